@@ -0,0 +1,120 @@
+// Package jstest runs scripts in a fresh gojs runtime for the tests of the
+// runtime and modules packages.
+package jstest
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gojs/modules"
+	"gojs/runtime"
+)
+
+// DefaultTimeout bounds the runs of Run and RunWith
+const DefaultTimeout = 10 * time.Second
+
+// Run runs script in a new runtime, including its event loop, and returns
+// what it printed to the console
+func Run(t *testing.T, script string) (string, error) {
+	t.Helper()
+	return RunWith(t, runtime.Options{}, script)
+}
+
+// RunWith is Run with a runtime configured by opts. Unless opts sets its
+// own Console, what the script printed to stdout and stderr is returned.
+// Without a Timeout, runs are bounded by DefaultTimeout so that a hanging
+// loop fails the test instead of blocking it.
+func RunWith(t *testing.T, opts runtime.Options, script string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	if opts.Console == nil {
+		opts.Console = modules.NewTextSink(&out, &out)
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	_, err := runtime.NewWithOptions(opts).RunScript(script, "test.js")
+	return out.String(), err
+}
+
+// RunFile runs the file at path in a new runtime and returns what it printed
+// to the console
+func RunFile(t *testing.T, path string) (string, error) {
+	t.Helper()
+	var err error
+	out := Capture(t, func() {
+		err = runtime.New().RunFile(path)
+	})
+	return out, err
+}
+
+// WriteFiles creates files, keyed by slash-separated paths relative to dir,
+// along with their parent directories
+func WriteFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// ExpectOutput runs script and fails unless it succeeds and prints want
+func ExpectOutput(t *testing.T, script, want string) {
+	t.Helper()
+	ExpectOutputWith(t, runtime.Options{}, script, want)
+}
+
+// ExpectOutputWith is ExpectOutput with a runtime configured by opts
+func ExpectOutputWith(t *testing.T, opts runtime.Options, script, want string) {
+	t.Helper()
+	got, err := RunWith(t, opts, script)
+	if err != nil {
+		t.Fatalf("script failed: %v\noutput:\n%s", err, got)
+	}
+	if got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+// Capture returns what fn writes to standard output, where the console of a
+// runtime created inside fn without Options.Console prints
+func Capture(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	done := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		r.Close()
+		done <- buf.String()
+	}()
+
+	fn()
+	w.Close()
+	return <-done
+}
+
+// Quote returns path as a JS string literal
+func Quote(path string) string {
+	return "'" + strings.ReplaceAll(filepath.ToSlash(path), "'", `\'`) + "'"
+}
@@ -262,7 +262,7 @@ func (l *Lexer) readNumber(line, column int) token.Token {
 	}
 
 	literal := l.input[position:l.position]
-	tokenType := token.INT
+	var tokenType token.TokenType = token.INT
 	if isFloat {
 		tokenType = token.FLOAT
 	}
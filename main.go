@@ -1,9 +1,15 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"gojs/modules"
 	"gojs/repl"
 	"gojs/runtime"
 )
@@ -13,16 +19,7 @@ func main() {
 
 	// If no arguments, start REPL
 	if len(args) == 0 {
-		defer func() {
-			if r := recover(); r != nil {
-				if r == "exit" {
-					os.Exit(0)
-				}
-				panic(r)
-			}
-		}()
-		repl.Start(os.Stdin, os.Stdout)
-		return
+		os.Exit(repl.Start(os.Stdin, os.Stdout))
 	}
 
 	// Check for flags
@@ -36,32 +33,152 @@ func main() {
 		return
 	}
 
+	// Parse runtime options that precede the file name
+	rejectionMode := runtime.UnhandledRejectionsThrow
+	var opts runtime.Options
+
+	// Any permission flag turns on the permission model: everything that
+	// is not granted is denied
+	permissions := func() *modules.Permissions {
+		if opts.Permissions == nil {
+			opts.Permissions = &modules.Permissions{}
+		}
+		return opts.Permissions
+	}
+	allPaths := []string{string(filepath.Separator)}
+
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		arg := args[0]
+		switch {
+		case arg == "--allow-read":
+			permissions().AllowRead = allPaths
+		case strings.HasPrefix(arg, "--allow-read="):
+			p := permissions()
+			p.AllowRead = append(p.AllowRead, splitPaths(strings.TrimPrefix(arg, "--allow-read="))...)
+		case arg == "--allow-write":
+			permissions().AllowWrite = allPaths
+		case strings.HasPrefix(arg, "--allow-write="):
+			p := permissions()
+			p.AllowWrite = append(p.AllowWrite, splitPaths(strings.TrimPrefix(arg, "--allow-write="))...)
+		case arg == "--allow-env":
+			permissions().AllowEnv = true
+		case arg == "--allow-child-process":
+			permissions().AllowChildProcess = true
+		case arg == "--deny-require":
+			permissions().DenyRequire = true
+		case strings.HasPrefix(arg, "--timeout="):
+			opts.Timeout = time.Duration(positiveInt(arg, "--timeout=")) * time.Millisecond
+		case strings.HasPrefix(arg, "--max-call-stack-size="):
+			opts.MaxCallStackSize = positiveInt(arg, "--max-call-stack-size=")
+		case strings.HasPrefix(arg, "--max-heap-size="):
+			opts.MaxHeapBytes = uint64(positiveInt(arg, "--max-heap-size=")) << 20
+		case strings.HasPrefix(arg, "--log-format="):
+			switch format := strings.TrimPrefix(arg, "--log-format="); format {
+			case "text":
+				opts.Console = nil
+			case "json":
+				opts.Console = modules.NewJSONSink(os.Stdout)
+			default:
+				fmt.Fprintf(os.Stderr, "Error: invalid value for --log-format: %s\n", format)
+				os.Exit(9)
+			}
+		case strings.HasPrefix(arg, "--unhandled-rejections="):
+			mode, err := runtime.ParseUnhandledRejectionMode(strings.TrimPrefix(arg, "--unhandled-rejections="))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(9)
+			}
+			rejectionMode = mode
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unknown option %s\n", arg)
+			os.Exit(9)
+		}
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no file specified")
+		os.Exit(9)
+	}
+
 	// Otherwise, treat first argument as a file to execute
 	filename := args[0]
 
-	rt := runtime.New()
+	rt := runtime.NewWithOptions(opts)
+	rt.SetUnhandledRejectionMode(rejectionMode)
+	rt.SetArgs(args[1:])
 	if err := rt.RunFile(filename); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		var exitErr *runtime.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
+		fmt.Fprintf(os.Stderr, "Error: %s\n", modules.ErrorString(err))
 		os.Exit(1)
 	}
 }
 
+// splitPaths splits the comma-separated value of a permission flag
+func splitPaths(value string) []string {
+	var paths []string
+	for _, path := range strings.Split(value, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// positiveInt parses the value of a numeric flag, exiting on invalid input
+func positiveInt(arg, prefix string) int {
+	n, err := strconv.Atoi(strings.TrimPrefix(arg, prefix))
+	if err != nil || n <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid value for %s\n", strings.TrimSuffix(prefix, "="))
+		os.Exit(9)
+	}
+	return n
+}
+
 func printHelp() {
 	fmt.Println("GoJS - A JavaScript runtime written in Go")
 	fmt.Println()
 	fmt.Println("Usage:")
-	fmt.Println("  gojs [file.js]     Run a JavaScript file")
+	fmt.Println("  gojs [options] [file.js] [args...]")
+	fmt.Println("                     Run a JavaScript file")
 	fmt.Println("  gojs               Start REPL (interactive mode)")
 	fmt.Println()
 	fmt.Println("Options:")
 	fmt.Println("  -h, --help         Show this help message")
 	fmt.Println("  -v, --version      Show version")
+	fmt.Println("  --unhandled-rejections=MODE")
+	fmt.Println("                     How to treat unhandled promise rejections:")
+	fmt.Println("                     throw (default), strict, warn or none")
+	fmt.Println("  --log-format=FORMAT")
+	fmt.Println("                     Write console output as text (default) or as")
+	fmt.Println("                     json, one object per line")
+	fmt.Println()
+	fmt.Println("Limits:")
+	fmt.Println("  --timeout=MS       Stop the script after MS milliseconds")
+	fmt.Println("  --max-call-stack-size=N")
+	fmt.Println("                     Limit nested function calls to N")
+	fmt.Println("  --max-heap-size=MB Stop the script when the heap exceeds MB megabytes")
+	fmt.Println()
+	fmt.Println("Permissions (any of these denies everything not granted):")
+	fmt.Println("  --allow-read[=PATHS]")
+	fmt.Println("                     Allow reading the comma-separated files and")
+	fmt.Println("                     directories, or everything if no paths are given")
+	fmt.Println("  --allow-write[=PATHS]")
+	fmt.Println("                     Allow writing, like --allow-read")
+	fmt.Println("  --allow-env        Allow access to environment variables")
+	fmt.Println("  --allow-child-process")
+	fmt.Println("                     Allow running other programs")
+	fmt.Println("  --deny-require     Disallow loading modules from files")
 	fmt.Println()
 	fmt.Println("Features:")
 	fmt.Println("  - Event loop with macrotasks and microtasks")
 	fmt.Println("  - Promise support (async/await)")
 	fmt.Println("  - Timers (setTimeout, setInterval)")
 	fmt.Println("  - Node.js-style modules (fs, path)")
+	fmt.Println("  - ES modules (.mjs, \"type\": \"module\")")
 	fmt.Println("  - Console API")
 	fmt.Println()
 	fmt.Println("Examples:")
@@ -0,0 +1,205 @@
+package modules
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// abortSignal is the state of an AbortSignal
+type abortSignal struct {
+	obj     *goja.Object
+	aborted bool
+	reason  goja.Value
+
+	// algorithms run when the signal aborts, before the 'abort' event
+	algorithms []*abortAlgorithm
+	timer      *time.Timer
+}
+
+type abortAlgorithm struct {
+	fn      func()
+	removed bool
+}
+
+// setupAbort creates AbortController and AbortSignal
+func (c *eventTargetClasses) setupAbort() {
+	vm := c.vm
+	var proto *goja.Object
+	c.signal, proto = newClass(vm, "AbortSignal", c.target, func(this *goja.Object, args []goja.Value) {
+		panic(NewNodeError(vm, "TypeError", "ERR_ILLEGAL_CONSTRUCTOR", "Illegal constructor"))
+	})
+
+	signalOf := func(this goja.Value) *abortSignal {
+		s, ok := c.signalOf(this)
+		if !ok {
+			panic(NewNodeError(vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be of type AbortSignal"))
+		}
+		return s
+	}
+	proto.DefineAccessorProperty("aborted", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(signalOf(call.This).aborted)
+	}), nil, goja.FLAG_TRUE, goja.FLAG_TRUE)
+	proto.DefineAccessorProperty("reason", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		if s := signalOf(call.This); s.reason != nil {
+			return s.reason
+		}
+		return goja.Undefined()
+	}), nil, goja.FLAG_TRUE, goja.FLAG_TRUE)
+	proto.Set("throwIfAborted", func(call goja.FunctionCall) goja.Value {
+		if s := signalOf(call.This); s.aborted {
+			panic(s.reason)
+		}
+		return goja.Undefined()
+	})
+	c.eventHandler(proto, "abort")
+	proto.DefineDataPropertySymbol(goja.SymToStringTag, vm.ToValue("AbortSignal"), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	// AbortSignal.abort([reason]) returns an already aborted signal
+	c.signal.Set("abort", func(call goja.FunctionCall) goja.Value {
+		s := c.newSignal()
+		c.abort(s, call.Argument(0))
+		return s.obj
+	})
+
+	// AbortSignal.timeout(delay) returns a signal aborted with a
+	// TimeoutError after delay milliseconds. Like the timer of Node.js, it
+	// does not keep the loop alive.
+	c.signal.Set("timeout", func(call goja.FunctionCall) goja.Value {
+		delay := call.Argument(0)
+		if !isNumber(delay) {
+			panic(ErrInvalidArgType(vm, "delay", "of type number", delay))
+		}
+		if d := delay.ToFloat(); d < 0 || d > math.MaxUint32 || d != math.Trunc(d) {
+			panic(errOutOfRange(vm, "delay", ">= 0 && <= 4294967295", delay))
+		}
+		s := c.newSignal()
+		s.timer = time.AfterFunc(time.Duration(delay.ToInteger())*time.Millisecond, func() {
+			c.loop.RunOnLoop(func(*goja.Runtime) {
+				c.abort(s, c.newDOMException("The operation was aborted due to timeout", "TimeoutError"))
+			})
+		})
+		return s.obj
+	})
+
+	// AbortSignal.any(signals) returns a signal aborted with the first of
+	// signals to abort
+	c.signal.Set("any", func(call goja.FunctionCall) goja.Value {
+		arg, ok := call.Argument(0).(*goja.Object)
+		if !ok {
+			panic(ErrInvalidArgType(vm, "signals", "an instance of Array", call.Argument(0)))
+		}
+		var sources []*abortSignal
+		for i, v := range iterableValues(vm, arg) {
+			source, ok := c.signalOf(v)
+			if !ok {
+				panic(ErrInvalidArgType(vm, "signals["+strconv.Itoa(i)+"]", "an instance of AbortSignal", v))
+			}
+			sources = append(sources, source)
+		}
+		s := c.newSignal()
+		for _, source := range sources {
+			if source.aborted {
+				c.abort(s, source.reason)
+				return s.obj
+			}
+		}
+		for _, source := range sources {
+			source := source
+			source.onAbort(func() { c.abort(s, source.reason) })
+		}
+		return s.obj
+	})
+
+	// AbortController() owns a signal that abort() aborts
+	var controllerProto *goja.Object
+	c.controller, controllerProto = newClass(vm, "AbortController", nil, func(this *goja.Object, args []goja.Value) {
+		this.DefineDataPropertySymbol(c.signalKey, c.newSignal().obj, goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	})
+	controllerSignal := func(this goja.Value) *goja.Object {
+		if obj, ok := this.(*goja.Object); ok {
+			if signal, ok := obj.GetSymbol(c.signalKey).(*goja.Object); ok {
+				return signal
+			}
+		}
+		panic(NewNodeError(vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be of type AbortController"))
+	}
+	controllerProto.DefineAccessorProperty("signal", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return controllerSignal(call.This)
+	}), nil, goja.FLAG_TRUE, goja.FLAG_TRUE)
+	controllerProto.Set("abort", func(call goja.FunctionCall) goja.Value {
+		s, _ := c.signalOf(controllerSignal(call.This))
+		c.abort(s, call.Argument(0))
+		return goja.Undefined()
+	})
+	controllerProto.DefineDataPropertySymbol(goja.SymToStringTag, vm.ToValue("AbortController"), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	if custom := inspectorOf(vm).custom; custom != nil {
+		proto.SetSymbol(custom, func(call goja.FunctionCall) goja.Value {
+			return inspectObject(vm, c.signal, "aborted", signalOf(call.This).aborted)
+		})
+		controllerProto.SetSymbol(custom, func(call goja.FunctionCall) goja.Value {
+			return inspectObject(vm, c.controller, "signal", controllerSignal(call.This))
+		})
+	}
+}
+
+// newSignal creates an AbortSignal that is not aborted
+func (c *eventTargetClasses) newSignal() *abortSignal {
+	obj := c.vm.NewObject()
+	obj.SetPrototype(c.signal.Get("prototype").ToObject(c.vm))
+	s := &abortSignal{obj: obj}
+	obj.DefineDataPropertySymbol(c.signalKey, c.vm.ToValue(s), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	c.targetOf(obj)
+	return s
+}
+
+// signalOf returns the state of the AbortSignal v
+func (c *eventTargetClasses) signalOf(v goja.Value) (*abortSignal, bool) {
+	if obj, ok := v.(*goja.Object); ok {
+		s, ok := exportSymbol(obj, c.signalKey).(*abortSignal)
+		return s, ok
+	}
+	return nil, false
+}
+
+// abort aborts s with reason, an AbortError DOMException if undefined, and
+// fires its 'abort' event
+func (c *eventTargetClasses) abort(s *abortSignal, reason goja.Value) {
+	if s.aborted {
+		return
+	}
+	if reason == nil || goja.IsUndefined(reason) {
+		reason = c.newDOMException("This operation was aborted", "AbortError")
+	}
+	s.aborted, s.reason = true, reason
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	algorithms := s.algorithms
+	s.algorithms = nil
+	for _, a := range algorithms {
+		if !a.removed {
+			a.fn()
+		}
+	}
+	c.dispatch(s.obj, c.newEvent("abort"))
+}
+
+// onAbort runs fn when s aborts, unless the returned function is called
+// first
+func (s *abortSignal) onAbort(fn func()) (remove func()) {
+	a := &abortAlgorithm{fn: fn}
+	s.algorithms = append(s.algorithms, a)
+	return func() {
+		a.removed = true
+		for i, other := range s.algorithms {
+			if other == a {
+				s.algorithms = append(s.algorithms[:i:i], s.algorithms[i+1:]...)
+				return
+			}
+		}
+	}
+}
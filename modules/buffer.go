@@ -0,0 +1,786 @@
+package modules
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+const (
+	// bufferMaxLength is the largest Buffer that can be allocated
+	bufferMaxLength = 1 << 32
+	// bufferInspectMaxBytes is how many bytes util.inspect shows of a Buffer
+	bufferInspectMaxBytes = 50
+)
+
+// bufferState holds the Buffer constructor and the intrinsics it builds on.
+// Buffers are Uint8Arrays whose prototype is Buffer.prototype, so they work
+// with every TypedArray method and with typed array code written for the web.
+type bufferState struct {
+	vm         *goja.Runtime
+	ctor       *goja.Object
+	proto      *goja.Object
+	uint8Array *goja.Object
+	isView     goja.Callable
+	subarray   goja.Callable
+}
+
+// bufferOf returns the Buffer state of vm, creating it on first use
+func bufferOf(vm *goja.Runtime) *bufferState {
+	if val := vm.GlobalObject().Get("__buffer"); val != nil {
+		if b, ok := val.Export().(*bufferState); ok {
+			return b
+		}
+	}
+	b := newBufferState(vm)
+	vm.GlobalObject().DefineDataProperty("__buffer", vm.ToValue(b), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	return b
+}
+
+// SetupBuffer sets up the Buffer global and the buffer module
+func SetupBuffer(vm *goja.Runtime) error {
+	b := bufferOf(vm)
+	vm.GlobalObject().DefineDataProperty("Buffer", b.ctor, goja.FLAG_TRUE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	constants := vm.NewObject()
+	constants.Set("MAX_LENGTH", bufferMaxLength)
+
+	buffer := vm.NewObject()
+	buffer.Set("Buffer", b.ctor)
+	buffer.Set("kMaxLength", bufferMaxLength)
+	buffer.Set("INSPECT_MAX_BYTES", bufferInspectMaxBytes)
+	buffer.Set("constants", constants)
+
+	// Register buffer module
+	return RegisterModule(vm, "buffer", buffer)
+}
+
+// NewBuffer returns a Buffer backed by data, which is shared, not copied
+func NewBuffer(vm *goja.Runtime, data []byte) *goja.Object {
+	b := bufferOf(vm)
+	return b.view(vm.ToValue(vm.NewArrayBuffer(data)))
+}
+
+// BufferBytes returns the bytes of a Buffer, TypedArray, DataView or
+// ArrayBuffer. The slice shares memory with the JS value.
+func BufferBytes(vm *goja.Runtime, v goja.Value) ([]byte, bool) {
+	return bufferOf(vm).bytes(v)
+}
+
+func newBufferState(vm *goja.Runtime) *bufferState {
+	uint8Array := vm.Get("Uint8Array").ToObject(vm)
+	uint8Proto := uint8Array.Get("prototype").ToObject(vm)
+	isView, _ := goja.AssertFunction(vm.Get("ArrayBuffer").ToObject(vm).Get("isView"))
+	subarray, _ := goja.AssertFunction(uint8Proto.Get("subarray"))
+
+	b := &bufferState{
+		vm:         vm,
+		uint8Array: uint8Array,
+		isView:     isView,
+		subarray:   subarray,
+	}
+
+	// Buffer(arg, encodingOrOffset, length) is the deprecated form of
+	// Buffer.from and Buffer.alloc. TypedArray methods also construct
+	// Buffers through it, with a length or an (arrayBuffer, offset, length).
+	b.ctor = vm.ToValue(func(call goja.ConstructorCall) *goja.Object {
+		if isNumber(call.Argument(0)) {
+			return b.alloc(call.Argument(0))
+		}
+		return b.from(call.Arguments)
+	}).ToObject(vm)
+	b.ctor.DefineDataProperty("name", vm.ToValue("Buffer"), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	b.ctor.SetPrototype(uint8Array)
+
+	b.proto = vm.NewObject()
+	b.proto.SetPrototype(uint8Proto)
+	b.proto.DefineDataProperty("constructor", b.ctor, goja.FLAG_TRUE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	b.ctor.DefineDataProperty("prototype", b.proto, goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+
+	b.setupStatics()
+	b.setupMethods()
+	b.setupNumberMethods()
+	return b
+}
+
+// setupStatics adds Buffer.from, Buffer.alloc and the other static methods
+func (b *bufferState) setupStatics() {
+	vm := b.vm
+	ctor := b.ctor
+
+	ctor.Set("poolSize", 8192)
+
+	// Buffer.from(string[, encoding]), Buffer.from(array | buffer) and
+	// Buffer.from(arrayBuffer[, byteOffset[, length]])
+	ctor.Set("from", func(call goja.FunctionCall) goja.Value {
+		return b.from(call.Arguments)
+	})
+
+	// Buffer.alloc(size[, fill[, encoding]])
+	ctor.Set("alloc", func(call goja.FunctionCall) goja.Value {
+		buf := b.alloc(call.Argument(0))
+		if fill := call.Argument(1); !goja.IsUndefined(fill) {
+			data, _ := b.bytes(buf)
+			b.fill(data, fill, b.encoding(call.Argument(2)))
+		}
+		return buf
+	})
+
+	// Buffer.allocUnsafe(size) / Buffer.allocUnsafeSlow(size). Go zeroes
+	// all memory, so these are as safe as alloc.
+	allocUnsafe := func(call goja.FunctionCall) goja.Value {
+		return b.alloc(call.Argument(0))
+	}
+	ctor.Set("allocUnsafe", allocUnsafe)
+	ctor.Set("allocUnsafeSlow", allocUnsafe)
+
+	// Buffer.concat(list[, totalLength])
+	ctor.Set("concat", func(call goja.FunctionCall) goja.Value {
+		list, ok := call.Argument(0).(*goja.Object)
+		if !ok || list.ClassName() != "Array" {
+			panic(ErrInvalidArgType(vm, "list", "an instance of Array", call.Argument(0)))
+		}
+
+		var parts [][]byte
+		total := 0
+		for i := 0; i < int(list.Get("length").ToInteger()); i++ {
+			item := list.Get(fmt.Sprint(i))
+			data, ok := b.uint8Bytes(item)
+			if !ok {
+				panic(ErrInvalidArgType(vm, fmt.Sprintf("list[%d]", i), "an instance of Buffer or Uint8Array", item))
+			}
+			parts = append(parts, data)
+			total += len(data)
+		}
+		if length := call.Argument(1); !goja.IsUndefined(length) {
+			total = b.size(length, "length")
+		}
+
+		out := make([]byte, 0, total)
+		for _, part := range parts {
+			if len(out)+len(part) > total {
+				part = part[:total-len(out)]
+			}
+			out = append(out, part...)
+		}
+		return NewBuffer(vm, out[:total])
+	})
+
+	// Buffer.byteLength(string[, encoding]) also accepts binary data
+	ctor.Set("byteLength", func(call goja.FunctionCall) goja.Value {
+		arg := call.Argument(0)
+		if s, ok := arg.Export().(string); ok {
+			return vm.ToValue(len(encodeString(s, b.encoding(call.Argument(1)))))
+		}
+		data, ok := b.bytes(arg)
+		if !ok {
+			panic(ErrInvalidArgType(vm, "string", "of type string or an instance of Buffer or ArrayBuffer", arg))
+		}
+		return vm.ToValue(len(data))
+	})
+
+	// Buffer.compare(a, b) orders buffers for Array.prototype.sort
+	ctor.Set("compare", func(call goja.FunctionCall) goja.Value {
+		x := b.argBytes(call.Argument(0), "buf1")
+		y := b.argBytes(call.Argument(1), "buf2")
+		return vm.ToValue(bytes.Compare(x, y))
+	})
+
+	ctor.Set("isBuffer", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(vm.InstanceOf(call.Argument(0), b.ctor))
+	})
+
+	ctor.Set("isEncoding", func(call goja.FunctionCall) goja.Value {
+		name, ok := call.Argument(0).Export().(string)
+		if !ok {
+			return vm.ToValue(false)
+		}
+		_, ok = normalizeEncoding(name)
+		return vm.ToValue(ok)
+	})
+}
+
+// setupMethods adds the methods of Buffer.prototype other than the numeric
+// readers and writers
+func (b *bufferState) setupMethods() {
+	vm := b.vm
+	proto := b.proto
+
+	// buf.toString([encoding[, start[, end]]])
+	toString := func(call goja.FunctionCall) goja.Value {
+		data := b.this(call)
+		encoding := b.encoding(call.Argument(0))
+		start, end := b.span(len(data), call.Argument(1), call.Argument(2))
+		return vm.ToValue(decodeBytes(data[start:end], encoding))
+	}
+	proto.Set("toString", toString)
+	proto.Set("toLocaleString", toString)
+
+	// buf.toJSON() is used by JSON.stringify
+	proto.Set("toJSON", func(call goja.FunctionCall) goja.Value {
+		data := b.this(call)
+		values := make([]interface{}, len(data))
+		for i, v := range data {
+			values[i] = v
+		}
+		json := vm.NewObject()
+		json.Set("type", "Buffer")
+		json.Set("data", vm.NewArray(values...))
+		return json
+	})
+
+	// buf.equals(otherBuffer)
+	proto.Set("equals", func(call goja.FunctionCall) goja.Value {
+		data := b.this(call)
+		return vm.ToValue(bytes.Equal(data, b.argBytes(call.Argument(0), "otherBuffer")))
+	})
+
+	// buf.compare(target[, targetStart[, targetEnd[, sourceStart[, sourceEnd]]]])
+	proto.Set("compare", func(call goja.FunctionCall) goja.Value {
+		data := b.this(call)
+		target := b.argBytes(call.Argument(0), "target")
+		targetStart := b.index(call.Argument(1), 0, len(target), "targetStart")
+		targetEnd := b.index(call.Argument(2), len(target), len(target), "targetEnd")
+		sourceStart := b.index(call.Argument(3), 0, len(data), "sourceStart")
+		sourceEnd := b.index(call.Argument(4), len(data), len(data), "sourceEnd")
+		if targetStart > targetEnd {
+			targetStart = targetEnd
+		}
+		if sourceStart > sourceEnd {
+			sourceStart = sourceEnd
+		}
+		return vm.ToValue(bytes.Compare(data[sourceStart:sourceEnd], target[targetStart:targetEnd]))
+	})
+
+	// buf.copy(target[, targetStart[, sourceStart[, sourceEnd]]]) returns the
+	// number of bytes copied. Overlapping regions are handled.
+	proto.Set("copy", func(call goja.FunctionCall) goja.Value {
+		data := b.this(call)
+		target := b.argBytes(call.Argument(0), "target")
+		targetStart := b.index(call.Argument(1), 0, len(target), "targetStart")
+		sourceStart := b.index(call.Argument(2), 0, len(data), "sourceStart")
+		sourceEnd := b.index(call.Argument(3), len(data), len(data), "sourceEnd")
+		if sourceStart >= sourceEnd {
+			return vm.ToValue(0)
+		}
+		return vm.ToValue(copy(target[targetStart:], data[sourceStart:sourceEnd]))
+	})
+
+	// buf.fill(value[, offset[, end]][, encoding])
+	proto.Set("fill", func(call goja.FunctionCall) goja.Value {
+		data := b.this(call)
+		offset, end, encoding := call.Argument(1), call.Argument(2), call.Argument(3)
+		if _, ok := offset.Export().(string); ok {
+			offset, end, encoding = goja.Undefined(), goja.Undefined(), offset
+		} else if _, ok := end.Export().(string); ok {
+			end, encoding = goja.Undefined(), end
+		}
+		start := b.index(offset, 0, len(data), "offset")
+		stop := b.index(end, len(data), len(data), "end")
+		if start < stop {
+			b.fill(data[start:stop], call.Argument(0), b.encoding(encoding))
+		}
+		return call.This
+	})
+
+	// buf.write(string[, offset[, length]][, encoding]) returns the number of
+	// bytes written. A UTF-8 character that does not fit is left out.
+	proto.Set("write", func(call goja.FunctionCall) goja.Value {
+		data := b.this(call)
+		s, ok := call.Argument(0).Export().(string)
+		if !ok {
+			panic(ErrInvalidArgType(vm, "string", "of type string", call.Argument(0)))
+		}
+		args := append(call.Arguments[1:len(call.Arguments):len(call.Arguments)], goja.Undefined(), goja.Undefined(), goja.Undefined())
+		offset, length, encoding := args[0], args[1], args[2]
+		if _, ok := offset.Export().(string); ok {
+			offset, length, encoding = goja.Undefined(), goja.Undefined(), offset
+		} else if _, ok := length.Export().(string); ok {
+			length, encoding = goja.Undefined(), length
+		}
+
+		start := b.index(offset, 0, len(data), "offset")
+		max := b.index(length, len(data)-start, len(data)-start, "length")
+		enc := b.encoding(encoding)
+		encoded := encodeString(s, enc)
+		n := len(encoded)
+		if n > max {
+			n = max
+			if enc == encodingUTF8 {
+				for n > 0 && encoded[n]&0xc0 == 0x80 {
+					n--
+				}
+			}
+		}
+		return vm.ToValue(copy(data[start:start+n], encoded))
+	})
+
+	// buf.indexOf / buf.lastIndexOf / buf.includes (value[, byteOffset][, encoding])
+	search := func(call goja.FunctionCall, last bool) int {
+		data := b.this(call)
+		offset, encoding := call.Argument(1), call.Argument(2)
+		if _, ok := offset.Export().(string); ok {
+			offset, encoding = goja.Undefined(), offset
+		}
+
+		var needle []byte
+		value := call.Argument(0)
+		if s, ok := value.Export().(string); ok {
+			needle = encodeString(s, b.encoding(encoding))
+		} else if isNumber(value) {
+			needle = []byte{byte(value.ToInteger())}
+		} else {
+			needle = b.argBytes(value, "value")
+		}
+
+		from := 0
+		if last {
+			from = len(data)
+		}
+		if !goja.IsUndefined(offset) {
+			from = int(offset.ToInteger())
+			if from < 0 {
+				from += len(data)
+			}
+		}
+		if last {
+			if from < 0 {
+				return -1
+			}
+			if end := from + len(needle); end < len(data) {
+				data = data[:end]
+			}
+			return bytes.LastIndex(data, needle)
+		}
+		if from < 0 {
+			from = 0
+		}
+		if from > len(data) {
+			return -1
+		}
+		if i := bytes.Index(data[from:], needle); i >= 0 {
+			return from + i
+		}
+		return -1
+	}
+	proto.Set("indexOf", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(search(call, false))
+	})
+	proto.Set("lastIndexOf", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(search(call, true))
+	})
+	proto.Set("includes", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(search(call, false) >= 0)
+	})
+
+	// buf.slice([start[, end]]) returns a view of the same memory, like
+	// subarray and unlike TypedArray.prototype.slice
+	proto.Set("slice", func(call goja.FunctionCall) goja.Value {
+		view, err := b.subarray(call.This, call.Arguments...)
+		if err != nil {
+			panic(err)
+		}
+		return view
+	})
+
+	// buf.swap16() / buf.swap32() / buf.swap64() reverse the byte order in place
+	for _, size := range []int{2, 4, 8} {
+		size := size
+		proto.Set(fmt.Sprintf("swap%d", size*8), func(call goja.FunctionCall) goja.Value {
+			data := b.this(call)
+			if len(data)%size != 0 {
+				panic(NewNodeError(vm, "RangeError", "ERR_INVALID_BUFFER_SIZE", fmt.Sprintf("Buffer size must be a multiple of %d-bits", size*8)))
+			}
+			for i := 0; i < len(data); i += size {
+				word := data[i : i+size]
+				for j := 0; j < size/2; j++ {
+					word[j], word[size-1-j] = word[size-1-j], word[j]
+				}
+			}
+			return call.This
+		})
+	}
+
+	// util.inspect shows Buffers as <Buffer 68 69>
+	if custom := inspectorOf(vm).custom; custom != nil {
+		proto.SetSymbol(custom, func(call goja.FunctionCall) goja.Value {
+			data := b.this(call)
+			return vm.ToValue("<Buffer " + strings.TrimPrefix(formatBytes(data, bufferInspectMaxBytes), "<"))
+		})
+	}
+}
+
+// bufferNumber describes one of the fixed-size numbers the read and write
+// methods handle, such as UInt32LE
+type bufferNumber struct {
+	name         string
+	size         int
+	signed       bool
+	float        bool
+	bigint       bool
+	littleEndian bool
+}
+
+// setupNumberMethods adds buf.readUInt8, buf.writeDoubleBE and the other
+// numeric readers and writers, with their readUint* aliases
+func (b *bufferState) setupNumberMethods() {
+	vm := b.vm
+
+	var numbers []bufferNumber
+	for _, size := range []int{1, 2, 4} {
+		for _, signed := range []bool{false, true} {
+			name := fmt.Sprintf("UInt%d", size*8)
+			if signed {
+				name = fmt.Sprintf("Int%d", size*8)
+			}
+			if size == 1 {
+				numbers = append(numbers, bufferNumber{name: name, size: size, signed: signed})
+				continue
+			}
+			numbers = append(numbers,
+				bufferNumber{name: name + "LE", size: size, signed: signed, littleEndian: true},
+				bufferNumber{name: name + "BE", size: size, signed: signed})
+		}
+	}
+	numbers = append(numbers,
+		bufferNumber{name: "FloatLE", size: 4, float: true, littleEndian: true},
+		bufferNumber{name: "FloatBE", size: 4, float: true},
+		bufferNumber{name: "DoubleLE", size: 8, float: true, littleEndian: true},
+		bufferNumber{name: "DoubleBE", size: 8, float: true},
+		bufferNumber{name: "BigUInt64LE", size: 8, bigint: true, littleEndian: true},
+		bufferNumber{name: "BigUInt64BE", size: 8, bigint: true},
+		bufferNumber{name: "BigInt64LE", size: 8, bigint: true, signed: true, littleEndian: true},
+		bufferNumber{name: "BigInt64BE", size: 8, bigint: true, signed: true})
+
+	for _, n := range numbers {
+		n := n
+		read := func(call goja.FunctionCall) goja.Value {
+			data := b.this(call)
+			offset := b.offset(call.Argument(0), n.size, len(data))
+			return n.read(vm, data[offset:offset+n.size])
+		}
+		write := func(call goja.FunctionCall) goja.Value {
+			data := b.this(call)
+			offset := b.offset(call.Argument(1), n.size, len(data))
+			n.write(vm, data[offset:offset+n.size], call.Argument(0))
+			return vm.ToValue(offset + n.size)
+		}
+		b.setNumberMethod("read"+n.name, read)
+		b.setNumberMethod("write"+n.name, write)
+	}
+
+	// buf.readUIntLE(offset, byteLength) and friends handle integers of 1 to
+	// 6 bytes
+	for _, signed := range []bool{false, true} {
+		for _, littleEndian := range []bool{true, false} {
+			name := "UInt"
+			if signed {
+				name = "Int"
+			}
+			if littleEndian {
+				name += "LE"
+			} else {
+				name += "BE"
+			}
+			number := func(byteLength goja.Value) bufferNumber {
+				size := int(b.integer(byteLength, "byteLength"))
+				if size < 1 || size > 6 {
+					panic(errOutOfRange(vm, "byteLength", ">= 1 and <= 6", size))
+				}
+				return bufferNumber{size: size, signed: signed, littleEndian: littleEndian}
+			}
+			b.setNumberMethod("read"+name, func(call goja.FunctionCall) goja.Value {
+				data := b.this(call)
+				n := number(call.Argument(1))
+				offset := b.offset(call.Argument(0), n.size, len(data))
+				return n.read(vm, data[offset:offset+n.size])
+			})
+			b.setNumberMethod("write"+name, func(call goja.FunctionCall) goja.Value {
+				data := b.this(call)
+				n := number(call.Argument(2))
+				offset := b.offset(call.Argument(1), n.size, len(data))
+				n.write(vm, data[offset:offset+n.size], call.Argument(0))
+				return vm.ToValue(offset + n.size)
+			})
+		}
+	}
+}
+
+// setNumberMethod adds a numeric method under its name and, for the UInt
+// methods, under the Uint alias as well
+func (b *bufferState) setNumberMethod(name string, fn func(goja.FunctionCall) goja.Value) {
+	method := b.vm.ToValue(fn)
+	b.proto.Set(name, method)
+	if alias := strings.Replace(name, "UInt", "Uint", 1); alias != name {
+		b.proto.Set(alias, method)
+	}
+}
+
+// read decodes the number stored in data
+func (n bufferNumber) read(vm *goja.Runtime, data []byte) goja.Value {
+	var u uint64
+	for i := 0; i < n.size; i++ {
+		if n.littleEndian {
+			u |= uint64(data[i]) << (8 * i)
+		} else {
+			u = u<<8 | uint64(data[i])
+		}
+	}
+
+	switch {
+	case n.float && n.size == 4:
+		return vm.ToValue(float64(math.Float32frombits(uint32(u))))
+	case n.float:
+		return vm.ToValue(math.Float64frombits(u))
+	case n.bigint && n.signed:
+		return vm.ToValue(big.NewInt(int64(u)))
+	case n.bigint:
+		return vm.ToValue(new(big.Int).SetUint64(u))
+	case n.signed:
+		// Sign-extend from the top bit of the number
+		shift := uint(64 - 8*n.size)
+		return vm.ToValue(int64(u<<shift) >> shift)
+	}
+	return vm.ToValue(u)
+}
+
+// write encodes value into data, throwing a RangeError for integers that
+// do not fit
+func (n bufferNumber) write(vm *goja.Runtime, data []byte, value goja.Value) {
+	var u uint64
+	switch {
+	case n.float && n.size == 4:
+		u = uint64(math.Float32bits(float32(value.ToFloat())))
+	case n.float:
+		u = math.Float64bits(value.ToFloat())
+	case n.bigint:
+		i, ok := value.Export().(*big.Int)
+		if !ok {
+			panic(ErrInvalidArgType(vm, "value", "of type bigint", value))
+		}
+		min, max := big.NewInt(0), new(big.Int).SetUint64(math.MaxUint64)
+		if n.signed {
+			min, max = big.NewInt(math.MinInt64), big.NewInt(math.MaxInt64)
+		}
+		if i.Cmp(min) < 0 || i.Cmp(max) > 0 {
+			panic(errOutOfRange(vm, "value", fmt.Sprintf(">= %s and <= %s", min, max), i))
+		}
+		if n.signed {
+			u = uint64(i.Int64())
+		} else {
+			u = i.Uint64()
+		}
+	default:
+		f := value.ToFloat()
+		bits := uint(8 * n.size)
+		min, max := 0.0, math.Exp2(float64(bits))-1
+		if n.signed {
+			min, max = -math.Exp2(float64(bits-1)), math.Exp2(float64(bits-1))-1
+		}
+		if math.IsNaN(f) {
+			f = 0
+		}
+		if f < min || f > max {
+			panic(errOutOfRange(vm, "value", fmt.Sprintf(">= %v and <= %v", min, max), value))
+		}
+		u = uint64(int64(f))
+	}
+
+	for i := 0; i < n.size; i++ {
+		if n.littleEndian {
+			data[i] = byte(u >> (8 * i))
+		} else {
+			data[n.size-1-i] = byte(u >> (8 * i))
+		}
+	}
+}
+
+// from implements Buffer.from
+func (b *bufferState) from(args []goja.Value) *goja.Object {
+	vm := b.vm
+	args = append(args[:len(args):len(args)], goja.Undefined(), goja.Undefined(), goja.Undefined())
+	value := args[0]
+
+	if s, ok := value.Export().(string); ok {
+		return NewBuffer(vm, encodeString(s, b.encoding(args[1])))
+	}
+
+	obj, ok := value.(*goja.Object)
+	if ok {
+		// A view of an ArrayBuffer shares its memory
+		if _, isArrayBuffer := obj.Export().(goja.ArrayBuffer); isArrayBuffer {
+			return b.view(args[:3]...)
+		}
+		// Typed arrays and array-likes are copied element by element
+		if length := obj.Get("length"); length != nil && !goja.IsUndefined(length) {
+			return b.view(obj)
+		}
+		// The result of buf.toJSON()
+		if data, isArray := obj.Get("data").(*goja.Object); isArray && data.ClassName() == "Array" && obj.Get("type").String() == "Buffer" {
+			return b.view(data)
+		}
+	}
+
+	panic(NewNodeError(vm, "TypeError", "ERR_INVALID_ARG_TYPE", "The first argument must be of type string or an instance of Buffer, ArrayBuffer, or Array or an Array-like Object. Received "+describeReceived(vm, value)))
+}
+
+// view constructs a Uint8Array from args and makes it a Buffer
+func (b *bufferState) view(args ...goja.Value) *goja.Object {
+	obj, err := b.vm.New(b.uint8Array, args...)
+	if err != nil {
+		panic(err)
+	}
+	obj.SetPrototype(b.proto)
+	return obj
+}
+
+// alloc returns a zero-filled Buffer of the given size
+func (b *bufferState) alloc(size goja.Value) *goja.Object {
+	return NewBuffer(b.vm, make([]byte, b.size(size, "size")))
+}
+
+// size validates a Buffer size argument
+func (b *bufferState) size(v goja.Value, name string) int {
+	if !isNumber(v) {
+		panic(ErrInvalidArgType(b.vm, name, "of type number", v))
+	}
+	f := v.ToFloat()
+	if math.IsNaN(f) || f < 0 || f > bufferMaxLength {
+		panic(errOutOfRange(b.vm, name, fmt.Sprintf(">= 0 && <= %d", bufferMaxLength), v))
+	}
+	return int(f)
+}
+
+// fill repeats value, a string, number or binary data, over data
+func (b *bufferState) fill(data []byte, value goja.Value, encoding string) {
+	var pattern []byte
+	if s, ok := value.Export().(string); ok {
+		pattern = encodeString(s, encoding)
+	} else if bin, ok := b.bytes(value); ok {
+		pattern = bin
+	} else {
+		pattern = []byte{byte(value.ToInteger())}
+	}
+	if len(pattern) == 0 {
+		pattern = []byte{0}
+	}
+	for i := 0; i < len(data); i += len(pattern) {
+		copy(data[i:], pattern)
+	}
+}
+
+// bytes returns the bytes of a TypedArray, DataView or ArrayBuffer
+func (b *bufferState) bytes(v goja.Value) ([]byte, bool) {
+	obj, ok := v.(*goja.Object)
+	if !ok {
+		return nil, false
+	}
+	if buf, ok := obj.Export().(goja.ArrayBuffer); ok {
+		return buf.Bytes(), true
+	}
+	if isView, err := b.isView(goja.Undefined(), obj); err != nil || !isView.ToBoolean() {
+		return nil, false
+	}
+	var data []byte
+	if err := b.vm.ExportTo(obj, &data); err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// uint8Bytes returns the bytes of a Buffer or Uint8Array
+func (b *bufferState) uint8Bytes(v goja.Value) ([]byte, bool) {
+	if !b.vm.InstanceOf(v, b.uint8Array) {
+		return nil, false
+	}
+	return b.bytes(v)
+}
+
+// argBytes returns the bytes of a Buffer or Uint8Array argument
+func (b *bufferState) argBytes(v goja.Value, name string) []byte {
+	data, ok := b.uint8Bytes(v)
+	if !ok {
+		panic(ErrInvalidArgType(b.vm, name, "an instance of Buffer or Uint8Array", v))
+	}
+	return data
+}
+
+// this returns the bytes of the Buffer a method was called on
+func (b *bufferState) this(call goja.FunctionCall) []byte {
+	data, ok := b.uint8Bytes(call.This)
+	if !ok {
+		panic(NewNodeError(b.vm, "TypeError", "ERR_INVALID_ARG_TYPE", "argument must be a buffer"))
+	}
+	return data
+}
+
+// encoding validates an encoding argument, defaulting to UTF-8
+func (b *bufferState) encoding(v goja.Value) string {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return encodingUTF8
+	}
+	name, ok := normalizeEncoding(v.String())
+	if !ok {
+		panic(NewNodeError(b.vm, "TypeError", "ERR_UNKNOWN_ENCODING", "Unknown encoding: "+v.String()))
+	}
+	return name
+}
+
+// integer validates an integer argument
+func (b *bufferState) integer(v goja.Value, name string) int64 {
+	if !isNumber(v) {
+		panic(ErrInvalidArgType(b.vm, name, "of type number", v))
+	}
+	f := v.ToFloat()
+	if f != math.Trunc(f) {
+		panic(errOutOfRange(b.vm, name, "an integer", v))
+	}
+	return int64(f)
+}
+
+// index validates an optional index argument in [0, max]
+func (b *bufferState) index(v goja.Value, def, max int, name string) int {
+	if v == nil || goja.IsUndefined(v) {
+		return def
+	}
+	i := b.integer(v, name)
+	if i < 0 || i > int64(max) {
+		panic(errOutOfRange(b.vm, name, fmt.Sprintf(">= 0 and <= %d", max), i))
+	}
+	return int(i)
+}
+
+// offset validates the offset of a number of size bytes in a buffer of
+// the given length
+func (b *bufferState) offset(v goja.Value, size, length int) int {
+	if length < size {
+		panic(NewNodeError(b.vm, "RangeError", "ERR_BUFFER_OUT_OF_BOUNDS", "Attempt to access memory outside buffer bounds"))
+	}
+	return b.index(v, 0, length-size, "offset")
+}
+
+// span clamps the start and end arguments of toString to [0, length]
+func (b *bufferState) span(length int, start, end goja.Value) (int, int) {
+	clamp := func(v goja.Value, def int) int {
+		if goja.IsUndefined(v) {
+			return def
+		}
+		i := v.ToInteger()
+		if i < 0 {
+			return 0
+		}
+		if i > int64(length) {
+			return length
+		}
+		return int(i)
+	}
+	s, e := clamp(start, 0), clamp(end, length)
+	if e < s {
+		e = s
+	}
+	return s, e
+}
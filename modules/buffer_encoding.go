@@ -0,0 +1,203 @@
+package modules
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Canonical names of the encodings Buffer and fs understand
+const (
+	encodingUTF8      = "utf8"
+	encodingUTF16LE   = "utf16le"
+	encodingLatin1    = "latin1"
+	encodingASCII     = "ascii"
+	encodingBase64    = "base64"
+	encodingBase64URL = "base64url"
+	encodingHex       = "hex"
+)
+
+// encodingAliases maps every accepted spelling of an encoding, in lower case,
+// to its canonical name
+var encodingAliases = map[string]string{
+	"utf8":      encodingUTF8,
+	"utf-8":     encodingUTF8,
+	"utf16le":   encodingUTF16LE,
+	"utf-16le":  encodingUTF16LE,
+	"ucs2":      encodingUTF16LE,
+	"ucs-2":     encodingUTF16LE,
+	"latin1":    encodingLatin1,
+	"binary":    encodingLatin1,
+	"ascii":     encodingASCII,
+	"base64":    encodingBase64,
+	"base64url": encodingBase64URL,
+	"hex":       encodingHex,
+}
+
+// normalizeEncoding returns the canonical name of encoding and whether it is
+// supported
+func normalizeEncoding(encoding string) (string, bool) {
+	name, ok := encodingAliases[strings.ToLower(encoding)]
+	return name, ok
+}
+
+// encodeString converts s to bytes in the given canonical encoding
+func encodeString(s string, encoding string) []byte {
+	switch encoding {
+	case encodingUTF16LE:
+		units := utf16.Encode([]rune(s))
+		data := make([]byte, 2*len(units))
+		for i, unit := range units {
+			data[2*i] = byte(unit)
+			data[2*i+1] = byte(unit >> 8)
+		}
+		return data
+	case encodingLatin1, encodingASCII:
+		// Each UTF-16 code unit keeps its low byte
+		units := utf16.Encode([]rune(s))
+		data := make([]byte, len(units))
+		for i, unit := range units {
+			data[i] = byte(unit)
+		}
+		return data
+	case encodingBase64, encodingBase64URL:
+		return decodeBase64(s)
+	case encodingHex:
+		return decodeHex(s)
+	}
+	return []byte(s)
+}
+
+// decodeBytes converts data in the given canonical encoding to a string
+func decodeBytes(data []byte, encoding string) string {
+	switch encoding {
+	case encodingUTF16LE:
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+		}
+		return string(utf16.Decode(units))
+	case encodingLatin1:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	case encodingASCII:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b & 0x7f)
+		}
+		return string(runes)
+	case encodingBase64:
+		return base64.StdEncoding.EncodeToString(data)
+	case encodingBase64URL:
+		return base64.RawURLEncoding.EncodeToString(data)
+	case encodingHex:
+		return hex.EncodeToString(data)
+	}
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	// Every invalid byte becomes U+FFFD
+	return string([]rune(string(data)))
+}
+
+// decodeBase64 decodes standard and URL-safe base64 alike. Like Node.js it
+// ignores whitespace, padding and other characters outside the alphabet.
+func decodeBase64(s string) []byte {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '+', c == '/':
+			b.WriteByte(c)
+		case c == '-':
+			b.WriteByte('+')
+		case c == '_':
+			b.WriteByte('/')
+		case c == '=':
+			// Padding ends the data
+			i = len(s)
+		}
+	}
+	clean := b.String()
+	if len(clean)%4 == 1 {
+		// A single trailing character carries no complete byte
+		clean = clean[:len(clean)-1]
+	}
+	data, _ := base64.RawStdEncoding.DecodeString(clean)
+	return data
+}
+
+// decodeHex decodes pairs of hex digits up to the first invalid pair
+func decodeHex(s string) []byte {
+	data := make([]byte, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		b, err := hex.DecodeString(s[i : i+2])
+		if err != nil {
+			break
+		}
+		data = append(data, b[0])
+	}
+	return data
+}
+
+// stringDecoder decodes a sequence of byte chunks to strings without
+// splitting characters that straddle two chunks, like Node.js's StringDecoder
+type stringDecoder struct {
+	encoding string
+	pending  []byte
+}
+
+// write decodes data, holding back the bytes of an incomplete character
+func (d *stringDecoder) write(data []byte) string {
+	data = append(d.pending, data...)
+	keep := 0
+	switch d.encoding {
+	case encodingUTF8:
+		keep = incompleteUTF8(data)
+	case encodingUTF16LE:
+		keep = len(data) % 2
+	case encodingBase64, encodingBase64URL:
+		keep = len(data) % 3
+	}
+	d.pending = append([]byte(nil), data[len(data)-keep:]...)
+	return decodeBytes(data[:len(data)-keep], d.encoding)
+}
+
+// end decodes the bytes still held back
+func (d *stringDecoder) end() string {
+	data := d.pending
+	d.pending = nil
+	if len(data) == 0 {
+		return ""
+	}
+	return decodeBytes(data, d.encoding)
+}
+
+// incompleteUTF8 returns the length of the incomplete UTF-8 sequence at the
+// end of data
+func incompleteUTF8(data []byte) int {
+	for i := 1; i <= 3 && i <= len(data); i++ {
+		b := data[len(data)-i]
+		if b&0xc0 == 0x80 {
+			continue
+		}
+		size := 1
+		switch {
+		case b&0xe0 == 0xc0:
+			size = 2
+		case b&0xf0 == 0xe0:
+			size = 3
+		case b&0xf8 == 0xf0:
+			size = 4
+		}
+		if size > i {
+			return i
+		}
+		return 0
+	}
+	return 0
+}
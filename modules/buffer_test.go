@@ -0,0 +1,93 @@
+package modules_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gojs/internal/jstest"
+)
+
+func TestBufferEncodings(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const b = Buffer.from('héllo');
+		console.log(b, b.length, b.toString('hex'), b.toString('base64'), b instanceof Uint8Array);
+		console.log(Buffer.from('aGk=', 'base64').toString(), Buffer.from('6869', 'hex').toString('latin1'), Buffer.byteLength('é'));
+		console.log(Buffer.from('hi', 'utf16le'), Buffer.from('a-_b', 'base64url'), Buffer.isEncoding('UTF-8'), Buffer.isEncoding('nope'));
+	`, "<Buffer 68 c3 a9 6c 6c 6f> 6 68c3a96c6c6f aMOpbGxv true\n"+
+		"hi hi 2\n"+
+		"<Buffer 68 00 69 00> <Buffer 6b ef db> true false\n")
+}
+
+func TestBufferSharesMemory(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const ab = new ArrayBuffer(4);
+		Buffer.from(ab, 1, 2)[0] = 7;
+		console.log(new Uint8Array(ab)[1]);
+		const b = Buffer.from('abc');
+		b.slice(1, 2)[0] = 0x41;
+		b.subarray(2)[0] = 0x42;
+		console.log(b.toString(), Buffer.from(b) === b);
+	`, "7\naAB false\n")
+}
+
+func TestBufferMethods(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		console.log(Buffer.concat([Buffer.from('a'), Buffer.from('bc')]).toString(), Buffer.compare(Buffer.from('a'), Buffer.from('b')), Buffer.isBuffer(Buffer.alloc(0)), Buffer.isBuffer(new Uint8Array(1)));
+		console.log(JSON.stringify(Buffer.from([1, 2])), Buffer.alloc(3, 'ab').toString(), Buffer.from('abcb').indexOf('b', 2), Buffer.from('abc').includes('bc'));
+		const target = Buffer.alloc(4, '.');
+		Buffer.from('xyz').copy(target, 1, 1);
+		console.log(target.toString(), Buffer.from('ab').equals(Buffer.from('ab')), Buffer.from([1, 2, 3, 4]).swap16());
+	`, "abc -1 true false\n"+
+		"{\"type\":\"Buffer\",\"data\":[1,2]} aba 3 true\n"+
+		".yz. true <Buffer 02 01 04 03>\n")
+}
+
+func TestBufferReadWriteNumbers(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const w = Buffer.alloc(8);
+		w.writeUInt32BE(0xdeadbeef, 0);
+		w.writeInt16LE(-2, 4);
+		console.log(w.readUInt32BE(0).toString(16), w.readInt16LE(4), w.readUint16LE(4), w.readBigUInt64BE(0));
+		w.writeDoubleLE(1.5);
+		console.log(w.readDoubleLE(0), w.readUIntBE(0, 3));
+		try { w.writeUInt8(256, 0); } catch (e) { console.log(e instanceof RangeError); }
+		try { w.readUInt32LE(6); } catch (e) { console.log(e instanceof RangeError); }
+	`, "deadbeef -2 65534 16045690985375531008n\n1.5 0\ntrue\ntrue\n")
+}
+
+func TestFSBinaryData(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "data.bin")
+	jstest.ExpectOutput(t, `
+		const fs = require('fs');
+		const file = `+jstest.Quote(file)+`;
+		fs.writeFileSync(file, Buffer.from([0, 255, 128, 10]));
+		const data = fs.readFileSync(file, null);
+		console.log(data, fs.readFileSync(file, 'hex'), fs.readFileSync(file, { encoding: null }).length);
+		fs.writeFileSync(file, 'aGk=', 'base64');
+		fs.writeFile(file + '2', new Uint16Array([1]), () => console.log(fs.readFileSync(file, 'utf8'), fs.readFileSync(file + '2', null)));
+	`, "<Buffer 00 ff 80 0a> 00ff800a 4\nhi <Buffer 01 00>\n")
+
+	if data, err := os.ReadFile(file); err != nil || string(data) != "hi" {
+		t.Errorf("file = %q, %v", data, err)
+	}
+}
+
+func TestFSReadFileReturnsBuffersByDefault(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "a.bin")
+	if err := os.WriteFile(file, []byte{0xff, 'a'}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	jstest.ExpectOutput(t, `
+		const fs = require('fs');
+		const file = `+jstest.Quote(file)+`;
+		const show = (data) => console.log(Buffer.isBuffer(data), data.length);
+		show(fs.readFileSync(file));
+		show(fs.readFileSync(file, 'latin1'));
+		fs.readFile(file, (err, data) => {
+			show(data);
+			fs.promises.readFile(file, { encoding: 'utf8' }).then(show);
+		});
+	`, "true 2\nfalse 2\ntrue 2\nfalse 2\n")
+}
@@ -0,0 +1,759 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"net"
+	"os"
+	"os/exec"
+	goruntime "runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// Default maxBuffer of exec, execFile and the Sync functions, in bytes
+const childMaxBuffer = 1024 * 1024
+
+// childClasses holds the ChildProcess class of the child_process module
+type childClasses struct {
+	vm   *goja.Runtime
+	loop AsyncLoop
+	net  *netClasses
+
+	child    *goja.Object
+	childKey *goja.Symbol
+}
+
+// childProcess is the state of a ChildProcess. A running process holds a
+// reference on the loop unless it was unref'd.
+type childProcess struct {
+	c   *childClasses
+	obj *goja.Object
+	cmd *exec.Cmd
+
+	// stdio holds the sockets of the piped stdin, stdout and stderr. 'close'
+	// is emitted once the process has exited and they have all closed.
+	stdio      [3]*netSocket
+	openStdio  int
+	exited     bool
+	closed     bool
+	exitCode   goja.Value
+	signalCode goja.Value
+
+	// timer kills the process once the timeout option expires
+	timer *time.Timer
+
+	refed   bool
+	holding bool
+}
+
+// spawnOptions are the parsed arguments of spawn and the functions built
+// on it
+type spawnOptions struct {
+	file  string
+	args  []string
+	argv0 string
+	// commandLine is the file and arguments given, which errors name
+	commandLine string
+	cwd         string
+	// env is the environment of the process, nil for that of gojs
+	env []string
+	// stdio is "pipe", "inherit" or "ignore" for stdin, stdout and stderr.
+	// stdioSet tells whether the stdio option was given.
+	stdio    [3]string
+	stdioSet bool
+
+	timeout    time.Duration
+	killSignal syscall.Signal
+
+	// maxBuffer, encoding and input apply to the functions that buffer the
+	// output. encoding is empty for Buffers.
+	maxBuffer float64
+	encoding  string
+	input     []byte
+}
+
+// SetupChildProcess sets up the child_process module. Processes are started
+// with os/exec and their exit and output are handed to scripts on loop.
+func SetupChildProcess(vm *goja.Runtime, loop AsyncLoop) error {
+	netClasses := netOf(vm)
+	if netClasses == nil {
+		return errors.New("net not initialized - call SetupNet first")
+	}
+	c := &childClasses{
+		vm:       vm,
+		loop:     loop,
+		net:      netClasses,
+		childKey: goja.NewSymbol("childProcess"),
+	}
+	if err := c.setupChildProcess(); err != nil {
+		return err
+	}
+	util, err := builtinExports(vm, "util")
+	if err != nil {
+		return err
+	}
+	promisifyCustom, _ := util.ToObject(vm).Get("promisify").ToObject(vm).Get("custom").(*goja.Symbol)
+
+	module := vm.NewObject()
+	module.Set("ChildProcess", c.child)
+
+	// spawn(command[, args][, options]) starts command without waiting for it
+	module.Set("spawn", func(call goja.FunctionCall) goja.Value {
+		opts := c.spawnArgs(call.Argument(0), call.Argument(1), call.Argument(2), false, "")
+		return c.spawn(opts, "spawn").obj
+	})
+
+	// exec(command[, options][, callback]) runs command in a shell and
+	// calls back with its buffered output
+	exec := vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		opts, cb := c.execArgs(call.Arguments)
+		return c.execFile(opts, cb).obj
+	}).ToObject(vm)
+	module.Set("exec", exec)
+
+	// execFile(file[, args][, options][, callback]) is exec without a shell
+	execFile := vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		opts, cb := c.execFileArgs(call.Arguments)
+		return c.execFile(opts, cb).obj
+	}).ToObject(vm)
+	module.Set("execFile", execFile)
+
+	// util.promisify(exec) and util.promisify(execFile) resolve with
+	// { stdout, stderr }. The error they reject with carries both too.
+	if promisifyCustom != nil {
+		promisified := func(parse func(args []goja.Value) (*spawnOptions, goja.Callable)) goja.Value {
+			return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+				opts, _ := parse(call.Arguments)
+				promise, resolve, reject := vm.NewPromise()
+				cp := c.execFile(opts, func(_ goja.Value, args ...goja.Value) (goja.Value, error) {
+					err, stdout, stderr := args[0], args[1], args[2]
+					if errObj, ok := err.(*goja.Object); ok {
+						errObj.Set("stdout", stdout)
+						errObj.Set("stderr", stderr)
+						reject(errObj)
+					} else {
+						result := vm.NewObject()
+						result.Set("stdout", stdout)
+						result.Set("stderr", stderr)
+						resolve(result)
+					}
+					return goja.Undefined(), nil
+				})
+				obj := vm.ToValue(promise).ToObject(vm)
+				obj.Set("child", cp.obj)
+				return obj
+			})
+		}
+		exec.DefineDataPropertySymbol(promisifyCustom, promisified(c.execArgs), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+		execFile.DefineDataPropertySymbol(promisifyCustom, promisified(c.execFileArgs), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	}
+
+	c.setupSync(module)
+
+	return RegisterModule(vm, "child_process", module)
+}
+
+// setupChildProcess creates ChildProcess, an EventEmitter for a process
+// started by spawn
+func (c *childClasses) setupChildProcess() error {
+	vm := c.vm
+	emitter, err := builtinExports(vm, "events")
+	if err != nil {
+		return err
+	}
+
+	childOf := func(this goja.Value) *childProcess {
+		if obj, ok := this.(*goja.Object); ok {
+			if cp, ok := exportSymbol(obj, c.childKey).(*childProcess); ok {
+				return cp
+			}
+		}
+		panic(NewNodeError(vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be of type ChildProcess"))
+	}
+
+	var proto *goja.Object
+	c.child, proto = c.net.streams.newClass("ChildProcess", emitter.ToObject(vm), func(this *goja.Object, args []goja.Value) {
+		cp := &childProcess{c: c, obj: this, refed: true, exitCode: goja.Null(), signalCode: goja.Null()}
+		this.DefineDataPropertySymbol(c.childKey, vm.ToValue(cp), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+		this.Set("exitCode", cp.exitCode)
+		this.Set("signalCode", cp.signalCode)
+		this.Set("killed", false)
+		this.Set("connected", false)
+		this.Set("stdin", goja.Null())
+		this.Set("stdout", goja.Null())
+		this.Set("stderr", goja.Null())
+		this.Set("stdio", []interface{}{nil, nil, nil})
+	})
+
+	// kill([signal]) sends signal, 'SIGTERM' by default, and tells whether
+	// it could be delivered
+	proto.Set("kill", func(call goja.FunctionCall) goja.Value {
+		cp := childOf(call.This)
+		sig := syscall.SIGTERM
+		if !isNullish(call.Argument(0)) {
+			sig = signalArg(vm, call.Argument(0))
+		}
+		return vm.ToValue(cp.kill(sig))
+	})
+
+	proto.Set("ref", func(call goja.FunctionCall) goja.Value {
+		cp := childOf(call.This)
+		cp.refed = true
+		cp.hold()
+		return goja.Undefined()
+	})
+	proto.Set("unref", func(call goja.FunctionCall) goja.Value {
+		cp := childOf(call.This)
+		cp.refed = false
+		cp.release()
+		return goja.Undefined()
+	})
+	return nil
+}
+
+// spawnArgs parses the (file[, args][, options]) arguments of spawn and
+// execFile. A shell runs file as a command line if the shell option is set,
+// or always with shell. The output is decoded with encoding unless the
+// encoding option says otherwise; empty means Buffers.
+func (c *childClasses) spawnArgs(fileArg, argsArg, optionsArg goja.Value, shell bool, encoding string) *spawnOptions {
+	vm := c.vm
+	file, ok := fileArg.Export().(string)
+	if !ok || !isString(fileArg) {
+		panic(ErrInvalidArgType(vm, "file", "of type string", fileArg))
+	}
+	if file == "" {
+		panic(NewNodeError(vm, "TypeError", "ERR_INVALID_ARG_VALUE", "The argument 'file' cannot be empty. Received ''"))
+	}
+	checkChildProcess(vm, file)
+
+	opts := &spawnOptions{
+		file:       file,
+		killSignal: syscall.SIGTERM,
+		maxBuffer:  childMaxBuffer,
+		encoding:   encoding,
+		stdio:      [3]string{"pipe", "pipe", "pipe"},
+	}
+	if obj, ok := argsArg.(*goja.Object); ok && obj.ClassName() == "Array" {
+		length := int(obj.Get("length").ToInteger())
+		for i := 0; i < length; i++ {
+			opts.args = append(opts.args, obj.Get(fmt.Sprint(i)).String())
+		}
+	} else if !isNullish(argsArg) {
+		if _, ok := argsArg.(*goja.Object); !ok {
+			panic(ErrInvalidArgType(vm, "args", "an instance of Array", argsArg))
+		}
+		optionsArg = argsArg
+	}
+
+	opts.commandLine = strings.Join(append([]string{file}, opts.args...), " ")
+
+	options, ok := optionsArg.(*goja.Object)
+	if !ok && !isNullish(optionsArg) {
+		panic(ErrInvalidArgType(vm, "options", "of type object", optionsArg))
+	}
+	get := func(name string) goja.Value {
+		if options == nil {
+			return goja.Undefined()
+		}
+		return options.Get(name)
+	}
+
+	if v := get("cwd"); !isNullish(v) {
+		if !isString(v) {
+			panic(ErrInvalidArgType(vm, "options.cwd", "of type string", v))
+		}
+		opts.cwd = v.String()
+	}
+	if v := get("env"); !isNullish(v) {
+		env, ok := v.(*goja.Object)
+		if !ok {
+			panic(ErrInvalidArgType(vm, "options.env", "of type object", v))
+		}
+		opts.env = []string{}
+		for _, key := range env.Keys() {
+			if value := env.Get(key); value != nil && !goja.IsUndefined(value) {
+				opts.env = append(opts.env, key+"="+value.String())
+			}
+		}
+	}
+	if v := get("stdio"); !isNullish(v) {
+		opts.stdio = stdioArg(vm, v)
+		opts.stdioSet = true
+	}
+	if v := get("timeout"); !isNullish(v) {
+		if !isNumber(v) || v.ToFloat() < 0 || v.ToFloat() != math.Trunc(v.ToFloat()) {
+			panic(errOutOfRange(vm, "timeout", "an unsigned integer", v))
+		}
+		opts.timeout = time.Duration(v.ToFloat()) * time.Millisecond
+	}
+	if v := get("killSignal"); !isNullish(v) {
+		opts.killSignal = signalArg(vm, v)
+	}
+	if v := get("maxBuffer"); !isNullish(v) {
+		if !isNumber(v) || v.ToFloat() < 0 {
+			panic(errOutOfRange(vm, "options.maxBuffer", "a positive number", v))
+		}
+		opts.maxBuffer = v.ToFloat()
+	}
+	if v := get("encoding"); !isNullish(v) {
+		opts.encoding, _ = normalizeEncoding(v.String())
+	}
+	if v := get("input"); !isNullish(v) {
+		if data, ok := BufferBytes(vm, v); ok {
+			opts.input = append([]byte(nil), data...)
+		} else if isString(v) {
+			encoding := opts.encoding
+			if encoding == "" {
+				encoding = "utf8"
+			}
+			opts.input = encodeString(v.String(), encoding)
+		} else {
+			panic(ErrInvalidArgType(vm, "options.stdio[0]", "of type string or an instance of Buffer, TypedArray, or DataView", v))
+		}
+	}
+
+	// The shell gets the command line with the arguments joined by spaces
+	if v := get("shell"); shell || !isNullish(v) && v.ToBoolean() {
+		command := opts.commandLine
+		if goruntime.GOOS == "windows" {
+			opts.file = os.Getenv("ComSpec")
+			if opts.file == "" {
+				opts.file = "cmd.exe"
+			}
+			opts.args = []string{"/d", "/s", "/c", command}
+		} else {
+			opts.file = "/bin/sh"
+			opts.args = []string{"-c", command}
+		}
+		if isString(v) {
+			opts.file = v.String()
+		}
+	}
+	opts.argv0 = opts.file
+	if v := get("argv0"); isString(v) {
+		opts.argv0 = v.String()
+	}
+	return opts
+}
+
+// stdioArg parses the stdio option: one of "pipe", "inherit" and "ignore"
+// for all three streams, or an array of them
+func stdioArg(vm *goja.Runtime, v goja.Value) [3]string {
+	invalid := func() {
+		panic(NewNodeError(vm, "TypeError", "ERR_INVALID_ARG_VALUE", "The argument 'stdio' is invalid. Received "+Inspect(vm, v, InspectOptions{})))
+	}
+	mode := func(v goja.Value) string {
+		if isNullish(v) {
+			return "pipe"
+		}
+		switch s := v.String(); s {
+		case "pipe", "inherit", "ignore":
+			if isString(v) {
+				return s
+			}
+		case "overlapped":
+			return "pipe"
+		}
+		invalid()
+		return ""
+	}
+
+	if obj, ok := v.(*goja.Object); ok && obj.ClassName() == "Array" {
+		var stdio [3]string
+		for i := range stdio {
+			stdio[i] = mode(obj.Get(fmt.Sprint(i)))
+		}
+		if obj.Get("length").ToInteger() > 3 {
+			invalid()
+		}
+		return stdio
+	}
+	if !isString(v) {
+		invalid()
+	}
+	m := mode(v)
+	return [3]string{m, m, m}
+}
+
+// execArgs parses the (command[, options][, callback]) arguments of exec,
+// which runs command in a shell
+func (c *childClasses) execArgs(args []goja.Value) (*spawnOptions, goja.Callable) {
+	command, options := argAt(args, 0), argAt(args, 1)
+	cb, _ := goja.AssertFunction(argAt(args, 2))
+	if fn, ok := goja.AssertFunction(options); ok {
+		options, cb = goja.Undefined(), fn
+	}
+	if !isString(command) {
+		panic(ErrInvalidArgType(c.vm, "command", "of type string", command))
+	}
+	return c.spawnArgs(command, options, goja.Undefined(), true, "utf8"), cb
+}
+
+// execFileArgs parses the (file[, args][, options][, callback]) arguments
+// of execFile
+func (c *childClasses) execFileArgs(args []goja.Value) (*spawnOptions, goja.Callable) {
+	var cb goja.Callable
+	if len(args) > 1 {
+		if fn, ok := goja.AssertFunction(args[len(args)-1]); ok {
+			cb = fn
+			args = args[:len(args)-1]
+		}
+	}
+	return c.spawnArgs(argAt(args, 0), argAt(args, 1), argAt(args, 2), false, "utf8"), cb
+}
+
+// command creates the exec.Cmd of opts
+func (opts *spawnOptions) command() *exec.Cmd {
+	cmd := exec.Command(opts.file, opts.args...)
+	cmd.Args[0] = opts.argv0
+	cmd.Dir = opts.cwd
+	cmd.Env = opts.env
+	return cmd
+}
+
+// spawnArgv returns the spawnargs of a process: argv0 and the arguments
+func (opts *spawnOptions) spawnArgv() []string {
+	return append([]string{opts.argv0}, opts.args...)
+}
+
+// spawn starts the process of opts. A process that cannot be started emits
+// 'error', with the system call named call, and then 'close'.
+func (c *childClasses) spawn(opts *spawnOptions, call string) *childProcess {
+	vm := c.vm
+	obj, err := vm.New(c.child)
+	if err != nil {
+		panic(err)
+	}
+	cp := exportSymbol(obj, c.childKey).(*childProcess)
+	obj.Set("spawnfile", opts.file)
+	obj.Set("spawnargs", opts.spawnArgv())
+	cmd := opts.command()
+	cp.cmd = cmd
+
+	// The ends of the pipes given to the process are closed once it has
+	// started; the other ends become Sockets
+	var childEnds []*os.File
+	stdio := []goja.Value{goja.Null(), goja.Null(), goja.Null()}
+	for i, mode := range opts.stdio {
+		var f *os.File
+		switch mode {
+		case "inherit":
+			f = []*os.File{os.Stdin, os.Stdout, os.Stderr}[i]
+		case "pipe":
+			r, w, err := os.Pipe()
+			if err != nil {
+				panic(NewSystemError(vm, err, "pipe", ""))
+			}
+			parent, child := w, r
+			socketOpts := vm.NewObject()
+			socketOpts.Set("readable", false)
+			if i > 0 {
+				parent, child = r, w
+				socketOpts = vm.NewObject()
+				socketOpts.Set("writable", false)
+			}
+			childEnds = append(childEnds, child)
+			f = child
+
+			ns := c.net.newSocket(pipeConn{parent}, nil, socketOpts)
+			cp.stdio[i] = ns
+			cp.openStdio++
+			callMethod(vm, ns.s.obj, "once", vm.ToValue("close"), vm.ToValue(func(goja.FunctionCall) goja.Value {
+				cp.openStdio--
+				cp.maybeClose()
+				return goja.Undefined()
+			}))
+			stdio[i] = ns.s.obj
+		}
+		if f == nil {
+			continue
+		}
+		switch i {
+		case 0:
+			cmd.Stdin = f
+		case 1:
+			cmd.Stdout = f
+		case 2:
+			cmd.Stderr = f
+		}
+	}
+	obj.Set("stdin", stdio[0])
+	obj.Set("stdout", stdio[1])
+	obj.Set("stderr", stdio[2])
+	obj.Set("stdio", stdio)
+
+	err = cmd.Start()
+	for _, f := range childEnds {
+		f.Close()
+	}
+	if err != nil {
+		e := spawnError(err, call, opts.file)
+		errValue := jsError(vm, e).(*goja.Object)
+		errValue.Set("spawnargs", opts.args)
+		for _, ns := range cp.stdio {
+			if ns != nil {
+				ns.s.destroy(nil, nil)
+			}
+		}
+		c.loop.NextTick(func() {
+			cp.exited = true
+			cp.exitCode = vm.ToValue(-int(e.errno))
+			obj.Set("exitCode", cp.exitCode)
+			cp.emit("error", errValue)
+			cp.maybeClose()
+		})
+		return cp
+	}
+	obj.Set("pid", cmd.Process.Pid)
+	cp.hold()
+	if opts.timeout > 0 {
+		cp.timer = time.AfterFunc(opts.timeout, func() {
+			c.loop.RunOnLoop(func(*goja.Runtime) {
+				cp.kill(opts.killSignal)
+			})
+		})
+	}
+
+	// A halted run kills the process and closes the pipes to it
+	unclose := c.loop.AddCloser(func() {
+		cmd.Process.Kill()
+		for _, ns := range cp.stdio {
+			if ns != nil {
+				ns.conn.Close()
+			}
+		}
+	})
+	go func() {
+		cmd.Wait()
+		unclose()
+		c.loop.RunOnLoop(func(*goja.Runtime) {
+			cp.onExit(cmd.ProcessState)
+		})
+	}()
+	c.loop.NextTick(func() { cp.emit("spawn") })
+	return cp
+}
+
+// onExit emits 'exit' with the exit code, or the signal that ended the
+// process
+func (cp *childProcess) onExit(state *os.ProcessState) {
+	vm := cp.c.vm
+	if cp.timer != nil {
+		cp.timer.Stop()
+	}
+	cp.release()
+	cp.exited = true
+	if sig, ok := exitSignal(state); ok {
+		cp.signalCode = vm.ToValue(nameOfSignal(sig))
+	} else {
+		cp.exitCode = vm.ToValue(state.ExitCode())
+	}
+	cp.obj.Set("exitCode", cp.exitCode)
+	cp.obj.Set("signalCode", cp.signalCode)
+	cp.emit("exit", cp.exitCode, cp.signalCode)
+
+	// Nothing reads stdin any more, and output nobody reads is drained so
+	// that 'close' follows
+	if ns := cp.stdio[0]; ns != nil && !ns.s.destroyed {
+		ns.s.destroy(nil, nil)
+	}
+	for _, ns := range cp.stdio[1:] {
+		if ns != nil && !ns.s.destroyed && ns.s.r.flowing == flowNone {
+			callMethod(vm, ns.s.obj, "resume")
+		}
+	}
+	cp.maybeClose()
+}
+
+// maybeClose emits 'close' once the process has exited and its stdio
+// streams have closed
+func (cp *childProcess) maybeClose() {
+	if !cp.exited || cp.openStdio > 0 || cp.closed {
+		return
+	}
+	cp.closed = true
+	cp.emit("close", cp.exitCode, cp.signalCode)
+}
+
+// kill sends sig to the process, reporting whether it could
+func (cp *childProcess) kill(sig syscall.Signal) bool {
+	if cp.cmd == nil || cp.cmd.Process == nil || cp.exited {
+		return false
+	}
+	if err := signalProcess(cp.cmd.Process, sig); err != nil {
+		return false
+	}
+	cp.obj.Set("killed", true)
+	return true
+}
+
+// signalProcess sends sig to p
+func signalProcess(p *os.Process, sig syscall.Signal) error {
+	if goruntime.GOOS == "windows" {
+		// Windows can only terminate processes, whatever the signal
+		return p.Kill()
+	}
+	return p.Signal(sig)
+}
+
+func (cp *childProcess) emit(event string, args ...goja.Value) {
+	if _, err := Emit(cp.c.vm, cp.obj, event, args...); err != nil {
+		panic(err)
+	}
+}
+
+func (cp *childProcess) hold() {
+	if !cp.exited && cp.refed && !cp.holding && cp.cmd != nil && cp.cmd.Process != nil {
+		cp.holding = true
+		cp.c.loop.Ref()
+	}
+}
+
+func (cp *childProcess) release() {
+	if cp.holding {
+		cp.holding = false
+		cp.c.loop.Unref()
+	}
+}
+
+// execFile runs opts like spawn, buffering the output up to maxBuffer
+// bytes. Once the process has closed cb is called with an error, unless it
+// exited with 0, and the output.
+func (c *childClasses) execFile(opts *spawnOptions, cb goja.Callable) *childProcess {
+	vm := c.vm
+	cp := c.spawn(opts, "spawn")
+
+	var output [2][]byte
+	var failure *goja.Object
+	outputValue := func(i int) goja.Value {
+		if opts.encoding == "" {
+			return NewBuffer(vm, output[i])
+		}
+		return vm.ToValue(decodeBytes(output[i], opts.encoding))
+	}
+
+	done := false
+	finish := func(code, signal goja.Value) {
+		if done {
+			return
+		}
+		done = true
+		stdout, stderr := outputValue(0), outputValue(1)
+		if failure == nil && (!isNullish(signal) || code.ToInteger() != 0) {
+			msg := "Command failed: " + opts.commandLine + "\n"
+			if opts.encoding == "" {
+				msg += decodeUTF8(output[1])
+			} else {
+				msg += stderr.String()
+			}
+			failure = NewNodeError(vm, "Error", "", msg)
+			failure.Set("code", code)
+			failure.Set("killed", cp.obj.Get("killed"))
+			failure.Set("signal", signal)
+		}
+		var err goja.Value = goja.Null()
+		if failure != nil {
+			failure.Set("cmd", opts.commandLine)
+			err = failure
+		}
+		if cb != nil {
+			if _, e := cb(goja.Undefined(), err, stdout, stderr); e != nil {
+				panic(e)
+			}
+		}
+	}
+
+	for i, name := range []string{"stdout", "stderr"} {
+		i, name := i, name
+		ns := cp.stdio[i+1]
+		if ns == nil {
+			continue
+		}
+		callMethod(vm, ns.s.obj, "on", vm.ToValue("data"), vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			data, _ := BufferBytes(vm, call.Argument(0))
+			if failure != nil {
+				return goja.Undefined()
+			}
+			if room := opts.maxBuffer - float64(len(output[i])); float64(len(data)) > room {
+				output[i] = append(output[i], data[:int(room)]...)
+				failure = NewNodeError(vm, "RangeError", "ERR_CHILD_PROCESS_STDIO_MAXBUFFER", name+" maxBuffer length exceeded")
+				cp.kill(opts.killSignal)
+				return goja.Undefined()
+			}
+			output[i] = append(output[i], data...)
+			return goja.Undefined()
+		}))
+	}
+
+	callMethod(vm, cp.obj, "on", vm.ToValue("error"), vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		failure, _ = call.Argument(0).(*goja.Object)
+		for _, ns := range cp.stdio[1:] {
+			if ns != nil {
+				ns.s.destroy(nil, nil)
+			}
+		}
+		finish(goja.Null(), goja.Null())
+		return goja.Undefined()
+	}))
+	callMethod(vm, cp.obj, "on", vm.ToValue("close"), vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		finish(call.Argument(0), call.Argument(1))
+		return goja.Undefined()
+	}))
+	return cp
+}
+
+// exitSignal returns the signal that ended a process, if any
+func exitSignal(state *os.ProcessState) (syscall.Signal, bool) {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return ws.Signal(), true
+	}
+	return 0, false
+}
+
+// spawnError describes the failure of the system call call to start file
+// like Node.js: "spawn x ENOENT"
+func spawnError(err error, call, file string) *nodeError {
+	e := &nodeError{syscall: call + " " + file, path: file, err: err}
+	var errno syscall.Errno
+	switch {
+	case errors.Is(err, exec.ErrNotFound), errors.Is(err, fs.ErrNotExist):
+		errno = syscall.ENOENT
+	case errors.As(err, &errno):
+	case errors.Is(err, fs.ErrPermission):
+		errno = syscall.EACCES
+	}
+	name, ok := errnoNames[errno]
+	if !ok {
+		e.message = err.Error()
+		return e
+	}
+	e.code, e.errno = name, errno
+	e.message = fmt.Sprintf("%s %s %s", call, file, name)
+	return e
+}
+
+// pipeConn is the end of a pipe to a child process that a Socket reads or
+// writes
+type pipeConn struct {
+	*os.File
+}
+
+func (p pipeConn) LocalAddr() net.Addr  { return pipeAddr{} }
+func (p pipeConn) RemoteAddr() net.Addr { return pipeAddr{} }
+
+// CloseWrite closes stdin once it is ended
+func (p pipeConn) CloseWrite() error {
+	return p.File.Close()
+}
+
+// pipeAddr is the address of both ends of a pipe, which has none
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "" }
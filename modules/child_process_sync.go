@@ -0,0 +1,203 @@
+package modules
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// setupSync adds spawnSync, execSync and execFileSync to the child_process
+// module. Like in Node.js they block the loop until the process has exited.
+func (c *childClasses) setupSync(module *goja.Object) {
+	vm := c.vm
+
+	// spawnSync(command[, args][, options]) returns the status, signal and
+	// output of command
+	module.Set("spawnSync", func(call goja.FunctionCall) goja.Value {
+		opts := c.spawnArgs(call.Argument(0), call.Argument(1), call.Argument(2), false, "")
+		return c.spawnSync(opts)
+	})
+
+	// execSync(command[, options]) runs command in a shell and returns its
+	// stdout, throwing if it fails
+	module.Set("execSync", func(call goja.FunctionCall) goja.Value {
+		if !isString(call.Argument(0)) {
+			panic(ErrInvalidArgType(vm, "command", "of type string", call.Argument(0)))
+		}
+		opts := c.spawnArgs(call.Argument(0), call.Argument(1), goja.Undefined(), true, "")
+		return c.execSync(opts)
+	})
+
+	// execFileSync(file[, args][, options]) is execSync without a shell
+	module.Set("execFileSync", func(call goja.FunctionCall) goja.Value {
+		opts := c.spawnArgs(call.Argument(0), call.Argument(1), call.Argument(2), false, "")
+		return c.execSync(opts)
+	})
+}
+
+// spawnSync runs the process of opts to completion. The result holds the
+// error that kept it from running or finishing, its status or signal, pid
+// and output.
+func (c *childClasses) spawnSync(opts *spawnOptions) *goja.Object {
+	vm := c.vm
+	cmd := opts.command()
+	result := vm.NewObject()
+
+	// The process is killed once it runs out of time or output space, the
+	// reason becoming the error of the result
+	var mu sync.Mutex
+	var killedFor syscall.Errno
+	kill := func(reason syscall.Errno) {
+		mu.Lock()
+		defer mu.Unlock()
+		if killedFor == 0 {
+			killedFor = reason
+			signalProcess(cmd.Process, opts.killSignal)
+		}
+	}
+
+	var outputs [3]*syncOutput
+	for i, mode := range opts.stdio {
+		switch {
+		case mode == "inherit":
+			switch i {
+			case 0:
+				cmd.Stdin = os.Stdin
+			case 1:
+				cmd.Stdout = os.Stdout
+			case 2:
+				cmd.Stderr = os.Stderr
+			}
+		case mode == "pipe" && i == 0:
+			if opts.input != nil {
+				cmd.Stdin = bytes.NewReader(opts.input)
+			}
+		case mode == "pipe":
+			outputs[i] = &syncOutput{max: opts.maxBuffer, overflow: func() { kill(syscall.ENOBUFS) }}
+			if i == 1 {
+				cmd.Stdout = outputs[i]
+			} else {
+				cmd.Stderr = outputs[i]
+			}
+		}
+	}
+
+	fail := func(err error) {
+		errValue := jsError(vm, spawnError(err, "spawnSync", opts.file)).(*goja.Object)
+		errValue.Set("spawnargs", opts.args)
+		result.Set("error", errValue)
+	}
+
+	if err := cmd.Start(); err != nil {
+		fail(err)
+		result.Set("status", goja.Null())
+		result.Set("signal", goja.Null())
+		result.Set("output", goja.Null())
+		result.Set("pid", 0)
+		result.Set("stdout", goja.Null())
+		result.Set("stderr", goja.Null())
+		return result
+	}
+	if opts.timeout > 0 {
+		timer := time.AfterFunc(opts.timeout, func() { kill(syscall.ETIMEDOUT) })
+		defer timer.Stop()
+	}
+	// A halted run does not wait for the process
+	unclose := c.loop.AddCloser(func() { cmd.Process.Kill() })
+	cmd.Wait()
+	unclose()
+
+	if killedFor != 0 {
+		fail(killedFor)
+	}
+	if sig, ok := exitSignal(cmd.ProcessState); ok {
+		result.Set("status", goja.Null())
+		result.Set("signal", nameOfSignal(sig))
+	} else {
+		result.Set("status", cmd.ProcessState.ExitCode())
+		result.Set("signal", goja.Null())
+	}
+	output := []goja.Value{goja.Null(), goja.Null(), goja.Null()}
+	for i, out := range outputs {
+		switch {
+		case out == nil:
+		case opts.encoding == "":
+			output[i] = NewBuffer(vm, out.data)
+		default:
+			output[i] = vm.ToValue(decodeBytes(out.data, opts.encoding))
+		}
+	}
+	result.Set("output", output)
+	result.Set("pid", cmd.Process.Pid)
+	result.Set("stdout", output[1])
+	result.Set("stderr", output[2])
+	return result
+}
+
+// execSync runs opts like spawnSync and returns its stdout. It throws if the
+// process could not run or exited with anything but 0; the error carries
+// the result. Unless the stdio option is given, stderr is also written to
+// that of gojs.
+func (c *childClasses) execSync(opts *spawnOptions) goja.Value {
+	vm := c.vm
+	result := c.spawnSync(opts)
+	stderr := result.Get("stderr")
+	if !opts.stdioSet && !isNullish(stderr) {
+		if data, ok := BufferBytes(vm, stderr); ok {
+			os.Stderr.Write(data)
+		} else {
+			os.Stderr.WriteString(stderr.String())
+		}
+	}
+
+	var failure *goja.Object
+	if err, ok := result.Get("error").(*goja.Object); ok {
+		failure = err
+	} else if status := result.Get("status"); !isNumber(status) || status.ToInteger() != 0 {
+		msg := "Command failed: " + opts.commandLine
+		if !isNullish(stderr) && stderr.ToObject(vm).Get("length").ToInteger() > 0 {
+			if data, ok := BufferBytes(vm, stderr); ok {
+				msg += "\n" + decodeUTF8(data)
+			} else {
+				msg += "\n" + stderr.String()
+			}
+		}
+		failure = NewNodeError(vm, "Error", "", msg)
+	}
+	if failure == nil {
+		return result.Get("stdout")
+	}
+	for _, key := range result.Keys() {
+		if key != "error" {
+			failure.Set(key, result.Get(key))
+		}
+	}
+	panic(failure)
+}
+
+// syncOutput collects the output of spawnSync up to max bytes, calling
+// overflow once there is more
+type syncOutput struct {
+	data     []byte
+	max      float64
+	overflow func()
+	full     bool
+}
+
+func (o *syncOutput) Write(p []byte) (int, error) {
+	if o.full {
+		return len(p), nil
+	}
+	if room := o.max - float64(len(o.data)); float64(len(p)) > room {
+		o.data = append(o.data, p[:int(room)]...)
+		o.full = true
+		o.overflow()
+		return len(p), nil
+	}
+	o.data = append(o.data, p...)
+	return len(p), nil
+}
@@ -0,0 +1,66 @@
+//go:build !windows
+
+package modules_test
+
+import (
+	"testing"
+
+	"gojs/internal/jstest"
+)
+
+func TestSpawn(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const child = require('child_process').spawn('sh', ['-c', 'read x; echo "got $x"; echo err >&2; exit 3']);
+		let out = '', err = '';
+		child.stdout.setEncoding('utf8');
+		child.stderr.setEncoding('utf8');
+		child.stdout.on('data', (d) => out += d);
+		child.stderr.on('data', (d) => err += d);
+		child.on('spawn', () => console.log('spawn', typeof child.pid));
+		child.on('exit', (code, signal) => console.log('exit', code, signal));
+		child.on('close', (code) => console.log('close', code, JSON.stringify(out), JSON.stringify(err), child.exitCode));
+		child.stdin.end('hi\n');
+	`, "spawn number\nexit 3 null\nclose 3 \"got hi\\n\" \"err\\n\" 3\n")
+}
+
+func TestSpawnErrors(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const cp = require('child_process');
+		cp.spawn('nosuchcmd_xyz').on('error', (e) => console.log(e.code, e.message));
+		const slow = cp.spawn('sleep', ['5'], { timeout: 20 });
+		slow.on('exit', (code, signal) => console.log('timeout', code, signal, slow.killed));
+	`, "ENOENT spawn nosuchcmd_xyz ENOENT\ntimeout null SIGTERM true\n")
+}
+
+func TestExecAndExecFile(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const cp = require('child_process');
+		const { promisify } = require('util');
+		cp.exec('echo $GOJS_X; exit 2', { env: { GOJS_X: 'env' } }, (e, stdout) => {
+			console.log(e.code, e.killed, e.cmd, JSON.stringify(stdout));
+			cp.execFile('echo', ['a', 'b'], (e, stdout) => {
+				console.log(e, JSON.stringify(stdout));
+				promisify(cp.execFile)('echo', ['p']).then(({ stdout, stderr }) => console.log(JSON.stringify(stdout), JSON.stringify(stderr)));
+			});
+		});
+	`, "2 false echo $GOJS_X; exit 2 \"env\\n\"\nnull \"a b\\n\"\n\"p\\n\" \"\"\n")
+}
+
+func TestSyncChildProcesses(t *testing.T) {
+	dir := t.TempDir()
+	jstest.ExpectOutput(t, `
+		const cp = require('child_process');
+		const r = cp.spawnSync('cat', { input: 'in' });
+		console.log(r.status, r.stdout.toString(), r.signal, r.output.length);
+		console.log(cp.execSync('pwd', { cwd: `+jstest.Quote(dir)+`, encoding: 'utf8' }).trim() === require('fs').realpathSync(`+jstest.Quote(dir)+`));
+		console.log(cp.execFileSync('echo', ['x']).toString().trim());
+		try { cp.execSync('exit 4', { stdio: 'ignore' }); } catch (e) { console.log('threw', e.status); }
+	`, "0 in null 3\ntrue\nx\nthrew 4\n")
+}
+
+func TestChildProcessUnref(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		require('child_process').spawn('sleep', ['5'], { stdio: 'ignore' }).unref();
+		console.log('done');
+	`, "done\n")
+}
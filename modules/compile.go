@@ -0,0 +1,142 @@
+package modules
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
+	"github.com/dop251/goja/parser"
+	"github.com/dop251/goja/token"
+)
+
+// cleanStackFunc is the global function catch clauses pass their exception
+// to, see cleanCaughtStacks
+const cleanStackFunc = "__cleanStack"
+
+// caughtName binds the exception of a catch clause whose parameter is a
+// destructuring pattern
+const caughtName = "__caught"
+
+// idxType is the type of the source positions in goja's AST
+var idxType = reflect.TypeOf(file.Idx(0))
+
+// astPkgPath is the package of goja's AST nodes
+var astPkgPath = reflect.TypeOf(ast.Program{}).PkgPath()
+
+// CompileScript compiles a script run by the host, rewriting its import()
+// calls like a module's
+func CompileScript(name, src string) (*goja.Program, error) {
+	return compileWrapped(name, "", RewriteDynamicImport(src), "")
+}
+
+// compileWrapped compiles the source of a module wrapped in a function:
+// prefix and suffix, neither of which may contain a newline before body,
+// surround body. Stack traces and syntax errors report positions in body,
+// so the wrapper does not shift the columns of the module's first line.
+func compileWrapped(name, prefix, body, suffix string) (*goja.Program, error) {
+	prg, err := parser.ParseFile(nil, name, prefix+body+suffix, 0)
+	if err != nil {
+		var list parser.ErrorList
+		if errors.As(err, &list) {
+			for _, e := range list {
+				if e.Position.Line == 1 {
+					e.Position.Column = max(e.Position.Column-len(prefix), 1)
+				}
+			}
+		}
+		return nil, &goja.CompilerSyntaxError{CompilerError: goja.CompilerError{Message: err.Error()}}
+	}
+
+	// A source map describes the file as it is, so positions are left to it
+	if prefix != "" && !strings.Contains(body, "//# sourceMappingURL=") {
+		walkAST(prg, func(node reflect.Value) {
+			shiftPositions(node, -len(prefix))
+		})
+		prg.File = file.NewFile(name, body+suffix, 1)
+	}
+	cleanCaughtStacks(prg)
+	return goja.CompileAST(prg, false)
+}
+
+// walkAST calls visit on every struct of the AST rooted at root, including
+// those embedded by value in other nodes
+func walkAST(root interface{}, visit func(node reflect.Value)) {
+	seen := make(map[uintptr]bool)
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Ptr:
+			if v.IsNil() || seen[v.Pointer()] {
+				return
+			}
+			seen[v.Pointer()] = true
+			walk(v.Elem())
+		case reflect.Interface:
+			if !v.IsNil() {
+				walk(v.Elem())
+			}
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				walk(v.Index(i))
+			}
+		case reflect.Struct:
+			if v.Type().PkgPath() != astPkgPath {
+				return
+			}
+			visit(v)
+			for i := 0; i < v.NumField(); i++ {
+				walk(v.Field(i))
+			}
+		}
+	}
+	walk(reflect.ValueOf(root))
+}
+
+// shiftPositions moves the source positions of node by delta. Positions
+// inside the wrapper become the start of the file.
+func shiftPositions(node reflect.Value, delta int) {
+	for i := 0; i < node.NumField(); i++ {
+		f := node.Field(i)
+		if f.Type() == idxType && f.CanSet() && f.Int() > 0 {
+			f.SetInt(int64(max(int(f.Int())+delta, 1)))
+		}
+	}
+}
+
+// cleanCaughtStacks makes every catch clause that binds its exception start
+// by passing it to __cleanStack. Errors thrown by the engine itself record
+// the runtime's frames, which can only be removed from their stacks once
+// they are caught. A destructuring parameter is bound in the body instead.
+func cleanCaughtStacks(prg *ast.Program) {
+	walkAST(prg, func(node reflect.Value) {
+		if !node.CanAddr() {
+			return
+		}
+		catch, ok := node.Addr().Interface().(*ast.CatchStatement)
+		if !ok || catch.Body == nil || catch.Parameter == nil {
+			return
+		}
+		idx := catch.Body.LeftBrace
+		var prologue []ast.Statement
+		param, ok := catch.Parameter.(*ast.Identifier)
+		if !ok {
+			param = &ast.Identifier{Name: caughtName, Idx: idx}
+			prologue = append(prologue, &ast.LexicalDeclaration{Idx: idx, Token: token.LET, List: []*ast.Binding{{
+				Target:      catch.Parameter,
+				Initializer: &ast.Identifier{Name: caughtName, Idx: idx},
+			}}})
+			catch.Parameter = param
+		}
+		clean := &ast.ExpressionStatement{Expression: &ast.CallExpression{
+			Callee:           &ast.Identifier{Name: cleanStackFunc, Idx: idx},
+			LeftParenthesis:  idx,
+			ArgumentList:     []ast.Expression{&ast.Identifier{Name: param.Name, Idx: idx}},
+			RightParenthesis: idx,
+		}}
+		prologue = append([]ast.Statement{clean}, prologue...)
+		catch.Body.List = append(prologue, catch.Body.List...)
+	})
+}
@@ -2,72 +2,112 @@ package modules
 
 import (
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/dop251/goja"
 )
 
-// SetupConsole sets up the console object
-func SetupConsole(vm *goja.Runtime) {
+// SetupConsole sets up the console object, which sends every message to
+// sink. A nil sink writes text to os.Stdout and os.Stderr. Values are
+// formatted like util.inspect.
+func SetupConsole(vm *goja.Runtime, sink ConsoleSink) {
 	console := vm.NewObject()
+	if sink == nil {
+		sink = NewTextSink(os.Stdout, os.Stderr)
+	}
 
-	// Helper function to format values
-	format := func(args []goja.Value) string {
-		parts := make([]string, len(args))
-		for i, arg := range args {
-			if arg == nil || goja.IsUndefined(arg) {
-				parts[i] = "undefined"
-			} else if goja.IsNull(arg) {
-				parts[i] = "null"
-			} else {
-				parts[i] = arg.String()
-			}
-		}
-		return strings.Join(parts, " ")
+	// Capture the intrinsics the formatter needs before any script runs
+	inspectorOf(vm)
+
+	// groups holds the labels of the active console.group calls
+	var groups []string
+
+	// emit sends a message produced by render to the sink
+	emit := func(level ConsoleLevel, method string, args []goja.Value, render func(colors bool) string) {
+		sink.Write(&ConsoleEntry{
+			Level:  level,
+			Method: method,
+			Args:   args,
+			Time:   time.Now(),
+			Source: callerLocation(vm),
+			Group:  append([]string(nil), groups...),
+			vm:     vm,
+			render: render,
+		})
+	}
+
+	// inspectOptions returns the options values are formatted with
+	inspectOptions := func(colors bool) InspectOptions {
+		return InspectOptions{Depth: DefaultInspectDepth, Colors: colors}
+	}
+
+	// print emits the arguments of a call formatted like console.log
+	print := func(level ConsoleLevel, method string, args []goja.Value) {
+		emit(level, method, args, func(colors bool) string {
+			return Format(vm, inspectOptions(colors), args...)
+		})
+	}
+
+	// printText emits a message that needs no formatting
+	printText := func(level ConsoleLevel, method, msg string) {
+		emit(level, method, nil, func(bool) string {
+			return msg
+		})
 	}
 
 	// console.log
 	console.Set("log", func(call goja.FunctionCall) goja.Value {
-		fmt.Println(format(call.Arguments))
+		print(ConsoleLog, "log", copyArgs(call))
 		return goja.Undefined()
 	})
 
 	// console.info (alias for log)
 	console.Set("info", func(call goja.FunctionCall) goja.Value {
-		fmt.Println(format(call.Arguments))
+		print(ConsoleInfo, "info", copyArgs(call))
 		return goja.Undefined()
 	})
 
 	// console.warn
 	console.Set("warn", func(call goja.FunctionCall) goja.Value {
-		fmt.Println("[WARN]", format(call.Arguments))
+		print(ConsoleWarn, "warn", copyArgs(call))
 		return goja.Undefined()
 	})
 
 	// console.error
 	console.Set("error", func(call goja.FunctionCall) goja.Value {
-		fmt.Println("[ERROR]", format(call.Arguments))
+		print(ConsoleError, "error", copyArgs(call))
 		return goja.Undefined()
 	})
 
 	// console.debug
 	console.Set("debug", func(call goja.FunctionCall) goja.Value {
-		fmt.Println("[DEBUG]", format(call.Arguments))
+		print(ConsoleDebug, "debug", copyArgs(call))
 		return goja.Undefined()
 	})
 
-	// console.dir
+	// console.dir inspects a single value, taking util.inspect options
 	console.Set("dir", func(call goja.FunctionCall) goja.Value {
-		if len(call.Arguments) > 0 {
-			fmt.Println(call.Arguments[0].String())
-		}
+		value := call.Argument(0)
+		options := call.Argument(1)
+		emit(ConsoleLog, "dir", []goja.Value{value}, func(colors bool) string {
+			return Inspect(vm, value, inspectOptionsFrom(vm, options, inspectOptions(colors)))
+		})
 		return goja.Undefined()
 	})
 
-	// console.trace
+	// console.trace prints its message and the call stack of the caller
 	console.Set("trace", func(call goja.FunctionCall) goja.Value {
-		fmt.Println("[TRACE]", format(call.Arguments))
-		// TODO: Add stack trace
+		args := copyArgs(call)
+		stack := formatCallStack(vm.CaptureCallStack(0, nil))
+		emit(ConsoleTrace, "trace", args, func(colors bool) string {
+			msg := "Trace"
+			if len(args) > 0 {
+				msg += ": " + Format(vm, inspectOptions(colors), args...)
+			}
+			return msg + stack
+		})
 		return goja.Undefined()
 	})
 
@@ -79,44 +119,199 @@ func SetupConsole(vm *goja.Runtime) {
 
 		assertion := call.Arguments[0].ToBoolean()
 		if !assertion {
-			message := "Assertion failed"
-			if len(call.Arguments) > 1 {
-				message += ": " + format(call.Arguments[1:])
-			}
-			fmt.Println("[ASSERT]", message)
+			args := copyArgs(call)[1:]
+			emit(ConsoleWarn, "assert", args, func(colors bool) string {
+				if len(args) == 0 {
+					return "Assertion failed"
+				}
+				return "Assertion failed: " + Format(vm, inspectOptions(colors), args...)
+			})
 		}
 		return goja.Undefined()
 	})
 
 	// console.clear
 	console.Set("clear", func(call goja.FunctionCall) goja.Value {
-		fmt.Print("\033[H\033[2J")
+		printText(ConsoleLog, "clear", "")
+		return goja.Undefined()
+	})
+
+	// label returns the label argument of the counter and timer methods
+	label := func(call goja.FunctionCall) string {
+		if arg := call.Argument(0); !goja.IsUndefined(arg) {
+			return arg.String()
+		}
+		return "default"
+	}
+
+	// warning reports misuse of a label the way Node.js does
+	warning := func(method, msg string) {
+		printText(ConsoleWarn, method, "Warning: "+msg)
+	}
+
+	// console.count / console.countReset
+	counts := make(map[string]int)
+
+	console.Set("count", func(call goja.FunctionCall) goja.Value {
+		name := label(call)
+		counts[name]++
+		printText(ConsoleInfo, "count", fmt.Sprintf("%s: %d", name, counts[name]))
 		return goja.Undefined()
 	})
 
-	// console.time / console.timeEnd (simple implementation)
-	timers := make(map[string]int64)
+	console.Set("countReset", func(call goja.FunctionCall) goja.Value {
+		name := label(call)
+		if _, ok := counts[name]; !ok {
+			warning("countReset", fmt.Sprintf("Count for '%s' does not exist", name))
+			return goja.Undefined()
+		}
+		counts[name] = 0
+		return goja.Undefined()
+	})
+
+	// console.group / console.groupCollapsed / console.groupEnd
+	group := func(method string) func(goja.FunctionCall) goja.Value {
+		return func(call goja.FunctionCall) goja.Value {
+			label := ""
+			if len(call.Arguments) > 0 {
+				args := copyArgs(call)
+				print(ConsoleLog, method, args)
+				label = Format(vm, inspectOptions(false), args...)
+			}
+			groups = append(groups, label)
+			return goja.Undefined()
+		}
+	}
+	console.Set("group", group("group"))
+	console.Set("groupCollapsed", group("groupCollapsed"))
+
+	console.Set("groupEnd", func(call goja.FunctionCall) goja.Value {
+		if len(groups) > 0 {
+			groups = groups[:len(groups)-1]
+		}
+		return goja.Undefined()
+	})
+
+	// console.time / console.timeLog / console.timeEnd measure elapsed time
+	// with Go's monotonic clock
+	timers := make(map[string]time.Time)
 
 	console.Set("time", func(call goja.FunctionCall) goja.Value {
-		label := "default"
-		if len(call.Arguments) > 0 {
-			label = call.Arguments[0].String()
+		name := label(call)
+		if _, ok := timers[name]; ok {
+			warning("time", fmt.Sprintf("Label '%s' already exists for console.time()", name))
+			return goja.Undefined()
 		}
-		timers[label] = 0 // Simplified - could use actual timing
+		timers[name] = time.Now()
+		return goja.Undefined()
+	})
+
+	console.Set("timeLog", func(call goja.FunctionCall) goja.Value {
+		name := label(call)
+		start, ok := timers[name]
+		if !ok {
+			warning("timeLog", fmt.Sprintf("No such label '%s' for console.timeLog()", name))
+			return goja.Undefined()
+		}
+		msg := fmt.Sprintf("%s: %s", name, formatDuration(time.Since(start)))
+		data := copyArgs(call)
+		if len(data) > 0 {
+			data = data[1:]
+		}
+		emit(ConsoleInfo, "timeLog", data, func(colors bool) string {
+			if len(data) == 0 {
+				return msg
+			}
+			return msg + " " + Format(vm, inspectOptions(colors), data...)
+		})
 		return goja.Undefined()
 	})
 
 	console.Set("timeEnd", func(call goja.FunctionCall) goja.Value {
-		label := "default"
-		if len(call.Arguments) > 0 {
-			label = call.Arguments[0].String()
+		name := label(call)
+		start, ok := timers[name]
+		if !ok {
+			warning("timeEnd", fmt.Sprintf("No such label '%s' for console.timeEnd()", name))
+			return goja.Undefined()
 		}
-		if _, ok := timers[label]; ok {
-			fmt.Printf("%s: 0ms\n", label) // Simplified
-			delete(timers, label)
+		delete(timers, name)
+		printText(ConsoleInfo, "timeEnd", fmt.Sprintf("%s: %s", name, formatDuration(time.Since(start))))
+		return goja.Undefined()
+	})
+
+	// console.table renders arrays and objects of rows as a table
+	console.Set("table", func(call goja.FunctionCall) goja.Value {
+		data, ok := call.Argument(0).(*goja.Object)
+		if !ok {
+			print(ConsoleLog, "table", copyArgs(call))
+			return goja.Undefined()
 		}
+		var columns []string
+		if filter, ok := call.Argument(1).(*goja.Object); ok {
+			if err := vm.ExportTo(filter, &columns); err != nil {
+				panic(vm.NewTypeError("The \"properties\" argument must be an array of strings"))
+			}
+		}
+		table := formatTable(vm, data, columns)
+		emit(ConsoleLog, "table", []goja.Value{data}, func(bool) string {
+			return table
+		})
 		return goja.Undefined()
 	})
 
 	vm.Set("console", console)
 }
+
+// copyArgs copies the arguments of a call, which share storage with the VM
+// stack, so they stay valid while the sink runs
+func copyArgs(call goja.FunctionCall) []goja.Value {
+	return append([]goja.Value(nil), call.Arguments...)
+}
+
+// callerLocation returns the position of the innermost script frame on the
+// call stack
+func callerLocation(vm *goja.Runtime) SourceLocation {
+	for _, frame := range vm.CaptureCallStack(0, nil) {
+		pos := frame.Position()
+		if pos.Filename != "" && !isInternalFrame(&frame) {
+			return SourceLocation{File: pos.Filename, Line: pos.Line, Column: pos.Column}
+		}
+	}
+	return SourceLocation{}
+}
+
+// formatDuration formats an elapsed time like Node.js's console.timeEnd
+func formatDuration(d time.Duration) string {
+	ms := float64(d) / float64(time.Millisecond)
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%d:%02d:%06.3f (h:mm:ss.mmm)", int(d.Hours()), int(d.Minutes())%60, float64(d%time.Minute)/float64(time.Second))
+	case d >= time.Minute:
+		return fmt.Sprintf("%d:%06.3f (m:ss.mmm)", int(d.Minutes()), float64(d%time.Minute)/float64(time.Second))
+	case d >= time.Second:
+		return fmt.Sprintf("%.3fs", d.Seconds())
+	}
+	return fmt.Sprintf("%.3fms", ms)
+}
+
+// formatCallStack formats the JS frames of stack as the lines of a stack
+// trace. Native frames, such as the console method itself, and the event
+// loop's internal frames are left out.
+func formatCallStack(stack []goja.StackFrame) string {
+	var b strings.Builder
+	for i := range stack {
+		frame := &stack[i]
+		pos := frame.Position()
+		if pos.Filename == "" || isInternalFrame(frame) {
+			continue
+		}
+
+		location := fmt.Sprintf("%s:%d:%d", pos.Filename, pos.Line, pos.Column)
+		if name := frame.FuncName(); name != "" && name != "<anonymous>" {
+			fmt.Fprintf(&b, "\n    at %s (%s)", name, location)
+		} else {
+			fmt.Fprintf(&b, "\n    at %s", location)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,219 @@
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// ConsoleLevel is the severity of a console message
+type ConsoleLevel string
+
+// Console levels. log, info, debug, dir, table, count, group and time
+// messages are ConsoleLog, ConsoleInfo or ConsoleDebug; warn and assert are
+// ConsoleWarn; error is ConsoleError and trace is ConsoleTrace.
+const (
+	ConsoleLog   ConsoleLevel = "log"
+	ConsoleInfo  ConsoleLevel = "info"
+	ConsoleDebug ConsoleLevel = "debug"
+	ConsoleWarn  ConsoleLevel = "warn"
+	ConsoleError ConsoleLevel = "error"
+	ConsoleTrace ConsoleLevel = "trace"
+)
+
+// SourceLocation is the script position a console method was called from
+type SourceLocation struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// ConsoleEntry is a single message written through the console object
+type ConsoleEntry struct {
+	Level ConsoleLevel
+	// Method is the console method that produced the entry, e.g. "log" or "table"
+	Method string
+	// Args are the arguments of the call. They may only be used while the
+	// sink's Write method runs.
+	Args []goja.Value
+	Time time.Time
+	// Source is where the console method was called from; it is empty for
+	// calls made outside of any script
+	Source SourceLocation
+	// Group holds the labels of the console.group calls the entry is nested in
+	Group []string
+
+	vm     *goja.Runtime
+	render func(colors bool) string
+	text   [2]*string
+}
+
+// Text returns the formatted message, with ANSI colors if colors is set.
+// It may only be called while the sink's Write method runs.
+func (e *ConsoleEntry) Text(colors bool) string {
+	i := 0
+	if colors {
+		i = 1
+	}
+	if e.text[i] == nil {
+		text := e.render(colors)
+		e.text[i] = &text
+	}
+	return *e.text[i]
+}
+
+// ConsoleSink receives everything scripts write through the console object.
+// Write is called on the event loop goroutine, once per console call.
+type ConsoleSink interface {
+	Write(entry *ConsoleEntry)
+}
+
+// textSink writes console messages as plain text lines, the way a terminal
+// shows them
+type textSink struct {
+	mu     sync.Mutex
+	stdout io.Writer
+	stderr io.Writer
+	colors [2]bool
+}
+
+// NewTextSink returns a ConsoleSink that writes messages as text: warnings,
+// errors and traces to stderr and everything else to stdout. Output is
+// colored when the writer is a terminal.
+func NewTextSink(stdout, stderr io.Writer) ConsoleSink {
+	return &textSink{
+		stdout: stdout,
+		stderr: stderr,
+		colors: [2]bool{UseColors(stdout), UseColors(stderr)},
+	}
+}
+
+// textPrefixes are put in front of the text of the methods that have one
+var textPrefixes = map[string]string{
+	"warn":   "[WARN]",
+	"error":  "[ERROR]",
+	"debug":  "[DEBUG]",
+	"assert": "[ASSERT]",
+}
+
+func (s *textSink) Write(entry *ConsoleEntry) {
+	w, colors := s.stdout, s.colors[0]
+	switch entry.Level {
+	case ConsoleWarn, ConsoleError, ConsoleTrace:
+		w, colors = s.stderr, s.colors[1]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry.Method == "clear" {
+		if colors {
+			fmt.Fprint(w, "\033[H\033[2J")
+		}
+		return
+	}
+
+	msg := entry.Text(colors)
+	if prefix, ok := textPrefixes[entry.Method]; ok {
+		if msg == "" {
+			msg = prefix
+		} else {
+			msg = prefix + " " + msg
+		}
+	}
+	if len(entry.Group) > 0 {
+		indent := strings.Repeat("  ", len(entry.Group))
+		msg = indent + strings.ReplaceAll(msg, "\n", "\n"+indent)
+	}
+	fmt.Fprintln(w, msg)
+}
+
+// jsonSink writes one JSON object per console message
+type jsonSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONSink returns a ConsoleSink that writes each message to w as a
+// single line of JSON with the fields time, level, method, message, args,
+// source and, inside console.group, group
+func NewJSONSink(w io.Writer) ConsoleSink {
+	return &jsonSink{w: w}
+}
+
+// jsonEntry is the JSON form of a ConsoleEntry
+type jsonEntry struct {
+	Time    string            `json:"time"`
+	Level   ConsoleLevel      `json:"level"`
+	Method  string            `json:"method"`
+	Message string            `json:"message"`
+	Args    []json.RawMessage `json:"args,omitempty"`
+	Source  *SourceLocation   `json:"source,omitempty"`
+	Group   []string          `json:"group,omitempty"`
+}
+
+func (s *jsonSink) Write(entry *ConsoleEntry) {
+	if entry.Method == "clear" {
+		return
+	}
+
+	out := jsonEntry{
+		Time:    entry.Time.UTC().Format(time.RFC3339Nano),
+		Level:   entry.Level,
+		Method:  entry.Method,
+		Message: entry.Text(false),
+		Group:   entry.Group,
+	}
+	if entry.Source.File != "" {
+		source := entry.Source
+		out.Source = &source
+	}
+	for _, arg := range entry.Args {
+		out.Args = append(out.Args, jsonArg(entry.vm, arg))
+	}
+
+	line, err := json.Marshal(out)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.Write(append(line, '\n'))
+}
+
+// jsonArg converts a console argument to JSON. Values JSON cannot represent,
+// such as functions, symbols and circular objects, become their inspected
+// string.
+func jsonArg(vm *goja.Runtime, arg goja.Value) json.RawMessage {
+	if arg == nil || goja.IsUndefined(arg) {
+		return json.RawMessage("null")
+	}
+
+	var data []byte
+	var err error
+	switch v := arg.(type) {
+	case *goja.Symbol:
+		err = fmt.Errorf("symbol")
+	case *goja.Object:
+		if _, isFunc := goja.AssertFunction(v); isFunc {
+			err = fmt.Errorf("function")
+		} else if v.ClassName() == "Error" {
+			// Errors have no enumerable properties worth serializing
+			err = fmt.Errorf("error")
+		} else {
+			data, err = v.MarshalJSON()
+		}
+	default:
+		data, err = json.Marshal(arg.Export())
+	}
+	if err != nil || len(data) == 0 {
+		data, _ = json.Marshal(Inspect(vm, arg, InspectOptions{Depth: DefaultInspectDepth}))
+	}
+	return data
+}
@@ -0,0 +1,121 @@
+package modules_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gojs/internal/jstest"
+	"gojs/modules"
+	"gojs/runtime"
+)
+
+func TestTextSinkSeparatesStreams(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	opts := runtime.Options{Console: modules.NewTextSink(&stdout, &stderr)}
+	if _, err := jstest.RunWith(t, opts, `
+		console.log('log');
+		console.debug('debug');
+		console.warn('warn');
+		console.error();
+		console.group('g');
+		console.error('nested');
+		console.assert(false, 'assert');
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if want := "log\n[DEBUG] debug\ng\n"; stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+	if want := "[WARN] warn\n[ERROR]\n  [ERROR] nested\n  [ASSERT] Assertion failed: assert\n"; stderr.String() != want {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+}
+
+func TestJSONSink(t *testing.T) {
+	var out bytes.Buffer
+	opts := runtime.Options{Console: modules.NewJSONSink(&out)}
+	if _, err := jstest.RunWith(t, opts, `
+		console.warn('disk %d%% full', 91);
+		console.group('outer');
+		  console.log({ a: [1] }, () => {});
+		console.clear();
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3:\n%s", len(lines), out.String())
+	}
+	type entry struct {
+		Time    string
+		Level   string
+		Method  string
+		Message string
+		Args    []interface{}
+		Source  modules.SourceLocation
+		Group   []string
+	}
+	var entries []entry
+	for _, line := range lines {
+		var e entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+
+	warn := entries[0]
+	if warn.Level != "warn" || warn.Method != "warn" || warn.Message != "disk 91% full" || warn.Time == "" {
+		t.Errorf("warn entry = %+v", warn)
+	}
+	if args, _ := json.Marshal(warn.Args); string(args) != `["disk %d%% full",91]` {
+		t.Errorf("warn args = %s", args)
+	}
+	if warn.Source.File != "test.js" || warn.Source.Line != 2 || warn.Source.Column != 15 {
+		t.Errorf("warn source = %+v", warn.Source)
+	}
+
+	log := entries[2]
+	if log.Level != "log" || log.Message != "{ a: [ 1 ] } [Function (anonymous)]" {
+		t.Errorf("log entry = %+v", log)
+	}
+	if args, _ := json.Marshal(log.Args); string(args) != `[{"a":[1]},"[Function (anonymous)]"]` {
+		t.Errorf("log args = %s", args)
+	}
+	if len(log.Group) != 1 || log.Group[0] != "outer" {
+		t.Errorf("log group = %v", log.Group)
+	}
+}
+
+// collector is a ConsoleSink that keeps the level and text of each entry
+type collector struct {
+	entries []string
+}
+
+func (c *collector) Write(e *modules.ConsoleEntry) {
+	c.entries = append(c.entries, string(e.Level)+" "+e.Method+" "+e.Text(false))
+}
+
+func TestCustomConsoleSink(t *testing.T) {
+	sink := &collector{}
+	if _, err := jstest.RunWith(t, runtime.Options{Console: sink}, `
+		console.info('a', 1);
+		console.table([1]);
+		console.trace('here');
+		console.count();
+	`); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"info info a 1", "log table", "trace trace Trace: here", "info count default: 1"}
+	if len(sink.entries) != len(want) {
+		t.Fatalf("entries = %q, want %q", sink.entries, want)
+	}
+	for i, entry := range sink.entries {
+		if !strings.HasPrefix(entry, want[i]) {
+			t.Errorf("entry %d = %q, want prefix %q", i, entry, want[i])
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package modules
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// Column headers used by console.table
+const (
+	tableIndexKey     = "(index)"
+	tableIterationKey = "(iteration index)"
+	tableKeyKey       = "Key"
+	tableValuesKey    = "Values"
+)
+
+// formatTable renders data as the box-drawn table console.table prints. The
+// rows are the entries of data; object rows are split into a column per
+// property, restricted to columns if it is not nil, and primitive rows go
+// into a Values column.
+func formatTable(vm *goja.Runtime, data *goja.Object, columns []string) string {
+	in := inspectorOf(vm)
+
+	// cell formats a value shown in the table, abbreviating objects with
+	// more than two properties
+	cell := func(v goja.Value) string {
+		ctx := &inspectContext{inspector: in}
+		if obj, ok := v.(*goja.Object); ok && obj.ClassName() != "Array" && len(obj.Keys()) > 2 {
+			return ctx.formatValue(v, 1)
+		}
+		return ctx.formatValue(v, 0)
+	}
+	indices := func(n int) []string {
+		index := make([]string, n)
+		for i := range index {
+			index[i] = strconv.Itoa(i)
+		}
+		return index
+	}
+
+	switch (&inspectContext{inspector: in}).kindOf(data, "") {
+	case "Map":
+		var keys, values []string
+		in.mapForEach(data, vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			keys = append(keys, cell(call.Argument(1)))
+			values = append(values, cell(call.Argument(0)))
+			return goja.Undefined()
+		}))
+		return renderTable([]string{tableIterationKey, tableKeyKey, tableValuesKey}, [][]string{indices(len(keys)), keys, values})
+	case "Set":
+		var values []string
+		in.setForEach(data, vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			values = append(values, cell(call.Argument(0)))
+			return goja.Undefined()
+		}))
+		return renderTable([]string{tableIterationKey, tableValuesKey}, [][]string{indices(len(values)), values})
+	}
+
+	rowKeys := data.Keys()
+	var head []string
+	cells := make(map[string][]string)
+	var values []string
+	hasPrimitives := false
+
+	for i, rowKey := range rowKeys {
+		item := data.Get(rowKey)
+		row, isObject := item.(*goja.Object)
+		if columns == nil && !isObject {
+			if values == nil {
+				values = make([]string, len(rowKeys))
+			}
+			hasPrimitives = true
+			values[i] = cell(item)
+			continue
+		}
+
+		keys := columns
+		if keys == nil {
+			keys = row.Keys()
+		}
+		for _, key := range keys {
+			column, ok := cells[key]
+			if !ok {
+				head = append(head, key)
+				column = make([]string, len(rowKeys))
+			}
+			if isObject && hasOwnProperty(in, row, key) {
+				column[i] = cell(row.Get(key))
+			}
+			cells[key] = column
+		}
+	}
+
+	table := [][]string{rowKeys}
+	for _, key := range head {
+		table = append(table, cells[key])
+	}
+	head = append([]string{tableIndexKey}, head...)
+	if hasPrimitives {
+		head = append(head, tableValuesKey)
+		table = append(table, values)
+	}
+	return renderTable(head, table)
+}
+
+// hasOwnProperty reports whether obj has an own property called key
+func hasOwnProperty(in *inspector, obj *goja.Object, key string) bool {
+	desc, err := in.getOwnPropertyDescriptor(goja.Undefined(), obj, in.vm.ToValue(key))
+	return err == nil && !goja.IsUndefined(desc)
+}
+
+// renderTable draws head and the given columns of cells with box-drawing
+// characters, left-aligning every cell
+func renderTable(head []string, columns [][]string) string {
+	widths := make([]int, len(head))
+	rows := 0
+	for i, title := range head {
+		widths[i] = visibleLength(title)
+		if len(columns[i]) > rows {
+			rows = len(columns[i])
+		}
+	}
+	cellAt := func(column, row int) string {
+		if row < len(columns[column]) {
+			return columns[column][row]
+		}
+		return ""
+	}
+	for i := range head {
+		for j := 0; j < rows; j++ {
+			if width := visibleLength(cellAt(i, j)); width > widths[i] {
+				widths[i] = width
+			}
+		}
+	}
+
+	divider := make([]string, len(widths))
+	for i, width := range widths {
+		divider[i] = strings.Repeat("─", width+2)
+	}
+	renderRow := func(cells []string) string {
+		padded := make([]string, len(cells))
+		for i, cell := range cells {
+			padded[i] = cell + strings.Repeat(" ", widths[i]-visibleLength(cell))
+		}
+		return "│ " + strings.Join(padded, " │ ") + " │"
+	}
+
+	lines := []string{
+		"┌" + strings.Join(divider, "┬") + "┐",
+		renderRow(head),
+		"├" + strings.Join(divider, "┼") + "┤",
+	}
+	for j := 0; j < rows; j++ {
+		row := make([]string, len(head))
+		for i := range head {
+			row[i] = cellAt(i, j)
+		}
+		lines = append(lines, renderRow(row))
+	}
+	lines = append(lines, "└"+strings.Join(divider, "┴")+"┘")
+	return strings.Join(lines, "\n")
+}
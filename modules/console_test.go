@@ -0,0 +1,71 @@
+package modules_test
+
+import (
+	"regexp"
+	"testing"
+
+	"gojs/internal/jstest"
+)
+
+func TestConsoleCount(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		console.count(); console.count('x'); console.count();
+		console.countReset(); console.count();
+	`, "default: 1\nx: 1\ndefault: 2\ndefault: 1\n")
+}
+
+func TestConsoleGroup(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		console.group('G');
+		console.log('in\nsecond line');
+		console.groupCollapsed();
+		console.info('deeper');
+		console.groupEnd();
+		console.groupEnd();
+		console.groupEnd();
+		console.log('out');
+	`, "G\n  in\n  second line\n    deeper\nout\n")
+}
+
+func TestConsoleTable(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		console.table([{ a: 1, b: 'y' }, { a: 2, c: true }]);
+		console.table({ r1: { v: 1, w: 0 }, r2: { v: 2 } }, ['v']);
+		console.table([1, 'two']);
+		console.table('not tabular');
+	`, `┌─────────┬───┬─────┬──────┐
+│ (index) │ a │ b   │ c    │
+├─────────┼───┼─────┼──────┤
+│ 0       │ 1 │ 'y' │      │
+│ 1       │ 2 │     │ true │
+└─────────┴───┴─────┴──────┘
+┌─────────┬───┐
+│ (index) │ v │
+├─────────┼───┤
+│ r1      │ 1 │
+│ r2      │ 2 │
+└─────────┴───┘
+┌─────────┬────────┐
+│ (index) │ Values │
+├─────────┼────────┤
+│ 0       │ 1      │
+│ 1       │ 'two'  │
+└─────────┴────────┘
+not tabular
+`)
+}
+
+func TestConsoleTime(t *testing.T) {
+	out, err := jstest.Run(t, `
+		console.time('t');
+		console.timeLog('t', 'step', 1);
+		console.timeEnd('t');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := regexp.MustCompile(`^t: \d+\.\d{3}ms step 1\nt: \d+\.\d{3}ms\n$`)
+	if !want.MatchString(out) {
+		t.Errorf("output = %q, want %v", out, want)
+	}
+}
@@ -0,0 +1,391 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/dop251/goja"
+)
+
+// errnoNames maps the errors of system calls to the codes Node.js reports
+// for them
+var errnoNames = map[syscall.Errno]string{
+	syscall.EPERM:         "EPERM",
+	syscall.ENOENT:        "ENOENT",
+	syscall.ESRCH:         "ESRCH",
+	syscall.EINTR:         "EINTR",
+	syscall.EIO:           "EIO",
+	syscall.ENXIO:         "ENXIO",
+	syscall.E2BIG:         "E2BIG",
+	syscall.ENOEXEC:       "ENOEXEC",
+	syscall.EBADF:         "EBADF",
+	syscall.ECHILD:        "ECHILD",
+	syscall.EAGAIN:        "EAGAIN",
+	syscall.ENOMEM:        "ENOMEM",
+	syscall.EACCES:        "EACCES",
+	syscall.EFAULT:        "EFAULT",
+	syscall.EBUSY:         "EBUSY",
+	syscall.EEXIST:        "EEXIST",
+	syscall.EXDEV:         "EXDEV",
+	syscall.ENODEV:        "ENODEV",
+	syscall.ENOTDIR:       "ENOTDIR",
+	syscall.EISDIR:        "EISDIR",
+	syscall.EINVAL:        "EINVAL",
+	syscall.ENFILE:        "ENFILE",
+	syscall.EMFILE:        "EMFILE",
+	syscall.ENOTTY:        "ENOTTY",
+	syscall.ETXTBSY:       "ETXTBSY",
+	syscall.EFBIG:         "EFBIG",
+	syscall.ENOSPC:        "ENOSPC",
+	syscall.ESPIPE:        "ESPIPE",
+	syscall.EROFS:         "EROFS",
+	syscall.EMLINK:        "EMLINK",
+	syscall.EPIPE:         "EPIPE",
+	syscall.ERANGE:        "ERANGE",
+	syscall.ENAMETOOLONG:  "ENAMETOOLONG",
+	syscall.ENOSYS:        "ENOSYS",
+	syscall.ENOTEMPTY:     "ENOTEMPTY",
+	syscall.ELOOP:         "ELOOP",
+	syscall.ENOTSUP:       "ENOTSUP",
+	syscall.ENOTSOCK:      "ENOTSOCK",
+	syscall.EADDRINUSE:    "EADDRINUSE",
+	syscall.EADDRNOTAVAIL: "EADDRNOTAVAIL",
+	syscall.ENETDOWN:      "ENETDOWN",
+	syscall.ENETUNREACH:   "ENETUNREACH",
+	syscall.ECONNABORTED:  "ECONNABORTED",
+	syscall.ECONNRESET:    "ECONNRESET",
+	syscall.ENOBUFS:       "ENOBUFS",
+	syscall.ENOTCONN:      "ENOTCONN",
+	syscall.ETIMEDOUT:     "ETIMEDOUT",
+	syscall.ECONNREFUSED:  "ECONNREFUSED",
+	syscall.EHOSTUNREACH:  "EHOSTUNREACH",
+	syscall.EALREADY:      "EALREADY",
+	syscall.EINPROGRESS:   "EINPROGRESS",
+	syscall.EAFNOSUPPORT:  "EAFNOSUPPORT",
+}
+
+// errnoMessages holds the descriptions Node.js uses where they differ from
+// the strerror text Go reports
+var errnoMessages = map[syscall.Errno]string{
+	syscall.EEXIST:  "file already exists",
+	syscall.EISDIR:  "illegal operation on a directory",
+	syscall.EAGAIN:  "resource temporarily unavailable",
+	syscall.ENOTSUP: "operation not supported on socket",
+}
+
+// nodeError is a Go error carrying the properties of a Node.js error. It is
+// converted to a JS Error with the same properties by jsError.
+type nodeError struct {
+	// name is the JS constructor of the error, "Error" if empty
+	name    string
+	code    string
+	message string
+	errno   syscall.Errno
+	syscall string
+	path    string
+	dest    string
+	err     error
+
+	// address and port locate the socket of network errors, or hostname
+	// the name that failed to resolve. port is -1 for Unix sockets.
+	address  string
+	port     int
+	hostname string
+}
+
+func (e *nodeError) Error() string {
+	return e.message
+}
+
+func (e *nodeError) Unwrap() error {
+	return e.err
+}
+
+// systemError describes err, returned by a system call on path, like a
+// Node.js system error: "ENOENT: no such file or directory, open 'x'". dest
+// is the second path of calls such as rename. A nil err stays nil.
+func systemError(err error, call, path string, dest ...string) error {
+	if err == nil {
+		return nil
+	}
+	var ne *nodeError
+	if errors.As(err, &ne) {
+		return err
+	}
+
+	e := &nodeError{syscall: call, path: path, err: err}
+	if len(dest) > 0 {
+		e.dest = dest[0]
+	}
+
+	var errno syscall.Errno
+	switch {
+	case errors.As(err, &errno):
+	case errors.Is(err, fs.ErrNotExist):
+		errno = syscall.ENOENT
+	case errors.Is(err, fs.ErrExist):
+		errno = syscall.EEXIST
+	case errors.Is(err, fs.ErrPermission):
+		errno = syscall.EACCES
+	}
+	name, ok := errnoNames[errno]
+	if !ok {
+		e.message = err.Error()
+		return e
+	}
+
+	e.code = name
+	e.errno = errno
+	description, ok := errnoMessages[errno]
+	if !ok {
+		description = errno.Error()
+	}
+	e.message = fmt.Sprintf("%s: %s, %s", name, description, call)
+	if path != "" {
+		e.message += fmt.Sprintf(" '%s'", path)
+	}
+	if e.dest != "" {
+		e.message += fmt.Sprintf(" -> '%s'", e.dest)
+	}
+	return e
+}
+
+// netError describes err, returned by the socket call call on address and
+// port, like Node.js: "connect ECONNREFUSED 127.0.0.1:80". Errors of listen
+// include the description: "listen EADDRINUSE: address already in use
+// :::80". Failed lookups become ENOTFOUND errors of getaddrinfo. port is -1
+// for Unix sockets.
+func netError(err error, call, address string, port int) error {
+	if err == nil {
+		return nil
+	}
+	var ne *nodeError
+	if errors.As(err, &ne) {
+		return err
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		e := &nodeError{code: "EAI_AGAIN", errno: 3001, syscall: "getaddrinfo", hostname: dnsErr.Name, err: err}
+		if dnsErr.IsNotFound {
+			e.code, e.errno = "ENOTFOUND", 3008
+		}
+		e.message = fmt.Sprintf("getaddrinfo %s %s", e.code, dnsErr.Name)
+		return e
+	}
+
+	location := address
+	if port >= 0 {
+		location = net.JoinHostPort(address, strconv.Itoa(port))
+		if strings.Contains(address, ":") {
+			// Node.js does not bracket IPv6 addresses
+			location = fmt.Sprintf("%s:%d", address, port)
+		}
+	}
+	e := &nodeError{syscall: call, address: address, port: port, err: err}
+	var errno syscall.Errno
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		errno = syscall.ETIMEDOUT
+	} else {
+		errors.As(err, &errno)
+	}
+	name, ok := errnoNames[errno]
+	if !ok {
+		e.message = err.Error()
+		return e
+	}
+	e.code, e.errno = name, errno
+	if call == "listen" {
+		description, ok := errnoMessages[errno]
+		if !ok {
+			description = errno.Error()
+		}
+		e.message = fmt.Sprintf("%s %s: %s", call, name, description)
+	} else {
+		e.message = fmt.Sprintf("%s %s", call, name)
+	}
+	if location != "" {
+		e.message += " " + location
+	}
+	return e
+}
+
+// throwError throws err to scripts as jsError converts it. A stack overflow
+// or an interrupt is rethrown unchanged so that scripts cannot catch it.
+func throwError(vm *goja.Runtime, err error) {
+	var overflow *goja.StackOverflowError
+	var interrupted *goja.InterruptedError
+	if errors.As(err, &overflow) || errors.As(err, &interrupted) {
+		panic(err)
+	}
+	panic(jsError(vm, err))
+}
+
+// jsError converts err to the JS value thrown to scripts: exceptions thrown
+// by JS keep their value, nodeErrors and module resolution errors become
+// Errors with their code and other properties, and anything else becomes a
+// plain Error
+func jsError(vm *goja.Runtime, err error) goja.Value {
+	var ex *goja.Exception
+	if errors.As(err, &ex) {
+		CleanErrorStack(vm, ex.Value())
+		return ex.Value()
+	}
+
+	var re *resolveError
+	if errors.As(err, &re) {
+		return NewNodeError(vm, "Error", re.Code, re.Error())
+	}
+
+	var ne *nodeError
+	if !errors.As(err, &ne) {
+		return NewNodeError(vm, "Error", "", err.Error())
+	}
+
+	name := ne.name
+	if name == "" {
+		name = "Error"
+	}
+	obj := NewNodeError(vm, name, ne.code, ne.message)
+	if ne.errno != 0 {
+		obj.Set("errno", -int(ne.errno))
+	}
+	if ne.syscall != "" {
+		obj.Set("syscall", ne.syscall)
+	}
+	if ne.path != "" {
+		obj.Set("path", ne.path)
+	}
+	if ne.dest != "" {
+		obj.Set("dest", ne.dest)
+	}
+	if ne.address != "" {
+		obj.Set("address", ne.address)
+		if ne.port >= 0 {
+			obj.Set("port", ne.port)
+		}
+	}
+	if ne.hostname != "" {
+		obj.Set("hostname", ne.hostname)
+	}
+	return obj
+}
+
+// NewSystemError creates the error thrown when the system call named call
+// fails on path, e.g. "ENOENT: no such file or directory, open 'x'", with the
+// code, errno, syscall and path properties of Node.js system errors
+func NewSystemError(vm *goja.Runtime, err error, call, path string, dest ...string) goja.Value {
+	return jsError(vm, systemError(err, call, path, dest...))
+}
+
+// NewNodeError creates a JS error with the given constructor name, such as
+// "TypeError", and a Node.js error code, which is left out if empty
+func NewNodeError(vm *goja.Runtime, name, code, message string) *goja.Object {
+	obj, err := vm.New(vm.Get(name), vm.ToValue(message))
+	if err != nil {
+		panic(err)
+	}
+	if code != "" {
+		obj.Set("code", code)
+	}
+	return obj
+}
+
+// ErrInvalidArgType creates the ERR_INVALID_ARG_TYPE TypeError thrown when
+// the argument name is not of the expected type, e.g. "of type function"
+func ErrInvalidArgType(vm *goja.Runtime, name, expected string, actual goja.Value) *goja.Object {
+	return NewNodeError(vm, "TypeError", "ERR_INVALID_ARG_TYPE",
+		fmt.Sprintf("The \"%s\" argument must be %s. Received %s", name, expected, describeReceived(vm, actual)))
+}
+
+// describeReceived describes a value the way Node.js argument errors do,
+// e.g. "type number (5)" or "an instance of Object"
+func describeReceived(vm *goja.Runtime, v goja.Value) string {
+	if v == nil || goja.IsUndefined(v) {
+		return "undefined"
+	}
+	if goja.IsNull(v) {
+		return "null"
+	}
+	if obj, ok := v.(*goja.Object); ok {
+		if _, isFunc := goja.AssertFunction(obj); isFunc {
+			if name := obj.Get("name"); name != nil && name.String() != "" {
+				return "function " + name.String()
+			}
+			return "function"
+		}
+		if ctor, ok := obj.Get("constructor").(*goja.Object); ok {
+			if name := ctor.Get("name"); name != nil && name.String() != "" {
+				return "an instance of " + name.String()
+			}
+		}
+		return Inspect(vm, v, InspectOptions{Depth: -1})
+	}
+
+	inspected := Inspect(vm, v, InspectOptions{})
+	if len(inspected) > 28 {
+		inspected = inspected[:25] + "..."
+	}
+	typ := "number"
+	switch v.(type) {
+	case *goja.Symbol:
+		typ = "symbol"
+	default:
+		switch v.Export().(type) {
+		case string:
+			typ = "string"
+		case bool:
+			typ = "boolean"
+		case *big.Int:
+			typ = "bigint"
+		}
+	}
+	return fmt.Sprintf("type %s (%s)", typ, inspected)
+}
+
+// errOutOfRange creates the ERR_OUT_OF_RANGE RangeError thrown when the
+// value of name is not within the described range
+func errOutOfRange(vm *goja.Runtime, name, rng string, actual interface{}) *goja.Object {
+	return NewNodeError(vm, "RangeError", "ERR_OUT_OF_RANGE",
+		fmt.Sprintf("The value of \"%s\" is out of range. It must be %s. Received %v", name, rng, actual))
+}
+
+// pathArg returns the path argument at index i, throwing
+// ERR_INVALID_ARG_TYPE if it is missing or not a string, Buffer or URL
+func pathArg(vm *goja.Runtime, args []goja.Value, i int, name string) string {
+	arg := argAt(args, i)
+	if s, ok := arg.Export().(string); ok {
+		return s
+	}
+	if obj, ok := arg.(*goja.Object); ok {
+		if data, ok := bufferOf(vm).uint8Bytes(obj); ok {
+			return string(data)
+		}
+		// URL objects of the file: scheme
+		if protocol := obj.Get("protocol"); protocol != nil && protocol.String() == "file:" {
+			if pathname := obj.Get("pathname"); pathname != nil {
+				if path, err := url.PathUnescape(pathname.String()); err == nil {
+					return path
+				}
+			}
+		}
+	}
+	panic(ErrInvalidArgType(vm, name, "of type string or an instance of Buffer or URL", arg))
+}
+
+// argAt returns the argument at index i, or undefined if there are fewer
+// arguments
+func argAt(args []goja.Value, i int) goja.Value {
+	if i < 0 || i >= len(args) {
+		return goja.Undefined()
+	}
+	return args[i]
+}
@@ -0,0 +1,152 @@
+package modules
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// InternalPrefix starts the source names of the runtime's own scripts and
+// the names of its native helpers. Their frames are left out of stack traces.
+const InternalPrefix = "gojs:internal/"
+
+// nativeFrameSuffix ends the stack trace lines of native functions
+const nativeFrameSuffix = " (native)"
+
+// errorConstructors are the global constructors replaced by SetupErrors
+var errorConstructors = []string{
+	"Error", "EvalError", "RangeError", "ReferenceError", "SyntaxError", "TypeError", "URIError", "AggregateError",
+}
+
+// SetupErrors replaces the global Error constructors with ones that remove
+// the runtime's internal frames from the stack of the errors they create.
+// The prototypes are shared with the original constructors, so instanceof
+// and subclassing behave as before. It also defines the __cleanStack global
+// that compiled catch clauses call on the exceptions they catch.
+func SetupErrors(vm *goja.Runtime) error {
+	var base *goja.Object
+	for _, name := range errorConstructors {
+		native, ok := vm.Get(name).(*goja.Object)
+		if !ok {
+			continue
+		}
+		ctor := wrapErrorConstructor(vm, name, native)
+		if base == nil {
+			base = ctor
+		} else if err := ctor.SetPrototype(base); err != nil {
+			return err
+		}
+		if err := vm.GlobalObject().DefineDataProperty(name, ctor, goja.FLAG_TRUE, goja.FLAG_TRUE, goja.FLAG_FALSE); err != nil {
+			return err
+		}
+	}
+	clean := func(call goja.FunctionCall) goja.Value {
+		CleanErrorStack(vm, call.Argument(0))
+		return goja.Undefined()
+	}
+	return vm.GlobalObject().DefineDataProperty(cleanStackFunc, vm.ToValue(clean), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+}
+
+// wrapErrorConstructor returns a constructor creating errors with native,
+// whose stacks are cleaned with CleanStack
+func wrapErrorConstructor(vm *goja.Runtime, name string, native *goja.Object) *goja.Object {
+	construct, _ := goja.AssertConstructor(native)
+	// Calling the constructor without new adds a frame for it
+	ownFrame := "\tat " + name + " (native)\n"
+
+	ctor := vm.ToValue(func(call goja.ConstructorCall) *goja.Object {
+		obj, err := construct(call.NewTarget, call.Arguments...)
+		if err != nil {
+			panic(err)
+		}
+		if stack := obj.Get("stack"); stack != nil && isString(stack) {
+			cleaned := CleanStack(stack.String())
+			if i := strings.Index(cleaned, "\n"); strings.HasPrefix(cleaned[i+1:], ownFrame) {
+				cleaned = cleaned[:i+1] + cleaned[i+1+len(ownFrame):]
+			}
+			setStack(vm, obj, stack.String(), cleaned)
+		}
+		return obj
+	}).ToObject(vm)
+
+	proto := native.Get("prototype")
+	ctor.DefineDataProperty("prototype", proto, goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	ctor.DefineDataProperty("name", vm.ToValue(name), goja.FLAG_FALSE, goja.FLAG_TRUE, goja.FLAG_FALSE)
+	ctor.DefineDataProperty("length", native.Get("length"), goja.FLAG_FALSE, goja.FLAG_TRUE, goja.FLAG_FALSE)
+	proto.ToObject(vm).DefineDataProperty("constructor", ctor, goja.FLAG_TRUE, goja.FLAG_TRUE, goja.FLAG_FALSE)
+	return ctor
+}
+
+// CleanErrorStack removes the runtime's internal frames from the stack of
+// the Error v. Errors thrown by the engine itself record every frame, so the
+// runtime cleans them wherever it catches or reports an exception.
+func CleanErrorStack(vm *goja.Runtime, v goja.Value) {
+	obj, ok := v.(*goja.Object)
+	if !ok || obj.ClassName() != "Error" {
+		return
+	}
+	if stack := obj.Get("stack"); stack != nil && isString(stack) {
+		setStack(vm, obj, stack.String(), CleanStack(stack.String()))
+	}
+}
+
+// setStack replaces the stack of obj with cleaned if cleaning changed it
+func setStack(vm *goja.Runtime, obj *goja.Object, stack, cleaned string) {
+	if cleaned != stack {
+		obj.DefineDataProperty("stack", vm.ToValue(cleaned), goja.FLAG_TRUE, goja.FLAG_TRUE, goja.FLAG_FALSE)
+	}
+}
+
+// CleanStack removes the lines of the runtime's internal frames, such as
+// the event loop's, and of its Go functions from a formatted stack trace
+func CleanStack(stack string) string {
+	if !strings.Contains(stack, InternalPrefix) && !strings.Contains(stack, nativeFrameSuffix) {
+		return stack
+	}
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(stack, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "at ") && (strings.Contains(trimmed, InternalPrefix) ||
+			strings.HasSuffix(trimmed, nativeFrameSuffix) && isGoFuncName(strings.TrimSuffix(trimmed[3:], nativeFrameSuffix))) {
+			continue
+		}
+		b.WriteString(line)
+	}
+	if !strings.HasSuffix(stack, "\n") {
+		return strings.TrimSuffix(b.String(), "\n")
+	}
+	return b.String()
+}
+
+// isInternalFrame reports whether frame belongs to one of the runtime's own
+// scripts, native helpers or Go functions
+func isInternalFrame(frame *goja.StackFrame) bool {
+	return strings.HasPrefix(frame.SrcName(), InternalPrefix) || strings.HasPrefix(frame.FuncName(), InternalPrefix) ||
+		frame.SrcName() == "<native>" && isGoFuncName(frame.FuncName())
+}
+
+// isGoFuncName reports whether name is the name of a Go function, such as
+// "gojs/modules.SetupRequire.func6.1". goja names native functions created
+// from Go functions that way when they are not given a name of their own.
+func isGoFuncName(name string) bool {
+	return strings.Contains(name, "/") || strings.Contains(name, ".func")
+}
+
+// ErrorString formats err like goja's Exception.Error, the thrown value
+// followed by the innermost frame, unless that frame is internal
+func ErrorString(err error) string {
+	ex, ok := err.(*goja.Exception)
+	if !ok || ex.Value() == nil {
+		return err.Error()
+	}
+
+	var b bytes.Buffer
+	b.WriteString(ex.Value().String())
+	if stack := ex.Stack(); len(stack) > 0 && !isInternalFrame(&stack[0]) &&
+		(stack[0].SrcName() != "<native>" || stack[0].FuncName() != "<native>") {
+		b.WriteString(" at ")
+		stack[0].Write(&b)
+	}
+	return b.String()
+}
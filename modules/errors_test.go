@@ -0,0 +1,97 @@
+package modules_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gojs/internal/jstest"
+)
+
+func TestFSSystemErrors(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	jstest.ExpectOutput(t, `
+		const fs = require('fs');
+		const missing = `+jstest.Quote(missing)+`;
+		try { fs.readFileSync(missing); } catch (e) {
+			console.log(e instanceof Error, e.code, e.errno, e.syscall, e.path === missing);
+			console.log(e.message === "ENOENT: no such file or directory, open '" + missing + "'");
+		}
+		try { fs.renameSync(missing, missing + '2'); } catch (e) { console.log(e.code, e.syscall, e.dest === missing + '2'); }
+		fs.readFile(missing, (e) => {
+			console.log('callback', e.code, e.syscall);
+			fs.promises.stat(missing).catch((e) => console.log('promise', e.code, e.syscall));
+		});
+	`, "true ENOENT -2 open true\ntrue\nENOENT rename true\ncallback ENOENT open\npromise ENOENT stat\n")
+}
+
+func TestInvalidArgTypeErrors(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		for (const f of [() => setTimeout('x'), () => setInterval(1), () => setImmediate(),
+			() => queueMicrotask(1), () => process.nextTick(null), () => require('fs').readFileSync(1n)]) {
+			try { f(); console.log('no error'); } catch (e) { console.log(e instanceof TypeError, e.code); }
+		}
+	`, "true ERR_INVALID_ARG_TYPE\ntrue ERR_INVALID_ARG_TYPE\ntrue ERR_INVALID_ARG_TYPE\n"+
+		"true ERR_INVALID_ARG_TYPE\ntrue ERR_INVALID_ARG_TYPE\ntrue ERR_INVALID_ARG_TYPE\n")
+}
+
+func TestBufferRangeErrors(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		try { Buffer.alloc(2).readUInt32LE(0); } catch (e) { console.log(e instanceof RangeError, e.code); }
+		try { Buffer.alloc(2).writeUInt8(300); } catch (e) { console.log(e instanceof RangeError, e.code); }
+	`, "true ERR_BUFFER_OUT_OF_BOUNDS\ntrue ERR_OUT_OF_RANGE\n")
+}
+
+func TestStacksHideInternalFrames(t *testing.T) {
+	out, err := jstest.Run(t, `
+		class CustomError extends Error {}
+		function make() { return new CustomError('x'); }
+		console.log(make() instanceof Error, Object.getPrototypeOf(TypeError) === Error, Error.prototype.constructor === Error);
+		console.log(make().stack, Error('called').stack);
+		setTimeout(() => {
+			try { null.x; } catch (e) { console.log(e); }
+			console.log(new RangeError('timer'));
+			Promise.reject(new Error('rejected'));
+		}, 0);
+	`)
+	if err == nil || !strings.Contains(err.Error(), "rejected") || strings.Contains(err.Error(), "internal") {
+		t.Errorf("err = %v, want the rejection without internal frames", err)
+	}
+	if !strings.HasPrefix(out, "true true true\n") {
+		t.Errorf("output = %q, want instanceof checks to pass", out)
+	}
+	for _, frame := range []string{"gojs:internal", "runTask", "(native)"} {
+		if strings.Contains(out, frame) {
+			t.Errorf("output contains %q:\n%s", frame, out)
+		}
+	}
+}
+
+func TestEngineErrorStacksHideInternalFrames(t *testing.T) {
+	dir := t.TempDir()
+	jstest.WriteFiles(t, dir, map[string]string{
+		"caught.js": "setTimeout(() => { try { null.v; } catch (e) { console.log(e.stack); } }, 0);",
+	})
+	module := filepath.Join(dir, "caught.js")
+	out, err := jstest.Run(t, `
+		process.on('uncaughtException', (e) => console.log(e.stack));
+		process.on('unhandledRejection', (e) => console.log(e.stack));
+		try { require('missing'); } catch (e) { console.log(e.stack); }
+		setTimeout(() => { null.x; }, 0);
+		setTimeout(() => { Promise.resolve().then(() => { null.y; }); }, 0);
+		setTimeout(() => { try { null.z; } catch (e) { console.log(e.stack); } }, 0);
+		setTimeout(() => { try { null.w; } catch ({ stack }) { console.log(stack); } }, 0);
+		require(`+jstest.Quote(module)+`);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(out, "TypeError") != 5 || !strings.Contains(out, "Cannot find module 'missing'") {
+		t.Fatalf("output = %q, want both exceptions and the require error", out)
+	}
+	for _, frame := range []string{"gojs:internal", "runTask", "(native)", "gojs/modules"} {
+		if strings.Contains(out, frame) {
+			t.Errorf("output contains %q:\n%s", frame, out)
+		}
+	}
+}
@@ -0,0 +1,665 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// importConditions are the conditional export keys matched by import
+var importConditions = []string{"import", "node", "default"}
+
+// Module formats
+const (
+	formatModule   = "module"
+	formatCommonJS = "commonjs"
+	formatJSON     = "json"
+	formatBuiltin  = "builtin"
+)
+
+// esModule is a node of the ES module graph. CommonJS, JSON and built-in
+// modules that are imported get one as well, so that their exports can be
+// imported by name.
+type esModule struct {
+	path       string
+	format     string
+	source     *esmSource
+	deps       []*esModule
+	linked     bool
+	body       goja.Callable // the module body of an ES module
+	context    *goja.Object  // the __esm object passed to body
+	getters    map[string]goja.Callable
+	exports    goja.Value // module.exports of other formats
+	namespace  *goja.Object
+	evaluation *goja.Promise
+	onStack    bool
+}
+
+// esmLoader loads and evaluates ES modules for a runtime
+type esmLoader struct {
+	vm      *goja.Runtime
+	loop    AsyncLoop
+	modules map[string]*esModule // by canonical path, "node:<name>" for built-ins
+	then    goja.Callable
+
+	// requireFile loads a CommonJS or JSON module, set by SetupRequire
+	requireFile func(path string) goja.Value
+}
+
+// SetupESM installs the ES module loader. Static imports are loaded before a
+// module runs; import() loads modules from a task on the event loop.
+//
+// goja has no module records, so modules are rewritten into async functions
+// that receive their imports through a scope object (see esmSource.wrapper).
+func SetupESM(vm *goja.Runtime, loop AsyncLoop) error {
+	l := &esmLoader{
+		vm:      vm,
+		loop:    loop,
+		modules: make(map[string]*esModule),
+	}
+
+	// Capture the intrinsic then, like the event loop does
+	settled, resolve, _ := vm.NewPromise()
+	if err := resolve(goja.Undefined()); err != nil {
+		return err
+	}
+	then, ok := goja.AssertFunction(vm.ToValue(settled).ToObject(vm).Get("then"))
+	if !ok {
+		return fmt.Errorf("Promise.prototype.then is not a function")
+	}
+	l.then = then
+
+	return vm.GlobalObject().DefineDataProperty("__esmLoader", vm.ToValue(l), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+}
+
+// esmLoaderOf returns the loader installed by SetupESM, or nil
+func esmLoaderOf(vm *goja.Runtime) *esmLoader {
+	val := vm.GlobalObject().Get("__esmLoader")
+	if val == nil {
+		return nil
+	}
+	l, _ := val.Export().(*esmLoader)
+	return l
+}
+
+// IsESModule reports whether the file at path is loaded as an ES module:
+// .mjs files, and .js files whose closest package.json has "type": "module"
+func IsESModule(path string) bool {
+	return moduleFormat(path) == formatModule
+}
+
+// moduleFormat determines how the file at path is loaded
+func moduleFormat(path string) string {
+	switch filepath.Ext(path) {
+	case ".mjs":
+		return formatModule
+	case ".json":
+		return formatJSON
+	case ".js":
+		if _, pkg := findPackageJSON(filepath.Dir(path)); pkg != nil && pkg.Type == "module" {
+			return formatModule
+		}
+	}
+	return formatCommonJS
+}
+
+// ImportFile loads the ES module at path with its dependencies and starts
+// evaluating it. The returned promise settles once evaluation, including any
+// top-level await, has finished.
+func ImportFile(vm *goja.Runtime, path string) (*goja.Promise, error) {
+	l := esmLoaderOf(vm)
+	if l == nil {
+		return nil, fmt.Errorf("ES modules are not set up - call SetupESM first")
+	}
+	m, err := l.load(canonicalPath(path))
+	if err != nil {
+		return nil, err
+	}
+	return l.evaluate(m), nil
+}
+
+// fileURL converts an absolute path into a file: URL
+func fileURL(path string) string {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+// resolve finds the module specifier refers to, loading it if needed
+func (l *esmLoader) resolve(specifier, fromDir string) (*esModule, error) {
+	name := strings.TrimPrefix(specifier, "node:")
+	if exports, err := builtinExports(l.vm, name); err == nil {
+		key := "node:" + name
+		if m := l.modules[key]; m != nil {
+			return m, nil
+		}
+		m := &esModule{path: key, format: formatBuiltin, exports: exports, linked: true}
+		l.modules[key] = m
+		return m, nil
+	} else if name != specifier {
+		return nil, fmt.Errorf("Built-in module '%s' not found", specifier)
+	}
+
+	if strings.HasPrefix(specifier, "file:") {
+		u, err := url.Parse(specifier)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid URL '%s'", specifier)
+		}
+		specifier = filepath.FromSlash(u.Path)
+	}
+
+	path, err := resolveModule(specifier, fromDir, importConditions)
+	if err != nil {
+		return nil, err
+	}
+	path = canonicalPath(path)
+	if ex := l.vm.Try(func() { checkRequire(l.vm, path) }); ex != nil {
+		return nil, ex
+	}
+	return l.load(path)
+}
+
+// load reads, rewrites and links the module at path. Modules are cached by
+// path; a module that is still being linked (a cycle) is returned as is.
+func (l *esmLoader) load(path string) (*esModule, error) {
+	if m := l.modules[path]; m != nil {
+		return m, nil
+	}
+
+	m := &esModule{path: path, format: moduleFormat(path)}
+	if m.format != formatModule {
+		m.linked = true
+		l.modules[path] = m
+		return m, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot find module '%s': %v", path, err)
+	}
+
+	source, err := transformESM(stripShebang(string(content)))
+	if err != nil {
+		return nil, fmt.Errorf("Error compiling module '%s': %v", path, err)
+	}
+	m.source = source
+
+	prefix, suffix := source.wrapper()
+	prg, err := compileWrapped(path, prefix, source.body, suffix)
+	if err != nil {
+		return nil, fmt.Errorf("Error compiling module '%s': %v", path, err)
+	}
+
+	l.modules[path] = m
+
+	// Link the dependencies before anything runs
+	dir := filepath.Dir(path)
+	for _, specifier := range source.requests {
+		dep, err := l.resolve(specifier, dir)
+		if err != nil {
+			delete(l.modules, path)
+			return nil, err
+		}
+		m.deps = append(m.deps, dep)
+	}
+	m.linked = true
+
+	locals := make([]string, 0, len(source.imports))
+	for local := range source.imports {
+		locals = append(locals, local)
+	}
+	sort.Strings(locals)
+	for _, local := range locals {
+		imp := source.imports[local]
+		dep := m.deps[imp.request]
+		if imp.name == "*" || dep.format != formatModule || !dep.linked {
+			continue
+		}
+		if !l.hasExport(dep, imp.name, nil) {
+			delete(l.modules, path)
+			return nil, fmt.Errorf("SyntaxError: The requested module '%s' does not provide an export named '%s'",
+				source.requests[imp.request], imp.name)
+		}
+	}
+
+	// Create the module body with its import scope
+	wrapper, err := l.vm.RunProgram(prg)
+	if err != nil {
+		delete(l.modules, path)
+		return nil, err
+	}
+	outer, _ := goja.AssertFunction(wrapper)
+	inner, err := outer(goja.Undefined(), l.vm.NewDynamicObject(&importScope{l: l, m: m}))
+	if err != nil {
+		delete(l.modules, path)
+		return nil, err
+	}
+	m.body, _ = goja.AssertFunction(inner)
+	m.context = l.moduleContext(m)
+
+	return m, nil
+}
+
+// moduleContext creates the __esm object through which a module body binds
+// its exports and reaches import() and import.meta
+func (l *esmLoader) moduleContext(m *esModule) *goja.Object {
+	vm := l.vm
+	dir := filepath.Dir(m.path)
+	context := vm.NewObject()
+
+	context.Set("bind", func(call goja.FunctionCall) goja.Value {
+		getters := call.Argument(0).ToObject(vm)
+		m.getters = make(map[string]goja.Callable)
+		for _, name := range getters.Keys() {
+			m.getters[name], _ = goja.AssertFunction(getters.Get(name))
+		}
+		return goja.Undefined()
+	})
+
+	context.Set("import", func(call goja.FunctionCall) goja.Value {
+		return l.dynamicImport(call.Argument(0).String(), dir)
+	})
+
+	meta := vm.NewObject()
+	meta.Set("url", fileURL(m.path))
+	meta.Set("filename", m.path)
+	meta.Set("dirname", dir)
+	meta.Set("resolve", func(call goja.FunctionCall) goja.Value {
+		specifier := call.Argument(0).String()
+		if _, err := builtinExports(vm, strings.TrimPrefix(specifier, "node:")); err == nil {
+			return vm.ToValue(specifier)
+		}
+		path, err := resolveModule(specifier, dir, importConditions)
+		if err != nil {
+			panic(jsError(vm, err))
+		}
+		return vm.ToValue(fileURL(canonicalPath(path)))
+	})
+	context.Set("meta", meta)
+
+	return context
+}
+
+// dynamicImport implements import(): the module is loaded from a task on
+// the event loop and the promise resolves with its namespace
+func (l *esmLoader) dynamicImport(specifier, fromDir string) goja.Value {
+	promise, resolve, reject := l.vm.NewPromise()
+
+	l.loop.RunOnLoop(func(vm *goja.Runtime) {
+		m, err := l.resolve(specifier, fromDir)
+		if err != nil {
+			reject(l.errorValue(err))
+			return
+		}
+		l.whenEvaluated(m, func() {
+			resolve(l.namespaceOf(m))
+		}, func(reason goja.Value) {
+			reject(reason)
+		})
+	})
+
+	return l.vm.ToValue(promise)
+}
+
+// require implements require() of an ES module: its namespace is returned
+// if the module graph evaluates synchronously
+func (l *esmLoader) require(path string) goja.Value {
+	m, err := l.load(path)
+	if err != nil {
+		throwError(l.vm, err)
+	}
+
+	p := l.evaluate(m)
+	switch p.State() {
+	case goja.PromiseStateFulfilled:
+		return l.namespaceOf(m)
+	case goja.PromiseStateRejected:
+		panic(p.Result())
+	}
+	panic(NewNodeError(l.vm, "Error", "ERR_REQUIRE_ASYNC_MODULE",
+		"require() cannot be used on an ES module with top-level await: "+path))
+}
+
+// errorValue converts a loader error into the value thrown to scripts
+func (l *esmLoader) errorValue(err error) goja.Value {
+	return jsError(l.vm, err)
+}
+
+// whenEvaluated calls done once m has been evaluated, or fail with the
+// reason its evaluation failed
+func (l *esmLoader) whenEvaluated(m *esModule, done func(), fail func(goja.Value)) {
+	p := l.evaluate(m)
+	switch p.State() {
+	case goja.PromiseStateFulfilled:
+		done()
+	case goja.PromiseStateRejected:
+		fail(p.Result())
+	default:
+		l.onSettled(p, func(goja.Value) { done() }, fail)
+	}
+}
+
+// onSettled attaches reactions to p with the intrinsic then
+func (l *esmLoader) onSettled(p *goja.Promise, onFulfilled, onRejected func(goja.Value)) {
+	reaction := func(fn func(goja.Value)) goja.Value {
+		return l.vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			fn(call.Argument(0))
+			return goja.Undefined()
+		})
+	}
+	if _, err := l.then(l.vm.ToValue(p), reaction(onFulfilled), reaction(onRejected)); err != nil {
+		panic(err)
+	}
+}
+
+// evaluate runs m after its dependencies, in post-order. A module graph
+// without top-level await is evaluated synchronously, so the returned promise
+// is already settled. Dependencies that are still being evaluated further up
+// (import cycles) are not waited for.
+func (l *esmLoader) evaluate(m *esModule) *goja.Promise {
+	if m.evaluation != nil {
+		return m.evaluation
+	}
+
+	promise, resolve, reject := l.vm.NewPromise()
+	m.evaluation = promise
+	// Failures are reported to whoever imported the module, so the
+	// evaluation promise itself never counts as an unhandled rejection
+	noop := func(goja.Value) {}
+	l.onSettled(promise, noop, noop)
+
+	fail := func(reason goja.Value) {
+		reject(reason)
+	}
+
+	m.onStack = true
+	var waiting []*goja.Promise
+	for _, dep := range m.deps {
+		if dep.onStack {
+			continue
+		}
+		p := l.evaluate(dep)
+		switch p.State() {
+		case goja.PromiseStateRejected:
+			m.onStack = false
+			fail(p.Result())
+			return promise
+		case goja.PromiseStatePending:
+			waiting = append(waiting, p)
+		}
+	}
+	m.onStack = false
+
+	l.afterAll(waiting, func() {
+		l.execute(m, func() { resolve(goja.Undefined()) }, fail)
+	}, fail)
+
+	return promise
+}
+
+// afterAll calls done once every promise in waiting has fulfilled, or fail
+// as soon as one rejects
+func (l *esmLoader) afterAll(waiting []*goja.Promise, done func(), fail func(goja.Value)) {
+	if len(waiting) == 0 {
+		done()
+		return
+	}
+	l.onSettled(waiting[0], func(goja.Value) {
+		l.afterAll(waiting[1:], done, fail)
+	}, fail)
+}
+
+// execute runs the body of a single module whose dependencies have been evaluated
+func (l *esmLoader) execute(m *esModule, done func(), fail func(goja.Value)) {
+	vm := l.vm
+
+	switch m.format {
+	case formatBuiltin:
+		done()
+		return
+	case formatCommonJS, formatJSON:
+		if l.requireFile == nil {
+			fail(vm.ToValue("require is not set up"))
+			return
+		}
+		if ex := vm.Try(func() { m.exports = l.requireFile(m.path) }); ex != nil {
+			fail(ex.Value())
+			return
+		}
+		done()
+		return
+	}
+
+	res, err := m.body(goja.Undefined(), m.context)
+	if err != nil {
+		var ex *goja.Exception
+		if errors.As(err, &ex) {
+			fail(ex.Value())
+			return
+		}
+		panic(err)
+	}
+
+	p, ok := res.Export().(*goja.Promise)
+	if !ok {
+		done()
+		return
+	}
+	switch p.State() {
+	case goja.PromiseStateFulfilled:
+		done()
+	case goja.PromiseStateRejected:
+		l.onSettled(p, func(goja.Value) {}, func(goja.Value) {})
+		fail(p.Result())
+	default:
+		l.onSettled(p, func(goja.Value) { done() }, fail)
+	}
+}
+
+// namespaceOf returns the module namespace object of m
+func (l *esmLoader) namespaceOf(m *esModule) *goja.Object {
+	if m.namespace == nil {
+		m.namespace = l.vm.NewDynamicObject(&moduleNamespace{l: l, m: m})
+	}
+	return m.namespace
+}
+
+// hasExport reports whether m provides an export called name
+func (l *esmLoader) hasExport(m *esModule, name string, visited map[*esModule]bool) bool {
+	for _, n := range l.exportNames(m, visited) {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// exportNames lists the names exported by m, sorted
+func (l *esmLoader) exportNames(m *esModule, visited map[*esModule]bool) []string {
+	if m.format != formatModule {
+		names := []string{"default"}
+		if obj, ok := m.exports.(*goja.Object); ok {
+			for _, key := range obj.Keys() {
+				if key != "default" {
+					names = append(names, key)
+				}
+			}
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	if visited == nil {
+		visited = make(map[*esModule]bool)
+	}
+	if visited[m] {
+		return nil
+	}
+	visited[m] = true
+
+	seen := make(map[string]bool)
+	for name := range m.source.localExports {
+		seen[name] = true
+	}
+	for name := range m.source.reexports {
+		seen[name] = true
+	}
+	for _, request := range m.source.starExports {
+		if request >= len(m.deps) {
+			continue
+		}
+		for _, name := range l.exportNames(m.deps[request], visited) {
+			if name != "default" {
+				seen[name] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveExport returns the current value of the export name of m
+func (l *esmLoader) resolveExport(m *esModule, name string, visited map[*esModule]bool) (goja.Value, bool) {
+	vm := l.vm
+
+	if m.format != formatModule {
+		if m.exports == nil {
+			return nil, false
+		}
+		if name == "default" {
+			return m.exports, true
+		}
+		obj, ok := m.exports.(*goja.Object)
+		if !ok {
+			return nil, false
+		}
+		if val := obj.Get(name); val != nil {
+			return val, true
+		}
+		return nil, false
+	}
+
+	if visited == nil {
+		visited = make(map[*esModule]bool)
+	}
+	if visited[m] {
+		return nil, false
+	}
+	visited[m] = true
+
+	if _, ok := m.source.localExports[name]; ok {
+		getter := m.getters[name]
+		if getter == nil {
+			ctor := vm.Get("ReferenceError")
+			err, _ := vm.New(ctor, vm.ToValue(fmt.Sprintf("Cannot access '%s' before initialization", name)))
+			panic(err)
+		}
+		val, err := getter(goja.Undefined())
+		if err != nil {
+			panic(err)
+		}
+		return val, true
+	}
+
+	if imp, ok := m.source.reexports[name]; ok {
+		return l.importBinding(m, imp), true
+	}
+
+	if name != "default" {
+		for _, request := range m.source.starExports {
+			if val, ok := l.resolveExport(m.deps[request], name, visited); ok {
+				return val, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// importBinding returns the current value of an imported binding of m
+func (l *esmLoader) importBinding(m *esModule, imp esmImport) goja.Value {
+	dep := m.deps[imp.request]
+	if imp.name == "*" {
+		return l.namespaceOf(dep)
+	}
+	if val, ok := l.resolveExport(dep, imp.name, nil); ok {
+		return val
+	}
+	return goja.Undefined()
+}
+
+// moduleNamespace is the object returned by import * as ns and import().
+// Its properties are read-only views of the module's exports.
+type moduleNamespace struct {
+	l *esmLoader
+	m *esModule
+}
+
+func (n *moduleNamespace) Get(key string) goja.Value {
+	if val, ok := n.l.resolveExport(n.m, key, nil); ok {
+		return val
+	}
+	return nil
+}
+
+func (n *moduleNamespace) Set(key string, val goja.Value) bool {
+	return false
+}
+
+func (n *moduleNamespace) Has(key string) bool {
+	return n.l.hasExport(n.m, key, nil)
+}
+
+func (n *moduleNamespace) Delete(key string) bool {
+	return false
+}
+
+func (n *moduleNamespace) Keys() []string {
+	return n.l.exportNames(n.m, nil)
+}
+
+// importScope holds the imported bindings of a module. The module body is
+// compiled inside with (scope), so reading an import always sees the
+// exporting module's current value.
+type importScope struct {
+	l *esmLoader
+	m *esModule
+}
+
+func (s *importScope) Get(key string) goja.Value {
+	imp, ok := s.m.source.imports[key]
+	if !ok {
+		return nil
+	}
+	return s.l.importBinding(s.m, imp)
+}
+
+func (s *importScope) Set(key string, val goja.Value) bool {
+	panic(s.l.vm.NewTypeError("Assignment to constant variable."))
+}
+
+func (s *importScope) Has(key string) bool {
+	_, ok := s.m.source.imports[key]
+	return ok
+}
+
+func (s *importScope) Delete(key string) bool {
+	return false
+}
+
+func (s *importScope) Keys() []string {
+	return nil
+}
@@ -0,0 +1,143 @@
+package modules_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"gojs/internal/jstest"
+	"gojs/runtime"
+)
+
+func TestESMImportsAndExports(t *testing.T) {
+	expectFileOutput(t, map[string]string{
+		"package.json": `{"type": "module"}`,
+		"main.js": `
+			import greet, { count, inc as increment } from './counter.js';
+			import * as ns from './reexport.js';
+			console.log(greet(), count);
+			increment();
+			console.log(count, ns.count, ns.lib.name, ns.renamed);
+		`,
+		"counter.js": `
+			export let count = 0;
+			export function inc() { count++; }
+			export default function () { return 'hi'; }
+		`,
+		"reexport.js": `
+			export * from './counter.js';
+			export * as lib from './lib.js';
+			export { name as renamed } from './lib.js';
+		`,
+		"lib.js": "export const name = 'lib';",
+	}, "hi 0\n1 1 lib lib\n")
+}
+
+func TestESMImportedBindingsAreReadOnly(t *testing.T) {
+	expectFileOutput(t, map[string]string{
+		"package.json": `{"type": "module"}`,
+		"main.js": `
+			import { value } from './lib.js';
+			try { value = 2; } catch (e) { console.log(e instanceof TypeError); }
+			console.log(value);
+		`,
+		"lib.js": "export const value = 1;",
+	}, "true\n1\n")
+}
+
+func TestESMDynamicImportFromCommonJS(t *testing.T) {
+	expectFileOutput(t, map[string]string{
+		"main.js": `
+			import('./lib.mjs').then((ns) => console.log(ns.default, ns.name));
+			console.log('sync');
+		`,
+		"lib.mjs": "export default 'default'; export const name = 'lib';",
+	}, "sync\ndefault lib\n")
+}
+
+func TestESMTopLevelAwait(t *testing.T) {
+	expectFileOutput(t, map[string]string{
+		"main.js": "import('./entry.mjs');",
+		"entry.mjs": `
+			import { value } from './slow.mjs';
+			console.log('entry', value);
+		`,
+		"slow.mjs": `
+			export const value = await new Promise((resolve) => setTimeout(() => resolve(5), 1));
+			console.log('slow');
+		`,
+	}, "slow\nentry 5\n")
+}
+
+func TestESMImportMeta(t *testing.T) {
+	expectFileOutput(t, map[string]string{
+		"package.json": `{"type": "module"}`,
+		"main.js": `
+			import path from 'path';
+			console.log(path.basename(import.meta.filename), import.meta.dirname === path.dirname(import.meta.filename));
+			console.log(import.meta.url.startsWith('file://'), import.meta.url.endsWith('/main.js'));
+			console.log(import.meta.resolve('./lib.js').endsWith('/lib.js'));
+		`,
+		"lib.js": "",
+	}, "main.js true\ntrue true\ntrue\n")
+}
+
+func TestESMCommonJSInterop(t *testing.T) {
+	expectFileOutput(t, map[string]string{
+		"package.json": `{"type": "module"}`,
+		"main.js": `
+			import lib, { name } from './lib.cjs';
+			import data from './data.json' with { type: 'json' };
+			import { join } from 'node:path';
+			import { fromESM } from './bridge.cjs';
+			console.log(lib.name, name, data.value, join('a', 'b'), fromESM);
+		`,
+		"lib.cjs":    "module.exports = { name: 'cjs' };",
+		"data.json":  `{"value": 42}`,
+		"bridge.cjs": "exports.fromESM = require('./esm.js').value;",
+		"esm.js":     "export const value = 'esm';",
+	}, "cjs cjs 42 a/b esm\n")
+}
+
+func TestESMReportsPositionsInTheModule(t *testing.T) {
+	expectFileOutput(t, map[string]string{
+		"main.js": `
+			import('./lib.mjs').then((m) => console.log(/lib\.mjs:(\d+:\d+)/.exec(m.e.stack)[1]));
+			import('./syntax.mjs').catch((e) => console.log(/Line \d+:\d+/.exec(e.message)[0]));
+		`,
+		"lib.mjs":    "const e = new Error('x'); export { e };",
+		"syntax.mjs": "let a = ;",
+	}, "1:11\nLine 1:9\n")
+}
+
+func TestESMRequireOfAsyncModuleThrows(t *testing.T) {
+	expectFileOutput(t, map[string]string{
+		"main.js": `
+			try { require('./async.mjs'); } catch (e) { console.log(e instanceof Error, e.code); }
+		`,
+		"async.mjs": "await null;",
+	}, "true ERR_REQUIRE_ASYNC_MODULE\n")
+}
+
+func TestESMUnsettledTopLevelAwait(t *testing.T) {
+	dir := t.TempDir()
+	jstest.WriteFiles(t, dir, map[string]string{
+		"main.mjs": "await new Promise(() => {});",
+	})
+	_, err := jstest.RunFile(t, filepath.Join(dir, "main.mjs"))
+	var exit *runtime.ExitError
+	if !errors.As(err, &exit) || exit.Code != 13 {
+		t.Errorf("err = %v, want exit code 13", err)
+	}
+}
+
+func TestImportMethodsAreNotDynamicImports(t *testing.T) {
+	dir := t.TempDir()
+	jstest.WriteFiles(t, dir, map[string]string{"b.mjs": "export const v = 'dynamic';\n"})
+	jstest.ExpectOutput(t, `
+		const o = { import(x) { return 'method ' + x; } };
+		class C { static import(x) { return 'static ' + x; } }
+		console.log(o.import(1), C.import(2));
+		import(`+jstest.Quote(filepath.Join(dir, "b.mjs"))+`).then((m) => console.log(m.v));
+	`, "method 1 static 2\ndynamic\n")
+}
@@ -0,0 +1,938 @@
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsTokenKind classifies the tokens produced by scanJS
+type jsTokenKind int
+
+const (
+	jsIdent jsTokenKind = iota
+	jsPunct
+	jsNumber
+	jsString
+	jsTemplate
+	jsRegExp
+)
+
+// jsToken is a token of JavaScript source together with its byte offsets
+type jsToken struct {
+	kind    jsTokenKind
+	text    string
+	start   int
+	end     int
+	newline bool // a line break precedes the token
+}
+
+// punctuators that are longer than one character, longest first
+var jsPunctuators = []string{
+	">>>=", "...", "===", "!==", "**=", "<<=", ">>=", ">>>", "&&=", "||=", "??=",
+	"=>", "==", "!=", "<=", ">=", "&&", "||", "??", "?.", "++", "--",
+	"+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "**", "<<", ">>",
+}
+
+// keywords after which a '/' starts a regular expression rather than a division
+var regExpKeywords = map[string]bool{
+	"return": true, "typeof": true, "instanceof": true, "in": true, "of": true,
+	"new": true, "delete": true, "void": true, "throw": true, "case": true,
+	"do": true, "else": true, "yield": true, "await": true,
+}
+
+// scanJS splits JavaScript source into tokens. It understands just enough of
+// the grammar (comments, strings, template literals and regular expressions)
+// to find the import and export statements of a module.
+func scanJS(src string) ([]jsToken, error) {
+	var tokens []jsToken
+	var templates []int // brace depth at each open template substitution
+	braces := 0
+	newline := false
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			newline = true
+			i++
+			continue
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			i++
+			continue
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			if strings.Contains(src[i:i+2+end], "\n") {
+				newline = true
+			}
+			i += end + 4
+			continue
+		}
+
+		tok := jsToken{kind: jsPunct, start: i, newline: newline}
+		newline = false
+
+		var prev *jsToken
+		if len(tokens) > 0 {
+			prev = &tokens[len(tokens)-1]
+		}
+
+		switch {
+		case c == '"' || c == '\'':
+			end, err := scanQuoted(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tok.kind, i = jsString, end
+		case c == '`' || (c == '}' && len(templates) > 0 && braces == templates[len(templates)-1]+1):
+			if c == '}' {
+				templates = templates[:len(templates)-1]
+				braces--
+			}
+			end, open, err := scanTemplate(src, i+1)
+			if err != nil {
+				return nil, err
+			}
+			if open {
+				templates = append(templates, braces)
+				braces++
+			}
+			tok.kind, i = jsTemplate, end
+		case isIdentByte(c) && !isDigitByte(c):
+			for i < len(src) && isIdentByte(src[i]) {
+				i++
+			}
+			tok.kind = jsIdent
+		case isDigitByte(c) || (c == '.' && i+1 < len(src) && isDigitByte(src[i+1])):
+			for i < len(src) && (isIdentByte(src[i]) || src[i] == '.' ||
+				((src[i] == '+' || src[i] == '-') && (src[i-1] == 'e' || src[i-1] == 'E') && !strings.HasPrefix(src[tok.start:], "0x"))) {
+				i++
+			}
+			tok.kind = jsNumber
+		case c == '/' && regExpAllowed(prev):
+			end, err := scanRegExp(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tok.kind, i = jsRegExp, end
+		default:
+			n := 1
+			for _, p := range jsPunctuators {
+				if strings.HasPrefix(src[i:], p) {
+					n = len(p)
+					break
+				}
+			}
+			// "a?.5:1" is a conditional, not optional chaining
+			if n == 2 && src[i:i+2] == "?." && i+2 < len(src) && isDigitByte(src[i+2]) {
+				n = 1
+			}
+			switch c {
+			case '{':
+				braces++
+			case '}':
+				braces--
+			}
+			i += n
+		}
+
+		tok.end = i
+		tok.text = src[tok.start:tok.end]
+		tokens = append(tokens, tok)
+	}
+
+	if len(templates) > 0 {
+		return nil, fmt.Errorf("unterminated template literal")
+	}
+	return tokens, nil
+}
+
+// scanQuoted returns the end offset of the string literal starting at i
+func scanQuoted(src string, i int) (int, error) {
+	quote := src[i]
+	for i++; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1, nil
+		case '\n':
+			return 0, fmt.Errorf("unterminated string literal")
+		}
+	}
+	return 0, fmt.Errorf("unterminated string literal")
+}
+
+// scanTemplate scans template characters starting at i and returns the end
+// offset and whether the template continues with a substitution
+func scanTemplate(src string, i int) (int, bool, error) {
+	for ; i < len(src); i++ {
+		switch {
+		case src[i] == '\\':
+			i++
+		case src[i] == '`':
+			return i + 1, false, nil
+		case src[i] == '$' && i+1 < len(src) && src[i+1] == '{':
+			return i + 2, true, nil
+		}
+	}
+	return 0, false, fmt.Errorf("unterminated template literal")
+}
+
+// scanRegExp returns the end offset of the regular expression literal at i
+func scanRegExp(src string, i int) (int, error) {
+	inClass := false
+	for i++; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '\n':
+			return 0, fmt.Errorf("unterminated regular expression")
+		case '/':
+			if !inClass {
+				i++
+				for i < len(src) && isIdentByte(src[i]) {
+					i++
+				}
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unterminated regular expression")
+}
+
+// regExpAllowed reports whether a '/' following prev starts a regular expression
+func regExpAllowed(prev *jsToken) bool {
+	if prev == nil {
+		return true
+	}
+	switch prev.kind {
+	case jsIdent:
+		return regExpKeywords[prev.text]
+	case jsPunct:
+		switch prev.text {
+		case ")", "]", "++", "--":
+			return false
+		}
+		return true
+	case jsTemplate:
+		return strings.HasSuffix(prev.text, "${")
+	}
+	return false
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 || isDigitByte(c) ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigitByte(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// jsStringValue returns the value of a string literal token
+func jsStringValue(literal string) (string, error) {
+	if strings.HasPrefix(literal, "'") {
+		body := literal[1 : len(literal)-1]
+		body = strings.ReplaceAll(body, "\\'", "'")
+		body = strings.ReplaceAll(body, "\"", "\\\"")
+		literal = "\"" + body + "\""
+	}
+	return strconv.Unquote(literal)
+}
+
+// esmImport refers to an export of one of a module's requests
+type esmImport struct {
+	request int
+	name    string // "*" for the module namespace
+}
+
+// esmSource is an ES module rewritten into a script. Import and export
+// statements are blanked out and described by the other fields instead.
+type esmSource struct {
+	body         string
+	requests     []string             // specifiers of static imports, in order
+	imports      map[string]esmImport // local name -> imported binding
+	localExports map[string]string    // export name -> local name
+	reexports    map[string]esmImport // export name -> binding of a request
+	starExports  []int                // requests re-exported with export *
+}
+
+// defaultExportName is the local binding created for "export default <expression>"
+const defaultExportName = "__esm_default"
+
+// esmEdit replaces src[start:end] with text
+type esmEdit struct {
+	start, end int
+	text       string
+}
+
+// esmTransformer rewrites a single module
+type esmTransformer struct {
+	src    string
+	tokens []jsToken
+	edits  []esmEdit
+	out    *esmSource
+}
+
+// transformESM rewrites the source of an ES module so that it compiles as a
+// script. Line numbers are preserved.
+func transformESM(src string) (*esmSource, error) {
+	tokens, err := scanJS(src)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &esmTransformer{
+		src:    src,
+		tokens: tokens,
+		out: &esmSource{
+			imports:      make(map[string]esmImport),
+			localExports: make(map[string]string),
+			reexports:    make(map[string]esmImport),
+		},
+	}
+
+	depth := 0
+	for i := 0; i < len(tokens); {
+		tok := tokens[i]
+		switch {
+		case tok.kind == jsPunct && (tok.text == "(" || tok.text == "[" || tok.text == "{"):
+			depth++
+		case tok.kind == jsPunct && (tok.text == ")" || tok.text == "]" || tok.text == "}"):
+			depth--
+		case tok.kind == jsTemplate:
+			if strings.HasPrefix(tok.text, "}") {
+				depth--
+			}
+			if strings.HasSuffix(tok.text, "${") {
+				depth++
+			}
+		case t.isKeyword(i, "import"):
+			switch {
+			case t.isPunct(i+1, "("):
+				t.replace(tok.start, tok.end, "__esm.import")
+			case t.isPunct(i+1, ".") && t.isIdent(i+2, "meta"):
+				t.replace(tok.start, tokens[i+2].end, "__esm.meta")
+				i += 3
+				continue
+			case depth == 0:
+				next, err := t.importDeclaration(i)
+				if err != nil {
+					return nil, err
+				}
+				i = next
+				continue
+			}
+		case t.isKeyword(i, "export") && depth == 0:
+			next, err := t.exportDeclaration(i)
+			if err != nil {
+				return nil, err
+			}
+			i = next
+			continue
+		}
+		i++
+	}
+
+	t.out.body = t.apply()
+	return t.out, nil
+}
+
+// isKeyword reports whether token i is the identifier name used as a
+// keyword rather than as a property or method name
+func (t *esmTransformer) isKeyword(i int, name string) bool {
+	return t.isIdent(i, name) && !(i > 0 && (t.isPunct(i-1, ".") || t.isPunct(i-1, "?."))) && !t.isMethodName(i)
+}
+
+// method definition prefixes, after which an identifier names a method
+var methodPrefixes = map[string]bool{
+	"{": true, ",": true, "*": true, "static": true, "get": true, "set": true, "async": true,
+}
+
+// isMethodName reports whether token i names a method definition, as in
+// { import(x) {} } or static import(x) {}: its parameters are followed by a
+// body. A call followed by a block on the next line is told apart by what
+// precedes the name.
+func (t *esmTransformer) isMethodName(i int) bool {
+	if !t.isPunct(i+1, "(") {
+		return false
+	}
+	body := t.matching(i+1) + 1
+	if !t.isPunct(body, "{") {
+		return false
+	}
+	if !t.tokens[body].newline {
+		return true
+	}
+	return i > 0 && methodPrefixes[t.tokens[i-1].text]
+}
+
+func (t *esmTransformer) isIdent(i int, name string) bool {
+	return i < len(t.tokens) && t.tokens[i].kind == jsIdent && (name == "" || t.tokens[i].text == name)
+}
+
+func (t *esmTransformer) isPunct(i int, text string) bool {
+	return i < len(t.tokens) && t.tokens[i].kind == jsPunct && t.tokens[i].text == text
+}
+
+func (t *esmTransformer) isString(i int) bool {
+	return i < len(t.tokens) && t.tokens[i].kind == jsString
+}
+
+// errorAt returns a syntax error located at token i
+func (t *esmTransformer) errorAt(i int, msg string) error {
+	offset := len(t.src)
+	if i < len(t.tokens) {
+		offset = t.tokens[i].start
+	}
+	line := strings.Count(t.src[:offset], "\n") + 1
+	return fmt.Errorf("SyntaxError: %s (line %d)", msg, line)
+}
+
+// replace records an edit of the source
+func (t *esmTransformer) replace(start, end int, text string) {
+	t.edits = append(t.edits, esmEdit{start: start, end: end, text: text})
+}
+
+// blank replaces src[start:end] with spaces, keeping line breaks
+func (t *esmTransformer) blank(start, end int) {
+	t.replace(start, end, strings.Map(func(r rune) rune {
+		if r == '\n' {
+			return r
+		}
+		return ' '
+	}, t.src[start:end]))
+}
+
+// apply returns the source with all edits made
+func (t *esmTransformer) apply() string {
+	sort.SliceStable(t.edits, func(a, b int) bool { return t.edits[a].start < t.edits[b].start })
+	var b strings.Builder
+	pos := 0
+	for _, e := range t.edits {
+		b.WriteString(t.src[pos:e.start])
+		b.WriteString(e.text)
+		pos = e.end
+	}
+	b.WriteString(t.src[pos:])
+	return b.String()
+}
+
+// request returns the index of specifier in the module's requests, adding it if needed
+func (t *esmTransformer) request(i int) (int, error) {
+	if !t.isString(i) {
+		return 0, t.errorAt(i, "Expected module specifier")
+	}
+	specifier, err := jsStringValue(t.tokens[i].text)
+	if err != nil {
+		return 0, t.errorAt(i, "Invalid module specifier")
+	}
+	for n, r := range t.out.requests {
+		if r == specifier {
+			return n, nil
+		}
+	}
+	t.out.requests = append(t.out.requests, specifier)
+	return len(t.out.requests) - 1, nil
+}
+
+// statementEnd skips the import attributes and semicolon that may follow the
+// module specifier at token i, returning the index after the statement
+func (t *esmTransformer) statementEnd(i int) int {
+	i++
+	if (t.isIdent(i, "with") || (t.isIdent(i, "assert") && !t.tokens[i].newline)) && t.isPunct(i+1, "{") {
+		i = t.matching(i+1) + 1
+	}
+	if t.isPunct(i, ";") {
+		i++
+	}
+	return i
+}
+
+// matching returns the index of the bracket that closes the one at token i
+func (t *esmTransformer) matching(i int) int {
+	depth := 0
+	for ; i < len(t.tokens); i++ {
+		tok := t.tokens[i]
+		switch {
+		case tok.kind == jsPunct && (tok.text == "(" || tok.text == "[" || tok.text == "{"):
+			depth++
+		case tok.kind == jsPunct && (tok.text == ")" || tok.text == "]" || tok.text == "}"):
+			depth--
+			if depth == 0 {
+				return i
+			}
+		case tok.kind == jsTemplate:
+			if strings.HasPrefix(tok.text, "}") {
+				depth--
+			}
+			if strings.HasSuffix(tok.text, "${") {
+				depth++
+			}
+		}
+	}
+	return len(t.tokens) - 1
+}
+
+// blankStatement removes the tokens from start up to (not including) end
+func (t *esmTransformer) blankStatement(start, end int) {
+	t.blank(t.tokens[start].start, t.tokens[end-1].end)
+}
+
+// moduleExportName reads an identifier or string used as an import or export name
+func (t *esmTransformer) moduleExportName(i int) (string, error) {
+	if t.isIdent(i, "") {
+		return t.tokens[i].text, nil
+	}
+	if t.isString(i) {
+		if name, err := jsStringValue(t.tokens[i].text); err == nil {
+			return name, nil
+		}
+	}
+	return "", t.errorAt(i, "Unexpected token")
+}
+
+// specifiers parses "{ a, b as c }" starting at token i. It returns the
+// (name, alias) pairs and the index after the closing brace.
+func (t *esmTransformer) specifiers(i int) ([][2]string, int, error) {
+	var specs [][2]string
+	for i++; !t.isPunct(i, "}"); {
+		name, err := t.moduleExportName(i)
+		if err != nil {
+			return nil, 0, err
+		}
+		alias := name
+		i++
+		if t.isIdent(i, "as") {
+			if alias, err = t.moduleExportName(i + 1); err != nil {
+				return nil, 0, err
+			}
+			i += 2
+		}
+		specs = append(specs, [2]string{name, alias})
+		if t.isPunct(i, ",") {
+			i++
+		} else if !t.isPunct(i, "}") {
+			return nil, 0, t.errorAt(i, "Unexpected token in import or export list")
+		}
+	}
+	return specs, i + 1, nil
+}
+
+// importDeclaration handles the import statement at token start
+func (t *esmTransformer) importDeclaration(start int) (int, error) {
+	i := start + 1
+
+	// import "specifier"
+	if t.isString(i) {
+		if _, err := t.request(i); err != nil {
+			return 0, err
+		}
+		end := t.statementEnd(i)
+		t.blankStatement(start, end)
+		return end, nil
+	}
+
+	var bindings [][2]string // (imported name, local name)
+	if t.isIdent(i, "") && !t.isIdent(i, "from") || t.isIdent(i, "from") && t.isIdent(i+1, "from") {
+		bindings = append(bindings, [2]string{"default", t.tokens[i].text})
+		i++
+		if t.isPunct(i, ",") {
+			i++
+		}
+	}
+	switch {
+	case t.isPunct(i, "*"):
+		if !t.isIdent(i+1, "as") || !t.isIdent(i+2, "") {
+			return 0, t.errorAt(i, "Expected 'as' after '*'")
+		}
+		bindings = append(bindings, [2]string{"*", t.tokens[i+2].text})
+		i += 3
+	case t.isPunct(i, "{"):
+		specs, next, err := t.specifiers(i)
+		if err != nil {
+			return 0, err
+		}
+		bindings = append(bindings, specs...)
+		i = next
+	}
+
+	if !t.isIdent(i, "from") {
+		return 0, t.errorAt(i, "Expected 'from'")
+	}
+	request, err := t.request(i + 1)
+	if err != nil {
+		return 0, err
+	}
+	for _, b := range bindings {
+		t.out.imports[b[1]] = esmImport{request: request, name: b[0]}
+	}
+
+	end := t.statementEnd(i + 1)
+	t.blankStatement(start, end)
+	return end, nil
+}
+
+// exportDeclaration handles the export statement at token start
+func (t *esmTransformer) exportDeclaration(start int) (int, error) {
+	i := start + 1
+	exportTok := t.tokens[start]
+
+	switch {
+	// export * from "x" / export * as ns from "x"
+	case t.isPunct(i, "*"):
+		alias := ""
+		i++
+		if t.isIdent(i, "as") {
+			name, err := t.moduleExportName(i + 1)
+			if err != nil {
+				return 0, err
+			}
+			alias = name
+			i += 2
+		}
+		if !t.isIdent(i, "from") {
+			return 0, t.errorAt(i, "Expected 'from'")
+		}
+		request, err := t.request(i + 1)
+		if err != nil {
+			return 0, err
+		}
+		if alias == "" {
+			t.out.starExports = append(t.out.starExports, request)
+		} else {
+			t.out.reexports[alias] = esmImport{request: request, name: "*"}
+		}
+		end := t.statementEnd(i + 1)
+		t.blankStatement(start, end)
+		return end, nil
+
+	// export { a, b as c } [from "x"]
+	case t.isPunct(i, "{"):
+		specs, next, err := t.specifiers(i)
+		if err != nil {
+			return 0, err
+		}
+		end := next
+		if t.isIdent(next, "from") {
+			request, err := t.request(next + 1)
+			if err != nil {
+				return 0, err
+			}
+			for _, s := range specs {
+				t.out.reexports[s[1]] = esmImport{request: request, name: s[0]}
+			}
+			end = t.statementEnd(next + 1)
+		} else {
+			for _, s := range specs {
+				t.out.localExports[s[1]] = s[0]
+			}
+			if t.isPunct(end, ";") {
+				end++
+			}
+		}
+		t.blankStatement(start, end)
+		return end, nil
+
+	case t.isIdent(i, "default"):
+		return t.exportDefault(start, i+1)
+
+	// export var|let|const ...
+	case t.isIdent(i, "var") || t.isIdent(i, "let") || t.isIdent(i, "const"):
+		names, err := t.declaredNames(i + 1)
+		if err != nil {
+			return 0, err
+		}
+		for _, name := range names {
+			t.out.localExports[name] = name
+		}
+		t.blank(exportTok.start, exportTok.end)
+		return i + 1, nil
+
+	// export function|async function|class
+	case t.isIdent(i, "function") || t.isIdent(i, "class") || t.isAsyncFunction(i):
+		nameIdx := t.declarationName(i)
+		if !t.isIdent(nameIdx, "") {
+			return 0, t.errorAt(nameIdx, "Exported declarations must have a name")
+		}
+		name := t.tokens[nameIdx].text
+		t.out.localExports[name] = name
+		t.blank(exportTok.start, exportTok.end)
+		return i + 1, nil
+	}
+
+	return 0, t.errorAt(i, "Unexpected token after 'export'")
+}
+
+// exportDefault handles "export default" where token i follows "default"
+func (t *esmTransformer) exportDefault(start, i int) (int, error) {
+	exportStart := t.tokens[start].start
+	defaultEnd := t.tokens[i-1].end
+
+	if t.isIdent(i, "function") || t.isIdent(i, "class") || t.isAsyncFunction(i) {
+		nameIdx := t.declarationName(i)
+		if t.isIdent(nameIdx, "") && !t.isIdent(nameIdx, "extends") {
+			// A named declaration keeps its name and stays hoisted
+			t.out.localExports["default"] = t.tokens[nameIdx].text
+			t.blank(exportStart, defaultEnd)
+			return i, nil
+		}
+
+		// Anonymous declarations are named "default"
+		body := nameIdx
+		for body < len(t.tokens) && !t.isPunct(body, "{") {
+			if t.isPunct(body, "(") {
+				body = t.matching(body)
+			}
+			body++
+		}
+		end := t.matching(body)
+		t.out.localExports["default"] = defaultExportName
+		t.replace(exportStart, defaultEnd, "const "+defaultExportName+" = { default:")
+		t.replace(t.tokens[end].end, t.tokens[end].end, " }.default;")
+		return end + 1, nil
+	}
+
+	t.out.localExports["default"] = defaultExportName
+	t.replace(exportStart, defaultEnd, "const "+defaultExportName+" =")
+	return i, nil
+}
+
+// isAsyncFunction reports whether token i starts "async function"
+func (t *esmTransformer) isAsyncFunction(i int) bool {
+	return t.isIdent(i, "async") && t.isIdent(i+1, "function") && !t.tokens[i+1].newline
+}
+
+// declarationName returns the index of the name of the function or class
+// declaration starting at token i
+func (t *esmTransformer) declarationName(i int) int {
+	if t.isIdent(i, "async") {
+		i++
+	}
+	i++
+	if t.isPunct(i, "*") {
+		i++
+	}
+	return i
+}
+
+// declaredNames returns the names bound by the declarators of a variable
+// declaration starting at token i
+func (t *esmTransformer) declaredNames(i int) ([]string, error) {
+	var names []string
+	for {
+		bound, next, err := t.bindingNames(i)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, bound...)
+		i = next
+		if t.isPunct(i, "=") {
+			i = t.skipExpression(i+1, true)
+		}
+		if !t.isPunct(i, ",") {
+			return names, nil
+		}
+		i++
+	}
+}
+
+// bindingNames returns the names bound by the binding pattern at token i and
+// the index after it
+func (t *esmTransformer) bindingNames(i int) ([]string, int, error) {
+	switch {
+	case t.isIdent(i, ""):
+		return []string{t.tokens[i].text}, i + 1, nil
+
+	case t.isPunct(i, "["):
+		var names []string
+		for i++; !t.isPunct(i, "]"); {
+			if i >= len(t.tokens) {
+				return nil, 0, t.errorAt(i, "Unterminated array pattern")
+			}
+			if t.isPunct(i, ",") {
+				i++
+				continue
+			}
+			if t.isPunct(i, "...") {
+				i++
+			}
+			bound, next, err := t.bindingNames(i)
+			if err != nil {
+				return nil, 0, err
+			}
+			names = append(names, bound...)
+			i = next
+			if t.isPunct(i, "=") {
+				i = t.skipExpression(i+1, false)
+			}
+		}
+		return names, i + 1, nil
+
+	case t.isPunct(i, "{"):
+		var names []string
+		for i++; !t.isPunct(i, "}"); {
+			if i >= len(t.tokens) {
+				return nil, 0, t.errorAt(i, "Unterminated object pattern")
+			}
+			if t.isPunct(i, ",") {
+				i++
+				continue
+			}
+			if t.isPunct(i, "...") {
+				bound, next, err := t.bindingNames(i + 1)
+				if err != nil {
+					return nil, 0, err
+				}
+				names = append(names, bound...)
+				i = next
+				continue
+			}
+
+			key := i
+			if t.isPunct(i, "[") {
+				i = t.matching(i)
+			}
+			i++
+			if t.isPunct(i, ":") {
+				bound, next, err := t.bindingNames(i + 1)
+				if err != nil {
+					return nil, 0, err
+				}
+				names = append(names, bound...)
+				i = next
+			} else if t.isIdent(key, "") {
+				names = append(names, t.tokens[key].text)
+			} else {
+				return nil, 0, t.errorAt(key, "Unexpected token in object pattern")
+			}
+			if t.isPunct(i, "=") {
+				i = t.skipExpression(i+1, false)
+			}
+		}
+		return names, i + 1, nil
+	}
+
+	return nil, 0, t.errorAt(i, "Unexpected token in declaration")
+}
+
+// skipExpression returns the index of the token that ends the expression
+// starting at token i: a ',' or closing bracket outside of any nesting, a
+// ';', or, at statement level, a line break where a semicolon would be inserted
+func (t *esmTransformer) skipExpression(i int, statement bool) int {
+	depth := 0
+	start := i
+	for ; i < len(t.tokens); i++ {
+		tok := t.tokens[i]
+		if depth == 0 {
+			if tok.kind == jsPunct && (tok.text == "," || tok.text == ";" || tok.text == ")" || tok.text == "]" || tok.text == "}") {
+				return i
+			}
+			if statement && i > start && tok.newline && t.endsExpression(i-1) && t.startsStatement(i) {
+				return i
+			}
+		}
+		switch {
+		case tok.kind == jsPunct && (tok.text == "(" || tok.text == "[" || tok.text == "{"):
+			depth++
+		case tok.kind == jsPunct && (tok.text == ")" || tok.text == "]" || tok.text == "}"):
+			depth--
+		case tok.kind == jsTemplate:
+			if strings.HasPrefix(tok.text, "}") {
+				depth--
+			}
+			if strings.HasSuffix(tok.text, "${") {
+				depth++
+			}
+		}
+	}
+	return i
+}
+
+// endsExpression reports whether token i can be the last token of an expression
+func (t *esmTransformer) endsExpression(i int) bool {
+	tok := t.tokens[i]
+	switch tok.kind {
+	case jsIdent:
+		return !regExpKeywords[tok.text]
+	case jsPunct:
+		return tok.text == ")" || tok.text == "]" || tok.text == "}" || tok.text == "++" || tok.text == "--"
+	case jsTemplate:
+		return strings.HasSuffix(tok.text, "`")
+	}
+	return true
+}
+
+// startsStatement reports whether token i cannot continue the previous line
+func (t *esmTransformer) startsStatement(i int) bool {
+	tok := t.tokens[i]
+	switch tok.kind {
+	case jsIdent:
+		return tok.text != "in" && tok.text != "instanceof"
+	case jsPunct:
+		return tok.text == "{" || tok.text == "!" || tok.text == "~" || tok.text == "++" || tok.text == "--"
+	case jsTemplate:
+		return false
+	}
+	return true
+}
+
+// wrapper returns the text around the transformed body that turns it into a
+// function expression. The outer sloppy-mode function puts the import
+// bindings in scope with a with statement, the inner strict async function is
+// the module body, so that imports stay live and top-level await works.
+// Everything before the body is on its first line to keep line numbers
+// intact.
+func (s *esmSource) wrapper() (prefix, suffix string) {
+	names := make([]string, 0, len(s.localExports))
+	for name := range s.localExports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var getters strings.Builder
+	for _, name := range names {
+		key, _ := json.Marshal(name)
+		fmt.Fprintf(&getters, "%s: () => %s, ", key, s.localExports[name])
+	}
+
+	prefix = fmt.Sprintf(`(function (__imports) { with (__imports) { return async function (__esm) { "use strict"; __esm.bind({ %s}); `, getters.String())
+	return prefix, "\n} } })"
+}
+
+// rewriteDynamicImport replaces import(...) calls in a script with calls to
+// callee. Sources that cannot be scanned are returned unchanged.
+func rewriteDynamicImport(src, callee string) string {
+	if !strings.Contains(src, "import") {
+		return src
+	}
+	tokens, err := scanJS(src)
+	if err != nil {
+		return src
+	}
+	t := &esmTransformer{src: src, tokens: tokens}
+	for i := range tokens {
+		if t.isKeyword(i, "import") && t.isPunct(i+1, "(") {
+			t.replace(tokens[i].start, tokens[i].end, callee)
+		}
+	}
+	if len(t.edits) == 0 {
+		return src
+	}
+	return t.apply()
+}
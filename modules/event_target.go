@@ -0,0 +1,494 @@
+package modules
+
+import (
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// Event phases, as in the DOM Standard
+const (
+	eventPhaseNone     = 0
+	eventPhaseAtTarget = 2
+)
+
+// domExceptionNames lists the DOMException names that have a legacy code,
+// with the name of the constant holding it
+var domExceptionNames = []struct {
+	name, constant string
+	code           int
+}{
+	{"IndexSizeError", "INDEX_SIZE_ERR", 1},
+	{"HierarchyRequestError", "HIERARCHY_REQUEST_ERR", 3},
+	{"WrongDocumentError", "WRONG_DOCUMENT_ERR", 4},
+	{"InvalidCharacterError", "INVALID_CHARACTER_ERR", 5},
+	{"NoModificationAllowedError", "NO_MODIFICATION_ALLOWED_ERR", 7},
+	{"NotFoundError", "NOT_FOUND_ERR", 8},
+	{"NotSupportedError", "NOT_SUPPORTED_ERR", 9},
+	{"InvalidStateError", "INVALID_STATE_ERR", 11},
+	{"SyntaxError", "SYNTAX_ERR", 12},
+	{"InvalidModificationError", "INVALID_MODIFICATION_ERR", 13},
+	{"NamespaceError", "NAMESPACE_ERR", 14},
+	{"InvalidAccessError", "INVALID_ACCESS_ERR", 15},
+	{"TypeMismatchError", "TYPE_MISMATCH_ERR", 17},
+	{"SecurityError", "SECURITY_ERR", 18},
+	{"NetworkError", "NETWORK_ERR", 19},
+	{"AbortError", "ABORT_ERR", 20},
+	{"URLMismatchError", "URL_MISMATCH_ERR", 21},
+	{"QuotaExceededError", "QUOTA_EXCEEDED_ERR", 22},
+	{"TimeoutError", "TIMEOUT_ERR", 23},
+	{"InvalidNodeTypeError", "INVALID_NODE_TYPE_ERR", 24},
+	{"DataCloneError", "DATA_CLONE_ERR", 25},
+}
+
+// eventTargetClasses holds DOMException, Event and EventTarget, and the
+// AbortController and AbortSignal built on them
+type eventTargetClasses struct {
+	vm    *goja.Runtime
+	loop  AsyncLoop
+	start time.Time
+
+	domException *goja.Object
+	event        *goja.Object
+	eventProto   *goja.Object
+	target       *goja.Object
+	targetProto  *goja.Object
+	eventKey     *goja.Symbol
+	targetKey    *goja.Symbol
+
+	controller *goja.Object
+	signal     *goja.Object
+	signalKey  *goja.Symbol
+}
+
+// webEvent is the state of an Event
+type webEvent struct {
+	typ              string
+	bubbles          bool
+	cancelable       bool
+	composed         bool
+	trusted          bool
+	defaultPrevented bool
+	passive          bool
+	stopped          bool
+	stoppedNow       bool
+	dispatching      bool
+	phase            int
+	target           goja.Value
+	currentTarget    goja.Value
+	timeStamp        float64
+}
+
+// webListener is a listener added with addEventListener. callback is a
+// function or an object with a handleEvent method.
+type webListener struct {
+	callback goja.Value
+	capture  bool
+	once     bool
+	passive  bool
+	removed  bool
+}
+
+// eventTargetState holds the listeners and event handler attributes of an
+// EventTarget
+type eventTargetState struct {
+	listeners map[string][]*webListener
+	handlers  map[string]goja.Value
+}
+
+// eventTargetsOf returns the EventTarget classes of vm, or nil before
+// SetupEventTarget
+func eventTargetsOf(vm *goja.Runtime) *eventTargetClasses {
+	val := vm.GlobalObject().Get("__eventTarget")
+	if val == nil {
+		return nil
+	}
+	c, _ := val.Export().(*eventTargetClasses)
+	return c
+}
+
+// SetupEventTarget sets up the DOMException, Event, EventTarget,
+// AbortController and AbortSignal globals. Listener errors are reported on
+// loop as uncaught exceptions, and AbortSignal.timeout fires on it.
+func SetupEventTarget(vm *goja.Runtime, loop AsyncLoop) error {
+	c := &eventTargetClasses{
+		vm:        vm,
+		loop:      loop,
+		start:     time.Now(),
+		eventKey:  goja.NewSymbol("event"),
+		targetKey: goja.NewSymbol("eventTarget"),
+		signalKey: goja.NewSymbol("abortSignal"),
+	}
+	c.setupDOMException()
+	c.setupEvent()
+	c.setupEventTarget()
+	c.setupAbort()
+
+	if err := vm.GlobalObject().DefineDataProperty("__eventTarget", vm.ToValue(c), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE); err != nil {
+		return err
+	}
+	for _, ctor := range []*goja.Object{c.domException, c.event, c.target, c.controller, c.signal} {
+		vm.GlobalObject().DefineDataProperty(ctor.Get("name").String(), ctor, goja.FLAG_TRUE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	}
+	return nil
+}
+
+// setupDOMException creates DOMException. Instances are Error objects, so
+// they have a stack and util.inspect shows them as errors.
+func (c *eventTargetClasses) setupDOMException() {
+	vm := c.vm
+	errorCtor := vm.Get("Error").ToObject(vm)
+	codes := map[string]int{}
+	ctor := vm.ToValue(func(call goja.ConstructorCall) *goja.Object {
+		message := ""
+		if v := call.Argument(0); !goja.IsUndefined(v) {
+			message = v.String()
+		}
+		name := "Error"
+		var cause goja.Value
+		if opts, ok := call.Argument(1).(*goja.Object); ok {
+			if v := opts.Get("name"); !isNullish(v) {
+				name = v.String()
+			}
+			if opts.Get("cause") != nil {
+				cause = opts.Get("cause")
+			}
+		} else if v := call.Argument(1); !goja.IsUndefined(v) {
+			name = v.String()
+		}
+
+		obj, err := vm.New(errorCtor, vm.ToValue(message))
+		if err != nil {
+			panic(err)
+		}
+		obj.SetPrototype(call.This.Prototype())
+		obj.DefineDataProperty("name", vm.ToValue(name), goja.FLAG_TRUE, goja.FLAG_TRUE, goja.FLAG_FALSE)
+		obj.DefineDataProperty("code", vm.ToValue(codes[name]), goja.FLAG_TRUE, goja.FLAG_TRUE, goja.FLAG_FALSE)
+		if cause != nil {
+			obj.DefineDataProperty("cause", cause, goja.FLAG_TRUE, goja.FLAG_TRUE, goja.FLAG_FALSE)
+		}
+		return obj
+	}).ToObject(vm)
+	ctor.DefineDataProperty("name", vm.ToValue("DOMException"), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	proto := ctor.Get("prototype").ToObject(vm)
+	proto.SetPrototype(errorCtor.Get("prototype").ToObject(vm))
+	proto.DefineDataPropertySymbol(goja.SymToStringTag, vm.ToValue("DOMException"), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	for _, e := range domExceptionNames {
+		codes[e.name] = e.code
+		ctor.DefineDataProperty(e.constant, vm.ToValue(e.code), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+		proto.DefineDataProperty(e.constant, vm.ToValue(e.code), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	}
+	c.domException = ctor
+}
+
+// newDOMException creates a DOMException with the given message and name
+func (c *eventTargetClasses) newDOMException(message, name string) *goja.Object {
+	obj, err := c.vm.New(c.domException, c.vm.ToValue(message), c.vm.ToValue(name))
+	if err != nil {
+		panic(err)
+	}
+	return obj
+}
+
+// setupEvent creates Event
+func (c *eventTargetClasses) setupEvent() {
+	vm := c.vm
+	c.event, c.eventProto = newClass(vm, "Event", nil, func(this *goja.Object, args []goja.Value) {
+		if len(args) == 0 {
+			panic(NewNodeError(vm, "TypeError", "ERR_MISSING_ARGS", "The \"type\" argument must be specified"))
+		}
+		e := &webEvent{typ: args[0].String(), timeStamp: c.now()}
+		if opts, ok := argAt(args, 1).(*goja.Object); ok {
+			flag := func(name string) bool {
+				v := opts.Get(name)
+				return v != nil && v.ToBoolean()
+			}
+			e.bubbles, e.cancelable, e.composed = flag("bubbles"), flag("cancelable"), flag("composed")
+		} else if v := argAt(args, 1); !isNullish(v) {
+			panic(ErrInvalidArgType(vm, "options", "of type object", v))
+		}
+		this.DefineDataPropertySymbol(c.eventKey, vm.ToValue(e), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	})
+	proto := c.eventProto
+
+	for _, ctorOrProto := range []*goja.Object{c.event, proto} {
+		for name, value := range map[string]int{"NONE": 0, "CAPTURING_PHASE": 1, "AT_TARGET": 2, "BUBBLING_PHASE": 3} {
+			ctorOrProto.DefineDataProperty(name, vm.ToValue(value), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+		}
+	}
+
+	getter := func(name string, get func(e *webEvent) interface{}) {
+		proto.DefineAccessorProperty(name, vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			return vm.ToValue(get(c.eventOf(call.This)))
+		}), nil, goja.FLAG_TRUE, goja.FLAG_TRUE)
+	}
+	target := func(v goja.Value) interface{} {
+		if v == nil {
+			return goja.Null()
+		}
+		return v
+	}
+	getter("type", func(e *webEvent) interface{} { return e.typ })
+	getter("bubbles", func(e *webEvent) interface{} { return e.bubbles })
+	getter("cancelable", func(e *webEvent) interface{} { return e.cancelable })
+	getter("composed", func(e *webEvent) interface{} { return e.composed })
+	getter("defaultPrevented", func(e *webEvent) interface{} { return e.cancelable && e.defaultPrevented })
+	getter("isTrusted", func(e *webEvent) interface{} { return e.trusted })
+	getter("eventPhase", func(e *webEvent) interface{} { return e.phase })
+	getter("timeStamp", func(e *webEvent) interface{} { return e.timeStamp })
+	getter("target", func(e *webEvent) interface{} { return target(e.target) })
+	getter("srcElement", func(e *webEvent) interface{} { return target(e.target) })
+	getter("currentTarget", func(e *webEvent) interface{} { return target(e.currentTarget) })
+	getter("returnValue", func(e *webEvent) interface{} { return !e.cancelable || !e.defaultPrevented })
+	getter("cancelBubble", func(e *webEvent) interface{} { return e.stopped })
+
+	proto.Set("preventDefault", func(call goja.FunctionCall) goja.Value {
+		if e := c.eventOf(call.This); !e.passive {
+			e.defaultPrevented = true
+		}
+		return goja.Undefined()
+	})
+	proto.Set("stopPropagation", func(call goja.FunctionCall) goja.Value {
+		c.eventOf(call.This).stopped = true
+		return goja.Undefined()
+	})
+	proto.Set("stopImmediatePropagation", func(call goja.FunctionCall) goja.Value {
+		e := c.eventOf(call.This)
+		e.stopped, e.stoppedNow = true, true
+		return goja.Undefined()
+	})
+	proto.Set("composedPath", func(call goja.FunctionCall) goja.Value {
+		if e := c.eventOf(call.This); e.dispatching {
+			return vm.ToValue(vm.NewArray(e.currentTarget))
+		}
+		return vm.ToValue(vm.NewArray())
+	})
+	proto.DefineDataPropertySymbol(goja.SymToStringTag, vm.ToValue("Event"), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	if custom := inspectorOf(vm).custom; custom != nil {
+		proto.SetSymbol(custom, func(call goja.FunctionCall) goja.Value {
+			e := c.eventOf(call.This)
+			ctor, ok := call.This.ToObject(vm).Get("constructor").(*goja.Object)
+			if !ok {
+				ctor = c.event
+			}
+			return inspectObject(vm, ctor, "type", e.typ, "defaultPrevented", e.cancelable && e.defaultPrevented,
+				"cancelable", e.cancelable, "timeStamp", e.timeStamp)
+		})
+	}
+}
+
+// setupEventTarget creates EventTarget
+func (c *eventTargetClasses) setupEventTarget() {
+	vm := c.vm
+	c.target, c.targetProto = newClass(vm, "EventTarget", nil, func(this *goja.Object, args []goja.Value) {
+		c.targetOf(this)
+	})
+	proto := c.targetProto
+
+	// listenerOptions reads the capture flag, or the options object, of
+	// addEventListener and removeEventListener
+	listenerOptions := func(v goja.Value) (l webListener, signal goja.Value) {
+		opts, ok := v.(*goja.Object)
+		if !ok {
+			l.capture = v != nil && v.ToBoolean()
+			return l, nil
+		}
+		flag := func(name string) bool {
+			v := opts.Get(name)
+			return v != nil && v.ToBoolean()
+		}
+		l.capture, l.once, l.passive = flag("capture"), flag("once"), flag("passive")
+		if v := opts.Get("signal"); !isNullish(v) {
+			signal = v
+		}
+		return l, signal
+	}
+
+	proto.Set("addEventListener", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 2 {
+			panic(NewNodeError(vm, "TypeError", "ERR_MISSING_ARGS", "The \"type\" and \"listener\" arguments must be specified"))
+		}
+		typ, callback := call.Argument(0).String(), call.Argument(1)
+		if isNullish(callback) {
+			return goja.Undefined()
+		}
+		if _, ok := callback.(*goja.Object); !ok {
+			panic(ErrInvalidArgType(vm, "listener", "an instance of EventListener", callback))
+		}
+		opts, signalValue := listenerOptions(call.Argument(2))
+		var signal *abortSignal
+		if signalValue != nil {
+			var ok bool
+			if signal, ok = c.signalOf(signalValue); !ok {
+				panic(ErrInvalidArgType(vm, "options.signal", "an instance of AbortSignal", signalValue))
+			}
+			if signal.aborted {
+				return goja.Undefined()
+			}
+		}
+
+		s := c.targetOf(call.This)
+		for _, l := range s.listeners[typ] {
+			if l.callback.SameAs(callback) && l.capture == opts.capture {
+				return goja.Undefined()
+			}
+		}
+		l := &webListener{callback: callback, capture: opts.capture, once: opts.once, passive: opts.passive}
+		s.listeners[typ] = append(s.listeners[typ], l)
+		if signal != nil {
+			signal.onAbort(func() { s.remove(typ, l) })
+		}
+		return goja.Undefined()
+	})
+
+	proto.Set("removeEventListener", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 2 {
+			panic(NewNodeError(vm, "TypeError", "ERR_MISSING_ARGS", "The \"type\" and \"listener\" arguments must be specified"))
+		}
+		typ, callback := call.Argument(0).String(), call.Argument(1)
+		opts, _ := listenerOptions(call.Argument(2))
+		s := c.targetOf(call.This)
+		for _, l := range s.listeners[typ] {
+			if l.callback.SameAs(callback) && l.capture == opts.capture {
+				s.remove(typ, l)
+				break
+			}
+		}
+		return goja.Undefined()
+	})
+
+	proto.Set("dispatchEvent", func(call goja.FunctionCall) goja.Value {
+		event, ok := call.Argument(0).(*goja.Object)
+		if !ok || !vm.InstanceOf(event, c.event) {
+			panic(ErrInvalidArgType(vm, "event", "an instance of Event", call.Argument(0)))
+		}
+		if c.eventOf(event).dispatching {
+			panic(NewNodeError(vm, "Error", "ERR_EVENT_RECURSION", "The event \""+c.eventOf(event).typ+"\" is already being dispatched"))
+		}
+		return vm.ToValue(c.dispatch(call.This.ToObject(vm), event))
+	})
+	proto.DefineDataPropertySymbol(goja.SymToStringTag, vm.ToValue("EventTarget"), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+}
+
+// eventOf returns the state of the Event this, throwing for other objects
+func (c *eventTargetClasses) eventOf(this goja.Value) *webEvent {
+	if obj, ok := this.(*goja.Object); ok {
+		if e, ok := exportSymbol(obj, c.eventKey).(*webEvent); ok {
+			return e
+		}
+	}
+	panic(NewNodeError(c.vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be of type Event"))
+}
+
+// targetOf returns the listeners of this, creating them for objects that
+// inherit from EventTarget.prototype without calling the constructor
+func (c *eventTargetClasses) targetOf(this goja.Value) *eventTargetState {
+	obj, ok := this.(*goja.Object)
+	if !ok {
+		panic(NewNodeError(c.vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be of type EventTarget"))
+	}
+	if s, ok := exportSymbol(obj, c.targetKey).(*eventTargetState); ok {
+		return s
+	}
+	s := &eventTargetState{listeners: map[string][]*webListener{}, handlers: map[string]goja.Value{}}
+	obj.DefineDataPropertySymbol(c.targetKey, c.vm.ToValue(s), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	return s
+}
+
+func (s *eventTargetState) remove(typ string, l *webListener) {
+	l.removed = true
+	list := s.listeners[typ]
+	for i, other := range list {
+		if other == l {
+			s.listeners[typ] = append(list[:i:i], list[i+1:]...)
+			return
+		}
+	}
+}
+
+// newEvent creates an Event of the given type. Events created by the
+// runtime are trusted.
+func (c *eventTargetClasses) newEvent(typ string) *goja.Object {
+	obj, err := c.vm.New(c.event, c.vm.ToValue(typ))
+	if err != nil {
+		panic(err)
+	}
+	c.eventOf(obj).trusted = true
+	return obj
+}
+
+// dispatch calls the listeners of target for event and reports whether the
+// default action was not prevented. Errors thrown by listeners do not stop
+// the others; they are rethrown on the next tick as uncaught exceptions.
+func (c *eventTargetClasses) dispatch(target *goja.Object, event *goja.Object) bool {
+	vm := c.vm
+	e := c.eventOf(event)
+	s := c.targetOf(target)
+	e.dispatching, e.target, e.currentTarget, e.phase = true, target, target, eventPhaseAtTarget
+	e.stopped, e.stoppedNow = false, false
+
+	listeners := append([]*webListener(nil), s.listeners[e.typ]...)
+	for _, l := range listeners {
+		if l.removed {
+			continue
+		}
+		if l.once {
+			s.remove(e.typ, l)
+		}
+		e.passive = l.passive
+		var err error
+		if fn, ok := goja.AssertFunction(l.callback); ok {
+			_, err = fn(target, event)
+		} else if handleEvent, ok := goja.AssertFunction(l.callback.ToObject(vm).Get("handleEvent")); ok {
+			_, err = handleEvent(l.callback, event)
+		}
+		e.passive = false
+		if err != nil {
+			c.loop.NextTick(func() { panic(err) })
+		}
+		if e.stoppedNow {
+			break
+		}
+	}
+
+	e.dispatching, e.currentTarget, e.phase = false, nil, eventPhaseNone
+	return !e.cancelable || !e.defaultPrevented
+}
+
+// eventHandler defines the on<typ> attribute of proto. The handler is
+// called by a listener added the first time one is set, as in browsers.
+func (c *eventTargetClasses) eventHandler(proto *goja.Object, typ string) {
+	vm := c.vm
+	proto.DefineAccessorProperty("on"+typ, vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		if h, ok := c.targetOf(call.This).handlers[typ]; ok {
+			return h
+		}
+		return goja.Null()
+	}), vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		s := c.targetOf(call.This)
+		handler := call.Argument(0)
+		if _, ok := goja.AssertFunction(handler); !ok {
+			handler = goja.Null()
+		}
+		if _, registered := s.handlers[typ]; !registered {
+			listener := vm.ToValue(func(call goja.FunctionCall) goja.Value {
+				if fn, ok := goja.AssertFunction(s.handlers[typ]); ok {
+					if _, err := fn(call.This, call.Arguments...); err != nil {
+						panic(err)
+					}
+				}
+				return goja.Undefined()
+			})
+			s.listeners[typ] = append(s.listeners[typ], &webListener{callback: listener})
+		}
+		s.handlers[typ] = handler
+		return goja.Undefined()
+	}), goja.FLAG_TRUE, goja.FLAG_TRUE)
+}
+
+// now returns the milliseconds since the runtime started, the clock of
+// Event.timeStamp
+func (c *eventTargetClasses) now() float64 {
+	return float64(time.Since(c.start).Microseconds()) / 1000
+}
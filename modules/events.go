@@ -0,0 +1,396 @@
+package modules
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dop251/goja"
+)
+
+// defaultMaxListeners is the initial value of EventEmitter.defaultMaxListeners
+const defaultMaxListeners = 10
+
+// eventKey identifies an event by string name or symbol
+type eventKey struct {
+	name string
+	sym  *goja.Symbol
+}
+
+// eventListener is a registered listener. fn is the function passed by the
+// caller and is what listeners() and off() work with.
+type eventListener struct {
+	fn       goja.Value
+	callable goja.Callable
+	once     bool
+}
+
+// emitterState holds the listeners of a single EventEmitter instance
+type emitterState struct {
+	events       map[eventKey][]*eventListener
+	names        map[eventKey]goja.Value
+	order        []eventKey
+	maxListeners int
+	warned       map[eventKey]bool
+}
+
+// SetupEvents sets up the events module
+func SetupEvents(vm *goja.Runtime) error {
+	stateKey := goja.NewSymbol("eventEmitterState")
+
+	ctor := vm.ToValue(func(call goja.ConstructorCall) *goja.Object {
+		initEmitter(vm, stateKey, call.This)
+		return nil
+	}).ToObject(vm)
+	ctor.DefineDataProperty("name", vm.ToValue("EventEmitter"), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	ctor.Set("defaultMaxListeners", defaultMaxListeners)
+
+	// state returns the listener state of this, creating it for objects that
+	// inherit from EventEmitter.prototype without calling the constructor
+	state := func(this goja.Value) *emitterState {
+		obj := this.ToObject(vm)
+		if s, ok := exportSymbol(obj, stateKey).(*emitterState); ok {
+			return s
+		}
+		return initEmitter(vm, stateKey, obj)
+	}
+
+	maxListeners := func(s *emitterState) int {
+		if s.maxListeners >= 0 {
+			return s.maxListeners
+		}
+		return int(ctor.Get("defaultMaxListeners").ToInteger())
+	}
+
+	emit := func(this goja.Value, name goja.Value, args ...goja.Value) bool {
+		return emitEvent(vm, state(this), this, name, args)
+	}
+
+	addListener := func(prepend, once bool) func(goja.FunctionCall) goja.Value {
+		return func(call goja.FunctionCall) goja.Value {
+			name := call.Argument(0)
+			listener := call.Argument(1)
+			callable, ok := goja.AssertFunction(listener)
+			if !ok {
+				panic(vm.NewTypeError("The \"listener\" argument must be of type function"))
+			}
+
+			s := state(call.This)
+
+			// 'newListener' fires before the listener is added
+			if len(s.events[newEventKey(vm.ToValue("newListener"))]) > 0 {
+				emit(call.This, vm.ToValue("newListener"), name, listener)
+			}
+
+			key := newEventKey(name)
+			l := &eventListener{fn: listener, callable: callable, once: once}
+			if _, exists := s.names[key]; !exists {
+				s.names[key] = name
+				s.order = append(s.order, key)
+			}
+			if prepend {
+				s.events[key] = append([]*eventListener{l}, s.events[key]...)
+			} else {
+				s.events[key] = append(s.events[key], l)
+			}
+
+			if limit := maxListeners(s); limit > 0 && len(s.events[key]) > limit && !s.warned[key] {
+				s.warned[key] = true
+				fmt.Fprintf(os.Stderr, "MaxListenersExceededWarning: Possible EventEmitter memory leak detected. %d %s listeners added. Use emitter.setMaxListeners() to increase limit\n",
+					len(s.events[key]), name.String())
+			}
+
+			return call.This
+		}
+	}
+
+	removeListener := func(call goja.FunctionCall) goja.Value {
+		name := call.Argument(0)
+		listener := call.Argument(1)
+		s := state(call.This)
+		key := newEventKey(name)
+
+		listeners := s.events[key]
+		for i := len(listeners) - 1; i >= 0; i-- {
+			if listeners[i].fn.StrictEquals(listener) {
+				removeAt(s, key, i)
+				if len(s.events[newEventKey(vm.ToValue("removeListener"))]) > 0 {
+					emit(call.This, vm.ToValue("removeListener"), name, listener)
+				}
+				break
+			}
+		}
+
+		return call.This
+	}
+
+	proto := ctor.Get("prototype").ToObject(vm)
+	proto.Set("on", addListener(false, false))
+	proto.Set("addListener", addListener(false, false))
+	proto.Set("prependListener", addListener(true, false))
+	proto.Set("once", addListener(false, true))
+	proto.Set("prependOnceListener", addListener(true, true))
+	proto.Set("off", removeListener)
+	proto.Set("removeListener", removeListener)
+
+	proto.Set("removeAllListeners", func(call goja.FunctionCall) goja.Value {
+		s := state(call.This)
+		if len(call.Arguments) == 0 || goja.IsUndefined(call.Arguments[0]) {
+			s.events = make(map[eventKey][]*eventListener)
+			s.names = make(map[eventKey]goja.Value)
+			s.order = nil
+			return call.This
+		}
+
+		key := newEventKey(call.Arguments[0])
+		for len(s.events[key]) > 0 {
+			removeAt(s, key, len(s.events[key])-1)
+		}
+		return call.This
+	})
+
+	proto.Set("emit", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 1 {
+			return vm.ToValue(false)
+		}
+		return vm.ToValue(emit(call.This, call.Arguments[0], call.Arguments[1:]...))
+	})
+
+	proto.Set("listenerCount", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(len(state(call.This).events[newEventKey(call.Argument(0))]))
+	})
+
+	listeners := func(call goja.FunctionCall) goja.Value {
+		fns := make([]interface{}, 0)
+		for _, l := range state(call.This).events[newEventKey(call.Argument(0))] {
+			fns = append(fns, l.fn)
+		}
+		return vm.NewArray(fns...)
+	}
+	proto.Set("listeners", listeners)
+	proto.Set("rawListeners", listeners)
+
+	proto.Set("eventNames", func(call goja.FunctionCall) goja.Value {
+		s := state(call.This)
+		names := make([]interface{}, 0, len(s.order))
+		for _, key := range s.order {
+			names = append(names, s.names[key])
+		}
+		return vm.NewArray(names...)
+	})
+
+	proto.Set("setMaxListeners", func(call goja.FunctionCall) goja.Value {
+		n := call.Argument(0).ToInteger()
+		if n < 0 {
+			panic(vm.NewTypeError("The value of \"n\" is out of range. It must be a non-negative number"))
+		}
+		state(call.This).maxListeners = int(n)
+		return call.This
+	})
+
+	proto.Set("getMaxListeners", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(maxListeners(state(call.This)))
+	})
+
+	// events.once(emitter, name) resolves with the arguments of the next
+	// emission, or rejects if 'error' is emitted first
+	ctor.Set("once", func(call goja.FunctionCall) goja.Value {
+		emitter := call.Argument(0).ToObject(vm)
+		name := call.Argument(1)
+		promise, resolve, reject := vm.NewPromise()
+
+		var onEvent, onError goja.Value
+		off := func(event, listener goja.Value) {
+			if fn, ok := goja.AssertFunction(emitter.Get("removeListener")); ok {
+				fn(emitter, event, listener)
+			}
+		}
+		on := func(event, listener goja.Value) {
+			fn, ok := goja.AssertFunction(emitter.Get("once"))
+			if !ok {
+				panic(vm.NewTypeError("The \"emitter\" argument must be an EventEmitter"))
+			}
+			if _, err := fn(emitter, event, listener); err != nil {
+				panic(err)
+			}
+		}
+
+		onEvent = vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			if onError != nil {
+				off(vm.ToValue("error"), onError)
+			}
+			resolve(vm.NewArray(valuesToInterfaces(call.Arguments)...))
+			return goja.Undefined()
+		})
+		on(name, onEvent)
+
+		if name.String() != "error" {
+			onError = vm.ToValue(func(call goja.FunctionCall) goja.Value {
+				off(name, onEvent)
+				reject(call.Argument(0))
+				return goja.Undefined()
+			})
+			on(vm.ToValue("error"), onError)
+		}
+
+		return vm.ToValue(promise)
+	})
+
+	ctor.Set("EventEmitter", ctor)
+
+	// Register events module
+	return RegisterModule(vm, "events", ctor)
+}
+
+// initEmitter attaches fresh listener state to obj
+func initEmitter(vm *goja.Runtime, stateKey *goja.Symbol, obj *goja.Object) *emitterState {
+	s := &emitterState{
+		events:       make(map[eventKey][]*eventListener),
+		names:        make(map[eventKey]goja.Value),
+		maxListeners: -1,
+		warned:       make(map[eventKey]bool),
+	}
+	obj.DefineDataPropertySymbol(stateKey, vm.ToValue(s), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	return s
+}
+
+// newEventKey converts an event name into a map key
+func newEventKey(name goja.Value) eventKey {
+	if sym, ok := name.(*goja.Symbol); ok {
+		return eventKey{sym: sym}
+	}
+	return eventKey{name: name.String()}
+}
+
+// removeAt removes the i-th listener for key, forgetting the event name once
+// it has no listeners left
+func removeAt(s *emitterState, key eventKey, i int) {
+	listeners := s.events[key]
+	listeners = append(listeners[:i:i], listeners[i+1:]...)
+	if len(listeners) > 0 {
+		s.events[key] = listeners
+		return
+	}
+
+	delete(s.events, key)
+	delete(s.names, key)
+	delete(s.warned, key)
+	for j, k := range s.order {
+		if k == key {
+			s.order = append(s.order[:j:j], s.order[j+1:]...)
+			break
+		}
+	}
+}
+
+// emitEvent calls the listeners for name with args. An 'error' event without
+// listeners throws. Exceptions thrown by listeners propagate to the caller.
+func emitEvent(vm *goja.Runtime, s *emitterState, this goja.Value, name goja.Value, args []goja.Value) bool {
+	key := newEventKey(name)
+	listeners := s.events[key]
+
+	if len(listeners) == 0 {
+		if key.sym == nil && key.name == "error" {
+			var err goja.Value = goja.Undefined()
+			if len(args) > 0 {
+				err = args[0]
+			}
+			if obj, ok := err.(*goja.Object); ok && obj.Get("stack") != nil {
+				panic(err)
+			}
+			unhandled := vm.NewGoError(fmt.Errorf("Unhandled error. (%s)", err.String()))
+			unhandled.Set("code", "ERR_UNHANDLED_ERROR")
+			unhandled.Set("context", err)
+			panic(unhandled)
+		}
+		return false
+	}
+
+	// Listeners added or removed during emit do not affect this emission
+	snapshot := append([]*eventListener(nil), listeners...)
+	for _, l := range snapshot {
+		if l.once {
+			current := s.events[key]
+			for i, c := range current {
+				if c == l {
+					removeAt(s, key, i)
+					break
+				}
+			}
+		}
+		if _, err := l.callable(this, args...); err != nil {
+			panic(err)
+		}
+	}
+
+	return true
+}
+
+// NewEventEmitter creates an EventEmitter instance for use by other modules
+func NewEventEmitter(vm *goja.Runtime) (*goja.Object, error) {
+	ctor, err := builtinExports(vm, "events")
+	if err != nil {
+		return nil, err
+	}
+	return vm.New(ctor)
+}
+
+// Emit calls emitter.emit(name, args...) from Go and reports whether the
+// event had listeners
+func Emit(vm *goja.Runtime, emitter *goja.Object, name string, args ...goja.Value) (bool, error) {
+	emit, ok := goja.AssertFunction(emitter.Get("emit"))
+	if !ok {
+		return false, fmt.Errorf("object is not an EventEmitter")
+	}
+	res, err := emit(emitter, append([]goja.Value{vm.ToValue(name)}, args...)...)
+	if err != nil {
+		return false, err
+	}
+	return res.ToBoolean(), nil
+}
+
+// callMethod calls obj[name](args...), propagating exceptions as panics
+func callMethod(vm *goja.Runtime, obj *goja.Object, name string, args ...goja.Value) goja.Value {
+	fn, ok := goja.AssertFunction(obj.Get(name))
+	if !ok {
+		panic(vm.NewTypeError(fmt.Sprintf("%s is not a function", name)))
+	}
+	res, err := fn(obj, args...)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+// valuesToInterfaces converts JS values for use with vm.NewArray
+func valuesToInterfaces(values []goja.Value) []interface{} {
+	items := make([]interface{}, len(values))
+	for i, v := range values {
+		items[i] = v
+	}
+	return items
+}
+
+// iterableValues collects the values of a JS iterable
+func iterableValues(vm *goja.Runtime, iterable goja.Value) []goja.Value {
+	var values []goja.Value
+	vm.ForOf(iterable, func(v goja.Value) bool {
+		values = append(values, v)
+		return true
+	})
+	return values
+}
+
+// iterateValues returns an iterator over a snapshot of items
+func iterateValues(vm *goja.Runtime, items []interface{}) goja.Value {
+	return callMethod(vm, vm.NewArray(items...), "values")
+}
+
+// exportSymbol returns the Go value stored under sym on obj, or nil if obj
+// has no such property
+func exportSymbol(obj *goja.Object, sym *goja.Symbol) interface{} {
+	v := obj.GetSymbol(sym)
+	if v == nil {
+		return nil
+	}
+	return v.Export()
+}
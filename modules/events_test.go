@@ -0,0 +1,81 @@
+package modules_test
+
+import (
+	"testing"
+
+	"gojs/internal/jstest"
+)
+
+func TestEventEmitter(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const EventEmitter = require('events');
+		console.log(EventEmitter.EventEmitter === EventEmitter);
+		class Bus extends EventEmitter {}
+		const bus = new Bus();
+		const seen = [];
+		bus.on('x', (a, b) => seen.push('on ' + a + b));
+		bus.prependListener('x', () => seen.push('first'));
+		bus.once('x', () => seen.push('once'));
+		console.log(bus.emit('x', 1, 2), bus.emit('x', 3, 4), bus.emit('y'));
+		console.log(JSON.stringify(seen));
+		console.log(bus.listenerCount('x'), JSON.stringify(bus.eventNames()));
+	`, "true\ntrue true false\n[\"first\",\"on 12\",\"once\",\"first\",\"on 34\"]\n2 [\"x\"]\n")
+}
+
+func TestEventEmitterRemovesListeners(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const EventEmitter = require('events');
+		const e = new EventEmitter();
+		const f = () => console.log('called');
+		e.on('a', f);
+		e.on('a', f);
+		e.off('a', f);
+		console.log(e.listenerCount('a'));
+		e.emit('a');
+		e.on('b', f);
+		e.removeAllListeners('a');
+		console.log(e.listenerCount('a'), e.listenerCount('b'));
+		e.removeAllListeners();
+		console.log(JSON.stringify(e.eventNames()));
+	`, "1\ncalled\n0 1\n[]\n")
+}
+
+func TestEventEmitterErrors(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const EventEmitter = require('events');
+		const e = new EventEmitter();
+		try { e.emit('error', new Error('bad')); } catch (err) { console.log('thrown', err.message); }
+		e.on('error', (err) => console.log('handled', err.message));
+		e.emit('error', new Error('bad'));
+	`, "thrown bad\nhandled bad\n")
+}
+
+func TestEventEmitterMaxListeners(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const EventEmitter = require('events');
+		const e = new EventEmitter();
+		console.log(e.getMaxListeners(), EventEmitter.defaultMaxListeners);
+		e.setMaxListeners(1);
+		console.log(e.getMaxListeners());
+	`, "10 10\n1\n")
+}
+
+func TestEventsOnce(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const { EventEmitter, once } = require('events');
+		const e = new EventEmitter();
+		once(e, 'ready').then((args) => console.log('ready', JSON.stringify(args)));
+		e.emit('ready', 'a', 'b');
+		const failing = new EventEmitter();
+		once(failing, 'never').catch((err) => console.log('rejected', err.message));
+		failing.emit('error', new Error('oops'));
+	`, "ready [\"a\",\"b\"]\nrejected oops\n")
+}
+
+func TestProcessIsAnEventEmitter(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const EventEmitter = require('events');
+		process.once('custom', (v) => console.log('custom', v));
+		console.log(process instanceof EventEmitter, process.emit('custom', 1), process.emit('custom', 2));
+	`, "custom 1\ntrue true false\n")
+}
@@ -0,0 +1,459 @@
+package modules
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// fetchClasses holds Headers, Request and Response and the transport fetch
+// sends its requests with
+type fetchClasses struct {
+	vm      *goja.Runtime
+	loop    AsyncLoop
+	streams *webStreamClasses
+	urls    *urlClasses
+	events  *eventTargetClasses
+
+	headers     *goja.Object
+	request     *goja.Object
+	response    *goja.Object
+	headersKey  *goja.Symbol
+	requestKey  *goja.Symbol
+	responseKey *goja.Symbol
+
+	transport *http.Transport
+}
+
+// fetchRequest is the state of a Request
+type fetchRequest struct {
+	method    string
+	url       string
+	headers   *goja.Object
+	body      *fetchBody
+	signal    *abortSignal
+	redirect  string
+	keepalive bool
+}
+
+// fetchResponse is the state of a Response
+type fetchResponse struct {
+	typ        string
+	url        string
+	redirected bool
+	status     int
+	statusText string
+	headers    *goja.Object
+	body       *fetchBody
+}
+
+// SetupFetch sets up the fetch, Headers, Request and Response globals. It
+// needs the URL, EventTarget and ReadableStream globals.
+func SetupFetch(vm *goja.Runtime, loop AsyncLoop) error {
+	c := &fetchClasses{
+		vm:          vm,
+		loop:        loop,
+		streams:     webStreamsOf(vm),
+		urls:        urlClassesOf(vm),
+		events:      eventTargetsOf(vm),
+		headersKey:  goja.NewSymbol("headers"),
+		requestKey:  goja.NewSymbol("request"),
+		responseKey: goja.NewSymbol("response"),
+		transport:   http.DefaultTransport.(*http.Transport).Clone(),
+	}
+	c.setupHeaders()
+	c.setupRequest()
+	c.setupResponse()
+
+	for _, ctor := range []*goja.Object{c.headers, c.request, c.response} {
+		vm.GlobalObject().DefineDataProperty(ctor.Get("name").String(), ctor, goja.FLAG_TRUE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	}
+	return vm.GlobalObject().DefineDataProperty("fetch", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return c.fetch(call.Argument(0), call.Argument(1))
+	}), goja.FLAG_TRUE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+}
+
+// setupRequest creates Request(input[, init])
+func (c *fetchClasses) setupRequest() {
+	vm := c.vm
+	var proto *goja.Object
+	c.request, proto = newClass(vm, "Request", nil, func(this *goja.Object, args []goja.Value) {
+		r := c.newRequest(argAt(args, 0), argAt(args, 1))
+		this.DefineDataPropertySymbol(c.requestKey, vm.ToValue(r), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	})
+
+	requestOf := func(this goja.Value) *fetchRequest {
+		r, ok := c.requestOf(this)
+		if !ok {
+			panic(NewNodeError(vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be of type Request"))
+		}
+		return r
+	}
+	getters := []struct {
+		name string
+		get  func(r *fetchRequest) interface{}
+	}{
+		{"method", func(r *fetchRequest) interface{} { return r.method }},
+		{"url", func(r *fetchRequest) interface{} { return r.url }},
+		{"headers", func(r *fetchRequest) interface{} { return r.headers }},
+		{"destination", func(*fetchRequest) interface{} { return "" }},
+		{"referrer", func(*fetchRequest) interface{} { return "about:client" }},
+		{"referrerPolicy", func(*fetchRequest) interface{} { return "" }},
+		{"mode", func(*fetchRequest) interface{} { return "cors" }},
+		{"credentials", func(*fetchRequest) interface{} { return "same-origin" }},
+		{"cache", func(*fetchRequest) interface{} { return "default" }},
+		{"redirect", func(r *fetchRequest) interface{} { return r.redirect }},
+		{"integrity", func(*fetchRequest) interface{} { return "" }},
+		{"keepalive", func(r *fetchRequest) interface{} { return r.keepalive }},
+		{"isReloadNavigation", func(*fetchRequest) interface{} { return false }},
+		{"isHistoryNavigation", func(*fetchRequest) interface{} { return false }},
+		{"signal", func(r *fetchRequest) interface{} { return r.signal.obj }},
+		{"duplex", func(*fetchRequest) interface{} { return "half" }},
+	}
+	for _, g := range getters {
+		get := g.get
+		proto.DefineAccessorProperty(g.name, vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			return vm.ToValue(get(requestOf(call.This)))
+		}), nil, goja.FLAG_TRUE, goja.FLAG_TRUE)
+	}
+	c.setupBody(proto, func(this goja.Value) *fetchBody {
+		return requestOf(this).body
+	})
+	proto.Set("clone", func(call goja.FunctionCall) goja.Value {
+		r := requestOf(call.This)
+		clone := *r
+		clone.body = c.cloneBody(r.body, "Request.clone")
+		clone.headers = c.cloneHeaders(r.headers)
+		clone.signal = c.followSignal(r.signal)
+		return c.wrapRequest(&clone)
+	})
+	proto.DefineDataPropertySymbol(goja.SymToStringTag, vm.ToValue("Request"), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	// Inspecting shows the getters up to signal, as in Node.js
+	if custom := inspectorOf(vm).custom; custom != nil {
+		proto.SetSymbol(custom, func(call goja.FunctionCall) goja.Value {
+			r := requestOf(call.This)
+			var pairs []interface{}
+			for _, g := range getters[:len(getters)-1] {
+				pairs = append(pairs, g.name, g.get(r))
+			}
+			return inspectObject(vm, c.request, pairs...)
+		})
+	}
+}
+
+// setupResponse creates Response([body[, init]])
+func (c *fetchClasses) setupResponse() {
+	vm := c.vm
+	var proto *goja.Object
+	c.response, proto = newClass(vm, "Response", nil, func(this *goja.Object, args []goja.Value) {
+		r := &fetchResponse{typ: "default"}
+		c.initResponse(r, argAt(args, 0), argAt(args, 1), "")
+		this.DefineDataPropertySymbol(c.responseKey, vm.ToValue(r), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	})
+
+	responseOf := func(this goja.Value) *fetchResponse {
+		if obj, ok := this.(*goja.Object); ok {
+			if r, ok := exportSymbol(obj, c.responseKey).(*fetchResponse); ok {
+				return r
+			}
+		}
+		panic(NewNodeError(vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be of type Response"))
+	}
+	getters := []struct {
+		name string
+		get  func(r *fetchResponse) interface{}
+	}{
+		{"status", func(r *fetchResponse) interface{} { return r.status }},
+		{"statusText", func(r *fetchResponse) interface{} { return r.statusText }},
+		{"headers", func(r *fetchResponse) interface{} { return r.headers }},
+		{"ok", func(r *fetchResponse) interface{} { return r.status >= 200 && r.status <= 299 }},
+		{"redirected", func(r *fetchResponse) interface{} { return r.redirected }},
+		{"type", func(r *fetchResponse) interface{} { return r.typ }},
+		{"url", func(r *fetchResponse) interface{} { return r.url }},
+	}
+	for _, g := range getters {
+		get := g.get
+		proto.DefineAccessorProperty(g.name, vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			return vm.ToValue(get(responseOf(call.This)))
+		}), nil, goja.FLAG_TRUE, goja.FLAG_TRUE)
+	}
+	c.setupBody(proto, func(this goja.Value) *fetchBody {
+		return responseOf(this).body
+	})
+	proto.Set("clone", func(call goja.FunctionCall) goja.Value {
+		r := responseOf(call.This)
+		clone := *r
+		clone.body = c.cloneBody(r.body, "Response.clone")
+		clone.headers = c.cloneHeaders(r.headers)
+		return c.wrapResponse(&clone)
+	})
+	proto.DefineDataPropertySymbol(goja.SymToStringTag, vm.ToValue("Response"), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	// Response.error() returns a network error
+	c.response.Set("error", func(call goja.FunctionCall) goja.Value {
+		r := &fetchResponse{typ: "error"}
+		r.headers, _ = c.newHeaders(true)
+		return c.wrapResponse(r)
+	})
+
+	// Response.json(data[, init]) returns a response of data as JSON
+	c.response.Set("json", func(call goja.FunctionCall) goja.Value {
+		stringify, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("stringify"))
+		text, err := stringify(goja.Undefined(), call.Argument(0))
+		if err != nil {
+			panic(err)
+		}
+		if goja.IsUndefined(text) {
+			panic(vm.NewTypeError("Value is not JSON serializable"))
+		}
+		r := &fetchResponse{typ: "default"}
+		c.initResponse(r, text, call.Argument(1), "application/json")
+		return c.wrapResponse(r)
+	})
+
+	// Response.redirect(url[, status]) returns a redirect to url
+	c.response.Set("redirect", func(call goja.FunctionCall) goja.Value {
+		location := c.parseFetchURL(call.Argument(0).String())
+		status := 302
+		if v := call.Argument(1); !goja.IsUndefined(v) {
+			status = int(v.ToInteger())
+		}
+		switch status {
+		case 301, 302, 303, 307, 308:
+		default:
+			panic(NewNodeError(vm, "RangeError", "", "Invalid status code "+strconv.Itoa(status)))
+		}
+		r := &fetchResponse{typ: "default", status: status}
+		var h *fetchHeaders
+		r.headers, h = c.newHeaders(true)
+		h.append("location", location)
+		return c.wrapResponse(r)
+	})
+
+	if custom := inspectorOf(vm).custom; custom != nil {
+		proto.SetSymbol(custom, func(call goja.FunctionCall) goja.Value {
+			this := call.This.ToObject(vm)
+			pairs := []interface{}{}
+			for _, name := range []string{"status", "statusText", "headers", "body", "bodyUsed", "ok", "redirected", "type", "url"} {
+				pairs = append(pairs, name, this.Get(name))
+			}
+			return inspectObject(vm, c.response, pairs...)
+		})
+	}
+}
+
+// newRequest creates the state of Request(input, init), taking the body of
+// input if it is a Request
+func (c *fetchClasses) newRequest(input, initValue goja.Value) *fetchRequest {
+	vm := c.vm
+	init, _ := initValue.(*goja.Object)
+	// member returns a member of init, nil if absent
+	member := func(name string) goja.Value {
+		if init == nil {
+			return nil
+		}
+		if v := init.Get(name); v != nil && !goja.IsUndefined(v) {
+			return v
+		}
+		return nil
+	}
+
+	r := &fetchRequest{method: "GET", redirect: "follow"}
+	var signal *abortSignal
+	var headersInit goja.Value
+	var inputBody *fetchBody
+	if other, ok := c.requestOf(input); ok {
+		if other.body.isUsed() {
+			panic(vm.NewTypeError("Cannot construct a Request with a Request object that has already been used."))
+		}
+		r.method, r.url, r.redirect, r.keepalive = other.method, other.url, other.redirect, other.keepalive
+		signal, headersInit, inputBody = other.signal, other.headers, other.body
+	} else {
+		r.url = c.parseFetchURL(input.String())
+		if rec, _ := parseURL(r.url, nil); rec.username != "" || rec.password != "" {
+			panic(vm.NewTypeError("Request cannot be constructed from a URL that includes credentials: " + input.String()))
+		}
+	}
+
+	if v := member("method"); v != nil {
+		method := v.String()
+		if !isHTTPToken(method) {
+			panic(vm.NewTypeError("'%s' is not a valid HTTP method.", method))
+		}
+		switch upper := strings.ToUpper(method); upper {
+		case "CONNECT", "TRACE", "TRACK":
+			panic(vm.NewTypeError("'%s' HTTP method is unsupported.", method))
+		case "DELETE", "GET", "HEAD", "OPTIONS", "POST", "PUT":
+			method = upper
+		}
+		r.method = method
+	}
+	if v := member("signal"); v != nil {
+		signal = nil
+		if !goja.IsNull(v) {
+			s, ok := c.events.signalOf(v)
+			if !ok {
+				panic(vm.NewTypeError("Failed to construct 'Request': member signal is not of type AbortSignal."))
+			}
+			signal = s
+		}
+	}
+	if v := member("redirect"); v != nil {
+		switch redirect := v.String(); redirect {
+		case "follow", "error", "manual":
+			r.redirect = redirect
+		default:
+			panic(vm.NewTypeError("Request constructor: %s is not an accepted type. Expected one of follow, manual, error.", redirect))
+		}
+	}
+	if v := member("keepalive"); v != nil {
+		r.keepalive = v.ToBoolean()
+	}
+	r.signal = c.followSignal(signal)
+
+	var h *fetchHeaders
+	r.headers, h = c.newHeaders(false)
+	if v := member("headers"); v != nil {
+		headersInit = v
+	}
+	if headersInit != nil {
+		c.fillHeaders(h, headersInit)
+	}
+
+	var body *fetchBody
+	if v := member("body"); v != nil && !goja.IsNull(v) {
+		var contentType string
+		body, contentType = c.extractBody(v)
+		if contentType != "" {
+			if _, ok := h.get("content-type"); !ok {
+				h.append("content-type", contentType)
+			}
+		}
+	} else if inputBody != nil && (init == nil || init.Get("body") == nil || goja.IsUndefined(init.Get("body"))) {
+		body = &fetchBody{source: inputBody.source, stream: inputBody.stream}
+		inputBody.used = true
+	}
+	if body != nil && (r.method == "GET" || r.method == "HEAD") {
+		panic(vm.NewTypeError("Request with GET/HEAD method cannot have body."))
+	}
+	if body != nil && body.stream != nil && inputBody == nil {
+		if v := member("duplex"); v == nil || v.String() != "half" {
+			panic(vm.NewTypeError("RequestInit: duplex option is required when sending a body."))
+		}
+	}
+	r.body = body
+	return r
+}
+
+// initResponse applies body and init to r. The Content-Type defaults to
+// contentType, or to the one the body implies.
+func (c *fetchClasses) initResponse(r *fetchResponse, body, initValue goja.Value, contentType string) {
+	vm := c.vm
+	r.status = 200
+	init, _ := initValue.(*goja.Object)
+	if init != nil {
+		if v := init.Get("status"); v != nil && !goja.IsUndefined(v) {
+			r.status = int(v.ToInteger())
+			if r.status < 200 || r.status > 599 {
+				panic(NewNodeError(vm, "RangeError", "", `init["status"] must be in the range of 200 to 599, inclusive.`))
+			}
+		}
+		if v := init.Get("statusText"); v != nil && !goja.IsUndefined(v) {
+			r.statusText = v.String()
+			for _, ch := range r.statusText {
+				if ch != '\t' && (ch < ' ' || ch == 0x7f || ch > 0xff) {
+					panic(vm.NewTypeError("Invalid statusText"))
+				}
+			}
+		}
+	}
+
+	var h *fetchHeaders
+	r.headers, h = c.newHeaders(false)
+	if init != nil {
+		if v := init.Get("headers"); v != nil && !goja.IsUndefined(v) {
+			c.fillHeaders(h, v)
+		}
+	}
+	if isNullish(body) {
+		return
+	}
+	if nullBodyStatus(r.status) {
+		panic(vm.NewTypeError("Response constructor: Invalid response status code %d", r.status))
+	}
+	var implied string
+	r.body, implied = c.extractBody(body)
+	if contentType == "" {
+		contentType = implied
+	}
+	if _, ok := h.get("content-type"); !ok && contentType != "" {
+		h.append("content-type", contentType)
+	}
+}
+
+// parseFetchURL parses an absolute URL, throwing the TypeError of fetch
+// for invalid ones
+func (c *fetchClasses) parseFetchURL(input string) string {
+	r, ok := parseURL(input, nil)
+	if !ok {
+		err := c.vm.NewTypeError("Failed to parse URL from " + input)
+		err.DefineDataProperty("cause", c.urls.invalidURL(input, nil), goja.FLAG_TRUE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+		panic(err)
+	}
+	return r.href()
+}
+
+// followSignal returns a new signal that aborts with signal, if any
+func (c *fetchClasses) followSignal(signal *abortSignal) *abortSignal {
+	s := c.events.newSignal()
+	switch {
+	case signal == nil:
+	case signal.aborted:
+		c.events.abort(s, signal.reason)
+	default:
+		signal.onAbort(func() { c.events.abort(s, signal.reason) })
+	}
+	return s
+}
+
+func (c *fetchClasses) requestOf(v goja.Value) (*fetchRequest, bool) {
+	if obj, ok := v.(*goja.Object); ok {
+		r, ok := exportSymbol(obj, c.requestKey).(*fetchRequest)
+		return r, ok
+	}
+	return nil, false
+}
+
+// mustHeaders returns the state of a Headers object created by this package
+func (c *fetchClasses) mustHeaders(obj *goja.Object) *fetchHeaders {
+	h, _ := c.headersOf(obj)
+	return h
+}
+
+// wrapRequest creates a Request object for r
+func (c *fetchClasses) wrapRequest(r *fetchRequest) *goja.Object {
+	obj := c.vm.NewObject()
+	obj.SetPrototype(c.request.Get("prototype").ToObject(c.vm))
+	obj.DefineDataPropertySymbol(c.requestKey, c.vm.ToValue(r), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	return obj
+}
+
+// wrapResponse creates a Response object for r
+func (c *fetchClasses) wrapResponse(r *fetchResponse) *goja.Object {
+	obj := c.vm.NewObject()
+	obj.SetPrototype(c.response.Get("prototype").ToObject(c.vm))
+	obj.DefineDataPropertySymbol(c.responseKey, c.vm.ToValue(r), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	return obj
+}
+
+// nullBodyStatus reports whether responses with status have no body
+func nullBodyStatus(status int) bool {
+	switch status {
+	case 101, 103, 204, 205, 304:
+		return true
+	}
+	return false
+}
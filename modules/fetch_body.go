@@ -0,0 +1,152 @@
+package modules
+
+import (
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// fetchBody is the body of a Request or Response: either bytes known up
+// front, read through a stream created on first use, or a stream. A nil
+// *fetchBody is a null body.
+type fetchBody struct {
+	source []byte
+	stream *readableStream
+	// used is set once the bytes are read without a stream, or the body is
+	// moved to another Request
+	used bool
+}
+
+// setupBody adds the body getters and methods shared by Request and
+// Response to proto. bodyOf returns the body of this, nil if null.
+func (c *fetchClasses) setupBody(proto *goja.Object, bodyOf func(this goja.Value) *fetchBody) {
+	vm := c.vm
+	proto.DefineAccessorProperty("body", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		b := bodyOf(call.This)
+		if b == nil {
+			return goja.Null()
+		}
+		return c.bodyStream(b).obj
+	}), nil, goja.FLAG_TRUE, goja.FLAG_TRUE)
+	proto.DefineAccessorProperty("bodyUsed", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(bodyOf(call.This).isUsed())
+	}), nil, goja.FLAG_TRUE, goja.FLAG_TRUE)
+
+	// consume returns a promise of the bytes of the body converted by fn
+	consume := func(fn func(data []byte) goja.Value) func(goja.FunctionCall) goja.Value {
+		return func(call goja.FunctionCall) goja.Value {
+			b := bodyOf(call.This)
+			promise, resolve, reject := vm.NewPromise()
+			c.readBody(b, func(data []byte, err goja.Value) {
+				if err != nil {
+					reject(err)
+					return
+				}
+				if ex := vm.Try(func() { resolve(fn(data)) }); ex != nil {
+					reject(ex.Value())
+				}
+			})
+			return vm.ToValue(promise)
+		}
+	}
+	proto.Set("text", consume(func(data []byte) goja.Value {
+		return vm.ToValue(decodeUTF8(data))
+	}))
+	proto.Set("json", consume(func(data []byte) goja.Value {
+		parse, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("parse"))
+		v, err := parse(goja.Undefined(), vm.ToValue(decodeUTF8(data)))
+		if err != nil {
+			panic(err)
+		}
+		return v
+	}))
+	proto.Set("arrayBuffer", consume(func(data []byte) goja.Value {
+		return vm.ToValue(vm.NewArrayBuffer(data))
+	}))
+	proto.Set("bytes", consume(func(data []byte) goja.Value {
+		return c.streams.newChunk(data)
+	}))
+}
+
+// isUsed reports whether the body has been read, or its stream disturbed
+func (b *fetchBody) isUsed() bool {
+	return b != nil && (b.used || b.stream != nil && b.stream.disturbed)
+}
+
+// bodyStream returns the stream of b, creating it from the bytes of b on
+// first use
+func (c *fetchClasses) bodyStream(b *fetchBody) *readableStream {
+	if b.stream == nil {
+		data := b.source
+		var s *readableStream
+		s = c.streams.newStream(webStreamSource{
+			pull: func(done func(err goja.Value)) {
+				if len(data) > 0 {
+					s.enqueue(c.streams.newChunk(data))
+				}
+				s.close()
+				done(nil)
+			},
+		}, 0)
+		b.stream = s
+	}
+	return b.stream
+}
+
+// readBody reads all of b, failing if it was already read
+func (c *fetchClasses) readBody(b *fetchBody, done func(data []byte, err goja.Value)) {
+	switch {
+	case b == nil:
+		done(nil, nil)
+	case b.isUsed() || b.stream != nil && b.stream.reader != nil:
+		done(nil, c.vm.NewTypeError("Body is unusable: Body has already been read"))
+	case b.stream == nil:
+		b.used = true
+		done(b.source, nil)
+	default:
+		b.stream.readAll(done)
+	}
+}
+
+// cloneBody returns a copy of b. A stream is teed, one branch replacing the
+// stream of b.
+func (c *fetchClasses) cloneBody(b *fetchBody, prefix string) *fetchBody {
+	if b == nil {
+		return nil
+	}
+	if b.isUsed() || b.stream != nil && b.stream.reader != nil {
+		panic(c.vm.NewTypeError(prefix + ": Body has already been consumed."))
+	}
+	if b.stream == nil {
+		return &fetchBody{source: b.source}
+	}
+	var other *readableStream
+	b.stream, other = b.stream.tee()
+	return &fetchBody{stream: other}
+}
+
+// extractBody converts a body init to a body and the Content-Type it
+// implies, if any
+func (c *fetchClasses) extractBody(v goja.Value) (*fetchBody, string) {
+	vm := c.vm
+	if s, ok := c.streams.streamOf(v); ok {
+		if s.disturbed || s.reader != nil {
+			panic(vm.NewTypeError("Response body object should not be disturbed or locked"))
+		}
+		return &fetchBody{stream: s}, ""
+	}
+	if obj, ok := v.(*goja.Object); ok {
+		if p, ok := exportSymbol(obj, c.urls.paramsKey).(*searchParams); ok {
+			return &fetchBody{source: []byte(serializeQuery(p.list))}, "application/x-www-form-urlencoded;charset=UTF-8"
+		}
+		if data, ok := bufferOf(vm).bytes(obj); ok {
+			return &fetchBody{source: append([]byte(nil), data...)}, ""
+		}
+	}
+	return &fetchBody{source: []byte(v.String())}, "text/plain;charset=UTF-8"
+}
+
+// decodeUTF8 decodes data as UTF-8 text, dropping a byte order mark
+func decodeUTF8(data []byte) string {
+	return strings.TrimPrefix(strings.ToValidUTF8(string(data), "\uFFFD"), "\uFEFF")
+}
@@ -0,0 +1,291 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// fetchChunkSize is the most bytes a chunk of a fetched body holds
+const fetchChunkSize = 64 * 1024
+
+// fetchMaxRedirects is the number of redirects fetch follows, as in the
+// Fetch standard
+const fetchMaxRedirects = 20
+
+var (
+	errUnexpectedRedirect = errors.New("unexpected redirect")
+	errRedirectCount      = errors.New("redirect count exceeded")
+)
+
+// fetch sends the request of fetch(input[, init]), returning a promise of
+// its response. The response arrives on the loop once its head is read;
+// the body streams after it.
+func (c *fetchClasses) fetch(input, init goja.Value) goja.Value {
+	vm := c.vm
+	promise, resolve, reject := vm.NewPromise()
+	var r *fetchRequest
+	if ex := vm.Try(func() { r = c.newRequest(input, init) }); ex != nil {
+		reject(ex.Value())
+		return vm.ToValue(promise)
+	}
+	if r.signal.aborted {
+		reject(r.signal.reason)
+		return vm.ToValue(promise)
+	}
+
+	target, _ := url.Parse(r.url)
+	if target.Scheme != "http" && target.Scheme != "https" {
+		reject(c.fetchFailed(jsError(vm, errors.New("unknown scheme"))))
+		return vm.ToValue(promise)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var body io.Reader
+	var pipe *io.PipeWriter
+	if b := r.body; b != nil {
+		if b.stream == nil {
+			body = bytes.NewReader(b.source)
+			b.used = true
+		} else {
+			var pr *io.PipeReader
+			pr, pipe = io.Pipe()
+			body = pr
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, r.url, body)
+	if err != nil {
+		cancel()
+		reject(c.fetchFailed(jsError(vm, err)))
+		return vm.ToValue(promise)
+	}
+	h := c.mustHeaders(r.headers)
+	req.Header = h.header()
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+	req.Header.Del("Host")
+	if _, ok := h.get("accept"); !ok {
+		req.Header.Set("Accept", "*/*")
+	}
+	if _, ok := h.get("user-agent"); !ok {
+		req.Header.Set("User-Agent", "gojs")
+	}
+	if pipe != nil {
+		req.ContentLength = -1
+		c.pumpBody(r.body.stream, pipe)
+	}
+
+	redirect := r.redirect
+	client := &http.Client{
+		Transport: c.transport,
+		CheckRedirect: func(_ *http.Request, via []*http.Request) error {
+			switch {
+			case redirect == "error":
+				return errUnexpectedRedirect
+			case redirect == "manual":
+				return http.ErrUseLastResponse
+			case len(via) >= fetchMaxRedirects:
+				return errRedirectCount
+			}
+			return nil
+		},
+	}
+
+	// Aborting rejects the promise until the response arrives, and errors
+	// its body after
+	var stream *readableStream
+	settled := false
+	removeAbort := r.signal.onAbort(func() {
+		cancel()
+		if !settled {
+			settled = true
+			reject(r.signal.reason)
+		} else if stream != nil {
+			stream.error(r.signal.reason)
+		}
+	})
+	// A halted run cancels the request
+	unclose := c.loop.AddCloser(cancel)
+	finish := func() {
+		removeAbort()
+		unclose()
+		cancel()
+	}
+
+	c.loop.Ref()
+	go func() {
+		resp, err := client.Do(req)
+		c.loop.RunOnLoop(func(*goja.Runtime) {
+			if settled {
+				if resp != nil {
+					resp.Body.Close()
+				}
+				finish()
+				return
+			}
+			settled = true
+			if err != nil {
+				finish()
+				reject(c.fetchFailed(c.networkError(err, target)))
+				return
+			}
+			res := c.fetchedResponse(resp, req)
+			if r.method == "HEAD" || nullBodyStatus(resp.StatusCode) {
+				resp.Body.Close()
+				finish()
+			} else {
+				stream = c.responseStream(resp.Body, finish)
+				res.body = &fetchBody{stream: stream}
+			}
+			resolve(c.wrapResponse(res))
+		})
+		c.loop.Unref()
+	}()
+	return vm.ToValue(promise)
+}
+
+// fetchedResponse converts the head of resp to a Response with immutable
+// headers
+func (c *fetchClasses) fetchedResponse(resp *http.Response, req *http.Request) *fetchResponse {
+	res := &fetchResponse{
+		typ:        "basic",
+		url:        resp.Request.URL.String(),
+		redirected: resp.Request != req,
+		status:     resp.StatusCode,
+		statusText: strings.TrimSpace(strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode))),
+	}
+	if rec, ok := parseURL(res.url, nil); ok {
+		res.url = rec.href()
+	}
+	var h *fetchHeaders
+	res.headers, h = c.newHeaders(true)
+	names := make([]string, 0, len(resp.Header))
+	for name := range resp.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range resp.Header[name] {
+			h.append(strings.ToLower(name), value)
+		}
+	}
+	return res
+}
+
+// responseStream streams body, reading a chunk whenever the stream pulls.
+// finish is called once the body ends, fails or is cancelled.
+func (c *fetchClasses) responseStream(body io.ReadCloser, finish func()) *readableStream {
+	vm := c.vm
+	var s *readableStream
+	s = c.streams.newStream(webStreamSource{
+		pull: func(done func(err goja.Value)) {
+			buf := make([]byte, fetchChunkSize)
+			var n int
+			runAsync(c.loop, func() (fsResult, error) {
+				var err error
+				n, err = body.Read(buf)
+				return nil, err
+			}, func(_ fsResult, err error) {
+				defer done(nil)
+				if s.state != webStreamReadable || s.closeRequested {
+					return
+				}
+				if n > 0 {
+					s.enqueue(c.streams.newChunk(buf[:n]))
+				}
+				switch {
+				case err == io.EOF:
+					body.Close()
+					s.close()
+					finish()
+				case err != nil:
+					body.Close()
+					terminated := vm.NewTypeError("terminated")
+					terminated.DefineDataProperty("cause", jsError(vm, err), goja.FLAG_TRUE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+					s.error(terminated)
+					finish()
+				}
+			})
+		},
+		cancel: func(reason goja.Value, done func(err goja.Value)) {
+			body.Close()
+			finish()
+			done(nil)
+		},
+	}, 0)
+	return s
+}
+
+// pumpBody writes the chunks of the request body s to w
+func (c *fetchClasses) pumpBody(s *readableStream, w *io.PipeWriter) {
+	reader := c.streams.newReader(s)
+	var next func()
+	next = func() {
+		reader.read(readRequest{
+			chunk: func(v goja.Value) {
+				data, ok := bufferOf(c.vm).uint8Bytes(v)
+				if !ok {
+					w.CloseWithError(errors.New("Received non-Uint8Array chunk"))
+					s.cancel(goja.Undefined(), func(goja.Value) {})
+					return
+				}
+				data = append([]byte(nil), data...)
+				runAsync(c.loop, func() (fsResult, error) {
+					_, err := w.Write(data)
+					return nil, err
+				}, func(_ fsResult, err error) {
+					if err != nil {
+						s.cancel(goja.Undefined(), func(goja.Value) {})
+						return
+					}
+					next()
+				})
+			},
+			close: func() { w.Close() },
+			fail: func(err goja.Value) {
+				w.CloseWithError(errors.New(err.String()))
+			},
+		})
+	}
+	next()
+}
+
+// networkError converts the error of a request to target to the cause of
+// the "fetch failed" TypeError
+func (c *fetchClasses) networkError(err error, target *url.URL) goja.Value {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) || errors.As(err, &opErr) && opErr.Op == "dial" {
+		port, convErr := strconv.Atoi(target.Port())
+		if convErr != nil {
+			port = 80
+			if target.Scheme == "https" {
+				port = 443
+			}
+		}
+		return jsError(c.vm, netError(err, "connect", target.Hostname(), port))
+	}
+	return jsError(c.vm, err)
+}
+
+// fetchFailed creates the TypeError that fetch rejects with on network
+// errors
+func (c *fetchClasses) fetchFailed(cause goja.Value) *goja.Object {
+	err := c.vm.NewTypeError("fetch failed")
+	err.DefineDataProperty("cause", cause, goja.FLAG_TRUE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	return err
+}
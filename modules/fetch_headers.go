@@ -0,0 +1,322 @@
+package modules
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// fetchHeaders is the state of a Headers object: its entries in insertion
+// order. The headers of fetched responses are immutable.
+type fetchHeaders struct {
+	list      []headerEntry
+	immutable bool
+}
+
+// headerEntry is a header as appended, with its name lowercased for lookups
+type headerEntry struct {
+	name  string
+	lower string
+	value string
+}
+
+// setupHeaders creates Headers([init])
+func (c *fetchClasses) setupHeaders() {
+	vm := c.vm
+	var proto *goja.Object
+	c.headers, proto = newClass(vm, "Headers", nil, func(this *goja.Object, args []goja.Value) {
+		h := &fetchHeaders{}
+		this.DefineDataPropertySymbol(c.headersKey, vm.ToValue(h), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+		if init := argAt(args, 0); !goja.IsUndefined(init) {
+			c.fillHeaders(h, init)
+		}
+	})
+
+	headersOf := func(this goja.Value) *fetchHeaders {
+		h, ok := c.headersOf(this)
+		if !ok {
+			panic(NewNodeError(vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be of type Headers"))
+		}
+		return h
+	}
+	// mutable returns the headers of this, throwing if they are immutable
+	mutable := func(this goja.Value) *fetchHeaders {
+		h := headersOf(this)
+		if h.immutable {
+			panic(vm.NewTypeError("immutable"))
+		}
+		return h
+	}
+
+	proto.Set("append", func(call goja.FunctionCall) goja.Value {
+		h := mutable(call.This)
+		name, value := c.headerPair("Headers.append", call.Argument(0), call.Argument(1))
+		h.append(name, value)
+		return goja.Undefined()
+	})
+	proto.Set("set", func(call goja.FunctionCall) goja.Value {
+		h := mutable(call.This)
+		name, value := c.headerPair("Headers.set", call.Argument(0), call.Argument(1))
+		h.set(name, value)
+		return goja.Undefined()
+	})
+	proto.Set("delete", func(call goja.FunctionCall) goja.Value {
+		h := mutable(call.This)
+		h.delete(c.headerName("Headers.delete", call.Argument(0)))
+		return goja.Undefined()
+	})
+	proto.Set("get", func(call goja.FunctionCall) goja.Value {
+		h := headersOf(call.This)
+		if value, ok := h.get(c.headerName("Headers.get", call.Argument(0))); ok {
+			return vm.ToValue(value)
+		}
+		return goja.Null()
+	})
+	proto.Set("has", func(call goja.FunctionCall) goja.Value {
+		h := headersOf(call.This)
+		_, ok := h.get(c.headerName("Headers.has", call.Argument(0)))
+		return vm.ToValue(ok)
+	})
+	proto.Set("getSetCookie", func(call goja.FunctionCall) goja.Value {
+		var cookies []interface{}
+		for _, e := range headersOf(call.This).list {
+			if e.lower == "set-cookie" {
+				cookies = append(cookies, e.value)
+			}
+		}
+		return vm.NewArray(cookies...)
+	})
+	proto.Set("forEach", func(call goja.FunctionCall) goja.Value {
+		h := headersOf(call.This)
+		fn, ok := goja.AssertFunction(call.Argument(0))
+		if !ok {
+			panic(ErrInvalidArgType(vm, "callback", "of type function", call.Argument(0)))
+		}
+		for _, pair := range h.sorted() {
+			if _, err := fn(call.Argument(1), vm.ToValue(pair[1]), vm.ToValue(pair[0]), call.This); err != nil {
+				panic(err)
+			}
+		}
+		return goja.Undefined()
+	})
+
+	// The iterators walk the headers sorted by name, with the values of a
+	// name combined except for set-cookie
+	iterate := func(item func(pair [2]string) interface{}) func(goja.FunctionCall) goja.Value {
+		return func(call goja.FunctionCall) goja.Value {
+			pairs := headersOf(call.This).sorted()
+			items := make([]interface{}, len(pairs))
+			for i, pair := range pairs {
+				items[i] = item(pair)
+			}
+			return iterateValues(vm, items)
+		}
+	}
+	entries := iterate(func(pair [2]string) interface{} { return vm.NewArray(pair[0], pair[1]) })
+	proto.Set("entries", entries)
+	proto.Set("keys", iterate(func(pair [2]string) interface{} { return pair[0] }))
+	proto.Set("values", iterate(func(pair [2]string) interface{} { return pair[1] }))
+	proto.SetSymbol(goja.SymIterator, entries)
+	proto.DefineDataPropertySymbol(goja.SymToStringTag, vm.ToValue("Headers"), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	// Like Node.js, inspecting shows the headers in insertion order, under
+	// the name they were first added with
+	if custom := inspectorOf(vm).custom; custom != nil {
+		proto.SetSymbol(custom, func(call goja.FunctionCall) goja.Value {
+			h := headersOf(call.This)
+			var pairs []interface{}
+			seen := map[string]bool{}
+			for _, e := range h.list {
+				if seen[e.lower] {
+					continue
+				}
+				seen[e.lower] = true
+				value, _ := h.get(e.lower)
+				pairs = append(pairs, e.name, value)
+			}
+			return inspectObject(vm, c.headers, pairs...)
+		})
+	}
+}
+
+// newHeaders creates a Headers object with no entries
+func (c *fetchClasses) newHeaders(immutable bool) (*goja.Object, *fetchHeaders) {
+	obj, err := c.vm.New(c.headers)
+	if err != nil {
+		panic(err)
+	}
+	h, _ := c.headersOf(obj)
+	h.immutable = immutable
+	return obj, h
+}
+
+// cloneHeaders copies a Headers object created by this package
+func (c *fetchClasses) cloneHeaders(obj *goja.Object) *goja.Object {
+	h := c.mustHeaders(obj)
+	clone, state := c.newHeaders(h.immutable)
+	state.list = append(state.list, h.list...)
+	return clone
+}
+
+// headersOf returns the state of the Headers object v
+func (c *fetchClasses) headersOf(v goja.Value) (*fetchHeaders, bool) {
+	if obj, ok := v.(*goja.Object); ok {
+		h, ok := exportSymbol(obj, c.headersKey).(*fetchHeaders)
+		return h, ok
+	}
+	return nil, false
+}
+
+// fillHeaders appends the headers of init: a Headers object, a sequence of
+// name-value pairs or a record of names to values
+func (c *fetchClasses) fillHeaders(h *fetchHeaders, init goja.Value) {
+	vm := c.vm
+	const prefix = "Headers constructor"
+	obj, ok := init.(*goja.Object)
+	if !ok {
+		panic(vm.NewTypeError(prefix + ": Argument 1 could not be converted to one of: sequence<sequence<ByteString>>, record<ByteString, ByteString>."))
+	}
+	if other, ok := c.headersOf(obj); ok {
+		h.list = append(h.list, other.list...)
+		return
+	}
+	if _, ok := goja.AssertFunction(obj.GetSymbol(goja.SymIterator)); ok {
+		for _, item := range iterableValues(vm, obj) {
+			if _, ok := item.(*goja.Object); !ok {
+				panic(vm.NewTypeError(prefix + ": Argument 1 could not be converted to one of: sequence<sequence<ByteString>>, record<ByteString, ByteString>."))
+			}
+			pair := iterableValues(vm, item)
+			if len(pair) != 2 {
+				panic(vm.NewTypeError("%s: expected name/value pair to be length 2, found %d.", prefix, len(pair)))
+			}
+			h.append(c.headerPair(prefix, pair[0], pair[1]))
+		}
+		return
+	}
+	for _, key := range obj.Keys() {
+		h.append(c.headerPair(prefix, vm.ToValue(key), obj.Get(key)))
+	}
+}
+
+// headerName validates a header name argument
+func (c *fetchClasses) headerName(prefix string, v goja.Value) string {
+	name := v.String()
+	if !isHTTPToken(name) {
+		panic(c.vm.NewTypeError("%s: \"%s\" is an invalid header name.", prefix, name))
+	}
+	return name
+}
+
+// headerPair validates a header name and value, trimming the whitespace
+// around the value
+func (c *fetchClasses) headerPair(prefix string, name, value goja.Value) (string, string) {
+	n := c.headerName(prefix, name)
+	v := strings.Trim(value.String(), " \t\r\n")
+	for _, r := range v {
+		if r == 0 || r == '\r' || r == '\n' || r > 0xff {
+			panic(c.vm.NewTypeError("%s: \"%s\" is an invalid header value.", prefix, v))
+		}
+	}
+	return n, v
+}
+
+func (h *fetchHeaders) append(name, value string) {
+	h.list = append(h.list, headerEntry{name: name, lower: strings.ToLower(name), value: value})
+}
+
+// set replaces the values of name with value, keeping its position
+func (h *fetchHeaders) set(name, value string) {
+	lower := strings.ToLower(name)
+	found := false
+	list := h.list[:0]
+	for _, e := range h.list {
+		if e.lower == lower {
+			if found {
+				continue
+			}
+			found, e.value = true, value
+		}
+		list = append(list, e)
+	}
+	h.list = list
+	if !found {
+		h.append(name, value)
+	}
+}
+
+// delete removes the values of name
+func (h *fetchHeaders) delete(name string) {
+	lower := strings.ToLower(name)
+	list := h.list[:0]
+	for _, e := range h.list {
+		if e.lower != lower {
+			list = append(list, e)
+		}
+	}
+	h.list = list
+}
+
+// get returns the values of name combined with ", "
+func (h *fetchHeaders) get(name string) (string, bool) {
+	lower := strings.ToLower(name)
+	var values []string
+	for _, e := range h.list {
+		if e.lower == lower {
+			values = append(values, e.value)
+		}
+	}
+	return strings.Join(values, ", "), values != nil
+}
+
+// sorted returns the name-value pairs that Headers iterates over
+func (h *fetchHeaders) sorted() [][2]string {
+	var names []string
+	seen := map[string]bool{}
+	for _, e := range h.list {
+		if !seen[e.lower] {
+			seen[e.lower] = true
+			names = append(names, e.lower)
+		}
+	}
+	sort.Strings(names)
+	var pairs [][2]string
+	for _, name := range names {
+		if name != "set-cookie" {
+			value, _ := h.get(name)
+			pairs = append(pairs, [2]string{name, value})
+			continue
+		}
+		for _, e := range h.list {
+			if e.lower == name {
+				pairs = append(pairs, [2]string{name, e.value})
+			}
+		}
+	}
+	return pairs
+}
+
+// header converts the headers to a net/http header
+func (h *fetchHeaders) header() http.Header {
+	header := http.Header{}
+	for _, e := range h.list {
+		header.Add(e.name, e.value)
+	}
+	return header
+}
+
+// isHTTPToken reports whether s is a token, the syntax of header names and
+// methods
+func isHTTPToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 0x80 || c <= ' ' || strings.IndexByte("\"(),/:;<=>?@[\\]{}\x7f", c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
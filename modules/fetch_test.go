@@ -0,0 +1,197 @@
+package modules_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gojs/internal/jstest"
+)
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"hello":"world"}`)
+		case "/echo":
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("X-Method", r.Method)
+			w.Header().Set("X-Token", r.Header.Get("X-Token"))
+			w.Header().Set("X-Type", r.Header.Get("Content-Type"))
+			w.WriteHeader(http.StatusCreated)
+			w.Write(body)
+		case "/redirect":
+			http.Redirect(w, r, "/json", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	jstest.ExpectOutput(t, `
+		const base = `+jstest.Quote(srv.URL)+`;
+		(async () => {
+			const res = await fetch(base + '/json');
+			console.log(res.status, res.ok, res.headers.get('content-type'));
+			console.log((await res.json()).hello);
+
+			const echo = await fetch(new URL('/echo', base), {
+				method: 'POST',
+				headers: { 'X-Token': 'secret' },
+				body: new URLSearchParams({ q: '1' }),
+			});
+			console.log(echo.status, echo.headers.get('x-method'), echo.headers.get('x-token'), echo.headers.get('x-type'), await echo.text());
+
+			const redirected = await fetch(base + '/redirect');
+			console.log(redirected.redirected, redirected.url === base + '/json');
+			const manual = await fetch(base + '/redirect', { redirect: 'manual' });
+			console.log(manual.status, manual.headers.get('location'));
+
+			const missing = await fetch(base + '/missing');
+			console.log(missing.status, missing.ok);
+		})();
+	`, "200 true application/json\nworld\n"+
+		"201 POST secret application/x-www-form-urlencoded;charset=UTF-8 q=1\n"+
+		"true true\n302 /json\n404 false\n")
+}
+
+func TestFetchStreamsBodies(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}))
+	defer srv.Close()
+
+	jstest.ExpectOutput(t, `
+		(async () => {
+			const body = new ReadableStream({ start(c) { c.enqueue(new Uint8Array([104, 105])); c.close(); } });
+			const res = await fetch(`+jstest.Quote(srv.URL)+`, { method: 'POST', body, duplex: 'half' });
+			const reader = res.body.getReader();
+			const chunks = [];
+			for (let r = await reader.read(); !r.done; r = await reader.read()) chunks.push(...r.value);
+			console.log(String.fromCharCode(...chunks), res.bodyUsed);
+		})();
+	`, "hi true\n")
+}
+
+func TestFetchConnectionRefused(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	jstest.ExpectOutput(t, `
+		fetch(`+jstest.Quote(url)+`).then(
+			() => console.log('resolved'),
+			(err) => console.log(err.name, err.message, err.cause.code));
+	`, "TypeError fetch failed ECONNREFUSED\n")
+}
+
+func TestFetchAbort(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	jstest.ExpectOutput(t, `
+		const controller = new AbortController();
+		fetch(`+jstest.Quote(srv.URL)+`, { signal: controller.signal }).then(
+			() => console.log('resolved'),
+			(err) => console.log(err.name, err === controller.signal.reason));
+		setTimeout(() => controller.abort(), 20);
+	`, "AbortError true\n")
+}
+
+func TestRequestAndResponse(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		(async () => {
+			const res = Response.json({ a: 1 }, { status: 201 });
+			console.log(res.status, res.headers.get('content-type'), await res.clone().text(), (await res.json()).a, res.bodyUsed);
+			try { await res.text(); } catch (e) { console.log(e.name); }
+			const req = new Request('http://h/p', { method: 'POST', body: 'body' });
+			console.log(req.method, req.url, req.headers.get('content-type'), await req.text());
+			console.log((await new Response(new Uint8Array([104, 105])).bytes()).length);
+			console.log(Response.redirect('http://x/', 301).headers.get('location'), Response.error().type);
+		})();
+	`, "201 application/json {\"a\":1} 1 true\nTypeError\n"+
+		"POST http://h/p text/plain;charset=UTF-8 body\n2\nhttp://x/ error\n")
+}
+
+func TestHeaders(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const h = new Headers({ 'B': '1', 'a': '2' });
+		h.append('b', '3');
+		h.append('Set-Cookie', 'x=1');
+		h.append('Set-Cookie', 'y=2');
+		console.log([...h].map(([k, v]) => k + '=' + v).join(' '));
+		console.log(h.get('B'), h.getSetCookie().length, h.has('c'));
+		h.delete('set-cookie');
+		console.log(h.has('Set-Cookie'));
+	`, "a=2 b=1, 3 set-cookie=x=1 set-cookie=y=2\n1, 3 2 false\nfalse\n")
+}
+
+func TestURL(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const u = new URL('../b?x=1#h', 'http://user:pw@example.com:8080/a/c');
+		console.log(u.href, u.origin, u.pathname, u.searchParams.get('x'));
+		u.searchParams.append('y', 'a b');
+		u.port = '80';
+		u.hash = '';
+		console.log(u.href, URL.canParse('nope'), URL.canParse('/p', 'http://h'));
+		try { new URL('nope'); } catch (e) { console.log(e instanceof TypeError, e.code); }
+		const p = new URLSearchParams({ b: '2', a: '1' });
+		p.append('a', '3');
+		p.sort();
+		console.log(p.toString(), p.getAll('a').join(), p.size, [...p.keys()].join());
+		const url = require('url');
+		console.log(url.fileURLToPath('file:///tmp/a%20b'), url.pathToFileURL('/tmp/a b').href);
+	`, "http://user:pw@example.com:8080/b?x=1#h http://example.com:8080 /b 1\n"+
+		"http://user:pw@example.com/b?x=1&y=a+b false true\n"+
+		"true ERR_INVALID_URL\n"+
+		"a=1&a=3&b=2 1,3 3 a,a,b\n"+
+		"/tmp/a b file:///tmp/a%20b\n")
+}
+
+func TestEventTargetAndAbortSignal(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const et = new EventTarget();
+		const order = [];
+		et.addEventListener('ping', (e) => order.push('fn ' + e.type + ' ' + (e.target === et)), { once: true });
+		et.addEventListener('ping', { handleEvent(e) { order.push('obj'); e.preventDefault(); } });
+		const ev = new Event('ping', { cancelable: true });
+		console.log(et.dispatchEvent(ev), ev.defaultPrevented);
+		et.dispatchEvent(new Event('ping'));
+		console.log(order.join(','));
+
+		const ac = new AbortController();
+		ac.signal.addEventListener('abort', () => console.log('abort event', ac.signal.reason.name));
+		ac.abort();
+		console.log(ac.signal.aborted);
+		try { ac.signal.throwIfAborted(); } catch (e) { console.log(e instanceof DOMException, e.name, e.code); }
+		const any = AbortSignal.any([new AbortController().signal, AbortSignal.abort('why')]);
+		console.log(any.aborted, any.reason);
+		AbortSignal.timeout(1).onabort = function () { console.log('timeout', this.reason.name); };
+		setTimeout(() => {}, 20);
+	`, "false true\nfn ping true,obj,obj\nabort event AbortError\ntrue\ntrue AbortError 20\ntrue why\ntimeout TimeoutError\n")
+}
+
+func TestReadableStream(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		(async () => {
+			const rs = new ReadableStream({ start(c) { c.enqueue('a'); c.enqueue('b'); c.close(); } });
+			const reader = rs.getReader();
+			const got = [];
+			for (let r = await reader.read(); !r.done; r = await reader.read()) got.push(r.value);
+			console.log(got.join(''), rs.locked);
+			reader.releaseLock();
+			console.log(rs.locked);
+
+			const values = [];
+			const it = ReadableStream.from([1, 2])[Symbol.asyncIterator]();
+			for (let r = await it.next(); !r.done; r = await it.next()) values.push(r.value);
+			console.log(values.join(','), require('stream/web').ReadableStream === ReadableStream);
+		})();
+	`, "ab true\nfalse\n1,2 true\n")
+}
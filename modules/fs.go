@@ -8,52 +8,41 @@ import (
 	"github.com/dop251/goja"
 )
 
-// SetupFS sets up the fs module
-func SetupFS(vm *goja.Runtime) error {
+// SetupFS sets up the fs module. Asynchronous operations are run on
+// goroutines and their results are delivered through loop.
+func SetupFS(vm *goja.Runtime, loop AsyncLoop) error {
 	fs := vm.NewObject()
 
 	// fs.readFileSync
 	fs.Set("readFileSync", func(call goja.FunctionCall) goja.Value {
-		if len(call.Arguments) < 1 {
-			panic(vm.ToValue("readFileSync requires a path argument"))
-		}
-
-		path := call.Arguments[0].String()
-		encoding := "utf8"
+		path := pathArg(vm, call.Arguments, 0, "path")
+		checkRead(vm, path)
+		encoding := encodingBuffer
 		if len(call.Arguments) > 1 {
-			if call.Arguments[1].ExportType().Kind().String() == "string" {
-				encoding = call.Arguments[1].String()
-			} else if obj := call.Arguments[1].ToObject(vm); obj != nil {
-				if enc := obj.Get("encoding"); enc != nil && !goja.IsUndefined(enc) {
-					encoding = enc.String()
-				}
-			}
+			encoding = parseEncoding(vm, call.Arguments[1], encoding)
 		}
 
 		data, err := ioutil.ReadFile(path)
 		if err != nil {
-			panic(vm.ToValue("Error reading file: " + err.Error()))
+			panic(NewSystemError(vm, err, "open", path))
 		}
 
-		if encoding == "utf8" || encoding == "utf-8" {
-			return vm.ToValue(string(data))
-		}
-		// Return buffer for binary data
-		return vm.ToValue(data)
+		return fileContent(vm, data, encoding)
 	})
 
 	// fs.writeFileSync
 	fs.Set("writeFileSync", func(call goja.FunctionCall) goja.Value {
-		if len(call.Arguments) < 2 {
-			panic(vm.ToValue("writeFileSync requires path and data arguments"))
+		path := pathArg(vm, call.Arguments, 0, "path")
+		checkWrite(vm, path)
+		var encoding goja.Value
+		if len(call.Arguments) > 2 {
+			encoding = call.Arguments[2]
 		}
+		data := fileData(vm, call.Argument(1), parseEncoding(vm, encoding, "utf8"))
 
-		path := call.Arguments[0].String()
-		data := call.Arguments[1].String()
-
-		err := ioutil.WriteFile(path, []byte(data), 0644)
+		err := ioutil.WriteFile(path, data, 0644)
 		if err != nil {
-			panic(vm.ToValue("Error writing file: " + err.Error()))
+			panic(NewSystemError(vm, err, "open", path))
 		}
 
 		return goja.Undefined()
@@ -65,18 +54,19 @@ func SetupFS(vm *goja.Runtime) error {
 			return vm.ToValue(false)
 		}
 
-		path := call.Arguments[0].String()
+		// Paths outside the read grants are reported as missing
+		path := pathArg(vm, call.Arguments, 0, "path")
+		if !canRead(vm, path) {
+			return vm.ToValue(false)
+		}
 		_, err := os.Stat(path)
 		return vm.ToValue(err == nil)
 	})
 
 	// fs.mkdirSync
 	fs.Set("mkdirSync", func(call goja.FunctionCall) goja.Value {
-		if len(call.Arguments) < 1 {
-			panic(vm.ToValue("mkdirSync requires a path argument"))
-		}
-
-		path := call.Arguments[0].String()
+		path := pathArg(vm, call.Arguments, 0, "path")
+		checkWrite(vm, path)
 		recursive := false
 
 		if len(call.Arguments) > 1 {
@@ -95,42 +85,32 @@ func SetupFS(vm *goja.Runtime) error {
 		}
 
 		if err != nil {
-			panic(vm.ToValue("Error creating directory: " + err.Error()))
+			panic(NewSystemError(vm, err, "mkdir", path))
 		}
 
 		return goja.Undefined()
 	})
 
-	// fs.readdirSync
+	// fs.readdirSync lists names, or fs.Dirent objects with {withFileTypes: true}
 	fs.Set("readdirSync", func(call goja.FunctionCall) goja.Value {
-		if len(call.Arguments) < 1 {
-			panic(vm.ToValue("readdirSync requires a path argument"))
-		}
-
-		path := call.Arguments[0].String()
-		files, err := ioutil.ReadDir(path)
+		path := pathArg(vm, call.Arguments, 0, "path")
+		checkRead(vm, path)
+		withFileTypes := optionBool(vm, call.Argument(1), "withFileTypes")
+		entries, err := os.ReadDir(path)
 		if err != nil {
-			panic(vm.ToValue("Error reading directory: " + err.Error()))
-		}
-
-		names := make([]string, len(files))
-		for i, file := range files {
-			names[i] = file.Name()
+			panic(NewSystemError(vm, err, "scandir", path))
 		}
 
-		return vm.ToValue(names)
+		return dirListing(vm, path, entries, withFileTypes)
 	})
 
 	// fs.unlinkSync (delete file)
 	fs.Set("unlinkSync", func(call goja.FunctionCall) goja.Value {
-		if len(call.Arguments) < 1 {
-			panic(vm.ToValue("unlinkSync requires a path argument"))
-		}
-
-		path := call.Arguments[0].String()
+		path := pathArg(vm, call.Arguments, 0, "path")
+		checkWrite(vm, path)
 		err := os.Remove(path)
 		if err != nil {
-			panic(vm.ToValue("Error removing file: " + err.Error()))
+			panic(NewSystemError(vm, err, "unlink", path))
 		}
 
 		return goja.Undefined()
@@ -138,34 +118,107 @@ func SetupFS(vm *goja.Runtime) error {
 
 	// fs.statSync
 	fs.Set("statSync", func(call goja.FunctionCall) goja.Value {
-		if len(call.Arguments) < 1 {
-			panic(vm.ToValue("statSync requires a path argument"))
-		}
-
-		path := call.Arguments[0].String()
+		path := pathArg(vm, call.Arguments, 0, "path")
+		checkRead(vm, path)
 		info, err := os.Stat(path)
 		if err != nil {
-			panic(vm.ToValue("Error getting file stats: " + err.Error()))
+			panic(NewSystemError(vm, err, "stat", path))
 		}
 
-		stat := vm.NewObject()
-		stat.Set("isFile", func(call goja.FunctionCall) goja.Value {
-			return vm.ToValue(!info.IsDir())
-		})
-		stat.Set("isDirectory", func(call goja.FunctionCall) goja.Value {
-			return vm.ToValue(info.IsDir())
-		})
-		stat.Set("size", info.Size())
-		stat.Set("mode", int(info.Mode()))
-		stat.Set("mtime", info.ModTime().Unix())
-
-		return stat
+		return newStatObject(vm, info)
 	})
 
+	// The rest of the synchronous API
+	setupFSSync(vm, fs)
+
+	// Asynchronous callback and promise variants
+	setupFSAsync(vm, loop, fs)
+
+	// File descriptors and the streams reading and writing through them
+	setupFSDescriptors(vm, fs)
+	if err := setupFSStreams(vm, loop, fs); err != nil {
+		return err
+	}
+
+	// Change notifications
+	if err := setupFSWatch(vm, loop, fs); err != nil {
+		return err
+	}
+
 	// Register fs module
 	return RegisterModule(vm, "fs", fs)
 }
 
+// encodingBuffer is the encoding parseEncoding returns for an explicit null
+// encoding, which reads files into a Buffer
+const encodingBuffer = "buffer"
+
+// parseEncoding extracts the encoding from a string or {encoding} options
+// argument. An encoding of null selects Buffers; unknown encodings throw.
+func parseEncoding(vm *goja.Runtime, arg goja.Value, defaultEncoding string) string {
+	if arg == nil || goja.IsUndefined(arg) {
+		return defaultEncoding
+	}
+	if goja.IsNull(arg) {
+		return encodingBuffer
+	}
+	encoding := arg
+	if _, ok := arg.Export().(string); !ok {
+		encoding = arg.ToObject(vm).Get("encoding")
+		if encoding == nil || goja.IsUndefined(encoding) {
+			return defaultEncoding
+		}
+	}
+	if goja.IsNull(encoding) || encoding.String() == encodingBuffer {
+		return encodingBuffer
+	}
+	name, ok := normalizeEncoding(encoding.String())
+	if !ok {
+		panic(NewNodeError(vm, "TypeError", "ERR_INVALID_ARG_VALUE",
+			fmt.Sprintf("The argument 'encoding' is invalid encoding. Received '%s'", encoding.String())))
+	}
+	return name
+}
+
+// fileContent converts raw file data to a JS value for the given encoding
+func fileContent(vm *goja.Runtime, data []byte, encoding string) goja.Value {
+	if encoding == encodingBuffer {
+		return NewBuffer(vm, data)
+	}
+	return vm.ToValue(decodeBytes(data, encoding))
+}
+
+// fileData converts the data argument of a write to bytes. Buffers,
+// TypedArrays, DataViews and ArrayBuffers are written as they are; anything
+// else but undefined is converted to a string and encoded. The bytes are a
+// copy, so the write is not affected by later changes to a Buffer.
+func fileData(vm *goja.Runtime, data goja.Value, encoding string) []byte {
+	if bin, ok := BufferBytes(vm, data); ok {
+		return append([]byte(nil), bin...)
+	}
+	if data == nil || goja.IsUndefined(data) {
+		panic(ErrInvalidArgType(vm, "data", "of type string or an instance of Buffer, TypedArray, or DataView", data))
+	}
+	if encoding == encodingBuffer {
+		encoding = encodingUTF8
+	}
+	return encodeString(data.String(), encoding)
+}
+
+// dirListing converts the entries of the directory dir to the names or
+// fs.Dirent objects readdir returns
+func dirListing(vm *goja.Runtime, dir string, entries []os.DirEntry, withFileTypes bool) goja.Value {
+	listing := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		if withFileTypes {
+			listing[i] = newDirent(vm, dir, entry)
+		} else {
+			listing[i] = entry.Name()
+		}
+	}
+	return vm.NewArray(listing...)
+}
+
 // RegisterModule registers a module in the require system
 func RegisterModule(vm *goja.Runtime, name string, module *goja.Object) error {
 	// Get the module cache
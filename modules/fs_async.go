@@ -0,0 +1,231 @@
+package modules
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/dop251/goja"
+)
+
+// AsyncLoop is the part of the event loop used by modules that perform
+// blocking work on goroutines
+type AsyncLoop interface {
+	RunOnLoop(fn func(*goja.Runtime))
+	// NextTick queues fn like process.nextTick. Only call it on the loop.
+	NextTick(fn func())
+	Ref()
+	Unref()
+	// AddCloser registers fn to release a host resource if the run is
+	// halted, returning a function that unregisters it
+	AddCloser(fn func()) func()
+}
+
+// fsResult converts the outcome of a background operation into a JS value.
+// It is always invoked on the loop goroutine.
+type fsResult func() goja.Value
+
+// fsOp performs blocking file system work off the loop goroutine
+type fsOp func() (fsResult, error)
+
+// fsOpBuilder validates JS arguments and prepares an fsOp
+type fsOpBuilder func(args []goja.Value) fsOp
+
+// runAsync executes op on a goroutine and hands the outcome to done on the loop
+func runAsync(loop AsyncLoop, op fsOp, done func(fsResult, error)) {
+	loop.Ref()
+	go func() {
+		defer loop.Unref()
+		result, err := op()
+		loop.RunOnLoop(func(*goja.Runtime) {
+			done(result, err)
+		})
+	}()
+}
+
+// setupFSAsync adds the callback API to fs and registers fs/promises
+func setupFSAsync(vm *goja.Runtime, loop AsyncLoop, fs *goja.Object) error {
+	ops := []struct {
+		name  string
+		build fsOpBuilder
+	}{
+		{"readFile", readFileOp(vm)},
+		{"writeFile", writeFileOp(vm)},
+		{"readdir", readdirOp(vm)},
+		{"stat", statOp(vm)},
+		{"mkdir", mkdirOp(vm)},
+		{"unlink", unlinkOp(vm)},
+	}
+
+	promises := vm.NewObject()
+	for _, op := range ops {
+		fs.Set(op.name, fsCallback(vm, loop, op.name, op.build))
+		promises.Set(op.name, fsPromise(vm, loop, op.build))
+	}
+
+	fs.Set("promises", promises)
+
+	return RegisterModule(vm, "fs/promises", promises)
+}
+
+// fsCallback wraps an operation in the Node-style (err, result) callback API
+func fsCallback(vm *goja.Runtime, loop AsyncLoop, name string, build fsOpBuilder) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		args := call.Arguments
+		var callback goja.Callable
+		ok := false
+		if len(args) > 0 {
+			callback, ok = goja.AssertFunction(args[len(args)-1])
+		}
+		if !ok {
+			panic(ErrInvalidArgType(vm, "cb", "of type function", argAt(args, len(args)-1)))
+		}
+
+		op := build(args[:len(args)-1])
+		runAsync(loop, op, func(result fsResult, err error) {
+			var cbErr error
+			if err != nil {
+				_, cbErr = callback(goja.Undefined(), jsError(vm, err))
+			} else if result != nil {
+				_, cbErr = callback(goja.Undefined(), goja.Null(), result())
+			} else {
+				_, cbErr = callback(goja.Undefined(), goja.Null())
+			}
+			if cbErr != nil {
+				panic(cbErr)
+			}
+		})
+
+		return goja.Undefined()
+	}
+}
+
+// fsPromise wraps an operation in a function returning a Promise
+func fsPromise(vm *goja.Runtime, loop AsyncLoop, build fsOpBuilder) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		promise, resolve, reject := vm.NewPromise()
+		// Invalid arguments and denied access reject the promise
+		var op fsOp
+		if ex := vm.Try(func() { op = build(call.Arguments) }); ex != nil {
+			reject(ex.Value())
+			return vm.ToValue(promise)
+		}
+
+		runAsync(loop, op, func(result fsResult, err error) {
+			if err != nil {
+				reject(jsError(vm, err))
+			} else if result != nil {
+				resolve(result())
+			} else {
+				resolve(goja.Undefined())
+			}
+		})
+
+		return vm.ToValue(promise)
+	}
+}
+
+func readFileOp(vm *goja.Runtime) fsOpBuilder {
+	return func(args []goja.Value) fsOp {
+		path := pathArg(vm, args, 0, "path")
+		checkRead(vm, path)
+		encoding := encodingBuffer
+		if len(args) > 1 {
+			encoding = parseEncoding(vm, args[1], encoding)
+		}
+
+		return func() (fsResult, error) {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, systemError(err, "open", path)
+			}
+			return func() goja.Value {
+				return fileContent(vm, data, encoding)
+			}, nil
+		}
+	}
+}
+
+func writeFileOp(vm *goja.Runtime) fsOpBuilder {
+	return func(args []goja.Value) fsOp {
+		path := pathArg(vm, args, 0, "path")
+		checkWrite(vm, path)
+		var encoding goja.Value
+		if len(args) > 2 {
+			encoding = args[2]
+		}
+		data := fileData(vm, argAt(args, 1), parseEncoding(vm, encoding, "utf8"))
+
+		return func() (fsResult, error) {
+			return nil, systemError(ioutil.WriteFile(path, data, 0644), "open", path)
+		}
+	}
+}
+
+func readdirOp(vm *goja.Runtime) fsOpBuilder {
+	return func(args []goja.Value) fsOp {
+		path := pathArg(vm, args, 0, "path")
+		checkRead(vm, path)
+		withFileTypes := len(args) > 1 && optionBool(vm, args[1], "withFileTypes")
+
+		return func() (fsResult, error) {
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return nil, systemError(err, "scandir", path)
+			}
+
+			return func() goja.Value {
+				return dirListing(vm, path, entries, withFileTypes)
+			}, nil
+		}
+	}
+}
+
+func statOp(vm *goja.Runtime) fsOpBuilder {
+	return func(args []goja.Value) fsOp {
+		path := pathArg(vm, args, 0, "path")
+		checkRead(vm, path)
+
+		return func() (fsResult, error) {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, systemError(err, "stat", path)
+			}
+			return func() goja.Value {
+				return newStatObject(vm, info)
+			}, nil
+		}
+	}
+}
+
+func mkdirOp(vm *goja.Runtime) fsOpBuilder {
+	return func(args []goja.Value) fsOp {
+		path := pathArg(vm, args, 0, "path")
+		checkWrite(vm, path)
+		recursive := false
+		if len(args) > 1 && !goja.IsUndefined(args[1]) && !goja.IsNull(args[1]) {
+			if obj := args[1].ToObject(vm); obj != nil {
+				if rec := obj.Get("recursive"); rec != nil && !goja.IsUndefined(rec) {
+					recursive = rec.ToBoolean()
+				}
+			}
+		}
+
+		return func() (fsResult, error) {
+			if recursive {
+				return nil, systemError(os.MkdirAll(path, 0755), "mkdir", path)
+			}
+			return nil, systemError(os.Mkdir(path, 0755), "mkdir", path)
+		}
+	}
+}
+
+func unlinkOp(vm *goja.Runtime) fsOpBuilder {
+	return func(args []goja.Value) fsOp {
+		path := pathArg(vm, args, 0, "path")
+		checkWrite(vm, path)
+
+		return func() (fsResult, error) {
+			return nil, systemError(os.Remove(path), "unlink", path)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package modules_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gojs/internal/jstest"
+)
+
+func TestFSCallbacksAndPromises(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	jstest.ExpectOutput(t, `
+		const fs = require('fs');
+		fs.writeFile(`+jstest.Quote(file)+`, 'hello', (err) => {
+			if (err) throw err;
+			fs.readFile(`+jstest.Quote(file)+`, 'utf8', (err, data) => {
+				console.log(err, data);
+				fs.promises.stat(`+jstest.Quote(file)+`).then((st) => console.log(st.size, st.isFile()));
+			});
+		});
+	`, "null hello\n5 true\n")
+
+	if data, err := os.ReadFile(file); err != nil || string(data) != "hello" {
+		t.Errorf("file = %q, %v", data, err)
+	}
+}
+
+func TestFSPromisesNamespace(t *testing.T) {
+	dir := t.TempDir()
+	jstest.ExpectOutput(t, `
+		const fs = require('fs');
+		const fsp = require('fs/promises');
+		console.log(fsp === fs.promises);
+		(async () => {
+			const sub = `+jstest.Quote(filepath.Join(dir, "a", "b"))+`;
+			await fsp.mkdir(sub, { recursive: true });
+			await fsp.writeFile(sub + '/one.txt', '1');
+			await fsp.writeFile(sub + '/two.txt', '2');
+			console.log(JSON.stringify((await fsp.readdir(sub)).sort()));
+			await fsp.unlink(sub + '/one.txt');
+			console.log(JSON.stringify(await fsp.readdir(sub)));
+		})();
+	`, "true\n[\"one.txt\",\"two.txt\"]\n[\"two.txt\"]\n")
+}
+
+func TestFSCallbacksRunOnTheLoop(t *testing.T) {
+	dir := t.TempDir()
+	jstest.ExpectOutput(t, `
+		const fs = require('fs');
+		fs.readdir(`+jstest.Quote(dir)+`, (err, names) => console.log('callback', err, names.length));
+		Promise.resolve().then(() => console.log('microtask'));
+		console.log('sync');
+	`, "sync\nmicrotask\ncallback null 0\n")
+}
+
+func TestFSAsyncErrors(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	jstest.ExpectOutput(t, `
+		const fs = require('fs');
+		fs.readFile(`+jstest.Quote(missing)+`, 'utf8', (err, data) => {
+			console.log(err instanceof Error, data);
+			fs.promises.unlink(`+jstest.Quote(missing)+`).catch((err) => console.log('rejected', err instanceof Error));
+		});
+	`, "true undefined\nrejected true\n")
+}
+
+func TestFSPromisesRejectInvalidArguments(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const fs = require('fs');
+		try {
+			fs.promises.readFile(123).catch((e) => console.log('rejected', e.code));
+		} catch (e) {
+			console.log('threw', e.code);
+		}
+	`, "rejected ERR_INVALID_ARG_TYPE\n")
+}
@@ -0,0 +1,307 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"syscall"
+
+	"github.com/dop251/goja"
+)
+
+// fileFlags maps the string flags of fs.openSync to open(2) flags
+var fileFlags = map[string]int{
+	"r":   os.O_RDONLY,
+	"rs":  os.O_RDONLY | os.O_SYNC,
+	"sr":  os.O_RDONLY | os.O_SYNC,
+	"r+":  os.O_RDWR,
+	"rs+": os.O_RDWR | os.O_SYNC,
+	"sr+": os.O_RDWR | os.O_SYNC,
+	"w":   os.O_TRUNC | os.O_CREATE | os.O_WRONLY,
+	"wx":  os.O_TRUNC | os.O_CREATE | os.O_WRONLY | os.O_EXCL,
+	"xw":  os.O_TRUNC | os.O_CREATE | os.O_WRONLY | os.O_EXCL,
+	"w+":  os.O_TRUNC | os.O_CREATE | os.O_RDWR,
+	"wx+": os.O_TRUNC | os.O_CREATE | os.O_RDWR | os.O_EXCL,
+	"xw+": os.O_TRUNC | os.O_CREATE | os.O_RDWR | os.O_EXCL,
+	"a":   os.O_APPEND | os.O_CREATE | os.O_WRONLY,
+	"ax":  os.O_APPEND | os.O_CREATE | os.O_WRONLY | os.O_EXCL,
+	"xa":  os.O_APPEND | os.O_CREATE | os.O_WRONLY | os.O_EXCL,
+	"as":  os.O_APPEND | os.O_CREATE | os.O_WRONLY | os.O_SYNC,
+	"sa":  os.O_APPEND | os.O_CREATE | os.O_WRONLY | os.O_SYNC,
+	"a+":  os.O_APPEND | os.O_CREATE | os.O_RDWR,
+	"ax+": os.O_APPEND | os.O_CREATE | os.O_RDWR | os.O_EXCL,
+	"xa+": os.O_APPEND | os.O_CREATE | os.O_RDWR | os.O_EXCL,
+	"as+": os.O_APPEND | os.O_CREATE | os.O_RDWR | os.O_SYNC,
+	"sa+": os.O_APPEND | os.O_CREATE | os.O_RDWR | os.O_SYNC,
+}
+
+// openFile is an entry of the fd table
+type openFile struct {
+	file  *os.File
+	flags int
+}
+
+// fdTable maps the file descriptors handed to scripts to the files this
+// runtime opened. Scripts can only use descriptors found in it.
+type fdTable struct {
+	files map[int]*openFile
+}
+
+// fdTableOf returns the fd table of vm, creating it on first use with the
+// standard streams as 0, 1 and 2
+func fdTableOf(vm *goja.Runtime) *fdTable {
+	if val := vm.GlobalObject().Get("__fdTable"); val != nil {
+		if t, ok := val.Export().(*fdTable); ok {
+			return t
+		}
+	}
+	t := &fdTable{files: map[int]*openFile{
+		0: {file: os.Stdin, flags: os.O_RDONLY},
+		1: {file: os.Stdout, flags: os.O_WRONLY},
+		2: {file: os.Stderr, flags: os.O_WRONLY},
+	}}
+	vm.GlobalObject().DefineDataProperty("__fdTable", vm.ToValue(t), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	return t
+}
+
+// add registers an opened file and returns its descriptor
+func (t *fdTable) add(file *os.File, flags int) int {
+	fd := int(file.Fd())
+	t.files[fd] = &openFile{file: file, flags: flags}
+	return fd
+}
+
+// get returns the file of the fd argument v, throwing EBADF for
+// descriptors this runtime did not open
+func (t *fdTable) get(vm *goja.Runtime, v goja.Value, call string) (int, *openFile) {
+	fd := fdArg(vm, v)
+	f, ok := t.files[fd]
+	if !ok {
+		panic(NewSystemError(vm, syscall.EBADF, call, ""))
+	}
+	return fd, f
+}
+
+// close closes fd and removes it from the table
+func (t *fdTable) close(fd int) error {
+	f, ok := t.files[fd]
+	if !ok {
+		return syscall.EBADF
+	}
+	delete(t.files, fd)
+	return f.file.Close()
+}
+
+// fdArg validates a file descriptor argument
+func fdArg(vm *goja.Runtime, v goja.Value) int {
+	if !isNumber(v) {
+		panic(ErrInvalidArgType(vm, "fd", "of type number", v))
+	}
+	f := v.ToFloat()
+	if f != math.Trunc(f) || f < 0 || f > math.MaxInt32 {
+		panic(errOutOfRange(vm, "fd", ">= 0 && <= 2147483647", v))
+	}
+	return int(f)
+}
+
+// parseFlags reads the flags of an open call, given as a string such as
+// "r+" or as a number. The default is "r".
+func parseFlags(vm *goja.Runtime, v goja.Value, defaultFlags string) int {
+	if isNullish(v) {
+		return fileFlags[defaultFlags]
+	}
+	if isNumber(v) {
+		return int(v.ToInteger())
+	}
+	flags, ok := fileFlags[v.String()]
+	if !ok {
+		panic(NewNodeError(vm, "TypeError", "ERR_INVALID_ARG_VALUE",
+			fmt.Sprintf("The argument 'flags' is invalid. Received '%s'", v.String())))
+	}
+	return flags
+}
+
+// checkOpen checks the permissions needed to open path with flags
+func checkOpen(vm *goja.Runtime, path string, flags int) {
+	if flags&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		checkWrite(vm, path)
+	}
+	if flags&os.O_WRONLY == 0 {
+		checkRead(vm, path)
+	}
+}
+
+// setupFSDescriptors adds the file descriptor API to fs
+func setupFSDescriptors(vm *goja.Runtime, fs *goja.Object) {
+	fds := fdTableOf(vm)
+
+	// fs.openSync(path[, flags[, mode]]) returns a file descriptor
+	fs.Set("openSync", func(call goja.FunctionCall) goja.Value {
+		path := pathArg(vm, call.Arguments, 0, "path")
+		flags := parseFlags(vm, call.Argument(1), "r")
+		checkOpen(vm, path, flags)
+		mode := uint64(0666)
+		if !isNullish(call.Argument(2)) {
+			mode = parseMode(vm, call.Argument(2))
+		}
+		file, err := os.OpenFile(path, flags, goFileMode(mode))
+		if err != nil {
+			panic(NewSystemError(vm, err, "open", path))
+		}
+
+		return vm.ToValue(fds.add(file, flags))
+	})
+
+	// fs.closeSync
+	fs.Set("closeSync", func(call goja.FunctionCall) goja.Value {
+		fd, _ := fds.get(vm, call.Argument(0), "close")
+		if err := fds.close(fd); err != nil {
+			panic(NewSystemError(vm, err, "close", ""))
+		}
+
+		return goja.Undefined()
+	})
+
+	// fs.readSync(fd, buffer[, offset[, length[, position]]]) or
+	// fs.readSync(fd, buffer, {offset, length, position}) reads into buffer
+	// and returns the number of bytes read, 0 at the end of the file
+	fs.Set("readSync", func(call goja.FunctionCall) goja.Value {
+		_, f := fds.get(vm, call.Argument(0), "read")
+		data, ok := BufferBytes(vm, call.Argument(1))
+		if !ok {
+			panic(ErrInvalidArgType(vm, "buffer", "an instance of Buffer, TypedArray, or DataView", call.Argument(1)))
+		}
+		data, position := ioRange(vm, data, call.Arguments[2:])
+
+		var n int
+		var err error
+		if position >= 0 {
+			n, err = f.file.ReadAt(data, position)
+		} else {
+			n, err = f.file.Read(data)
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			panic(NewSystemError(vm, err, "read", ""))
+		}
+
+		return vm.ToValue(n)
+	})
+
+	// fs.writeSync(fd, buffer[, offset[, length[, position]]]) or
+	// fs.writeSync(fd, string[, position[, encoding]]) returns the number
+	// of bytes written
+	fs.Set("writeSync", func(call goja.FunctionCall) goja.Value {
+		_, f := fds.get(vm, call.Argument(0), "write")
+
+		var data []byte
+		var position int64 = -1
+		if str, ok := call.Argument(1).Export().(string); ok {
+			data = encodeString(str, bufferOf(vm).encoding(call.Argument(3)))
+			position = positionArg(vm, call.Argument(2))
+		} else {
+			bin, ok := BufferBytes(vm, call.Argument(1))
+			if !ok {
+				panic(ErrInvalidArgType(vm, "buffer", "of type string or an instance of Buffer, TypedArray, or DataView", call.Argument(1)))
+			}
+			data, position = ioRange(vm, bin, call.Arguments[2:])
+		}
+
+		n, err := f.write(data, position)
+		if err != nil {
+			panic(NewSystemError(vm, err, "write", ""))
+		}
+
+		return vm.ToValue(n)
+	})
+
+	// fs.fstatSync
+	fs.Set("fstatSync", func(call goja.FunctionCall) goja.Value {
+		_, f := fds.get(vm, call.Argument(0), "fstat")
+		info, err := f.file.Stat()
+		if err != nil {
+			panic(NewSystemError(vm, err, "fstat", ""))
+		}
+
+		return newStatObject(vm, info)
+	})
+
+	// fs.ftruncateSync(fd[, len]) truncates or extends the file to len bytes
+	fs.Set("ftruncateSync", func(call goja.FunctionCall) goja.Value {
+		_, f := fds.get(vm, call.Argument(0), "ftruncate")
+		var size int64
+		if !isNullish(call.Argument(1)) {
+			size = call.Argument(1).ToInteger()
+		}
+		if err := f.file.Truncate(size); err != nil {
+			panic(NewSystemError(vm, err, "ftruncate", ""))
+		}
+
+		return goja.Undefined()
+	})
+}
+
+// write writes data at position, or at the current position if it is
+// negative. Files opened for appending always write at the end.
+func (f *openFile) write(data []byte, position int64) (int, error) {
+	if position >= 0 && f.flags&os.O_APPEND == 0 {
+		return f.file.WriteAt(data, position)
+	}
+	return f.file.Write(data)
+}
+
+// ioRange applies the offset, length and position arguments of readSync and
+// writeSync, given as numbers or as an options object, to data. A negative
+// position means the current file position.
+func ioRange(vm *goja.Runtime, data []byte, args []goja.Value) ([]byte, int64) {
+	offset, length, position := argAt(args, 0), argAt(args, 1), argAt(args, 2)
+	if opts, ok := offset.(*goja.Object); ok {
+		offset, length, position = opts.Get("offset"), opts.Get("length"), opts.Get("position")
+	}
+
+	start := 0
+	if !isNullish(offset) {
+		start = rangeArg(vm, offset, "offset", len(data))
+	}
+	count := len(data) - start
+	if !isNullish(length) {
+		count = rangeArg(vm, length, "length", len(data)-start)
+	}
+
+	return data[start : start+count], positionArg(vm, position)
+}
+
+// rangeArg validates an integer argument between 0 and max
+func rangeArg(vm *goja.Runtime, v goja.Value, name string, max int) int {
+	if !isNumber(v) {
+		panic(ErrInvalidArgType(vm, name, "of type number", v))
+	}
+	f := v.ToFloat()
+	if f != math.Trunc(f) || f < 0 || f > float64(max) {
+		panic(errOutOfRange(vm, name, fmt.Sprintf(">= 0 && <= %d", max), v))
+	}
+	return int(f)
+}
+
+// positionArg reads a file position; null, undefined and -1 mean the
+// current position and are returned as -1
+func positionArg(vm *goja.Runtime, v goja.Value) int64 {
+	if isNullish(v) {
+		return -1
+	}
+	if n, ok := v.Export().(int64); ok {
+		return n
+	}
+	if bigint, ok := v.Export().(interface{ Int64() int64 }); ok {
+		return bigint.Int64()
+	}
+	if !isNumber(v) {
+		panic(ErrInvalidArgType(vm, "position", "of type number or bigint", v))
+	}
+	f := v.ToFloat()
+	if f != math.Trunc(f) || f < -1 {
+		panic(errOutOfRange(vm, "position", "an integer >= -1", v))
+	}
+	return int64(f)
+}
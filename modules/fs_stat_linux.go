@@ -0,0 +1,43 @@
+//go:build linux
+
+package modules
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// statOf extracts the fields of fs.Stats from info. Linux does not report
+// the birth time through stat, so like libuv it falls back to ctime.
+func statOf(info os.FileInfo) fileStat {
+	sys, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return statFromFileInfo(info)
+	}
+	ctime := time.Unix(int64(sys.Ctim.Sec), int64(sys.Ctim.Nsec))
+	return fileStat{
+		dev:       uint64(sys.Dev),
+		ino:       uint64(sys.Ino),
+		mode:      uint64(sys.Mode),
+		nlink:     uint64(sys.Nlink),
+		uid:       uint64(sys.Uid),
+		gid:       uint64(sys.Gid),
+		rdev:      uint64(sys.Rdev),
+		size:      int64(sys.Size),
+		blksize:   int64(sys.Blksize),
+		blocks:    int64(sys.Blocks),
+		atime:     time.Unix(int64(sys.Atim.Sec), int64(sys.Atim.Nsec)),
+		mtime:     time.Unix(int64(sys.Mtim.Sec), int64(sys.Mtim.Nsec)),
+		ctime:     ctime,
+		birthtime: ctime,
+	}
+}
+
+// accessPath checks the R_OK, W_OK and X_OK bits of mode against path
+func accessPath(path string, mode uint32) error {
+	if err := syscall.Access(path, mode); err != nil {
+		return &os.PathError{Op: "access", Path: path, Err: err}
+	}
+	return nil
+}
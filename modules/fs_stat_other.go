@@ -0,0 +1,26 @@
+//go:build !linux
+
+package modules
+
+import (
+	"os"
+)
+
+// statOf extracts the fields of fs.Stats from info. Only the fields Go
+// reports on every platform are filled in.
+func statOf(info os.FileInfo) fileStat {
+	return statFromFileInfo(info)
+}
+
+// accessPath checks that path exists and, for W_OK, that it is writable by
+// someone
+func accessPath(path string, mode uint32) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if mode&accessWrite != 0 && info.Mode().Perm()&0222 == 0 {
+		return &os.PathError{Op: "access", Path: path, Err: os.ErrPermission}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package modules
+
+import (
+	"os"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// File type bits of a Unix mode, as found in Stats.mode
+const (
+	modeTypeMask   = 0170000
+	modeSocket     = 0140000
+	modeSymlink    = 0120000
+	modeRegular    = 0100000
+	modeBlockDev   = 0060000
+	modeDir        = 0040000
+	modeCharDev    = 0020000
+	modeNamedPipe  = 0010000
+	modeSetuid     = 0004000
+	modeSetgid     = 0002000
+	modeStickyBits = 0001000
+)
+
+// fileStat is the platform-independent result of a stat call
+type fileStat struct {
+	dev, ino, mode, nlink, uid, gid, rdev uint64
+	size, blksize, blocks                 int64
+	atime, mtime, ctime, birthtime        time.Time
+}
+
+// fsClasses holds the fs.Stats and fs.Dirent classes. Both keep the file
+// type under typeKey, which their is* methods read.
+type fsClasses struct {
+	statsCtor  *goja.Object
+	direntCtor *goja.Object
+	stats      *goja.Object
+	dirent     *goja.Object
+	typeKey    *goja.Symbol
+}
+
+// fsClassesOf returns the fs classes of vm, creating them on first use
+func fsClassesOf(vm *goja.Runtime) *fsClasses {
+	if val := vm.GlobalObject().Get("__fsClasses"); val != nil {
+		if c, ok := val.Export().(*fsClasses); ok {
+			return c
+		}
+	}
+	c := newFSClasses(vm)
+	vm.GlobalObject().DefineDataProperty("__fsClasses", vm.ToValue(c), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	return c
+}
+
+func newFSClasses(vm *goja.Runtime) *fsClasses {
+	c := &fsClasses{typeKey: goja.NewSymbol("type")}
+
+	// newClass creates a constructor with the is* type predicates on its
+	// prototype
+	newClass := func(name string) *goja.Object {
+		ctor := vm.ToValue(func(call goja.ConstructorCall) *goja.Object {
+			return nil
+		}).ToObject(vm)
+		ctor.DefineDataProperty("name", vm.ToValue(name), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+		proto := ctor.Get("prototype").ToObject(vm)
+
+		predicates := []struct {
+			method string
+			typ    uint64
+		}{
+			{"isFile", modeRegular},
+			{"isDirectory", modeDir},
+			{"isSymbolicLink", modeSymlink},
+			{"isBlockDevice", modeBlockDev},
+			{"isCharacterDevice", modeCharDev},
+			{"isFIFO", modeNamedPipe},
+			{"isSocket", modeSocket},
+		}
+		for _, p := range predicates {
+			typ := p.typ
+			proto.Set(p.method, func(call goja.FunctionCall) goja.Value {
+				mode, _ := call.This.ToObject(vm).GetSymbol(c.typeKey).Export().(int64)
+				return vm.ToValue(uint64(mode)&modeTypeMask == typ)
+			})
+		}
+		return ctor
+	}
+
+	c.statsCtor = newClass("Stats")
+	c.direntCtor = newClass("Dirent")
+	c.stats = c.statsCtor.Get("prototype").ToObject(vm)
+	c.dirent = c.direntCtor.Get("prototype").ToObject(vm)
+	return c
+}
+
+// setType stores the file type of mode on a Stats or Dirent object
+func (c *fsClasses) setType(vm *goja.Runtime, obj *goja.Object, mode uint64) {
+	obj.DefineDataPropertySymbol(c.typeKey, vm.ToValue(int64(mode&modeTypeMask)), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+}
+
+// newStatObject builds the fs.Stats object returned by statSync and friends
+func newStatObject(vm *goja.Runtime, info os.FileInfo) *goja.Object {
+	return statObject(vm, statOf(info))
+}
+
+// statObject builds an fs.Stats object from st
+func statObject(vm *goja.Runtime, st fileStat) *goja.Object {
+	c := fsClassesOf(vm)
+
+	stat := vm.NewObject()
+	stat.SetPrototype(c.stats)
+	c.setType(vm, stat, st.mode)
+
+	stat.Set("dev", st.dev)
+	stat.Set("mode", st.mode)
+	stat.Set("nlink", st.nlink)
+	stat.Set("uid", st.uid)
+	stat.Set("gid", st.gid)
+	stat.Set("rdev", st.rdev)
+	stat.Set("blksize", st.blksize)
+	stat.Set("ino", st.ino)
+	stat.Set("size", st.size)
+	stat.Set("blocks", st.blocks)
+
+	times := []struct {
+		name string
+		time time.Time
+	}{
+		{"atime", st.atime},
+		{"mtime", st.mtime},
+		{"ctime", st.ctime},
+		{"birthtime", st.birthtime},
+	}
+	for _, t := range times {
+		stat.Set(t.name+"Ms", float64(t.time.UnixNano())/float64(time.Millisecond))
+	}
+	dateCtor := vm.Get("Date")
+	for _, t := range times {
+		date, err := vm.New(dateCtor, vm.ToValue(t.time.UnixNano()/int64(time.Millisecond)))
+		if err != nil {
+			panic(err)
+		}
+		stat.Set(t.name, date)
+	}
+
+	return stat
+}
+
+// newDirent builds an fs.Dirent for the directory entry name in dir
+func newDirent(vm *goja.Runtime, dir string, entry os.DirEntry) *goja.Object {
+	c := fsClassesOf(vm)
+	dirent := vm.NewObject()
+	dirent.SetPrototype(c.dirent)
+	c.setType(vm, dirent, unixMode(entry.Type()))
+	dirent.Set("name", entry.Name())
+	dirent.Set("parentPath", dir)
+	dirent.Set("path", dir)
+	return dirent
+}
+
+// unixMode converts a Go file mode to the st_mode bits of Unix
+func unixMode(mode os.FileMode) uint64 {
+	bits := uint64(mode.Perm())
+	switch {
+	case mode&os.ModeDir != 0:
+		bits |= modeDir
+	case mode&os.ModeSymlink != 0:
+		bits |= modeSymlink
+	case mode&os.ModeNamedPipe != 0:
+		bits |= modeNamedPipe
+	case mode&os.ModeSocket != 0:
+		bits |= modeSocket
+	case mode&os.ModeCharDevice != 0:
+		bits |= modeCharDev
+	case mode&os.ModeDevice != 0:
+		bits |= modeBlockDev
+	default:
+		bits |= modeRegular
+	}
+	if mode&os.ModeSetuid != 0 {
+		bits |= modeSetuid
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= modeSetgid
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= modeStickyBits
+	}
+	return bits
+}
+
+// goFileMode converts the permission bits of a Unix mode to a Go file mode
+func goFileMode(mode uint64) os.FileMode {
+	perm := os.FileMode(mode & 0777)
+	if mode&modeSetuid != 0 {
+		perm |= os.ModeSetuid
+	}
+	if mode&modeSetgid != 0 {
+		perm |= os.ModeSetgid
+	}
+	if mode&modeStickyBits != 0 {
+		perm |= os.ModeSticky
+	}
+	return perm
+}
+
+// statFromFileInfo fills in the fields of a stat result that os.FileInfo
+// carries on every platform
+func statFromFileInfo(info os.FileInfo) fileStat {
+	return fileStat{
+		mode:      unixMode(info.Mode()),
+		nlink:     1,
+		size:      info.Size(),
+		blksize:   4096,
+		blocks:    (info.Size() + 511) / 512,
+		atime:     info.ModTime(),
+		mtime:     info.ModTime(),
+		ctime:     info.ModTime(),
+		birthtime: info.ModTime(),
+	}
+}
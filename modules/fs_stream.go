@@ -0,0 +1,376 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/dop251/goja"
+)
+
+// Default high water mark of fs.ReadStream, which reads in larger chunks
+// than other streams
+const fileReadHighWaterMark = 64 * 1024
+
+// fileStream is the state of an fs.ReadStream or fs.WriteStream
+type fileStream struct {
+	path  string
+	flags int
+	mode  os.FileMode
+	fd    int
+	file  *openFile
+
+	// pos is where the next read or write happens, -1 for the current
+	// file position. end is the last byte a ReadStream reads, -1 for EOF.
+	pos   int64
+	end   int64
+	bytes int64
+
+	autoClose bool
+
+	// busy is set while I/O runs on a goroutine; closing waits for it
+	busy      bool
+	afterBusy func()
+}
+
+// setupFSStreams adds fs.ReadStream, fs.WriteStream, createReadStream and
+// createWriteStream. The streams read and write on goroutines and resume on
+// loop.
+func setupFSStreams(vm *goja.Runtime, loop AsyncLoop, fs *goja.Object) error {
+	c := streamsOf(vm)
+	if c == nil {
+		return errors.New("streams not initialized - call SetupStream first")
+	}
+	fds := fdTableOf(vm)
+	fileKey := goja.NewSymbol("fileStream")
+
+	fileOf := func(this goja.Value) (*streamState, *fileStream) {
+		s := c.state(this)
+		f, ok := exportSymbol(s.obj, fileKey).(*fileStream)
+		if !ok {
+			panic(NewNodeError(vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be a file stream"))
+		}
+		return s, f
+	}
+
+	// newFileStream parses the arguments shared by both stream types and
+	// returns the options for the underlying stream
+	newFileStream := func(this *goja.Object, args []goja.Value, defaultFlags string, write bool) (*fileStream, *goja.Object) {
+		opts := vm.NewObject()
+		switch options := argAt(args, 1).(type) {
+		case *goja.Object:
+			opts = options
+		default:
+			if !isNullish(options) {
+				opts.Set("encoding", options)
+			}
+		}
+
+		f := &fileStream{fd: -1, pos: -1, end: -1, mode: 0666, autoClose: true}
+		f.flags = parseFlags(vm, opts.Get("flags"), defaultFlags)
+		if mode := opts.Get("mode"); !isNullish(mode) {
+			f.mode = goFileMode(parseMode(vm, mode))
+		}
+		if v := opts.Get("autoClose"); v != nil && !goja.IsUndefined(v) {
+			f.autoClose = v.ToBoolean()
+		}
+
+		if fd := opts.Get("fd"); !isNullish(fd) {
+			f.fd, f.file = fds.get(vm, fd, "open")
+			this.Set("path", goja.Undefined())
+			this.Set("fd", f.fd)
+		} else {
+			f.path = pathArg(vm, args, 0, "path")
+			if write {
+				checkOpen(vm, f.path, f.flags|os.O_WRONLY)
+			} else {
+				checkOpen(vm, f.path, f.flags)
+			}
+			this.Set("path", f.path)
+			this.Set("fd", goja.Null())
+		}
+
+		if start := opts.Get("start"); !isNullish(start) {
+			f.pos = int64(rangeArg(vm, start, "start", math.MaxInt32))
+			this.Set("start", f.pos)
+		}
+		if flags := opts.Get("flags"); !isNullish(flags) {
+			this.Set("flags", flags)
+		} else {
+			this.Set("flags", defaultFlags)
+		}
+		this.Set("mode", uint64(f.mode.Perm()))
+
+		// autoClose decides whether the stream is destroyed, and the file
+		// closed, once it has ended or finished
+		streamOpts := vm.NewObject()
+		for _, name := range []string{"highWaterMark", "encoding", "emitClose"} {
+			if v := opts.Get(name); v != nil {
+				streamOpts.Set(name, v)
+			}
+		}
+		streamOpts.Set("autoDestroy", f.autoClose)
+		this.Set("autoClose", f.autoClose)
+		this.DefineDataPropertySymbol(fileKey, vm.ToValue(f), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+		return f, streamOpts
+	}
+
+	// open opens the file of a stream on a goroutine unless it was created
+	// from an fd
+	open := func(call goja.FunctionCall) goja.Value {
+		s, f := fileOf(call.This)
+		cb, _ := goja.AssertFunction(call.Argument(0))
+		done := func(err goja.Value) {
+			if _, e := cb(goja.Undefined(), err); e != nil {
+				panic(e)
+			}
+		}
+		if f.file != nil {
+			done(goja.Undefined())
+			return goja.Undefined()
+		}
+
+		var file *os.File
+		runAsync(loop, func() (fsResult, error) {
+			var err error
+			file, err = os.OpenFile(f.path, f.flags, f.mode)
+			return nil, systemError(err, "open", f.path)
+		}, func(_ fsResult, err error) {
+			if err != nil {
+				done(jsError(vm, err))
+				return
+			}
+			f.fd = fds.add(file, f.flags)
+			f.file = fds.files[f.fd]
+			s.obj.Set("fd", f.fd)
+			done(goja.Undefined())
+			s.emit("open", vm.ToValue(f.fd))
+			s.emit("ready")
+		})
+		return goja.Undefined()
+	}
+
+	// closeFile closes the file of a destroyed stream if autoClose is on,
+	// waiting for I/O in progress
+	closeFile := func(call goja.FunctionCall) goja.Value {
+		s, f := fileOf(call.This)
+		err := call.Argument(0)
+		cb, _ := goja.AssertFunction(call.Argument(1))
+		done := func(err goja.Value) {
+			if _, e := cb(goja.Undefined(), err); e != nil {
+				panic(e)
+			}
+		}
+
+		closeNow := func() {
+			if f.file == nil || !f.autoClose {
+				done(err)
+				return
+			}
+			fd := f.fd
+			file := fds.files[fd]
+			delete(fds.files, fd)
+			f.file = nil
+			runAsync(loop, func() (fsResult, error) {
+				if file == nil {
+					return nil, nil
+				}
+				return nil, systemError(file.file.Close(), "close", "")
+			}, func(_ fsResult, closeErr error) {
+				s.obj.Set("fd", goja.Null())
+				if closeErr != nil && isNullish(err) {
+					err = jsError(vm, closeErr)
+				}
+				done(err)
+			})
+		}
+		if f.busy {
+			f.afterBusy = closeNow
+		} else {
+			closeNow()
+		}
+		return goja.Undefined()
+	}
+
+	// runIO runs op on a goroutine, then done on the loop, keeping the stream
+	// busy in between
+	runIO := func(f *fileStream, op func() error, done func(err error)) {
+		f.busy = true
+		runAsync(loop, func() (fsResult, error) {
+			return nil, op()
+		}, func(_ fsResult, err error) {
+			f.busy = false
+			if f.afterBusy != nil {
+				after := f.afterBusy
+				f.afterBusy = nil
+				defer after()
+			}
+			done(err)
+		})
+	}
+
+	// fs.ReadStream(path[, options]) reads a file in chunks of
+	// highWaterMark bytes, from options.start to options.end inclusive
+	readStream, readProto := c.newClass("ReadStream", c.readable, func(this *goja.Object, args []goja.Value) {
+		f, opts := newFileStream(this, args, "r", false)
+		if isNullish(opts.Get("highWaterMark")) {
+			opts.Set("highWaterMark", fileReadHighWaterMark)
+		}
+		if o, ok := argAt(args, 1).(*goja.Object); ok && !isNullish(o.Get("end")) {
+			f.end = int64(rangeArg(vm, o.Get("end"), "end", math.MaxInt32))
+			if f.pos > f.end {
+				panic(errOutOfRange(vm, "start", fmt.Sprintf("<= \"end\" (here: %d)", f.end), vm.ToValue(f.pos)))
+			}
+			this.Set("end", f.end)
+		}
+		this.Set("bytesRead", 0)
+
+		s := c.newState(this, opts)
+		s.r = newReadableState(vm, opts, "readable")
+		s.construct()
+	})
+
+	readProto.Set("_construct", open)
+	readProto.Set("_destroy", closeFile)
+	readProto.Set("_read", func(call goja.FunctionCall) goja.Value {
+		s, f := fileOf(call.This)
+		n := int64(call.Argument(0).ToInteger())
+		if f.end >= 0 {
+			next := f.bytes
+			if f.pos >= 0 {
+				next = f.pos
+			}
+			if remaining := f.end - next + 1; remaining < n {
+				n = remaining
+			}
+		}
+		if n <= 0 || f.file == nil {
+			s.push(goja.Null(), goja.Undefined(), false)
+			return goja.Undefined()
+		}
+
+		buf := make([]byte, n)
+		var read int
+		file, pos := f.file.file, f.pos
+		runIO(f, func() error {
+			var err error
+			if pos >= 0 {
+				read, err = file.ReadAt(buf, pos)
+			} else {
+				read, err = file.Read(buf)
+			}
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return systemError(err, "read", "")
+		}, func(err error) {
+			if err != nil {
+				s.errorOrDestroy(jsError(vm, err))
+				return
+			}
+			if read == 0 {
+				s.push(goja.Null(), goja.Undefined(), false)
+				return
+			}
+			if f.pos >= 0 {
+				f.pos += int64(read)
+			}
+			f.bytes += int64(read)
+			s.obj.Set("bytesRead", f.bytes)
+			s.push(NewBuffer(vm, buf[:read]), goja.Undefined(), false)
+		})
+		return goja.Undefined()
+	})
+	readProto.Set("close", func(call goja.FunctionCall) goja.Value {
+		s, _ := fileOf(call.This)
+		cb, _ := goja.AssertFunction(call.Argument(0))
+		s.destroy(goja.Undefined(), cb)
+		return goja.Undefined()
+	})
+	c.getter(readProto, "pending", func(s *streamState) interface{} {
+		return goja.IsNull(s.obj.Get("fd"))
+	})
+
+	// fs.WriteStream(path[, options]) writes to a file, from options.start
+	// if given
+	writeStream, writeProto := c.newClass("WriteStream", c.writable, func(this *goja.Object, args []goja.Value) {
+		_, opts := newFileStream(this, args, "w", true)
+		this.Set("bytesWritten", 0)
+
+		s := c.newState(this, opts)
+		s.w = newWritableState(vm, opts, "writable")
+		s.construct()
+	})
+
+	writeProto.Set("_construct", open)
+	writeProto.Set("_destroy", closeFile)
+	writeProto.Set("_write", func(call goja.FunctionCall) goja.Value {
+		s, f := fileOf(call.This)
+		cb, _ := goja.AssertFunction(call.Argument(2))
+		data, _ := BufferBytes(vm, call.Argument(0))
+		data = append([]byte(nil), data...)
+
+		var written int
+		file, pos := f.file, f.pos
+		runIO(f, func() error {
+			var err error
+			written, err = file.write(data, pos)
+			return systemError(err, "write", "")
+		}, func(err error) {
+			if f.pos >= 0 {
+				f.pos += int64(written)
+			}
+			f.bytes += int64(written)
+			s.obj.Set("bytesWritten", f.bytes)
+			var errValue goja.Value = goja.Undefined()
+			if err != nil {
+				errValue = jsError(vm, err)
+			}
+			if _, e := cb(goja.Undefined(), errValue); e != nil {
+				panic(e)
+			}
+		})
+		return goja.Undefined()
+	})
+	// close ends the stream and calls cb once the file is closed
+	writeProto.Set("close", func(call goja.FunctionCall) goja.Value {
+		s, f := fileOf(call.This)
+		if cb, ok := goja.AssertFunction(call.Argument(0)); ok {
+			s.whenClosed(cb)
+		}
+		if !f.autoClose {
+			s.call("once", vm.ToValue("finish"), s.obj.Get("destroy"))
+		}
+		s.end(goja.Undefined(), goja.Undefined(), goja.Undefined())
+		return goja.Undefined()
+	})
+	writeProto.Set("destroySoon", writeProto.Get("end"))
+	c.getter(writeProto, "pending", func(s *streamState) interface{} {
+		return goja.IsNull(s.obj.Get("fd"))
+	})
+
+	fs.Set("ReadStream", readStream)
+	fs.Set("WriteStream", writeStream)
+
+	// fs.createReadStream(path[, options])
+	fs.Set("createReadStream", func(call goja.FunctionCall) goja.Value {
+		stream, err := vm.New(readStream, call.Arguments...)
+		if err != nil {
+			panic(err)
+		}
+		return stream
+	})
+
+	// fs.createWriteStream(path[, options])
+	fs.Set("createWriteStream", func(call goja.FunctionCall) goja.Value {
+		stream, err := vm.New(writeStream, call.Arguments...)
+		if err != nil {
+			panic(err)
+		}
+		return stream
+	})
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package modules_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gojs/internal/jstest"
+)
+
+func TestFSFileDescriptors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "fd.txt")
+	jstest.ExpectOutput(t, `
+		const fs = require('fs');
+		const file = `+jstest.Quote(file)+`;
+		let fd = fs.openSync(file, 'w');
+		console.log(fs.writeSync(fd, 'hello world'), fs.writeSync(fd, Buffer.from('!'), 0, 1, 0));
+		fs.closeSync(fd);
+
+		fd = fs.openSync(file, 'r+');
+		const buf = Buffer.alloc(4);
+		console.log(fs.readSync(fd, buf, 0, 4, 6), buf.toString());
+		console.log(fs.readSync(fd, buf, 0, 4, null), buf.toString());
+		fs.ftruncateSync(fd, 5);
+		console.log(fs.fstatSync(fd).size, fs.readSync(fd, buf, 0, 4, 10));
+		fs.closeSync(fd);
+
+		try { fs.closeSync(fd); } catch (e) { console.log(e.code); }
+		try { fs.readSync(1234, buf); } catch (e) { console.log(e.code); }
+		try { fs.openSync(file, 'wx'); } catch (e) { console.log(e.code); }
+	`, "11 1\n4 worl\n4 !ell\n5 0\nEBADF\nEBADF\nEEXIST\n")
+}
+
+func TestFSReadStream(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "in.txt")
+	if err := os.WriteFile(file, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jstest.ExpectOutput(t, `
+		const fs = require('fs');
+		const events = [];
+		const chunks = [];
+		const rs = fs.createReadStream(`+jstest.Quote(file)+`, { highWaterMark: 3, start: 1, end: 7, encoding: 'utf8' });
+		console.log(rs instanceof fs.ReadStream, rs instanceof require('stream').Readable);
+		rs.on('open', (fd) => events.push('open ' + typeof fd));
+		rs.on('ready', () => events.push('ready'));
+		rs.on('data', (chunk) => chunks.push(chunk));
+		rs.on('end', () => events.push('end'));
+		rs.on('close', () => console.log(events.join(','), chunks.join('|')));
+	`, "true true\nopen number,ready,end 123|456|7\n")
+}
+
+func TestFSWriteStream(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.txt")
+	data := strings.Repeat("x", 100000)
+	if err := os.WriteFile(src, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jstest.ExpectOutput(t, `
+		const fs = require('fs');
+		const dir = `+jstest.Quote(dir)+`;
+		const ws = fs.createWriteStream(dir + '/small.txt', { highWaterMark: 4 });
+		console.log(ws instanceof fs.WriteStream, ws.write('abcdef'));
+		ws.on('drain', () => ws.end('gh'));
+		ws.on('finish', () => {
+			fs.createWriteStream(dir + '/small.txt', { flags: 'a' }).end('!', () => {
+				console.log(fs.readFileSync(dir + '/small.txt', 'utf8'));
+				fs.createReadStream(dir + '/src.txt')
+					.pipe(fs.createWriteStream(dir + '/copy.txt'))
+					.on('finish', () => console.log('copied'));
+			});
+		});
+	`, "true false\nabcdefgh!\ncopied\n")
+
+	if copied, err := os.ReadFile(filepath.Join(dir, "copy.txt")); err != nil || string(copied) != data {
+		t.Errorf("copy has %d bytes, %v", len(copied), err)
+	}
+}
+
+func TestFSReadStreamErrors(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	jstest.ExpectOutput(t, `
+		const rs = require('fs').createReadStream(`+jstest.Quote(missing)+`);
+		rs.on('error', (e) => console.log('error', e.code));
+		rs.on('close', () => console.log('close'));
+	`, "error ENOENT\nclose\n")
+}
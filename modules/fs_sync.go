@@ -0,0 +1,471 @@
+package modules
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// Modes of fs.accessSync
+const (
+	accessExists  = 0
+	accessExecute = 1
+	accessWrite   = 2
+	accessRead    = 4
+)
+
+// copyFileExcl is the fs.copyFileSync mode that fails if the destination exists
+const copyFileExcl = 1
+
+// setupFSSync adds the synchronous file and directory operations beyond
+// reading, writing and listing, along with fs.Stats, fs.Dirent and fs.constants
+func setupFSSync(vm *goja.Runtime, fs *goja.Object) {
+	classes := fsClassesOf(vm)
+	fs.Set("Stats", classes.statsCtor)
+	fs.Set("Dirent", classes.direntCtor)
+	setupFSConstants(vm, fs)
+
+	// fs.lstatSync describes a symbolic link itself rather than its target
+	fs.Set("lstatSync", func(call goja.FunctionCall) goja.Value {
+		path := pathArg(vm, call.Arguments, 0, "path")
+		checkRead(vm, path)
+		info, err := os.Lstat(path)
+		if err != nil {
+			panic(NewSystemError(vm, err, "lstat", path))
+		}
+
+		return newStatObject(vm, info)
+	})
+
+	// fs.renameSync
+	fs.Set("renameSync", func(call goja.FunctionCall) goja.Value {
+		oldPath := pathArg(vm, call.Arguments, 0, "oldPath")
+		newPath := pathArg(vm, call.Arguments, 1, "newPath")
+		checkWrite(vm, oldPath)
+		checkWrite(vm, newPath)
+		if err := os.Rename(oldPath, newPath); err != nil {
+			panic(NewSystemError(vm, err, "rename", oldPath, newPath))
+		}
+
+		return goja.Undefined()
+	})
+
+	// fs.rmSync removes files, and directories with {recursive: true}.
+	// {force: true} ignores paths that do not exist.
+	fs.Set("rmSync", func(call goja.FunctionCall) goja.Value {
+		path := pathArg(vm, call.Arguments, 0, "path")
+		checkWrite(vm, path)
+		recursive := optionBool(vm, call.Argument(1), "recursive")
+		force := optionBool(vm, call.Argument(1), "force")
+
+		info, err := os.Lstat(path)
+		if err != nil {
+			if force && os.IsNotExist(err) {
+				return goja.Undefined()
+			}
+			panic(NewSystemError(vm, err, "lstat", path))
+		}
+		if info.IsDir() && !recursive {
+			panic(jsError(vm, &nodeError{
+				code:    "ERR_FS_EISDIR",
+				message: "Path is a directory: rm returned EISDIR (is a directory) " + path,
+				errno:   syscall.EISDIR,
+				syscall: "rm",
+				path:    path,
+			}))
+		}
+
+		if recursive {
+			err = os.RemoveAll(path)
+		} else {
+			err = os.Remove(path)
+		}
+		if err != nil {
+			panic(NewSystemError(vm, err, "rm", path))
+		}
+
+		return goja.Undefined()
+	})
+
+	// fs.copyFileSync(src, dest[, mode]) copies a file with its permissions
+	fs.Set("copyFileSync", func(call goja.FunctionCall) goja.Value {
+		src := pathArg(vm, call.Arguments, 0, "src")
+		dest := pathArg(vm, call.Arguments, 1, "dest")
+		checkRead(vm, src)
+		checkWrite(vm, dest)
+		excl := call.Argument(2).ToInteger()&copyFileExcl != 0
+		if err := copyFile(src, dest, excl); err != nil {
+			panic(NewSystemError(vm, err, "copyfile", src, dest))
+		}
+
+		return goja.Undefined()
+	})
+
+	// fs.cpSync(src, dest[, {recursive, force, errorOnExist}]) copies files
+	// and directory trees. Symbolic links are copied as links.
+	fs.Set("cpSync", func(call goja.FunctionCall) goja.Value {
+		src := pathArg(vm, call.Arguments, 0, "src")
+		dest := pathArg(vm, call.Arguments, 1, "dest")
+		checkRead(vm, src)
+		checkWrite(vm, dest)
+
+		opts := copyOptions{
+			recursive:    optionBool(vm, call.Argument(2), "recursive"),
+			force:        true,
+			errorOnExist: optionBool(vm, call.Argument(2), "errorOnExist"),
+		}
+		if options, ok := call.Argument(2).(*goja.Object); ok {
+			if force := options.Get("force"); force != nil && !goja.IsUndefined(force) {
+				opts.force = force.ToBoolean()
+			}
+		}
+
+		absSrc, _ := filepath.Abs(src)
+		absDest, _ := filepath.Abs(dest)
+		if absSrc == absDest {
+			panic(jsError(vm, cpError("ERR_FS_CP_EINVAL", "Invalid src or dest",
+				syscall.EINVAL, "src and dest cannot be the same", dest)))
+		}
+		if strings.HasPrefix(absDest, absSrc+string(filepath.Separator)) {
+			panic(jsError(vm, cpError("ERR_FS_CP_EINVAL", "Invalid src or dest", syscall.EINVAL,
+				fmt.Sprintf("cannot copy %s to a subdirectory of self %s", src, dest), dest)))
+		}
+		if err := copyTree(src, dest, opts); err != nil {
+			panic(jsError(vm, err))
+		}
+
+		return goja.Undefined()
+	})
+
+	// fs.appendFileSync creates the file if it does not exist
+	fs.Set("appendFileSync", func(call goja.FunctionCall) goja.Value {
+		path := pathArg(vm, call.Arguments, 0, "path")
+		checkWrite(vm, path)
+		data := fileData(vm, call.Argument(1), parseEncoding(vm, call.Argument(2), "utf8"))
+
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err == nil {
+			_, err = f.Write(data)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			panic(NewSystemError(vm, err, "open", path))
+		}
+
+		return goja.Undefined()
+	})
+
+	// fs.symlinkSync(target, path). The type argument only matters on
+	// Windows and is ignored. Writes through the link reach the target, so
+	// it must be writable as well.
+	fs.Set("symlinkSync", func(call goja.FunctionCall) goja.Value {
+		target := pathArg(vm, call.Arguments, 0, "target")
+		path := pathArg(vm, call.Arguments, 1, "path")
+		checkWrite(vm, path)
+		if filepath.IsAbs(target) {
+			checkWrite(vm, target)
+		} else {
+			checkWrite(vm, filepath.Join(filepath.Dir(path), target))
+		}
+		if err := os.Symlink(target, path); err != nil {
+			panic(NewSystemError(vm, err, "symlink", target, path))
+		}
+
+		return goja.Undefined()
+	})
+
+	// fs.readlinkSync
+	fs.Set("readlinkSync", func(call goja.FunctionCall) goja.Value {
+		path := pathArg(vm, call.Arguments, 0, "path")
+		checkRead(vm, path)
+		encoding := parseEncoding(vm, call.Argument(1), "utf8")
+		target, err := os.Readlink(path)
+		if err != nil {
+			panic(NewSystemError(vm, err, "readlink", path))
+		}
+
+		return fileContent(vm, []byte(target), encoding)
+	})
+
+	// fs.realpathSync resolves a path to an absolute path without symlinks
+	realpath := vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		path := pathArg(vm, call.Arguments, 0, "path")
+		checkRead(vm, path)
+		encoding := parseEncoding(vm, call.Argument(1), "utf8")
+		abs, err := filepath.Abs(path)
+		if err == nil {
+			abs, err = filepath.EvalSymlinks(abs)
+		}
+		if err != nil {
+			panic(NewSystemError(vm, err, "realpath", path))
+		}
+
+		return fileContent(vm, []byte(abs), encoding)
+	}).ToObject(vm)
+	realpath.Set("native", realpath)
+	fs.Set("realpathSync", realpath)
+
+	// fs.chmodSync(path, mode) takes a number or an octal string
+	fs.Set("chmodSync", func(call goja.FunctionCall) goja.Value {
+		path := pathArg(vm, call.Arguments, 0, "path")
+		checkWrite(vm, path)
+		if err := os.Chmod(path, goFileMode(parseMode(vm, call.Argument(1)))); err != nil {
+			panic(NewSystemError(vm, err, "chmod", path))
+		}
+
+		return goja.Undefined()
+	})
+
+	// fs.utimesSync(path, atime, mtime) takes Dates or seconds since the epoch
+	fs.Set("utimesSync", func(call goja.FunctionCall) goja.Value {
+		path := pathArg(vm, call.Arguments, 0, "path")
+		checkWrite(vm, path)
+		atime := parseTime(vm, call.Argument(1))
+		mtime := parseTime(vm, call.Argument(2))
+		if err := os.Chtimes(path, atime, mtime); err != nil {
+			panic(NewSystemError(vm, err, "utime", path))
+		}
+
+		return goja.Undefined()
+	})
+
+	// fs.mkdtempSync(prefix) creates a directory named prefix followed by
+	// random characters and returns its path
+	fs.Set("mkdtempSync", func(call goja.FunctionCall) goja.Value {
+		prefix := pathArg(vm, call.Arguments, 0, "prefix")
+		checkWrite(vm, prefix)
+		encoding := parseEncoding(vm, call.Argument(1), "utf8")
+		// A bare prefix is relative to the working directory, not the
+		// system's temporary directory
+		dir, pattern := filepath.Split(prefix)
+		bare := dir == ""
+		if bare {
+			dir = "."
+		}
+		path, err := os.MkdirTemp(dir, pattern+"*")
+		if bare {
+			path = filepath.Base(path)
+		}
+		if err != nil {
+			panic(NewSystemError(vm, err, "mkdtemp", prefix+"XXXXXX"))
+		}
+
+		return fileContent(vm, []byte(path), encoding)
+	})
+
+	// fs.accessSync(path[, mode]) throws unless the file exists and allows
+	// the access in mode, a combination of fs.constants.R_OK, W_OK and X_OK
+	fs.Set("accessSync", func(call goja.FunctionCall) goja.Value {
+		path := pathArg(vm, call.Arguments, 0, "path")
+		checkRead(vm, path)
+		mode := uint32(call.Argument(1).ToInteger())
+		if mode&accessWrite != 0 {
+			checkWrite(vm, path)
+		}
+		if err := accessPath(path, mode); err != nil {
+			panic(NewSystemError(vm, err, "access", path))
+		}
+
+		return goja.Undefined()
+	})
+}
+
+// setupFSConstants adds fs.constants and the access modes fs also exposes
+// directly
+func setupFSConstants(vm *goja.Runtime, fs *goja.Object) {
+	constants := vm.NewObject()
+	values := []struct {
+		name  string
+		value int
+	}{
+		{"F_OK", accessExists},
+		{"R_OK", accessRead},
+		{"W_OK", accessWrite},
+		{"X_OK", accessExecute},
+		{"COPYFILE_EXCL", copyFileExcl},
+		{"COPYFILE_FICLONE", 2},
+		{"COPYFILE_FICLONE_FORCE", 4},
+		{"O_RDONLY", os.O_RDONLY},
+		{"O_WRONLY", os.O_WRONLY},
+		{"O_RDWR", os.O_RDWR},
+		{"O_CREAT", os.O_CREATE},
+		{"O_EXCL", os.O_EXCL},
+		{"O_TRUNC", os.O_TRUNC},
+		{"O_APPEND", os.O_APPEND},
+		{"O_SYNC", os.O_SYNC},
+		{"S_IFMT", modeTypeMask},
+		{"S_IFREG", modeRegular},
+		{"S_IFDIR", modeDir},
+		{"S_IFCHR", modeCharDev},
+		{"S_IFBLK", modeBlockDev},
+		{"S_IFIFO", modeNamedPipe},
+		{"S_IFLNK", modeSymlink},
+		{"S_IFSOCK", modeSocket},
+	}
+	for _, c := range values {
+		constants.Set(c.name, c.value)
+	}
+	fs.Set("constants", constants)
+
+	for _, name := range []string{"F_OK", "R_OK", "W_OK", "X_OK"} {
+		fs.Set(name, constants.Get(name))
+	}
+}
+
+// optionBool reads a boolean property of an options object, which may be
+// undefined
+func optionBool(vm *goja.Runtime, options goja.Value, name string) bool {
+	obj, ok := options.(*goja.Object)
+	if !ok {
+		return false
+	}
+	value := obj.Get(name)
+	return value != nil && value.ToBoolean()
+}
+
+// parseMode reads a file mode given as a number or an octal string
+func parseMode(vm *goja.Runtime, v goja.Value) uint64 {
+	if s, ok := v.Export().(string); ok {
+		mode, err := strconv.ParseUint(s, 8, 32)
+		if err != nil {
+			panic(NewNodeError(vm, "TypeError", "ERR_INVALID_ARG_VALUE",
+				fmt.Sprintf("The argument 'mode' must be a 32-bit unsigned integer or an octal string. Received '%s'", s)))
+		}
+		return mode
+	}
+	return uint64(v.ToInteger())
+}
+
+// parseTime reads a file time given as a Date, seconds since the epoch or a
+// numeric string
+func parseTime(vm *goja.Runtime, v goja.Value) time.Time {
+	if t, ok := v.Export().(time.Time); ok {
+		return t
+	}
+	seconds := v.ToFloat()
+	if math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return time.Now()
+	}
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second)))
+}
+
+// copyFile copies the contents and permissions of src to dest. With excl
+// it fails if dest exists.
+func copyFile(src, dest string, excl bool) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if excl {
+		flags |= os.O_EXCL
+	}
+	out, err := os.OpenFile(dest, flags, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(dest, info.Mode().Perm())
+}
+
+// copyOptions are the options of fs.cpSync
+type copyOptions struct {
+	recursive    bool
+	force        bool
+	errorOnExist bool
+}
+
+// cpError creates the error of a failed fs.cpSync check, such as
+// "Invalid src or dest: cp returned EINVAL (src and dest cannot be the same) x"
+func cpError(code, summary string, errno syscall.Errno, detail, path string) error {
+	return &nodeError{
+		code:    code,
+		message: fmt.Sprintf("%s: cp returned %s (%s) %s", summary, errnoNames[errno], detail, path),
+		errno:   errno,
+		syscall: "cp",
+		path:    path,
+	}
+}
+
+// copyTree copies src to dest, descending into directories. Failed system
+// calls are reported with the path they failed on.
+func copyTree(src, dest string, opts copyOptions) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return systemError(err, "lstat", src)
+	}
+
+	if info.IsDir() {
+		if !opts.recursive {
+			return cpError("ERR_FS_EISDIR", "Recursive option is required to copy a directory",
+				syscall.EISDIR, src+" is a directory (not copied)", src)
+		}
+		if err := os.MkdirAll(dest, info.Mode().Perm()); err != nil {
+			return systemError(err, "mkdir", dest)
+		}
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return systemError(err, "scandir", src)
+		}
+		for _, entry := range entries {
+			if err := copyTree(filepath.Join(src, entry.Name()), filepath.Join(dest, entry.Name()), opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if _, err := os.Lstat(dest); err == nil {
+		if !opts.force {
+			if opts.errorOnExist {
+				return cpError("ERR_FS_CP_EEXIST", "Target already exists",
+					syscall.EEXIST, dest+" already exists", dest)
+			}
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(dest); err != nil {
+				return systemError(err, "unlink", dest)
+			}
+		}
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return systemError(err, "readlink", src)
+		}
+		if err := os.Symlink(target, dest); err != nil {
+			return systemError(err, "symlink", target, dest)
+		}
+		return nil
+	}
+	if err := copyFile(src, dest, false); err != nil {
+		return systemError(err, "copyfile", src, dest)
+	}
+	return nil
+}
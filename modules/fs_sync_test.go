@@ -0,0 +1,99 @@
+package modules_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gojs/internal/jstest"
+)
+
+func TestFSStats(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, []byte("hello"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	jstest.ExpectOutput(t, `
+		const fs = require('fs');
+		const st = fs.statSync(`+jstest.Quote(file)+`);
+		console.log(st instanceof fs.Stats, st.size, st.isFile(), st.isDirectory(), (st.mode & 0o777).toString(8));
+		console.log(st.mtime instanceof Date, st.mtime.getTime() === Math.floor(st.mtimeMs), st.nlink, typeof st.ino);
+		console.log(fs.statSync(`+jstest.Quote(dir)+`).isDirectory());
+	`, "true 5 true false 640\ntrue true 1 number\ntrue\n")
+}
+
+func TestFSDirents(t *testing.T) {
+	dir := t.TempDir()
+	jstest.WriteFiles(t, dir, map[string]string{"file.txt": "", "sub/x": ""})
+	jstest.ExpectOutput(t, `
+		const fs = require('fs');
+		const entries = fs.readdirSync(`+jstest.Quote(dir)+`, { withFileTypes: true });
+		for (const e of entries.sort((a, b) => a.name < b.name ? -1 : 1)) {
+			console.log(e instanceof fs.Dirent, e.name, e.isFile(), e.isDirectory(), e.parentPath === `+jstest.Quote(dir)+`);
+		}
+	`, "true file.txt true false true\ntrue sub false true true\n")
+}
+
+func TestFSSyncFileOperations(t *testing.T) {
+	dir := t.TempDir()
+	jstest.ExpectOutput(t, `
+		const fs = require('fs');
+		const path = require('path');
+		const dir = `+jstest.Quote(dir)+`;
+		const a = path.join(dir, 'a.txt');
+		fs.appendFileSync(a, 'one');
+		fs.appendFileSync(a, Buffer.from(' two'));
+		fs.copyFileSync(a, path.join(dir, 'b.txt'));
+		try { fs.copyFileSync(a, path.join(dir, 'b.txt'), fs.constants.COPYFILE_EXCL); } catch (e) { console.log('exists', e.code); }
+		fs.renameSync(path.join(dir, 'b.txt'), path.join(dir, 'c.txt'));
+		console.log(fs.readFileSync(path.join(dir, 'c.txt'), 'utf8'), fs.existsSync(path.join(dir, 'b.txt')));
+		fs.chmodSync(a, '600');
+		console.log((fs.statSync(a).mode & 0o777).toString(8));
+		fs.utimesSync(a, 1000, new Date(2000000));
+		console.log(fs.statSync(a).atimeMs, fs.statSync(a).mtimeMs);
+		fs.accessSync(a, fs.constants.R_OK | fs.constants.W_OK);
+		try { fs.accessSync(path.join(dir, 'missing')); } catch (e) { console.log(e.code); }
+	`, "exists EEXIST\none two false\n600\n1000000 2000000\nENOENT\n")
+}
+
+func TestFSSyncDirectoryOperations(t *testing.T) {
+	dir := t.TempDir()
+	jstest.WriteFiles(t, dir, map[string]string{"src/a.txt": "a", "src/sub/b.txt": "b"})
+	jstest.ExpectOutput(t, `
+		const fs = require('fs');
+		const path = require('path');
+		const dir = `+jstest.Quote(dir)+`;
+		fs.cpSync(path.join(dir, 'src'), path.join(dir, 'dst'), { recursive: true });
+		console.log(fs.readFileSync(path.join(dir, 'dst/sub/b.txt'), 'utf8'));
+		const tmp = fs.mkdtempSync(path.join(dir, 'tmp-'));
+		console.log(path.basename(tmp).startsWith('tmp-'), path.basename(tmp).length > 4);
+		try { fs.rmSync(path.join(dir, 'dst')); } catch (e) { console.log(e.code); }
+		fs.rmSync(path.join(dir, 'dst'), { recursive: true });
+		fs.rmSync(path.join(dir, 'missing'), { force: true });
+		console.log(fs.existsSync(path.join(dir, 'dst')));
+	`, "b\ntrue true\nERR_FS_EISDIR\nfalse\n")
+}
+
+func TestFSSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.txt")
+	link := filepath.Join(dir, "link")
+	if err := os.WriteFile(target, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(dir, "probe")); err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+	real, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jstest.ExpectOutput(t, `
+		const fs = require('fs');
+		fs.symlinkSync(`+jstest.Quote(target)+`, `+jstest.Quote(link)+`);
+		console.log(fs.readlinkSync(`+jstest.Quote(link)+`) === `+jstest.Quote(target)+`);
+		console.log(fs.lstatSync(`+jstest.Quote(link)+`).isSymbolicLink(), fs.statSync(`+jstest.Quote(link)+`).isSymbolicLink());
+		console.log(fs.realpathSync(`+jstest.Quote(link)+`) === `+jstest.Quote(real)+`);
+	`, "true\ntrue false\ntrue\n")
+}
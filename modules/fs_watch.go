@@ -0,0 +1,310 @@
+package modules
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// Default polling interval of fs.watchFile, as in Node.js
+const watchFileInterval = 5007 * time.Millisecond
+
+// watchEvent is a change reported by a watch backend. filename is relative
+// to the watched directory, or the base name of a watched file.
+type watchEvent struct {
+	eventType string
+	filename  string
+}
+
+// watcher is the state of an fs.FSWatcher or fs.StatWatcher. A persistent
+// watcher holds a reference on the loop until it is closed or unref'd.
+type watcher struct {
+	loop   AsyncLoop
+	refed  bool
+	closed bool
+	stop   func()
+	// unclose unregisters the closer that stops the watcher if the run is
+	// halted
+	unclose func()
+}
+
+// start records how to stop the watcher, which is also done if the run is
+// halted
+func (w *watcher) start(stop func()) {
+	var once sync.Once
+	w.stop = func() { once.Do(stop) }
+	w.unclose = w.loop.AddCloser(w.stop)
+}
+
+func (w *watcher) ref() {
+	if !w.refed && !w.closed {
+		w.refed = true
+		w.loop.Ref()
+	}
+}
+
+func (w *watcher) unref() {
+	if w.refed {
+		w.refed = false
+		w.loop.Unref()
+	}
+}
+
+// close stops the watcher and reports whether it was still open
+func (w *watcher) close() bool {
+	if w.closed {
+		return false
+	}
+	w.closed = true
+	w.stop()
+	w.unclose()
+	w.unref()
+	return true
+}
+
+// setupFSWatch adds fs.watch, fs.watchFile and fs.unwatchFile. Changes are
+// detected on goroutines and delivered to listeners as macrotasks on loop.
+func setupFSWatch(vm *goja.Runtime, loop AsyncLoop, fs *goja.Object) error {
+	emitter, err := builtinExports(vm, "events")
+	if err != nil {
+		return err
+	}
+	watcherKey := goja.NewSymbol("watcher")
+
+	watcherOf := func(this goja.Value) *watcher {
+		if obj, ok := this.(*goja.Object); ok {
+			if w, ok := exportSymbol(obj, watcherKey).(*watcher); ok {
+				return w
+			}
+		}
+		panic(NewNodeError(vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be a watcher"))
+	}
+
+	// newClass creates a watcher class extending EventEmitter with ref and
+	// unref, which control whether the watcher keeps the loop alive
+	newClass := func(name string) (*goja.Object, *goja.Object) {
+		ctor := vm.ToValue(func(call goja.ConstructorCall) *goja.Object {
+			return nil
+		}).ToObject(vm)
+		ctor.DefineDataProperty("name", vm.ToValue(name), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+		ctor.SetPrototype(emitter.ToObject(vm))
+		proto := ctor.Get("prototype").ToObject(vm)
+		proto.SetPrototype(emitter.ToObject(vm).Get("prototype").ToObject(vm))
+
+		proto.Set("ref", func(call goja.FunctionCall) goja.Value {
+			watcherOf(call.This).ref()
+			return call.This
+		})
+		proto.Set("unref", func(call goja.FunctionCall) goja.Value {
+			watcherOf(call.This).unref()
+			return call.This
+		})
+		return ctor, proto
+	}
+
+	newWatcher := func(proto *goja.Object) (*goja.Object, *watcher) {
+		obj := vm.NewObject()
+		obj.SetPrototype(proto)
+		w := &watcher{loop: loop}
+		obj.DefineDataPropertySymbol(watcherKey, vm.ToValue(w), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+		return obj, w
+	}
+
+	// emit emits event on obj unless the watcher was closed in the meantime
+	emit := func(obj *goja.Object, w *watcher, event string, args ...goja.Value) {
+		if w.closed {
+			return
+		}
+		if _, err := Emit(vm, obj, event, args...); err != nil {
+			panic(err)
+		}
+	}
+
+	fsWatcher, fsWatcherProto := newClass("FSWatcher")
+	fsWatcherProto.Set("close", func(call goja.FunctionCall) goja.Value {
+		if watcherOf(call.This).close() {
+			obj := call.This.ToObject(vm)
+			loop.NextTick(func() {
+				if _, err := Emit(vm, obj, "close"); err != nil {
+					panic(err)
+				}
+			})
+		}
+		return goja.Undefined()
+	})
+
+	// fs.watch(filename[, options][, listener]) watches a file or directory
+	// and emits 'change' with the event type, 'rename' or 'change', and the
+	// name of the file that changed
+	fs.Set("watch", func(call goja.FunctionCall) goja.Value {
+		path := pathArg(vm, call.Arguments, 0, "filename")
+		options, listener := call.Argument(1), call.Argument(2)
+		if _, ok := goja.AssertFunction(options); ok {
+			options, listener = goja.Undefined(), options
+		}
+		encoding := parseEncoding(vm, options, "utf8")
+		persistent, recursive := true, false
+		if opts, ok := options.(*goja.Object); ok {
+			if v := opts.Get("persistent"); v != nil && !goja.IsUndefined(v) {
+				persistent = v.ToBoolean()
+			}
+			if v := opts.Get("recursive"); v != nil && !goja.IsUndefined(v) {
+				recursive = v.ToBoolean()
+			}
+		}
+		checkRead(vm, path)
+
+		obj, w := newWatcher(fsWatcherProto)
+		if _, ok := goja.AssertFunction(listener); ok {
+			callMethod(vm, obj, "on", vm.ToValue("change"), listener)
+		}
+
+		stop, err := startWatch(path, recursive, func(ev watchEvent) {
+			loop.RunOnLoop(func(*goja.Runtime) {
+				emit(obj, w, "change", vm.ToValue(ev.eventType), fileContent(vm, []byte(ev.filename), encoding))
+			})
+		}, func(err error) {
+			loop.RunOnLoop(func(*goja.Runtime) {
+				if w.closed {
+					return
+				}
+				emit(obj, w, "error", NewSystemError(vm, err, "watch", path))
+				callMethod(vm, obj, "close")
+			})
+		})
+		if err != nil {
+			panic(NewSystemError(vm, err, "watch", path))
+		}
+		w.start(stop)
+		if persistent {
+			w.ref()
+		}
+
+		return obj
+	})
+
+	// Stat watchers are shared by every watchFile call for the same file
+	statWatchers := map[string]*goja.Object{}
+	statWatcher, statWatcherProto := newClass("StatWatcher")
+
+	// fs.watchFile(filename[, options], listener) polls the file every
+	// options.interval milliseconds and calls listener(current, previous)
+	// with fs.Stats objects when it changed. A missing file has zeroed stats.
+	fs.Set("watchFile", func(call goja.FunctionCall) goja.Value {
+		path := pathArg(vm, call.Arguments, 0, "filename")
+		options, listener := call.Argument(1), call.Argument(2)
+		if _, ok := goja.AssertFunction(options); ok {
+			options, listener = goja.Undefined(), options
+		}
+		if _, ok := goja.AssertFunction(listener); !ok {
+			panic(ErrInvalidArgType(vm, "listener", "of type function", listener))
+		}
+		interval, persistent := watchFileInterval, true
+		if opts, ok := options.(*goja.Object); ok {
+			if v := opts.Get("interval"); !isNullish(v) {
+				if !isNumber(v) {
+					panic(ErrInvalidArgType(vm, "interval", "of type number", v))
+				}
+				interval = time.Duration(v.ToFloat() * float64(time.Millisecond))
+			}
+			if v := opts.Get("persistent"); v != nil && !goja.IsUndefined(v) {
+				persistent = v.ToBoolean()
+			}
+		}
+		checkRead(vm, path)
+
+		key, _ := filepath.Abs(path)
+		obj, ok := statWatchers[key]
+		if !ok {
+			var w *watcher
+			obj, w = newWatcher(statWatcherProto)
+			done := make(chan struct{})
+			w.start(func() { close(done) })
+			go pollStat(path, interval, done, func(curr, prev fileStat) {
+				loop.RunOnLoop(func(*goja.Runtime) {
+					emit(obj, w, "change", statObject(vm, curr), statObject(vm, prev))
+				})
+			})
+			if persistent {
+				w.ref()
+			}
+			statWatchers[key] = obj
+		}
+		callMethod(vm, obj, "on", vm.ToValue("change"), listener)
+
+		return obj
+	})
+
+	// fs.unwatchFile(filename[, listener]) removes listener, or every
+	// listener, and stops polling once none are left
+	fs.Set("unwatchFile", func(call goja.FunctionCall) goja.Value {
+		path := pathArg(vm, call.Arguments, 0, "filename")
+		key, _ := filepath.Abs(path)
+		obj, ok := statWatchers[key]
+		if !ok {
+			return goja.Undefined()
+		}
+
+		if _, ok := goja.AssertFunction(call.Argument(1)); ok {
+			callMethod(vm, obj, "removeListener", vm.ToValue("change"), call.Argument(1))
+		} else {
+			callMethod(vm, obj, "removeAllListeners", vm.ToValue("change"))
+		}
+		if callMethod(vm, obj, "listenerCount", vm.ToValue("change")).ToInteger() == 0 {
+			delete(statWatchers, key)
+			watcherOf(obj).close()
+			loop.NextTick(func() {
+				if _, err := Emit(vm, obj, "stop"); err != nil {
+					panic(err)
+				}
+			})
+		}
+
+		return goja.Undefined()
+	})
+
+	fs.Set("FSWatcher", fsWatcher)
+	fs.Set("StatWatcher", statWatcher)
+	return nil
+}
+
+// pollStat stats path every interval until done is closed and calls changed
+// with the new and previous stats whenever they differ
+func pollStat(path string, interval time.Duration, done <-chan struct{}, changed func(curr, prev fileStat)) {
+	prev := statPath(path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		curr := statPath(path)
+		if !sameStat(curr, prev) {
+			changed(curr, prev)
+			prev = curr
+		}
+	}
+}
+
+// statPath stats path, returning zeroed stats if it cannot be found
+func statPath(path string) fileStat {
+	info, err := os.Stat(path)
+	if err != nil {
+		epoch := time.Unix(0, 0)
+		return fileStat{atime: epoch, mtime: epoch, ctime: epoch, birthtime: epoch}
+	}
+	return statOf(info)
+}
+
+// sameStat compares the fields libuv compares to detect a change. Reads
+// that only update the access time do not count.
+func sameStat(a, b fileStat) bool {
+	return a.dev == b.dev && a.ino == b.ino && a.mode == b.mode &&
+		a.uid == b.uid && a.gid == b.gid && a.size == b.size &&
+		a.mtime.Equal(b.mtime) && a.ctime.Equal(b.ctime) && a.birthtime.Equal(b.birthtime)
+}
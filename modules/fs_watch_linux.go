@@ -0,0 +1,152 @@
+//go:build linux
+
+package modules
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// inotifyMask selects the events libuv watches for
+const inotifyMask = syscall.IN_ATTRIB | syscall.IN_CREATE | syscall.IN_MODIFY |
+	syscall.IN_DELETE | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// inotifyWatcher watches a file, a directory or, if recursive, a directory
+// tree with one inotify instance
+type inotifyWatcher struct {
+	file      *os.File
+	root      string
+	recursive bool
+
+	// dirs maps watch descriptors to directories relative to root. Only
+	// the reading goroutine touches it once watching has started.
+	dirs map[int32]string
+}
+
+// startWatch watches path with inotify. notify and fail are called from a
+// goroutine; the returned function stops watching.
+func startWatch(path string, recursive bool, notify func(watchEvent), fail func(error)) (func(), error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	// A non-blocking descriptor goes through the runtime poller, so
+	// closing the file wakes up the goroutine blocked reading it
+	w := &inotifyWatcher{
+		file:      os.NewFile(uintptr(fd), "inotify"),
+		root:      path,
+		recursive: recursive && info.IsDir(),
+		dirs:      map[int32]string{},
+	}
+	if err := w.add(""); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+
+	go w.run(notify, fail)
+	return func() { w.file.Close() }, nil
+}
+
+// add watches the directory rel below root, and its subdirectories if the
+// watch is recursive. Subdirectories that disappear meanwhile are skipped.
+func (w *inotifyWatcher) add(rel string) error {
+	dir := filepath.Join(w.root, rel)
+	conn, err := w.file.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var wd int
+	var addErr error
+	if err := conn.Control(func(fd uintptr) {
+		wd, addErr = syscall.InotifyAddWatch(int(fd), dir, inotifyMask)
+	}); err != nil {
+		return err
+	}
+	if addErr != nil {
+		return &os.PathError{Op: "watch", Path: dir, Err: addErr}
+	}
+	w.dirs[int32(wd)] = rel
+
+	if !w.recursive {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			w.add(filepath.Join(rel, entry.Name()))
+		}
+	}
+	return nil
+}
+
+// run reads events until the file is closed
+func (w *inotifyWatcher) run(notify func(watchEvent), fail func(error)) {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				fail(err)
+			}
+			return
+		}
+
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			wd := int32(binary.NativeEndian.Uint32(buf[off:]))
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			off += syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[off:off+nameLen]), "\x00")
+			off += nameLen
+
+			if ev, ok := w.event(wd, mask, name); ok {
+				notify(ev)
+			}
+		}
+	}
+}
+
+// event translates an inotify event the way libuv does: content and
+// attribute changes are 'change', everything else is 'rename'
+func (w *inotifyWatcher) event(wd int32, mask uint32, name string) (watchEvent, bool) {
+	rel, ok := w.dirs[wd]
+	if !ok {
+		return watchEvent{}, false
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.dirs, wd)
+		return watchEvent{}, false
+	}
+
+	if w.recursive && mask&syscall.IN_ISDIR != 0 && mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		w.add(filepath.Join(rel, name))
+	}
+
+	// Events about a subdirectory itself are also reported by its parent
+	if name == "" && rel != "" {
+		return watchEvent{}, false
+	}
+	filename := filepath.Join(rel, name)
+	if name == "" {
+		filename = filepath.Base(w.root)
+	}
+
+	eventType := "rename"
+	if mask&(syscall.IN_ATTRIB|syscall.IN_MODIFY) != 0 {
+		eventType = "change"
+	}
+	return watchEvent{eventType: eventType, filename: filename}, true
+}
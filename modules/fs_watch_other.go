@@ -0,0 +1,95 @@
+//go:build !linux
+
+package modules
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// How often fs.watch polls on platforms without an inotify backend
+const watchPollInterval = 250 * time.Millisecond
+
+// pollEntry is what the polling backend compares to detect changes
+type pollEntry struct {
+	modTime time.Time
+	size    int64
+	mode    os.FileMode
+}
+
+// startWatch polls path for changes. notify and fail are called from a
+// goroutine; the returned function stops watching.
+func startWatch(path string, recursive bool, notify func(watchEvent), fail func(error)) (func(), error) {
+	prev, err := pollSnapshot(path, recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(watchPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			curr, err := pollSnapshot(path, recursive)
+			if err != nil {
+				notify(watchEvent{eventType: "rename", filename: filepath.Base(path)})
+				fail(err)
+				return
+			}
+			for name, entry := range curr {
+				old, ok := prev[name]
+				switch {
+				case !ok:
+					notify(watchEvent{eventType: "rename", filename: name})
+				case !old.modTime.Equal(entry.modTime) || old.size != entry.size || old.mode != entry.mode:
+					notify(watchEvent{eventType: "change", filename: name})
+				}
+			}
+			for name := range prev {
+				if _, ok := curr[name]; !ok {
+					notify(watchEvent{eventType: "rename", filename: name})
+				}
+			}
+			prev = curr
+		}
+	}()
+	return func() { close(done) }, nil
+}
+
+// pollSnapshot records path, or the entries of the directory path, keyed
+// by the name fs.watch reports for them
+func pollSnapshot(path string, recursive bool) (map[string]pollEntry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	entryOf := func(info os.FileInfo) pollEntry {
+		return pollEntry{modTime: info.ModTime(), size: info.Size(), mode: info.Mode()}
+	}
+	if !info.IsDir() {
+		return map[string]pollEntry{filepath.Base(path): entryOf(info)}, nil
+	}
+
+	snapshot := map[string]pollEntry{}
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == path {
+			return nil
+		}
+		rel, _ := filepath.Rel(path, p)
+		if info, err := d.Info(); err == nil {
+			snapshot[rel] = entryOf(info)
+		}
+		if d.IsDir() && !recursive {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return snapshot, err
+}
@@ -0,0 +1,67 @@
+package modules_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gojs/internal/jstest"
+)
+
+func TestFSWatch(t *testing.T) {
+	dir := t.TempDir()
+	jstest.WriteFiles(t, dir, map[string]string{"sub/.keep": ""})
+	jstest.ExpectOutput(t, `
+		const fs = require('fs');
+		const dir = `+jstest.Quote(dir)+`;
+		const watcher = fs.watch(dir, { recursive: true }, (eventType, filename) => {
+			if (filename !== 'sub/new.txt') return;
+			console.log(eventType, filename, watcher instanceof fs.FSWatcher);
+			watcher.close();
+		});
+		watcher.on('close', () => console.log('close'));
+		setTimeout(() => fs.writeFileSync(dir + '/sub/new.txt', 'x'), 20);
+	`, "rename sub/new.txt true\nclose\n")
+}
+
+func TestFSWatchBufferNames(t *testing.T) {
+	dir := t.TempDir()
+	jstest.ExpectOutput(t, `
+		const fs = require('fs');
+		const watcher = fs.watch(`+jstest.Quote(dir)+`, { encoding: 'buffer' }, (eventType, filename) => {
+			console.log(Buffer.isBuffer(filename), filename.toString());
+			watcher.close();
+		});
+		setTimeout(() => fs.writeFileSync(`+jstest.Quote(filepath.Join(dir, "a"))+`, ''), 20);
+	`, "true a\n")
+}
+
+func TestFSWatchFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "watched.txt")
+	jstest.ExpectOutput(t, `
+		const fs = require('fs');
+		const file = `+jstest.Quote(file)+`;
+		fs.writeFileSync(file, 'a');
+		const other = () => {};
+		const listener = (curr, prev) => {
+			console.log(curr instanceof fs.Stats, prev.size, curr.size);
+			fs.unwatchFile(file, listener);
+			fs.unwatchFile(file, other);
+		};
+		const watcher = fs.watchFile(file, { interval: 10 }, listener);
+		console.log(watcher instanceof fs.StatWatcher, fs.watchFile(file, { interval: 10 }, other) === watcher);
+		fs.unwatchFile(file, () => {});
+		setTimeout(() => fs.readFileSync(file), 20);
+		setTimeout(() => fs.writeFileSync(file, 'abc'), 40);
+	`, "true true\ntrue 1 3\n")
+}
+
+func TestFSWatchUnref(t *testing.T) {
+	dir := t.TempDir()
+	jstest.ExpectOutput(t, `
+		const fs = require('fs');
+		fs.watch(`+jstest.Quote(dir)+`, { persistent: false });
+		fs.watch(`+jstest.Quote(dir)+`).unref();
+		fs.watchFile(`+jstest.Quote(filepath.Join(dir, "missing"))+`, { persistent: false }, () => {});
+		console.log('done');
+	`, "done\n")
+}
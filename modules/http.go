@@ -0,0 +1,792 @@
+package modules
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// httpMethods are the methods the http module lists in http.METHODS
+var httpMethods = []string{
+	"ACL", "BIND", "CHECKOUT", "CONNECT", "COPY", "DELETE", "GET", "HEAD", "LINK", "LOCK",
+	"M-SEARCH", "MERGE", "MKACTIVITY", "MKCALENDAR", "MKCOL", "MOVE", "NOTIFY", "OPTIONS",
+	"PATCH", "POST", "PROPFIND", "PROPPATCH", "PURGE", "PUT", "QUERY", "REBIND", "REPORT",
+	"SEARCH", "SOURCE", "SUBSCRIBE", "TRACE", "UNBIND", "UNLINK", "UNLOCK", "UNSUBSCRIBE",
+}
+
+// httpStatusCodes are the reason phrases of http.STATUS_CODES, which differ
+// from Go's in places
+var httpStatusCodes = map[int]string{
+	100: "Continue",
+	101: "Switching Protocols",
+	102: "Processing",
+	103: "Early Hints",
+	200: "OK",
+	201: "Created",
+	202: "Accepted",
+	203: "Non-Authoritative Information",
+	204: "No Content",
+	205: "Reset Content",
+	206: "Partial Content",
+	207: "Multi-Status",
+	208: "Already Reported",
+	226: "IM Used",
+	300: "Multiple Choices",
+	301: "Moved Permanently",
+	302: "Found",
+	303: "See Other",
+	304: "Not Modified",
+	305: "Use Proxy",
+	307: "Temporary Redirect",
+	308: "Permanent Redirect",
+	400: "Bad Request",
+	401: "Unauthorized",
+	402: "Payment Required",
+	403: "Forbidden",
+	404: "Not Found",
+	405: "Method Not Allowed",
+	406: "Not Acceptable",
+	407: "Proxy Authentication Required",
+	408: "Request Timeout",
+	409: "Conflict",
+	410: "Gone",
+	411: "Length Required",
+	412: "Precondition Failed",
+	413: "Payload Too Large",
+	414: "URI Too Long",
+	415: "Unsupported Media Type",
+	416: "Range Not Satisfiable",
+	417: "Expectation Failed",
+	418: "I'm a Teapot",
+	421: "Misdirected Request",
+	422: "Unprocessable Entity",
+	423: "Locked",
+	424: "Failed Dependency",
+	425: "Too Early",
+	426: "Upgrade Required",
+	428: "Precondition Required",
+	429: "Too Many Requests",
+	431: "Request Header Fields Too Large",
+	451: "Unavailable For Legal Reasons",
+	500: "Internal Server Error",
+	501: "Not Implemented",
+	502: "Bad Gateway",
+	503: "Service Unavailable",
+	504: "Gateway Timeout",
+	505: "HTTP Version Not Supported",
+	506: "Variant Also Negotiates",
+	507: "Insufficient Storage",
+	508: "Loop Detected",
+	509: "Bandwidth Limit Exceeded",
+	510: "Not Extended",
+	511: "Network Authentication Required",
+}
+
+// Default limit on the size of request and response heads, in bytes
+const httpMaxHeaderSize = 16 * 1024
+
+// httpClasses holds the classes of the http module
+type httpClasses struct {
+	vm      *goja.Runtime
+	loop    AsyncLoop
+	streams *streamClasses
+
+	// incomingKey and outgoingKey hold the state of messages
+	incomingKey *goja.Symbol
+	outgoingKey *goja.Symbol
+
+	incomingMessage *goja.Object
+	outgoingMessage *goja.Object
+	outgoingProto   *goja.Object
+	serverResponse  *goja.Object
+	clientRequest   *goja.Object
+	server          *goja.Object
+	agent           *goja.Object
+	globalAgent     *goja.Object
+}
+
+// incomingMessage is the state of an http.IncomingMessage, whose body is
+// read on goroutines
+type incomingMessage struct {
+	body io.ReadCloser
+	// trailer returns the trailers once the body has been read
+	trailer func() http.Header
+	// touch is called whenever a read completes
+	touch func()
+}
+
+// messageSink sends an outgoing message. Its methods are called on the loop
+// and call done there once the work is complete.
+type messageSink interface {
+	// writeHead fixes the head of the message before the first write.
+	// contentLength is -1 if the length of the body is unknown.
+	writeHead(header http.Header, contentLength int64)
+	write(data []byte, flush bool, done func(err error))
+	end(trailers http.Header, done func(err error))
+	// abort tears down a message that is not complete
+	abort()
+}
+
+// outgoingMessage is the state of an http.OutgoingMessage: a
+// ServerResponse or ClientRequest
+type outgoingMessage struct {
+	sink    messageSink
+	headers map[string]*outgoingHeader
+	names   []string
+
+	// headersSent is set once the head can no longer change, headWritten
+	// once it was handed to the sink
+	headersSent bool
+	headWritten bool
+	// contentLength is known when end() is called before any write
+	contentLength int64
+	// ending is set by end(), whose writes need not be flushed
+	ending   bool
+	trailers http.Header
+}
+
+// outgoingHeader is a header set on an outgoing message, with the case of
+// its name as given
+type outgoingHeader struct {
+	name  string
+	value goja.Value
+}
+
+// SetupHTTP sets up the http module. Servers and clients run on net/http
+// goroutines and hand requests and responses to scripts on loop.
+func SetupHTTP(vm *goja.Runtime, loop AsyncLoop) error {
+	streams := streamsOf(vm)
+	if streams == nil {
+		return errors.New("streams not initialized - call SetupStream first")
+	}
+	c := &httpClasses{
+		vm:          vm,
+		loop:        loop,
+		streams:     streams,
+		incomingKey: goja.NewSymbol("incomingMessage"),
+		outgoingKey: goja.NewSymbol("outgoingMessage"),
+	}
+
+	c.setupIncoming()
+	c.setupOutgoing()
+	if err := c.setupServer(); err != nil {
+		return err
+	}
+	c.setupClient()
+
+	module := vm.NewObject()
+	methods := make([]interface{}, len(httpMethods))
+	for i, m := range httpMethods {
+		methods[i] = m
+	}
+	module.Set("METHODS", vm.NewArray(methods...))
+	statusCodes := vm.NewObject()
+	codes := make([]int, 0, len(httpStatusCodes))
+	for code := range httpStatusCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		statusCodes.Set(strconv.Itoa(code), httpStatusCodes[code])
+	}
+	module.Set("STATUS_CODES", statusCodes)
+	module.Set("maxHeaderSize", httpMaxHeaderSize)
+
+	module.Set("IncomingMessage", c.incomingMessage)
+	module.Set("OutgoingMessage", c.outgoingMessage)
+	module.Set("ServerResponse", c.serverResponse)
+	module.Set("ClientRequest", c.clientRequest)
+	module.Set("Server", c.server)
+	module.Set("Agent", c.agent)
+	module.Set("globalAgent", c.globalAgent)
+
+	// http.createServer([options][, requestListener])
+	module.Set("createServer", func(call goja.FunctionCall) goja.Value {
+		server, err := vm.New(c.server, call.Arguments...)
+		if err != nil {
+			panic(err)
+		}
+		return server
+	})
+	// http.request(url[, options][, callback]) creates a ClientRequest
+	module.Set("request", func(call goja.FunctionCall) goja.Value {
+		req, err := vm.New(c.clientRequest, call.Arguments...)
+		if err != nil {
+			panic(err)
+		}
+		return req
+	})
+	// http.get is http.request for GET requests that are ended at once
+	module.Set("get", func(call goja.FunctionCall) goja.Value {
+		req, err := vm.New(c.clientRequest, call.Arguments...)
+		if err != nil {
+			panic(err)
+		}
+		callMethod(vm, req, "end")
+		return req
+	})
+
+	module.Set("validateHeaderName", func(call goja.FunctionCall) goja.Value {
+		validateHeaderName(vm, call.Argument(0))
+		return goja.Undefined()
+	})
+	module.Set("validateHeaderValue", func(call goja.FunctionCall) goja.Value {
+		validateHeaderValue(vm, call.Argument(0).String(), call.Argument(1))
+		return goja.Undefined()
+	})
+
+	return RegisterModule(vm, "http", module)
+}
+
+// setupIncoming creates IncomingMessage, the Readable of a request received
+// by a server or a response received by a client
+func (c *httpClasses) setupIncoming() {
+	vm := c.vm
+	streams := c.streams
+
+	var proto *goja.Object
+	c.incomingMessage, proto = streams.newClass("IncomingMessage", streams.readable, func(this *goja.Object, args []goja.Value) {
+		s := streams.newState(this, goja.Undefined())
+		s.r = newReadableState(vm, goja.Undefined(), "readable")
+		this.DefineDataPropertySymbol(c.incomingKey, vm.ToValue(&incomingMessage{}), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+
+		socket := argAt(args, 0)
+		this.Set("socket", socket)
+		this.Set("httpVersionMajor", nil)
+		this.Set("httpVersionMinor", nil)
+		this.Set("httpVersion", nil)
+		this.Set("complete", false)
+		this.Set("rawHeaders", vm.NewArray())
+		this.Set("rawTrailers", vm.NewArray())
+		this.Set("aborted", false)
+		this.Set("upgrade", nil)
+		this.Set("url", "")
+		this.Set("method", nil)
+		this.Set("statusCode", nil)
+		this.Set("statusMessage", nil)
+		this.Set("headers", vm.NewObject())
+		this.Set("trailers", vm.NewObject())
+		s.construct()
+	})
+	proto.DefineAccessorProperty("connection", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return call.This.ToObject(vm).Get("socket")
+	}), nil, goja.FLAG_TRUE, goja.FLAG_FALSE)
+
+	incomingOf := func(this goja.Value) (*streamState, *incomingMessage) {
+		s := streams.state(this)
+		m, ok := exportSymbol(s.obj, c.incomingKey).(*incomingMessage)
+		if !ok {
+			panic(NewNodeError(vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be of type IncomingMessage"))
+		}
+		return s, m
+	}
+
+	// _read reads the next chunk of the body on a goroutine
+	proto.Set("_read", func(call goja.FunctionCall) goja.Value {
+		s, m := incomingOf(call.This)
+		if m.body == nil {
+			s.push(goja.Null(), goja.Undefined(), false)
+			return goja.Undefined()
+		}
+
+		buf := make([]byte, call.Argument(0).ToInteger())
+		var read int
+		body := m.body
+		runAsync(c.loop, func() (fsResult, error) {
+			var err error
+			read, err = body.Read(buf)
+			if errors.Is(err, io.EOF) {
+				body.Close()
+			}
+			return nil, err
+		}, func(_ fsResult, err error) {
+			if m.touch != nil {
+				m.touch()
+			}
+			if s.destroyed {
+				return
+			}
+			if read > 0 {
+				s.push(NewBuffer(vm, buf[:read]), goja.Undefined(), false)
+			}
+			switch {
+			case errors.Is(err, io.EOF):
+				m.body = nil
+				s.obj.Set("complete", true)
+				if m.trailer != nil {
+					trailers, raw := incomingHeaders(vm, "", m.trailer())
+					s.obj.Set("trailers", trailers)
+					s.obj.Set("rawTrailers", raw)
+				}
+				s.push(goja.Null(), goja.Undefined(), false)
+			case err != nil:
+				c.abortIncoming(s.obj)
+			}
+		})
+		return goja.Undefined()
+	})
+
+	// Messages that fail only report errors to scripts listening for them
+	proto.Set("_destroy", func(call goja.FunctionCall) goja.Value {
+		s, m := incomingOf(call.This)
+		err := call.Argument(0)
+		if s.listenerCount("error") == 0 {
+			err = goja.Null()
+		}
+		if body := m.body; body != nil {
+			m.body = nil
+			go body.Close()
+		}
+		if cb, ok := goja.AssertFunction(call.Argument(1)); ok {
+			if _, e := cb(goja.Undefined(), err); e != nil {
+				panic(e)
+			}
+		}
+		return goja.Undefined()
+	})
+}
+
+// newIncoming creates an IncomingMessage reading body, which may be nil for
+// messages without a body
+func (c *httpClasses) newIncoming(socket goja.Value, body io.ReadCloser, major, minor int) (*goja.Object, *incomingMessage) {
+	vm := c.vm
+	obj, err := vm.New(c.incomingMessage, socket)
+	if err != nil {
+		panic(err)
+	}
+	m := exportSymbol(obj, c.incomingKey).(*incomingMessage)
+	m.body = body
+	obj.Set("httpVersionMajor", major)
+	obj.Set("httpVersionMinor", minor)
+	obj.Set("httpVersion", strconv.Itoa(major)+"."+strconv.Itoa(minor))
+	return obj, m
+}
+
+// abortIncoming fails an incoming message whose connection was closed
+// before it was complete, emitting 'aborted' first
+func (c *httpClasses) abortIncoming(obj *goja.Object) {
+	s := c.streams.state(obj)
+	if s.destroyed || obj.Get("complete").ToBoolean() {
+		return
+	}
+	obj.Set("aborted", true)
+	s.emit("aborted")
+	s.destroy(NewNodeError(c.vm, "Error", "ECONNRESET", "aborted"), nil)
+}
+
+// discardedDuplicates are the headers of which IncomingMessage.headers only
+// keeps the first value
+var discardedDuplicates = map[string]bool{
+	"age": true, "authorization": true, "content-length": true, "content-type": true, "etag": true,
+	"expires": true, "from": true, "host": true, "if-modified-since": true, "if-unmodified-since": true,
+	"last-modified": true, "location": true, "max-forwards": true, "proxy-authorization": true,
+	"referer": true, "retry-after": true, "server": true, "user-agent": true,
+}
+
+// incomingHeaders converts received headers to the headers object of an
+// IncomingMessage, with lower-case names, and its rawHeaders list. host,
+// which Go keeps apart from the other headers, comes first if not empty.
+func incomingHeaders(vm *goja.Runtime, host string, header http.Header) (*goja.Object, *goja.Object) {
+	var raw []interface{}
+	headers := vm.NewObject()
+	add := func(name, value string) {
+		raw = append(raw, name, value)
+		key := strings.ToLower(name)
+		prev := headers.Get(key)
+		switch {
+		case key == "set-cookie":
+			if prev == nil {
+				headers.Set(key, vm.NewArray(value))
+			} else {
+				callMethod(vm, prev.ToObject(vm), "push", vm.ToValue(value))
+			}
+		case prev == nil:
+			headers.Set(key, value)
+		case discardedDuplicates[key]:
+		case key == "cookie":
+			headers.Set(key, prev.String()+"; "+value)
+		default:
+			headers.Set(key, prev.String()+", "+value)
+		}
+	}
+
+	if host != "" {
+		add("Host", host)
+	}
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			add(name, value)
+		}
+	}
+	return headers, vm.NewArray(raw...)
+}
+
+// setupOutgoing creates OutgoingMessage, the Writable base class of
+// ServerResponse and ClientRequest, with the methods managing headers
+func (c *httpClasses) setupOutgoing() {
+	vm := c.vm
+	streams := c.streams
+
+	var proto *goja.Object
+	c.outgoingMessage, proto = streams.newClass("OutgoingMessage", streams.writable, func(this *goja.Object, args []goja.Value) {
+		c.initOutgoing(this, nil, true)
+	})
+	c.outgoingProto = proto
+
+	proto.Set("setHeader", func(call goja.FunctionCall) goja.Value {
+		_, m := c.outgoing(call.This)
+		name := validateHeaderName(vm, call.Argument(0))
+		validateHeaderValue(vm, name, call.Argument(1))
+		if m.headersSent {
+			panic(headersSentError(vm, "set"))
+		}
+		m.setHeader(name, call.Argument(1))
+		return call.This
+	})
+
+	// appendHeader adds values to a header instead of replacing it
+	proto.Set("appendHeader", func(call goja.FunctionCall) goja.Value {
+		_, m := c.outgoing(call.This)
+		name := validateHeaderName(vm, call.Argument(0))
+		validateHeaderValue(vm, name, call.Argument(1))
+		if m.headersSent {
+			panic(headersSentError(vm, "append"))
+		}
+		h, ok := m.headers[strings.ToLower(name)]
+		if !ok {
+			m.setHeader(name, call.Argument(1))
+			return call.This
+		}
+		values := make([]interface{}, 0)
+		for _, v := range append(headerValues(h.value), headerValues(call.Argument(1))...) {
+			values = append(values, v)
+		}
+		h.value = vm.NewArray(values...)
+		return call.This
+	})
+
+	proto.Set("getHeader", func(call goja.FunctionCall) goja.Value {
+		_, m := c.outgoing(call.This)
+		if h, ok := m.headers[strings.ToLower(call.Argument(0).String())]; ok {
+			return h.value
+		}
+		return goja.Undefined()
+	})
+
+	proto.Set("getHeaders", func(call goja.FunctionCall) goja.Value {
+		_, m := c.outgoing(call.This)
+		headers := vm.NewObject()
+		headers.SetPrototype(nil)
+		for _, key := range m.names {
+			headers.Set(key, m.headers[key].value)
+		}
+		return headers
+	})
+
+	proto.Set("getHeaderNames", func(call goja.FunctionCall) goja.Value {
+		_, m := c.outgoing(call.This)
+		names := make([]interface{}, len(m.names))
+		for i, key := range m.names {
+			names[i] = key
+		}
+		return vm.NewArray(names...)
+	})
+
+	proto.Set("getRawHeaderNames", func(call goja.FunctionCall) goja.Value {
+		_, m := c.outgoing(call.This)
+		names := make([]interface{}, len(m.names))
+		for i, key := range m.names {
+			names[i] = m.headers[key].name
+		}
+		return vm.NewArray(names...)
+	})
+
+	proto.Set("hasHeader", func(call goja.FunctionCall) goja.Value {
+		_, m := c.outgoing(call.This)
+		_, ok := m.headers[strings.ToLower(call.Argument(0).String())]
+		return vm.ToValue(ok)
+	})
+
+	proto.Set("removeHeader", func(call goja.FunctionCall) goja.Value {
+		_, m := c.outgoing(call.This)
+		if m.headersSent {
+			panic(headersSentError(vm, "remove"))
+		}
+		m.removeHeader(call.Argument(0).String())
+		return goja.Undefined()
+	})
+
+	proto.DefineAccessorProperty("headersSent", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		_, m := c.outgoing(call.This)
+		return vm.ToValue(m.headersSent)
+	}), nil, goja.FLAG_TRUE, goja.FLAG_FALSE)
+
+	// addTrailers sets the trailers sent after a chunked body
+	proto.Set("addTrailers", func(call goja.FunctionCall) goja.Value {
+		_, m := c.outgoing(call.This)
+		if m.trailers == nil {
+			m.trailers = http.Header{}
+		}
+		eachHeader(vm, call.Argument(0), func(name string, value goja.Value) {
+			name = validateHeaderName(vm, vm.ToValue(name))
+			validateHeaderValue(vm, name, value)
+			for _, v := range headerValues(value) {
+				m.trailers.Add(name, v)
+			}
+		})
+		return goja.Undefined()
+	})
+
+	// flushHeaders sends the head without waiting for the body
+	proto.Set("flushHeaders", func(call goja.FunctionCall) goja.Value {
+		_, m := c.outgoing(call.This)
+		if !m.headWritten {
+			m.writeHead(vm)
+			m.sink.write(nil, true, func(error) {})
+		}
+		return goja.Undefined()
+	})
+
+	// end infers the Content-Length of bodies written all at once
+	proto.Set("end", func(call goja.FunctionCall) goja.Value {
+		s, m := c.outgoing(call.This)
+		chunk, encoding, cb := call.Argument(0), call.Argument(1), call.Argument(2)
+		if _, ok := goja.AssertFunction(chunk); ok {
+			cb, chunk, encoding = chunk, goja.Undefined(), goja.Undefined()
+		} else if _, ok := goja.AssertFunction(encoding); ok {
+			cb, encoding = encoding, goja.Undefined()
+		}
+		if !m.headersSent && !m.ending && s.w.pending == 0 && !m.hasHeader("content-length") && !m.hasHeader("transfer-encoding") {
+			m.contentLength = 0
+			if !isNullish(chunk) {
+				m.contentLength = int64(chunkLength(vm, chunk, encoding))
+			}
+		}
+		m.ending = true
+		s.end(chunk, encoding, cb)
+		return call.This
+	})
+
+	proto.Set("_write", func(call goja.FunctionCall) goja.Value {
+		_, m := c.outgoing(call.This)
+		cb, _ := goja.AssertFunction(call.Argument(2))
+		data, _ := BufferBytes(vm, call.Argument(0))
+		data = append([]byte(nil), data...)
+		if !m.headWritten {
+			m.writeHead(vm)
+		}
+		m.sink.write(data, !m.ending, func(err error) {
+			var errValue goja.Value = goja.Undefined()
+			if err != nil {
+				errValue = jsError(vm, err)
+			}
+			if _, e := cb(goja.Undefined(), errValue); e != nil {
+				panic(e)
+			}
+		})
+		return goja.Undefined()
+	})
+
+	proto.Set("_final", func(call goja.FunctionCall) goja.Value {
+		_, m := c.outgoing(call.This)
+		cb, _ := goja.AssertFunction(call.Argument(0))
+		if !m.headWritten {
+			if m.contentLength < 0 {
+				m.contentLength = 0
+			}
+			m.writeHead(vm)
+		}
+		m.sink.end(m.trailers, func(err error) {
+			var errValue goja.Value = goja.Undefined()
+			if err != nil {
+				errValue = jsError(vm, err)
+			}
+			if _, e := cb(goja.Undefined(), errValue); e != nil {
+				panic(e)
+			}
+		})
+		return goja.Undefined()
+	})
+
+	proto.Set("_destroy", func(call goja.FunctionCall) goja.Value {
+		s, m := c.outgoing(call.This)
+		if !s.w.finished && m.sink != nil {
+			m.sink.abort()
+		}
+		if cb, ok := goja.AssertFunction(call.Argument(1)); ok {
+			if _, e := cb(goja.Undefined(), call.Argument(0)); e != nil {
+				panic(e)
+			}
+		}
+		return goja.Undefined()
+	})
+}
+
+// initOutgoing sets up the stream state of an outgoing message sent to sink
+func (c *httpClasses) initOutgoing(obj *goja.Object, sink messageSink, autoDestroy bool) *outgoingMessage {
+	vm := c.vm
+	opts := vm.NewObject()
+	opts.Set("autoDestroy", autoDestroy)
+	s := c.streams.newState(obj, opts)
+	s.w = newWritableState(vm, opts, "writable")
+	m := &outgoingMessage{sink: sink, headers: map[string]*outgoingHeader{}, contentLength: -1}
+	obj.DefineDataPropertySymbol(c.outgoingKey, vm.ToValue(m), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	return m
+}
+
+// outgoing returns the state of the outgoing message this
+func (c *httpClasses) outgoing(this goja.Value) (*streamState, *outgoingMessage) {
+	if obj, ok := this.(*goja.Object); ok {
+		if m, ok := exportSymbol(obj, c.outgoingKey).(*outgoingMessage); ok {
+			return c.streams.state(obj), m
+		}
+	}
+	panic(NewNodeError(c.vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be of type OutgoingMessage"))
+}
+
+func (m *outgoingMessage) setHeader(name string, value goja.Value) {
+	key := strings.ToLower(name)
+	if _, ok := m.headers[key]; !ok {
+		m.names = append(m.names, key)
+	}
+	m.headers[key] = &outgoingHeader{name: name, value: value}
+}
+
+func (m *outgoingMessage) removeHeader(name string) {
+	key := strings.ToLower(name)
+	if _, ok := m.headers[key]; !ok {
+		return
+	}
+	delete(m.headers, key)
+	for i, n := range m.names {
+		if n == key {
+			m.names = append(m.names[:i], m.names[i+1:]...)
+			break
+		}
+	}
+}
+
+func (m *outgoingMessage) hasHeader(key string) bool {
+	_, ok := m.headers[key]
+	return ok
+}
+
+// writeHead fixes the headers and hands them to the sink
+func (m *outgoingMessage) writeHead(vm *goja.Runtime) {
+	header := http.Header{}
+	for _, key := range m.names {
+		h := m.headers[key]
+		name := http.CanonicalHeaderKey(h.name)
+		header[name] = append(header[name], headerValues(h.value)...)
+	}
+	if m.sink == nil {
+		panic(NewNodeError(vm, "Error", "ERR_METHOD_NOT_IMPLEMENTED", "The _implicitHeader() method is not implemented"))
+	}
+	m.sink.writeHead(header, m.contentLength)
+	m.headersSent = true
+	m.headWritten = true
+}
+
+// headerValues returns the strings a header value stands for: the items of
+// an array, or the value itself
+func headerValues(value goja.Value) []string {
+	if obj, ok := value.(*goja.Object); ok && obj.ClassName() == "Array" {
+		values := make([]string, obj.Get("length").ToInteger())
+		for i := range values {
+			values[i] = obj.Get(strconv.Itoa(i)).String()
+		}
+		return values
+	}
+	return []string{value.String()}
+}
+
+// eachHeader calls fn with the headers given as an object or as a flat list
+// of names and values
+func eachHeader(vm *goja.Runtime, headers goja.Value, fn func(name string, value goja.Value)) {
+	obj, ok := headers.(*goja.Object)
+	if !ok {
+		return
+	}
+	if obj.ClassName() == "Array" {
+		length := int(obj.Get("length").ToInteger())
+		for i := 0; i+1 < length; i += 2 {
+			fn(obj.Get(strconv.Itoa(i)).String(), obj.Get(strconv.Itoa(i+1)))
+		}
+		return
+	}
+	for _, key := range obj.Keys() {
+		fn(key, obj.Get(key))
+	}
+}
+
+// chunkLength returns the number of bytes chunk is written as
+func chunkLength(vm *goja.Runtime, chunk, encoding goja.Value) int {
+	if str, ok := chunk.Export().(string); ok {
+		enc := encodingUTF8
+		if !isNullish(encoding) {
+			enc = bufferOf(vm).encoding(encoding)
+		}
+		return len(encodeString(str, enc))
+	}
+	data, _ := bufferOf(vm).uint8Bytes(chunk)
+	return len(data)
+}
+
+// isToken reports whether s is a valid HTTP token, as header names and
+// methods must be
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r >= 0x7f || r <= ' ' || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateHeaderName throws ERR_INVALID_HTTP_TOKEN unless name is a valid
+// header name, and returns it
+func validateHeaderName(vm *goja.Runtime, name goja.Value) string {
+	str, ok := name.Export().(string)
+	if !ok || !isToken(str) {
+		panic(NewNodeError(vm, "TypeError", "ERR_INVALID_HTTP_TOKEN",
+			"Header name must be a valid HTTP token [\""+name.String()+"\"]"))
+	}
+	return str
+}
+
+// validateHeaderValue throws unless value can be sent as the value of the
+// header name
+func validateHeaderValue(vm *goja.Runtime, name string, value goja.Value) {
+	if value == nil || goja.IsUndefined(value) {
+		panic(NewNodeError(vm, "TypeError", "ERR_HTTP_INVALID_HEADER_VALUE",
+			"Invalid value \"undefined\" for header \""+name+"\""))
+	}
+	for _, v := range headerValues(value) {
+		for _, r := range v {
+			if r > 0xff || r < ' ' && r != '\t' || r == 0x7f {
+				panic(NewNodeError(vm, "TypeError", "ERR_INVALID_CHAR",
+					"Invalid character in header content [\""+name+"\"]"))
+			}
+		}
+	}
+}
+
+// headersSentError creates the error thrown when the headers of a message
+// change after they were sent
+func headersSentError(vm *goja.Runtime, op string) *goja.Object {
+	return NewNodeError(vm, "Error", "ERR_HTTP_HEADERS_SENT",
+		"Cannot "+op+" headers after they are sent to the client")
+}
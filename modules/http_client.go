@@ -0,0 +1,608 @@
+package modules
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// Idle connections of http.globalAgent are closed after this long, as in
+// Node.js
+const httpAgentTimeout = 5 * time.Second
+
+// httpAgent is the state of an http.Agent: the transport whose connections
+// its requests share
+type httpAgent struct {
+	transport *http.Transport
+	// unix holds a transport per Unix socket path
+	unix map[string]*http.Transport
+}
+
+// clientExchange is the state of an http.ClientRequest. The request is
+// sent by net/http once its head is written, with the body streamed through
+// a pipe.
+type clientExchange struct {
+	c         *httpClasses
+	obj       *goja.Object
+	transport *http.Transport
+
+	method   string
+	url      string
+	address  string
+	port     int
+	ctx      context.Context
+	cancel   context.CancelFunc
+	body     *io.PipeWriter
+	trailers http.Header
+
+	res      *goja.Object
+	complete bool
+
+	// timer emits 'timeout' once the request is idle for timeout
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+func newHTTPAgent(keepAlive bool, maxSockets int, idleTimeout time.Duration) *httpAgent {
+	return &httpAgent{
+		transport: &http.Transport{
+			DialContext:            (&net.Dialer{}).DialContext,
+			DisableKeepAlives:      !keepAlive,
+			DisableCompression:     true,
+			MaxConnsPerHost:        maxSockets,
+			MaxIdleConnsPerHost:    256,
+			IdleConnTimeout:        idleTimeout,
+			MaxResponseHeaderBytes: httpMaxHeaderSize,
+		},
+		unix: map[string]*http.Transport{},
+	}
+}
+
+// transportFor returns the transport of requests to the Unix socket path,
+// or to TCP addresses if path is empty
+func (a *httpAgent) transportFor(path string) *http.Transport {
+	if path == "" {
+		return a.transport
+	}
+	t, ok := a.unix[path]
+	if !ok {
+		t = a.transport.Clone()
+		t.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+		a.unix[path] = t
+	}
+	return t
+}
+
+func (a *httpAgent) closeIdleConnections() {
+	a.transport.CloseIdleConnections()
+	for _, t := range a.unix {
+		t.CloseIdleConnections()
+	}
+}
+
+// setupClient creates http.Agent and http.ClientRequest
+func (c *httpClasses) setupClient() {
+	vm := c.vm
+	streams := c.streams
+	emitter, _ := builtinExports(vm, "events")
+	agentKey := goja.NewSymbol("httpAgent")
+	clientKey := goja.NewSymbol("clientRequest")
+
+	agentOf := func(v goja.Value) (*httpAgent, bool) {
+		if obj, ok := v.(*goja.Object); ok {
+			a, ok := exportSymbol(obj, agentKey).(*httpAgent)
+			return a, ok
+		}
+		return nil, false
+	}
+
+	// http.Agent([options]) pools the connections of the requests using it.
+	// Connections are only kept open between requests with keepAlive.
+	var agentProto *goja.Object
+	c.agent, agentProto = streams.newClass("Agent", emitter.ToObject(vm), func(this *goja.Object, args []goja.Value) {
+		opts, _ := argAt(args, 0).(*goja.Object)
+		if opts == nil {
+			opts = vm.NewObject()
+		}
+		keepAlive := opts.Get("keepAlive") != nil && opts.Get("keepAlive").ToBoolean()
+		maxSockets := math.Inf(1)
+		if v := opts.Get("maxSockets"); !isNullish(v) {
+			maxSockets = v.ToFloat()
+		}
+		var idleTimeout time.Duration
+		if v := opts.Get("timeout"); !isNullish(v) {
+			idleTimeout = time.Duration(v.ToInteger()) * time.Millisecond
+		}
+		limit := 0
+		if !math.IsInf(maxSockets, 1) {
+			limit = int(maxSockets)
+		}
+
+		this.DefineDataPropertySymbol(agentKey, vm.ToValue(newHTTPAgent(keepAlive, limit, idleTimeout)), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+		this.Set("options", opts)
+		this.Set("keepAlive", keepAlive)
+		this.Set("maxSockets", maxSockets)
+		this.Set("maxFreeSockets", 256)
+		this.Set("defaultPort", 80)
+		this.Set("protocol", "http:")
+	})
+	// destroy closes the idle connections of the agent
+	agentProto.Set("destroy", func(call goja.FunctionCall) goja.Value {
+		if a, ok := agentOf(call.This); ok {
+			a.closeIdleConnections()
+		}
+		return goja.Undefined()
+	})
+
+	globalOpts := vm.NewObject()
+	globalOpts.Set("keepAlive", true)
+	globalOpts.Set("timeout", httpAgentTimeout.Milliseconds())
+	c.globalAgent, _ = vm.New(c.agent, globalOpts)
+
+	clientOf := func(this goja.Value) *clientExchange {
+		if obj, ok := this.(*goja.Object); ok {
+			if e, ok := exportSymbol(obj, clientKey).(*clientExchange); ok {
+				return e
+			}
+		}
+		panic(NewNodeError(vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be of type ClientRequest"))
+	}
+
+	// http.ClientRequest(url[, options][, callback]) is the request made by
+	// http.request. It is sent once its head is written and emits
+	// 'response' with an IncomingMessage.
+	var proto *goja.Object
+	c.clientRequest, proto = streams.newClass("ClientRequest", c.outgoingMessage, func(this *goja.Object, args []goja.Value) {
+		e := &clientExchange{c: c, obj: this}
+		m := c.initOutgoing(this, e, false)
+		this.DefineDataPropertySymbol(clientKey, vm.ToValue(e), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+
+		opts, cb := requestOptions(vm, args)
+		get := func(name string) goja.Value {
+			if v := opts.Get(name); !isNullish(v) {
+				return v
+			}
+			return nil
+		}
+
+		if v := get("protocol"); v != nil && v.String() != "http:" {
+			panic(NewNodeError(vm, "TypeError", "ERR_INVALID_PROTOCOL",
+				"Protocol \""+v.String()+"\" not supported. Expected \"http:\""))
+		}
+
+		a, ok := c.globalAgent, true
+		switch v := opts.Get("agent"); {
+		case isNullish(v):
+		case v.Export() == false:
+			a, _ = vm.New(c.agent)
+		default:
+			a, ok = v.(*goja.Object)
+			if _, isAgent := agentOf(v); !ok || !isAgent {
+				panic(ErrInvalidArgType(vm, "options.agent", "of type Agent-like Object, undefined, or false", v))
+			}
+		}
+		agent, _ := agentOf(a)
+
+		method := "GET"
+		if v := get("method"); v != nil {
+			method = v.String()
+			if !isToken(method) {
+				panic(NewNodeError(vm, "TypeError", "ERR_INVALID_HTTP_TOKEN", "Method must be a valid HTTP token [\""+method+"\"]"))
+			}
+			method = strings.ToUpper(method)
+		}
+		path := "/"
+		if v := get("path"); v != nil {
+			path = v.String()
+			if strings.IndexFunc(path, func(r rune) bool { return r <= ' ' }) >= 0 {
+				panic(NewNodeError(vm, "TypeError", "ERR_UNESCAPED_CHARACTERS", "Request path contains unescaped characters"))
+			}
+		}
+		host := "localhost"
+		if v := get("hostname"); v != nil {
+			host = v.String()
+		} else if v := get("host"); v != nil {
+			host = v.String()
+		}
+		defaultPort := 80
+		if v := get("defaultPort"); v != nil {
+			defaultPort = int(v.ToInteger())
+		}
+		port := defaultPort
+		if v := get("port"); v != nil {
+			port = portArg(vm, v, "options.port", true)
+		}
+		socketPath := ""
+		if v := get("socketPath"); v != nil {
+			socketPath = v.String()
+			checkWrite(vm, socketPath)
+		}
+
+		if headers := get("headers"); headers != nil {
+			eachHeader(vm, headers, func(name string, value goja.Value) {
+				name = validateHeaderName(vm, vm.ToValue(name))
+				validateHeaderValue(vm, name, value)
+				m.setHeader(name, value)
+			})
+		}
+		setHost := get("setHost") == nil || get("setHost").ToBoolean()
+		if setHost && !m.hasHeader("host") {
+			hostHeader := host
+			if strings.Contains(host, ":") {
+				hostHeader = "[" + host + "]"
+			}
+			if port != defaultPort {
+				hostHeader += ":" + strconv.Itoa(port)
+			}
+			m.setHeader("Host", vm.ToValue(hostHeader))
+		}
+		if auth := get("auth"); auth != nil && !m.hasHeader("authorization") {
+			m.setHeader("Authorization", vm.ToValue("Basic "+base64.StdEncoding.EncodeToString([]byte(auth.String()))))
+		}
+
+		e.method = method
+		e.transport = agent.transportFor(socketPath)
+		e.url = "http://" + net.JoinHostPort(host, strconv.Itoa(port)) + path
+		e.address, e.port = host, port
+		if socketPath != "" {
+			e.url = "http://localhost" + path
+			e.address, e.port = socketPath, -1
+		}
+		e.ctx, e.cancel = context.WithCancel(context.Background())
+
+		this.Set("agent", a)
+		this.Set("method", method)
+		this.Set("path", path)
+		this.Set("host", host)
+		this.Set("protocol", "http:")
+		this.Set("aborted", false)
+		this.Set("reusedSocket", false)
+		this.Set("maxHeadersCount", nil)
+		if cb != nil {
+			callMethod(vm, this, "once", vm.ToValue("response"), cb)
+		}
+		if v := get("timeout"); v != nil {
+			e.setTimeout(time.Duration(v.ToInteger()) * time.Millisecond)
+		}
+	})
+
+	// setTimeout(timeout[, callback]) emits 'timeout' once the request has
+	// been idle for timeout milliseconds. It does not abort the request.
+	proto.Set("setTimeout", func(call goja.FunctionCall) goja.Value {
+		e := clientOf(call.This)
+		if cb, ok := goja.AssertFunction(call.Argument(1)); ok && cb != nil {
+			callMethod(vm, e.obj, "once", vm.ToValue("timeout"), call.Argument(1))
+		}
+		e.setTimeout(time.Duration(call.Argument(0).ToInteger()) * time.Millisecond)
+		return call.This
+	})
+	for _, name := range []string{"setNoDelay", "setSocketKeepAlive"} {
+		proto.Set(name, func(call goja.FunctionCall) goja.Value { return goja.Undefined() })
+	}
+
+	// abort is the legacy way to destroy a request
+	proto.Set("abort", func(call goja.FunctionCall) goja.Value {
+		e := clientOf(call.This)
+		if e.obj.Get("aborted").ToBoolean() {
+			return goja.Undefined()
+		}
+		e.obj.Set("aborted", true)
+		c.loop.NextTick(func() {
+			if _, err := Emit(vm, e.obj, "abort"); err != nil {
+				panic(err)
+			}
+		})
+		streams.state(e.obj).destroy(nil, nil)
+		return goja.Undefined()
+	})
+
+	// _destroy aborts the exchange. Requests destroyed before their response
+	// fail with "socket hang up", unless abort() was called.
+	proto.Set("_destroy", func(call goja.FunctionCall) goja.Value {
+		e := clientOf(call.This)
+		err := call.Argument(0)
+		if isNullish(err) && e.res == nil && !e.complete && !e.obj.Get("aborted").ToBoolean() {
+			err = NewNodeError(vm, "Error", "ECONNRESET", "socket hang up")
+		}
+		e.abort()
+		if cb, ok := goja.AssertFunction(call.Argument(1)); ok {
+			if _, e := cb(goja.Undefined(), err); e != nil {
+				panic(e)
+			}
+		}
+		return goja.Undefined()
+	})
+}
+
+// requestOptions merges the URL and options arguments of http.request into
+// one options object and returns it with the callback, if any
+func requestOptions(vm *goja.Runtime, args []goja.Value) (*goja.Object, goja.Value) {
+	opts := vm.NewObject()
+	var cb goja.Value
+	merge := func(from *goja.Object) {
+		for _, key := range from.Keys() {
+			opts.Set(key, from.Get(key))
+		}
+	}
+
+	for i, arg := range args {
+		if _, ok := goja.AssertFunction(arg); ok {
+			cb = arg
+			break
+		}
+		if i > 1 {
+			break
+		}
+		input := ""
+		switch v := arg.(type) {
+		case *goja.Object:
+			// URL objects are used like the string they stand for
+			href, ok := "", false
+			if h := v.Get("href"); h != nil {
+				href, ok = h.Export().(string)
+			}
+			if !ok || i > 0 {
+				merge(v)
+				continue
+			}
+			input = href
+		default:
+			str, ok := arg.Export().(string)
+			if !ok || i > 0 {
+				if isNullish(arg) {
+					continue
+				}
+				panic(ErrInvalidArgType(vm, "options", "of type object", arg))
+			}
+			input = str
+		}
+
+		u, err := url.Parse(input)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			e := NewNodeError(vm, "TypeError", "ERR_INVALID_URL", "Invalid URL")
+			e.Set("input", input)
+			panic(e)
+		}
+		opts.Set("protocol", u.Scheme+":")
+		opts.Set("hostname", u.Hostname())
+		if p := u.Port(); p != "" {
+			opts.Set("port", p)
+		}
+		path := u.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+		if u.RawQuery != "" {
+			path += "?" + u.RawQuery
+		}
+		opts.Set("path", path)
+		if u.User != nil {
+			auth, _ := url.PathUnescape(u.User.String())
+			opts.Set("auth", auth)
+		}
+	}
+	return opts, cb
+}
+
+// writeHead starts sending the request. Bodies of unknown length are sent
+// chunked.
+func (e *clientExchange) writeHead(header http.Header, contentLength int64) {
+	c := e.c
+	var body io.ReadCloser
+	if contentLength != 0 {
+		var pr *io.PipeReader
+		pr, e.body = io.Pipe()
+		body = pr
+	}
+	req, err := http.NewRequestWithContext(e.ctx, e.method, e.url, body)
+	if err != nil {
+		c.loop.NextTick(func() { e.fail(err) })
+		return
+	}
+
+	if host := header.Get("Host"); host != "" {
+		req.Host = host
+	}
+	delete(header, "Host")
+	if strings.EqualFold(header.Get("Connection"), "close") {
+		req.Close = true
+	}
+	if n, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil {
+		contentLength = n
+	}
+	delete(header, "Content-Length")
+	if strings.EqualFold(header.Get("Transfer-Encoding"), "chunked") {
+		contentLength = -1
+	}
+	delete(header, "Transfer-Encoding")
+	// Node.js sends no User-Agent of its own
+	if _, ok := header["User-Agent"]; !ok {
+		header["User-Agent"] = []string{""}
+	}
+	req.Header = header
+	if body != nil {
+		req.ContentLength = contentLength
+		if contentLength < 0 {
+			e.trailers = http.Header{}
+			req.Trailer = e.trailers
+		}
+	}
+
+	// A halted run cancels the request; it is done with once it closes
+	unclose := c.loop.AddCloser(e.cancel)
+	callMethod(c.vm, e.obj, "once", c.vm.ToValue("close"), c.vm.ToValue(func(goja.FunctionCall) goja.Value {
+		unclose()
+		return goja.Undefined()
+	}))
+	c.loop.Ref()
+	go func() {
+		resp, err := e.transport.RoundTrip(req)
+		c.loop.RunOnLoop(func(*goja.Runtime) {
+			e.response(resp, err)
+		})
+		c.loop.Unref()
+	}()
+	e.touch()
+}
+
+func (e *clientExchange) write(data []byte, flush bool, done func(err error)) {
+	body := e.body
+	if body == nil || len(data) == 0 {
+		e.c.loop.NextTick(func() { done(nil) })
+		return
+	}
+	runAsync(e.c.loop, func() (fsResult, error) {
+		_, err := body.Write(data)
+		if errors.Is(err, io.ErrClosedPipe) {
+			err = syscall.EPIPE
+		}
+		return nil, netError(err, "write", "", -1)
+	}, func(_ fsResult, err error) {
+		e.touch()
+		done(err)
+	})
+}
+
+func (e *clientExchange) end(trailers http.Header, done func(err error)) {
+	if e.body != nil {
+		for name, values := range trailers {
+			e.trailers[name] = values
+		}
+		e.body.Close()
+	}
+	e.c.loop.NextTick(func() { done(nil) })
+}
+
+// abort cancels a request whose response is not complete
+func (e *clientExchange) abort() {
+	e.stopTimer()
+	if e.complete {
+		return
+	}
+	e.complete = true
+	e.cancel()
+	if e.body != nil {
+		e.body.CloseWithError(context.Canceled)
+	}
+	if e.res != nil {
+		e.c.abortIncoming(e.res)
+	}
+}
+
+// response emits 'response' once the head of the response has arrived, or
+// fails the request
+func (e *clientExchange) response(resp *http.Response, err error) {
+	c := e.c
+	vm := c.vm
+	s := c.streams.state(e.obj)
+	if s.destroyed {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return
+	}
+	if err != nil {
+		e.fail(err)
+		return
+	}
+	e.touch()
+
+	res, m := c.newIncoming(goja.Null(), resp.Body, resp.ProtoMajor, resp.ProtoMinor)
+	m.trailer = func() http.Header { return resp.Trailer }
+	m.touch = e.touch
+	header := resp.Header
+	if len(resp.TransferEncoding) > 0 {
+		header = header.Clone()
+		header["Transfer-Encoding"] = resp.TransferEncoding
+	}
+	headers, raw := incomingHeaders(vm, "", header)
+	res.Set("headers", headers)
+	res.Set("rawHeaders", raw)
+	res.Set("statusCode", resp.StatusCode)
+	res.Set("statusMessage", strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode)+" "))
+	res.Set("req", e.obj)
+	e.res = res
+
+	// The request closes with its response
+	callMethod(vm, res, "once", vm.ToValue("end"), vm.ToValue(func(goja.FunctionCall) goja.Value {
+		e.complete = true
+		e.stopTimer()
+		return goja.Undefined()
+	}))
+	callMethod(vm, res, "once", vm.ToValue("close"), vm.ToValue(func(goja.FunctionCall) goja.Value {
+		s.destroy(nil, nil)
+		return goja.Undefined()
+	}))
+
+	// Responses nobody listens for are discarded
+	if !s.emit("response", res) {
+		c.streams.state(res).resume()
+	}
+}
+
+// fail destroys the request with the error err of the transport
+func (e *clientExchange) fail(err error) {
+	vm := e.c.vm
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	var errValue goja.Value
+	switch {
+	case errors.As(err, &dnsErr), errors.As(err, &opErr) && opErr.Op == "dial":
+		errValue = jsError(vm, netError(err, "connect", e.address, e.port))
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, syscall.ECONNRESET):
+		errValue = NewNodeError(vm, "Error", "ECONNRESET", "socket hang up")
+	default:
+		errValue = jsError(vm, err)
+	}
+	e.stopTimer()
+	e.c.streams.state(e.obj).destroy(errValue, nil)
+}
+
+func (e *clientExchange) setTimeout(timeout time.Duration) {
+	e.stopTimer()
+	e.timeout = timeout
+	e.touch()
+}
+
+// touch restarts the idle timer after activity on the request
+func (e *clientExchange) touch() {
+	if e.timeout <= 0 || e.complete {
+		return
+	}
+	if e.timer != nil {
+		e.timer.Reset(e.timeout)
+		return
+	}
+	loop := e.c.loop
+	e.timer = time.AfterFunc(e.timeout, func() {
+		loop.RunOnLoop(func(vm *goja.Runtime) {
+			if e.timer == nil || e.complete {
+				return
+			}
+			if _, err := Emit(vm, e.obj, "timeout"); err != nil {
+				panic(err)
+			}
+		})
+	})
+}
+
+func (e *clientExchange) stopTimer() {
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+}
@@ -0,0 +1,645 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// Defaults of the timeouts of http.Server, in milliseconds
+const (
+	httpKeepAliveTimeout = 5000
+	httpHeadersTimeout   = 60000
+	httpRequestTimeout   = 300000
+)
+
+// httpServer is the state of an http.Server. A listening server holds a
+// reference on the loop unless it was unref'd.
+type httpServer struct {
+	c        *httpClasses
+	obj      *goja.Object
+	srv      *http.Server
+	listener net.Listener
+	// halted is closed if the run is halted, abandoning the requests in
+	// flight. unclose unregisters the closer of the listening server.
+	halted  chan struct{}
+	unclose func()
+
+	listening bool
+	refed     bool
+	holding   bool
+
+	// conns tracks the state of open connections for closeAllConnections
+	// and closeIdleConnections
+	mu    sync.Mutex
+	conns map[net.Conn]http.ConnState
+}
+
+// serverExchange is a request being handled by a script. The net/http
+// handler goroutine waits for the operations the response queues on ops;
+// closing ops completes the response.
+type serverExchange struct {
+	vm   *goja.Runtime
+	loop AsyncLoop
+	w    http.ResponseWriter
+	r    *http.Request
+	ops  chan func()
+
+	req *goja.Object
+	res *goja.Object
+	// head writes the status line and headers with the next operation
+	head   func()
+	closed bool
+}
+
+func (srv *httpServer) hold() {
+	if srv.listening && srv.refed && !srv.holding {
+		srv.holding = true
+		srv.c.loop.Ref()
+	}
+}
+
+func (srv *httpServer) release() {
+	if srv.holding {
+		srv.holding = false
+		srv.c.loop.Unref()
+	}
+}
+
+// setupServer creates http.Server and http.ServerResponse
+func (c *httpClasses) setupServer() error {
+	vm := c.vm
+	streams := c.streams
+	emitter, err := builtinExports(vm, "events")
+	if err != nil {
+		return err
+	}
+	serverKey := goja.NewSymbol("httpServer")
+
+	serverOf := func(this goja.Value) *httpServer {
+		if obj, ok := this.(*goja.Object); ok {
+			if srv, ok := exportSymbol(obj, serverKey).(*httpServer); ok {
+				return srv
+			}
+		}
+		panic(NewNodeError(vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be of type Server"))
+	}
+
+	// http.Server([options][, requestListener]) emits 'request' with an
+	// IncomingMessage and a ServerResponse for every request
+	var proto *goja.Object
+	c.server, proto = streams.newClass("Server", emitter.ToObject(vm), func(this *goja.Object, args []goja.Value) {
+		options, listener := argAt(args, 0), argAt(args, 1)
+		if _, ok := goja.AssertFunction(options); ok {
+			options, listener = goja.Undefined(), options
+		}
+		srv := &httpServer{c: c, obj: this, refed: true, conns: map[net.Conn]http.ConnState{}, halted: make(chan struct{})}
+		this.DefineDataPropertySymbol(serverKey, vm.ToValue(srv), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+
+		this.Set("timeout", 0)
+		this.Set("keepAliveTimeout", httpKeepAliveTimeout)
+		this.Set("headersTimeout", httpHeadersTimeout)
+		this.Set("requestTimeout", httpRequestTimeout)
+		this.Set("maxHeaderSize", httpMaxHeaderSize)
+		this.Set("maxHeadersCount", nil)
+		if opts, ok := options.(*goja.Object); ok {
+			for _, name := range []string{"keepAliveTimeout", "headersTimeout", "requestTimeout", "maxHeaderSize"} {
+				if v := opts.Get(name); !isNullish(v) {
+					this.Set(name, v)
+				}
+			}
+		}
+		if _, ok := goja.AssertFunction(listener); ok {
+			callMethod(vm, this, "on", vm.ToValue("request"), listener)
+		}
+	})
+
+	// listen([port[, host[, backlog]]][, callback]), listen(path[, callback])
+	// or listen(options[, callback]) starts accepting connections
+	proto.Set("listen", func(call goja.FunctionCall) goja.Value {
+		srv := serverOf(call.This)
+		args := call.Arguments
+		if len(args) > 0 {
+			if _, ok := goja.AssertFunction(args[len(args)-1]); ok {
+				callMethod(vm, srv.obj, "once", vm.ToValue("listening"), args[len(args)-1])
+				args = args[:len(args)-1]
+			}
+		}
+		if srv.listening {
+			panic(NewNodeError(vm, "Error", "ERR_SERVER_ALREADY_LISTEN", "Listen method has been called more than once without closing."))
+		}
+		network, host, port := listenArgs(vm, args)
+		srv.listen(network, host, port)
+		return call.This
+	})
+
+	proto.Set("address", func(call goja.FunctionCall) goja.Value {
+		srv := serverOf(call.This)
+		if !srv.listening {
+			return goja.Null()
+		}
+		return addressInfo(vm, srv.listener.Addr())
+	})
+
+	// close stops accepting connections and emits 'close' once the open
+	// ones are done. Idle connections are closed at once.
+	proto.Set("close", func(call goja.FunctionCall) goja.Value {
+		srv := serverOf(call.This)
+		if cb, ok := goja.AssertFunction(call.Argument(0)); ok {
+			listening := srv.listening
+			callMethod(vm, srv.obj, "once", vm.ToValue("close"), vm.ToValue(func(goja.FunctionCall) goja.Value {
+				var err goja.Value = goja.Undefined()
+				if !listening {
+					err = NewNodeError(vm, "Error", "ERR_SERVER_NOT_RUNNING", "Server is not running.")
+				}
+				if _, e := cb(srv.obj, err); e != nil {
+					panic(e)
+				}
+				return goja.Undefined()
+			}))
+		}
+		emitClose := func() {
+			if _, err := Emit(vm, srv.obj, "close"); err != nil {
+				panic(err)
+			}
+		}
+		if !srv.listening {
+			c.loop.NextTick(emitClose)
+			return call.This
+		}
+
+		srv.listening = false
+		hs, unclose := srv.srv, srv.unclose
+		runAsync(c.loop, func() (fsResult, error) {
+			return nil, hs.Shutdown(context.Background())
+		}, func(fsResult, error) {
+			unclose()
+			emitClose()
+		})
+		srv.release()
+		return call.This
+	})
+
+	proto.Set("closeAllConnections", func(call goja.FunctionCall) goja.Value {
+		serverOf(call.This).closeConnections(false)
+		return goja.Undefined()
+	})
+	proto.Set("closeIdleConnections", func(call goja.FunctionCall) goja.Value {
+		serverOf(call.This).closeConnections(true)
+		return goja.Undefined()
+	})
+
+	proto.Set("ref", func(call goja.FunctionCall) goja.Value {
+		srv := serverOf(call.This)
+		srv.refed = true
+		srv.hold()
+		return call.This
+	})
+	proto.Set("unref", func(call goja.FunctionCall) goja.Value {
+		srv := serverOf(call.This)
+		srv.refed = false
+		srv.release()
+		return call.This
+	})
+	proto.DefineAccessorProperty("listening", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(serverOf(call.This).listening)
+	}), nil, goja.FLAG_TRUE, goja.FLAG_FALSE)
+
+	c.setupServerResponse()
+	return nil
+}
+
+// listenArgs parses the arguments of server.listen into the network and
+// address to listen on. port is -1 for Unix sockets, whose path is host.
+func listenArgs(vm *goja.Runtime, args []goja.Value) (network, host string, port int) {
+	first := argAt(args, 0)
+	var portValue goja.Value = goja.Undefined()
+	switch v := first.(type) {
+	case *goja.Object:
+		if path := v.Get("path"); !isNullish(path) {
+			return unixSocket(vm, path.String())
+		}
+		portValue = v.Get("port")
+		if h := v.Get("host"); !isNullish(h) {
+			host = h.String()
+		}
+	default:
+		if str, ok := first.Export().(string); ok {
+			if _, err := strconv.Atoi(str); err != nil {
+				return unixSocket(vm, str)
+			}
+		}
+		portValue = first
+		if h, ok := argAt(args, 1).Export().(string); ok {
+			host = h
+		}
+	}
+	return "tcp", host, portArg(vm, portValue, "options.port", true)
+}
+
+// unixSocket checks that scripts may create or use the socket file path
+func unixSocket(vm *goja.Runtime, path string) (string, string, int) {
+	checkWrite(vm, path)
+	return "unix", path, -1
+}
+
+// portArg validates the port number name, which may be given as a string.
+// A missing port is 0 if allowed.
+func portArg(vm *goja.Runtime, v goja.Value, name string, allowZero bool) int {
+	if isNullish(v) && allowZero {
+		return 0
+	}
+	var port float64 = -1
+	switch p := v.Export().(type) {
+	case int64:
+		port = float64(p)
+	case float64:
+		port = p
+	case string:
+		if n, err := strconv.Atoi(p); err == nil {
+			port = float64(n)
+		}
+	}
+	if port < 0 || port >= 65536 || port != float64(int(port)) || !allowZero && port == 0 {
+		rng := ">= 0 and < 65536"
+		if !allowZero {
+			rng = "> 0 and < 65536"
+		}
+		panic(NewNodeError(vm, "RangeError", "ERR_SOCKET_BAD_PORT",
+			name+" should be "+rng+". Received "+describeReceived(vm, v)+"."))
+	}
+	return int(port)
+}
+
+// addressInfo describes a socket address like server.address(): an object
+// with the address, family and port, or the path of a Unix socket
+func addressInfo(vm *goja.Runtime, addr net.Addr) goja.Value {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return vm.ToValue(addr.String())
+	}
+	info := vm.NewObject()
+	info.Set("address", tcp.IP.String())
+	if tcp.IP.To4() != nil {
+		info.Set("family", "IPv4")
+	} else {
+		info.Set("family", "IPv6")
+	}
+	info.Set("port", tcp.Port)
+	return info
+}
+
+// listen starts serving on a goroutine and emits 'listening', or 'error' if
+// the address cannot be bound
+func (srv *httpServer) listen(network, host string, port int) {
+	vm := srv.c.vm
+	loop := srv.c.loop
+	emit := func(event string, args ...goja.Value) {
+		loop.NextTick(func() {
+			if _, err := Emit(vm, srv.obj, event, args...); err != nil {
+				panic(err)
+			}
+		})
+	}
+
+	address := host
+	if network == "tcp" {
+		address = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		if host == "" {
+			host = "::"
+		}
+		emit("error", jsError(vm, netError(err, "listen", host, port)))
+		return
+	}
+
+	duration := func(name string) time.Duration {
+		return time.Duration(srv.obj.Get(name).ToInteger()) * time.Millisecond
+	}
+	hs := &http.Server{
+		Handler:           srv,
+		IdleTimeout:       duration("keepAliveTimeout"),
+		ReadHeaderTimeout: duration("headersTimeout"),
+		ReadTimeout:       duration("requestTimeout"),
+		MaxHeaderBytes:    int(srv.obj.Get("maxHeaderSize").ToInteger()),
+		ConnState:         srv.trackConn,
+		ErrorLog:          log.New(io.Discard, "", 0),
+	}
+	srv.srv = hs
+	srv.listener = ln
+	srv.unclose = loop.AddCloser(func() {
+		srv.halt()
+		hs.Close()
+	})
+	srv.listening = true
+	srv.hold()
+
+	go func() {
+		if err := hs.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			loop.RunOnLoop(func(*goja.Runtime) {
+				if _, e := Emit(vm, srv.obj, "error", jsError(vm, netError(err, "accept", "", -1))); e != nil {
+					panic(e)
+				}
+			})
+		}
+	}()
+	emit("listening")
+}
+
+func (srv *httpServer) trackConn(conn net.Conn, state http.ConnState) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if state == http.StateClosed || state == http.StateHijacked {
+		delete(srv.conns, conn)
+		return
+	}
+	srv.conns[conn] = state
+}
+
+// halt abandons the requests in flight once the run is halted
+func (srv *httpServer) halt() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	select {
+	case <-srv.halted:
+	default:
+		close(srv.halted)
+	}
+}
+
+// closeConnections closes the open connections, or only the idle ones
+func (srv *httpServer) closeConnections(idle bool) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for conn, state := range srv.conns {
+		if !idle || state == http.StateIdle {
+			conn.Close()
+		}
+	}
+}
+
+// ServeHTTP hands the request to the loop and performs the operations the
+// script queues until the response is complete
+func (srv *httpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Scripts may read the request body while the response is written
+	http.NewResponseController(w).EnableFullDuplex()
+
+	loop := srv.c.loop
+	e := &serverExchange{vm: srv.c.vm, loop: loop, w: w, r: r, ops: make(chan func(), 4)}
+	loop.RunOnLoop(func(*goja.Runtime) {
+		srv.dispatch(e)
+	})
+
+	done := r.Context().Done()
+	for {
+		select {
+		case op, ok := <-e.ops:
+			if !ok {
+				return
+			}
+			op()
+		case <-srv.halted:
+			return
+		case <-done:
+			// The client went away before the response was complete
+			done = nil
+			loop.RunOnLoop(func(*goja.Runtime) {
+				e.disconnected(srv.c)
+			})
+		}
+	}
+}
+
+// dispatch emits 'request' for a new exchange
+func (srv *httpServer) dispatch(e *serverExchange) {
+	c := srv.c
+	vm := c.vm
+	r := e.r
+
+	socket := vm.NewObject()
+	if local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		setSocketAddress(socket, "local", local.String())
+	}
+	setSocketAddress(socket, "remote", r.RemoteAddr)
+
+	req, m := c.newIncoming(socket, r.Body, r.ProtoMajor, r.ProtoMinor)
+	m.trailer = func() http.Header { return r.Trailer }
+	header := r.Header
+	if len(r.TransferEncoding) > 0 {
+		header = header.Clone()
+		header["Transfer-Encoding"] = r.TransferEncoding
+	}
+	headers, raw := incomingHeaders(vm, r.Host, header)
+	req.Set("headers", headers)
+	req.Set("rawHeaders", raw)
+	req.Set("method", r.Method)
+	req.Set("url", r.RequestURI)
+
+	res, err := vm.New(c.serverResponse, req)
+	if err != nil {
+		panic(err)
+	}
+	_, out := c.outgoing(res)
+	out.sink = e
+	e.req, e.res = req, res
+
+	// Bodies nobody reads are discarded once the response is done
+	callMethod(vm, res, "once", vm.ToValue("finish"), vm.ToValue(func(goja.FunctionCall) goja.Value {
+		s := c.streams.state(req)
+		if s.r.flowing == flowNone && !s.r.readableListening && !s.destroyed {
+			m.body = nil
+			s.resume()
+		}
+		return goja.Undefined()
+	}))
+
+	if _, err := Emit(vm, srv.obj, "request", req, res); err != nil {
+		panic(err)
+	}
+}
+
+// setSocketAddress sets the address and port of one end of a connection on
+// the socket object of a request
+func setSocketAddress(socket *goja.Object, end, addr string) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+	ip := net.ParseIP(host)
+	socket.Set(end+"Address", host)
+	if n, err := strconv.Atoi(port); err == nil {
+		socket.Set(end+"Port", n)
+	}
+	if ip != nil && ip.To4() != nil {
+		socket.Set(end+"Family", "IPv4")
+	} else if ip != nil {
+		socket.Set(end+"Family", "IPv6")
+	}
+}
+
+// run queues op for the handler goroutine and calls done with its result
+// on the loop
+func (e *serverExchange) run(op func() error, done func(err error)) {
+	if e.closed {
+		e.loop.NextTick(func() { done(systemError(syscall.EPIPE, "write", "")) })
+		return
+	}
+	head := e.head
+	e.head = nil
+	e.loop.Ref()
+	e.ops <- func() {
+		if head != nil {
+			head()
+		}
+		err := op()
+		e.loop.RunOnLoop(func(*goja.Runtime) { done(err) })
+		e.loop.Unref()
+	}
+}
+
+func (e *serverExchange) writeHead(header http.Header, contentLength int64) {
+	vm := e.vm
+	code := e.res.Get("statusCode")
+	status := int(code.ToInteger())
+	if status < 100 || status > 999 {
+		panic(NewNodeError(vm, "RangeError", "ERR_HTTP_INVALID_STATUS_CODE", "Invalid status code: "+code.String()))
+	}
+	if !e.res.Get("sendDate").ToBoolean() {
+		header["Date"] = nil
+	}
+	// net/http would compute the length of short bodies itself, but Node.js
+	// streams any body whose length end() did not know
+	hasBody := e.r.Method != "HEAD" && status >= 200 && status != 204 && status != 304
+	if hasBody && header.Get("Content-Length") == "" && header.Get("Transfer-Encoding") == "" {
+		if contentLength >= 0 {
+			header.Set("Content-Length", strconv.FormatInt(contentLength, 10))
+		} else if e.r.ProtoAtLeast(1, 1) {
+			header.Set("Transfer-Encoding", "chunked")
+		}
+	}
+
+	w := e.w
+	e.head = func() {
+		for name, values := range header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(status)
+	}
+}
+
+func (e *serverExchange) write(data []byte, flush bool, done func(err error)) {
+	w := e.w
+	e.run(func() error {
+		if len(data) > 0 && e.r.Method != "HEAD" {
+			if _, err := w.Write(data); err != nil && !errors.Is(err, http.ErrBodyNotAllowed) {
+				return netError(err, "write", "", -1)
+			}
+		}
+		if flush {
+			http.NewResponseController(w).Flush()
+		}
+		return nil
+	}, done)
+}
+
+func (e *serverExchange) end(trailers http.Header, done func(err error)) {
+	w := e.w
+	e.run(func() error {
+		for name, values := range trailers {
+			w.Header()[http.TrailerPrefix+name] = values
+		}
+		return nil
+	}, done)
+	if !e.closed {
+		e.closed = true
+		close(e.ops)
+	}
+}
+
+// abort closes the connection of a response that was destroyed
+func (e *serverExchange) abort() {
+	if e.closed {
+		return
+	}
+	e.closed = true
+	e.ops <- func() {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// disconnected fails the request and response of an exchange whose client
+// went away
+func (e *serverExchange) disconnected(c *httpClasses) {
+	if e.res == nil || e.closed {
+		return
+	}
+	c.abortIncoming(e.req)
+	c.streams.state(e.res).destroy(nil, nil)
+}
+
+// setupServerResponse creates ServerResponse, the OutgoingMessage a server
+// answers a request with
+func (c *httpClasses) setupServerResponse() {
+	vm := c.vm
+
+	var proto *goja.Object
+	c.serverResponse, proto = c.streams.newClass("ServerResponse", c.outgoingMessage, func(this *goja.Object, args []goja.Value) {
+		c.initOutgoing(this, nil, true)
+		req := argAt(args, 0)
+		this.Set("req", req)
+		if obj, ok := req.(*goja.Object); ok {
+			this.Set("socket", obj.Get("socket"))
+		}
+		this.Set("statusCode", 200)
+		this.Set("statusMessage", goja.Undefined())
+		this.Set("sendDate", true)
+	})
+	proto.DefineAccessorProperty("connection", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return call.This.ToObject(vm).Get("socket")
+	}), nil, goja.FLAG_TRUE, goja.FLAG_FALSE)
+
+	// writeHead(statusCode[, statusMessage][, headers]) sets the status and
+	// headers, which cannot change afterwards
+	proto.Set("writeHead", func(call goja.FunctionCall) goja.Value {
+		_, m := c.outgoing(call.This)
+		obj := call.This.ToObject(vm)
+		if m.headersSent {
+			panic(NewNodeError(vm, "Error", "ERR_HTTP_HEADERS_SENT", "Cannot write headers after they are sent to the client"))
+		}
+		code := call.Argument(0)
+		if status := code.ToInteger(); status < 100 || status > 999 {
+			panic(NewNodeError(vm, "RangeError", "ERR_HTTP_INVALID_STATUS_CODE", "Invalid status code: "+code.String()))
+		}
+		headers := call.Argument(1)
+		if msg, ok := headers.Export().(string); ok {
+			obj.Set("statusMessage", msg)
+			headers = call.Argument(2)
+		}
+		obj.Set("statusCode", code.ToInteger())
+		if isNullish(obj.Get("statusMessage")) {
+			if text, ok := httpStatusCodes[int(code.ToInteger())]; ok {
+				obj.Set("statusMessage", text)
+			} else {
+				obj.Set("statusMessage", "unknown")
+			}
+		}
+		eachHeader(vm, headers, func(name string, value goja.Value) {
+			name = validateHeaderName(vm, vm.ToValue(name))
+			validateHeaderValue(vm, name, value)
+			m.setHeader(name, value)
+		})
+		m.headersSent = true
+		return call.This
+	})
+}
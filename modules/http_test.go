@@ -0,0 +1,106 @@
+package modules_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+
+	"gojs/internal/jstest"
+	"gojs/modules"
+	"gojs/runtime"
+)
+
+func TestHTTPServerAndClient(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const http = require('http');
+		const server = http.createServer((req, res) => {
+			let body = '';
+			req.setEncoding('utf8');
+			req.on('data', (chunk) => body += chunk);
+			req.on('end', () => {
+				res.setHeader('X-Path', req.url);
+				res.end(req.method + ' ' + body);
+			});
+		});
+		server.listen(0, '127.0.0.1', () => {
+			const { port } = server.address();
+			const req = http.request({ port, host: '127.0.0.1', path: '/upload', method: 'POST' }, (res) => {
+				let body = '';
+				res.setEncoding('utf8');
+				res.on('data', (chunk) => body += chunk);
+				res.on('end', () => {
+					console.log(res.statusCode, res.headers['x-path'], body);
+					server.close(() => console.log('closed'));
+				});
+			});
+			req.end('data');
+		});
+	`, "200 /upload POST data\nclosed\n")
+}
+
+func TestHTTPHeaders(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const http = require('http');
+		const server = http.createServer((req, res) => {
+			console.log(req.headers['x-multi'], req.headers.host === '127.0.0.1:' + server.address().port);
+			res.writeHead(404, { 'X-One': '1' });
+			res.write('chunk');
+			console.log(res.headersSent);
+			res.end();
+		});
+		server.listen(0, '127.0.0.1', () => {
+			http.get({
+				port: server.address().port,
+				host: '127.0.0.1',
+				headers: { 'X-Multi': ['a', 'b'] },
+			}, (res) => {
+				console.log(res.statusCode, res.statusMessage, res.headers['x-one'], res.headers['transfer-encoding']);
+				res.resume();
+				res.on('end', () => server.close());
+			});
+		});
+	`, "a, b true\ntrue\n404 Not Found 1 chunked\n")
+}
+
+func TestHTTPConnectionErrors(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const http = require('http');
+		http.get('http://127.0.0.1:1/').on('error', (e) => console.log(e.code, e.message));
+	`, "ECONNREFUSED connect ECONNREFUSED 127.0.0.1:1\n")
+}
+
+func TestHTTPServerServesGoClients(t *testing.T) {
+	var out bytes.Buffer
+	rt := runtime.NewWithOptions(runtime.Options{
+		Console: modules.NewTextSink(&out, &out),
+		Timeout: jstest.DefaultTimeout,
+	})
+	addr := make(chan string, 1)
+	rt.VM.Set("reportAddress", func(a string) { addr <- a })
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := rt.RunScript(`
+			const server = require('http').createServer((req, res) => {
+				res.end('hello ' + req.url);
+				server.close();
+			});
+			server.listen(0, '127.0.0.1', () => reportAddress('127.0.0.1:' + server.address().port));
+		`, "test.js")
+		done <- err
+	}()
+
+	res, err := http.Get("http://" + <-addr + "/go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "hello /go" {
+		t.Errorf("body = %q", body)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("%v\noutput:\n%s", err, out.String())
+	}
+}
@@ -0,0 +1,1360 @@
+package modules
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dop251/goja"
+)
+
+// DefaultInspectDepth is the depth console.log and util.inspect show nested
+// objects to
+const DefaultInspectDepth = 2
+
+const (
+	// inspectBreakLength is the line width beyond which entries are put on
+	// separate lines
+	inspectBreakLength = 128
+	// inspectCompact is how many inner levels may be combined on one line
+	inspectCompact = 3
+	// inspectMaxArrayLength is how many entries of arrays, maps and sets are shown
+	inspectMaxArrayLength = 100
+	// inspectMaxBufferLength is how many bytes of an ArrayBuffer are shown
+	inspectMaxBufferLength = 50
+)
+
+// InspectOptions controls how Inspect formats a value
+type InspectOptions struct {
+	// Depth is how many levels of nested objects are shown; deeper ones are
+	// abbreviated as [Object]. A negative depth shows everything.
+	Depth int
+	// Colors adds ANSI color codes
+	Colors bool
+	// ShowHidden also shows non-enumerable properties
+	ShowHidden bool
+	// ShowProxy shows proxies as their target and handler. Otherwise a
+	// proxy is shown as its target, without running any of its traps.
+	ShowProxy bool
+}
+
+// inspectStyles holds the ANSI codes that turn each kind of value's color on and off
+var inspectStyles = map[string][2]int{
+	"special":   {36, 39},
+	"number":    {33, 39},
+	"bigint":    {33, 39},
+	"boolean":   {33, 39},
+	"undefined": {90, 39},
+	"null":      {1, 22},
+	"string":    {32, 39},
+	"symbol":    {32, 39},
+	"date":      {35, 39},
+	"regexp":    {31, 39},
+}
+
+var (
+	ansiPattern       = regexp.MustCompile(`\x1b\[\d+m`)
+	identifierPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z_0-9]*$`)
+)
+
+// inspector holds the intrinsics Inspect relies on. They are captured when
+// the console is set up, before any script runs, so scripts cannot change
+// how values are shown by replacing them.
+type inspector struct {
+	vm                       *goja.Runtime
+	getOwnPropertyDescriptor goja.Callable
+	functionToString         goja.Callable
+	mapForEach               goja.Callable
+	setForEach               goja.Callable
+	stringify                goja.Callable
+	parseInt                 goja.Callable
+	parseFloat               goja.Callable
+	valueOf                  map[string]goja.Callable
+	weakHas                  map[string]goja.Callable
+	functionPrototype        *goja.Object
+	custom                   *goja.Symbol
+	inspect                  goja.Value
+}
+
+// inspectorOf returns the inspector of vm, creating it on first use
+func inspectorOf(vm *goja.Runtime) *inspector {
+	if val := vm.GlobalObject().Get("__inspector"); val != nil {
+		if in, ok := val.Export().(*inspector); ok {
+			return in
+		}
+	}
+	in := newInspector(vm)
+	vm.GlobalObject().DefineDataProperty("__inspector", vm.ToValue(in), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	return in
+}
+
+func newInspector(vm *goja.Runtime) *inspector {
+	method := func(path ...string) goja.Callable {
+		val := vm.GlobalObject().Get(path[0])
+		for _, name := range path[1:] {
+			val = val.ToObject(vm).Get(name)
+		}
+		fn, _ := goja.AssertFunction(val)
+		return fn
+	}
+
+	in := &inspector{
+		vm:                       vm,
+		getOwnPropertyDescriptor: method("Object", "getOwnPropertyDescriptor"),
+		functionToString:         method("Function", "prototype", "toString"),
+		mapForEach:               method("Map", "prototype", "forEach"),
+		setForEach:               method("Set", "prototype", "forEach"),
+		stringify:                method("JSON", "stringify"),
+		parseInt:                 method("parseInt"),
+		parseFloat:               method("parseFloat"),
+		valueOf: map[string]goja.Callable{
+			"Number":  method("Number", "prototype", "valueOf"),
+			"String":  method("String", "prototype", "valueOf"),
+			"Boolean": method("Boolean", "prototype", "valueOf"),
+		},
+		weakHas: map[string]goja.Callable{
+			"WeakMap": method("WeakMap", "prototype", "has"),
+			"WeakSet": method("WeakSet", "prototype", "has"),
+		},
+		functionPrototype: vm.Get("Function").ToObject(vm).Get("prototype").ToObject(vm),
+	}
+
+	// Objects can customize their output with a method stored under
+	// Symbol.for('nodejs.util.inspect.custom'), as in Node.js
+	if custom, err := method("Symbol", "for")(goja.Undefined(), vm.ToValue("nodejs.util.inspect.custom")); err == nil {
+		in.custom, _ = custom.(*goja.Symbol)
+	}
+
+	inspect := vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(Inspect(vm, call.Argument(0), inspectOptionsFrom(vm, call.Argument(1), InspectOptions{Depth: DefaultInspectDepth})))
+	}).ToObject(vm)
+	if in.custom != nil {
+		inspect.Set("custom", in.custom)
+	}
+	in.inspect = inspect
+
+	return in
+}
+
+// inspectObject returns an object that util.inspect shows as an instance of
+// ctor with the given name-value pairs as properties. Custom inspect methods
+// return it to show the state of their objects.
+func inspectObject(vm *goja.Runtime, ctor *goja.Object, pairs ...interface{}) *goja.Object {
+	proto := vm.NewObject()
+	proto.SetPrototype(ctor.Get("prototype").ToObject(vm))
+	if custom := inspectorOf(vm).custom; custom != nil {
+		proto.SetSymbol(custom, goja.Undefined())
+	}
+	obj := vm.NewObject()
+	obj.SetPrototype(proto)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		obj.DefineDataProperty(pairs[i].(string), vm.ToValue(pairs[i+1]), goja.FLAG_TRUE, goja.FLAG_TRUE, goja.FLAG_TRUE)
+	}
+	return obj
+}
+
+// inspectOptionsFrom reads the depth, colors, showHidden and showProxy
+// properties of a JS options object on top of defaults
+func inspectOptionsFrom(vm *goja.Runtime, val goja.Value, defaults InspectOptions) InspectOptions {
+	opts := defaults
+	if val == nil || goja.IsUndefined(val) || goja.IsNull(val) {
+		return opts
+	}
+	obj := val.ToObject(vm)
+	if depth := obj.Get("depth"); depth != nil && !goja.IsUndefined(depth) {
+		if goja.IsNull(depth) || math.IsInf(depth.ToFloat(), 1) {
+			opts.Depth = -1
+		} else {
+			opts.Depth = int(depth.ToInteger())
+		}
+	}
+	if colors := obj.Get("colors"); colors != nil && !goja.IsUndefined(colors) {
+		opts.Colors = colors.ToBoolean()
+	}
+	if hidden := obj.Get("showHidden"); hidden != nil && !goja.IsUndefined(hidden) {
+		opts.ShowHidden = hidden.ToBoolean()
+	}
+	if proxy := obj.Get("showProxy"); proxy != nil && !goja.IsUndefined(proxy) {
+		opts.ShowProxy = proxy.ToBoolean()
+	}
+	return opts
+}
+
+// Inspect formats v for display the way Node.js's util.inspect does
+func Inspect(vm *goja.Runtime, v goja.Value, opts InspectOptions) string {
+	ctx := &inspectContext{inspector: inspectorOf(vm), opts: opts}
+	return ctx.formatValue(v, 0)
+}
+
+// Format formats args the way console.log does. A string first argument may
+// contain printf-style %s, %d, %i, %f, %j, %o, %O and %c substitutions;
+// arguments left over are appended, strings as they are and other values
+// formatted with Inspect.
+func Format(vm *goja.Runtime, opts InspectOptions, args ...goja.Value) string {
+	in := inspectorOf(vm)
+	inspect := func(v goja.Value, opts InspectOptions) string {
+		return (&inspectContext{inspector: in, opts: opts}).formatValue(v, 0)
+	}
+
+	var b strings.Builder
+	next := 0
+	if len(args) > 0 && isString(args[0]) {
+		format := args[0].String()
+		next = 1
+		if len(args) == 1 {
+			return format
+		}
+
+		last := 0
+		for i := 0; i < len(format)-1; i++ {
+			if format[i] != '%' {
+				continue
+			}
+			verb := format[i+1]
+			if verb == '%' {
+				b.WriteString(format[last:i])
+				b.WriteByte('%')
+				last = i + 2
+				i++
+				continue
+			}
+			if next == len(args) {
+				continue
+			}
+
+			var sub string
+			arg := args[next]
+			switch verb {
+			case 's':
+				sub = in.formatString(arg)
+			case 'd':
+				sub = in.formatNumberArg(arg, nil)
+			case 'i':
+				sub = in.formatNumberArg(arg, in.parseInt)
+			case 'f':
+				if _, ok := arg.(*goja.Symbol); ok {
+					sub = "NaN"
+				} else {
+					sub = in.formatNumberArg(vm.ToValue(arg.String()), in.parseFloat)
+				}
+			case 'j':
+				sub = in.formatJSON(arg)
+			case 'o':
+				sub = inspect(arg, InspectOptions{Depth: 4, Colors: opts.Colors, ShowHidden: true})
+			case 'O':
+				sub = inspect(arg, opts)
+			case 'c':
+				// CSS styling has no meaning in a terminal
+			default:
+				continue
+			}
+
+			b.WriteString(format[last:i])
+			b.WriteString(sub)
+			last = i + 2
+			next++
+			i++
+		}
+		b.WriteString(format[last:])
+	}
+
+	for i, arg := range args[next:] {
+		if i > 0 || next > 0 {
+			b.WriteByte(' ')
+		}
+		if isString(arg) {
+			b.WriteString(arg.String())
+		} else {
+			b.WriteString(inspect(arg, opts))
+		}
+	}
+	return b.String()
+}
+
+// formatString implements %s: primitives are converted with String(), objects
+// without their own toString are inspected one level deep
+func (in *inspector) formatString(arg goja.Value) string {
+	if arg == nil {
+		return "undefined"
+	}
+	obj, ok := arg.(*goja.Object)
+	if !ok {
+		if sym, ok := arg.(*goja.Symbol); ok {
+			return symbolString(sym)
+		}
+		ctx := &inspectContext{inspector: in}
+		switch arg.ExportType() {
+		case reflect.TypeOf(int64(0)), reflect.TypeOf(float64(0)), reflect.TypeOf((*big.Int)(nil)):
+			return ctx.formatPrimitive(arg)
+		}
+		return arg.String()
+	}
+	if _, isFunc := goja.AssertFunction(obj); isFunc || !in.hasBuiltinToString(obj) {
+		return obj.String()
+	}
+	return (&inspectContext{inspector: in, opts: InspectOptions{Depth: 0}}).formatValue(obj, 0)
+}
+
+// formatNumberArg implements %d, %i and %f, converting arg with parse, or
+// with Number() if parse is nil
+func (in *inspector) formatNumberArg(arg goja.Value, parse goja.Callable) string {
+	if _, ok := arg.(*goja.Symbol); ok {
+		return "NaN"
+	}
+	if _, ok := arg.Export().(*big.Int); ok {
+		return arg.String() + "n"
+	}
+	var num goja.Value
+	if parse != nil {
+		var err error
+		if num, err = parse(goja.Undefined(), arg); err != nil {
+			panic(err)
+		}
+	} else {
+		num = in.vm.ToValue(arg.ToFloat())
+	}
+	return (&inspectContext{inspector: in}).formatPrimitive(num)
+}
+
+// formatJSON implements %j
+func (in *inspector) formatJSON(arg goja.Value) string {
+	var out goja.Value
+	if ex := in.vm.Try(func() {
+		var err error
+		if out, err = in.stringify(goja.Undefined(), arg); err != nil {
+			panic(err)
+		}
+	}); ex != nil {
+		if strings.Contains(strings.ToLower(ex.Error()), "circular") {
+			return "[Circular]"
+		}
+		panic(ex)
+	}
+	if out == nil || goja.IsUndefined(out) {
+		return "undefined"
+	}
+	return out.String()
+}
+
+// hasBuiltinToString reports whether obj uses a toString method provided by
+// the engine rather than one defined by the script
+func (in *inspector) hasBuiltinToString(obj *goja.Object) bool {
+	// Proxies count as built-in objects, and their target is checked
+	for obj.ExportType() == proxyExportType {
+		if obj = obj.Export().(goja.Proxy).Target(); obj == nil {
+			return true
+		}
+	}
+	fn, ok := obj.Get("toString").(*goja.Object)
+	if !ok {
+		return true
+	}
+	src, err := in.functionToString(fn)
+	return err != nil || strings.Contains(src.String(), "[native code]")
+}
+
+// propertyKey is an own property name: a string or a symbol
+type propertyKey struct {
+	name   string
+	symbol *goja.Symbol
+}
+
+func (k propertyKey) value(vm *goja.Runtime) goja.Value {
+	if k.symbol != nil {
+		return k.symbol
+	}
+	return vm.ToValue(k.name)
+}
+
+// inspectContext is the state of a single Inspect call
+type inspectContext struct {
+	*inspector
+	opts         InspectOptions
+	seen         []*goja.Object
+	circular     map[*goja.Object]int
+	indentation  int
+	currentDepth int
+}
+
+// stylize colors s as the given kind of value if colors are enabled
+func (c *inspectContext) stylize(s, style string) string {
+	if !c.opts.Colors {
+		return s
+	}
+	codes, ok := inspectStyles[style]
+	if !ok {
+		return s
+	}
+	return fmt.Sprintf("\x1b[%dm%s\x1b[%dm", codes[0], s, codes[1])
+}
+
+func (c *inspectContext) formatValue(v goja.Value, recurseTimes int) string {
+	obj, ok := v.(*goja.Object)
+	if !ok {
+		return c.formatPrimitive(v)
+	}
+
+	// Like Node.js, proxies are shown as their target without running traps
+	for obj.ExportType() == proxyExportType {
+		proxy := obj.Export().(goja.Proxy)
+		if proxy.Target() == nil {
+			return c.stylize("<Revoked Proxy>", "special")
+		}
+		if c.opts.ShowProxy {
+			return c.formatProxy(proxy, recurseTimes)
+		}
+		obj = proxy.Target()
+	}
+
+	if out, ok := c.formatCustom(obj, recurseTimes); ok {
+		return out
+	}
+
+	for _, seen := range c.seen {
+		if seen == obj {
+			if c.circular == nil {
+				c.circular = make(map[*goja.Object]int)
+			}
+			index, ok := c.circular[obj]
+			if !ok {
+				index = len(c.circular) + 1
+				c.circular[obj] = index
+			}
+			return c.stylize(fmt.Sprintf("[Circular *%d]", index), "special")
+		}
+	}
+
+	return c.formatRaw(obj, recurseTimes)
+}
+
+// formatProxy shows the target and handler of proxy, for showProxy
+func (c *inspectContext) formatProxy(proxy goja.Proxy, recurseTimes int) string {
+	if c.opts.Depth >= 0 && recurseTimes > c.opts.Depth {
+		return c.stylize("Proxy [Array]", "special")
+	}
+	recurseTimes++
+	c.indentation += 2
+	output := []string{
+		c.formatValue(proxy.Target(), recurseTimes),
+		c.formatValue(proxy.Handler(), recurseTimes),
+	}
+	c.indentation -= 2
+	return c.reduceToSingleString(output, "", [2]string{"Proxy [", "]"}, recurseTimes)
+}
+
+// formatCustom calls the custom inspect method of obj, if it has one
+func (c *inspectContext) formatCustom(obj *goja.Object, recurseTimes int) (string, bool) {
+	if c.custom == nil {
+		return "", false
+	}
+	method, ok := obj.GetSymbol(c.custom).(*goja.Object)
+	if !ok || method.SameAs(c.inspect) {
+		return "", false
+	}
+	fn, ok := goja.AssertFunction(method)
+	if !ok {
+		return "", false
+	}
+
+	depth := c.vm.ToValue(math.Inf(1))
+	if c.opts.Depth >= 0 {
+		depth = c.vm.ToValue(c.opts.Depth - recurseTimes)
+	}
+	options := c.vm.NewObject()
+	options.Set("depth", depth)
+	options.Set("colors", c.opts.Colors)
+	options.Set("showHidden", c.opts.ShowHidden)
+	options.Set("showProxy", c.opts.ShowProxy)
+
+	ret, err := fn(obj, depth, options, c.inspect)
+	if err != nil {
+		panic(err)
+	}
+	if retObj, ok := ret.(*goja.Object); ok && retObj.SameAs(obj) {
+		return "", false
+	}
+	if !isString(ret) {
+		return c.formatValue(ret, recurseTimes), true
+	}
+	return strings.ReplaceAll(ret.String(), "\n", "\n"+strings.Repeat(" ", c.indentation)), true
+}
+
+func (c *inspectContext) formatPrimitive(v goja.Value) string {
+	if v == nil || goja.IsUndefined(v) {
+		return c.stylize("undefined", "undefined")
+	}
+	if goja.IsNull(v) {
+		return c.stylize("null", "null")
+	}
+	if sym, ok := v.(*goja.Symbol); ok {
+		return c.stylize(symbolString(sym), "symbol")
+	}
+
+	switch val := v.Export().(type) {
+	case string:
+		return c.stylize(quoteString(val), "string")
+	case bool:
+		return c.stylize(strconv.FormatBool(val), "boolean")
+	case *big.Int:
+		return c.stylize(val.String()+"n", "bigint")
+	case float64:
+		if val == 0 && math.Signbit(val) {
+			return c.stylize("-0", "number")
+		}
+		return c.stylize(v.String(), "number")
+	case int64:
+		return c.stylize(v.String(), "number")
+	}
+	return v.String()
+}
+
+// quoteString quotes s like Node.js: single quotes unless s contains them,
+// then double quotes or backticks, with control characters escaped
+func quoteString(s string) string {
+	quote := byte('\'')
+	if strings.Contains(s, "'") {
+		if !strings.Contains(s, `"`) {
+			quote = '"'
+		} else if !strings.Contains(s, "`") && !strings.Contains(s, "${") {
+			quote = '`'
+		}
+	}
+
+	var b strings.Builder
+	b.WriteByte(quote)
+	for _, r := range s {
+		switch {
+		case r == rune(quote) || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\b':
+			b.WriteString(`\b`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x20 || (r >= 0x7f && r <= 0x9f):
+			fmt.Fprintf(&b, `\x%02X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte(quote)
+	return b.String()
+}
+
+// formatRaw formats an object that is not yet on the stack of objects being
+// formatted
+func (c *inspectContext) formatRaw(obj *goja.Object, recurseTimes int) string {
+	constructor, hasConstructor := c.constructorName(obj)
+	tag := c.toStringTag(obj, constructor)
+
+	kind := c.kindOf(obj, constructor)
+
+	var (
+		keys      []propertyKey
+		base      string
+		braces    = [2]string{"{", "}"}
+		entries   func(recurseTimes int) []string
+		arrayLike bool
+		isNumeric func(i int) bool
+	)
+	prefix := func(fallback, size string) string {
+		return inspectPrefix(constructor, hasConstructor, tag, fallback, size)
+	}
+
+	switch kind {
+	case "Array", "Arguments":
+		length := toLength(obj.Get("length"))
+		keys = c.ownKeys(obj, true)
+		if kind == "Arguments" {
+			braces[0] = "[Arguments] ["
+		} else if constructor != "Array" || !hasConstructor || tag != "" {
+			braces[0] = prefix("Array", fmt.Sprintf("(%d)", length)) + "["
+		} else {
+			braces[0] = "["
+		}
+		braces[1] = "]"
+		if length == 0 && len(keys) == 0 {
+			return braces[0] + "]"
+		}
+		arrayLike = true
+		entries = func(recurseTimes int) []string {
+			return c.formatArray(obj, length, recurseTimes)
+		}
+		isNumeric = func(i int) bool {
+			return isNumber(obj.Get(strconv.Itoa(i)))
+		}
+
+	case "TypedArray":
+		length := toLength(obj.Get("length"))
+		keys = c.ownKeys(obj, true)
+		braces = [2]string{prefix("TypedArray", fmt.Sprintf("(%d)", length)) + "[", "]"}
+		if length == 0 && len(keys) == 0 && !c.opts.ShowHidden {
+			return braces[0] + "]"
+		}
+		arrayLike = true
+		entries = func(recurseTimes int) []string {
+			return c.formatArray(obj, length, recurseTimes)
+		}
+		isNumeric = func(int) bool { return true }
+
+	case "Set", "Map":
+		size := toLength(obj.Get("size"))
+		keys = c.ownKeys(obj, false)
+		braces[0] = prefix(kind, fmt.Sprintf("(%d)", size)) + "{"
+		if size == 0 && len(keys) == 0 {
+			return braces[0] + "}"
+		}
+		entries = func(recurseTimes int) []string {
+			return c.formatCollection(obj, kind == "Map", recurseTimes)
+		}
+
+	case "WeakSet", "WeakMap":
+		keys = c.ownKeys(obj, false)
+		braces[0] = prefix(kind, "") + "{"
+		entries = func(int) []string {
+			return []string{c.stylize("<items unknown>", "special")}
+		}
+
+	case "Function":
+		keys = c.ownKeys(obj, false)
+		base = c.functionBase(obj, constructor, hasConstructor, tag)
+		if len(keys) == 0 {
+			return c.stylize(base, "special")
+		}
+
+	case "RegExp":
+		keys = c.ownKeys(obj, false)
+		base = "/" + obj.Get("source").String() + "/" + obj.Get("flags").String()
+		if p := prefix("RegExp", ""); p != "RegExp " {
+			base = p + base
+		}
+		if len(keys) == 0 {
+			return c.stylize(base, "regexp")
+		}
+
+	case "Date":
+		keys = c.ownKeys(obj, false)
+		base = "Invalid Date"
+		if t, ok := obj.Export().(time.Time); ok {
+			base = t.UTC().Format("2006-01-02T15:04:05.000Z")
+		}
+		if p := prefix("Date", ""); p != "Date " {
+			base = p + base
+		}
+		if len(keys) == 0 {
+			return c.stylize(base, "date")
+		}
+
+	case "Error":
+		keys = c.ownKeys(obj, false)
+		base = c.formatError(obj, &keys)
+		if len(keys) == 0 {
+			return base
+		}
+
+	case "Number", "String", "Boolean":
+		keys = c.ownKeys(obj, kind == "String")
+		if kind == "String" {
+			keys = withoutKey(keys, "length")
+		}
+		value, err := c.valueOf[kind](obj)
+		if err != nil {
+			panic(err)
+		}
+		typ := kind
+		if constructor != kind && hasConstructor {
+			typ += " (" + constructor + ")"
+		}
+		base = fmt.Sprintf("[%s: %s]", typ, (&inspectContext{inspector: c.inspector}).formatPrimitive(value))
+		if len(keys) == 0 {
+			return c.stylize(base, strings.ToLower(kind))
+		}
+
+	case "Promise":
+		keys = c.ownKeys(obj, false)
+		braces[0] = prefix("Promise", "") + "{"
+		entries = func(recurseTimes int) []string {
+			promise, _ := obj.Export().(*goja.Promise)
+			if promise == nil || promise.State() == goja.PromiseStatePending {
+				return []string{c.stylize("<pending>", "special")}
+			}
+			c.indentation += 2
+			result := c.formatValue(promise.Result(), recurseTimes)
+			c.indentation -= 2
+			if promise.State() == goja.PromiseStateRejected {
+				result = c.stylize("<rejected>", "special") + " " + result
+			}
+			return []string{result}
+		}
+
+	case "ArrayBuffer":
+		keys = c.ownKeys(obj, false)
+		braces[0] = prefix("ArrayBuffer", "") + "{"
+		entries = func(int) []string {
+			buf, _ := obj.Export().(goja.ArrayBuffer)
+			return []string{
+				c.stylize("[Uint8Contents]", "special") + ": " + formatBytes(buf.Bytes(), inspectMaxBufferLength),
+				"byteLength: " + c.formatPrimitive(c.vm.ToValue(len(buf.Bytes()))),
+			}
+		}
+
+	default:
+		keys = c.ownKeys(obj, false)
+		if !hasConstructor || constructor != "Object" || tag != "" {
+			braces[0] = prefix("Object", "") + "{"
+		} else {
+			braces[0] = "{"
+		}
+		if len(keys) == 0 {
+			return braces[0] + "}"
+		}
+	}
+
+	if c.opts.Depth >= 0 && recurseTimes > c.opts.Depth {
+		name := strings.TrimSuffix(prefix("Object", ""), " ")
+		if hasConstructor {
+			name = "[" + name + "]"
+		}
+		return c.stylize(name, "special")
+	}
+
+	recurseTimes++
+	c.seen = append(c.seen, obj)
+	c.currentDepth = recurseTimes
+
+	var output []string
+	if entries != nil {
+		output = entries(recurseTimes)
+	}
+	for _, key := range keys {
+		output = append(output, c.formatProperty(obj, key, recurseTimes, false))
+	}
+
+	c.seen = c.seen[:len(c.seen)-1]
+
+	if index, ok := c.circular[obj]; ok {
+		reference := c.stylize(fmt.Sprintf("<ref *%d>", index), "special")
+		if base == "" {
+			base = reference
+		} else {
+			base = reference + " " + base
+		}
+	}
+
+	if arrayLike && len(output) > 6 {
+		output = c.groupArrayElements(output, isNumeric)
+	}
+	return c.reduceToSingleString(output, base, braces, recurseTimes)
+}
+
+// inspectPrefix returns the name shown before the braces of an object
+func inspectPrefix(constructor string, hasConstructor bool, tag, fallback, size string) string {
+	if !hasConstructor {
+		if tag != "" && fallback != tag {
+			return fmt.Sprintf("[%s%s: null prototype] [%s] ", fallback, size, tag)
+		}
+		return fmt.Sprintf("[%s%s: null prototype] ", fallback, size)
+	}
+	if tag != "" && constructor != tag {
+		return fmt.Sprintf("%s%s [%s] ", constructor, size, tag)
+	}
+	return constructor + size + " "
+}
+
+// Export types that identify objects goja does not give a class name of their own
+var (
+	mapExportType         = reflect.TypeOf([][2]interface{}{})
+	setExportType         = reflect.TypeOf([]interface{}{})
+	promiseExportType     = reflect.TypeOf((*goja.Promise)(nil))
+	arrayBufferExportType = reflect.TypeOf(goja.ArrayBuffer{})
+	proxyExportType       = reflect.TypeOf(goja.Proxy{})
+)
+
+// kindOf returns the kind of built-in object obj is, which decides how it is
+// formatted, or "Object" for ordinary objects
+func (c *inspectContext) kindOf(obj *goja.Object, constructor string) string {
+	switch class := obj.ClassName(); class {
+	case "Array", "Arguments", "Function", "RegExp", "Date", "Error", "Number", "String", "Boolean":
+		return class
+	}
+
+	switch exportType := obj.ExportType(); {
+	case exportType == mapExportType:
+		return "Map"
+	case exportType == setExportType:
+		return "Set"
+	case exportType == promiseExportType:
+		return "Promise"
+	case exportType == arrayBufferExportType:
+		return "ArrayBuffer"
+	case exportType != nil && exportType.Kind() == reflect.Slice:
+		// Typed arrays export as Go slices of their element type
+		return "TypedArray"
+	}
+
+	// Weak collections cannot be told apart by their export type; the
+	// constructor name is only a hint, confirmed by calling their has method
+	if has, ok := c.weakHas[constructor]; ok {
+		if _, err := has(obj, goja.Undefined()); err == nil {
+			return constructor
+		}
+	}
+	return "Object"
+}
+
+// constructorName returns the name of the closest constructor in the
+// prototype chain of obj, or false for objects without a prototype
+func (c *inspectContext) constructorName(obj *goja.Object) (string, bool) {
+	for proto := obj; proto != nil; proto = proto.Prototype() {
+		desc, err := c.getOwnPropertyDescriptor(goja.Undefined(), proto, c.vm.ToValue("constructor"))
+		if err != nil || goja.IsUndefined(desc) {
+			continue
+		}
+		ctor, ok := desc.ToObject(c.vm).Get("value").(*goja.Object)
+		if !ok {
+			continue
+		}
+		if _, isFunc := goja.AssertFunction(ctor); !isFunc {
+			continue
+		}
+		name := ctor.Get("name")
+		if name == nil || name.String() == "" || !c.instanceOf(obj, ctor) {
+			continue
+		}
+		return name.String(), true
+	}
+	if obj.Prototype() == nil {
+		return "", false
+	}
+	return "Object", true
+}
+
+// instanceOf reports whether obj inherits from ctor.prototype
+func (c *inspectContext) instanceOf(obj, ctor *goja.Object) bool {
+	proto, ok := ctor.Get("prototype").(*goja.Object)
+	if !ok {
+		return false
+	}
+	for p := obj.Prototype(); p != nil; p = p.Prototype() {
+		if p.SameAs(proto) {
+			return true
+		}
+	}
+	return false
+}
+
+// toStringTag returns the Symbol.toStringTag of obj if it adds anything to
+// the constructor name
+func (c *inspectContext) toStringTag(obj *goja.Object, constructor string) string {
+	tag := obj.GetSymbol(goja.SymToStringTag)
+	if tag == nil || !isString(tag) || tag.String() == constructor {
+		return ""
+	}
+	// An enumerable own tag is shown as a property instead
+	for _, sym := range obj.Symbols() {
+		if sym == goja.SymToStringTag {
+			return ""
+		}
+	}
+	return tag.String()
+}
+
+// ownKeys returns the own property keys of obj that are shown, skipping
+// array indices if skipIndices is set
+func (c *inspectContext) ownKeys(obj *goja.Object, skipIndices bool) []propertyKey {
+	var names []string
+	if c.opts.ShowHidden {
+		names = obj.GetOwnPropertyNames()
+	} else {
+		names = obj.Keys()
+	}
+
+	keys := make([]propertyKey, 0, len(names))
+	for _, name := range names {
+		if skipIndices && isArrayIndex(name) {
+			continue
+		}
+		keys = append(keys, propertyKey{name: name})
+	}
+	for _, sym := range obj.Symbols() {
+		keys = append(keys, propertyKey{symbol: sym})
+	}
+	return keys
+}
+
+// withoutKey removes the string key name from keys
+func withoutKey(keys []propertyKey, name string) []propertyKey {
+	out := keys[:0]
+	for _, key := range keys {
+		if key.symbol != nil || key.name != name {
+			out = append(out, key)
+		}
+	}
+	return out
+}
+
+// formatProperty formats the own property key of obj. Array elements are
+// formatted without their key.
+func (c *inspectContext) formatProperty(obj *goja.Object, key propertyKey, recurseTimes int, element bool) string {
+	var str string
+	enumerable := true
+
+	desc, err := c.getOwnPropertyDescriptor(goja.Undefined(), obj, key.value(c.vm))
+	if err != nil {
+		panic(err)
+	}
+	if goja.IsUndefined(desc) {
+		str = c.stylize("undefined", "undefined")
+	} else {
+		d := desc.ToObject(c.vm)
+		enumerable = d.Get("enumerable").ToBoolean()
+		getter, setter := d.Get("get"), d.Get("set")
+		hasGetter := getter != nil && !goja.IsUndefined(getter)
+		hasSetter := setter != nil && !goja.IsUndefined(setter)
+		switch {
+		case hasGetter && hasSetter:
+			str = c.stylize("[Getter/Setter]", "special")
+		case hasGetter:
+			str = c.stylize("[Getter]", "special")
+		case hasSetter:
+			str = c.stylize("[Setter]", "special")
+		default:
+			c.indentation += 2
+			str = c.formatValue(d.Get("value"), recurseTimes)
+			c.indentation -= 2
+		}
+	}
+
+	if element {
+		return str
+	}
+
+	var name string
+	switch {
+	case key.symbol != nil:
+		name = "[" + c.stylize(symbolString(key.symbol), "symbol") + "]"
+	case key.name == "__proto__":
+		name = "['__proto__']"
+	case !enumerable:
+		name = "[" + key.name + "]"
+	case identifierPattern.MatchString(key.name):
+		name = key.name
+	default:
+		name = c.stylize(quoteString(key.name), "string")
+	}
+	return name + ": " + str
+}
+
+// formatArray formats the elements of an array or typed array, collapsing
+// runs of holes
+func (c *inspectContext) formatArray(obj *goja.Object, length int, recurseTimes int) []string {
+	shown := length
+	if shown > inspectMaxArrayLength {
+		shown = inspectMaxArrayLength
+	}
+
+	var output []string
+	holes := 0
+	flushHoles := func() {
+		if holes > 0 {
+			output = append(output, c.stylize(fmt.Sprintf("<%d empty item%s>", holes, plural(holes)), "undefined"))
+			holes = 0
+		}
+	}
+	for i := 0; i < shown; i++ {
+		index := c.vm.ToValue(strconv.Itoa(i))
+		desc, err := c.getOwnPropertyDescriptor(goja.Undefined(), obj, index)
+		if err != nil {
+			panic(err)
+		}
+		if goja.IsUndefined(desc) {
+			holes++
+			continue
+		}
+		flushHoles()
+		output = append(output, c.formatProperty(obj, propertyKey{name: strconv.Itoa(i)}, recurseTimes, true))
+	}
+	flushHoles()
+
+	if remaining := length - shown; remaining > 0 {
+		output = append(output, fmt.Sprintf("... %d more item%s", remaining, plural(remaining)))
+	}
+	return output
+}
+
+// formatCollection formats the entries of a Map or Set
+func (c *inspectContext) formatCollection(obj *goja.Object, isMap bool, recurseTimes int) []string {
+	var output []string
+	remaining := 0
+
+	c.indentation += 2
+	each := c.setForEach
+	if isMap {
+		each = c.mapForEach
+	}
+	_, err := each(obj, c.vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		if len(output) == inspectMaxArrayLength {
+			remaining++
+			return goja.Undefined()
+		}
+		if isMap {
+			output = append(output, c.formatValue(call.Argument(1), recurseTimes)+" => "+c.formatValue(call.Argument(0), recurseTimes))
+		} else {
+			output = append(output, c.formatValue(call.Argument(0), recurseTimes))
+		}
+		return goja.Undefined()
+	}))
+	c.indentation -= 2
+	if err != nil {
+		panic(err)
+	}
+
+	if remaining > 0 {
+		output = append(output, fmt.Sprintf("... %d more item%s", remaining, plural(remaining)))
+	}
+	return output
+}
+
+// functionBase returns the description of a function, e.g. [Function: f]
+func (c *inspectContext) functionBase(fn *goja.Object, constructor string, hasConstructor bool, tag string) string {
+	name := ""
+	if val := fn.Get("name"); val != nil && isString(val) {
+		name = val.String()
+	}
+
+	if src, err := c.functionToString(fn); err == nil && isClassSource(src.String()) {
+		if name == "" {
+			name = "(anonymous)"
+		}
+		base := "class " + name
+		if hasConstructor && constructor != "Function" {
+			base += " [" + constructor + "]"
+		}
+		if tag != "" && constructor != tag {
+			base += " [" + tag + "]"
+		}
+		if !hasConstructor {
+			base += " extends [null prototype]"
+		} else if super := fn.Prototype(); super != nil && !super.SameAs(c.functionPrototype) {
+			if superName := super.Get("name"); superName != nil && superName.String() != "" {
+				base += " extends " + superName.String()
+			}
+		}
+		return "[" + base + "]"
+	}
+
+	// Async and generator functions have constructors of their own
+	typ := "Function"
+	switch constructor {
+	case "AsyncFunction", "GeneratorFunction", "AsyncGeneratorFunction":
+		typ = constructor
+	}
+
+	base := "[" + typ
+	if !hasConstructor {
+		base += " (null prototype)"
+	}
+	if name == "" {
+		base += " (anonymous)"
+	} else {
+		base += ": " + name
+	}
+	base += "]"
+	if hasConstructor && constructor != typ && constructor != "Function" {
+		base += " " + constructor
+	}
+	if tag != "" && constructor != tag {
+		base += " [" + tag + "]"
+	}
+	return base
+}
+
+// isClassSource reports whether src is the source of a class
+func isClassSource(src string) bool {
+	if !strings.HasPrefix(src, "class") || len(src) == 5 {
+		return false
+	}
+	next := src[5]
+	return next == ' ' || next == '{' || next == '\t' || next == '\n'
+}
+
+// formatError returns the stack of an error, removing keys that are
+// already part of it from keys
+func (c *inspectContext) formatError(err *goja.Object, keys *[]propertyKey) string {
+	stack := ""
+	if val := err.Get("stack"); val != nil && isString(val) {
+		stack = strings.TrimRight(CleanStack(val.String()), "\n")
+	}
+	if stack == "" {
+		name, message := "Error", ""
+		if val := err.Get("name"); val != nil && !goja.IsUndefined(val) {
+			name = val.String()
+		}
+		if val := err.Get("message"); val != nil && !goja.IsUndefined(val) {
+			message = val.String()
+		}
+		stack = name
+		if message != "" {
+			stack += ": " + message
+		}
+	}
+
+	for _, name := range []string{"name", "message", "stack"} {
+		if val := err.Get(name); val != nil && isString(val) && strings.Contains(stack, val.String()) {
+			*keys = withoutKey(*keys, name)
+		}
+	}
+
+	// Errors without a stack trace are wrapped in brackets
+	if !strings.Contains(stack, "\n    at") && !strings.Contains(stack, "\n\tat") {
+		stack = "[" + stack + "]"
+	}
+	if c.indentation != 0 {
+		stack = strings.ReplaceAll(stack, "\n", "\n"+strings.Repeat(" ", c.indentation))
+	}
+	return stack
+}
+
+// groupArrayElements arranges short array entries in aligned columns
+func (c *inspectContext) groupArrayElements(output []string, isNumeric func(i int) bool) []string {
+	totalLength := 0
+	maxLength := 0
+	outputLength := len(output)
+	if strings.HasPrefix(output[outputLength-1], "... ") {
+		// The "more items" entry is not part of the grid
+		outputLength--
+	}
+
+	const separatorSpace = 2
+	dataLen := make([]int, outputLength)
+	for i := 0; i < outputLength; i++ {
+		dataLen[i] = visibleLength(output[i])
+		totalLength += dataLen[i] + separatorSpace
+		if dataLen[i] > maxLength {
+			maxLength = dataLen[i]
+		}
+	}
+
+	actualMax := maxLength + separatorSpace
+	if actualMax*3+c.indentation >= inspectBreakLength ||
+		(float64(totalLength)/float64(actualMax) <= 5 && maxLength > 6) {
+		return output
+	}
+
+	const approxCharHeights = 2.5
+	averageBias := math.Sqrt(float64(actualMax) - float64(totalLength)/float64(len(output)))
+	biasedMax := math.Max(float64(actualMax)-3-averageBias, 1)
+	columns := minInt(
+		int(math.Round(math.Sqrt(approxCharHeights*biasedMax*float64(outputLength))/biasedMax)),
+		(inspectBreakLength-c.indentation)/actualMax,
+		inspectCompact*4,
+		15,
+	)
+	if columns <= 1 {
+		return output
+	}
+
+	maxLineLength := make([]int, 0, columns)
+	for i := 0; i < columns; i++ {
+		lineLength := 0
+		for j := i; j < outputLength; j += columns {
+			if dataLen[j] > lineLength {
+				lineLength = dataLen[j]
+			}
+		}
+		maxLineLength = append(maxLineLength, lineLength+separatorSpace)
+	}
+
+	padStart := true
+	for i := 0; i < outputLength; i++ {
+		if !isNumeric(i) {
+			padStart = false
+			break
+		}
+	}
+
+	var grouped []string
+	for i := 0; i < outputLength; i += columns {
+		max := minInt(i+columns, outputLength)
+		var line strings.Builder
+		j := i
+		for ; j < max-1; j++ {
+			cell := output[j] + ", "
+			padding := strings.Repeat(" ", maxInt(maxLineLength[j-i]-dataLen[j]-separatorSpace, 0))
+			if padStart {
+				line.WriteString(padding + cell)
+			} else {
+				line.WriteString(cell + padding)
+			}
+		}
+		if padStart {
+			padding := strings.Repeat(" ", maxInt(maxLineLength[j-i]-separatorSpace-dataLen[j], 0))
+			line.WriteString(padding + output[j])
+		} else {
+			line.WriteString(output[j])
+		}
+		grouped = append(grouped, line.String())
+	}
+	if outputLength < len(output) {
+		grouped = append(grouped, output[outputLength])
+	}
+	return grouped
+}
+
+// reduceToSingleString joins the formatted entries of an object, on one line
+// if they are short enough and not nested too deeply
+func (c *inspectContext) reduceToSingleString(output []string, base string, braces [2]string, recurseTimes int) string {
+	prefix := ""
+	if base != "" {
+		prefix = base + " "
+	}
+
+	if c.currentDepth-recurseTimes < inspectCompact {
+		start := len(output) + c.indentation + len(braces[0]) + len(base) + 10
+		if c.isBelowBreakLength(output, start, base) {
+			joined := strings.Join(output, ", ")
+			if !strings.Contains(joined, "\n") {
+				return prefix + braces[0] + " " + joined + " " + braces[1]
+			}
+		}
+	}
+
+	indentation := "\n" + strings.Repeat(" ", c.indentation)
+	return prefix + braces[0] + indentation + "  " + strings.Join(output, ","+indentation+"  ") + indentation + braces[1]
+}
+
+func (c *inspectContext) isBelowBreakLength(output []string, start int, base string) bool {
+	totalLength := len(output) + start
+	if totalLength+len(output) > inspectBreakLength {
+		return false
+	}
+	for _, entry := range output {
+		totalLength += visibleLength(entry)
+		if totalLength > inspectBreakLength {
+			return false
+		}
+	}
+	return base == "" || !strings.Contains(base, "\n")
+}
+
+// formatBytes formats up to max bytes as hex pairs, e.g. <01 02>
+func formatBytes(data []byte, max int) string {
+	shown := data
+	if len(shown) > max {
+		shown = shown[:max]
+	}
+	parts := make([]string, len(shown))
+	for i, b := range shown {
+		parts[i] = fmt.Sprintf("%02x", b)
+	}
+	str := strings.Join(parts, " ")
+	if remaining := len(data) - len(shown); remaining > 0 {
+		str += fmt.Sprintf(" ... %d more byte%s", remaining, plural(remaining))
+	}
+	return "<" + str + ">"
+}
+
+// visibleLength returns the number of characters s takes up on screen
+func visibleLength(s string) int {
+	return utf8.RuneCountInString(ansiPattern.ReplaceAllString(s, ""))
+}
+
+// symbolString returns the description of a symbol, e.g. Symbol(foo)
+func symbolString(sym *goja.Symbol) string {
+	return "Symbol(" + sym.String() + ")"
+}
+
+// isString reports whether v is a primitive string
+func isString(v goja.Value) bool {
+	if v == nil {
+		return false
+	}
+	switch v.(type) {
+	case *goja.Object, *goja.Symbol:
+		return false
+	}
+	return v.ExportType() == reflect.TypeOf("")
+}
+
+// isNumber reports whether v is a primitive number or bigint
+func isNumber(v goja.Value) bool {
+	if v == nil {
+		return false
+	}
+	if _, ok := v.(*goja.Object); ok {
+		return false
+	}
+	switch v.ExportType() {
+	case reflect.TypeOf(int64(0)), reflect.TypeOf(float64(0)), reflect.TypeOf((*big.Int)(nil)):
+		return true
+	}
+	return false
+}
+
+// isArrayIndex reports whether name is a canonical array index
+func isArrayIndex(name string) bool {
+	n, err := strconv.ParseUint(name, 10, 32)
+	return err == nil && n < math.MaxUint32 && strconv.FormatUint(n, 10) == name
+}
+
+// toLength converts a length property to an int
+func toLength(v goja.Value) int {
+	if v == nil || goja.IsUndefined(v) {
+		return 0
+	}
+	return int(v.ToInteger())
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+func minInt(first int, rest ...int) int {
+	for _, n := range rest {
+		if n < first {
+			first = n
+		}
+	}
+	return first
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// UseColors reports whether output written to w should be colored: w must
+// be a terminal, unless FORCE_COLOR is set, and NO_COLOR must not be set
+func UseColors(w io.Writer) bool {
+	if force, ok := os.LookupEnv("FORCE_COLOR"); ok {
+		return force != "0" && force != "false"
+	}
+	if _, ok := os.LookupEnv("NO_COLOR"); ok || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
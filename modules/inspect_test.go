@@ -0,0 +1,72 @@
+package modules_test
+
+import (
+	"testing"
+
+	"gojs/internal/jstest"
+)
+
+func TestConsoleInspectsValues(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		console.log({ a: 1, b: 'x', c: [1, 2, { d: { e: 1 } }] });
+		const o = { name: 'o' }; o.self = o; console.log(o);
+		console.log(new Map([['k', 1]]), new Set([1, 2]));
+		class Foo { constructor() { this.x = 1; } } console.log(new Foo());
+		console.log(function named() {}, () => {}, [undefined, null], 'top');
+		console.log(['str'], Symbol('s'), 10n, -0);
+	`, "{ a: 1, b: 'x', c: [ 1, 2, { d: [Object] } ] }\n"+
+		"<ref *1> { name: 'o', self: [Circular *1] }\n"+
+		"Map(1) { 'k' => 1 } Set(2) { 1, 2 }\n"+
+		"Foo { x: 1 }\n"+
+		"[Function: named] [Function (anonymous)] [ undefined, null ] top\n"+
+		"[ 'str' ] Symbol(s) 10n -0\n")
+}
+
+func TestConsoleFormatSubstitutions(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		console.log('%s is %d years old', 'Bob', 42, 'extra');
+		console.log('%j %i %f %%', { a: 1 }, 3.9, '1.5');
+		console.log('%c styled', 'color: red');
+		console.log('%s %s', Symbol('sym'), Symbol());
+	`, "Bob is 42 years old extra\n{\"a\":1} 3 1.5 %\n styled\nSymbol(sym) Symbol()\n")
+}
+
+func TestUtilInspect(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const util = require('util');
+		console.log(util.inspect({ a: { b: { c: { d: 1 } } } }, { depth: null }));
+		console.log(util.inspect({ a: { b: { c: 1 } } }, { depth: 0 }));
+		console.log(util.inspect({ [util.inspect.custom]: () => 'custom!' }));
+		console.log(util.inspect('str'), util.inspect(new Date(0)), util.inspect(/re/g));
+		console.log(util.inspect(Promise.resolve(4)), util.inspect(new Uint8Array([1, 2])));
+		console.log(JSON.stringify(util.inspect({ a: 1 }, { colors: true })));
+	`, "{\n  a: { b: { c: { d: 1 } } }\n}\n"+
+		"{ a: [Object] }\n"+
+		"custom!\n"+
+		"'str' 1970-01-01T00:00:00.000Z /re/g\n"+
+		"Promise { 4 } Uint8Array(2) [ 1, 2 ]\n"+
+		"\"{ a: \\u001b[33m1\\u001b[39m }\"\n")
+}
+
+func TestUtilFormat(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const util = require('util');
+		console.log(util.format('%o', [1]));
+		console.log(util.format('%s=%d', 'a', 1, { b: 2 }));
+		console.log(util.formatWithOptions({ depth: 0 }, '%O', { a: { b: 1 } }));
+	`, "[ 1, [length]: 1 ]\na=1 { b: 2 }\n{ a: [Object] }\n")
+}
+
+func TestInspectProxies(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const util = require('util');
+		const trap = () => { throw new Error('trap'); };
+		const proxy = new Proxy({ a: 1 }, { get: trap, ownKeys: trap, getOwnPropertyDescriptor: trap });
+		console.log(proxy, [proxy]);
+		console.log('%s %o', proxy, proxy);
+		console.log(util.inspect(new Proxy([1, 2], {}), { showProxy: true }));
+		const { proxy: revoked, revoke } = Proxy.revocable({}, {});
+		revoke();
+		console.log(revoked);
+	`, "{ a: 1 } [ { a: 1 } ]\n{ a: 1 } { a: 1 }\nProxy [ [ 1, 2 ], {} ]\n<Revoked Proxy>\n")
+}
@@ -0,0 +1,359 @@
+package modules
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// netClasses holds the classes of the net module
+type netClasses struct {
+	vm      *goja.Runtime
+	loop    AsyncLoop
+	streams *streamClasses
+
+	socket    *goja.Object
+	server    *goja.Object
+	socketKey *goja.Symbol
+	serverKey *goja.Symbol
+}
+
+// netServer is the state of a net.Server. A listening server holds a
+// reference on the loop unless it was unref'd.
+type netServer struct {
+	c        *netClasses
+	obj      *goja.Object
+	listener net.Listener
+	// unclose unregisters the closer that closes listener if the run is
+	// halted
+	unclose func()
+	// options are passed to the sockets of accepted connections
+	options        *goja.Object
+	pauseOnConnect bool
+
+	listening bool
+	refed     bool
+	holding   bool
+
+	// close emits 'close' once closing and no connection is left
+	connections int
+	closing     bool
+}
+
+// netOf returns the net classes of vm, or nil before SetupNet
+func netOf(vm *goja.Runtime) *netClasses {
+	val := vm.GlobalObject().Get("__net")
+	if val == nil {
+		return nil
+	}
+	c, _ := val.Export().(*netClasses)
+	return c
+}
+
+// SetupNet sets up the net module. Sockets read and write on goroutines and
+// hand their results to scripts on loop.
+func SetupNet(vm *goja.Runtime, loop AsyncLoop) error {
+	streams := streamsOf(vm)
+	if streams == nil {
+		return errors.New("streams not initialized - call SetupStream first")
+	}
+	c := &netClasses{
+		vm:        vm,
+		loop:      loop,
+		streams:   streams,
+		socketKey: goja.NewSymbol("netSocket"),
+		serverKey: goja.NewSymbol("netServer"),
+	}
+	c.setupSocket()
+	if err := c.setupServer(); err != nil {
+		return err
+	}
+	if err := vm.GlobalObject().DefineDataProperty("__net", vm.ToValue(c), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE); err != nil {
+		return err
+	}
+
+	module := vm.NewObject()
+	module.Set("Socket", c.socket)
+	module.Set("Stream", c.socket)
+	module.Set("Server", c.server)
+
+	// net.createServer([options][, connectionListener])
+	module.Set("createServer", func(call goja.FunctionCall) goja.Value {
+		server, err := vm.New(c.server, call.Arguments...)
+		if err != nil {
+			panic(err)
+		}
+		return server
+	})
+	// net.connect(...) creates a Socket and connects it, taking the
+	// arguments of socket.connect
+	connect := func(call goja.FunctionCall) goja.Value {
+		var options goja.Value = goja.Undefined()
+		if obj, ok := call.Argument(0).(*goja.Object); ok {
+			options = obj
+		}
+		socket, err := vm.New(c.socket, options)
+		if err != nil {
+			panic(err)
+		}
+		return callMethod(vm, socket, "connect", call.Arguments...)
+	}
+	module.Set("connect", connect)
+	module.Set("createConnection", connect)
+
+	module.Set("isIP", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(ipVersion(call.Argument(0).String()))
+	})
+	module.Set("isIPv4", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(ipVersion(call.Argument(0).String()) == 4)
+	})
+	module.Set("isIPv6", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(ipVersion(call.Argument(0).String()) == 6)
+	})
+
+	return RegisterModule(vm, "net", module)
+}
+
+// setupServer creates net.Server
+func (c *netClasses) setupServer() error {
+	vm := c.vm
+	emitter, err := builtinExports(vm, "events")
+	if err != nil {
+		return err
+	}
+
+	serverOf := func(this goja.Value) *netServer {
+		if obj, ok := this.(*goja.Object); ok {
+			if srv, ok := exportSymbol(obj, c.serverKey).(*netServer); ok {
+				return srv
+			}
+		}
+		panic(NewNodeError(vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be of type Server"))
+	}
+
+	// net.Server([options][, connectionListener]) emits 'connection' with a
+	// Socket for every accepted connection
+	var proto *goja.Object
+	c.server, proto = c.streams.newClass("Server", emitter.ToObject(vm), func(this *goja.Object, args []goja.Value) {
+		options, listener := argAt(args, 0), argAt(args, 1)
+		if _, ok := goja.AssertFunction(options); ok {
+			options, listener = goja.Undefined(), options
+		}
+		srv := &netServer{c: c, obj: this, refed: true, options: vm.NewObject()}
+		if opts, ok := options.(*goja.Object); ok {
+			for _, name := range []string{"allowHalfOpen", "noDelay", "keepAlive", "highWaterMark"} {
+				if v := opts.Get(name); v != nil && !goja.IsUndefined(v) {
+					srv.options.Set(name, v)
+				}
+			}
+			if v := opts.Get("pauseOnConnect"); v != nil {
+				srv.pauseOnConnect = v.ToBoolean()
+			}
+		}
+		this.DefineDataPropertySymbol(c.serverKey, vm.ToValue(srv), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+		if _, ok := goja.AssertFunction(listener); ok {
+			callMethod(vm, this, "on", vm.ToValue("connection"), listener)
+		}
+	})
+
+	// listen([port[, host[, backlog]]][, callback]), listen(path[, callback])
+	// or listen(options[, callback]) starts accepting connections
+	proto.Set("listen", func(call goja.FunctionCall) goja.Value {
+		srv := serverOf(call.This)
+		args := call.Arguments
+		if len(args) > 0 {
+			if _, ok := goja.AssertFunction(args[len(args)-1]); ok {
+				callMethod(vm, srv.obj, "once", vm.ToValue("listening"), args[len(args)-1])
+				args = args[:len(args)-1]
+			}
+		}
+		if srv.listening {
+			panic(NewNodeError(vm, "Error", "ERR_SERVER_ALREADY_LISTEN", "Listen method has been called more than once without closing."))
+		}
+		network, host, port := listenArgs(vm, args)
+		srv.listen(network, host, port)
+		return call.This
+	})
+
+	proto.Set("address", func(call goja.FunctionCall) goja.Value {
+		srv := serverOf(call.This)
+		if !srv.listening {
+			return goja.Null()
+		}
+		return addressInfo(vm, srv.listener.Addr())
+	})
+
+	// close stops accepting connections and emits 'close' once the open
+	// ones have ended
+	proto.Set("close", func(call goja.FunctionCall) goja.Value {
+		srv := serverOf(call.This)
+		if cb, ok := goja.AssertFunction(call.Argument(0)); ok {
+			listening := srv.listening
+			callMethod(vm, srv.obj, "once", vm.ToValue("close"), vm.ToValue(func(goja.FunctionCall) goja.Value {
+				var err goja.Value = goja.Undefined()
+				if !listening {
+					err = NewNodeError(vm, "Error", "ERR_SERVER_NOT_RUNNING", "Server is not running.")
+				}
+				if _, e := cb(srv.obj, err); e != nil {
+					panic(e)
+				}
+				return goja.Undefined()
+			}))
+		}
+		if !srv.listening {
+			c.loop.NextTick(func() { srv.emit("close") })
+			return call.This
+		}
+		srv.listening = false
+		srv.closing = true
+		srv.listener.Close()
+		srv.unclose()
+		srv.release()
+		srv.maybeClose()
+		return call.This
+	})
+
+	proto.Set("getConnections", func(call goja.FunctionCall) goja.Value {
+		srv := serverOf(call.This)
+		cb, ok := goja.AssertFunction(call.Argument(0))
+		if !ok {
+			panic(ErrInvalidArgType(vm, "callback", "of type function", call.Argument(0)))
+		}
+		count := srv.connections
+		c.loop.NextTick(func() {
+			if _, err := cb(goja.Undefined(), goja.Null(), vm.ToValue(count)); err != nil {
+				panic(err)
+			}
+		})
+		return call.This
+	})
+
+	proto.Set("ref", func(call goja.FunctionCall) goja.Value {
+		srv := serverOf(call.This)
+		srv.refed = true
+		srv.hold()
+		return call.This
+	})
+	proto.Set("unref", func(call goja.FunctionCall) goja.Value {
+		srv := serverOf(call.This)
+		srv.refed = false
+		srv.release()
+		return call.This
+	})
+	proto.DefineAccessorProperty("listening", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(serverOf(call.This).listening)
+	}), nil, goja.FLAG_TRUE, goja.FLAG_FALSE)
+	return nil
+}
+
+// listen binds the address and accepts connections on a goroutine. It
+// emits 'listening', or 'error' if the address cannot be bound.
+func (srv *netServer) listen(network, host string, port int) {
+	c := srv.c
+	vm := c.vm
+	address := host
+	if network == "tcp" {
+		address = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		if host == "" {
+			host = "::"
+		}
+		errValue := jsError(vm, netError(err, "listen", host, port))
+		c.loop.NextTick(func() { srv.emit("error", errValue) })
+		return
+	}
+	srv.listener = ln
+	srv.unclose = c.loop.AddCloser(func() { ln.Close() })
+	srv.listening = true
+	srv.hold()
+	c.loop.NextTick(func() { srv.emit("listening") })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			unclose := c.loop.AddCloser(func() { conn.Close() })
+			c.loop.RunOnLoop(func(*goja.Runtime) {
+				srv.accept(conn, unclose)
+			})
+		}
+	}()
+}
+
+// accept emits 'connection' with a Socket for conn. Connections beyond
+// server.maxConnections are closed at once.
+func (srv *netServer) accept(conn net.Conn, unclose func()) {
+	vm := srv.c.vm
+	if !srv.listening {
+		conn.Close()
+		unclose()
+		return
+	}
+	if max := srv.obj.Get("maxConnections"); isNumber(max) && float64(srv.connections) >= max.ToFloat() {
+		conn.Close()
+		unclose()
+		return
+	}
+
+	ns := srv.c.newSocket(conn, unclose, srv.options)
+	ns.s.obj.Set("server", srv.obj)
+	srv.connections++
+	callMethod(vm, ns.s.obj, "once", vm.ToValue("close"), vm.ToValue(func(goja.FunctionCall) goja.Value {
+		srv.connections--
+		srv.maybeClose()
+		return goja.Undefined()
+	}))
+	if srv.pauseOnConnect {
+		callMethod(vm, ns.s.obj, "pause")
+	}
+	srv.emit("connection", ns.s.obj)
+}
+
+// maybeClose emits 'close' once a closing server has no connections left
+func (srv *netServer) maybeClose() {
+	if !srv.closing || srv.connections > 0 {
+		return
+	}
+	srv.closing = false
+	srv.c.loop.NextTick(func() { srv.emit("close") })
+}
+
+func (srv *netServer) emit(event string, args ...goja.Value) {
+	if _, err := Emit(srv.c.vm, srv.obj, event, args...); err != nil {
+		panic(err)
+	}
+}
+
+func (srv *netServer) hold() {
+	if srv.listening && srv.refed && !srv.holding {
+		srv.holding = true
+		srv.c.loop.Ref()
+	}
+}
+
+func (srv *netServer) release() {
+	if srv.holding {
+		srv.holding = false
+		srv.c.loop.Unref()
+	}
+}
+
+// ipVersion returns 4 or 6 for IP addresses in dotted or colon notation,
+// and 0 for anything else
+func ipVersion(s string) int {
+	ip := net.ParseIP(s)
+	switch {
+	case ip == nil:
+		return 0
+	case !strings.Contains(s, ":"):
+		return 4
+	}
+	return 6
+}
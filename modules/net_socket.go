@@ -0,0 +1,547 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// netReadSize is the most bytes a socket reads at once, as in Node.js
+const netReadSize = 64 * 1024
+
+// netSocket is the state of a net.Socket. Reads and writes run on
+// goroutines and resume on the loop. A connecting or connected socket holds
+// a reference on the loop unless it was unref'd.
+type netSocket struct {
+	c    *netClasses
+	s    *streamState
+	conn net.Conn
+	// unclose unregisters the closer that closes conn if the run is halted
+	unclose func()
+
+	connecting bool
+	// pending holds the writes and the end requested while connecting
+	pending  []func()
+	reading  bool
+	wantRead bool
+
+	bytesRead    int64
+	bytesWritten int64
+
+	// noDelay and keepAlive are applied once connected
+	noDelay        *bool
+	keepAlive      *bool
+	keepAliveDelay time.Duration
+
+	// timer emits 'timeout' once the socket is idle for timeout
+	timeout time.Duration
+	timer   *time.Timer
+
+	refed   bool
+	holding bool
+}
+
+// setupSocket creates net.Socket, a Duplex over a TCP or Unix socket
+func (c *netClasses) setupSocket() {
+	vm := c.vm
+	streams := c.streams
+
+	var proto *goja.Object
+	c.socket, proto = streams.newClass("Socket", streams.duplex, func(this *goja.Object, args []goja.Value) {
+		options, _ := argAt(args, 0).(*goja.Object)
+		// Sockets end their writable side with the readable one unless
+		// allowHalfOpen is set. 'close' is emitted by _destroy, which
+		// knows whether the socket failed.
+		streamOpts := vm.NewObject()
+		streamOpts.Set("allowHalfOpen", false)
+		streamOpts.Set("emitClose", false)
+		if options != nil {
+			for _, name := range []string{"allowHalfOpen", "readable", "writable", "highWaterMark", "readableHighWaterMark", "writableHighWaterMark"} {
+				if v := options.Get(name); v != nil && !goja.IsUndefined(v) {
+					streamOpts.Set(name, v)
+				}
+			}
+		}
+		s := streams.newState(this, streamOpts)
+		streams.initDuplex(s, streamOpts)
+		ns := &netSocket{c: c, s: s, refed: true}
+		this.DefineDataPropertySymbol(c.socketKey, vm.ToValue(ns), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+		this.Set("timeout", goja.Undefined())
+		s.construct()
+	})
+
+	socketOf := func(this goja.Value) *netSocket {
+		ns, ok := c.socketOf(this)
+		if !ok {
+			panic(NewNodeError(vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be of type Socket"))
+		}
+		return ns
+	}
+	// callback calls the stream callback cb with err, undefined if nil
+	callback := func(cb goja.Value, err error) {
+		fn, ok := goja.AssertFunction(cb)
+		if !ok {
+			return
+		}
+		var errValue goja.Value = goja.Undefined()
+		if err != nil {
+			errValue = jsError(vm, err)
+		}
+		if _, e := fn(goja.Undefined(), errValue); e != nil {
+			panic(e)
+		}
+	}
+
+	// connect(options[, listener]), connect(path[, listener]) or
+	// connect(port[, host][, listener]) opens the connection
+	proto.Set("connect", func(call goja.FunctionCall) goja.Value {
+		ns := socketOf(call.This)
+		network, address, port, options := c.connectArgs(call.Arguments)
+		if cb, ok := goja.AssertFunction(call.Arguments[len(call.Arguments)-1]); ok && cb != nil {
+			callMethod(vm, call.This.ToObject(vm), "once", vm.ToValue("connect"), call.Arguments[len(call.Arguments)-1])
+		}
+		if options != nil {
+			if v := options.Get("timeout"); !isNullish(v) {
+				callMethod(vm, call.This.ToObject(vm), "setTimeout", v)
+			}
+			if v := options.Get("noDelay"); v != nil && !goja.IsUndefined(v) {
+				noDelay := v.ToBoolean()
+				ns.noDelay = &noDelay
+			}
+			if v := options.Get("keepAlive"); v != nil && v.ToBoolean() {
+				keepAlive := true
+				ns.keepAlive = &keepAlive
+			}
+		}
+		ns.connect(network, address, port)
+		return call.This
+	})
+
+	proto.Set("_read", func(call goja.FunctionCall) goja.Value {
+		ns := socketOf(call.This)
+		if ns.conn == nil {
+			ns.wantRead = true
+			return goja.Undefined()
+		}
+		ns.read()
+		return goja.Undefined()
+	})
+
+	proto.Set("_write", func(call goja.FunctionCall) goja.Value {
+		ns := socketOf(call.This)
+		data, _ := BufferBytes(vm, call.Argument(0))
+		data = append([]byte(nil), data...)
+		cb := call.Argument(2)
+		ns.whenConnected(func() {
+			if ns.conn == nil {
+				callback(cb, &nodeError{name: "Error", code: "ERR_SOCKET_CLOSED", message: "Socket is closed"})
+				return
+			}
+			conn := ns.conn
+			runAsync(c.loop, func() (fsResult, error) {
+				_, err := conn.Write(data)
+				return nil, netError(err, "write", "", -1)
+			}, func(_ fsResult, err error) {
+				if err == nil {
+					ns.bytesWritten += int64(len(data))
+					ns.touch()
+				}
+				callback(cb, err)
+			})
+		})
+		return goja.Undefined()
+	})
+
+	// _final shuts down the sending side of the connection
+	proto.Set("_final", func(call goja.FunctionCall) goja.Value {
+		ns := socketOf(call.This)
+		cb := call.Argument(0)
+		ns.whenConnected(func() {
+			if cw, ok := ns.conn.(interface{ CloseWrite() error }); ok {
+				cw.CloseWrite()
+			}
+			callback(cb, nil)
+		})
+		return goja.Undefined()
+	})
+
+	proto.Set("_destroy", func(call goja.FunctionCall) goja.Value {
+		ns := socketOf(call.This)
+		ns.connecting = false
+		ns.pending = nil
+		ns.stopTimer()
+		ns.release()
+		if ns.conn != nil {
+			ns.conn.Close()
+			ns.unclose()
+		}
+		err := call.Argument(0)
+		if cb, ok := goja.AssertFunction(call.Argument(1)); ok {
+			if _, e := cb(goja.Undefined(), err); e != nil {
+				panic(e)
+			}
+		}
+		// 'close' follows the 'error' the stream emits on the next tick
+		hadError := vm.ToValue(!isNullish(err))
+		c.loop.NextTick(func() {
+			ns.s.closeEmitted = true
+			ns.s.emit("close", hadError)
+		})
+		return goja.Undefined()
+	})
+
+	// setTimeout(msecs[, callback]) emits 'timeout' once the socket is idle
+	// for msecs; 0 disables it
+	proto.Set("setTimeout", func(call goja.FunctionCall) goja.Value {
+		ns := socketOf(call.This)
+		msecs := call.Argument(0)
+		if !isNumber(msecs) {
+			panic(ErrInvalidArgType(vm, "msecs", "of type number", msecs))
+		}
+		if ms := msecs.ToFloat(); ms < 0 || ms != ms {
+			panic(errOutOfRange(vm, "msecs", "a non-negative finite number", ms))
+		}
+		obj := call.This.ToObject(vm)
+		cb := call.Argument(1)
+		if _, ok := goja.AssertFunction(cb); ok {
+			method := "once"
+			if msecs.ToFloat() == 0 {
+				method = "removeListener"
+			}
+			callMethod(vm, obj, method, vm.ToValue("timeout"), cb)
+		}
+		obj.Set("timeout", msecs)
+		ns.stopTimer()
+		ns.timeout = time.Duration(msecs.ToFloat() * float64(time.Millisecond))
+		ns.touch()
+		return call.This
+	})
+
+	// setNoDelay([noDelay]) disables Nagle's algorithm, by default
+	proto.Set("setNoDelay", func(call goja.FunctionCall) goja.Value {
+		ns := socketOf(call.This)
+		noDelay := goja.IsUndefined(call.Argument(0)) || call.Argument(0).ToBoolean()
+		ns.noDelay = &noDelay
+		ns.applyOptions()
+		return call.This
+	})
+
+	// setKeepAlive([enable][, initialDelay]) sends keep-alive probes after
+	// the connection is idle for initialDelay milliseconds
+	proto.Set("setKeepAlive", func(call goja.FunctionCall) goja.Value {
+		ns := socketOf(call.This)
+		enable := call.Argument(0).ToBoolean()
+		ns.keepAlive = &enable
+		if delay := call.Argument(1); isNumber(delay) {
+			ns.keepAliveDelay = time.Duration(delay.ToInteger()) * time.Millisecond
+		}
+		ns.applyOptions()
+		return call.This
+	})
+
+	proto.Set("address", func(call goja.FunctionCall) goja.Value {
+		ns := socketOf(call.This)
+		// Unix clients are bound to no path
+		if ns.conn == nil {
+			return vm.NewObject()
+		}
+		if addr, ok := ns.conn.LocalAddr().(*net.UnixAddr); ok && (addr.Name == "" || addr.Name == "@") {
+			return vm.NewObject()
+		}
+		return addressInfo(vm, ns.conn.LocalAddr())
+	})
+
+	proto.Set("ref", func(call goja.FunctionCall) goja.Value {
+		ns := socketOf(call.This)
+		ns.refed = true
+		ns.hold()
+		return call.This
+	})
+	proto.Set("unref", func(call goja.FunctionCall) goja.Value {
+		ns := socketOf(call.This)
+		ns.refed = false
+		ns.release()
+		return call.This
+	})
+
+	// resetAndDestroy closes the connection with a TCP RST
+	proto.Set("resetAndDestroy", func(call goja.FunctionCall) goja.Value {
+		ns := socketOf(call.This)
+		if tcp, ok := ns.conn.(*net.TCPConn); ok {
+			tcp.SetLinger(0)
+		}
+		ns.s.destroy(goja.Undefined(), nil)
+		return call.This
+	})
+
+	getter := func(name string, get func(ns *netSocket) interface{}) {
+		proto.DefineAccessorProperty(name, vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			return vm.ToValue(get(socketOf(call.This)))
+		}), nil, goja.FLAG_TRUE, goja.FLAG_FALSE)
+	}
+	getter("connecting", func(ns *netSocket) interface{} { return ns.connecting })
+	getter("pending", func(ns *netSocket) interface{} { return ns.conn == nil || ns.connecting })
+	getter("bytesRead", func(ns *netSocket) interface{} { return ns.bytesRead })
+	getter("bytesWritten", func(ns *netSocket) interface{} { return ns.bytesWritten })
+	getter("readyState", func(ns *netSocket) interface{} {
+		s := ns.s
+		readable, writable := !s.r.ended && !s.destroyed, !s.w.ending && !s.destroyed
+		switch {
+		case ns.connecting:
+			return "opening"
+		case readable && writable:
+			return "open"
+		case readable:
+			return "readOnly"
+		case writable:
+			return "writeOnly"
+		}
+		return "closed"
+	})
+}
+
+// newSocket creates a Socket for a connection accepted by a server, or a
+// pipe to a child process. unclose unregisters the closer of conn, if any.
+func (c *netClasses) newSocket(conn net.Conn, unclose func(), options *goja.Object) *netSocket {
+	obj, err := c.vm.New(c.socket, options)
+	if err != nil {
+		panic(err)
+	}
+	ns, _ := c.socketOf(obj)
+	ns.connected(conn, unclose)
+	return ns
+}
+
+func (c *netClasses) socketOf(v goja.Value) (*netSocket, bool) {
+	if obj, ok := v.(*goja.Object); ok {
+		ns, ok := exportSymbol(obj, c.socketKey).(*netSocket)
+		return ns, ok
+	}
+	return nil, false
+}
+
+// connectArgs parses the arguments of connect into the network and address
+// to connect to. port is -1 for Unix sockets, whose path is address.
+func (c *netClasses) connectArgs(args []goja.Value) (network, address string, port int, options *goja.Object) {
+	vm := c.vm
+	if len(args) > 0 {
+		if _, ok := goja.AssertFunction(args[len(args)-1]); ok {
+			args = args[:len(args)-1]
+		}
+	}
+	first := argAt(args, 0)
+	host := "localhost"
+	var portValue goja.Value
+	switch v := first.(type) {
+	case *goja.Object:
+		options = v
+		if path := v.Get("path"); !isNullish(path) {
+			network, address, port = unixSocket(vm, path.String())
+			return
+		}
+		portValue = v.Get("port")
+		if h := v.Get("host"); !isNullish(h) {
+			host = h.String()
+		}
+	default:
+		if str, ok := first.Export().(string); ok {
+			if _, err := strconv.Atoi(str); err != nil {
+				network, address, port = unixSocket(vm, str)
+				return
+			}
+		}
+		portValue = first
+		if h, ok := argAt(args, 1).Export().(string); ok {
+			host = h
+		}
+	}
+	if isNullish(portValue) {
+		panic(NewNodeError(vm, "TypeError", "ERR_MISSING_ARGS", `The "options" or "port" or "path" argument must be specified`))
+	}
+	return "tcp", host, portArg(vm, portValue, "Port", true), options
+}
+
+// connect dials address on a goroutine and emits 'connect' once connected
+func (ns *netSocket) connect(network, address string, port int) {
+	c := ns.c
+	vm := c.vm
+	ns.connecting = true
+	ns.hold()
+	dialAddress := address
+	if port >= 0 {
+		dialAddress = net.JoinHostPort(address, strconv.Itoa(port))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	uncancel := c.loop.AddCloser(cancel)
+	go func() {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, network, dialAddress)
+		uncancel()
+		cancel()
+		unclose := func() {}
+		if conn != nil {
+			unclose = c.loop.AddCloser(func() { conn.Close() })
+		}
+		c.loop.RunOnLoop(func(*goja.Runtime) {
+			if ns.s.destroyed || !ns.connecting {
+				if conn != nil {
+					conn.Close()
+					unclose()
+				}
+				return
+			}
+			ns.connecting = false
+			if err != nil {
+				ns.pending = nil
+				ns.s.destroy(jsError(vm, netError(err, "connect", address, port)), nil)
+				return
+			}
+			ns.connected(conn, unclose)
+			ns.s.emit("connect")
+			ns.s.emit("ready")
+		})
+	}()
+}
+
+// connected starts using conn, running the operations that waited for it.
+// unclose unregisters the closer of conn, if any.
+func (ns *netSocket) connected(conn net.Conn, unclose func()) {
+	if unclose == nil {
+		unclose = func() {}
+	}
+	ns.conn = conn
+	ns.unclose = unclose
+	obj := ns.s.obj
+	setSocketAddress(obj, "local", conn.LocalAddr().String())
+	setSocketAddress(obj, "remote", conn.RemoteAddr().String())
+	ns.applyOptions()
+	ns.hold()
+	ns.touch()
+
+	pending := ns.pending
+	ns.pending = nil
+	for _, fn := range pending {
+		fn()
+	}
+	if ns.wantRead {
+		ns.wantRead = false
+		ns.read()
+	}
+
+	// Like Node.js, start reading once connected so that the end of the
+	// connection is noticed even if nobody consumes the data. A socket
+	// paused right away, as with pauseOnConnect, is left alone.
+	ns.c.loop.NextTick(func() {
+		if s := ns.s; !s.destroyed && !s.r.ended && s.r.flowing != flowOff {
+			callMethod(ns.c.vm, s.obj, "read", ns.c.vm.ToValue(0))
+		}
+	})
+}
+
+// whenConnected runs fn now, or once a pending connection is made
+func (ns *netSocket) whenConnected(fn func()) {
+	if ns.connecting {
+		ns.pending = append(ns.pending, fn)
+		return
+	}
+	fn()
+}
+
+// read reads the next chunk on a goroutine and pushes it
+func (ns *netSocket) read() {
+	if ns.reading {
+		return
+	}
+	ns.reading = true
+	c := ns.c
+	vm := c.vm
+	conn := ns.conn
+	buf := make([]byte, netReadSize)
+	go func() {
+		n, err := conn.Read(buf)
+		c.loop.RunOnLoop(func(*goja.Runtime) {
+			ns.reading = false
+			s := ns.s
+			if s.destroyed {
+				return
+			}
+			ns.touch()
+			if n > 0 {
+				ns.bytesRead += int64(n)
+				s.push(NewBuffer(vm, buf[:n]), goja.Undefined(), false)
+			}
+			switch {
+			case errors.Is(err, io.EOF):
+				// read(0) ends a stream nobody is reading from
+				s.push(goja.Null(), goja.Undefined(), false)
+				callMethod(vm, s.obj, "read", vm.ToValue(0))
+			case err != nil:
+				s.destroy(jsError(vm, netError(err, "read", "", -1)), nil)
+			}
+		})
+	}()
+}
+
+// applyOptions applies the noDelay and keepAlive settings to a TCP
+// connection
+func (ns *netSocket) applyOptions() {
+	tcp, ok := ns.conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+	if ns.noDelay != nil {
+		tcp.SetNoDelay(*ns.noDelay)
+	}
+	if ns.keepAlive != nil {
+		tcp.SetKeepAlive(*ns.keepAlive)
+		if *ns.keepAlive && ns.keepAliveDelay > 0 {
+			tcp.SetKeepAlivePeriod(ns.keepAliveDelay)
+		}
+	}
+}
+
+func (ns *netSocket) hold() {
+	if (ns.connecting || ns.conn != nil) && ns.refed && !ns.holding && !ns.s.destroyed {
+		ns.holding = true
+		ns.c.loop.Ref()
+	}
+}
+
+func (ns *netSocket) release() {
+	if ns.holding {
+		ns.holding = false
+		ns.c.loop.Unref()
+	}
+}
+
+// touch restarts the idle timer after activity on the socket
+func (ns *netSocket) touch() {
+	if ns.timeout <= 0 || ns.s.destroyed {
+		return
+	}
+	if ns.timer != nil {
+		ns.timer.Reset(ns.timeout)
+		return
+	}
+	loop := ns.c.loop
+	ns.timer = time.AfterFunc(ns.timeout, func() {
+		loop.RunOnLoop(func(*goja.Runtime) {
+			if ns.timer == nil || ns.s.destroyed {
+				return
+			}
+			ns.s.emit("timeout")
+		})
+	})
+}
+
+func (ns *netSocket) stopTimer() {
+	if ns.timer != nil {
+		ns.timer.Stop()
+		ns.timer = nil
+	}
+}
@@ -0,0 +1,103 @@
+package modules_test
+
+import (
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"gojs/internal/jstest"
+)
+
+func TestNetEcho(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const net = require('net');
+		const server = net.createServer((socket) => socket.pipe(socket));
+		server.listen(0, '127.0.0.1', () => {
+			const client = net.connect(server.address().port, '127.0.0.1', () => client.end('ping'));
+			let data = '';
+			client.setEncoding('utf8');
+			client.on('data', (chunk) => data += chunk);
+			client.on('close', (hadError) => {
+				console.log(data, hadError, client.bytesWritten, client.bytesRead);
+				server.close();
+			});
+		});
+	`, "ping false 4 4\n")
+}
+
+func TestNetUnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "s.sock")
+	jstest.ExpectOutput(t, `
+		const net = require('net');
+		const server = net.createServer((socket) => {
+			socket.resume();
+			socket.end('hello ' + typeof server.address());
+		});
+		server.listen(`+jstest.Quote(sock)+`, () => {
+			const client = net.connect({ path: `+jstest.Quote(sock)+` });
+			client.setEncoding('utf8');
+			client.on('data', (data) => console.log(data));
+			client.on('end', () => server.close(() => console.log('closed')));
+		});
+	`, "hello string\nclosed\n")
+}
+
+func TestNetSocketInfo(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const net = require('net');
+		const server = net.createServer((socket) => {
+			socket.resume();
+			console.log(socket.remoteAddress, socket.remoteFamily, typeof socket.remotePort);
+			server.getConnections((err, count) => {
+				console.log(err, count);
+				socket.end();
+			});
+		});
+		server.listen({ port: 0, host: '127.0.0.1' }, () => {
+			const client = net.createConnection({ port: server.address().port, host: '127.0.0.1' });
+			const states = [client.connecting + ' ' + client.readyState];
+			client.on('ready', () => states.push(client.connecting + ' ' + client.readyState));
+			client.resume();
+			client.on('close', () => {
+				console.log(states.join(', '), client.readyState);
+				server.close();
+			});
+		});
+	`, "127.0.0.1 IPv4 number\nnull 1\ntrue opening, false open closed\n")
+}
+
+func TestNetErrors(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	port := busy.Addr().(*net.TCPAddr).Port
+
+	jstest.ExpectOutput(t, `
+		const net = require('net');
+		net.connect(1, '127.0.0.1').on('error', (e) => {
+			console.log(e.code, e.message);
+			net.createServer().listen(`+strconv.Itoa(port)+`, '127.0.0.1').on('error', (e) => console.log(e.code));
+		});
+		console.log(net.isIP('::1'), net.isIPv4('1.2.3.4'), net.isIP('nope'));
+	`, "6 true 0\nECONNREFUSED connect ECONNREFUSED 127.0.0.1:1\nEADDRINUSE\n")
+}
+
+func TestNetSocketEndsWithoutDataListener(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const net = require('net');
+		const server = net.createServer((socket) => {
+			socket.on('end', () => console.log('server end'));
+			socket.on('close', () => console.log('server close'));
+		});
+		server.listen(0, '127.0.0.1', () => {
+			const client = net.connect(server.address().port, '127.0.0.1', () => client.end());
+			client.on('close', () => {
+				console.log('client close');
+				server.close();
+			});
+		});
+	`, "server end\nserver close\nclient close\n")
+}
@@ -0,0 +1,281 @@
+package modules
+
+import (
+	"net"
+	"os"
+	"os/user"
+	goruntime "runtime"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// cpuInfo describes a CPU like an entry of os.cpus(). The times are in
+// milliseconds.
+type cpuInfo struct {
+	model string
+	speed int
+	user  float64
+	nice  float64
+	sys   float64
+	idle  float64
+	irq   float64
+}
+
+// NodePlatform maps GOOS to the values used by process.platform
+func NodePlatform(goos string) string {
+	if goos == "windows" {
+		return "win32"
+	}
+	return goos
+}
+
+// NodeArch maps GOARCH to the values used by process.arch
+func NodeArch(goarch string) string {
+	switch goarch {
+	case "amd64":
+		return "x64"
+	case "386":
+		return "ia32"
+	}
+	return goarch
+}
+
+// SetupOS sets up the os module
+func SetupOS(vm *goja.Runtime) error {
+	osModule := vm.NewObject()
+
+	// os.EOL
+	if goruntime.GOOS == "windows" {
+		osModule.Set("EOL", "\r\n")
+	} else {
+		osModule.Set("EOL", "\n")
+	}
+
+	// os.hostname
+	osModule.Set("hostname", func(call goja.FunctionCall) goja.Value {
+		name, err := os.Hostname()
+		if err != nil {
+			panic(NewSystemError(vm, err, "uv_os_gethostname", ""))
+		}
+		return vm.ToValue(name)
+	})
+
+	// os.platform and os.arch
+	osModule.Set("platform", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(NodePlatform(goruntime.GOOS))
+	})
+	osModule.Set("arch", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(NodeArch(goruntime.GOARCH))
+	})
+
+	// os.cpus
+	osModule.Set("cpus", func(call goja.FunctionCall) goja.Value {
+		cpus := hostCPUs()
+		result := make([]goja.Value, len(cpus))
+		for i, cpu := range cpus {
+			times := vm.NewObject()
+			times.Set("user", cpu.user)
+			times.Set("nice", cpu.nice)
+			times.Set("sys", cpu.sys)
+			times.Set("idle", cpu.idle)
+			times.Set("irq", cpu.irq)
+			obj := vm.NewObject()
+			obj.Set("model", cpu.model)
+			obj.Set("speed", cpu.speed)
+			obj.Set("times", times)
+			result[i] = obj
+		}
+		return vm.ToValue(result)
+	})
+
+	// os.totalmem and os.freemem
+	osModule.Set("totalmem", func(call goja.FunctionCall) goja.Value {
+		total, _ := hostMemory()
+		return vm.ToValue(total)
+	})
+	osModule.Set("freemem", func(call goja.FunctionCall) goja.Value {
+		_, free := hostMemory()
+		return vm.ToValue(free)
+	})
+
+	// os.homedir prefers the HOME (USERPROFILE on Windows) variable to the
+	// user database
+	osModule.Set("homedir", func(call goja.FunctionCall) goja.Value {
+		if home, err := os.UserHomeDir(); err == nil {
+			return vm.ToValue(home)
+		}
+		u, err := user.Current()
+		if err != nil {
+			panic(NewSystemError(vm, err, "uv_os_homedir", ""))
+		}
+		return vm.ToValue(u.HomeDir)
+	})
+
+	// os.tmpdir
+	osModule.Set("tmpdir", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(tmpDir())
+	})
+
+	// os.uptime returns the seconds since the system booted
+	osModule.Set("uptime", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(hostUptime())
+	})
+
+	// os.loadavg returns the 1, 5 and 15 minute load averages, which are
+	// always 0 on Windows
+	osModule.Set("loadavg", func(call goja.FunctionCall) goja.Value {
+		load := hostLoadavg()
+		return vm.ToValue([]float64{load[0], load[1], load[2]})
+	})
+
+	// os.networkInterfaces
+	osModule.Set("networkInterfaces", func(call goja.FunctionCall) goja.Value {
+		return networkInterfaces(vm)
+	})
+
+	// os.userInfo([options]) describes the current user. With
+	// { encoding: 'buffer' } the strings are Buffers.
+	osModule.Set("userInfo", func(call goja.FunctionCall) goja.Value {
+		encoding := "utf8"
+		if options, ok := call.Argument(0).(*goja.Object); ok {
+			if v := options.Get("encoding"); v != nil && !goja.IsUndefined(v) {
+				encoding = v.String()
+			}
+		}
+		u, err := user.Current()
+		if err != nil {
+			panic(NewSystemError(vm, err, "uv_os_get_passwd", ""))
+		}
+		str := func(s string) goja.Value {
+			if encoding == "buffer" {
+				return NewBuffer(vm, []byte(s))
+			}
+			return vm.ToValue(s)
+		}
+
+		info := vm.NewObject()
+		info.SetPrototype(nil)
+		info.Set("uid", userID(u.Uid))
+		info.Set("gid", userID(u.Gid))
+		info.Set("username", str(u.Username))
+		info.Set("homedir", str(u.HomeDir))
+		if shell := userShell(u.Username); shell != "" {
+			info.Set("shell", str(shell))
+		} else {
+			info.Set("shell", goja.Null())
+		}
+		return info
+	})
+
+	// os.constants.signals maps the signal names to their numbers
+	signalsObj := vm.NewObject()
+	for _, s := range signals {
+		signalsObj.Set(s.name, int(s.signal))
+	}
+	constants := vm.NewObject()
+	constants.Set("signals", signalsObj)
+	osModule.Set("constants", constants)
+
+	// Register os module
+	return RegisterModule(vm, "os", osModule)
+}
+
+// tmpDir returns the directory for temporary files like os.tmpdir, without
+// a trailing separator
+func tmpDir() string {
+	if goruntime.GOOS == "windows" {
+		dir := os.TempDir()
+		if len(dir) > 1 && strings.HasSuffix(dir, `\`) && !strings.HasSuffix(dir, `:\`) {
+			dir = dir[:len(dir)-1]
+		}
+		return dir
+	}
+	dir := "/tmp"
+	for _, name := range []string{"TMPDIR", "TMP", "TEMP"} {
+		if v := os.Getenv(name); v != "" {
+			dir = v
+			break
+		}
+	}
+	if len(dir) > 1 && strings.HasSuffix(dir, "/") {
+		dir = dir[:len(dir)-1]
+	}
+	return dir
+}
+
+// userID converts a user or group id to a number. Windows uses SIDs instead,
+// which like in Node.js become -1.
+func userID(id string) int {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// portableCPUs describes each CPU Go counts, for when nothing more is known
+func portableCPUs() []cpuInfo {
+	cpus := make([]cpuInfo, goruntime.NumCPU())
+	for i := range cpus {
+		cpus[i].model = "unknown"
+	}
+	return cpus
+}
+
+// networkInterfaces lists the addresses of the network interfaces that are
+// up, keyed by interface name
+func networkInterfaces(vm *goja.Runtime) goja.Value {
+	result := vm.NewObject()
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		panic(NewSystemError(vm, err, "uv_interface_addresses", ""))
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagRunning == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		mac := iface.HardwareAddr.String()
+		if mac == "" {
+			mac = "00:00:00:00:00:00"
+		}
+
+		var entries []goja.Value
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip, family := ipnet.IP.To4(), "IPv4"
+			if ip == nil {
+				ip, family = ipnet.IP, "IPv6"
+			}
+			ones, _ := ipnet.Mask.Size()
+
+			entry := vm.NewObject()
+			entry.Set("address", ip.String())
+			entry.Set("netmask", net.IP(ipnet.Mask).String())
+			entry.Set("family", family)
+			entry.Set("mac", mac)
+			entry.Set("internal", iface.Flags&net.FlagLoopback != 0)
+			entry.Set("cidr", ip.String()+"/"+strconv.Itoa(ones))
+			if family == "IPv6" {
+				scope := 0
+				if ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+					scope = iface.Index
+				}
+				entry.Set("scopeid", scope)
+			}
+			entries = append(entries, entry)
+		}
+		if len(entries) > 0 {
+			result.Set(iface.Name, entries)
+		}
+	}
+	return result
+}
@@ -0,0 +1,139 @@
+//go:build linux
+
+package modules
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// clockTickMillis is the length of a clock tick of /proc/stat, which the
+// kernel always reports in units of 1/100 s
+const clockTickMillis = 10
+
+// hostCPUs reads the CPU times from /proc/stat, the models from
+// /proc/cpuinfo and the speeds from cpufreq
+func hostCPUs() []cpuInfo {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return portableCPUs()
+	}
+	var cpus []cpuInfo
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 7 || !strings.HasPrefix(fields[0], "cpu") || fields[0] == "cpu" {
+			continue
+		}
+		tick := func(i int) float64 {
+			n, _ := strconv.ParseFloat(fields[i], 64)
+			return n * clockTickMillis
+		}
+		cpu := cpuInfo{model: "unknown", user: tick(1), nice: tick(2), sys: tick(3), idle: tick(4), irq: tick(6)}
+		freq, err := os.ReadFile("/sys/devices/system/cpu/" + fields[0] + "/cpufreq/scaling_cur_freq")
+		if err == nil {
+			khz, _ := strconv.Atoi(strings.TrimSpace(string(freq)))
+			cpu.speed = khz / 1000
+		}
+		cpus = append(cpus, cpu)
+	}
+
+	if f, err := os.Open("/proc/cpuinfo"); err == nil {
+		defer f.Close()
+		i := 0
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() && i < len(cpus) {
+			key, value, ok := strings.Cut(scanner.Text(), ":")
+			if ok && strings.TrimSpace(key) == "model name" {
+				cpus[i].model = strings.TrimSpace(value)
+				i++
+			}
+		}
+	}
+	return cpus
+}
+
+// hostMemory returns the total memory and the memory available to new
+// programs, in bytes
+func hostMemory() (total, free uint64) {
+	if f, err := os.Open("/proc/meminfo"); err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 2 {
+				continue
+			}
+			kb, _ := strconv.ParseUint(fields[1], 10, 64)
+			switch fields[0] {
+			case "MemTotal:":
+				total = kb * 1024
+			case "MemAvailable:":
+				free = kb * 1024
+			}
+		}
+		if total > 0 {
+			return total, free
+		}
+	}
+	var info syscall.Sysinfo_t
+	if syscall.Sysinfo(&info) != nil {
+		return 0, 0
+	}
+	unit := uint64(info.Unit)
+	return uint64(info.Totalram) * unit, uint64(info.Freeram) * unit
+}
+
+// hostUptime returns the seconds since boot from /proc/uptime
+func hostUptime() float64 {
+	if data, err := os.ReadFile("/proc/uptime"); err == nil {
+		if fields := strings.Fields(string(data)); len(fields) > 0 {
+			if up, err := strconv.ParseFloat(fields[0], 64); err == nil {
+				return up
+			}
+		}
+	}
+	var info syscall.Sysinfo_t
+	if syscall.Sysinfo(&info) != nil {
+		return 0
+	}
+	return float64(info.Uptime)
+}
+
+// hostLoadavg returns the load averages from /proc/loadavg
+func hostLoadavg() [3]float64 {
+	var load [3]float64
+	if data, err := os.ReadFile("/proc/loadavg"); err == nil {
+		fields := strings.Fields(string(data))
+		for i := 0; i < 3 && i < len(fields); i++ {
+			load[i], _ = strconv.ParseFloat(fields[i], 64)
+		}
+		return load
+	}
+	var info syscall.Sysinfo_t
+	if syscall.Sysinfo(&info) == nil {
+		for i := range load {
+			load[i] = float64(info.Loads[i]) / (1 << 16)
+		}
+	}
+	return load
+}
+
+// userShell looks up the login shell of username in /etc/passwd
+func userShell(username string) string {
+	f, err := os.Open("/etc/passwd")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) == 7 && fields[0] == username {
+			return fields[6]
+		}
+	}
+	return ""
+}
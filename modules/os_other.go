@@ -0,0 +1,29 @@
+//go:build !linux
+
+package modules
+
+// hostCPUs describes the CPUs. Only their number is known on other
+// platforms.
+func hostCPUs() []cpuInfo {
+	return portableCPUs()
+}
+
+// hostMemory is not known on other platforms
+func hostMemory() (total, free uint64) {
+	return 0, 0
+}
+
+// hostUptime is not known on other platforms
+func hostUptime() float64 {
+	return 0
+}
+
+// hostLoadavg is not known on other platforms
+func hostLoadavg() [3]float64 {
+	return [3]float64{}
+}
+
+// userShell is not known on other platforms
+func userShell(username string) string {
+	return ""
+}
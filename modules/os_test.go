@@ -0,0 +1,50 @@
+package modules_test
+
+import (
+	"os"
+	goruntime "runtime"
+	"strconv"
+	"testing"
+
+	"gojs/internal/jstest"
+)
+
+func TestOSHostInformation(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jstest.ExpectOutput(t, `
+		const os = require('os');
+		console.log(os.hostname() === `+jstest.Quote(hostname)+`, os.platform() === process.platform, os.arch() === process.arch);
+		console.log(os.tmpdir() === `+jstest.Quote(os.TempDir())+`, typeof os.homedir(), JSON.stringify(os.EOL));
+		console.log(os.constants.signals.SIGTERM, os.constants.signals.SIGKILL, require('node:os') === os);
+	`, "true true true\ntrue string \"\\n\"\n15 9 true\n")
+}
+
+func TestOSResources(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const os = require('os');
+		const cpus = os.cpus();
+		const times = cpus[0].times;
+		console.log(cpus.length, typeof cpus[0].model, typeof cpus[0].speed, Object.keys(times).join());
+		console.log(os.totalmem() >= os.freemem(), os.loadavg().length, os.uptime() >= 0);
+	`, strconv.Itoa(goruntime.NumCPU())+" string number user,nice,sys,idle,irq\ntrue 3 true\n")
+}
+
+func TestOSNetworkInterfaces(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const all = Object.values(require('os').networkInterfaces()).flat();
+		const lo = all.find((i) => i.address === '127.0.0.1');
+		console.log(lo.family, lo.internal, lo.netmask, lo.cidr, lo.mac);
+	`, "IPv4 true 255.0.0.0 127.0.0.1/8 00:00:00:00:00:00\n")
+}
+
+func TestOSUserInfo(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const os = require('os');
+		const user = os.userInfo();
+		console.log(user.uid === `+strconv.Itoa(os.Getuid())+`, typeof user.username, user.homedir === os.homedir());
+		console.log(Buffer.isBuffer(os.userInfo({ encoding: 'buffer' }).username));
+	`, "true string true\ntrue\n")
+}
@@ -0,0 +1,198 @@
+package modules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// Permissions restricts what scripts can access. The zero value denies all
+// file system and environment access; a nil *Permissions allows everything.
+type Permissions struct {
+	// AllowRead lists the files and directories scripts may read
+	AllowRead []string
+	// AllowWrite lists the files and directories scripts may write
+	AllowWrite []string
+	// AllowEnv allows reading and changing environment variables
+	AllowEnv bool
+	// AllowChildProcess allows running other programs with child_process
+	AllowChildProcess bool
+	// DenyRequire forbids loading modules from files with require and
+	// import. Built-in modules stay available.
+	DenyRequire bool
+}
+
+// Permission names reported in the permission property of ERR_ACCESS_DENIED errors
+const (
+	permissionRead         = "FileSystemRead"
+	permissionWrite        = "FileSystemWrite"
+	permissionEnv          = "Environment"
+	permissionChildProcess = "ChildProcess"
+	permissionRequire      = "Require"
+)
+
+// permissionState holds the grants in effect for a runtime, with paths made
+// absolute. Its fields are unexported so scripts cannot change them.
+type permissionState struct {
+	read         []string
+	write        []string
+	env          bool
+	childProcess bool
+	denyRequire  bool
+}
+
+// SetPermissions restricts the scripts run by vm. It must be called before any
+// script runs; a nil p leaves access unrestricted.
+func SetPermissions(vm *goja.Runtime, p *Permissions) error {
+	if p == nil {
+		return nil
+	}
+	state := &permissionState{
+		read:         grantedPaths(p.AllowRead),
+		write:        grantedPaths(p.AllowWrite),
+		env:          p.AllowEnv,
+		childProcess: p.AllowChildProcess,
+		denyRequire:  p.DenyRequire,
+	}
+	return vm.GlobalObject().DefineDataProperty("__permissions", vm.ToValue(state), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+}
+
+// permissionsOf returns the grants of vm, or nil if access is unrestricted
+func permissionsOf(vm *goja.Runtime) *permissionState {
+	val := vm.GlobalObject().Get("__permissions")
+	if val == nil {
+		return nil
+	}
+	state, _ := val.Export().(*permissionState)
+	return state
+}
+
+// grantedPaths makes the granted paths absolute
+func grantedPaths(paths []string) []string {
+	granted := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		granted = append(granted, realPath(path))
+	}
+	return granted
+}
+
+// maxSymlinks bounds the links realPath follows, like the ELOOP limit of
+// the kernel
+const maxSymlinks = 40
+
+// realPath returns the absolute path of path with symlinks resolved. For a
+// path that does not exist yet, symlinks are resolved in its closest existing
+// parent, and a dangling symlink is followed to the file a write through it
+// would create, so a link cannot be used to escape a granted directory.
+func realPath(path string) string {
+	return resolvePath(path, 0)
+}
+
+func resolvePath(path string, links int) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = filepath.Clean(path)
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real
+	}
+	parent := filepath.Dir(abs)
+	if parent == abs {
+		return abs
+	}
+	dir := resolvePath(parent, links)
+	if target, err := os.Readlink(abs); err == nil && links < maxSymlinks {
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(dir, target)
+		}
+		return resolvePath(target, links+1)
+	}
+	return filepath.Join(dir, filepath.Base(abs))
+}
+
+// pathGranted reports whether path is one of grants or lies inside one
+func pathGranted(grants []string, path string) bool {
+	target := realPath(path)
+	for _, grant := range grants {
+		if target == grant || strings.HasPrefix(target, strings.TrimSuffix(grant, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// canRead reports whether scripts may read path
+func canRead(vm *goja.Runtime, path string) bool {
+	p := permissionsOf(vm)
+	return p == nil || pathGranted(p.read, path)
+}
+
+// checkRead throws ERR_ACCESS_DENIED unless scripts may read path
+func checkRead(vm *goja.Runtime, path string) {
+	if !canRead(vm, path) {
+		panic(accessDenied(vm, permissionRead, path))
+	}
+}
+
+// checkWrite throws ERR_ACCESS_DENIED unless scripts may write path
+func checkWrite(vm *goja.Runtime, path string) {
+	if p := permissionsOf(vm); p != nil && !pathGranted(p.write, path) {
+		panic(accessDenied(vm, permissionWrite, path))
+	}
+}
+
+// CheckEnv throws ERR_ACCESS_DENIED unless scripts may use the environment
+// variable name
+func CheckEnv(vm *goja.Runtime, name string) {
+	if p := permissionsOf(vm); p != nil && !p.env {
+		panic(accessDenied(vm, permissionEnv, name))
+	}
+}
+
+// checkChildProcess throws ERR_ACCESS_DENIED unless scripts may run the
+// program file
+func checkChildProcess(vm *goja.Runtime, file string) {
+	if p := permissionsOf(vm); p != nil && !p.childProcess {
+		panic(accessDenied(vm, permissionChildProcess, file))
+	}
+}
+
+// checkRequire throws ERR_ACCESS_DENIED unless scripts may load the module
+// file at path
+func checkRequire(vm *goja.Runtime, path string) {
+	p := permissionsOf(vm)
+	if p == nil {
+		return
+	}
+	if p.denyRequire {
+		panic(accessDenied(vm, permissionRequire, path))
+	}
+	checkRead(vm, path)
+}
+
+// permissionFlags names the command line flag that grants each permission
+var permissionFlags = map[string]string{
+	permissionRead:         "--allow-read",
+	permissionWrite:        "--allow-write",
+	permissionEnv:          "--allow-env",
+	permissionChildProcess: "--allow-child-process",
+}
+
+// accessDenied creates the error thrown when a script exceeds its grants
+func accessDenied(vm *goja.Runtime, permission, resource string) *goja.Object {
+	msg := fmt.Sprintf("Access to this API has been restricted (%s: %s)", permission, resource)
+	if flag, ok := permissionFlags[permission]; ok {
+		msg += ". Use " + flag + " to grant access"
+	}
+	err, _ := vm.New(vm.Get("Error"), vm.ToValue(msg))
+	err.Set("code", "ERR_ACCESS_DENIED")
+	err.Set("permission", permission)
+	err.Set("resource", resource)
+	return err
+}
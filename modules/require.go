@@ -1,186 +1,359 @@
 package modules
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"strings"
 
 	"github.com/dop251/goja"
 )
 
-// SetupRequire sets up the require function for module loading
+// SetupRequire sets up the require function for module loading.
+//
+// Built-in modules registered with RegisterModule live in __moduleCache under
+// their names. Modules loaded from files live in require.cache, keyed by
+// their canonical absolute path and shared by every require function.
 func SetupRequire(vm *goja.Runtime, currentDir string) error {
-	// Get or create module cache
-	var cache *goja.Object
-	cacheVal := vm.Get("__moduleCache")
-	if cacheVal != nil && !goja.IsUndefined(cacheVal) {
-		cache = cacheVal.ToObject(vm)
+	// Get or create the built-in module cache
+	builtins := globalObject(vm, "__moduleCache")
+
+	// Get or create the file module cache
+	cache := globalObject(vm, "__requireCache")
+
+	// ES modules are loaded by the loader installed by SetupESM, if any
+	loader := esmLoaderOf(vm)
+
+	// makeRequire creates the require function for modules in dir
+	var makeRequire func(dir string, parent *goja.Object) *goja.Object
+
+	// dynamicImport creates the function that import() calls are rewritten
+	// to for scripts and CommonJS modules in dir
+	dynamicImport := func(dir string) goja.Value {
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			if loader == nil {
+				panic(NewNodeError(vm, "Error", "", "import() is not supported without ES module support"))
+			}
+			return loader.dynamicImport(call.Argument(0).String(), dir)
+		})
 	}
 
-	if cache == nil {
-		cache = vm.NewObject()
+	// builtin returns the exports of a built-in module, or nil
+	builtin := func(moduleName string) goja.Value {
+		name := strings.TrimPrefix(moduleName, "node:")
+		module := builtins.Get(name)
+		if module == nil || goja.IsUndefined(module) {
+			if name != moduleName {
+				panic(NewNodeError(vm, "Error", "ERR_UNKNOWN_BUILTIN_MODULE", "No such built-in module: "+moduleName))
+			}
+			return nil
+		}
+		return module.ToObject(vm).Get("exports")
 	}
 
-	// Create require function
-	require := func(call goja.FunctionCall) goja.Value {
-		if len(call.Arguments) < 1 {
-			panic(vm.ToValue("require() requires a module name"))
+	resolve := func(moduleName, fromDir string, parent *goja.Object) string {
+		filePath, err := resolveModule(moduleName, fromDir, requireConditions)
+		if err != nil {
+			panic(requireError(vm, err, parent))
 		}
+		return canonicalPath(filePath)
+	}
 
-		moduleName := call.Arguments[0].String()
+	// root is the require function of scripts; mainModule is the module
+	// require.main refers to once a main module was loaded
+	var root, mainModule *goja.Object
 
-		// Check cache first
-		cached := cache.Get(moduleName)
-		if cached != nil && !goja.IsUndefined(cached) {
-			cachedModule := cached.ToObject(vm)
-			if cachedModule != nil {
-				exports := cachedModule.Get("exports")
-				if exports != nil {
-					return exports
-				}
-			}
-		}
+	// loadFile loads the CommonJS or JSON module at filePath, or returns it
+	// from the cache
+	var loadFile func(filePath string, parent *goja.Object, main bool) goja.Value
 
-		// Check if it's a built-in module
-		if moduleName == "fs" || moduleName == "path" {
-			builtinModule := cache.Get(moduleName)
-			if builtinModule != nil && !goja.IsUndefined(builtinModule) {
-				moduleObj := builtinModule.ToObject(vm)
-				if moduleObj != nil {
-					return moduleObj.Get("exports")
-				}
-			}
-			panic(vm.ToValue(fmt.Sprintf("Built-in module '%s' not found", moduleName)))
+	load := func(moduleName, fromDir string, parent *goja.Object) goja.Value {
+		// Built-in modules take precedence over files
+		if exports := builtin(moduleName); exports != nil {
+			return exports
 		}
 
-		// Try to load as file
-		var filePath string
-		if filepath.IsAbs(moduleName) {
-			filePath = moduleName
-		} else if moduleName[0] == '.' {
-			filePath = filepath.Join(currentDir, moduleName)
-		} else {
-			// Try node_modules
-			filePath = filepath.Join(currentDir, "node_modules", moduleName)
+		filePath := resolve(moduleName, fromDir, parent)
+		checkRequire(vm, filePath)
+
+		// require() of an ES module returns its namespace
+		if loader != nil && IsESModule(filePath) {
+			return loader.require(filePath)
 		}
+		return loadFile(filePath, parent, false)
+	}
 
-		// Try adding .js extension if not present
-		if filepath.Ext(filePath) == "" {
-			filePath += ".js"
+	loadFile = func(filePath string, parent *goja.Object, main bool) goja.Value {
+		// Check cache first. A module that is still loading (circular
+		// dependency) returns its partial exports.
+		if cached := cache.Get(filePath); cached != nil && !goja.IsUndefined(cached) {
+			cachedModule := cached.ToObject(vm)
+			addChild(vm, parent, cachedModule)
+			return cachedModule.Get("exports")
 		}
 
 		// Read the file
 		content, err := ioutil.ReadFile(filePath)
 		if err != nil {
-			panic(vm.ToValue(fmt.Sprintf("Cannot find module '%s': %v", moduleName, err)))
+			panic(NewSystemError(vm, err, "open", filePath))
 		}
 
 		// Create module object
+		moduleDir := filepath.Dir(filePath)
 		moduleObj := vm.NewObject()
 		exportsObj := vm.NewObject()
+		moduleObj.Set("id", filePath)
+		if main {
+			// Like in Node.js the main module is identified as "."
+			moduleObj.Set("id", ".")
+			mainModule = moduleObj
+			root.Set("main", moduleObj)
+		}
+		moduleObj.Set("filename", filePath)
+		moduleObj.Set("path", moduleDir)
 		moduleObj.Set("exports", exportsObj)
+		moduleObj.Set("loaded", false)
+		moduleObj.Set("children", vm.NewArray())
+		moduleObj.Set("paths", nodeModulesPaths(moduleDir))
+		if parent != nil {
+			moduleObj.Set("parent", parent)
+		} else {
+			moduleObj.Set("parent", goja.Null())
+		}
+		addChild(vm, parent, moduleObj)
 
 		// Set module in cache before execution to handle circular dependencies
-		cache.Set(moduleName, moduleObj)
+		cache.Set(filePath, moduleObj)
 
-		// Create module scope
-		moduleDir := filepath.Dir(filePath)
-		moduleRequire := func(call goja.FunctionCall) goja.Value {
-			return SetupRequireInner(vm, moduleDir)(call)
+		// JSON files export their parsed content
+		if filepath.Ext(filePath) == ".json" {
+			parse, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("parse"))
+			parsed, err := parse(goja.Undefined(), vm.ToValue(string(content)))
+			if err != nil {
+				cache.Delete(filePath)
+				throwError(vm, err)
+			}
+			moduleObj.Set("exports", parsed)
+			moduleObj.Set("loaded", true)
+			return parsed
 		}
 
-		// Wrap module code in a function
-		wrappedCode := fmt.Sprintf(`(function(exports, require, module, __filename, __dirname) {
-%s
-})`, string(content))
+		// Create module scope
+		moduleRequire := makeRequire(moduleDir, moduleObj)
+		moduleObj.Set("require", moduleRequire)
 
-		// Compile and run
-		prg, err := goja.Compile(filePath, wrappedCode, false)
+		// Wrap module code in a function, keeping its positions
+		source := stripShebang(string(content))
+		prg, err := compileWrapped(filePath, "(function(exports, require, module, __filename, __dirname, __dynamicImport) {",
+			rewriteDynamicImport(source, "__dynamicImport"), "\n})")
 		if err != nil {
-			cache.Delete(moduleName)
-			panic(vm.ToValue(fmt.Sprintf("Error compiling module '%s': %v", moduleName, err)))
+			cache.Delete(filePath)
+			panic(NewNodeError(vm, "SyntaxError", "", strings.TrimPrefix(err.Error(), "SyntaxError: ")))
 		}
 
 		val, err := vm.RunProgram(prg)
 		if err != nil {
-			cache.Delete(moduleName)
-			panic(vm.ToValue(fmt.Sprintf("Error loading module '%s': %v", moduleName, err)))
+			cache.Delete(filePath)
+			throwError(vm, err)
 		}
 
 		fn, ok := goja.AssertFunction(val)
 		if !ok {
-			cache.Delete(moduleName)
-			panic(vm.ToValue(fmt.Sprintf("Error loading module '%s': not a function", moduleName)))
+			cache.Delete(filePath)
+			panic(NewNodeError(vm, "Error", "", fmt.Sprintf("Error loading module '%s': not a function", filePath)))
 		}
 
 		// Call the wrapped function
-		_, err = fn(goja.Undefined(),
+		_, err = fn(exportsObj,
 			exportsObj,
-			vm.ToValue(moduleRequire),
+			moduleRequire,
 			moduleObj,
 			vm.ToValue(filePath),
 			vm.ToValue(moduleDir),
+			dynamicImport(moduleDir),
 		)
 
 		if err != nil {
-			cache.Delete(moduleName)
-			panic(vm.ToValue(fmt.Sprintf("Error executing module '%s': %v", moduleName, err)))
+			cache.Delete(filePath)
+			throwError(vm, err)
 		}
 
+		moduleObj.Set("loaded", true)
+
 		// Return exports
 		return moduleObj.Get("exports")
 	}
 
-	// Store cache globally so RegisterModule can access it
-	vm.Set("__moduleCache", cache)
+	makeRequire = func(dir string, parent *goja.Object) *goja.Object {
+		require := vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			id, ok := call.Argument(0).Export().(string)
+			if !ok {
+				panic(ErrInvalidArgType(vm, "id", "of type string", call.Argument(0)))
+			}
+			return load(id, dir, parent)
+		}).ToObject(vm)
+
+		// require.resolve returns the absolute path a request would load
+		resolveFn := vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			moduleName, ok := call.Argument(0).Export().(string)
+			if !ok {
+				panic(ErrInvalidArgType(vm, "request", "of type string", call.Argument(0)))
+			}
+			if builtin(moduleName) != nil {
+				return vm.ToValue(moduleName)
+			}
+			return vm.ToValue(resolve(moduleName, dir, parent))
+		}).ToObject(vm)
+
+		// require.resolve.paths lists the node_modules directories searched
+		resolveFn.Set("paths", func(call goja.FunctionCall) goja.Value {
+			if builtin(call.Argument(0).String()) != nil {
+				return goja.Null()
+			}
+			return vm.ToValue(nodeModulesPaths(dir))
+		})
+
+		require.Set("resolve", resolveFn)
+		require.Set("cache", cache)
+		if mainModule != nil {
+			require.Set("main", mainModule)
+		}
+		return require
+	}
+
+	if loader != nil {
+		loader.requireFile = func(path string) goja.Value {
+			return load(path, filepath.Dir(path), nil)
+		}
+	}
+
+	root = makeRequire(currentDir, nil)
+	vm.Set("require", root)
+	vm.GlobalObject().Set("require", root)
+	vm.Set("__dynamicImport", dynamicImport(currentDir))
+
+	// The main module is run by the host, so DenyRequire does not apply
+	main := &mainLoader{load: func(path string) {
+		loadFile(path, nil, true)
+	}}
+	return vm.GlobalObject().DefineDataProperty("__requireMain", vm.ToValue(main), goja.FLAG_FALSE, goja.FLAG_TRUE, goja.FLAG_FALSE)
+}
 
-	vm.Set("require", require)
-	vm.GlobalObject().Set("require", require)
+// mainLoader loads the main module with the require functions of the last
+// SetupRequire
+type mainLoader struct {
+	load func(path string)
+}
 
+// RequireMain runs the CommonJS module at path as the main module, the one
+// require.main refers to. Like require, it throws the errors of the module.
+func RequireMain(vm *goja.Runtime, path string) error {
+	var main *mainLoader
+	if val := vm.GlobalObject().Get("__requireMain"); val != nil {
+		main, _ = val.Export().(*mainLoader)
+	}
+	if main == nil {
+		return errors.New("require is not set up - call SetupRequire first")
+	}
+	main.load(canonicalPath(path))
 	return nil
 }
 
-// SetupRequireInner creates a require function for a specific directory context
-func SetupRequireInner(vm *goja.Runtime, currentDir string) func(goja.FunctionCall) goja.Value {
-	return func(call goja.FunctionCall) goja.Value {
-		// This is a simplified version - in a real implementation,
-		// you'd want to share the cache across all require functions
-		if len(call.Arguments) < 1 {
-			panic(vm.ToValue("require() requires a module name"))
-		}
-
-		moduleName := call.Arguments[0].String()
-
-		// Check for built-in modules
-		if moduleName == "fs" || moduleName == "path" {
-			require := vm.Get("require")
-			if fn, ok := goja.AssertFunction(require); ok {
-				val, err := fn(goja.Undefined(), call.Arguments...)
-				if err != nil {
-					panic(err)
-				}
-				return val
-			}
+// requireError converts a resolution failure into the error require()
+// throws. MODULE_NOT_FOUND errors list the chain of requiring modules, like
+// Node.js: "Cannot find module 'x'\nRequire stack:\n- /app/a.js".
+func requireError(vm *goja.Runtime, err error, parent *goja.Object) goja.Value {
+	var re *resolveError
+	if !errors.As(err, &re) || re.Code != "MODULE_NOT_FOUND" || re.Reason != "" {
+		return jsError(vm, err)
+	}
+
+	var stack []interface{}
+	for module := parent; module != nil; {
+		stack = append(stack, module.Get("filename").String())
+		next, ok := module.Get("parent").(*goja.Object)
+		if !ok {
+			break
 		}
+		module = next
+	}
 
-		// For relative paths, resolve from current directory
-		var filePath string
-		if moduleName[0] == '.' {
-			filePath = filepath.Join(currentDir, moduleName)
-		} else {
-			filePath = moduleName
+	message := fmt.Sprintf("Cannot find module '%s'", re.Specifier)
+	if len(stack) > 0 {
+		message += "\nRequire stack:"
+		for _, filename := range stack {
+			message += "\n- " + filename.(string)
 		}
+	}
+	obj := NewNodeError(vm, "Error", re.Code, message)
+	obj.Set("requireStack", vm.NewArray(stack...))
+	return obj
+}
 
-		// Delegate to main require
-		require := vm.Get("require")
-		if fn, ok := goja.AssertFunction(require); ok {
-			val, err := fn(goja.Undefined(), vm.ToValue(filePath))
-			if err != nil {
-				panic(err)
-			}
-			return val
+// globalObject returns the object stored in the named global, creating it if needed
+func globalObject(vm *goja.Runtime, name string) *goja.Object {
+	if val := vm.Get(name); val != nil && !goja.IsUndefined(val) {
+		if obj := val.ToObject(vm); obj != nil {
+			return obj
+		}
+	}
+	obj := vm.NewObject()
+	vm.Set(name, obj)
+	return obj
+}
+
+// canonicalPath resolves symlinks so each file has a single cache key
+func canonicalPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real
+	}
+	return path
+}
+
+// addChild records child in parent.children unless it is already there
+func addChild(vm *goja.Runtime, parent, child *goja.Object) {
+	if parent == nil {
+		return
+	}
+	children := parent.Get("children").ToObject(vm)
+	length := int(children.Get("length").ToInteger())
+	for i := 0; i < length; i++ {
+		if children.Get(fmt.Sprint(i)).StrictEquals(child) {
+			return
 		}
+	}
+	children.Set(fmt.Sprint(length), child)
+}
 
-		panic(vm.ToValue("require function not available"))
+// RewriteDynamicImport rewrites import() calls in a script into calls to the
+// __dynamicImport function installed by SetupRequire
+func RewriteDynamicImport(source string) string {
+	return rewriteDynamicImport(source, "__dynamicImport")
+}
+
+// stripShebang comments out a leading #! line so the wrapped module compiles
+func stripShebang(source string) string {
+	if strings.HasPrefix(source, "#!") {
+		return "//" + source
 	}
+	return source
+}
+
+// builtinExports returns the exports of a module registered with RegisterModule
+func builtinExports(vm *goja.Runtime, name string) (goja.Value, error) {
+	cacheVal := vm.Get("__moduleCache")
+	if cacheVal == nil || goja.IsUndefined(cacheVal) {
+		return nil, fmt.Errorf("module cache not initialized - call SetupRequire first")
+	}
+
+	module := cacheVal.ToObject(vm).Get(name)
+	if module == nil || goja.IsUndefined(module) {
+		return nil, fmt.Errorf("built-in module '%s' not found", name)
+	}
+
+	return module.ToObject(vm).Get("exports"), nil
 }
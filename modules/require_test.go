@@ -0,0 +1,172 @@
+package modules_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gojs/internal/jstest"
+)
+
+// expectFileOutput writes files to a new directory, runs main.js from it and
+// fails unless it succeeds and prints want
+func expectFileOutput(t *testing.T, files map[string]string, want string) {
+	t.Helper()
+	dir := t.TempDir()
+	jstest.WriteFiles(t, dir, files)
+	got, err := jstest.RunFile(t, filepath.Join(dir, "main.js"))
+	if err != nil {
+		t.Fatalf("script failed: %v\noutput:\n%s", err, got)
+	}
+	if got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestRequireResolvesFiles(t *testing.T) {
+	expectFileOutput(t, map[string]string{
+		"main.js": `
+			console.log(require('./lib').name, require('./data').value, require('./common').name);
+			console.log(require('./dir').name, require('./pkgdir').name);
+			console.log(require('node:path') === require('path'));
+		`,
+		"lib.js":              "exports.name = 'lib';",
+		"data.json":           `{"value": 42}`,
+		"common.cjs":          "exports.name = 'cjs';",
+		"dir/index.js":        "exports.name = 'index';",
+		"pkgdir/package.json": `{"main": "src/entry.js"}`,
+		"pkgdir/src/entry.js": "exports.name = 'main field';",
+	}, "lib 42 cjs\nindex main field\ntrue\n")
+}
+
+func TestRequireWalksUpNodeModules(t *testing.T) {
+	expectFileOutput(t, map[string]string{
+		"main.js":                       "console.log(require('./a/b/c').name);",
+		"a/b/c.js":                      "module.exports = require('dep');",
+		"node_modules/dep/package.json": `{"main": "lib/dep.js"}`,
+		"node_modules/dep/lib/dep.js":   "exports.name = 'dep';",
+		"a/node_modules/other/index.js": "exports.name = 'unused';",
+	}, "dep\n")
+}
+
+func TestRequirePackageExportsAndImports(t *testing.T) {
+	expectFileOutput(t, map[string]string{
+		"package.json": `{"imports": {"#internal": "./internal.js"}}`,
+		"main.js": `
+			console.log(require('cond').name, require('cond/feature/x').name, require('#internal').name);
+			try { require('cond/hidden'); } catch (e) { console.log(e.code); }
+		`,
+		"internal.js": "exports.name = 'internal';",
+		"node_modules/cond/package.json": `{
+			"exports": {
+				".": {"import": "./esm.js", "require": "./req.js", "default": "./def.js"},
+				"./feature/*": "./features/*.js"
+			}
+		}`,
+		"node_modules/cond/req.js":        "exports.name = 'require condition';",
+		"node_modules/cond/def.js":        "exports.name = 'default condition';",
+		"node_modules/cond/features/x.js": "exports.name = 'feature x';",
+		"node_modules/cond/hidden.js":     "exports.name = 'hidden';",
+	}, "require condition feature x internal\nERR_PACKAGE_PATH_NOT_EXPORTED\n")
+}
+
+func TestRequireMissingModule(t *testing.T) {
+	expectFileOutput(t, map[string]string{
+		"main.js": `
+			try { require('./lib'); } catch (e) {
+				console.log(e instanceof Error, e.code, e.message.split('\n')[0]);
+				console.log(e.requireStack.map((file) => require('path').basename(file)).join(' < '));
+			}
+		`,
+		"lib.js": "require('missing');",
+	}, "true MODULE_NOT_FOUND Cannot find module 'missing'\nlib.js < main.js\n")
+}
+
+func TestRequireModuleErrors(t *testing.T) {
+	expectFileOutput(t, map[string]string{
+		"main.js": `
+			try { require('./syntax'); } catch (e) { console.log(e instanceof SyntaxError); }
+			try { require('./throws'); } catch (e) { console.log(e instanceof RangeError, e.message, e.custom); }
+		`,
+		"syntax.js": "let = ;",
+		"throws.js": "const e = new RangeError('thrown'); e.custom = 1; throw e;",
+	}, "true\ntrue thrown 1\n")
+}
+
+func TestRequireReportsPositionsInTheModule(t *testing.T) {
+	expectFileOutput(t, map[string]string{
+		"main.js": `
+			console.log(/lib\.js:(\d+:\d+)/.exec(require('./lib').stack)[1]);
+			try { require('./syntax'); } catch (e) { console.log(/Line \d+:\d+/.exec(e.message)[0]); }
+		`,
+		"lib.js":    "module.exports = new Error('x');",
+		"syntax.js": "let a = ;",
+	}, "1:18\nLine 1:9\n")
+}
+
+func TestRequireCachesByCanonicalPath(t *testing.T) {
+	expectFileOutput(t, map[string]string{
+		"main.js": `
+			const a = require('./a/index');
+			const b = require('./b/index');
+			console.log(a.util.name, b.util.name, a.util === b.util);
+			console.log(require('./a/util') === a.util, require('./b/../a/util.js') === a.util);
+		`,
+		"a/index.js": "exports.util = require('./util');",
+		"a/util.js":  "exports.name = 'a';",
+		"b/index.js": "exports.util = require('./util');",
+		"b/util.js":  "exports.name = 'b';",
+	}, "a b false\ntrue true\n")
+}
+
+func TestRequireCache(t *testing.T) {
+	expectFileOutput(t, map[string]string{
+		"main.js": `
+			const path = require('path');
+			const file = require.resolve('./counter');
+			console.log(path.basename(file), file in require.cache);
+			console.log(require('./counter').loads, require('./counter').loads, file in require.cache);
+			delete require.cache[file];
+			console.log(require('./counter').loads);
+		`,
+		"counter.js": "global.loads = (global.loads || 0) + 1; exports.loads = global.loads;",
+	}, "counter.js false\n1 1 true\n2\n")
+}
+
+func TestRequireModuleObject(t *testing.T) {
+	expectFileOutput(t, map[string]string{
+		"main.js": `
+			const child = require('./child');
+			console.log(child.id === child.filename, child.loadedWhileRunning, require.cache[child.filename].loaded);
+			console.log(child.isParentOfGrandchild, child.childCount);
+		`,
+		"child.js": `
+			const grandchild = require('./grandchild');
+			exports.id = module.id;
+			exports.filename = module.filename;
+			exports.loadedWhileRunning = module.loaded;
+			exports.isParentOfGrandchild = grandchild.parent === module && module.children.includes(grandchild.module);
+			exports.childCount = module.children.length;
+		`,
+		"grandchild.js": "exports.parent = module.parent; exports.module = module;",
+	}, "true false true\ntrue 1\n")
+}
+
+func TestRequireCircularDependencies(t *testing.T) {
+	expectFileOutput(t, map[string]string{
+		"main.js": "const a = require('./a'); console.log(a.partial, a.done);",
+		"a.js":    "exports.before = 1; exports.partial = require('./b').seen; exports.done = true;",
+		"b.js":    "exports.seen = JSON.stringify(require('./a'));",
+	}, "{\"before\":1} true\n")
+}
+
+func TestRunFileLoadsTheMainModule(t *testing.T) {
+	expectFileOutput(t, map[string]string{
+		"main.js": `
+			const child = require('./child');
+			console.log(require.main === module, module.id, module.parent, this === exports);
+			console.log(__filename === require('path').join(__dirname, 'main.js'), require.cache[__filename] === module);
+			console.log(child.parentIsMain, module.children.length);
+		`,
+		"child.js": `exports.parentIsMain = module.parent === require.main;`,
+	}, "true . null true\ntrue true\ntrue 1\n")
+}
@@ -0,0 +1,329 @@
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// requireConditions are the conditional export keys matched by require()
+var requireConditions = []string{"require", "node", "default"}
+
+// fileExtensions are tried in order when a specifier has no matching file
+var fileExtensions = []string{".js", ".json", ".cjs"}
+
+// packageJSON holds the fields of package.json used for resolution
+type packageJSON struct {
+	Name    string      `json:"name"`
+	Main    string      `json:"main"`
+	Type    string      `json:"type"`
+	Exports interface{} `json:"exports"`
+	Imports interface{} `json:"imports"`
+}
+
+// resolveError is returned when a specifier cannot be resolved
+type resolveError struct {
+	Specifier string
+	FromDir   string
+	Code      string
+	Reason    string
+}
+
+func (e *resolveError) Error() string {
+	if e.Reason != "" {
+		return e.Reason
+	}
+	return fmt.Sprintf("Cannot find module '%s' from '%s'", e.Specifier, e.FromDir)
+}
+
+// resolveModule implements the Node.js module resolution algorithm and
+// returns the absolute path of the file that specifier refers to when
+// required from fromDir
+func resolveModule(specifier, fromDir string, conditions []string) (string, error) {
+	notFound := &resolveError{Specifier: specifier, FromDir: fromDir, Code: "MODULE_NOT_FOUND"}
+
+	if specifier == "" {
+		return "", notFound
+	}
+
+	// Absolute and relative paths
+	if filepath.IsAbs(specifier) || isRelativeSpecifier(specifier) {
+		target := specifier
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(fromDir, target)
+		}
+		if file, ok := loadAsFile(target); ok {
+			return file, nil
+		}
+		if file, ok, err := loadAsDirectory(target); ok || err != nil {
+			return file, err
+		}
+		return "", notFound
+	}
+
+	// Package imports ("#name")
+	if strings.HasPrefix(specifier, "#") {
+		return resolvePackageImports(specifier, fromDir, conditions)
+	}
+
+	// A package can require itself by name
+	if pkgDir, pkg := findPackageJSON(fromDir); pkg != nil && pkg.Name != "" && pkg.Exports != nil {
+		if specifier == pkg.Name || strings.HasPrefix(specifier, pkg.Name+"/") {
+			return resolvePackageExports(pkgDir, pkg, "."+strings.TrimPrefix(specifier, pkg.Name), conditions)
+		}
+	}
+
+	// node_modules lookup, walking up from fromDir
+	name, subpath := splitPackageSpecifier(specifier)
+	for _, dir := range nodeModulesPaths(fromDir) {
+		pkgDir := filepath.Join(dir, name)
+		if pkg := readPackageJSON(pkgDir); pkg != nil && pkg.Exports != nil {
+			return resolvePackageExports(pkgDir, pkg, subpath, conditions)
+		}
+
+		target := filepath.Join(dir, specifier)
+		if file, ok := loadAsFile(target); ok {
+			return file, nil
+		}
+		if file, ok, err := loadAsDirectory(target); ok || err != nil {
+			return file, err
+		}
+	}
+
+	return "", notFound
+}
+
+// isRelativeSpecifier reports whether s is relative to the requiring module
+func isRelativeSpecifier(s string) bool {
+	return s == "." || s == ".." || strings.HasPrefix(s, "./") || strings.HasPrefix(s, "../") ||
+		(filepath.Separator != '/' && (strings.HasPrefix(s, ".\\") || strings.HasPrefix(s, "..\\")))
+}
+
+// isFile reports whether path exists and is not a directory
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// loadAsFile tries path itself, then path with each known extension
+func loadAsFile(path string) (string, bool) {
+	if isFile(path) {
+		return path, true
+	}
+	for _, ext := range fileExtensions {
+		if isFile(path + ext) {
+			return path + ext, true
+		}
+	}
+	return "", false
+}
+
+// loadIndex tries dir/index with each known extension
+func loadIndex(dir string) (string, bool) {
+	for _, ext := range fileExtensions {
+		index := filepath.Join(dir, "index"+ext)
+		if isFile(index) {
+			return index, true
+		}
+	}
+	return "", false
+}
+
+// loadAsDirectory resolves a directory through package.json "main" and then index files
+func loadAsDirectory(dir string) (string, bool, error) {
+	if pkg := readPackageJSON(dir); pkg != nil && pkg.Main != "" {
+		main := filepath.Join(dir, pkg.Main)
+		if file, ok := loadAsFile(main); ok {
+			return file, true, nil
+		}
+		if file, ok := loadIndex(main); ok {
+			return file, true, nil
+		}
+	}
+	if file, ok := loadIndex(dir); ok {
+		return file, true, nil
+	}
+	return "", false, nil
+}
+
+// readPackageJSON parses dir/package.json, returning nil if it is missing or invalid
+func readPackageJSON(dir string) *packageJSON {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return nil
+	}
+	var pkg packageJSON
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil
+	}
+	return &pkg
+}
+
+// findPackageJSON returns the closest package.json at or above dir
+func findPackageJSON(dir string) (string, *packageJSON) {
+	for {
+		if filepath.Base(dir) != "node_modules" {
+			if pkg := readPackageJSON(dir); pkg != nil {
+				return dir, pkg
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// nodeModulesPaths lists the node_modules directories to search from dir upwards
+func nodeModulesPaths(dir string) []string {
+	var paths []string
+	for {
+		if filepath.Base(dir) != "node_modules" {
+			paths = append(paths, filepath.Join(dir, "node_modules"))
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return paths
+		}
+		dir = parent
+	}
+}
+
+// splitPackageSpecifier splits "name/sub/path" or "@scope/name/sub" into the
+// package name and an exports subpath ("." or "./sub/path")
+func splitPackageSpecifier(specifier string) (string, string) {
+	parts := strings.Split(specifier, "/")
+	n := 1
+	if strings.HasPrefix(specifier, "@") && len(parts) > 1 {
+		n = 2
+	}
+	name := strings.Join(parts[:n], "/")
+	if len(parts) == n {
+		return name, "."
+	}
+	return name, "./" + strings.Join(parts[n:], "/")
+}
+
+// resolvePackageExports resolves subpath through the "exports" field of the
+// package in pkgDir
+func resolvePackageExports(pkgDir string, pkg *packageJSON, subpath string, conditions []string) (string, error) {
+	exports := pkg.Exports
+
+	// "exports": "./index.js" or conditions only is shorthand for {".": ...}
+	if m, ok := exports.(map[string]interface{}); !ok || !hasSubpathKeys(m) {
+		exports = map[string]interface{}{".": exports}
+	}
+
+	if target, ok := matchSubpath(exports.(map[string]interface{}), subpath, conditions); ok {
+		file := filepath.Join(pkgDir, filepath.FromSlash(target))
+		if isFile(file) {
+			return file, nil
+		}
+		return "", &resolveError{Specifier: subpath, FromDir: pkgDir, Code: "MODULE_NOT_FOUND",
+			Reason: fmt.Sprintf("Cannot find module '%s' exported from '%s'", file, pkgDir)}
+	}
+
+	return "", &resolveError{Specifier: subpath, FromDir: pkgDir, Code: "ERR_PACKAGE_PATH_NOT_EXPORTED",
+		Reason: fmt.Sprintf("Package subpath '%s' is not defined by \"exports\" in %s", subpath, filepath.Join(pkgDir, "package.json"))}
+}
+
+// resolvePackageImports resolves a "#name" specifier through the "imports"
+// field of the closest package.json
+func resolvePackageImports(specifier, fromDir string, conditions []string) (string, error) {
+	notDefined := &resolveError{Specifier: specifier, FromDir: fromDir, Code: "ERR_PACKAGE_IMPORT_NOT_DEFINED",
+		Reason: fmt.Sprintf("Package import specifier '%s' is not defined", specifier)}
+
+	pkgDir, pkg := findPackageJSON(fromDir)
+	if pkg == nil {
+		return "", notDefined
+	}
+	imports, ok := pkg.Imports.(map[string]interface{})
+	if !ok {
+		return "", notDefined
+	}
+
+	target, ok := matchSubpath(imports, specifier, conditions)
+	if !ok {
+		return "", notDefined
+	}
+
+	// Imports may map to other packages
+	if !strings.HasPrefix(target, "./") && !strings.HasPrefix(target, "../") {
+		return resolveModule(target, pkgDir, conditions)
+	}
+
+	file := filepath.Join(pkgDir, filepath.FromSlash(target))
+	if isFile(file) {
+		return file, nil
+	}
+	return "", &resolveError{Specifier: specifier, FromDir: fromDir, Code: "MODULE_NOT_FOUND"}
+}
+
+// hasSubpathKeys reports whether an exports object is keyed by subpaths
+// rather than by conditions
+func hasSubpathKeys(m map[string]interface{}) bool {
+	for key := range m {
+		return strings.HasPrefix(key, ".")
+	}
+	return false
+}
+
+// matchSubpath finds the target for key in an exports or imports map,
+// supporting a single "*" wildcard in keys
+func matchSubpath(m map[string]interface{}, key string, conditions []string) (string, bool) {
+	if target, ok := m[key]; ok {
+		return resolveTarget(target, "", conditions)
+	}
+
+	// Pick the longest matching pattern
+	bestKey, bestMatch := "", ""
+	for pattern := range m {
+		star := strings.Index(pattern, "*")
+		if star < 0 {
+			continue
+		}
+		prefix, suffix := pattern[:star], pattern[star+1:]
+		if len(key) >= len(prefix)+len(suffix) && strings.HasPrefix(key, prefix) && strings.HasSuffix(key, suffix) {
+			if len(prefix) > len(bestKey) || bestKey == "" {
+				bestKey = pattern
+				bestMatch = key[len(prefix) : len(key)-len(suffix)]
+			}
+		}
+	}
+	if bestKey != "" {
+		return resolveTarget(m[bestKey], bestMatch, conditions)
+	}
+
+	return "", false
+}
+
+// resolveTarget picks a target string from an exports value, following
+// condition objects and fallback arrays
+func resolveTarget(target interface{}, match string, conditions []string) (string, bool) {
+	switch t := target.(type) {
+	case string:
+		return strings.ReplaceAll(t, "*", match), true
+	case []interface{}:
+		for _, item := range t {
+			if resolved, ok := resolveTarget(item, match, conditions); ok {
+				return resolved, true
+			}
+		}
+	case map[string]interface{}:
+		// Conditions are matched in the order they appear in package.json,
+		// which encoding/json does not preserve, so the caller's priority
+		// order is used instead
+		for _, cond := range conditions {
+			if value, ok := t[cond]; ok {
+				if resolved, ok := resolveTarget(value, match, conditions); ok {
+					return resolved, true
+				}
+			}
+		}
+	}
+	return "", false
+}
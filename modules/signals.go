@@ -0,0 +1,51 @@
+package modules
+
+import (
+	"syscall"
+
+	"github.com/dop251/goja"
+)
+
+// signalName pairs a signal with its Node.js name
+type signalName struct {
+	name   string
+	signal syscall.Signal
+}
+
+// signalByName returns the signal named name, e.g. "SIGTERM"
+func signalByName(name string) (syscall.Signal, bool) {
+	for _, s := range signals {
+		if s.name == name {
+			return s.signal, true
+		}
+	}
+	return 0, false
+}
+
+// nameOfSignal returns the name of sig, preferring the first of its aliases
+func nameOfSignal(sig syscall.Signal) string {
+	for _, s := range signals {
+		if s.signal == sig {
+			return s.name
+		}
+	}
+	return sig.String()
+}
+
+// signalArg converts a signal name or number to a signal, throwing
+// ERR_UNKNOWN_SIGNAL for anything else
+func signalArg(vm *goja.Runtime, v goja.Value) syscall.Signal {
+	if isNumber(v) {
+		n := v.ToFloat()
+		for _, s := range signals {
+			if float64(s.signal) == n {
+				return s.signal
+			}
+		}
+	} else if name, ok := v.Export().(string); ok {
+		if sig, ok := signalByName(name); ok {
+			return sig
+		}
+	}
+	panic(NewNodeError(vm, "TypeError", "ERR_UNKNOWN_SIGNAL", "Unknown signal: "+v.String()))
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package modules
+
+import "syscall"
+
+// signals lists the signals known by name, in the order of
+// os.constants.signals. Only the signals Go defines on every platform are
+// included.
+var signals = []signalName{
+	{"SIGHUP", syscall.SIGHUP},
+	{"SIGINT", syscall.SIGINT},
+	{"SIGQUIT", syscall.SIGQUIT},
+	{"SIGILL", syscall.SIGILL},
+	{"SIGTRAP", syscall.SIGTRAP},
+	{"SIGABRT", syscall.SIGABRT},
+	{"SIGBUS", syscall.SIGBUS},
+	{"SIGFPE", syscall.SIGFPE},
+	{"SIGKILL", syscall.SIGKILL},
+	{"SIGSEGV", syscall.SIGSEGV},
+	{"SIGPIPE", syscall.SIGPIPE},
+	{"SIGALRM", syscall.SIGALRM},
+	{"SIGTERM", syscall.SIGTERM},
+}
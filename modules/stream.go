@@ -0,0 +1,520 @@
+package modules
+
+import (
+	"github.com/dop251/goja"
+)
+
+// Default high water marks of streams, in bytes or, in object mode, objects
+const (
+	streamHighWaterMark       = 16 * 1024
+	streamObjectHighWaterMark = 16
+)
+
+// streamClasses holds the stream classes. Every stream object keeps its
+// streamState under stateKey.
+type streamClasses struct {
+	vm       *goja.Runtime
+	loop     AsyncLoop
+	stateKey *goja.Symbol
+
+	stream         *goja.Object
+	readable       *goja.Object
+	readableProto  *goja.Object
+	writable       *goja.Object
+	writableProto  *goja.Object
+	duplex         *goja.Object
+	duplexProto    *goja.Object
+	transform      *goja.Object
+	transformProto *goja.Object
+	passThrough    *goja.Object
+}
+
+// streamState is the state of a stream object: Readables have r, Writables
+// have w, and Duplex streams have both. Destruction is shared by both sides.
+type streamState struct {
+	c   *streamClasses
+	vm  *goja.Runtime
+	obj *goja.Object
+	r   *readableState
+	w   *writableState
+
+	constructed  bool
+	destroyed    bool
+	closed       bool
+	closeEmitted bool
+	errorEmitted bool
+	errored      goja.Value
+	emitClose    bool
+	autoDestroy  bool
+
+	// afterConstruct runs the destroy requested while _construct was pending
+	afterConstruct func()
+
+	// transformCallback is the _write callback a Transform holds back until
+	// its output is read
+	transformCallback func()
+}
+
+// streamsOf returns the stream classes of vm, or nil before SetupStream
+func streamsOf(vm *goja.Runtime) *streamClasses {
+	val := vm.GlobalObject().Get("__streams")
+	if val == nil {
+		return nil
+	}
+	c, _ := val.Export().(*streamClasses)
+	return c
+}
+
+// SetupStream sets up the stream module. Stream callbacks are scheduled
+// with loop.NextTick.
+func SetupStream(vm *goja.Runtime, loop AsyncLoop) error {
+	emitter, err := builtinExports(vm, "events")
+	if err != nil {
+		return err
+	}
+
+	c := &streamClasses{vm: vm, loop: loop, stateKey: goja.NewSymbol("streamState")}
+
+	// Stream is the legacy base class every stream inherits from
+	c.stream, _ = c.newClass("Stream", emitter.ToObject(vm), func(this *goja.Object, args []goja.Value) {})
+	c.readable, c.readableProto = c.newClass("Readable", c.stream, func(this *goja.Object, args []goja.Value) {
+		options := argAt(args, 0)
+		s := c.newState(this, options)
+		s.r = newReadableState(vm, options, "readable")
+		s.construct()
+	})
+	c.writable, c.writableProto = c.newClass("Writable", c.stream, func(this *goja.Object, args []goja.Value) {
+		options := argAt(args, 0)
+		s := c.newState(this, options)
+		s.w = newWritableState(vm, options, "writable")
+		s.construct()
+	})
+	c.setupReadable(c.readableProto)
+	c.setupWritable(c.writableProto)
+	c.setupDestroy(c.readableProto)
+	c.setupDestroy(c.writableProto)
+
+	// Writables cannot be piped from
+	c.writableProto.Set("pipe", func(call goja.FunctionCall) goja.Value {
+		c.writableState(call.This).errorOrDestroy(NewNodeError(vm, "Error", "ERR_STREAM_CANNOT_PIPE", "Cannot pipe, not readable"))
+		return goja.Undefined()
+	})
+
+	c.setupDuplex()
+	c.setupTransform()
+	c.setupIterator()
+
+	if err := vm.GlobalObject().DefineDataProperty("__streams", vm.ToValue(c), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE); err != nil {
+		return err
+	}
+
+	// The module is the Stream class, with the other classes and the
+	// utilities as properties
+	module := c.stream
+	module.Set("Stream", c.stream)
+	module.Set("Readable", c.readable)
+	module.Set("Writable", c.writable)
+	module.Set("Duplex", c.duplex)
+	module.Set("Transform", c.transform)
+	module.Set("PassThrough", c.passThrough)
+	module.Set("getDefaultHighWaterMark", func(call goja.FunctionCall) goja.Value {
+		if call.Argument(0).ToBoolean() {
+			return vm.ToValue(streamObjectHighWaterMark)
+		}
+		return vm.ToValue(streamHighWaterMark)
+	})
+	promises := c.setupPipeline(module)
+	module.Set("promises", promises)
+
+	if err := RegisterModule(vm, "stream", module); err != nil {
+		return err
+	}
+	return RegisterModule(vm, "stream/promises", promises)
+}
+
+// newClass creates a constructor inheriting from parent that runs init on
+// the new object with the constructor arguments. JS classes can extend it
+// and call super(options).
+func (c *streamClasses) newClass(name string, parent *goja.Object, init func(this *goja.Object, args []goja.Value)) (*goja.Object, *goja.Object) {
+	return newClass(c.vm, name, parent, init)
+}
+
+// newClass creates a constructor that runs init on the new object, as
+// streamClasses.newClass does. A nil parent makes a base class.
+func newClass(vm *goja.Runtime, name string, parent *goja.Object, init func(this *goja.Object, args []goja.Value)) (*goja.Object, *goja.Object) {
+	ctor := vm.ToValue(func(call goja.ConstructorCall) *goja.Object {
+		init(call.This, call.Arguments)
+		return nil
+	}).ToObject(vm)
+	ctor.DefineDataProperty("name", vm.ToValue(name), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	proto := ctor.Get("prototype").ToObject(vm)
+	if parent != nil {
+		ctor.SetPrototype(parent)
+		proto.SetPrototype(parent.Get("prototype").ToObject(vm))
+	}
+	return ctor, proto
+}
+
+// newState attaches a streamState to obj and applies the options shared by
+// every stream: the emitClose and autoDestroy flags and the read, write,
+// final, destroy and construct implementations
+func (c *streamClasses) newState(obj *goja.Object, options goja.Value) *streamState {
+	s := &streamState{
+		c:           c,
+		vm:          c.vm,
+		obj:         obj,
+		constructed: true,
+		emitClose:   true,
+		autoDestroy: true,
+	}
+	if opts, ok := options.(*goja.Object); ok {
+		if v := opts.Get("emitClose"); v != nil && !goja.IsUndefined(v) {
+			s.emitClose = v.ToBoolean()
+		}
+		if v := opts.Get("autoDestroy"); v != nil && !goja.IsUndefined(v) {
+			s.autoDestroy = v.ToBoolean()
+		}
+		for _, name := range []string{"read", "write", "writev", "final", "destroy", "construct"} {
+			if fn, ok := goja.AssertFunction(opts.Get(name)); ok && fn != nil {
+				obj.Set("_"+name, opts.Get(name))
+			}
+		}
+	}
+	obj.DefineDataPropertySymbol(c.stateKey, c.vm.ToValue(s), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	return s
+}
+
+// state returns the stream state of this, throwing for other objects
+func (c *streamClasses) state(this goja.Value) *streamState {
+	if obj, ok := this.(*goja.Object); ok {
+		if s, ok := exportSymbol(obj, c.stateKey).(*streamState); ok {
+			return s
+		}
+	}
+	panic(NewNodeError(c.vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be a stream"))
+}
+
+// readableState returns the readable side of this, throwing if it has none
+func (c *streamClasses) readableState(this goja.Value) *streamState {
+	s := c.state(this)
+	if s.r == nil {
+		panic(NewNodeError(c.vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be a readable stream"))
+	}
+	return s
+}
+
+// writableState returns the writable side of this, throwing if it has none
+func (c *streamClasses) writableState(this goja.Value) *streamState {
+	s := c.state(this)
+	if s.w == nil {
+		panic(NewNodeError(c.vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be a writable stream"))
+	}
+	return s
+}
+
+// getter defines a read-only accessor on proto
+func (c *streamClasses) getter(proto *goja.Object, name string, get func(s *streamState) interface{}) {
+	vm := c.vm
+	proto.DefineAccessorProperty(name, vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(get(c.state(call.This)))
+	}), nil, goja.FLAG_TRUE, goja.FLAG_FALSE)
+}
+
+// setupDestroy adds destroy and the properties describing it to proto
+func (c *streamClasses) setupDestroy(proto *goja.Object) {
+	vm := c.vm
+
+	proto.Set("destroy", func(call goja.FunctionCall) goja.Value {
+		cb, _ := goja.AssertFunction(call.Argument(1))
+		c.state(call.This).destroy(call.Argument(0), cb)
+		return call.This
+	})
+
+	// _destroy(err, callback) releases resources; subclasses override it
+	proto.Set("_destroy", func(call goja.FunctionCall) goja.Value {
+		if cb, ok := goja.AssertFunction(call.Argument(1)); ok {
+			if _, err := cb(goja.Undefined(), call.Argument(0)); err != nil {
+				panic(err)
+			}
+		}
+		return goja.Undefined()
+	})
+
+	proto.DefineAccessorProperty("destroyed", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(c.state(call.This).destroyed)
+	}), vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		c.state(call.This).destroyed = call.Argument(0).ToBoolean()
+		return goja.Undefined()
+	}), goja.FLAG_TRUE, goja.FLAG_FALSE)
+	c.getter(proto, "closed", func(s *streamState) interface{} { return s.closed })
+	c.getter(proto, "errored", func(s *streamState) interface{} {
+		if s.errored == nil {
+			return goja.Null()
+		}
+		return s.errored
+	})
+}
+
+// nextTick queues fn like process.nextTick
+func (s *streamState) nextTick(fn func()) {
+	s.c.loop.NextTick(fn)
+}
+
+// method returns the function stored under name on the stream, if any
+func (s *streamState) method(name string) (goja.Callable, bool) {
+	return goja.AssertFunction(s.obj.Get(name))
+}
+
+// call invokes the method name of the stream, propagating exceptions
+func (s *streamState) call(name string, args ...goja.Value) goja.Value {
+	fn, ok := s.method(name)
+	if !ok {
+		panic(NewNodeError(s.vm, "Error", "ERR_METHOD_NOT_IMPLEMENTED", "The "+name+"() method is not implemented"))
+	}
+	res, err := fn(s.obj, args...)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+// emit emits event on the stream
+func (s *streamState) emit(event string, args ...goja.Value) bool {
+	emitted, err := Emit(s.vm, s.obj, event, args...)
+	if err != nil {
+		panic(err)
+	}
+	return emitted
+}
+
+// listenerCount returns the number of listeners for event
+func (s *streamState) listenerCount(event string) int {
+	return int(s.call("listenerCount", s.vm.ToValue(event)).ToInteger())
+}
+
+// callback wraps fn in a function that may be called only once. Later calls
+// report ERR_MULTIPLE_CALLBACK.
+func (s *streamState) callback(fn func(err goja.Value)) goja.Value {
+	called := false
+	return s.vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		if called {
+			s.errorOrDestroy(NewNodeError(s.vm, "Error", "ERR_MULTIPLE_CALLBACK", "Callback called multiple times"))
+			return goja.Undefined()
+		}
+		called = true
+		fn(call.Argument(0))
+		return goja.Undefined()
+	})
+}
+
+// construct runs _construct, if the stream has one, on the next tick.
+// Reads and writes wait until its callback is called.
+func (s *streamState) construct() {
+	if _, ok := s.method("_construct"); !ok {
+		return
+	}
+	s.constructed = false
+	s.nextTick(func() {
+		s.call("_construct", s.callback(func(err goja.Value) {
+			s.constructed = true
+			if s.afterConstruct != nil {
+				s.afterConstruct()
+				return
+			}
+			if !isNullish(err) {
+				s.errorOrDestroy(err)
+				return
+			}
+			s.nextTick(func() {
+				if s.r != nil && s.r.needReadable {
+					s.maybeReadMore()
+				}
+				if s.w != nil {
+					if !s.w.writing {
+						s.clearBuffer()
+					}
+					s.finishMaybe(false)
+				}
+			})
+		}))
+	})
+}
+
+// setErrored records err as the error the stream failed with
+func (s *streamState) setErrored(err goja.Value) {
+	if s.errored == nil && !isNullish(err) {
+		s.errored = err
+	}
+}
+
+// destroy destroys the stream through _destroy, then emits 'error' if err
+// is given and 'close'
+func (s *streamState) destroy(err goja.Value, cb goja.Callable) {
+	if s.destroyed {
+		if cb != nil {
+			s.whenClosed(cb)
+		}
+		return
+	}
+	s.setErrored(err)
+	s.destroyed = true
+
+	if !s.constructed {
+		s.afterConstruct = func() { s.runDestroy(err, cb) }
+		return
+	}
+	s.runDestroy(err, cb)
+}
+
+func (s *streamState) runDestroy(err goja.Value, cb goja.Callable) {
+	if isNullish(err) {
+		err = goja.Null()
+	}
+	s.call("_destroy", err, s.callback(func(err goja.Value) {
+		s.setErrored(err)
+		s.closed = true
+		if s.w != nil {
+			s.w.failPending(s, s.destroyedError("end"))
+		}
+		if cb != nil {
+			if _, e := cb(goja.Undefined(), err); e != nil {
+				panic(e)
+			}
+		}
+		s.nextTick(func() {
+			if !isNullish(err) {
+				s.emitError(err)
+			}
+			s.emitCloseEvent()
+		})
+	}))
+}
+
+// whenClosed calls cb with the stream's error once it has closed
+func (s *streamState) whenClosed(cb goja.Callable) {
+	errored := func() goja.Value {
+		if s.errored == nil {
+			return goja.Null()
+		}
+		return s.errored
+	}
+	if s.closed {
+		s.nextTick(func() {
+			if _, err := cb(goja.Undefined(), errored()); err != nil {
+				panic(err)
+			}
+		})
+		return
+	}
+	s.call("once", s.vm.ToValue("close"), s.vm.ToValue(func(goja.FunctionCall) goja.Value {
+		if _, err := cb(goja.Undefined(), errored()); err != nil {
+			panic(err)
+		}
+		return goja.Undefined()
+	}))
+}
+
+// emitError emits 'error' unless the stream already has
+func (s *streamState) emitError(err goja.Value) {
+	if s.errorEmitted {
+		return
+	}
+	s.errorEmitted = true
+	s.emit("error", err)
+}
+
+// emitCloseEvent emits 'close' once, unless emitClose is off
+func (s *streamState) emitCloseEvent() {
+	if !s.emitClose || s.closeEmitted {
+		return
+	}
+	s.closeEmitted = true
+	s.emit("close")
+}
+
+// errorOrDestroy fails the stream with err: it is destroyed if autoDestroy
+// is on, otherwise 'error' is emitted
+func (s *streamState) errorOrDestroy(err goja.Value) {
+	if s.destroyed {
+		return
+	}
+	if s.autoDestroy {
+		s.destroy(err, nil)
+		return
+	}
+	s.setErrored(err)
+	s.nextTick(func() { s.emitError(err) })
+}
+
+// destroyedError creates the error of an operation on a destroyed stream
+func (s *streamState) destroyedError(op string) *goja.Object {
+	return NewNodeError(s.vm, "Error", "ERR_STREAM_DESTROYED", "Cannot call "+op+" after a stream was destroyed")
+}
+
+// streamOptions reads the high water mark and object mode of one side of a
+// stream. side is "readable" or "writable": Duplex streams accept
+// readableHighWaterMark and readableObjectMode for their readable side.
+func streamOptions(vm *goja.Runtime, options goja.Value, side string) (objectMode bool, highWaterMark int) {
+	opts, _ := options.(*goja.Object)
+	get := func(name string) goja.Value {
+		if opts == nil {
+			return nil
+		}
+		if v := opts.Get(name); v != nil && !goja.IsUndefined(v) {
+			return v
+		}
+		return nil
+	}
+
+	if v := get(side + "ObjectMode"); v != nil {
+		objectMode = v.ToBoolean()
+	} else if v := get("objectMode"); v != nil {
+		objectMode = v.ToBoolean()
+	}
+
+	highWaterMark = streamHighWaterMark
+	if objectMode {
+		highWaterMark = streamObjectHighWaterMark
+	}
+	name := "highWaterMark"
+	v := get(name)
+	if v == nil {
+		name = side + "HighWaterMark"
+		v = get(name)
+	}
+	if v != nil {
+		hwm := v.ToFloat()
+		if hwm < 0 || hwm != hwm || hwm != float64(int64(hwm)) {
+			panic(NewNodeError(vm, "TypeError", "ERR_INVALID_ARG_VALUE",
+				"The property 'options."+name+"' is invalid. Received "+Inspect(vm, v, InspectOptions{})))
+		}
+		highWaterMark = int(hwm)
+	}
+	return objectMode, highWaterMark
+}
+
+// isNullish reports whether v is missing, undefined or null
+func isNullish(v goja.Value) bool {
+	return v == nil || goja.IsUndefined(v) || goja.IsNull(v)
+}
+
+// thenValue calls onFulfilled with v, or with the value v settles to if it
+// is a thenable
+func thenValue(vm *goja.Runtime, v goja.Value, onFulfilled, onRejected func(goja.Value)) {
+	if obj, ok := v.(*goja.Object); ok {
+		if then, ok := goja.AssertFunction(obj.Get("then")); ok {
+			_, err := then(obj, vm.ToValue(func(call goja.FunctionCall) goja.Value {
+				onFulfilled(call.Argument(0))
+				return goja.Undefined()
+			}), vm.ToValue(func(call goja.FunctionCall) goja.Value {
+				onRejected(call.Argument(0))
+				return goja.Undefined()
+			}))
+			if err != nil {
+				panic(err)
+			}
+			return
+		}
+	}
+	onFulfilled(v)
+}
@@ -0,0 +1,177 @@
+package modules
+
+import (
+	"github.com/dop251/goja"
+)
+
+// setupDuplex creates Duplex, a Readable that is also Writable
+func (c *streamClasses) setupDuplex() {
+	vm := c.vm
+	c.duplex, c.duplexProto = c.newClass("Duplex", c.readable, func(this *goja.Object, args []goja.Value) {
+		options := argAt(args, 0)
+		s := c.newState(this, options)
+		c.initDuplex(s, options)
+		s.construct()
+	})
+	c.setupWritable(c.duplexProto)
+
+	// Duplex streams only inherit from Readable, but count as Writable
+	hasInstance, _ := goja.AssertFunction(vm.Get("Function").ToObject(vm).Get("prototype").ToObject(vm).GetSymbol(goja.SymHasInstance))
+	c.writable.DefineDataPropertySymbol(goja.SymHasInstance, vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		if obj, ok := call.Argument(0).(*goja.Object); ok && call.This.SameAs(c.writable) {
+			if s, ok := exportSymbol(obj, c.stateKey).(*streamState); ok && s.w != nil {
+				return vm.ToValue(true)
+			}
+		}
+		res, err := hasInstance(call.This, call.Argument(0))
+		if err != nil {
+			panic(err)
+		}
+		return res
+	}), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+}
+
+// initDuplex creates both sides of a Duplex stream. The readable and
+// writable options start a side already ended; allowHalfOpen false ends
+// the writable side with the readable one.
+func (c *streamClasses) initDuplex(s *streamState, options goja.Value) {
+	vm := c.vm
+	s.r = newReadableState(vm, options, "readable")
+	s.w = newWritableState(vm, options, "writable")
+
+	allowHalfOpen := true
+	if opts, ok := options.(*goja.Object); ok {
+		if v := opts.Get("readable"); v != nil && !goja.IsUndefined(v) && !v.ToBoolean() {
+			s.r.ended, s.r.endEmitted = true, true
+		}
+		if v := opts.Get("writable"); v != nil && !goja.IsUndefined(v) && !v.ToBoolean() {
+			s.w.ending, s.w.ended, s.w.finished = true, true, true
+		}
+		if v := opts.Get("allowHalfOpen"); v != nil && !goja.IsUndefined(v) {
+			allowHalfOpen = v.ToBoolean()
+		}
+	}
+	s.obj.Set("allowHalfOpen", allowHalfOpen)
+	if !allowHalfOpen {
+		callMethod(vm, s.obj, "once", vm.ToValue("end"), vm.ToValue(func(goja.FunctionCall) goja.Value {
+			if !s.w.ending {
+				s.nextTick(func() { callMethod(vm, s.obj, "end") })
+			}
+			return goja.Undefined()
+		}))
+	}
+}
+
+// setupTransform creates Transform, a Duplex whose output is computed from
+// its input by _transform, and PassThrough
+func (c *streamClasses) setupTransform() {
+	vm := c.vm
+
+	init := func(this *goja.Object, args []goja.Value) {
+		options := argAt(args, 0)
+		s := c.newState(this, options)
+		c.initDuplex(s, options)
+		// Transforms only push from _transform, which writes drive
+		s.r.sync = false
+		if opts, ok := options.(*goja.Object); ok {
+			for _, name := range []string{"transform", "flush"} {
+				if fn, ok := goja.AssertFunction(opts.Get(name)); ok && fn != nil {
+					this.Set("_"+name, opts.Get(name))
+				}
+			}
+		}
+		s.construct()
+	}
+	c.transform, c.transformProto = c.newClass("Transform", c.duplex, init)
+	proto := c.transformProto
+
+	proto.Set("_transform", func(call goja.FunctionCall) goja.Value {
+		panic(NewNodeError(vm, "Error", "ERR_METHOD_NOT_IMPLEMENTED", "The _transform() method is not implemented"))
+	})
+
+	// _write passes each chunk to _transform. Its callback is held back
+	// while the readable side is full, so writes wait for reads.
+	proto.Set("_write", func(call goja.FunctionCall) goja.Value {
+		s := c.state(call.This)
+		callback, _ := goja.AssertFunction(call.Argument(2))
+		done := func(args ...goja.Value) {
+			if _, err := callback(goja.Undefined(), args...); err != nil {
+				panic(err)
+			}
+		}
+		length := s.r.length
+		s.call("_transform", call.Argument(0), call.Argument(1), vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			if err := call.Argument(0); !isNullish(err) {
+				done(err)
+				return goja.Undefined()
+			}
+			if data := call.Argument(1); !isNullish(data) {
+				callMethod(vm, s.obj, "push", data)
+			}
+			if s.w.ended || length == s.r.length || s.r.length < s.r.highWaterMark {
+				done()
+			} else {
+				s.transformCallback = func() { done() }
+			}
+			return goja.Undefined()
+		}))
+		return goja.Undefined()
+	})
+
+	proto.Set("_read", func(call goja.FunctionCall) goja.Value {
+		s := c.state(call.This)
+		if cb := s.transformCallback; cb != nil {
+			s.transformCallback = nil
+			cb()
+		}
+		return goja.Undefined()
+	})
+
+	// _final runs _flush, if any, and ends the readable side
+	proto.Set("_final", func(call goja.FunctionCall) goja.Value {
+		s := c.state(call.This)
+		cb, _ := goja.AssertFunction(call.Argument(0))
+		done := func(args ...goja.Value) {
+			if cb == nil {
+				return
+			}
+			if _, err := cb(goja.Undefined(), args...); err != nil {
+				panic(err)
+			}
+		}
+		if _, ok := s.method("_flush"); !ok || s.destroyed {
+			callMethod(vm, s.obj, "push", goja.Null())
+			done()
+			return goja.Undefined()
+		}
+		s.call("_flush", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			if err := call.Argument(0); !isNullish(err) {
+				if cb != nil {
+					done(err)
+				} else {
+					s.destroy(err, nil)
+				}
+				return goja.Undefined()
+			}
+			if data := call.Argument(1); !isNullish(data) {
+				callMethod(vm, s.obj, "push", data)
+			}
+			callMethod(vm, s.obj, "push", goja.Null())
+			done()
+			return goja.Undefined()
+		}))
+		return goja.Undefined()
+	})
+
+	// PassThrough passes its input through unchanged
+	var passThroughProto *goja.Object
+	c.passThrough, passThroughProto = c.newClass("PassThrough", c.transform, init)
+	passThroughProto.Set("_transform", func(call goja.FunctionCall) goja.Value {
+		if cb, ok := goja.AssertFunction(call.Argument(2)); ok {
+			if _, err := cb(goja.Undefined(), goja.Null(), call.Argument(0)); err != nil {
+				panic(err)
+			}
+		}
+		return goja.Undefined()
+	})
+}
@@ -0,0 +1,277 @@
+package modules
+
+import (
+	"github.com/dop251/goja"
+)
+
+// asyncIteratorSymbol returns Symbol.asyncIterator, defining it if the
+// engine does not
+func asyncIteratorSymbol(vm *goja.Runtime) *goja.Symbol {
+	symbol := vm.Get("Symbol").ToObject(vm)
+	if sym, ok := symbol.Get("asyncIterator").(*goja.Symbol); ok {
+		return sym
+	}
+	sym := goja.NewSymbol("Symbol.asyncIterator")
+	symbol.DefineDataProperty("asyncIterator", sym, goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	return sym
+}
+
+// setupIterator makes Readables async iterable and adds Readable.from
+func (c *streamClasses) setupIterator() {
+	vm := c.vm
+	asyncIterator := asyncIteratorSymbol(vm)
+
+	c.readableProto.SetSymbol(asyncIterator, func(call goja.FunctionCall) goja.Value {
+		return c.iterator(c.readableState(call.This), true)
+	})
+
+	// readable.iterator([options]) is [Symbol.asyncIterator]() with the
+	// destroyOnReturn option
+	c.readableProto.Set("iterator", func(call goja.FunctionCall) goja.Value {
+		destroyOnReturn := true
+		if opts, ok := call.Argument(0).(*goja.Object); ok {
+			if v := opts.Get("destroyOnReturn"); v != nil && !goja.IsUndefined(v) {
+				destroyOnReturn = v.ToBoolean()
+			}
+		}
+		return c.iterator(c.readableState(call.This), destroyOnReturn)
+	})
+
+	// Readable.from(iterable[, options]) creates an object mode Readable
+	// from an iterable or async iterable
+	c.readable.Set("from", func(call goja.FunctionCall) goja.Value {
+		return c.from(call.Argument(0), call.Argument(1))
+	})
+}
+
+// iterator returns an async iterator over the chunks read from s. Leaving
+// the iteration early destroys the stream if destroyOnReturn is set.
+func (c *streamClasses) iterator(s *streamState, destroyOnReturn bool) *goja.Object {
+	vm := c.vm
+	var waiting []func()
+	started, done, returned := false, false, false
+	var failure goja.Value
+
+	wake := func() {
+		pending := waiting
+		waiting = nil
+		for _, fn := range pending {
+			fn()
+		}
+	}
+	result := func(value goja.Value, finished bool) *goja.Object {
+		res := vm.NewObject()
+		res.Set("value", value)
+		res.Set("done", finished)
+		return res
+	}
+
+	iter := vm.NewObject()
+	iter.Set("next", func(call goja.FunctionCall) goja.Value {
+		promise, resolve, reject := vm.NewPromise()
+		if !started {
+			started = true
+			callMethod(vm, s.obj, "on", vm.ToValue("readable"), vm.ToValue(func(goja.FunctionCall) goja.Value {
+				wake()
+				return goja.Undefined()
+			}))
+			options := vm.NewObject()
+			options.Set("writable", false)
+			c.finished(s.obj, options, func(err goja.Value) {
+				done, failure = true, err
+				wake()
+			})
+		}
+
+		var next func()
+		next = func() {
+			var chunk goja.Value = goja.Null()
+			if !s.destroyed && !returned {
+				chunk = callMethod(vm, s.obj, "read")
+			}
+			switch {
+			case !goja.IsNull(chunk):
+				resolve(result(chunk, false))
+			case returned:
+				resolve(result(goja.Undefined(), true))
+			case done && failure != nil:
+				reject(failure)
+			case done:
+				resolve(result(goja.Undefined(), true))
+			default:
+				waiting = append(waiting, next)
+			}
+		}
+		next()
+		return vm.ToValue(promise)
+	})
+	iter.Set("return", func(call goja.FunctionCall) goja.Value {
+		promise, resolve, _ := vm.NewPromise()
+		if !returned {
+			returned = true
+			if destroyOnReturn && (!done || failure == nil && s.autoDestroy) {
+				s.destroy(goja.Null(), nil)
+			}
+			wake()
+		}
+		resolve(result(call.Argument(0), true))
+		return vm.ToValue(promise)
+	})
+	iter.SetSymbol(asyncIteratorSymbol(vm), func(call goja.FunctionCall) goja.Value {
+		return call.This
+	})
+	return iter
+}
+
+// from creates a Readable yielding the values of iterable. Strings and
+// Buffers are emitted whole instead of iterated.
+func (c *streamClasses) from(iterable goja.Value, options goja.Value) *goja.Object {
+	vm := c.vm
+	opts := vm.NewObject()
+	opts.Set("objectMode", true)
+	opts.Set("highWaterMark", 1)
+	if o, ok := options.(*goja.Object); ok {
+		for _, key := range o.Keys() {
+			opts.Set(key, o.Get(key))
+		}
+	}
+	stream, err := vm.New(c.readable, opts)
+	if err != nil {
+		panic(err)
+	}
+	s := c.state(stream)
+
+	if _, ok := iterable.Export().(string); ok || vm.InstanceOf(iterable, bufferOf(vm).ctor) {
+		stream.Set("_read", func(call goja.FunctionCall) goja.Value {
+			s.push(iterable, goja.Undefined(), false)
+			s.push(goja.Null(), goja.Undefined(), false)
+			return goja.Undefined()
+		})
+		return stream
+	}
+
+	obj, _ := iterable.(*goja.Object)
+	var iterator *goja.Object
+	isAsync := false
+	if obj != nil {
+		if fn, ok := goja.AssertFunction(obj.GetSymbol(asyncIteratorSymbol(vm))); ok {
+			it, err := fn(obj)
+			if err != nil {
+				panic(err)
+			}
+			iterator, isAsync = it.ToObject(vm), true
+		} else if fn, ok := goja.AssertFunction(obj.GetSymbol(goja.SymIterator)); ok {
+			it, err := fn(obj)
+			if err != nil {
+				panic(err)
+			}
+			iterator = it.ToObject(vm)
+		}
+	}
+	if iterator == nil {
+		panic(ErrInvalidArgType(vm, "iterable", "an Iterable", iterable))
+	}
+	nextFn, ok := goja.AssertFunction(iterator.Get("next"))
+	if !ok {
+		panic(ErrInvalidArgType(vm, "iterable", "an Iterable", iterable))
+	}
+
+	reading := false
+	fail := func(err goja.Value) {
+		reading = false
+		s.destroy(err, nil)
+	}
+
+	// push hands a value to the stream and reports whether to read on
+	push := func(value goja.Value) bool {
+		if goja.IsNull(value) {
+			fail(NewNodeError(vm, "TypeError", "ERR_STREAM_NULL_VALUES", "May not write null values to stream"))
+			return false
+		}
+		if callMethod(vm, stream, "push", value).ToBoolean() {
+			return true
+		}
+		reading = false
+		return false
+	}
+
+	var next func()
+	// step handles an iterator result and reports whether to read on
+	// synchronously
+	step := func(res goja.Value) bool {
+		r := res.ToObject(vm)
+		if r.Get("done").ToBoolean() {
+			callMethod(vm, stream, "push", goja.Null())
+			return false
+		}
+		value := r.Get("value")
+		if v, ok := value.(*goja.Object); ok {
+			if _, ok := goja.AssertFunction(v.Get("then")); ok {
+				thenValue(vm, value, func(v goja.Value) {
+					if push(v) {
+						next()
+					}
+				}, fail)
+				return false
+			}
+		}
+		return push(value)
+	}
+	next = func() {
+		for {
+			res, err := nextFn(iterator)
+			if err != nil {
+				fail(jsError(vm, err))
+				return
+			}
+			if isAsync {
+				thenValue(vm, res, func(res goja.Value) {
+					if step(res) {
+						next()
+					}
+				}, fail)
+				return
+			}
+			if !step(res) {
+				return
+			}
+		}
+	}
+
+	stream.Set("_read", func(call goja.FunctionCall) goja.Value {
+		if !reading {
+			reading = true
+			next()
+		}
+		return goja.Undefined()
+	})
+
+	// Destroying the stream closes the iterator
+	stream.Set("_destroy", func(call goja.FunctionCall) goja.Value {
+		err := call.Argument(0)
+		cb, _ := goja.AssertFunction(call.Argument(1))
+		done := func(e goja.Value) {
+			if isNullish(e) {
+				e = err
+			}
+			s.nextTick(func() {
+				if _, ex := cb(goja.Undefined(), e); ex != nil {
+					panic(ex)
+				}
+			})
+		}
+		ret, ok := goja.AssertFunction(iterator.Get("return"))
+		if !ok {
+			done(goja.Null())
+			return goja.Undefined()
+		}
+		res, ex := ret(iterator)
+		if ex != nil {
+			done(jsError(vm, ex))
+			return goja.Undefined()
+		}
+		thenValue(vm, res, func(goja.Value) { done(goja.Null()) }, done)
+		return goja.Undefined()
+	})
+	return stream
+}
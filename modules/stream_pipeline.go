@@ -0,0 +1,386 @@
+package modules
+
+import (
+	"strconv"
+
+	"github.com/dop251/goja"
+)
+
+// setupPipeline adds finished and pipeline to the stream module and returns
+// their promise versions, the stream/promises module
+func (c *streamClasses) setupPipeline(module *goja.Object) *goja.Object {
+	vm := c.vm
+
+	// stream.finished(stream[, options], callback) calls callback once the
+	// stream has ended, finished, errored or closed early, and returns a
+	// function removing its listeners
+	module.Set("finished", func(call goja.FunctionCall) goja.Value {
+		stream, options, callback := call.Argument(0), call.Argument(1), call.Argument(2)
+		if _, ok := goja.AssertFunction(options); ok {
+			options, callback = goja.Undefined(), options
+		}
+		cb, ok := goja.AssertFunction(callback)
+		if !ok {
+			panic(ErrInvalidArgType(vm, "callback", "of type function", callback))
+		}
+		obj := c.streamArg(stream, "stream")
+
+		cleanup := c.finished(obj, options, func(err goja.Value) {
+			args := []goja.Value{}
+			if err != nil {
+				args = append(args, err)
+			}
+			if _, e := cb(obj, args...); e != nil {
+				panic(e)
+			}
+		})
+		return vm.ToValue(func(goja.FunctionCall) goja.Value {
+			cleanup()
+			return goja.Undefined()
+		})
+	})
+
+	// stream.pipeline(source[, ...transforms], destination, callback) pipes
+	// the streams into each other, destroys all of them if one fails and
+	// calls callback once the last has finished
+	module.Set("pipeline", func(call goja.FunctionCall) goja.Value {
+		args := call.Arguments
+		var callback goja.Value = goja.Undefined()
+		if len(args) > 0 {
+			callback, args = args[len(args)-1], args[:len(args)-1]
+		}
+		cb, ok := goja.AssertFunction(callback)
+		if !ok {
+			panic(ErrInvalidArgType(vm, "callback", "of type function", callback))
+		}
+
+		return c.pipeline(args, func(err, value goja.Value) {
+			if err == nil {
+				err = goja.Undefined()
+			}
+			if _, e := cb(goja.Undefined(), err, value); e != nil {
+				panic(e)
+			}
+		})
+	})
+
+	promises := vm.NewObject()
+	promises.Set("finished", func(call goja.FunctionCall) goja.Value {
+		promise, resolve, reject := vm.NewPromise()
+		ex := vm.Try(func() {
+			obj := c.streamArg(call.Argument(0), "stream")
+			c.finished(obj, call.Argument(1), func(err goja.Value) {
+				if err != nil {
+					reject(err)
+				} else {
+					resolve(goja.Undefined())
+				}
+			})
+		})
+		if ex != nil {
+			reject(ex.Value())
+		}
+		return vm.ToValue(promise)
+	})
+	promises.Set("pipeline", func(call goja.FunctionCall) goja.Value {
+		promise, resolve, reject := vm.NewPromise()
+		ex := vm.Try(func() {
+			c.pipeline(call.Arguments, func(err, value goja.Value) {
+				if err != nil {
+					reject(err)
+				} else {
+					resolve(value)
+				}
+			})
+		})
+		if ex != nil {
+			reject(ex.Value())
+		}
+		return vm.ToValue(promise)
+	})
+	return promises
+}
+
+// streamArg validates a stream argument
+func (c *streamClasses) streamArg(v goja.Value, name string) *goja.Object {
+	obj, ok := v.(*goja.Object)
+	if !ok || !isStream(obj) {
+		panic(ErrInvalidArgType(c.vm, name, "an instance of Stream", v))
+	}
+	return obj
+}
+
+// isStream reports whether obj looks like a stream: an emitter that can be
+// piped from or written to
+func isStream(obj *goja.Object) bool {
+	_, on := goja.AssertFunction(obj.Get("on"))
+	_, pipe := goja.AssertFunction(obj.Get("pipe"))
+	_, write := goja.AssertFunction(obj.Get("write"))
+	return on && (pipe || write)
+}
+
+// finished calls callback once stream is done, with nil or the error it
+// failed with. options.readable and options.writable choose the sides to
+// wait for. It returns a function removing the listeners it added.
+func (c *streamClasses) finished(stream *goja.Object, options goja.Value, callback func(err goja.Value)) func() {
+	vm := c.vm
+	s, ours := exportSymbol(stream, c.stateKey).(*streamState)
+
+	readable, writable, onError := false, false, true
+	if ours {
+		readable, writable = s.r != nil, s.w != nil
+	} else {
+		_, readable = goja.AssertFunction(stream.Get("read"))
+		_, writable = goja.AssertFunction(stream.Get("write"))
+	}
+	if opts, ok := options.(*goja.Object); ok {
+		if v := opts.Get("readable"); v != nil && !goja.IsUndefined(v) {
+			readable = v.ToBoolean()
+		}
+		if v := opts.Get("writable"); v != nil && !goja.IsUndefined(v) {
+			writable = v.ToBoolean()
+		}
+		if v := opts.Get("error"); v != nil && !goja.IsUndefined(v) {
+			onError = v.ToBoolean()
+		}
+	}
+
+	readableFinished := func(strict bool) bool {
+		if !ours || s.r == nil {
+			return stream.Get("readableEnded") != nil && stream.Get("readableEnded").ToBoolean()
+		}
+		return s.r.endEmitted || !strict && s.r.ended && s.r.length == 0
+	}
+	writableFinished := func(strict bool) bool {
+		if !ours || s.w == nil {
+			return stream.Get("writableFinished") != nil && stream.Get("writableFinished").ToBoolean()
+		}
+		return s.w.finished || !strict && s.w.ended && s.w.length == 0
+	}
+	isTrue := func(name string) bool {
+		v := stream.Get(name)
+		return v != nil && v.ToBoolean()
+	}
+
+	// Streams that will emit 'close' are done only once they have
+	willEmitClose := ours && s.autoDestroy && s.emitClose && !s.closed
+	readableDone, writableDone := readableFinished(true), writableFinished(true)
+
+	called := false
+	done := func(err goja.Value) {
+		if !called {
+			called = true
+			callback(err)
+		}
+	}
+
+	var listeners []pipeListener
+	listen := func(event string, fn func(call goja.FunctionCall) goja.Value) {
+		value := vm.ToValue(fn)
+		listeners = append(listeners, pipeListener{emitter: stream, event: event, fn: value})
+		callMethod(vm, stream, "on", vm.ToValue(event), value)
+	}
+
+	onClose := func() {
+		if ours && s.errored != nil {
+			done(s.errored)
+			return
+		}
+		if readable && !readableDone && !readableFinished(false) || writable && !writableDone && !writableFinished(false) {
+			done(NewNodeError(vm, "Error", "ERR_STREAM_PREMATURE_CLOSE", "Premature close"))
+			return
+		}
+		done(nil)
+	}
+
+	listen("end", func(goja.FunctionCall) goja.Value {
+		readableDone = true
+		if ours && s.destroyed {
+			willEmitClose = false
+		}
+		if willEmitClose && (!isTrue("writable") || writable) {
+			return goja.Undefined()
+		}
+		if !writable || writableDone {
+			done(nil)
+		}
+		return goja.Undefined()
+	})
+	listen("finish", func(goja.FunctionCall) goja.Value {
+		writableDone = true
+		if ours && s.destroyed {
+			willEmitClose = false
+		}
+		if willEmitClose && (!isTrue("readable") || readable) {
+			return goja.Undefined()
+		}
+		if !readable || readableDone {
+			done(nil)
+		}
+		return goja.Undefined()
+	})
+	if onError {
+		listen("error", func(call goja.FunctionCall) goja.Value {
+			done(call.Argument(0))
+			return goja.Undefined()
+		})
+	}
+	listen("close", func(goja.FunctionCall) goja.Value {
+		onClose()
+		return goja.Undefined()
+	})
+
+	// Streams that are already done will not emit anything more
+	switch {
+	case ours && (s.closed || s.closeEmitted):
+		c.loop.NextTick(onClose)
+	case ours && s.errorEmitted && !willEmitClose:
+		c.loop.NextTick(onClose)
+	case !willEmitClose && (!readable || readableDone) && (!writable || writableDone) && (readableDone || writableDone):
+		c.loop.NextTick(onClose)
+	}
+
+	return func() {
+		for _, l := range listeners {
+			callMethod(vm, l.emitter, "removeListener", vm.ToValue(l.event), l.fn)
+		}
+		listeners = nil
+	}
+}
+
+// pipeline connects streams as stream.pipeline does and calls callback with
+// the first error, if any, and the value the destination resolved to when
+// it is a function. It returns the last stream.
+func (c *streamClasses) pipeline(streams []goja.Value, callback func(err, value goja.Value)) goja.Value {
+	vm := c.vm
+	if len(streams) == 1 {
+		if arr, ok := streams[0].Export().([]interface{}); ok {
+			streams = make([]goja.Value, len(arr))
+			for i, v := range arr {
+				streams[i] = vm.ToValue(v)
+			}
+		}
+	}
+	if len(streams) < 2 {
+		panic(NewNodeError(vm, "TypeError", "ERR_MISSING_ARGS", "The \"streams\" argument must be specified"))
+	}
+
+	var failure, value goja.Value = nil, goja.Undefined()
+	var destroys []func(err goja.Value)
+	pending := 0
+	finish := func(err goja.Value, final bool) {
+		if err != nil && (failure == nil || isPrematureClose(failure)) {
+			failure = err
+		}
+		if failure != nil {
+			for _, destroy := range destroys {
+				destroy(failure)
+			}
+			destroys = nil
+		}
+		if final {
+			c.loop.NextTick(func() { callback(failure, value) })
+		}
+	}
+	track := func(stream *goja.Object, reading, writing bool) {
+		pending++
+		options := vm.NewObject()
+		options.Set("readable", reading)
+		options.Set("writable", writing)
+
+		// destroy tears the stream down unless it finished fine
+		finishedOK := false
+		destroyed := false
+		c.finished(stream, options, func(err goja.Value) {
+			finishedOK = err == nil
+			pending--
+			finish(err, pending == 0)
+		})
+		destroys = append(destroys, func(err goja.Value) {
+			if finishedOK || destroyed {
+				return
+			}
+			destroyed = true
+			if _, ok := goja.AssertFunction(stream.Get("destroy")); ok {
+				callMethod(vm, stream, "destroy", err)
+			}
+		})
+	}
+
+	var ret goja.Value = goja.Undefined()
+	last := len(streams) - 1
+	for i, v := range streams {
+		reading, writing := i < last, i > 0
+
+		if fn, ok := goja.AssertFunction(v); ok {
+			// Functions map the previous stage to a new source; the last one
+			// consumes it and returns a promise
+			var res goja.Value
+			var err error
+			if i == 0 {
+				res, err = fn(goja.Undefined())
+			} else {
+				res, err = fn(goja.Undefined(), ret)
+			}
+			if err != nil {
+				panic(err)
+			}
+			if i == last && !isStreamValue(res) {
+				if obj, ok := res.(*goja.Object); ok {
+					if _, ok := goja.AssertFunction(obj.Get("then")); ok {
+						pending++
+						thenValue(vm, res, func(v goja.Value) {
+							value = v
+							pending--
+							finish(nil, pending == 0)
+						}, func(err goja.Value) {
+							pending--
+							finish(err, pending == 0)
+						})
+						ret = res
+						continue
+					}
+				}
+				panic(NewNodeError(vm, "TypeError", "ERR_INVALID_RETURN_VALUE",
+					"Expected a Promise or a Stream to be returned from the \"destination\" function."))
+			}
+			if !isStreamValue(res) {
+				res = c.from(res, goja.Undefined())
+			}
+			track(res.(*goja.Object), true, false)
+			ret = res
+			continue
+		}
+
+		obj, ok := v.(*goja.Object)
+		if !ok || !isStream(obj) {
+			if i != 0 {
+				panic(ErrInvalidArgType(vm, "streams["+strconv.Itoa(i)+"]", "an instance of Stream or a function", v))
+			}
+			obj = c.from(v, goja.Undefined())
+		}
+		track(obj, reading, writing)
+		if prev, ok := ret.(*goja.Object); ok && isStream(prev) {
+			callMethod(vm, prev, "pipe", obj)
+		}
+		ret = obj
+	}
+	return ret
+}
+
+// isStreamValue reports whether v is a stream object
+func isStreamValue(v goja.Value) bool {
+	obj, ok := v.(*goja.Object)
+	return ok && isStream(obj)
+}
+
+// isPrematureClose reports whether err is ERR_STREAM_PREMATURE_CLOSE, which
+// later, more specific errors replace
+func isPrematureClose(err goja.Value) bool {
+	obj, ok := err.(*goja.Object)
+	if !ok {
+		return false
+	}
+	code := obj.Get("code")
+	return code != nil && code.String() == "ERR_STREAM_PREMATURE_CLOSE"
+}
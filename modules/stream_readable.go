@@ -0,0 +1,844 @@
+package modules
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dop251/goja"
+)
+
+// flowMode is the readableFlowing state of a Readable: null until data is
+// consumed, then true while flowing and false once paused
+type flowMode int
+
+const (
+	flowNone flowMode = iota
+	flowOn
+	flowOff
+)
+
+// readAll is the size read() is called with when no size is given
+const readAll = -1
+
+// readableState is the state of the readable side of a stream
+type readableState struct {
+	objectMode    bool
+	highWaterMark int
+
+	chunks []streamChunk
+	length int
+
+	flowing           flowMode
+	ended             bool
+	endEmitted        bool
+	reading           bool
+	sync              bool
+	needReadable      bool
+	emittedReadable   bool
+	readableListening bool
+	resumeScheduled   bool
+	readingMore       bool
+	dataEmitted       bool
+
+	encoding string
+	decoder  *stringDecoder
+
+	pipes      []*pipeTarget
+	awaitDrain int
+}
+
+// streamChunk is a buffered chunk of a Readable: bytes, a string when an
+// encoding is set, or any value in object mode
+type streamChunk struct {
+	data  []byte
+	str   string
+	value goja.Value
+}
+
+// size returns the length the chunk counts towards the buffered length
+func (c streamChunk) size(objectMode bool) int {
+	switch {
+	case objectMode:
+		return 1
+	case c.data != nil:
+		return len(c.data)
+	}
+	return utf8.RuneCountInString(c.str)
+}
+
+// pipeTarget is a destination a Readable is piped to, with the listeners
+// that connect the two
+type pipeTarget struct {
+	dest      *goja.Object
+	waiting   bool
+	listeners []pipeListener
+}
+
+// pipeListener is a listener pipe registered on the source or destination
+type pipeListener struct {
+	emitter *goja.Object
+	event   string
+	fn      goja.Value
+}
+
+func newReadableState(vm *goja.Runtime, options goja.Value, side string) *readableState {
+	// Until the first _read, pushes are buffered as if made during one
+	r := &readableState{sync: true}
+	r.objectMode, r.highWaterMark = streamOptions(vm, options, side)
+	if opts, ok := options.(*goja.Object); ok {
+		if v := opts.Get("encoding"); !isNullish(v) {
+			r.setEncoding(vm, v)
+		}
+	}
+	return r
+}
+
+// setEncoding makes the stream decode the data it emits to strings
+func (r *readableState) setEncoding(vm *goja.Runtime, v goja.Value) {
+	encoding := bufferOf(vm).encoding(v)
+	r.encoding = encoding
+	r.decoder = &stringDecoder{encoding: encoding}
+
+	// Re-decode what is already buffered
+	var data []byte
+	for _, c := range r.chunks {
+		if c.data != nil {
+			data = append(data, c.data...)
+		} else {
+			data = append(data, c.str...)
+		}
+	}
+	r.chunks = nil
+	r.length = 0
+	if s := r.decoder.write(data); s != "" {
+		r.chunks = append(r.chunks, streamChunk{str: s})
+		r.length = utf8.RuneCountInString(s)
+	}
+}
+
+// setupReadable adds the Readable methods and properties to proto
+func (c *streamClasses) setupReadable(proto *goja.Object) {
+	vm := c.vm
+
+	proto.Set("push", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(c.readableState(call.This).push(call.Argument(0), call.Argument(1), false))
+	})
+
+	proto.Set("unshift", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(c.readableState(call.This).push(call.Argument(0), call.Argument(1), true))
+	})
+
+	proto.Set("read", func(call goja.FunctionCall) goja.Value {
+		n := readAll
+		if arg := call.Argument(0); !goja.IsUndefined(arg) {
+			if f := arg.ToFloat(); !math.IsNaN(f) {
+				n = int(f)
+			}
+		}
+		return c.readableState(call.This).read(n)
+	})
+
+	proto.Set("_read", func(call goja.FunctionCall) goja.Value {
+		panic(NewNodeError(vm, "Error", "ERR_METHOD_NOT_IMPLEMENTED", "The _read() method is not implemented"))
+	})
+
+	proto.Set("pause", func(call goja.FunctionCall) goja.Value {
+		c.readableState(call.This).pause()
+		return call.This
+	})
+
+	proto.Set("resume", func(call goja.FunctionCall) goja.Value {
+		c.readableState(call.This).resume()
+		return call.This
+	})
+
+	proto.Set("isPaused", func(call goja.FunctionCall) goja.Value {
+		r := c.readableState(call.This).r
+		return vm.ToValue(r.flowing == flowOff)
+	})
+
+	proto.Set("setEncoding", func(call goja.FunctionCall) goja.Value {
+		c.readableState(call.This).r.setEncoding(vm, call.Argument(0))
+		return call.This
+	})
+
+	proto.Set("pipe", func(call goja.FunctionCall) goja.Value {
+		dest, ok := call.Argument(0).(*goja.Object)
+		if !ok {
+			panic(ErrInvalidArgType(vm, "destination", "an instance of Stream", call.Argument(0)))
+		}
+		end := true
+		if opts, ok := call.Argument(1).(*goja.Object); ok {
+			if v := opts.Get("end"); v != nil && !goja.IsUndefined(v) {
+				end = v.ToBoolean()
+			}
+		}
+		return c.readableState(call.This).pipe(dest, end)
+	})
+
+	proto.Set("unpipe", func(call goja.FunctionCall) goja.Value {
+		s := c.readableState(call.This)
+		dest, _ := call.Argument(0).(*goja.Object)
+		s.unpipe(dest)
+		return call.This
+	})
+
+	// Adding 'data' listeners switches the stream to flowing mode, adding
+	// 'readable' listeners switches it to paused mode
+	emitterProto := proto.Prototype()
+	on, _ := goja.AssertFunction(emitterProto.Get("on"))
+	onListener := func(call goja.FunctionCall) goja.Value {
+		res, err := on(call.This, call.Arguments...)
+		if err != nil {
+			panic(err)
+		}
+		s := c.readableState(call.This)
+		switch call.Argument(0).String() {
+		case "data":
+			s.r.readableListening = s.listenerCount("readable") > 0
+			if s.r.flowing != flowOff {
+				s.resume()
+			}
+		case "readable":
+			s.onReadableListener()
+		}
+		return res
+	}
+	proto.Set("on", onListener)
+	proto.Set("addListener", onListener)
+
+	off, _ := goja.AssertFunction(emitterProto.Get("removeListener"))
+	offListener := func(call goja.FunctionCall) goja.Value {
+		res, err := off(call.This, call.Arguments...)
+		if err != nil {
+			panic(err)
+		}
+		if call.Argument(0).String() == "readable" {
+			s := c.readableState(call.This)
+			s.nextTick(s.updateReadableListening)
+		}
+		return res
+	}
+	proto.Set("off", offListener)
+	proto.Set("removeListener", offListener)
+
+	getter := func(name string, get func(r *readableState, s *streamState) interface{}) {
+		c.getter(proto, name, func(s *streamState) interface{} {
+			if s.r == nil {
+				return goja.Undefined()
+			}
+			return get(s.r, s)
+		})
+	}
+	getter("readable", func(r *readableState, s *streamState) interface{} {
+		return !s.destroyed && !s.errorEmitted && !r.endEmitted
+	})
+	getter("readableEnded", func(r *readableState, s *streamState) interface{} { return r.endEmitted })
+	getter("readableHighWaterMark", func(r *readableState, s *streamState) interface{} { return r.highWaterMark })
+	getter("readableLength", func(r *readableState, s *streamState) interface{} { return r.length })
+	getter("readableObjectMode", func(r *readableState, s *streamState) interface{} { return r.objectMode })
+	getter("readableDidRead", func(r *readableState, s *streamState) interface{} { return r.dataEmitted })
+	getter("readableAborted", func(r *readableState, s *streamState) interface{} {
+		return (s.destroyed || s.errored != nil) && !r.endEmitted
+	})
+	getter("readableEncoding", func(r *readableState, s *streamState) interface{} {
+		if r.decoder == nil {
+			return goja.Null()
+		}
+		return r.encoding
+	})
+	proto.DefineAccessorProperty("readableFlowing", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		switch c.readableState(call.This).r.flowing {
+		case flowOn:
+			return vm.ToValue(true)
+		case flowOff:
+			return vm.ToValue(false)
+		}
+		return goja.Null()
+	}), vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		r := c.readableState(call.This).r
+		switch v := call.Argument(0); {
+		case goja.IsNull(v):
+			r.flowing = flowNone
+		case v.ToBoolean():
+			r.flowing = flowOn
+		default:
+			r.flowing = flowOff
+		}
+		return goja.Undefined()
+	}), goja.FLAG_TRUE, goja.FLAG_FALSE)
+}
+
+// push adds a chunk to the read buffer, or ends the stream if chunk is
+// null. It returns false once the buffer is at the high water mark.
+func (s *streamState) push(chunk, encoding goja.Value, front bool) bool {
+	r := s.r
+	if goja.IsNull(chunk) {
+		r.reading = false
+		s.onEOF()
+		return false
+	}
+
+	var c streamChunk
+	if r.objectMode {
+		c.value = chunk
+	} else {
+		if str, ok := chunk.Export().(string); ok {
+			enc := encodingUTF8
+			if !isNullish(encoding) {
+				enc = bufferOf(s.vm).encoding(encoding)
+			}
+			c.data = encodeString(str, enc)
+		} else if data, ok := bufferOf(s.vm).uint8Bytes(chunk); ok {
+			c.data = data
+		} else {
+			s.errorOrDestroy(ErrInvalidArgType(s.vm, "chunk", "of type string or an instance of Buffer or Uint8Array", chunk))
+			return false
+		}
+		if len(c.data) == 0 {
+			r.reading = false
+			s.maybeReadMore()
+			return !r.ended && r.length < r.highWaterMark
+		}
+	}
+
+	switch {
+	case front && r.endEmitted:
+		s.errorOrDestroy(NewNodeError(s.vm, "Error", "ERR_STREAM_UNSHIFT_AFTER_END_EVENT", "stream.unshift() after end event"))
+		return false
+	case front:
+		if s.destroyed || s.errored != nil {
+			return false
+		}
+	case r.ended:
+		s.errorOrDestroy(NewNodeError(s.vm, "Error", "ERR_STREAM_PUSH_AFTER_EOF", "stream.push() after EOF"))
+		return false
+	case s.destroyed || s.errored != nil:
+		return false
+	default:
+		r.reading = false
+		if r.decoder != nil && !r.objectMode {
+			c = streamChunk{str: r.decoder.write(c.data)}
+			if c.str == "" {
+				s.maybeReadMore()
+				return !r.ended && r.length < r.highWaterMark
+			}
+		}
+	}
+
+	s.addChunk(c, front)
+	return !r.ended && (r.length < r.highWaterMark || r.length == 0)
+}
+
+// addChunk emits chunk directly to a flowing stream with an empty buffer,
+// and buffers it otherwise
+func (s *streamState) addChunk(c streamChunk, front bool) {
+	r := s.r
+	if r.flowing == flowOn && r.length == 0 && !r.sync && s.listenerCount("data") > 0 {
+		r.dataEmitted = true
+		s.emit("data", s.chunkValue(c))
+	} else {
+		r.length += c.size(r.objectMode)
+		if front {
+			r.chunks = append([]streamChunk{c}, r.chunks...)
+		} else {
+			r.chunks = append(r.chunks, c)
+		}
+		if r.needReadable {
+			s.emitReadable()
+		}
+	}
+	s.maybeReadMore()
+}
+
+// chunkValue converts a buffered chunk to the value handed to consumers
+func (s *streamState) chunkValue(c streamChunk) goja.Value {
+	switch {
+	case c.value != nil:
+		return c.value
+	case c.data != nil:
+		return NewBuffer(s.vm, c.data)
+	}
+	return s.vm.ToValue(c.str)
+}
+
+// onEOF handles push(null)
+func (s *streamState) onEOF() {
+	r := s.r
+	if r.ended {
+		return
+	}
+	if r.decoder != nil {
+		if str := r.decoder.end(); str != "" {
+			r.chunks = append(r.chunks, streamChunk{str: str})
+			r.length += utf8.RuneCountInString(str)
+		}
+	}
+	r.ended = true
+
+	if r.sync {
+		s.emitReadable()
+	} else {
+		r.needReadable = false
+		r.emittedReadable = true
+		s.emitReadableNow()
+	}
+}
+
+// read takes up to n units from the buffer, or readAll, calling _read to
+// refill it. It returns null if not enough data is buffered.
+func (s *streamState) read(n int) goja.Value {
+	r := s.r
+	requested := n
+
+	if n > r.highWaterMark {
+		// Grow the high water mark to the next power of two
+		hwm := 1
+		for hwm < n {
+			hwm <<= 1
+		}
+		r.highWaterMark = hwm
+	}
+	if n != 0 {
+		r.emittedReadable = false
+	}
+
+	// read(0) only triggers a refill, or the 'readable'/'end' events
+	if n == 0 && r.needReadable && (r.length >= r.highWaterMark || r.length > 0 && r.highWaterMark == 0 || r.ended) {
+		if r.length == 0 && r.ended {
+			s.endReadable()
+		} else {
+			s.emitReadable()
+		}
+		return goja.Null()
+	}
+
+	n = r.howMuchToRead(n)
+	if n == 0 && r.ended {
+		if r.length == 0 {
+			s.endReadable()
+		}
+		return goja.Null()
+	}
+
+	doRead := r.needReadable
+	if r.length == 0 || r.length-n < r.highWaterMark {
+		doRead = true
+	}
+	if r.ended || r.reading || s.destroyed || s.errored != nil || !s.constructed {
+		doRead = false
+	}
+	if doRead {
+		r.reading = true
+		r.sync = true
+		if r.length == 0 {
+			r.needReadable = true
+		}
+		func() {
+			defer func() {
+				r.sync = false
+				if e := recover(); e != nil {
+					if ex, ok := e.(*goja.Exception); ok {
+						s.errorOrDestroy(ex.Value())
+						return
+					}
+					panic(e)
+				}
+			}()
+			s.call("_read", s.vm.ToValue(r.highWaterMark))
+		}()
+		// _read may have pushed data synchronously
+		if !r.reading {
+			n = r.howMuchToRead(requested)
+		}
+	}
+
+	var ret goja.Value = goja.Null()
+	if n > 0 {
+		ret = s.fromList(n)
+	}
+	if goja.IsNull(ret) {
+		r.needReadable = r.length <= r.highWaterMark
+		n = 0
+	} else {
+		r.awaitDrain = 0
+	}
+
+	if r.length == 0 {
+		if !r.ended {
+			r.needReadable = true
+		}
+		if requested != n && r.ended {
+			s.endReadable()
+		}
+	}
+
+	if !goja.IsNull(ret) && !s.errorEmitted && !s.closeEmitted {
+		r.dataEmitted = true
+		s.emit("data", ret)
+	}
+	return ret
+}
+
+// howMuchToRead returns how much read(n) can return now
+func (r *readableState) howMuchToRead(n int) int {
+	if n == 0 || n < readAll || (r.length == 0 && r.ended) {
+		return 0
+	}
+	if r.objectMode {
+		return 1
+	}
+	if n == readAll {
+		// Flowing streams emit a chunk at a time
+		if r.flowing == flowOn && r.length > 0 {
+			return r.chunks[0].size(false)
+		}
+		return r.length
+	}
+	if n <= r.length {
+		return n
+	}
+	if r.ended {
+		return r.length
+	}
+	return 0
+}
+
+// fromList removes n units from the front of the buffer
+func (s *streamState) fromList(n int) goja.Value {
+	r := s.r
+	if r.length == 0 {
+		return goja.Null()
+	}
+
+	if r.objectMode {
+		c := r.chunks[0]
+		r.chunks = r.chunks[1:]
+		r.length--
+		return s.chunkValue(c)
+	}
+
+	if n >= r.length {
+		n = r.length
+	}
+	r.length -= n
+
+	// A whole first chunk needs no copying
+	if first := r.chunks[0]; first.size(false) == n {
+		r.chunks = r.chunks[1:]
+		return s.chunkValue(first)
+	}
+
+	if r.decoder != nil {
+		var b strings.Builder
+		for n > 0 {
+			runes := []rune(r.chunks[0].str)
+			if len(runes) <= n {
+				b.WriteString(r.chunks[0].str)
+				r.chunks = r.chunks[1:]
+				n -= len(runes)
+				continue
+			}
+			b.WriteString(string(runes[:n]))
+			r.chunks[0].str = string(runes[n:])
+			n = 0
+		}
+		return s.vm.ToValue(b.String())
+	}
+
+	data := make([]byte, 0, n)
+	for n > 0 {
+		chunk := r.chunks[0].data
+		if len(chunk) <= n {
+			data = append(data, chunk...)
+			r.chunks = r.chunks[1:]
+			n -= len(chunk)
+			continue
+		}
+		data = append(data, chunk[:n]...)
+		r.chunks[0].data = chunk[n:]
+		n = 0
+	}
+	return NewBuffer(s.vm, data)
+}
+
+// emitReadable schedules a 'readable' event
+func (s *streamState) emitReadable() {
+	r := s.r
+	r.needReadable = false
+	if !r.emittedReadable {
+		r.emittedReadable = true
+		s.nextTick(s.emitReadableNow)
+	}
+}
+
+func (s *streamState) emitReadableNow() {
+	r := s.r
+	if !s.destroyed && s.errored == nil && (r.length > 0 || r.ended) {
+		s.emit("readable")
+		r.emittedReadable = false
+	}
+	r.needReadable = r.flowing != flowOn && !r.ended && r.length <= r.highWaterMark
+	s.flow()
+}
+
+// maybeReadMore fills the buffer up to the high water mark on the next tick
+func (s *streamState) maybeReadMore() {
+	r := s.r
+	if r.readingMore || !s.constructed {
+		return
+	}
+	r.readingMore = true
+	s.nextTick(func() {
+		for !r.reading && !r.ended && (r.length < r.highWaterMark || (r.flowing == flowOn && r.length == 0)) {
+			length := r.length
+			s.read(0)
+			if length == r.length {
+				break
+			}
+		}
+		r.readingMore = false
+	})
+}
+
+// flow reads chunks as 'data' events while the stream is flowing
+func (s *streamState) flow() {
+	for s.r.flowing == flowOn && !goja.IsNull(s.read(readAll)) {
+	}
+}
+
+// resume switches the stream to flowing mode
+func (s *streamState) resume() {
+	r := s.r
+	if r.flowing != flowOn {
+		// 'readable' listeners keep the stream paused
+		if r.readableListening {
+			r.flowing = flowOff
+		} else {
+			r.flowing = flowOn
+		}
+		if !r.resumeScheduled {
+			r.resumeScheduled = true
+			s.nextTick(func() {
+				if !r.reading {
+					s.read(0)
+				}
+				r.resumeScheduled = false
+				s.emit("resume")
+				s.flow()
+				if r.flowing == flowOn && !r.reading {
+					s.read(0)
+				}
+			})
+		}
+	}
+}
+
+// pause stops 'data' events
+func (s *streamState) pause() {
+	if s.r.flowing != flowOff {
+		s.r.flowing = flowOff
+		s.emit("pause")
+	}
+}
+
+// onReadableListener switches the stream to paused mode when the first
+// 'readable' listener is added
+func (s *streamState) onReadableListener() {
+	r := s.r
+	if r.endEmitted || r.readableListening {
+		return
+	}
+	r.readableListening = true
+	r.needReadable = true
+	r.flowing = flowOff
+	r.emittedReadable = false
+	if r.length > 0 {
+		s.emitReadable()
+	} else if !r.reading {
+		s.nextTick(func() { s.read(0) })
+	}
+}
+
+// updateReadableListening resumes a stream whose last 'readable' listener
+// was removed while it has 'data' listeners
+func (s *streamState) updateReadableListening() {
+	r := s.r
+	r.readableListening = s.listenerCount("readable") > 0
+	if r.resumeScheduled && r.flowing == flowOff {
+		r.flowing = flowOn
+	} else if s.listenerCount("data") > 0 {
+		s.resume()
+	} else if !r.readableListening {
+		r.flowing = flowNone
+	}
+}
+
+// endReadable emits 'end' on the next tick once the buffer is drained
+func (s *streamState) endReadable() {
+	r := s.r
+	if r.endEmitted {
+		return
+	}
+	r.ended = true
+	s.nextTick(func() {
+		if r.endEmitted || r.length != 0 || s.errorEmitted || s.closeEmitted {
+			return
+		}
+		r.endEmitted = true
+		s.emit("end")
+
+		// Duplex streams are destroyed once both sides are done
+		if s.autoDestroy && (s.w == nil || s.w.finished) {
+			s.destroy(nil, nil)
+		}
+	})
+}
+
+// pipe writes everything read from the stream to dest, pausing while dest
+// is over its high water mark. dest is ended with the stream unless end is
+// false.
+func (s *streamState) pipe(dest *goja.Object, end bool) goja.Value {
+	vm := s.vm
+	r := s.r
+	target := &pipeTarget{dest: dest}
+	r.pipes = append(r.pipes, target)
+
+	listen := func(emitter *goja.Object, method, event string, fn func(call goja.FunctionCall) goja.Value) {
+		value := vm.ToValue(fn)
+		target.listeners = append(target.listeners, pipeListener{emitter: emitter, event: event, fn: value})
+		add, ok := goja.AssertFunction(emitter.Get(method))
+		if !ok {
+			panic(ErrInvalidArgType(vm, "destination", "an instance of Stream", dest))
+		}
+		if _, err := add(emitter, vm.ToValue(event), value); err != nil {
+			panic(err)
+		}
+	}
+	unpipe := func(goja.FunctionCall) goja.Value {
+		s.unpipe(dest)
+		return goja.Undefined()
+	}
+
+	if end {
+		onEnd := func(goja.FunctionCall) goja.Value {
+			if endFn, ok := goja.AssertFunction(dest.Get("end")); ok {
+				if _, err := endFn(dest); err != nil {
+					panic(err)
+				}
+			}
+			return goja.Undefined()
+		}
+		if r.endEmitted {
+			s.nextTick(func() { onEnd(goja.FunctionCall{}) })
+		} else {
+			listen(s.obj, "once", "end", onEnd)
+		}
+	} else {
+		listen(s.obj, "once", "end", unpipe)
+	}
+
+	listen(s.obj, "on", "data", func(call goja.FunctionCall) goja.Value {
+		write, ok := goja.AssertFunction(dest.Get("write"))
+		if !ok {
+			return goja.Undefined()
+		}
+		ret, err := write(dest, call.Argument(0))
+		if err != nil {
+			panic(err)
+		}
+		if ret.ToBoolean() || target.waiting {
+			return goja.Undefined()
+		}
+		// Wait for 'drain' before reading more
+		target.waiting = true
+		r.awaitDrain++
+		s.pause()
+		return goja.Undefined()
+	})
+	listen(dest, "on", "drain", func(goja.FunctionCall) goja.Value {
+		if !target.waiting {
+			return goja.Undefined()
+		}
+		target.waiting = false
+		r.awaitDrain--
+		if r.awaitDrain == 0 && s.listenerCount("data") > 0 {
+			r.flowing = flowOn
+			s.flow()
+		}
+		return goja.Undefined()
+	})
+
+	// An error on dest stops the pipe and is rethrown unless dest handles it
+	listen(dest, "prependListener", "error", func(call goja.FunctionCall) goja.Value {
+		s.unpipe(dest)
+		listeners, _ := goja.AssertFunction(dest.Get("listenerCount"))
+		if count, err := listeners(dest, vm.ToValue("error")); err == nil && count.ToInteger() == 0 {
+			ds, ok := exportSymbol(dest, s.c.stateKey).(*streamState)
+			if !ok || ds.errorEmitted {
+				panic(call.Argument(0))
+			}
+			ds.errorOrDestroy(call.Argument(0))
+		}
+		return goja.Undefined()
+	})
+	listen(dest, "once", "close", unpipe)
+	listen(dest, "once", "finish", unpipe)
+
+	if emit, ok := goja.AssertFunction(dest.Get("emit")); ok {
+		if _, err := emit(dest, vm.ToValue("pipe"), s.obj); err != nil {
+			panic(err)
+		}
+	}
+
+	if needDrain := dest.Get("writableNeedDrain"); needDrain != nil && needDrain.ToBoolean() {
+		target.waiting = true
+		r.awaitDrain++
+		s.pause()
+	} else if r.flowing != flowOn {
+		s.resume()
+	}
+	return dest
+}
+
+// unpipe disconnects dest, or every destination if dest is nil
+func (s *streamState) unpipe(dest *goja.Object) {
+	r := s.r
+	kept := r.pipes[:0]
+	var removed []*pipeTarget
+	for _, target := range r.pipes {
+		if dest == nil || target.dest == dest {
+			removed = append(removed, target)
+		} else {
+			kept = append(kept, target)
+		}
+	}
+	r.pipes = kept
+	if len(removed) == 0 {
+		return
+	}
+	if len(r.pipes) == 0 {
+		s.pause()
+	}
+
+	for _, target := range removed {
+		if target.waiting {
+			r.awaitDrain--
+		}
+		for _, l := range target.listeners {
+			if off, ok := goja.AssertFunction(l.emitter.Get("removeListener")); ok {
+				if _, err := off(l.emitter, s.vm.ToValue(l.event), l.fn); err != nil {
+					panic(err)
+				}
+			}
+		}
+		info := s.vm.NewObject()
+		info.Set("hasUnpiped", false)
+		if emit, ok := goja.AssertFunction(target.dest.Get("emit")); ok {
+			if _, err := emit(target.dest, s.vm.ToValue("unpipe"), s.obj, info); err != nil {
+				panic(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package modules_test
+
+import (
+	"testing"
+
+	"gojs/internal/jstest"
+)
+
+func TestStreamPipeline(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const { Readable, Transform, Writable, pipeline } = require('stream');
+		const chunks = [];
+		pipeline(
+			Readable.from(['a', 'b', 'c']),
+			new Transform({ transform(chunk, enc, cb) { cb(null, String(chunk).toUpperCase()); } }),
+			new Writable({ write(chunk, enc, cb) { chunks.push(String(chunk)); cb(); } }),
+			(err) => console.log(err, chunks.join('')));
+	`, "undefined ABC\n")
+}
+
+func TestStreamEventOrder(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const { Readable } = require('stream');
+		const order = [];
+		const r = new Readable({ read() {} });
+		r.on('data', (d) => order.push('data ' + d));
+		r.on('end', () => order.push('end'));
+		r.on('close', () => console.log(order.join(',')));
+		r.push('x');
+		r.push('y');
+		r.push(null);
+		order.push('sync');
+	`, "sync,data x,data y,end\n")
+}
+
+func TestStreamBackpressure(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const { Writable } = require('stream');
+		const slow = new Writable({ highWaterMark: 2, write(c, e, cb) { setTimeout(cb, 1); } });
+		console.log(slow.write('abc'), slow.writableLength);
+		slow.on('drain', () => console.log('drain', slow.writableLength));
+	`, "false 3\ndrain 0\n")
+}
+
+func TestStreamFinished(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const { PassThrough, finished } = require('stream');
+		const p = new PassThrough();
+		finished(p, (err) => console.log('finished', err.code));
+		p.destroy();
+	`, "finished ERR_STREAM_PREMATURE_CLOSE\n")
+}
+
+func TestStreamAsyncIteration(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const { Readable } = require('stream');
+		class Counter extends Readable {
+			constructor() { super({ objectMode: true }); this.n = 0; }
+			_read() { this.push(this.n < 3 ? this.n++ : null); }
+		}
+		(async () => {
+			const it = new Counter()[Symbol.asyncIterator]();
+			const got = [];
+			for (let x = await it.next(); !x.done; x = await it.next()) got.push(x.value);
+			console.log(got.join(''));
+
+			const early = new Counter();
+			const it2 = early[Symbol.asyncIterator]();
+			await it2.next();
+			await it2.return();
+			console.log(early.destroyed);
+		})();
+	`, "012\ntrue\n")
+}
+
+func TestStreamPromises(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const { Readable, Writable } = require('stream');
+		const sp = require('stream/promises');
+		(async () => {
+			console.log(sp === require('stream').promises);
+			const out = [];
+			await sp.pipeline(Readable.from(['1', '2']), new Writable({ objectMode: true, write(c, e, cb) { out.push(c); cb(); } }));
+			console.log(out.join(''));
+			const bad = new Readable({ read() { this.destroy(new Error('boom')); } });
+			try { await sp.finished(bad.resume()); } catch (e) { console.log('rejected', e.message); }
+		})();
+	`, "true\n12\nrejected boom\n")
+}
+
+func TestStreamAfterAwaitKeepsData(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const { Readable } = require('stream');
+		(async () => {
+			await null;
+			const r = new Readable({ read() {} });
+			const chunks = [];
+			r.on('data', (x) => chunks.push(String(x))).on('end', () => console.log(chunks.join(',')));
+			r.push('1');
+			r.push('2');
+			r.push(null);
+		})();
+	`, "1,2\n")
+}
+
+func TestStreamPromisesRejectInvalidArguments(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		const { finished, pipeline } = require('stream/promises');
+		const report = (p) => p.then(() => console.log('resolved'), (e) => console.log('rejected', e.code));
+		report(finished(null)).then(() => report(pipeline()));
+	`, "rejected ERR_INVALID_ARG_TYPE\nrejected ERR_MISSING_ARGS\n")
+}
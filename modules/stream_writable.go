@@ -0,0 +1,479 @@
+package modules
+
+import (
+	"github.com/dop251/goja"
+)
+
+// writableState is the state of the writable side of a stream
+type writableState struct {
+	objectMode      bool
+	highWaterMark   int
+	decodeStrings   bool
+	defaultEncoding string
+
+	length   int
+	buffered []writeRequest
+	corked   int
+	writing  bool
+	sync     bool
+
+	// writeCallback and writeLength describe the write in progress
+	writeCallback func(err goja.Value)
+	writeLength   int
+	pending       int
+
+	needDrain   bool
+	ending      bool
+	ended       bool
+	finalCalled bool
+	prefinished bool
+	finished    bool
+
+	// onFinished are the callbacks passed to end()
+	onFinished []goja.Callable
+}
+
+// writeRequest is a write waiting for the one in progress to complete
+type writeRequest struct {
+	chunk    goja.Value
+	encoding string
+	size     int
+	callback func(err goja.Value)
+}
+
+func newWritableState(vm *goja.Runtime, options goja.Value, side string) *writableState {
+	w := &writableState{decodeStrings: true, defaultEncoding: encodingUTF8}
+	w.objectMode, w.highWaterMark = streamOptions(vm, options, side)
+	if opts, ok := options.(*goja.Object); ok {
+		if v := opts.Get("decodeStrings"); v != nil && !goja.IsUndefined(v) {
+			w.decodeStrings = v.ToBoolean()
+		}
+		if v := opts.Get("defaultEncoding"); !isNullish(v) {
+			w.defaultEncoding = bufferOf(vm).encoding(v)
+		}
+	}
+	return w
+}
+
+// setupWritable adds the Writable methods and properties to proto
+func (c *streamClasses) setupWritable(proto *goja.Object) {
+	vm := c.vm
+
+	proto.Set("write", func(call goja.FunctionCall) goja.Value {
+		s := c.writableState(call.This)
+		chunk, encoding, cb := call.Argument(0), call.Argument(1), call.Argument(2)
+		if _, ok := goja.AssertFunction(encoding); ok {
+			cb, encoding = encoding, goja.Undefined()
+		}
+		return vm.ToValue(s.write(chunk, encoding, cb))
+	})
+
+	proto.Set("_write", func(call goja.FunctionCall) goja.Value {
+		// Streams with only _writev write one chunk at a time through it
+		s := c.writableState(call.This)
+		if _, ok := s.method("_writev"); ok {
+			req := vm.NewObject()
+			req.Set("chunk", call.Argument(0))
+			req.Set("encoding", call.Argument(1))
+			return s.call("_writev", vm.NewArray(req), call.Argument(2))
+		}
+		panic(NewNodeError(vm, "Error", "ERR_METHOD_NOT_IMPLEMENTED", "The _write() method is not implemented"))
+	})
+
+	proto.Set("end", func(call goja.FunctionCall) goja.Value {
+		s := c.writableState(call.This)
+		chunk, encoding, cb := call.Argument(0), call.Argument(1), call.Argument(2)
+		if _, ok := goja.AssertFunction(chunk); ok {
+			cb, chunk, encoding = chunk, goja.Undefined(), goja.Undefined()
+		} else if _, ok := goja.AssertFunction(encoding); ok {
+			cb, encoding = encoding, goja.Undefined()
+		}
+		s.end(chunk, encoding, cb)
+		return call.This
+	})
+
+	proto.Set("cork", func(call goja.FunctionCall) goja.Value {
+		c.writableState(call.This).w.corked++
+		return goja.Undefined()
+	})
+
+	proto.Set("uncork", func(call goja.FunctionCall) goja.Value {
+		s := c.writableState(call.This)
+		if s.w.corked > 0 {
+			s.w.corked--
+			if !s.w.writing {
+				s.clearBuffer()
+			}
+		}
+		return goja.Undefined()
+	})
+
+	proto.Set("setDefaultEncoding", func(call goja.FunctionCall) goja.Value {
+		s := c.writableState(call.This)
+		s.w.defaultEncoding = bufferOf(vm).encoding(call.Argument(0))
+		return call.This
+	})
+
+	getter := func(name string, get func(w *writableState, s *streamState) interface{}) {
+		c.getter(proto, name, func(s *streamState) interface{} {
+			if s.w == nil {
+				return goja.Undefined()
+			}
+			return get(s.w, s)
+		})
+	}
+	getter("writable", func(w *writableState, s *streamState) interface{} {
+		return !s.destroyed && s.errored == nil && !w.ending && !w.ended
+	})
+	getter("writableEnded", func(w *writableState, s *streamState) interface{} { return w.ending })
+	getter("writableFinished", func(w *writableState, s *streamState) interface{} { return w.finished })
+	getter("writableLength", func(w *writableState, s *streamState) interface{} { return w.length })
+	getter("writableHighWaterMark", func(w *writableState, s *streamState) interface{} { return w.highWaterMark })
+	getter("writableObjectMode", func(w *writableState, s *streamState) interface{} { return w.objectMode })
+	getter("writableCorked", func(w *writableState, s *streamState) interface{} { return w.corked })
+	getter("writableNeedDrain", func(w *writableState, s *streamState) interface{} {
+		return !s.destroyed && !w.ending && w.needDrain
+	})
+	getter("writableAborted", func(w *writableState, s *streamState) interface{} {
+		return (s.destroyed || s.errored != nil) && !w.finished
+	})
+}
+
+// write queues chunk for _write and returns whether the caller may keep
+// writing before 'drain'
+func (s *streamState) write(chunk, encoding, cb goja.Value) bool {
+	vm := s.vm
+	w := s.w
+
+	enc := w.defaultEncoding
+	if !isNullish(encoding) {
+		enc = encoding.String()
+		if enc != encodingBuffer {
+			enc = bufferOf(vm).encoding(encoding)
+		}
+	}
+
+	if goja.IsNull(chunk) {
+		panic(NewNodeError(vm, "TypeError", "ERR_STREAM_NULL_VALUES", "May not write null values to stream"))
+	}
+	size := 1
+	if !w.objectMode {
+		if str, ok := chunk.Export().(string); ok {
+			if w.decodeStrings {
+				data := encodeString(str, enc)
+				chunk, enc, size = NewBuffer(vm, data), encodingBuffer, len(data)
+			} else {
+				size = len(encodeString(str, enc))
+			}
+		} else if data, ok := bufferOf(vm).uint8Bytes(chunk); ok {
+			if !vm.InstanceOf(chunk, bufferOf(vm).ctor) {
+				chunk = NewBuffer(vm, data)
+			}
+			enc, size = encodingBuffer, len(data)
+		} else {
+			panic(ErrInvalidArgType(vm, "chunk", "of type string or an instance of Buffer, TypedArray, or DataView", chunk))
+		}
+	}
+
+	callback := func(err goja.Value) {
+		if fn, ok := goja.AssertFunction(cb); ok {
+			if _, e := fn(goja.Undefined(), err); e != nil {
+				panic(e)
+			}
+		}
+	}
+
+	var err *goja.Object
+	if w.ending {
+		err = NewNodeError(vm, "Error", "ERR_STREAM_WRITE_AFTER_END", "write after end")
+	} else if s.destroyed {
+		err = s.destroyedError("write")
+	}
+	if err != nil {
+		s.nextTick(func() { callback(err) })
+		s.errorOrDestroy(err)
+		return false
+	}
+
+	w.pending++
+	w.length += size
+	ret := w.length < w.highWaterMark
+	if !ret {
+		w.needDrain = true
+	}
+
+	req := writeRequest{chunk: chunk, encoding: enc, size: size, callback: callback}
+	if w.writing || w.corked > 0 || s.errored != nil || !s.constructed {
+		w.buffered = append(w.buffered, req)
+	} else {
+		s.doWrite(req)
+	}
+	return ret && s.errored == nil && !s.destroyed
+}
+
+// doWrite hands req to _write
+func (s *streamState) doWrite(req writeRequest) {
+	w := s.w
+	w.writeLength = req.size
+	w.writeCallback = req.callback
+	w.writing = true
+	w.sync = true
+	defer func() { w.sync = false }()
+
+	if s.destroyed {
+		s.onWrite(s.destroyedError("write"))
+		return
+	}
+	s.call("_write", req.chunk, s.vm.ToValue(req.encoding), s.callback(s.onWrite))
+}
+
+// doWritev hands every buffered write to _writev
+func (s *streamState) doWritev() {
+	vm := s.vm
+	w := s.w
+	reqs := w.buffered
+	w.buffered = nil
+
+	chunks := make([]interface{}, len(reqs))
+	size := 0
+	for i, req := range reqs {
+		chunk := vm.NewObject()
+		chunk.Set("chunk", req.chunk)
+		chunk.Set("encoding", req.encoding)
+		chunks[i] = chunk
+		size += req.size
+	}
+
+	// The batch completes as one write
+	w.pending -= len(reqs) - 1
+	w.writeLength = size
+	w.writeCallback = func(err goja.Value) {
+		for _, req := range reqs {
+			req.callback(err)
+		}
+	}
+	w.writing = true
+	w.sync = true
+	defer func() { w.sync = false }()
+	s.call("_writev", vm.NewArray(chunks...), s.callback(s.onWrite))
+}
+
+// onWrite is the callback of _write
+func (s *streamState) onWrite(err goja.Value) {
+	w := s.w
+	cb := w.writeCallback
+	w.writing = false
+	w.writeCallback = nil
+	w.length -= w.writeLength
+	w.writeLength = 0
+
+	if !isNullish(err) {
+		s.setErrored(err)
+		if w.sync {
+			s.nextTick(func() { s.afterWriteError(cb, err) })
+		} else {
+			s.afterWriteError(cb, err)
+		}
+		return
+	}
+
+	if len(w.buffered) > 0 {
+		s.clearBuffer()
+	}
+	if w.sync {
+		s.nextTick(func() { s.afterWrite(cb) })
+	} else {
+		s.afterWrite(cb)
+	}
+}
+
+func (s *streamState) afterWrite(cb func(err goja.Value)) {
+	w := s.w
+	if w.needDrain && !w.ending && !s.destroyed && w.length == 0 {
+		w.needDrain = false
+		s.emit("drain")
+	}
+	w.pending--
+	cb(goja.Null())
+	if s.destroyed {
+		w.failPending(s, s.destroyedError("write"))
+	}
+	s.finishMaybe(false)
+}
+
+func (s *streamState) afterWriteError(cb func(err goja.Value), err goja.Value) {
+	s.w.pending--
+	cb(err)
+	s.w.failPending(s, s.destroyedError("write"))
+	s.errorOrDestroy(err)
+}
+
+// failPending calls the callbacks of the buffered writes and of end() with
+// err once the stream has failed
+func (w *writableState) failPending(s *streamState, err goja.Value) {
+	if s.errored != nil {
+		err = s.errored
+	}
+	buffered := w.buffered
+	w.buffered = nil
+	for _, req := range buffered {
+		w.length -= req.size
+		w.pending--
+		req.callback(err)
+	}
+	onFinished := w.onFinished
+	w.onFinished = nil
+	for _, cb := range onFinished {
+		if _, e := cb(goja.Undefined(), err); e != nil {
+			panic(e)
+		}
+	}
+}
+
+// clearBuffer starts the buffered writes, all at once through _writev if
+// the stream has it, otherwise one at a time
+func (s *streamState) clearBuffer() {
+	w := s.w
+	if w.corked > 0 || s.destroyed || !s.constructed {
+		return
+	}
+	if _, ok := s.method("_writev"); ok && len(w.buffered) > 1 {
+		s.doWritev()
+		return
+	}
+	for len(w.buffered) > 0 && !w.writing {
+		req := w.buffered[0]
+		w.buffered = w.buffered[1:]
+		s.doWrite(req)
+	}
+}
+
+// end finishes the stream after the pending writes, writing chunk first
+func (s *streamState) end(chunk, encoding, cb goja.Value) {
+	w := s.w
+	if !isNullish(chunk) {
+		s.write(chunk, encoding, goja.Undefined())
+	}
+	if w.corked > 0 {
+		w.corked = 0
+		if !w.writing {
+			s.clearBuffer()
+		}
+	}
+
+	var err goja.Value
+	switch {
+	case s.errored != nil:
+		err = s.errored
+	case !w.ending:
+		w.ending = true
+		s.finishMaybe(true)
+		w.ended = true
+	case w.finished:
+		err = NewNodeError(s.vm, "Error", "ERR_STREAM_ALREADY_FINISHED", "Cannot call end after a stream was finished")
+	case s.destroyed:
+		err = s.destroyedError("end")
+	}
+
+	fn, ok := goja.AssertFunction(cb)
+	if !ok {
+		return
+	}
+	if err != nil || w.finished {
+		if err == nil {
+			err = goja.Null()
+		}
+		s.nextTick(func() {
+			if _, e := fn(goja.Undefined(), err); e != nil {
+				panic(e)
+			}
+		})
+		return
+	}
+	w.onFinished = append(w.onFinished, fn)
+}
+
+// needFinish reports whether every write is done and 'finish' is due
+func (s *streamState) needFinish() bool {
+	w := s.w
+	return w.ending && !s.destroyed && s.constructed && w.length == 0 && s.errored == nil &&
+		len(w.buffered) == 0 && !w.finished && !w.writing && !s.errorEmitted && !s.closeEmitted
+}
+
+// finishMaybe runs _final and emits 'finish' once the stream has ended and
+// all writes are done
+func (s *streamState) finishMaybe(sync bool) {
+	w := s.w
+	if !s.needFinish() {
+		return
+	}
+	s.prefinish()
+	if w.pending != 0 {
+		return
+	}
+	w.pending++
+	if sync {
+		s.nextTick(func() {
+			if s.needFinish() {
+				s.finish()
+			} else {
+				w.pending--
+			}
+		})
+		return
+	}
+	s.finish()
+}
+
+// prefinish calls _final, if the stream has one, before 'finish'
+func (s *streamState) prefinish() {
+	w := s.w
+	if w.prefinished || w.finalCalled {
+		return
+	}
+	if _, ok := s.method("_final"); !ok || s.destroyed {
+		w.prefinished = true
+		s.emit("prefinish")
+		return
+	}
+
+	w.finalCalled = true
+	w.pending++
+	w.sync = true
+	defer func() { w.sync = false }()
+	s.call("_final", s.callback(func(err goja.Value) {
+		w.pending--
+		if !isNullish(err) {
+			w.failPending(s, err)
+			s.errorOrDestroy(err)
+			return
+		}
+		if s.needFinish() {
+			w.prefinished = true
+			s.emit("prefinish")
+			w.pending++
+			s.nextTick(s.finish)
+		}
+	}))
+}
+
+// finish emits 'finish' and calls the end() callbacks
+func (s *streamState) finish() {
+	w := s.w
+	w.pending--
+	w.finished = true
+
+	onFinished := w.onFinished
+	w.onFinished = nil
+	for _, cb := range onFinished {
+		if _, err := cb(goja.Undefined(), goja.Null()); err != nil {
+			panic(err)
+		}
+	}
+	s.emit("finish")
+
+	// Duplex streams are destroyed once both sides are done
+	if s.autoDestroy && (s.r == nil || s.r.endEmitted) {
+		s.destroy(nil, nil)
+	}
+}
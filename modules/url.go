@@ -0,0 +1,920 @@
+package modules
+
+import (
+	"net/url"
+	"path/filepath"
+	goruntime "runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// urlSpecialSchemes maps the schemes the URL Standard treats specially to
+// their default ports
+var urlSpecialSchemes = map[string]string{
+	"ftp":   "21",
+	"file":  "",
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+}
+
+// Characters percent-encoded in each component, besides C0 controls and
+// non-ASCII bytes
+const (
+	urlFragmentSet = " \"<>`"
+	urlQuerySet    = " \"#<>"
+	urlPathSet     = " \"#<>?`{}"
+	urlUserinfoSet = " \"#<>?`{}/:;=@[\\]^|"
+)
+
+// urlRecord is a parsed URL. Components other than scheme and host are
+// kept percent-encoded, as the URL getters return them.
+type urlRecord struct {
+	scheme      string
+	username    string
+	password    string
+	host        string
+	hasHost     bool
+	port        string
+	path        string
+	opaque      bool
+	query       string
+	hasQuery    bool
+	fragment    string
+	hasFragment bool
+
+	// params is the state of url.searchParams, kept in sync with query
+	params    *searchParams
+	paramsObj *goja.Object
+}
+
+// searchParams is the state of a URLSearchParams: its name-value pairs and
+// the URL whose query they are, if any
+type searchParams struct {
+	list [][2]string
+	url  *urlRecord
+}
+
+// urlClasses holds the URL and URLSearchParams constructors
+type urlClasses struct {
+	vm        *goja.Runtime
+	url       *goja.Object
+	urlProto  *goja.Object
+	params    *goja.Object
+	urlKey    *goja.Symbol
+	paramsKey *goja.Symbol
+}
+
+// urlClassesOf returns the URL classes of vm, or nil before SetupURL
+func urlClassesOf(vm *goja.Runtime) *urlClasses {
+	val := vm.GlobalObject().Get("__url")
+	if val == nil {
+		return nil
+	}
+	c, _ := val.Export().(*urlClasses)
+	return c
+}
+
+// SetupURL sets up the URL and URLSearchParams globals and the url module
+func SetupURL(vm *goja.Runtime) error {
+	c := &urlClasses{
+		vm:        vm,
+		urlKey:    goja.NewSymbol("url"),
+		paramsKey: goja.NewSymbol("urlSearchParams"),
+	}
+	c.setupSearchParams()
+	c.setupURL()
+
+	if err := vm.GlobalObject().DefineDataProperty("__url", vm.ToValue(c), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE); err != nil {
+		return err
+	}
+	vm.GlobalObject().DefineDataProperty("URL", c.url, goja.FLAG_TRUE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	vm.GlobalObject().DefineDataProperty("URLSearchParams", c.params, goja.FLAG_TRUE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	module := vm.NewObject()
+	module.Set("URL", c.url)
+	module.Set("URLSearchParams", c.params)
+	module.Set("fileURLToPath", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(c.fileURLToPath(call.Argument(0)))
+	})
+	module.Set("pathToFileURL", func(call goja.FunctionCall) goja.Value {
+		path, ok := call.Argument(0).Export().(string)
+		if !ok {
+			panic(ErrInvalidArgType(vm, "path", "of type string", call.Argument(0)))
+		}
+		return c.pathToFileURL(path)
+	})
+	return RegisterModule(vm, "url", module)
+}
+
+// setupURL creates URL, whose components are accessors over a urlRecord
+func (c *urlClasses) setupURL() {
+	vm := c.vm
+	c.url, c.urlProto = newClass(vm, "URL", nil, func(this *goja.Object, args []goja.Value) {
+		if len(args) == 0 {
+			panic(ErrInvalidArgType(vm, "url", "of type string", goja.Undefined()))
+		}
+		r := c.parse(args[0].String(), argAt(args, 1))
+		this.DefineDataPropertySymbol(c.urlKey, vm.ToValue(r), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	})
+	proto := c.urlProto
+
+	// canParse reports whether new URL(input, base) would succeed
+	c.url.Set("canParse", func(call goja.FunctionCall) goja.Value {
+		var base *urlRecord
+		if b := call.Argument(1); !goja.IsUndefined(b) {
+			var ok bool
+			if base, ok = parseURL(b.String(), nil); !ok {
+				return vm.ToValue(false)
+			}
+		}
+		_, ok := parseURL(call.Argument(0).String(), base)
+		return vm.ToValue(ok)
+	})
+
+	accessor := func(name string, get func(r *urlRecord) string, set func(r *urlRecord, v string)) {
+		var setter goja.Value
+		if set != nil {
+			setter = vm.ToValue(func(call goja.FunctionCall) goja.Value {
+				set(c.record(call.This), call.Argument(0).String())
+				return goja.Undefined()
+			})
+		}
+		proto.DefineAccessorProperty(name, vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			return vm.ToValue(get(c.record(call.This)))
+		}), setter, goja.FLAG_TRUE, goja.FLAG_TRUE)
+	}
+
+	accessor("href", (*urlRecord).href, func(r *urlRecord, v string) {
+		parsed, ok := parseURL(v, nil)
+		if !ok {
+			panic(c.invalidURL(v, nil))
+		}
+		params, paramsObj := r.params, r.paramsObj
+		*r = *parsed
+		r.params, r.paramsObj = params, paramsObj
+		r.syncParams()
+	})
+	accessor("origin", (*urlRecord).origin, nil)
+	accessor("protocol", func(r *urlRecord) string { return r.scheme + ":" }, (*urlRecord).setProtocol)
+	accessor("username", func(r *urlRecord) string { return r.username }, func(r *urlRecord, v string) {
+		if r.hasCredentials() {
+			r.username = urlEncode(v, urlUserinfoSet)
+		}
+	})
+	accessor("password", func(r *urlRecord) string { return r.password }, func(r *urlRecord, v string) {
+		if r.hasCredentials() {
+			r.password = urlEncode(v, urlUserinfoSet)
+		}
+	})
+	accessor("host", func(r *urlRecord) string {
+		if r.port != "" {
+			return r.host + ":" + r.port
+		}
+		return r.host
+	}, func(r *urlRecord, v string) {
+		if r.opaque {
+			return
+		}
+		host, port := splitHostPort(v)
+		if r.setHostname(host) && port != "" {
+			r.setPort(port)
+		}
+	})
+	accessor("hostname", func(r *urlRecord) string { return r.host }, func(r *urlRecord, v string) {
+		if !r.opaque {
+			r.setHostname(v)
+		}
+	})
+	accessor("port", func(r *urlRecord) string { return r.port }, func(r *urlRecord, v string) {
+		if r.hasHost && r.host != "" && r.scheme != "file" {
+			r.setPort(v)
+		}
+	})
+	accessor("pathname", func(r *urlRecord) string { return r.path }, func(r *urlRecord, v string) {
+		if r.opaque {
+			return
+		}
+		if r.special() {
+			v = strings.ReplaceAll(v, "\\", "/")
+		}
+		if !strings.HasPrefix(v, "/") && (r.special() || r.hasHost) {
+			v = "/" + v
+		}
+		r.path = removeDotSegments(urlEncode(v, urlPathSet))
+	})
+	accessor("search", func(r *urlRecord) string {
+		if r.query == "" {
+			return ""
+		}
+		return "?" + r.query
+	}, func(r *urlRecord, v string) {
+		v = strings.TrimPrefix(v, "?")
+		r.query, r.hasQuery = urlEncode(v, r.querySet()), v != ""
+		r.syncParams()
+	})
+	accessor("hash", func(r *urlRecord) string {
+		if r.fragment == "" {
+			return ""
+		}
+		return "#" + r.fragment
+	}, func(r *urlRecord, v string) {
+		v = strings.TrimPrefix(v, "#")
+		r.fragment, r.hasFragment = urlEncode(v, urlFragmentSet), v != ""
+	})
+
+	proto.DefineAccessorProperty("searchParams", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		r := c.record(call.This)
+		if r.paramsObj == nil {
+			r.params = &searchParams{url: r}
+			r.syncParams()
+			r.paramsObj = c.newSearchParams(r.params)
+		}
+		return r.paramsObj
+	}), nil, goja.FLAG_TRUE, goja.FLAG_TRUE)
+
+	href := func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(c.record(call.This).href())
+	}
+	proto.Set("toString", href)
+	proto.Set("toJSON", href)
+	proto.DefineDataPropertySymbol(goja.SymToStringTag, vm.ToValue("URL"), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	// util.inspect shows the components, as Node.js does
+	if custom := inspectorOf(vm).custom; custom != nil {
+		proto.SetSymbol(custom, func(call goja.FunctionCall) goja.Value {
+			this := call.This.ToObject(vm)
+			var pairs []interface{}
+			for _, name := range []string{"href", "origin", "protocol", "username", "password", "host", "hostname", "port", "pathname", "search", "searchParams", "hash"} {
+				pairs = append(pairs, name, this.Get(name))
+			}
+			return inspectObject(vm, c.url, pairs...)
+		})
+	}
+}
+
+// setupSearchParams creates URLSearchParams
+func (c *urlClasses) setupSearchParams() {
+	vm := c.vm
+	var proto *goja.Object
+	c.params, proto = newClass(vm, "URLSearchParams", nil, func(this *goja.Object, args []goja.Value) {
+		p := &searchParams{}
+		init := argAt(args, 0)
+		switch obj, isObj := init.(*goja.Object); {
+		case isNullish(init):
+		case isObj && obj.GetSymbol(goja.SymIterator) != nil && !goja.IsUndefined(obj.GetSymbol(goja.SymIterator)):
+			for _, pair := range iterableValues(vm, obj) {
+				pairObj, ok := pair.(*goja.Object)
+				var items []goja.Value
+				if ok {
+					items = iterableValues(vm, pairObj)
+				}
+				if len(items) != 2 {
+					panic(NewNodeError(vm, "TypeError", "ERR_INVALID_TUPLE", "Each query pair must be an iterable [name, value] tuple"))
+				}
+				p.list = append(p.list, [2]string{items[0].String(), items[1].String()})
+			}
+		case isObj:
+			for _, key := range obj.Keys() {
+				p.list = append(p.list, [2]string{key, obj.Get(key).String()})
+			}
+		default:
+			p.list = parseQuery(strings.TrimPrefix(init.String(), "?"))
+		}
+		this.DefineDataPropertySymbol(c.paramsKey, vm.ToValue(p), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	})
+
+	paramsOf := func(this goja.Value) *searchParams {
+		if obj, ok := this.(*goja.Object); ok {
+			if p, ok := exportSymbol(obj, c.paramsKey).(*searchParams); ok {
+				return p
+			}
+		}
+		panic(NewNodeError(vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be of type URLSearchParams"))
+	}
+	requireArgs := func(call goja.FunctionCall, names ...string) {
+		if len(call.Arguments) < len(names) {
+			panic(NewNodeError(vm, "TypeError", "ERR_MISSING_ARGS", "The \""+strings.Join(names, "\" and \"")+"\" arguments must be specified"))
+		}
+	}
+	// matches reports whether a pair has name and, if given, value
+	matches := func(call goja.FunctionCall) func(pair [2]string) bool {
+		name := call.Argument(0).String()
+		value, hasValue := "", !goja.IsUndefined(call.Argument(1))
+		if hasValue {
+			value = call.Argument(1).String()
+		}
+		return func(pair [2]string) bool {
+			return pair[0] == name && (!hasValue || pair[1] == value)
+		}
+	}
+
+	proto.Set("append", func(call goja.FunctionCall) goja.Value {
+		requireArgs(call, "name", "value")
+		p := paramsOf(call.This)
+		p.list = append(p.list, [2]string{call.Argument(0).String(), call.Argument(1).String()})
+		p.update()
+		return goja.Undefined()
+	})
+	proto.Set("delete", func(call goja.FunctionCall) goja.Value {
+		requireArgs(call, "name")
+		p := paramsOf(call.This)
+		match := matches(call)
+		list := p.list[:0]
+		for _, pair := range p.list {
+			if !match(pair) {
+				list = append(list, pair)
+			}
+		}
+		p.list = list
+		p.update()
+		return goja.Undefined()
+	})
+	proto.Set("get", func(call goja.FunctionCall) goja.Value {
+		requireArgs(call, "name")
+		name := call.Argument(0).String()
+		for _, pair := range paramsOf(call.This).list {
+			if pair[0] == name {
+				return vm.ToValue(pair[1])
+			}
+		}
+		return goja.Null()
+	})
+	proto.Set("getAll", func(call goja.FunctionCall) goja.Value {
+		requireArgs(call, "name")
+		name := call.Argument(0).String()
+		values := []interface{}{}
+		for _, pair := range paramsOf(call.This).list {
+			if pair[0] == name {
+				values = append(values, pair[1])
+			}
+		}
+		return vm.ToValue(vm.NewArray(values...))
+	})
+	proto.Set("has", func(call goja.FunctionCall) goja.Value {
+		requireArgs(call, "name")
+		match := matches(call)
+		for _, pair := range paramsOf(call.This).list {
+			if match(pair) {
+				return vm.ToValue(true)
+			}
+		}
+		return vm.ToValue(false)
+	})
+	// set replaces the first pair named name and removes the others
+	proto.Set("set", func(call goja.FunctionCall) goja.Value {
+		requireArgs(call, "name", "value")
+		p := paramsOf(call.This)
+		name, value := call.Argument(0).String(), call.Argument(1).String()
+		list, found := p.list[:0], false
+		for _, pair := range p.list {
+			if pair[0] != name {
+				list = append(list, pair)
+			} else if !found {
+				list = append(list, [2]string{name, value})
+				found = true
+			}
+		}
+		if !found {
+			list = append(list, [2]string{name, value})
+		}
+		p.list = list
+		p.update()
+		return goja.Undefined()
+	})
+	proto.Set("sort", func(call goja.FunctionCall) goja.Value {
+		p := paramsOf(call.This)
+		sort.SliceStable(p.list, func(i, j int) bool { return p.list[i][0] < p.list[j][0] })
+		p.update()
+		return goja.Undefined()
+	})
+	proto.Set("toString", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(serializeQuery(paramsOf(call.This).list))
+	})
+	proto.Set("forEach", func(call goja.FunctionCall) goja.Value {
+		cb, ok := goja.AssertFunction(call.Argument(0))
+		if !ok {
+			panic(ErrInvalidArgType(vm, "callback", "of type function", call.Argument(0)))
+		}
+		p := paramsOf(call.This)
+		for i := 0; i < len(p.list); i++ {
+			pair := p.list[i]
+			if _, err := cb(call.Argument(1), vm.ToValue(pair[1]), vm.ToValue(pair[0]), call.This); err != nil {
+				panic(err)
+			}
+		}
+		return goja.Undefined()
+	})
+	proto.DefineAccessorProperty("size", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(len(paramsOf(call.This).list))
+	}), nil, goja.FLAG_TRUE, goja.FLAG_TRUE)
+
+	iterator := func(item func(pair [2]string) interface{}) func(goja.FunctionCall) goja.Value {
+		return func(call goja.FunctionCall) goja.Value {
+			list := paramsOf(call.This).list
+			items := make([]interface{}, len(list))
+			for i, pair := range list {
+				items[i] = item(pair)
+			}
+			return iterateValues(vm, items)
+		}
+	}
+	entries := iterator(func(pair [2]string) interface{} { return vm.NewArray(pair[0], pair[1]) })
+	proto.Set("entries", entries)
+	proto.Set("keys", iterator(func(pair [2]string) interface{} { return pair[0] }))
+	proto.Set("values", iterator(func(pair [2]string) interface{} { return pair[1] }))
+	proto.SetSymbol(goja.SymIterator, entries)
+	proto.DefineDataPropertySymbol(goja.SymToStringTag, vm.ToValue("URLSearchParams"), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	// util.inspect shows the pairs like a Map, as Node.js does
+	if custom := inspectorOf(vm).custom; custom != nil {
+		proto.SetSymbol(custom, func(call goja.FunctionCall) goja.Value {
+			list := paramsOf(call.This).list
+			if len(list) == 0 {
+				return vm.ToValue("URLSearchParams {}")
+			}
+			items := make([]string, len(list))
+			for i, pair := range list {
+				items[i] = quoteString(pair[0]) + " => " + quoteString(pair[1])
+			}
+			return vm.ToValue("URLSearchParams { " + strings.Join(items, ", ") + " }")
+		})
+	}
+}
+
+// newSearchParams wraps p in a URLSearchParams object
+func (c *urlClasses) newSearchParams(p *searchParams) *goja.Object {
+	obj := c.vm.NewObject()
+	obj.SetPrototype(c.params.Get("prototype").ToObject(c.vm))
+	obj.DefineDataPropertySymbol(c.paramsKey, c.vm.ToValue(p), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	return obj
+}
+
+// record returns the parsed URL of this, throwing for other objects
+func (c *urlClasses) record(this goja.Value) *urlRecord {
+	if obj, ok := this.(*goja.Object); ok {
+		if r, ok := exportSymbol(obj, c.urlKey).(*urlRecord); ok {
+			return r
+		}
+	}
+	panic(NewNodeError(c.vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be of type URL"))
+}
+
+// parse parses input against base, a URL or string, throwing
+// ERR_INVALID_URL for invalid URLs
+func (c *urlClasses) parse(input string, base goja.Value) *urlRecord {
+	var baseRecord *urlRecord
+	if !goja.IsUndefined(base) && base != nil {
+		var ok bool
+		if baseRecord, ok = parseURL(base.String(), nil); !ok {
+			panic(c.invalidURL(input, base))
+		}
+	}
+	r, ok := parseURL(input, baseRecord)
+	if !ok {
+		panic(c.invalidURL(input, base))
+	}
+	return r
+}
+
+func (c *urlClasses) invalidURL(input string, base goja.Value) *goja.Object {
+	err := NewNodeError(c.vm, "TypeError", "ERR_INVALID_URL", "Invalid URL")
+	err.Set("input", input)
+	if !isNullish(base) {
+		err.Set("base", base.String())
+	}
+	return err
+}
+
+// newURL returns a URL object for href, which must be valid
+func (c *urlClasses) newURL(href string) *goja.Object {
+	obj, err := c.vm.New(c.url, c.vm.ToValue(href))
+	if err != nil {
+		panic(err)
+	}
+	return obj
+}
+
+// fileURLToPath converts a file: URL, given as a string or URL, to a path
+func (c *urlClasses) fileURLToPath(v goja.Value) string {
+	vm := c.vm
+	var r *urlRecord
+	if obj, ok := v.(*goja.Object); ok && vm.InstanceOf(obj, c.url) {
+		r = c.record(obj)
+	} else if s, ok := v.Export().(string); ok {
+		r = c.parse(s, nil)
+	} else {
+		panic(ErrInvalidArgType(vm, "path", "of type string or an instance of URL", v))
+	}
+	if r.scheme != "file" {
+		panic(NewNodeError(vm, "TypeError", "ERR_INVALID_URL_SCHEME", "The URL must be of scheme file"))
+	}
+	if r.host != "" && r.host != "localhost" {
+		panic(NewNodeError(vm, "TypeError", "ERR_INVALID_FILE_URL_HOST", "File URL host must be \"localhost\" or empty on "+NodePlatform(goruntime.GOOS)))
+	}
+	if strings.Contains(strings.ToLower(r.path), "%2f") {
+		panic(NewNodeError(vm, "TypeError", "ERR_INVALID_FILE_URL_PATH", "File URL path must not include encoded / characters"))
+	}
+	return filepath.FromSlash(percentDecode(r.path))
+}
+
+// pathToFileURL converts a path, resolved against the working directory, to
+// a file: URL
+func (c *urlClasses) pathToFileURL(path string) *goja.Object {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		panic(c.vm.NewGoError(err))
+	}
+	abs = filepath.ToSlash(abs)
+	if strings.HasSuffix(path, "/") && !strings.HasSuffix(abs, "/") {
+		abs += "/"
+	}
+	abs = strings.NewReplacer("%", "%25", "\\", "%5C", "\n", "%0A", "\r", "%0D", "\t", "%09").Replace(abs)
+	return c.newURL("file://" + urlEncode(abs, urlPathSet))
+}
+
+// parseURL parses input, resolving it against base if it is relative. It
+// follows the URL Standard closely enough for http, file and opaque URLs,
+// with net/url doing the splitting.
+func parseURL(input string, base *urlRecord) (*urlRecord, bool) {
+	input = strings.TrimFunc(input, func(r rune) bool { return r <= ' ' })
+	input = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, input)
+
+	scheme := urlScheme(input)
+	if _, special := urlSpecialSchemes[scheme]; special || scheme == "" && base != nil && base.special() {
+		// Special URLs treat backslashes as slashes
+		end := strings.IndexAny(input, "?#")
+		if end < 0 {
+			end = len(input)
+		}
+		input = strings.ReplaceAll(input[:end], "\\", "/") + input[end:]
+		// and need no slashes after the scheme
+		if special && scheme != "file" {
+			input = scheme + "://" + strings.TrimLeft(input[len(scheme)+1:], "/")
+		}
+	}
+	hasFragment := strings.Contains(input, "#")
+	hasQuery := strings.Contains(strings.SplitN(input, "#", 2)[0], "?")
+
+	// net/url rejects spaces the URL Standard percent-encodes, and '%'
+	// signs not starting an escape outside the query
+	input = strings.ReplaceAll(input, " ", "%20")
+	if end := strings.IndexAny(input, "?#"); end >= 0 && input[end] == '?' {
+		queryEnd := strings.IndexByte(input, '#')
+		if queryEnd < 0 {
+			queryEnd = len(input)
+		}
+		input = escapeLonePercents(input[:end]) + input[end:queryEnd] + escapeLonePercents(input[queryEnd:])
+	} else {
+		input = escapeLonePercents(input)
+	}
+	u, err := url.Parse(input)
+	if err != nil {
+		return nil, false
+	}
+	if u.Scheme == "" {
+		if base == nil || base.opaque {
+			return nil, false
+		}
+		b, err := url.Parse(base.href())
+		if err != nil {
+			return nil, false
+		}
+		if u.Path == "" && u.Host == "" && !hasQuery {
+			hasQuery = base.hasQuery
+		}
+		u = b.ResolveReference(u)
+	}
+
+	r := &urlRecord{scheme: strings.ToLower(u.Scheme), hasFragment: hasFragment}
+	if u.Opaque != "" {
+		r.opaque = true
+		r.path = urlEncode(u.Opaque, "")
+	} else {
+		if u.User != nil {
+			r.username = urlEncode(u.User.Username(), urlUserinfoSet)
+			if password, ok := u.User.Password(); ok {
+				r.password = urlEncode(password, urlUserinfoSet)
+			}
+		}
+		r.hasHost = u.Host != "" || r.special()
+		host, port := splitHostPort(u.Host)
+		if !r.setHostname(host) || !r.setPort(port) && port != "" {
+			return nil, false
+		}
+		if r.special() && r.scheme != "file" && r.host == "" {
+			return nil, false
+		}
+
+		path := u.RawPath
+		if path == "" {
+			path = u.EscapedPath()
+		}
+		r.path = urlEncode(path, urlPathSet)
+		if strings.HasPrefix(r.path, "/") {
+			r.path = removeDotSegments(r.path)
+		} else if r.special() {
+			r.path = "/" + r.path
+		}
+	}
+	r.query, r.hasQuery = urlEncode(u.RawQuery, r.querySet()), hasQuery || u.RawQuery != ""
+	r.fragment = urlEncode(u.EscapedFragment(), urlFragmentSet)
+	return r, true
+}
+
+// urlScheme returns the lowercase scheme of input, or "" if it has none
+func urlScheme(input string) string {
+	for i := 0; i < len(input); i++ {
+		b := input[i]
+		switch {
+		case b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z':
+		case i > 0 && (b >= '0' && b <= '9' || b == '+' || b == '-' || b == '.'):
+		case i > 0 && b == ':':
+			return strings.ToLower(input[:i])
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+func (r *urlRecord) special() bool {
+	_, ok := urlSpecialSchemes[r.scheme]
+	return ok
+}
+
+func (r *urlRecord) hasCredentials() bool {
+	return r.hasHost && r.host != "" && r.scheme != "file"
+}
+
+func (r *urlRecord) querySet() string {
+	if r.special() {
+		return urlQuerySet + "'"
+	}
+	return urlQuerySet
+}
+
+func (r *urlRecord) href() string {
+	var b strings.Builder
+	b.WriteString(r.scheme + ":")
+	if r.hasHost {
+		b.WriteString("//")
+		if r.username != "" || r.password != "" {
+			b.WriteString(r.username)
+			if r.password != "" {
+				b.WriteString(":" + r.password)
+			}
+			b.WriteString("@")
+		}
+		b.WriteString(r.host)
+		if r.port != "" {
+			b.WriteString(":" + r.port)
+		}
+	} else if !r.opaque && strings.HasPrefix(r.path, "//") {
+		b.WriteString("/.")
+	}
+	b.WriteString(r.path)
+	if r.hasQuery {
+		b.WriteString("?" + r.query)
+	}
+	if r.hasFragment {
+		b.WriteString("#" + r.fragment)
+	}
+	return b.String()
+}
+
+// origin returns the serialized origin, "null" for opaque origins
+func (r *urlRecord) origin() string {
+	switch r.scheme {
+	case "http", "https", "ws", "wss", "ftp":
+		origin := r.scheme + "://" + r.host
+		if r.port != "" {
+			origin += ":" + r.port
+		}
+		return origin
+	case "blob":
+		if inner, ok := parseURL(r.path, nil); ok && (inner.scheme == "http" || inner.scheme == "https") {
+			return inner.origin()
+		}
+	}
+	return "null"
+}
+
+// setProtocol changes the scheme, unless that would turn a special URL into
+// a non-special one or the other way around
+func (r *urlRecord) setProtocol(v string) {
+	scheme := urlScheme(v + ":")
+	if scheme == "" {
+		return
+	}
+	_, special := urlSpecialSchemes[scheme]
+	if special != r.special() || scheme == "file" && (r.username != "" || r.password != "" || r.port != "") {
+		return
+	}
+	r.scheme = scheme
+	if urlSpecialSchemes[scheme] == r.port {
+		r.port = ""
+	}
+}
+
+// setHostname sets the host, reporting whether it is valid
+func (r *urlRecord) setHostname(host string) bool {
+	if strings.ContainsAny(host, " #%/<>?@\\^|") || strings.ContainsAny(strings.Trim(host, "[]"), "[]") {
+		return false
+	}
+	if r.special() {
+		host = strings.ToLower(host)
+		if host == "" && r.scheme != "file" {
+			return false
+		}
+	}
+	if r.scheme == "file" && host == "localhost" {
+		host = ""
+	}
+	r.host = host
+	return true
+}
+
+// setPort sets the port from the leading digits of v, reporting whether
+// there were any and they are in range. Default ports are dropped.
+func (r *urlRecord) setPort(v string) bool {
+	if v == "" {
+		r.port = ""
+		return true
+	}
+	end := 0
+	for end < len(v) && v[end] >= '0' && v[end] <= '9' {
+		end++
+	}
+	n, err := strconv.Atoi(v[:end])
+	if err != nil || n > 65535 {
+		return false
+	}
+	r.port = strconv.Itoa(n)
+	if urlSpecialSchemes[r.scheme] == r.port {
+		r.port = ""
+	}
+	return true
+}
+
+// syncParams refreshes the linked URLSearchParams after the query changed
+func (r *urlRecord) syncParams() {
+	if r.params != nil {
+		r.params.list = parseQuery(r.query)
+	}
+}
+
+// update writes the pairs back to the linked URL, if any
+func (p *searchParams) update() {
+	if p.url == nil {
+		return
+	}
+	p.url.query = serializeQuery(p.list)
+	p.url.hasQuery = p.url.query != ""
+}
+
+// splitHostPort splits host[:port], keeping the brackets of IPv6 hosts
+func splitHostPort(hostport string) (string, string) {
+	i := strings.LastIndexByte(hostport, ':')
+	if i < 0 || i < strings.LastIndexByte(hostport, ']') {
+		return hostport, ""
+	}
+	return hostport[:i], hostport[i+1:]
+}
+
+// removeDotSegments resolves the "." and ".." segments of an absolute path
+func removeDotSegments(path string) string {
+	segments := strings.Split(path[1:], "/")
+	out := make([]string, 0, len(segments))
+	for i, seg := range segments {
+		last := i == len(segments)-1
+		switch strings.ToLower(seg) {
+		case ".", "%2e":
+			if last {
+				out = append(out, "")
+			}
+		case "..", ".%2e", "%2e.", "%2e%2e":
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, seg)
+		}
+	}
+	return "/" + strings.Join(out, "/")
+}
+
+// urlEncode percent-encodes the C0 controls, non-ASCII bytes and characters
+// of set in s, leaving existing escapes alone
+func urlEncode(s, set string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c > 0x7e || strings.IndexByte(set, c) >= 0 {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// escapeLonePercents escapes the '%' signs that do not start an escape,
+// which the URL Standard allows and net/url rejects
+func escapeLonePercents(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && (i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2])) {
+			b.WriteString("%25")
+		} else {
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// percentDecode decodes the valid escapes of s, leaving the others as is
+func percentDecode(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			n, _ := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			b = append(b, byte(n))
+			i += 2
+		} else {
+			b = append(b, s[i])
+		}
+	}
+	return string(b)
+}
+
+// parseQuery parses application/x-www-form-urlencoded pairs
+func parseQuery(query string) [][2]string {
+	var list [][2]string
+	for _, part := range strings.Split(query, "&") {
+		if part == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(part, "=")
+		list = append(list, [2]string{
+			percentDecode(strings.ReplaceAll(name, "+", " ")),
+			percentDecode(strings.ReplaceAll(value, "+", " ")),
+		})
+	}
+	return list
+}
+
+// serializeQuery encodes pairs as application/x-www-form-urlencoded
+func serializeQuery(list [][2]string) string {
+	const hex = "0123456789ABCDEF"
+	encode := func(b *strings.Builder, s string) {
+		for i := 0; i < len(s); i++ {
+			c := s[i]
+			switch {
+			case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("*-._", c) >= 0:
+				b.WriteByte(c)
+			case c == ' ':
+				b.WriteByte('+')
+			default:
+				b.WriteByte('%')
+				b.WriteByte(hex[c>>4])
+				b.WriteByte(hex[c&15])
+			}
+		}
+	}
+	var b strings.Builder
+	for i, pair := range list {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		encode(&b, pair[0])
+		b.WriteByte('=')
+		encode(&b, pair[1])
+	}
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package modules
+
+import (
+	"github.com/dop251/goja"
+)
+
+// SetupUtil sets up the util module, which exposes the formatter behind console
+func SetupUtil(vm *goja.Runtime) error {
+	util := vm.NewObject()
+
+	// util.inspect(value, options) is shared with custom inspect methods,
+	// which receive it as their third argument
+	util.Set("inspect", inspectorOf(vm).inspect)
+
+	// util.format(format, ...args)
+	util.Set("format", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(Format(vm, InspectOptions{Depth: DefaultInspectDepth}, call.Arguments...))
+	})
+
+	// util.formatWithOptions(options, format, ...args)
+	util.Set("formatWithOptions", func(call goja.FunctionCall) goja.Value {
+		opts := inspectOptionsFrom(vm, call.Argument(0), InspectOptions{Depth: DefaultInspectDepth})
+		var args []goja.Value
+		if len(call.Arguments) > 1 {
+			args = call.Arguments[1:]
+		}
+		return vm.ToValue(Format(vm, opts, args...))
+	})
+
+	// util.promisify(original) returns a version of original, a function
+	// taking a Node.js style callback, that returns a promise instead.
+	// Functions can provide their own under util.promisify.custom.
+	symbolFor, _ := goja.AssertFunction(vm.Get("Symbol").ToObject(vm).Get("for"))
+	custom, err := symbolFor(goja.Undefined(), vm.ToValue("nodejs.util.promisify.custom"))
+	if err != nil {
+		return err
+	}
+	customKey := custom.(*goja.Symbol)
+	promisify := vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		original, ok := goja.AssertFunction(call.Argument(0))
+		if !ok {
+			panic(ErrInvalidArgType(vm, "original", "of type function", call.Argument(0)))
+		}
+		obj := call.Argument(0).ToObject(vm)
+		if fn := obj.GetSymbol(customKey); fn != nil && !goja.IsUndefined(fn) {
+			if _, ok := goja.AssertFunction(fn); !ok {
+				panic(ErrInvalidArgType(vm, "util.promisify.custom", "of type function", fn))
+			}
+			return fn
+		}
+		promisified := vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			promise, resolve, reject := vm.NewPromise()
+			callback := vm.ToValue(func(cb goja.FunctionCall) goja.Value {
+				if err := cb.Argument(0); err.ToBoolean() {
+					reject(err)
+				} else {
+					resolve(cb.Argument(1))
+				}
+				return goja.Undefined()
+			})
+			args := append(append([]goja.Value(nil), call.Arguments...), callback)
+			if _, err := original(call.This, args...); err != nil {
+				reject(jsError(vm, err))
+			}
+			return vm.ToValue(promise)
+		}).ToObject(vm)
+		promisified.SetPrototype(obj.Prototype())
+		promisified.DefineDataPropertySymbol(customKey, promisified, goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+		return promisified
+	}).ToObject(vm)
+	promisify.Set("custom", customKey)
+	util.Set("promisify", promisify)
+
+	// Register util module
+	return RegisterModule(vm, "util", util)
+}
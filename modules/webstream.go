@@ -0,0 +1,888 @@
+package modules
+
+import (
+	"github.com/dop251/goja"
+)
+
+// States of a ReadableStream
+const (
+	webStreamReadable = iota
+	webStreamClosed
+	webStreamErrored
+)
+
+// webStreamClasses holds the WHATWG ReadableStream and its reader and
+// controller classes
+type webStreamClasses struct {
+	vm   *goja.Runtime
+	loop AsyncLoop
+
+	stream          *goja.Object
+	reader          *goja.Object
+	controller      *goja.Object
+	uint8Array      *goja.Object
+	streamKey       *goja.Symbol
+	readerKey       *goja.Symbol
+	controllerProto *goja.Object
+}
+
+// readableStream is the state of a ReadableStream. Chunks come from its
+// source, which is either JS (the underlyingSource of the constructor) or
+// Go, like the body of a fetch response.
+type readableStream struct {
+	c   *webStreamClasses
+	obj *goja.Object
+
+	state         int
+	err           goja.Value
+	queue         []goja.Value
+	sizes         []float64
+	queueSize     float64
+	highWaterMark float64
+	size          goja.Callable
+
+	started        bool
+	closeRequested bool
+	pulling        bool
+	pullAgain      bool
+	disturbed      bool
+
+	reader     *streamReader
+	source     webStreamSource
+	controller *goja.Object
+}
+
+// webStreamSource produces the chunks of a ReadableStream. pull is called
+// while the queue is below the high water mark and calls done once it has
+// enqueued, closed or failed; cancel releases the source.
+type webStreamSource struct {
+	pull   func(done func(err goja.Value))
+	cancel func(reason goja.Value, done func(err goja.Value))
+}
+
+// streamReader is the state of a ReadableStreamDefaultReader
+type streamReader struct {
+	stream   *readableStream
+	obj      *goja.Object
+	requests []readRequest
+
+	closed       *goja.Promise
+	resolveClose func(interface{}) error
+	rejectClose  func(interface{}) error
+}
+
+// readRequest receives the outcome of a read: a chunk, the end of the
+// stream or its error
+type readRequest struct {
+	chunk func(v goja.Value)
+	close func()
+	fail  func(err goja.Value)
+}
+
+// webStreamsOf returns the ReadableStream classes of vm, or nil before
+// SetupWebStreams
+func webStreamsOf(vm *goja.Runtime) *webStreamClasses {
+	val := vm.GlobalObject().Get("__webStreams")
+	if val == nil {
+		return nil
+	}
+	c, _ := val.Export().(*webStreamClasses)
+	return c
+}
+
+// SetupWebStreams sets up the ReadableStream globals and the stream/web
+// module
+func SetupWebStreams(vm *goja.Runtime, loop AsyncLoop) error {
+	c := &webStreamClasses{
+		vm:         vm,
+		loop:       loop,
+		uint8Array: vm.Get("Uint8Array").ToObject(vm),
+		streamKey:  goja.NewSymbol("readableStream"),
+		readerKey:  goja.NewSymbol("readableStreamReader"),
+	}
+	c.setupController()
+	c.setupReader()
+	c.setupStream()
+
+	if err := vm.GlobalObject().DefineDataProperty("__webStreams", vm.ToValue(c), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE); err != nil {
+		return err
+	}
+	module := vm.NewObject()
+	for _, ctor := range []*goja.Object{c.stream, c.reader, c.controller} {
+		name := ctor.Get("name").String()
+		vm.GlobalObject().DefineDataProperty(name, ctor, goja.FLAG_TRUE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+		module.Set(name, ctor)
+	}
+	return RegisterModule(vm, "stream/web", module)
+}
+
+// setupStream creates ReadableStream(underlyingSource, strategy)
+func (c *webStreamClasses) setupStream() {
+	vm := c.vm
+	var proto *goja.Object
+	c.stream, proto = newClass(vm, "ReadableStream", nil, func(this *goja.Object, args []goja.Value) {
+		source, _ := argAt(args, 0).(*goja.Object)
+		if source == nil && !isNullish(argAt(args, 0)) {
+			panic(ErrInvalidArgType(vm, "source", "of type object", argAt(args, 0)))
+		}
+		highWaterMark := 1.0
+		var size goja.Callable
+		if source != nil {
+			if typ := source.Get("type"); !isNullish(typ) {
+				if typ.String() != "bytes" {
+					panic(NewNodeError(vm, "TypeError", "ERR_INVALID_ARG_VALUE", "The argument 'source.type' is invalid. Received "+Inspect(vm, typ, InspectOptions{})))
+				}
+				highWaterMark = 0
+			}
+		}
+		if strategy, ok := argAt(args, 1).(*goja.Object); ok {
+			if v := strategy.Get("highWaterMark"); !isNullish(v) {
+				highWaterMark = v.ToFloat()
+				if highWaterMark < 0 || highWaterMark != highWaterMark {
+					panic(NewNodeError(vm, "RangeError", "ERR_INVALID_ARG_VALUE", "The argument 'strategy.highWaterMark' is invalid. Received "+Inspect(vm, v, InspectOptions{})))
+				}
+			}
+			size, _ = goja.AssertFunction(strategy.Get("size"))
+		}
+
+		s := c.initStream(this, highWaterMark)
+		s.size = size
+		method := func(name string) goja.Callable {
+			if source == nil {
+				return nil
+			}
+			fn, _ := goja.AssertFunction(source.Get(name))
+			return fn
+		}
+		// settle calls done with the outcome of a source method, which may
+		// return a promise
+		settle := func(fn goja.Callable, done func(err goja.Value), args ...goja.Value) {
+			if fn == nil {
+				done(nil)
+				return
+			}
+			res, err := fn(source, args...)
+			if err != nil {
+				done(jsError(vm, err))
+				return
+			}
+			thenValue(vm, res, func(goja.Value) { done(nil) }, done)
+		}
+		pull, cancel := method("pull"), method("cancel")
+		s.source = webStreamSource{
+			pull: func(done func(err goja.Value)) {
+				settle(pull, done, s.controller)
+			},
+			cancel: func(reason goja.Value, done func(err goja.Value)) {
+				settle(cancel, done, reason)
+			},
+		}
+
+		// start runs synchronously and may throw; pulling waits for the
+		// promise it returns
+		var started goja.Value = goja.Undefined()
+		if start := method("start"); start != nil {
+			res, err := start(source, s.controller)
+			if err != nil {
+				panic(err)
+			}
+			started = res
+		}
+		thenValue(vm, started, func(goja.Value) {
+			s.started = true
+			s.pullIfNeeded()
+		}, s.error)
+	})
+
+	streamOf := func(this goja.Value) *readableStream {
+		s, ok := c.streamOf(this)
+		if !ok {
+			panic(NewNodeError(vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be of type ReadableStream"))
+		}
+		return s
+	}
+
+	// ReadableStream.from(iterable) streams the values of a sync or async
+	// iterable
+	c.stream.Set("from", func(call goja.FunctionCall) goja.Value {
+		return c.from(call.Argument(0)).obj
+	})
+
+	proto.DefineAccessorProperty("locked", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(streamOf(call.This).reader != nil)
+	}), nil, goja.FLAG_TRUE, goja.FLAG_TRUE)
+	proto.Set("cancel", func(call goja.FunctionCall) goja.Value {
+		s := streamOf(call.This)
+		if s.reader != nil {
+			return c.rejected(c.lockedError())
+		}
+		return c.promise(func(resolve, reject func(goja.Value)) {
+			s.cancel(call.Argument(0), func(err goja.Value) {
+				if err != nil {
+					reject(err)
+				} else {
+					resolve(goja.Undefined())
+				}
+			})
+		})
+	})
+	proto.Set("getReader", func(call goja.FunctionCall) goja.Value {
+		if opts, ok := call.Argument(0).(*goja.Object); ok {
+			if mode := opts.Get("mode"); !isNullish(mode) {
+				panic(NewNodeError(vm, "TypeError", "ERR_INVALID_ARG_VALUE", "The argument 'options.mode' is invalid. Received "+Inspect(vm, mode, InspectOptions{})))
+			}
+		}
+		return c.newReader(streamOf(call.This)).obj
+	})
+	proto.Set("tee", func(call goja.FunctionCall) goja.Value {
+		a, b := streamOf(call.This).tee()
+		return vm.ToValue(vm.NewArray(a.obj, b.obj))
+	})
+	values := func(call goja.FunctionCall) goja.Value {
+		preventCancel := false
+		if opts, ok := call.Argument(0).(*goja.Object); ok {
+			if v := opts.Get("preventCancel"); v != nil {
+				preventCancel = v.ToBoolean()
+			}
+		}
+		return c.iterator(streamOf(call.This), preventCancel)
+	}
+	proto.Set("values", values)
+	proto.SetSymbol(asyncIteratorSymbol(vm), values)
+	proto.DefineDataPropertySymbol(goja.SymToStringTag, vm.ToValue("ReadableStream"), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	if custom := inspectorOf(vm).custom; custom != nil {
+		proto.SetSymbol(custom, func(call goja.FunctionCall) goja.Value {
+			s := streamOf(call.This)
+			state := [...]string{"readable", "closed", "errored"}[s.state]
+			return inspectObject(vm, c.stream, "locked", s.reader != nil, "state", state, "supportsBYOB", false)
+		})
+	}
+}
+
+// setupController creates ReadableStreamDefaultController, which only the
+// stream constructs
+func (c *webStreamClasses) setupController() {
+	vm := c.vm
+	c.controller, c.controllerProto = newClass(vm, "ReadableStreamDefaultController", nil, func(this *goja.Object, args []goja.Value) {
+		panic(NewNodeError(vm, "TypeError", "ERR_ILLEGAL_CONSTRUCTOR", "Illegal constructor"))
+	})
+	proto := c.controllerProto
+
+	streamOf := func(this goja.Value) *readableStream {
+		if s, ok := c.streamOf(this); ok {
+			return s
+		}
+		panic(NewNodeError(vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be of type ReadableStreamDefaultController"))
+	}
+	// canEnqueue throws unless chunks can still be enqueued
+	canEnqueue := func(s *readableStream) {
+		if s.closeRequested || s.state != webStreamReadable {
+			panic(NewNodeError(vm, "TypeError", "ERR_INVALID_STATE", "Invalid state: Controller is already closed"))
+		}
+	}
+
+	proto.Set("enqueue", func(call goja.FunctionCall) goja.Value {
+		s := streamOf(call.This)
+		canEnqueue(s)
+		s.enqueue(call.Argument(0))
+		return goja.Undefined()
+	})
+	proto.Set("close", func(call goja.FunctionCall) goja.Value {
+		s := streamOf(call.This)
+		canEnqueue(s)
+		s.close()
+		return goja.Undefined()
+	})
+	proto.Set("error", func(call goja.FunctionCall) goja.Value {
+		streamOf(call.This).error(call.Argument(0))
+		return goja.Undefined()
+	})
+	proto.DefineAccessorProperty("desiredSize", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		switch s := streamOf(call.This); s.state {
+		case webStreamErrored:
+			return goja.Null()
+		case webStreamClosed:
+			return vm.ToValue(0)
+		default:
+			return vm.ToValue(s.desiredSize())
+		}
+	}), nil, goja.FLAG_TRUE, goja.FLAG_TRUE)
+	proto.DefineDataPropertySymbol(goja.SymToStringTag, vm.ToValue("ReadableStreamDefaultController"), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+}
+
+// setupReader creates ReadableStreamDefaultReader(stream)
+func (c *webStreamClasses) setupReader() {
+	vm := c.vm
+	var proto *goja.Object
+	c.reader, proto = newClass(vm, "ReadableStreamDefaultReader", nil, func(this *goja.Object, args []goja.Value) {
+		s, ok := c.streamOf(argAt(args, 0))
+		if !ok {
+			panic(ErrInvalidArgType(vm, "stream", "an instance of ReadableStream", argAt(args, 0)))
+		}
+		c.initReader(this, s)
+	})
+
+	readerOf := func(this goja.Value) *streamReader {
+		if obj, ok := this.(*goja.Object); ok {
+			if r, ok := exportSymbol(obj, c.readerKey).(*streamReader); ok {
+				return r
+			}
+		}
+		panic(NewNodeError(vm, "TypeError", "ERR_INVALID_THIS", "Value of \"this\" must be of type ReadableStreamDefaultReader"))
+	}
+
+	proto.Set("read", func(call goja.FunctionCall) goja.Value {
+		r := readerOf(call.This)
+		if r.stream == nil {
+			return c.rejected(c.releasedError())
+		}
+		return c.promise(func(resolve, reject func(goja.Value)) {
+			r.read(readRequest{
+				chunk: func(v goja.Value) { resolve(c.result(v, false)) },
+				close: func() { resolve(c.result(goja.Undefined(), true)) },
+				fail:  reject,
+			})
+		})
+	})
+	proto.Set("releaseLock", func(call goja.FunctionCall) goja.Value {
+		readerOf(call.This).release()
+		return goja.Undefined()
+	})
+	proto.Set("cancel", func(call goja.FunctionCall) goja.Value {
+		r := readerOf(call.This)
+		if r.stream == nil {
+			return c.rejected(c.releasedError())
+		}
+		return c.promise(func(resolve, reject func(goja.Value)) {
+			r.stream.cancel(call.Argument(0), func(err goja.Value) {
+				if err != nil {
+					reject(err)
+				} else {
+					resolve(goja.Undefined())
+				}
+			})
+		})
+	})
+	proto.DefineAccessorProperty("closed", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(readerOf(call.This).closed)
+	}), nil, goja.FLAG_TRUE, goja.FLAG_TRUE)
+	proto.DefineDataPropertySymbol(goja.SymToStringTag, vm.ToValue("ReadableStreamDefaultReader"), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+}
+
+// newStream creates a ReadableStream of chunks pulled from a Go source.
+// It starts pulling right away, up to highWaterMark chunks.
+func (c *webStreamClasses) newStream(source webStreamSource, highWaterMark float64) *readableStream {
+	obj := c.vm.NewObject()
+	obj.SetPrototype(c.stream.Get("prototype").ToObject(c.vm))
+	s := c.initStream(obj, highWaterMark)
+	s.source = source
+	s.started = true
+	s.pullIfNeeded()
+	return s
+}
+
+// initStream attaches the stream state and controller to obj
+func (c *webStreamClasses) initStream(obj *goja.Object, highWaterMark float64) *readableStream {
+	s := &readableStream{c: c, obj: obj, highWaterMark: highWaterMark}
+	s.controller = c.vm.NewObject()
+	s.controller.SetPrototype(c.controllerProto)
+	for _, target := range []*goja.Object{obj, s.controller} {
+		target.DefineDataPropertySymbol(c.streamKey, c.vm.ToValue(s), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	}
+	return s
+}
+
+// streamOf returns the stream state of a ReadableStream or its controller
+func (c *webStreamClasses) streamOf(v goja.Value) (*readableStream, bool) {
+	if obj, ok := v.(*goja.Object); ok {
+		s, ok := exportSymbol(obj, c.streamKey).(*readableStream)
+		return s, ok
+	}
+	return nil, false
+}
+
+// newReader locks s to a new reader, throwing if it is already locked
+func (c *webStreamClasses) newReader(s *readableStream) *streamReader {
+	obj := c.vm.NewObject()
+	obj.SetPrototype(c.reader.Get("prototype").ToObject(c.vm))
+	return c.initReader(obj, s)
+}
+
+func (c *webStreamClasses) initReader(obj *goja.Object, s *readableStream) *streamReader {
+	vm := c.vm
+	if s.reader != nil {
+		panic(c.lockedError())
+	}
+	r := &streamReader{stream: s, obj: obj}
+	var resolve, reject func(interface{}) error
+	r.closed, resolve, reject = vm.NewPromise()
+	r.resolveClose, r.rejectClose = resolve, reject
+	// A rejected closed promise is not an unhandled rejection
+	callMethod(vm, vm.ToValue(r.closed).ToObject(vm), "catch", vm.ToValue(func(goja.FunctionCall) goja.Value {
+		return goja.Undefined()
+	}))
+	switch s.state {
+	case webStreamClosed:
+		resolve(goja.Undefined())
+	case webStreamErrored:
+		reject(s.err)
+	}
+	s.reader = r
+	obj.DefineDataPropertySymbol(c.readerKey, vm.ToValue(r), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	return r
+}
+
+// read hands the next chunk, the end of the stream or its error to req.
+// Queued chunks are handed over synchronously.
+func (r *streamReader) read(req readRequest) {
+	s := r.stream
+	s.disturbed = true
+	switch s.state {
+	case webStreamClosed:
+		req.close()
+	case webStreamErrored:
+		req.fail(s.err)
+	default:
+		if len(s.queue) == 0 {
+			r.requests = append(r.requests, req)
+			s.pullIfNeeded()
+			return
+		}
+		chunk := s.queue[0]
+		s.queue = s.queue[1:]
+		s.queueSize -= s.sizes[0]
+		s.sizes = s.sizes[1:]
+		if s.closeRequested && len(s.queue) == 0 {
+			s.finishClose()
+		} else {
+			s.pullIfNeeded()
+		}
+		req.chunk(chunk)
+	}
+}
+
+// release unlocks the stream, failing pending reads
+func (r *streamReader) release() {
+	s := r.stream
+	if s == nil {
+		return
+	}
+	c := s.c
+	err := NewNodeError(c.vm, "TypeError", "ERR_INVALID_STATE", "Invalid state: Reader released")
+	if s.state == webStreamReadable {
+		r.rejectClose(err)
+	} else {
+		var reject func(interface{}) error
+		r.closed, _, reject = c.vm.NewPromise()
+		callMethod(c.vm, c.vm.ToValue(r.closed).ToObject(c.vm), "catch", c.vm.ToValue(func(goja.FunctionCall) goja.Value {
+			return goja.Undefined()
+		}))
+		reject(err)
+	}
+	requests := r.requests
+	r.requests = nil
+	for _, req := range requests {
+		req.fail(NewNodeError(c.vm, "TypeError", "ERR_INVALID_STATE", "Invalid state: Releasing reader"))
+	}
+	s.reader, r.stream = nil, nil
+}
+
+func (s *readableStream) desiredSize() float64 {
+	return s.highWaterMark - s.queueSize
+}
+
+// enqueue hands chunk to a pending read, or queues it
+func (s *readableStream) enqueue(chunk goja.Value) {
+	if r := s.reader; r != nil && len(r.requests) > 0 {
+		req := r.requests[0]
+		r.requests = r.requests[1:]
+		req.chunk(chunk)
+	} else {
+		size := 1.0
+		if s.size != nil {
+			v, err := s.size(goja.Undefined(), chunk)
+			if err != nil {
+				s.error(jsError(s.c.vm, err))
+				panic(err)
+			}
+			size = v.ToFloat()
+		}
+		s.queue = append(s.queue, chunk)
+		s.sizes = append(s.sizes, size)
+		s.queueSize += size
+	}
+	s.pullIfNeeded()
+}
+
+// close ends the stream once its queued chunks are read
+func (s *readableStream) close() {
+	if s.closeRequested || s.state != webStreamReadable {
+		return
+	}
+	s.closeRequested = true
+	if len(s.queue) == 0 {
+		s.finishClose()
+	}
+}
+
+func (s *readableStream) finishClose() {
+	s.state = webStreamClosed
+	if r := s.reader; r != nil {
+		requests := r.requests
+		r.requests = nil
+		r.resolveClose(goja.Undefined())
+		for _, req := range requests {
+			req.close()
+		}
+	}
+}
+
+// error fails the stream with err, discarding its queue
+func (s *readableStream) error(err goja.Value) {
+	if s.state != webStreamReadable {
+		return
+	}
+	s.state, s.err = webStreamErrored, err
+	s.queue, s.sizes, s.queueSize = nil, nil, 0
+	if r := s.reader; r != nil {
+		requests := r.requests
+		r.requests = nil
+		r.rejectClose(err)
+		for _, req := range requests {
+			req.fail(err)
+		}
+	}
+}
+
+// cancel closes the stream, discarding its queue, and cancels the source
+func (s *readableStream) cancel(reason goja.Value, done func(err goja.Value)) {
+	s.disturbed = true
+	switch s.state {
+	case webStreamClosed:
+		done(nil)
+		return
+	case webStreamErrored:
+		done(s.err)
+		return
+	}
+	s.queue, s.sizes, s.queueSize = nil, nil, 0
+	s.finishClose()
+	if s.source.cancel == nil {
+		done(nil)
+		return
+	}
+	s.source.cancel(reason, done)
+}
+
+// pullIfNeeded pulls from the source while reads are waiting or the queue
+// is below the high water mark, one pull at a time
+func (s *readableStream) pullIfNeeded() {
+	if s.state != webStreamReadable || s.closeRequested || !s.started || s.source.pull == nil {
+		return
+	}
+	if (s.reader == nil || len(s.reader.requests) == 0) && s.desiredSize() <= 0 {
+		return
+	}
+	if s.pulling {
+		s.pullAgain = true
+		return
+	}
+	s.pulling = true
+	s.source.pull(func(err goja.Value) {
+		if err != nil {
+			s.error(err)
+			return
+		}
+		s.pulling = false
+		if s.pullAgain {
+			s.pullAgain = false
+			s.pullIfNeeded()
+		}
+	})
+}
+
+// readAll reads the stream to its end and calls done with the bytes of its
+// chunks, which must be Uint8Arrays
+func (s *readableStream) readAll(done func(data []byte, err goja.Value)) {
+	c := s.c
+	r := c.newReader(s)
+	var data []byte
+	var next func()
+	next = func() {
+		for {
+			sync, more := true, false
+			r.read(readRequest{
+				chunk: func(v goja.Value) {
+					b, ok := bufferOf(c.vm).uint8Bytes(v)
+					if !ok {
+						err := NewNodeError(c.vm, "TypeError", "ERR_INVALID_ARG_TYPE", "Received non-Uint8Array chunk")
+						s.cancel(err, func(goja.Value) {})
+						done(nil, err)
+						return
+					}
+					data = append(data, b...)
+					if sync {
+						more = true
+					} else {
+						next()
+					}
+				},
+				close: func() {
+					r.release()
+					done(data, nil)
+				},
+				fail: func(err goja.Value) { done(nil, err) },
+			})
+			sync = false
+			if !more {
+				return
+			}
+		}
+	}
+	next()
+}
+
+// tee splits s into two streams that each receive every chunk. The source
+// is cancelled once both branches are.
+func (s *readableStream) tee() (*readableStream, *readableStream) {
+	c := s.c
+	r := c.newReader(s)
+	var branches [2]*readableStream
+	var canceled [2]bool
+	var reasons [2]goja.Value
+	reading := false
+	var cancelDone []func(err goja.Value)
+
+	pull := func(done func(err goja.Value)) {
+		if reading {
+			done(nil)
+			return
+		}
+		reading = true
+		r.read(readRequest{
+			chunk: func(v goja.Value) {
+				reading = false
+				for i, b := range branches {
+					if !canceled[i] {
+						b.enqueue(v)
+					}
+				}
+				done(nil)
+			},
+			close: func() {
+				reading = false
+				for i, b := range branches {
+					if !canceled[i] {
+						b.close()
+					}
+				}
+				done(nil)
+			},
+			fail: func(err goja.Value) {
+				for _, b := range branches {
+					b.error(err)
+				}
+				done(nil)
+			},
+		})
+	}
+	for i := range branches {
+		i := i
+		branches[i] = c.newStream(webStreamSource{
+			pull: pull,
+			cancel: func(reason goja.Value, done func(err goja.Value)) {
+				canceled[i], reasons[i] = true, reason
+				cancelDone = append(cancelDone, done)
+				if !canceled[1-i] {
+					return
+				}
+				s.cancel(c.vm.ToValue(c.vm.NewArray(reasons[0], reasons[1])), func(err goja.Value) {
+					for _, done := range cancelDone {
+						done(err)
+					}
+				})
+			},
+		}, 1)
+	}
+	return branches[0], branches[1]
+}
+
+// from creates a stream of the values of a sync or async iterable
+func (c *webStreamClasses) from(iterable goja.Value) *readableStream {
+	vm := c.vm
+	obj, ok := iterable.(*goja.Object)
+	if !ok {
+		panic(ErrInvalidArgType(vm, "iterable", "an instance of Iterable", iterable))
+	}
+	if s, ok := c.streamOf(obj); ok {
+		return s
+	}
+	method, isAsync := obj.GetSymbol(asyncIteratorSymbol(vm)), true
+	if _, ok := goja.AssertFunction(method); !ok {
+		method, isAsync = obj.GetSymbol(goja.SymIterator), false
+	}
+	fn, ok := goja.AssertFunction(method)
+	if !ok {
+		panic(ErrInvalidArgType(vm, "iterable", "an instance of Iterable", iterable))
+	}
+	it, err := fn(obj)
+	if err != nil {
+		panic(err)
+	}
+	iterator := it.ToObject(vm)
+
+	var s *readableStream
+	s = c.newStream(webStreamSource{
+		pull: func(done func(err goja.Value)) {
+			res, err := c.callIterator(iterator, "next")
+			if err != nil {
+				done(err)
+				return
+			}
+			step := func(res goja.Value) {
+				r, ok := res.(*goja.Object)
+				if !ok {
+					done(vm.NewTypeError("The iterator result must be an object"))
+					return
+				}
+				if r.Get("done").ToBoolean() {
+					s.close()
+					done(nil)
+					return
+				}
+				thenValue(vm, r.Get("value"), func(v goja.Value) {
+					s.enqueue(v)
+					done(nil)
+				}, done)
+			}
+			if isAsync {
+				thenValue(vm, res, step, done)
+			} else {
+				step(res)
+			}
+		},
+		cancel: func(reason goja.Value, done func(err goja.Value)) {
+			if _, ok := goja.AssertFunction(iterator.Get("return")); !ok {
+				done(nil)
+				return
+			}
+			res, err := c.callIterator(iterator, "return", reason)
+			if err != nil {
+				done(err)
+				return
+			}
+			thenValue(vm, res, func(goja.Value) { done(nil) }, done)
+		},
+	}, 0)
+	return s
+}
+
+// callIterator calls a method of an iterator, returning what it throws as
+// a JS value
+func (c *webStreamClasses) callIterator(iterator *goja.Object, name string, args ...goja.Value) (goja.Value, goja.Value) {
+	fn, ok := goja.AssertFunction(iterator.Get(name))
+	if !ok {
+		return nil, c.vm.NewTypeError("iterator." + name + " is not a function")
+	}
+	res, err := fn(iterator, args...)
+	if err != nil {
+		return nil, jsError(c.vm, err)
+	}
+	return res, nil
+}
+
+// iterator returns the async iterator of s. Returning early cancels the
+// stream unless preventCancel is set.
+func (c *webStreamClasses) iterator(s *readableStream, preventCancel bool) goja.Value {
+	vm := c.vm
+	r := c.newReader(s)
+	finished := false
+	iter := vm.NewObject()
+	iter.Set("next", func(call goja.FunctionCall) goja.Value {
+		if finished || r.stream == nil {
+			return c.resolved(c.result(goja.Undefined(), true))
+		}
+		return c.promise(func(resolve, reject func(goja.Value)) {
+			r.read(readRequest{
+				chunk: func(v goja.Value) { resolve(c.result(v, false)) },
+				close: func() {
+					finished = true
+					r.release()
+					resolve(c.result(goja.Undefined(), true))
+				},
+				fail: func(err goja.Value) {
+					finished = true
+					r.release()
+					reject(err)
+				},
+			})
+		})
+	})
+	iter.Set("return", func(call goja.FunctionCall) goja.Value {
+		value := call.Argument(0)
+		if finished || r.stream == nil {
+			return c.resolved(c.result(value, true))
+		}
+		finished = true
+		stream := r.stream
+		r.release()
+		if preventCancel {
+			return c.resolved(c.result(value, true))
+		}
+		return c.promise(func(resolve, reject func(goja.Value)) {
+			stream.cancel(value, func(err goja.Value) {
+				if err != nil {
+					reject(err)
+				} else {
+					resolve(c.result(value, true))
+				}
+			})
+		})
+	})
+	iter.SetSymbol(asyncIteratorSymbol(vm), func(call goja.FunctionCall) goja.Value {
+		return call.This
+	})
+	return iter
+}
+
+// result creates an iterator result
+func (c *webStreamClasses) result(value goja.Value, done bool) *goja.Object {
+	res := c.vm.NewObject()
+	res.Set("value", value)
+	res.Set("done", done)
+	return res
+}
+
+// promise returns a promise settled by run
+func (c *webStreamClasses) promise(run func(resolve, reject func(goja.Value))) goja.Value {
+	promise, resolve, reject := c.vm.NewPromise()
+	run(func(v goja.Value) { resolve(v) }, func(err goja.Value) { reject(err) })
+	return c.vm.ToValue(promise)
+}
+
+func (c *webStreamClasses) resolved(v goja.Value) goja.Value {
+	return c.promise(func(resolve, _ func(goja.Value)) { resolve(v) })
+}
+
+func (c *webStreamClasses) rejected(err goja.Value) goja.Value {
+	return c.promise(func(_, reject func(goja.Value)) { reject(err) })
+}
+
+func (c *webStreamClasses) lockedError() *goja.Object {
+	return NewNodeError(c.vm, "TypeError", "ERR_INVALID_STATE", "Invalid state: ReadableStream is locked")
+}
+
+func (c *webStreamClasses) releasedError() *goja.Object {
+	return NewNodeError(c.vm, "TypeError", "ERR_INVALID_STATE", "Invalid state: The reader is not attached to a stream")
+}
+
+// newChunk returns a Uint8Array holding data, the chunk type of byte
+// streams
+func (c *webStreamClasses) newChunk(data []byte) goja.Value {
+	obj, err := c.vm.New(c.uint8Array, c.vm.ToValue(c.vm.NewArrayBuffer(data)))
+	if err != nil {
+		panic(err)
+	}
+	return obj
+}
@@ -2,18 +2,22 @@ package repl
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
 
+	"github.com/dop251/goja"
+	"gojs/modules"
 	"gojs/runtime"
 )
 
 const PROMPT = "> "
 const CONTINUE_PROMPT = "... "
 
-// Start starts the REPL
-func Start(in io.Reader, out io.Writer) {
+// Start starts the REPL and returns the exit code once input ends, .exit is
+// entered or the script calls process.exit
+func Start(in io.Reader, out io.Writer) int {
 	scanner := bufio.NewScanner(in)
 	rt := runtime.New()
 
@@ -38,7 +42,9 @@ func Start(in io.Reader, out io.Writer) {
 
 		// Handle special commands
 		if !isMultiline && strings.HasPrefix(line, ".") {
-			handleCommand(line, out)
+			if !handleCommand(line, out) {
+				return 0
+			}
 			continue
 		}
 
@@ -53,25 +59,30 @@ func Start(in io.Reader, out io.Writer) {
 				multilineBuffer.Reset()
 				isMultiline = false
 
-				evaluateCode(rt, code, out)
+				if code, exited := evaluateCode(rt, code, out); exited {
+					return code
+				}
 			}
 		} else {
 			// Check if this starts a multiline input
 			if needsMoreInput(line) {
 				isMultiline = true
 				multilineBuffer.WriteString(line)
-			} else {
-				evaluateCode(rt, line, out)
+			} else if code, exited := evaluateCode(rt, line, out); exited {
+				return code
 			}
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
 		fmt.Fprintf(out, "Error reading input: %v\n", err)
+		return 1
 	}
+	return 0
 }
 
-func handleCommand(cmd string, out io.Writer) {
+// handleCommand runs a REPL command and reports whether the REPL should continue
+func handleCommand(cmd string, out io.Writer) bool {
 	switch cmd {
 	case ".help":
 		fmt.Fprintf(out, "Commands:\n")
@@ -80,32 +91,45 @@ func handleCommand(cmd string, out io.Writer) {
 		fmt.Fprintf(out, "  .clear   Clear the console\n")
 	case ".exit":
 		fmt.Fprintf(out, "Goodbye!\n")
-		// Exit is handled by returning from Start()
-		panic("exit")
+		return false
 	case ".clear":
 		fmt.Fprint(out, "\033[H\033[2J")
 	default:
 		fmt.Fprintf(out, "Unknown command: %s\n", cmd)
 		fmt.Fprintf(out, "Type .help for available commands\n")
 	}
+	return true
 }
 
-func evaluateCode(rt *runtime.Runtime, code string, out io.Writer) {
+// evaluateCode runs code and prints its result. If the code called
+// process.exit it returns the exit code and true.
+func evaluateCode(rt *runtime.Runtime, code string, out io.Writer) (int, bool) {
 	code = strings.TrimSpace(code)
 	if code == "" {
-		return
+		return 0, false
 	}
 
 	val, err := rt.Eval(code)
 	if err != nil {
-		fmt.Fprintf(out, "Error: %v\n", err)
-		return
+		var exitErr *runtime.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.Code, true
+		}
+		fmt.Fprintf(out, "Error: %s\n", modules.ErrorString(err))
+		return 0, false
 	}
 
-	// Print the result (unless it's undefined)
-	if val != nil && val.String() != "undefined" {
-		fmt.Fprintf(out, "%v\n", val.String())
+	// Print the result (unless it's undefined) the way console.log shows values
+	if val != nil && !goja.IsUndefined(val) {
+		opts := modules.InspectOptions{Depth: modules.DefaultInspectDepth, Colors: modules.UseColors(out)}
+		var result string
+		if ex := rt.VM.Try(func() { result = modules.Inspect(rt.VM, val, opts) }); ex != nil {
+			fmt.Fprintf(out, "Error: %s\n", modules.ErrorString(ex))
+			return 0, false
+		}
+		fmt.Fprintln(out, result)
 	}
+	return 0, false
 }
 
 // needsMoreInput checks if the line needs more input (basic heuristic)
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/dop251/goja"
+	"gojs/modules"
 )
 
 // Task represents a task in the event loop
@@ -13,13 +14,20 @@ type Task struct {
 	Callback func()
 	Time     time.Time
 	Index    int
+	seq      uint64
 }
 
 // TaskQueue is a priority queue for tasks
 type TaskQueue []*Task
 
-func (tq TaskQueue) Len() int           { return len(tq) }
-func (tq TaskQueue) Less(i, j int) bool { return tq[i].Time.Before(tq[j].Time) }
+func (tq TaskQueue) Len() int { return len(tq) }
+func (tq TaskQueue) Less(i, j int) bool {
+	// Tasks due at the same time run in the order they were scheduled
+	if tq[i].Time.Equal(tq[j].Time) {
+		return tq[i].seq < tq[j].seq
+	}
+	return tq[i].Time.Before(tq[j].Time)
+}
 func (tq TaskQueue) Swap(i, j int) {
 	tq[i], tq[j] = tq[j], tq[i]
 	tq[i].Index = i
@@ -45,16 +53,31 @@ func (tq *TaskQueue) Pop() interface{} {
 
 // EventLoop represents the JavaScript event loop
 type EventLoop struct {
-	vm            *goja.Runtime
-	macrotasks    TaskQueue
-	microtasks    []func()
-	timers        map[int]*Task
-	intervals     map[int]*Task
-	timerID       int
-	mutex         sync.Mutex
-	running       bool
-	stopChan      chan struct{}
-	pendingTasks  int
+	vm           *goja.Runtime
+	macrotasks   TaskQueue
+	microtasks   []func()
+	timers       map[int]*Task
+	intervals    map[int]*Task
+	timerID      int
+	mutex        sync.Mutex
+	running      bool
+	stopChan     chan struct{}
+	wakeup       chan struct{}
+	pendingTasks int
+	refs         int
+	seq          uint64
+	enqueueJob   func(callback goja.Value)
+	checkpoint   func() error
+	uncaught     func(r interface{})
+	ticks        []func()
+	trampoline   goja.Callable
+	entryTask    *goja.Object
+	entry        func()
+	inEntry      bool
+	fatal        error
+	closers      map[int]func()
+	closerID     int
+	closed       bool
 }
 
 // NewEventLoop creates a new event loop
@@ -65,8 +88,10 @@ func NewEventLoop(vm *goja.Runtime) *EventLoop {
 		microtasks: make([]func(), 0),
 		timers:     make(map[int]*Task),
 		intervals:  make(map[int]*Task),
+		closers:    make(map[int]func()),
 		timerID:    1,
 		stopChan:   make(chan struct{}),
+		wakeup:     make(chan struct{}, 1),
 	}
 	heap.Init(&el.macrotasks)
 	return el
@@ -79,6 +104,219 @@ func (el *EventLoop) QueueMicrotask(fn func()) {
 	el.microtasks = append(el.microtasks, fn)
 }
 
+// queueJob adds a JS function to the VM's promise job queue, so it is
+// ordered together with promise reactions and await continuations
+func (el *EventLoop) queueJob(callback goja.Value) {
+	if el.enqueueJob != nil {
+		el.enqueueJob(callback)
+		return
+	}
+	fn, _ := goja.AssertFunction(callback)
+	el.QueueMicrotask(func() {
+		if _, err := fn(goja.Undefined()); err != nil {
+			if isUncatchable(err) {
+				panic(err)
+			}
+			el.reportException(err)
+		}
+	})
+}
+
+// NextTick queues fn to run once the current JS entry finishes, ahead of any
+// promise reactions it triggered. Ticks queued by promise reactions run once
+// the promise jobs are drained, like in Node.js. Must be called on the loop
+// goroutine.
+func (el *EventLoop) NextTick(fn func()) {
+	el.ticks = append(el.ticks, fn)
+}
+
+// runTicks drains the nextTick queue, including ticks queued while draining
+func (el *EventLoop) runTicks() {
+	for len(el.ticks) > 0 && el.fatalErr() == nil {
+		tick := el.ticks[0]
+		el.ticks = el.ticks[1:]
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					if isUncatchable(r) {
+						panic(r)
+					}
+					el.reportException(r)
+				}
+			}()
+			tick()
+		}()
+	}
+}
+
+// enter runs fn as a single top-level entry into the VM. The nextTick queue is
+// drained after fn returns but before goja flushes its promise job queue.
+// JS exceptions and uncatchable errors raised by fn are returned.
+func (el *EventLoop) enter(fn func()) error {
+	if el.trampoline == nil {
+		if err := el.setupTrampoline(); err != nil {
+			return err
+		}
+	}
+
+	el.entry = fn
+	_, err := el.trampoline(goja.Undefined(), el.entryTask)
+
+	// goja drains its job queue once the outermost entry returns. Ticks the
+	// jobs queued run in entries of their own, which drain the jobs they
+	// queue in turn. Scheduling them from Go instead would make goja drain
+	// the job queue in the middle of the reaction that queued them.
+	for err == nil && !el.inEntry && len(el.ticks) > 0 && el.fatalErr() == nil {
+		el.entry = func() {}
+		_, err = el.trampoline(goja.Undefined(), el.entryTask)
+	}
+	return err
+}
+
+// setupTrampoline creates the functions used by enter. The trampoline is a JS
+// function so that goja sees a frame on its call stack while the entry runs
+// and defers draining its job queue until the entry returns. Both frames are
+// named as internal, so they are left out of stack traces.
+func (el *EventLoop) setupTrampoline() error {
+	prg, err := goja.Compile(modules.InternalPrefix+"loop", "(function processTask(runTask) { runTask(); })", true)
+	if err != nil {
+		return err
+	}
+	val, err := el.vm.RunProgram(prg)
+	if err != nil {
+		return err
+	}
+	el.trampoline, _ = goja.AssertFunction(val)
+
+	task := el.vm.ToValue(func(goja.FunctionCall) goja.Value {
+		fn := el.entry
+		el.entry = nil
+
+		outer := el.inEntry
+		el.inEntry = true
+		defer func() {
+			el.inEntry = outer
+		}()
+
+		fn()
+		el.runTicks()
+		return goja.Undefined()
+	}).ToObject(el.vm)
+	task.DefineDataProperty("name", el.vm.ToValue(modules.InternalPrefix+"runTask"), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	el.entryTask = task
+
+	return nil
+}
+
+// terminate stops the loop; Run returns err once the current task finishes
+func (el *EventLoop) terminate(err error) {
+	el.mutex.Lock()
+	if el.fatal == nil {
+		el.fatal = err
+	}
+	el.mutex.Unlock()
+
+	el.wake()
+}
+
+// fatalErr returns the error the loop was terminated with, if any. The
+// error is set from other goroutines by Interrupt and the execution limits.
+func (el *EventLoop) fatalErr() error {
+	el.mutex.Lock()
+	defer el.mutex.Unlock()
+	return el.fatal
+}
+
+// takeFatal returns and clears the error the loop was terminated with
+func (el *EventLoop) takeFatal() error {
+	el.mutex.Lock()
+	defer el.mutex.Unlock()
+	err := el.fatal
+	el.fatal = nil
+	return err
+}
+
+// clearTasks discards every pending timer, interval, macrotask and microtask
+func (el *EventLoop) clearTasks() {
+	el.mutex.Lock()
+	defer el.mutex.Unlock()
+
+	el.macrotasks = el.macrotasks[:0]
+	el.microtasks = nil
+	el.timers = make(map[int]*Task)
+	el.intervals = make(map[int]*Task)
+	el.pendingTasks = 0
+}
+
+// AddCloser registers fn to release a host resource, such as a listener or a
+// child process, when the run is halted. The returned function unregisters
+// it and should be called once the resource is released. fn may be called
+// on any goroutine, and right away if the run was halted already. It is safe
+// to call from any goroutine.
+func (el *EventLoop) AddCloser(fn func()) func() {
+	el.mutex.Lock()
+	if el.closed {
+		el.mutex.Unlock()
+		fn()
+		return func() {}
+	}
+	id := el.closerID
+	el.closerID++
+	el.closers[id] = fn
+	el.mutex.Unlock()
+
+	return func() {
+		el.mutex.Lock()
+		defer el.mutex.Unlock()
+		delete(el.closers, id)
+	}
+}
+
+// closeResources calls every closer added with AddCloser, and any added
+// later
+func (el *EventLoop) closeResources() {
+	el.mutex.Lock()
+	closers := el.closers
+	el.closers = make(map[int]func())
+	el.closed = true
+	el.mutex.Unlock()
+
+	for _, fn := range closers {
+		fn()
+	}
+}
+
+// hasPendingWork reports whether Run would find anything left to do
+func (el *EventLoop) hasPendingWork() bool {
+	el.mutex.Lock()
+	defer el.mutex.Unlock()
+	return len(el.macrotasks) > 0 || el.refs > 0
+}
+
+// isUncatchable reports whether a recovered panic is an error JS cannot catch,
+// such as the interrupt raised by process.exit
+func isUncatchable(r interface{}) bool {
+	switch r.(type) {
+	case *goja.InterruptedError, *goja.StackOverflowError:
+		return true
+	}
+	return false
+}
+
+// reportException passes an exception that escaped a task to the uncaught
+// exception handler, or prints it if there is none
+func (el *EventLoop) reportException(r interface{}) {
+	if el.uncaught != nil {
+		el.uncaught(r)
+		return
+	}
+	if err, ok := r.(*goja.Exception); ok {
+		println("Uncaught exception:", modules.CleanStack(err.String()))
+	} else {
+		println("Panic in task:", r)
+	}
+}
+
 // SetTimeout schedules a function to run after a delay
 func (el *EventLoop) SetTimeout(callback func(), delay time.Duration) int {
 	el.mutex.Lock()
@@ -92,13 +330,21 @@ func (el *EventLoop) SetTimeout(callback func(), delay time.Duration) int {
 		Time:     time.Now().Add(delay),
 	}
 
-	heap.Push(&el.macrotasks, task)
+	el.pushTask(task)
 	el.timers[id] = task
 	el.pendingTasks++
+	el.wake()
 
 	return id
 }
 
+// pushTask adds a task to the macrotask queue. The caller must hold the mutex.
+func (el *EventLoop) pushTask(task *Task) {
+	el.seq++
+	task.seq = el.seq
+	heap.Push(&el.macrotasks, task)
+}
+
 // ClearTimeout cancels a timeout
 func (el *EventLoop) ClearTimeout(id int) {
 	el.mutex.Lock()
@@ -123,19 +369,21 @@ func (el *EventLoop) SetInterval(callback func(), delay time.Duration) int {
 
 	var repeatFunc func()
 	repeatFunc = func() {
-		callback()
-
-		// Reschedule the interval
-		el.mutex.Lock()
-		if _, exists := el.intervals[id]; exists {
-			task := &Task{
-				Callback: repeatFunc,
-				Time:     time.Now().Add(delay),
+		// Reschedule the interval even if the callback throws: only
+		// clearInterval stops it
+		defer func() {
+			el.mutex.Lock()
+			if _, exists := el.intervals[id]; exists {
+				task := &Task{
+					Callback: repeatFunc,
+					Time:     time.Now().Add(delay),
+				}
+				el.pushTask(task)
+				el.intervals[id] = task
 			}
-			heap.Push(&el.macrotasks, task)
-			el.intervals[id] = task
-		}
-		el.mutex.Unlock()
+			el.mutex.Unlock()
+		}()
+		callback()
 	}
 
 	task := &Task{
@@ -143,13 +391,61 @@ func (el *EventLoop) SetInterval(callback func(), delay time.Duration) int {
 		Time:     time.Now().Add(delay),
 	}
 
-	heap.Push(&el.macrotasks, task)
+	el.pushTask(task)
 	el.intervals[id] = task
 	el.pendingTasks++
+	el.wake()
 
 	return id
 }
 
+// RunOnLoop schedules fn to run on the loop goroutine as a macrotask.
+// It is safe to call from any goroutine and is the only supported way for
+// Go code running elsewhere to touch the VM.
+func (el *EventLoop) RunOnLoop(fn func(*goja.Runtime)) {
+	el.mutex.Lock()
+	task := &Task{
+		Callback: func() {
+			fn(el.vm)
+		},
+		Time: time.Now(),
+	}
+	el.pushTask(task)
+	el.pendingTasks++
+	el.mutex.Unlock()
+
+	el.wake()
+}
+
+// Ref registers a pending host operation. While any references are
+// outstanding Run keeps waiting for work instead of returning.
+// It is safe to call from any goroutine.
+func (el *EventLoop) Ref() {
+	el.mutex.Lock()
+	defer el.mutex.Unlock()
+	el.refs++
+}
+
+// Unref releases a reference taken with Ref. Callers that deliver a result
+// should call RunOnLoop before Unref so the loop cannot exit in between.
+func (el *EventLoop) Unref() {
+	el.mutex.Lock()
+	if el.refs > 0 {
+		el.refs--
+	}
+	el.mutex.Unlock()
+
+	el.wake()
+}
+
+// wake interrupts a Run that is blocked waiting for work
+func (el *EventLoop) wake() {
+	select {
+	case el.wakeup <- struct{}{}:
+	default:
+	}
+}
+
 // ClearInterval cancels an interval
 func (el *EventLoop) ClearInterval(id int) {
 	el.mutex.Lock()
@@ -164,9 +460,12 @@ func (el *EventLoop) ClearInterval(id int) {
 	}
 }
 
-// processMicrotasks executes all pending microtasks
+// processMicrotasks executes all pending microtasks. Promise jobs live on the
+// VM's own queue, which goja drains whenever control returns from JS, so every
+// microtask that calls into the VM also flushes the promise reactions it
+// triggers before the next one starts.
 func (el *EventLoop) processMicrotasks() {
-	for {
+	for el.fatalErr() == nil {
 		el.mutex.Lock()
 		if len(el.microtasks) == 0 {
 			el.mutex.Unlock()
@@ -180,8 +479,19 @@ func (el *EventLoop) processMicrotasks() {
 	}
 }
 
-// Run starts the event loop
-func (el *EventLoop) Run() {
+// drainMicrotasks processes all pending microtasks and then runs the
+// microtask checkpoint, which may end the run with an error
+func (el *EventLoop) drainMicrotasks() error {
+	el.processMicrotasks()
+	if el.checkpoint != nil {
+		return el.checkpoint()
+	}
+	return nil
+}
+
+// Run starts the event loop. It returns when there is no more work, or with
+// an error if a task failed in a way that must terminate the run.
+func (el *EventLoop) Run() error {
 	el.running = true
 	defer func() {
 		el.running = false
@@ -189,39 +499,76 @@ func (el *EventLoop) Run() {
 
 	for {
 		// Process all microtasks first
-		el.processMicrotasks()
+		if err := el.drainMicrotasks(); err != nil {
+			return err
+		}
+		if err := el.fatalErr(); err != nil {
+			return err
+		}
 
 		// Get next macrotask
 		el.mutex.Lock()
 		if len(el.macrotasks) == 0 {
+			waiting := el.refs > 0
 			el.mutex.Unlock()
-			break
+			if !waiting {
+				break
+			}
+			// Host operations are still outstanding; block until one of
+			// them schedules work or releases its reference
+			select {
+			case <-el.wakeup:
+			case <-el.stopChan:
+				return nil
+			}
+			if err := el.fatalErr(); err != nil {
+				return err
+			}
+			continue
 		}
 
-		task := heap.Pop(&el.macrotasks).(*Task)
-		el.mutex.Unlock()
-
-		// Wait until it's time to execute
-		now := time.Now()
-		if task.Time.After(now) {
-			time.Sleep(task.Time.Sub(now))
+		// Wait until it's time to execute, waking early if an earlier
+		// task gets scheduled in the meantime
+		task := el.macrotasks[0]
+		if wait := time.Until(task.Time); wait > 0 {
+			el.mutex.Unlock()
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-el.wakeup:
+				timer.Stop()
+			case <-el.stopChan:
+				timer.Stop()
+				return nil
+			}
+			continue
 		}
 
+		heap.Pop(&el.macrotasks)
+		el.mutex.Unlock()
+
 		// Execute the task
 		func() {
 			defer func() {
 				if r := recover(); r != nil {
 					// Handle panic in task
-					if err, ok := r.(*goja.Exception); ok {
-						println("Uncaught exception:", err.String())
-					} else {
-						println("Panic in task:", r)
-					}
+					el.reportException(r)
 				}
 			}()
-			task.Callback()
+			if err := el.enter(task.Callback); err != nil && el.fatalErr() == nil {
+				// A stack overflow cannot be caught by the script
+				if isUncatchable(err) {
+					el.terminate(err)
+					return
+				}
+				el.reportException(err)
+			}
 		}()
 
+		if err := el.fatalErr(); err != nil {
+			return err
+		}
+
 		// Decrement pending tasks if it was a timeout (not interval)
 		el.mutex.Lock()
 		isInterval := false
@@ -237,13 +584,17 @@ func (el *EventLoop) Run() {
 		el.mutex.Unlock()
 
 		// Process microtasks after each macrotask
-		el.processMicrotasks()
+		if err := el.drainMicrotasks(); err != nil {
+			return err
+		}
 	}
+
+	return nil
 }
 
 // RunUntilIdle runs the event loop until there are no more tasks
-func (el *EventLoop) RunUntilIdle() {
-	el.Run()
+func (el *EventLoop) RunUntilIdle() error {
+	return el.Run()
 }
 
 // Stop stops the event loop
@@ -0,0 +1,96 @@
+package runtime_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"gojs/internal/jstest"
+	"gojs/runtime"
+)
+
+func TestTimersRunInOrder(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		setTimeout(() => console.log('c'), 20);
+		setTimeout(() => console.log('a'), 0);
+		setImmediate(() => console.log('b'));
+		const id = setInterval(() => { console.log('i'); clearInterval(id); }, 5);
+	`, "a\nb\ni\nc\n")
+}
+
+func TestRunOnLoopFromGoroutine(t *testing.T) {
+	out := jstest.Capture(t, func() {
+		rt := runtime.New()
+		loop := rt.EventLoop
+
+		loop.Ref()
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			loop.RunOnLoop(func(vm *goja.Runtime) {
+				if _, err := vm.RunString(`console.log('from goroutine')`); err != nil {
+					t.Error(err)
+				}
+			})
+			loop.Unref()
+		}()
+
+		if _, err := rt.RunScript(`console.log('script')`, "test.js"); err != nil {
+			t.Error(err)
+		}
+	})
+	if want := "script\nfrom goroutine\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+func TestRunOnLoopFromManyGoroutines(t *testing.T) {
+	rt := runtime.New()
+	loop := rt.EventLoop
+
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		loop.Ref()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			loop.RunOnLoop(func(vm *goja.Runtime) {
+				if _, err := vm.RunString(`count++`); err != nil {
+					t.Error(err)
+				}
+			})
+			loop.Unref()
+		}()
+	}
+
+	if _, err := rt.RunScript(`var count = 0`, "test.js"); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if count := rt.VM.Get("count").ToInteger(); count != n {
+		t.Errorf("count = %d, want %d", count, n)
+	}
+}
+
+func TestUnrefLetsTheLoopExit(t *testing.T) {
+	rt := runtime.New()
+	loop := rt.EventLoop
+
+	loop.Ref()
+	go loop.Unref()
+
+	done := make(chan error)
+	go func() {
+		_, err := rt.RunScript(`1`, "test.js")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the loop kept running after Unref")
+	}
+}
@@ -0,0 +1,168 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	goruntime "runtime"
+	"runtime/metrics"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// heapCheckInterval is how often the heap size is sampled while a run with
+// Options.MaxHeapBytes is in progress
+const heapCheckInterval = 10 * time.Millisecond
+
+// heapMetric is the runtime/metrics sample holding the bytes occupied by heap
+// objects, including garbage not collected yet
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// TimeoutError is returned when a run takes longer than Options.Timeout
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("script execution timed out after %v", e.Timeout)
+}
+
+// MemoryLimitError is returned when the heap grows beyond Options.MaxHeapBytes.
+// HeapBytes is the heap of the whole process, not only of the runtime.
+type MemoryLimitError struct {
+	Limit     uint64
+	HeapBytes uint64
+}
+
+func (e *MemoryLimitError) Error() string {
+	return fmt.Sprintf("heap size of %d bytes exceeds the limit of %d bytes", e.HeapBytes, e.Limit)
+}
+
+// StackOverflowError is returned when the call stack grows beyond
+// Options.MaxCallStackSize
+type StackOverflowError struct {
+	Limit int
+}
+
+func (e *StackOverflowError) Error() string {
+	return fmt.Sprintf("maximum call stack size of %d exceeded", e.Limit)
+}
+
+// InterruptedError is returned when the run was stopped by Runtime.Interrupt
+type InterruptedError struct {
+	Reason interface{}
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("script execution interrupted: %v", e.Reason)
+}
+
+// Interrupt stops the script running in rt, discards its pending timers and
+// tasks and closes its servers, sockets, child processes and watchers. It is
+// safe to call from any goroutine. The current run returns an
+// *InterruptedError carrying reason, and so does every later run: an
+// interrupted runtime cannot be used again.
+func (rt *Runtime) Interrupt(reason interface{}) {
+	rt.halt(&InterruptedError{Reason: reason})
+}
+
+// halt ends the runtime with err, releasing the host resources scripts hold.
+// Only the first call has an effect.
+func (rt *Runtime) halt(err error) {
+	rt.limitMu.Lock()
+	if rt.limitErr != nil {
+		rt.limitMu.Unlock()
+		return
+	}
+	rt.limitErr = err
+	rt.limitMu.Unlock()
+
+	rt.VM.Interrupt(err)
+	rt.EventLoop.clearTasks()
+	rt.EventLoop.closeResources()
+	rt.EventLoop.terminate(err)
+}
+
+// haltErr returns the error the runtime was halted with, or nil
+func (rt *Runtime) haltErr() error {
+	rt.limitMu.Lock()
+	defer rt.limitMu.Unlock()
+	return rt.limitErr
+}
+
+// watchLimits enforces Options.Timeout and Options.MaxHeapBytes until the
+// returned function is called. Nested runs share the outermost watch.
+func (rt *Runtime) watchLimits() func() {
+	if rt.watching || (rt.opts.Timeout <= 0 && rt.opts.MaxHeapBytes == 0) {
+		return func() {}
+	}
+	rt.watching = true
+
+	var timer *time.Timer
+	if timeout := rt.opts.Timeout; timeout > 0 {
+		timer = time.AfterFunc(timeout, func() {
+			rt.halt(&TimeoutError{Timeout: timeout})
+		})
+	}
+
+	done := make(chan struct{})
+	if rt.opts.MaxHeapBytes > 0 {
+		go rt.watchHeap(rt.opts.MaxHeapBytes, done)
+	}
+
+	return func() {
+		rt.watching = false
+		if timer != nil {
+			timer.Stop()
+		}
+		close(done)
+	}
+}
+
+// watchHeap halts the runtime once the heap stays above limit after a
+// garbage collection, checking until done is closed
+func (rt *Runtime) watchHeap(limit uint64, done chan struct{}) {
+	ticker := time.NewTicker(heapCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		if heapBytes() <= limit {
+			continue
+		}
+		// Only live objects count; garbage may simply not be collected yet
+		goruntime.GC()
+		if used := heapBytes(); used > limit {
+			rt.halt(&MemoryLimitError{Limit: limit, HeapBytes: used})
+			return
+		}
+	}
+}
+
+// heapBytes returns the number of bytes occupied by heap objects
+func heapBytes() uint64 {
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// limitError converts the error a run ended with into the typed error of the
+// limit that stopped it, if any
+func (rt *Runtime) limitError(err error) error {
+	if haltErr := rt.haltErr(); haltErr != nil {
+		return haltErr
+	}
+	var overflow *goja.StackOverflowError
+	if errors.As(err, &overflow) {
+		return &StackOverflowError{Limit: rt.opts.MaxCallStackSize}
+	}
+	return err
+}
@@ -0,0 +1,133 @@
+package runtime_test
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gojs/internal/jstest"
+	"gojs/runtime"
+)
+
+func TestTimeoutStopsRunawayScripts(t *testing.T) {
+	for name, script := range map[string]string{
+		"script": `while (true) {}`,
+		"timer":  `setTimeout(() => { while (true) {} }, 0)`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := jstest.RunWith(t, runtime.Options{Timeout: 50 * time.Millisecond}, script)
+			var timeout *runtime.TimeoutError
+			if !errors.As(err, &timeout) || timeout.Timeout != 50*time.Millisecond {
+				t.Fatalf("err = %v, want a *TimeoutError", err)
+			}
+		})
+	}
+}
+
+func TestTimeoutClearsPendingTimers(t *testing.T) {
+	start := time.Now()
+	out, err := jstest.RunWith(t, runtime.Options{Timeout: 50 * time.Millisecond}, `
+		setTimeout(() => {}, 60000);
+		process.on('exit', () => console.log('exit'));
+	`)
+	var timeout *runtime.TimeoutError
+	if !errors.As(err, &timeout) {
+		t.Fatalf("err = %v, want a *TimeoutError", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("run took %v", elapsed)
+	}
+	if out != "" {
+		t.Errorf("output = %q, want no exit event", out)
+	}
+}
+
+func TestTimeoutAppliesToEachRun(t *testing.T) {
+	rt := runtime.NewWithOptions(runtime.Options{Timeout: 100 * time.Millisecond})
+	for i := 0; i < 3; i++ {
+		if _, err := rt.RunScript(`setTimeout(() => {}, 60)`, "test.js"); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+}
+
+func TestTimeoutClosesServers(t *testing.T) {
+	rt := runtime.NewWithOptions(runtime.Options{Timeout: 100 * time.Millisecond})
+	var addrs []string
+	rt.VM.Set("reportAddress", func(addr string) { addrs = append(addrs, addr) })
+
+	_, err := rt.RunScript(`
+		for (const name of ['net', 'http']) {
+			const server = require(name).createServer(() => {});
+			server.listen(0, '127.0.0.1', () => reportAddress('127.0.0.1:' + server.address().port));
+		}
+	`, "test.js")
+	var timeout *runtime.TimeoutError
+	if !errors.As(err, &timeout) {
+		t.Fatalf("err = %v, want a *TimeoutError", err)
+	}
+	if len(addrs) != 2 {
+		t.Fatalf("addresses = %v", addrs)
+	}
+	for _, addr := range addrs {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			t.Errorf("%s is still listening after the timeout", addr)
+		}
+	}
+}
+
+func TestMaxCallStackSize(t *testing.T) {
+	dir := t.TempDir()
+	jstest.WriteFiles(t, dir, map[string]string{
+		"main.js": `function f() { f(); } f();`,
+		"so.js":   `function f() { f(); } f();`,
+	})
+
+	for name, run := range map[string]func(rt *runtime.Runtime) error{
+		"script": func(rt *runtime.Runtime) error {
+			_, err := rt.RunScript(`function f() { f(); } f();`, "test.js")
+			return err
+		},
+		"file": func(rt *runtime.Runtime) error {
+			return rt.RunFile(filepath.Join(dir, "main.js"))
+		},
+		// require must not turn the overflow into an Error scripts can catch
+		"require": func(rt *runtime.Runtime) error {
+			_, err := rt.RunScript(`try { require(`+jstest.Quote(filepath.Join(dir, "so.js"))+`); } catch (e) {}`, "test.js")
+			return err
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := run(runtime.NewWithOptions(runtime.Options{MaxCallStackSize: 100}))
+			var overflow *runtime.StackOverflowError
+			if !errors.As(err, &overflow) || overflow.Limit != 100 {
+				t.Fatalf("err = %v, want a *StackOverflowError with limit 100", err)
+			}
+		})
+	}
+}
+
+func TestMaxHeapBytes(t *testing.T) {
+	_, err := jstest.RunWith(t, runtime.Options{MaxHeapBytes: 1, Timeout: 5 * time.Second}, `setInterval(() => {}, 1)`)
+	var memory *runtime.MemoryLimitError
+	if !errors.As(err, &memory) || memory.Limit != 1 {
+		t.Fatalf("err = %v, want a *MemoryLimitError with limit 1", err)
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	rt := runtime.New()
+	time.AfterFunc(20*time.Millisecond, func() { rt.Interrupt("stop") })
+
+	_, err := rt.RunScript(`while (true) {}`, "test.js")
+	var interrupted *runtime.InterruptedError
+	if !errors.As(err, &interrupted) || interrupted.Reason != "stop" {
+		t.Fatalf("err = %v, want an *InterruptedError", err)
+	}
+	if _, err := rt.Eval(`1`); !errors.As(err, &interrupted) {
+		t.Errorf("a later run returned %v, want an *InterruptedError", err)
+	}
+}
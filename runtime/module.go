@@ -0,0 +1,73 @@
+package runtime
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dop251/goja"
+	"gojs/modules"
+)
+
+// unsettledTopLevelAwaitCode is the exit code used when the event loop runs
+// out of work while the entry module is still waiting on top-level await
+const unsettledTopLevelAwaitCode = 13
+
+// RunModule runs the ES module at path and its dependencies, then the event
+// loop until it has no more work. A non-zero exit code is returned as an
+// *ExitError.
+func (rt *Runtime) RunModule(path string) error {
+	if err := rt.haltErr(); err != nil {
+		return err
+	}
+	defer rt.watchLimits()()
+
+	vm := rt.VM
+
+	var promise *goja.Promise
+	var loadErr error
+	err := rt.EventLoop.enter(func() {
+		promise, loadErr = modules.ImportFile(vm, path)
+		if loadErr != nil || promise.State() != goja.PromiseStatePending {
+			return
+		}
+
+		// A module that fails after top-level await ends the run
+		then, _ := goja.AssertFunction(vm.ToValue(promise).ToObject(vm).Get("then"))
+		onRejected := func(call goja.FunctionCall) goja.Value {
+			rt.EventLoop.terminate(rt.moduleError(call.Argument(0)))
+			return goja.Undefined()
+		}
+		if _, err := then(vm.ToValue(promise), goja.Undefined(), vm.ToValue(onRejected)); err != nil {
+			panic(err)
+		}
+	})
+	if err == nil {
+		err = loadErr
+	}
+	if err == nil && promise.State() == goja.PromiseStateRejected {
+		err = rt.moduleError(promise.Result())
+	}
+	if err != nil {
+		return rt.exit(rt.runError(err))
+	}
+
+	if err := rt.runLoop(); err != nil {
+		return rt.exit(rt.runError(err))
+	}
+
+	if rt.exitErr == nil && promise.State() == goja.PromiseStatePending {
+		fmt.Fprintln(os.Stderr, "Warning: Detected unsettled top-level await")
+		rt.process.Set("exitCode", unsettledTopLevelAwaitCode)
+	}
+
+	return rt.exit(nil)
+}
+
+// moduleError converts the reason a module failed with into the exception
+// returned to the caller
+func (rt *Runtime) moduleError(reason goja.Value) error {
+	if ex := rt.VM.Try(func() { panic(reason) }); ex != nil {
+		return ex
+	}
+	return fmt.Errorf("%s", describeError(reason))
+}
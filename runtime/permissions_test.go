@@ -0,0 +1,113 @@
+package runtime_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gojs/internal/jstest"
+	"gojs/modules"
+	"gojs/runtime"
+)
+
+// accessDenied returns a script that prints the code and permission of the
+// error thrown by expr, or "allowed"
+func accessDenied(expr string) string {
+	return `try { ` + expr + `; console.log('allowed'); } catch (e) { console.log(e.code, e.permission); }`
+}
+
+func TestPermissions(t *testing.T) {
+	dir := t.TempDir()
+	readable := filepath.Join(dir, "readable")
+	writable := filepath.Join(dir, "writable")
+	jstest.WriteFiles(t, dir, map[string]string{
+		"secret":          "secret",
+		"readable/lib.js": "exports.ok = true;",
+		"writable/.keep":  "",
+	})
+	opts := runtime.Options{Permissions: &modules.Permissions{
+		AllowRead:  []string{readable},
+		AllowWrite: []string{writable},
+	}}
+	js := jstest.Quote
+
+	tests := []struct {
+		name, expr, want string
+	}{
+		{"read granted", "require('fs').readdirSync(" + js(readable) + ")", "allowed"},
+		{"read denied", "require('fs').readFileSync(" + js(filepath.Join(dir, "secret")) + ")", "ERR_ACCESS_DENIED FileSystemRead"},
+		{"read through ..", "require('fs').readFileSync(" + js(readable+"/../secret") + ")", "ERR_ACCESS_DENIED FileSystemRead"},
+		{"write granted", "require('fs').writeFileSync(" + js(filepath.Join(writable, "a")) + ", 'a')", "allowed"},
+		{"write denied", "require('fs').writeFileSync(" + js(filepath.Join(readable, "a")) + ", 'a')", "ERR_ACCESS_DENIED FileSystemWrite"},
+		{"env denied", "process.env.HOME", "ERR_ACCESS_DENIED Environment"},
+		{"require granted", "require(" + js(filepath.Join(readable, "lib.js")) + ")", "allowed"},
+		{"require needs read", "require(" + js(filepath.Join(dir, "secret")) + ")", "ERR_ACCESS_DENIED FileSystemRead"},
+		{"child process denied", "require('child_process').spawn('true')", "ERR_ACCESS_DENIED ChildProcess"},
+		{"exec denied", "require('child_process').execSync('true')", "ERR_ACCESS_DENIED ChildProcess"},
+		{"symlink out of the grant", "require('fs').symlinkSync(" + js(filepath.Join(dir, "escaped")) + ", " + js(filepath.Join(writable, "link")) + ")", "ERR_ACCESS_DENIED FileSystemWrite"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jstest.ExpectOutputWith(t, opts, accessDenied(tt.expr), tt.want+"\n")
+		})
+	}
+}
+
+func TestPermissionsFollowDanglingSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	writable := filepath.Join(dir, "writable")
+	if err := os.Mkdir(writable, 0755); err != nil {
+		t.Fatal(err)
+	}
+	escaped := filepath.Join(dir, "escaped")
+	link := filepath.Join(writable, "link")
+	if err := os.Symlink(escaped, link); err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+	opts := runtime.Options{Permissions: &modules.Permissions{AllowWrite: []string{writable}}}
+
+	jstest.ExpectOutputWith(t, opts, accessDenied("require('fs').writeFileSync("+jstest.Quote(link)+", 'x')"), "ERR_ACCESS_DENIED FileSystemWrite\n")
+	if _, err := os.Stat(escaped); err == nil {
+		t.Error("the write escaped the granted directory")
+	}
+}
+
+func TestPermissionsHideDeniedPaths(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secret, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := runtime.Options{Permissions: &modules.Permissions{}}
+	jstest.ExpectOutputWith(t, opts, `console.log(require('fs').existsSync(`+jstest.Quote(secret)+`))`, "false\n")
+}
+
+func TestPermissionsDenyRequire(t *testing.T) {
+	dir := t.TempDir()
+	jstest.WriteFiles(t, dir, map[string]string{"lib.js": "", "lib.mjs": ""})
+	opts := runtime.Options{Permissions: &modules.Permissions{
+		AllowRead:   []string{dir},
+		DenyRequire: true,
+	}}
+	jstest.ExpectOutputWith(t, opts, `
+		console.log(typeof require('path').join);
+		`+accessDenied("require("+jstest.Quote(filepath.Join(dir, "lib.js"))+")")+`
+		import(`+jstest.Quote(filepath.Join(dir, "lib.mjs"))+`).catch((e) => console.log(e.code, e.permission));
+	`, "function\nERR_ACCESS_DENIED Require\nERR_ACCESS_DENIED Require\n")
+}
+
+func TestPermissionsAllowEnv(t *testing.T) {
+	t.Setenv("GOJS_TEST", "value")
+	opts := runtime.Options{Permissions: &modules.Permissions{AllowEnv: true}}
+	jstest.ExpectOutputWith(t, opts, `console.log(process.env.GOJS_TEST)`, "value\n")
+}
+
+func TestPermissionsRejectPromises(t *testing.T) {
+	dir := t.TempDir()
+	opts := runtime.Options{Permissions: &modules.Permissions{AllowRead: []string{filepath.Join(dir, "readable")}}}
+	jstest.ExpectOutputWith(t, opts, `
+		require('fs').promises.readFile(`+jstest.Quote(filepath.Join(dir, "secret"))+`).then(
+			() => console.log('resolved'),
+			(e) => console.log(e.code, e.permission));
+	`, "ERR_ACCESS_DENIED FileSystemRead\n")
+}
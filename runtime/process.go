@@ -0,0 +1,311 @@
+package runtime
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	goruntime "runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"gojs/modules"
+)
+
+// Version is the runtime version reported by process.version
+const Version = "v1.0.0"
+
+// ExitError is returned by RunFile, RunScript and Eval when the script ends
+// with a non-zero exit code, either through process.exit or process.exitCode
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("process exited with code %d", e.Code)
+}
+
+// setupProcess installs the global process object, an EventEmitter
+func (rt *Runtime) setupProcess() error {
+	vm := rt.VM
+	process, err := modules.NewEventEmitter(vm)
+	if err != nil {
+		return err
+	}
+	rt.process = process
+
+	// Static information about the host
+	execPath, err := os.Executable()
+	if err != nil {
+		execPath = os.Args[0]
+	}
+	process.Set("execPath", execPath)
+	process.Set("argv0", os.Args[0])
+	process.Set("argv", []string{execPath})
+	process.Set("execArgv", []string{})
+	process.Set("pid", os.Getpid())
+	process.Set("ppid", os.Getppid())
+	process.Set("platform", modules.NodePlatform(goruntime.GOOS))
+	process.Set("arch", modules.NodeArch(goruntime.GOARCH))
+	process.Set("version", Version)
+	versions := vm.NewObject()
+	versions.Set("gojs", strings.TrimPrefix(Version, "v"))
+	versions.Set("go", goruntime.Version())
+	process.Set("versions", versions)
+	process.Set("env", vm.NewDynamicObject(&envObject{vm: vm}))
+	process.Set("exitCode", goja.Undefined())
+
+	// process.cwd / process.chdir
+	process.Set("cwd", func(call goja.FunctionCall) goja.Value {
+		dir, err := os.Getwd()
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return vm.ToValue(dir)
+	})
+
+	process.Set("chdir", func(call goja.FunctionCall) goja.Value {
+		dir, ok := call.Argument(0).Export().(string)
+		if !ok {
+			panic(modules.ErrInvalidArgType(vm, "directory", "of type string", call.Argument(0)))
+		}
+		if err := os.Chdir(dir); err != nil {
+			cwd, _ := os.Getwd()
+			panic(modules.NewSystemError(vm, err, "chdir", cwd, dir))
+		}
+		return goja.Undefined()
+	})
+
+	process.Set("uptime", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(time.Since(rt.startTime).Seconds())
+	})
+
+	// process.hrtime([previous]) returns [seconds, nanoseconds]
+	hrtime := vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		elapsed := time.Since(rt.startTime).Nanoseconds()
+		if len(call.Arguments) > 0 && !goja.IsUndefined(call.Arguments[0]) {
+			var prev []int64
+			if err := vm.ExportTo(call.Arguments[0], &prev); err != nil || len(prev) != 2 {
+				panic(vm.NewTypeError("hrtime argument must be an array of [seconds, nanoseconds]"))
+			}
+			elapsed -= prev[0]*int64(time.Second) + prev[1]
+		}
+		return vm.ToValue([]int64{elapsed / int64(time.Second), elapsed % int64(time.Second)})
+	}).ToObject(vm)
+	hrtime.Set("bigint", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(big.NewInt(time.Since(rt.startTime).Nanoseconds()))
+	})
+	process.Set("hrtime", hrtime)
+
+	// process.nextTick runs callbacks before promise reactions
+	process.Set("nextTick", func(call goja.FunctionCall) goja.Value {
+		fn, ok := goja.AssertFunction(call.Argument(0))
+		if !ok {
+			panic(modules.ErrInvalidArgType(vm, "callback", "of type function", call.Argument(0)))
+		}
+
+		args := make([]goja.Value, 0)
+		if len(call.Arguments) > 1 {
+			args = append(args, call.Arguments[1:]...)
+		}
+
+		rt.EventLoop.NextTick(func() {
+			if _, err := fn(goja.Undefined(), args...); err != nil {
+				panic(err)
+			}
+		})
+
+		return goja.Undefined()
+	})
+
+	// process.exit ends the run immediately, closing servers, sockets, child
+	// processes and watchers; 'exit' listeners still run
+	process.Set("exit", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) > 0 && !goja.IsUndefined(call.Arguments[0]) {
+			process.Set("exitCode", call.Arguments[0])
+		}
+
+		if rt.exitErr == nil {
+			rt.exitErr = &ExitError{Code: rt.exitCode()}
+			rt.emitProcessEvent("exit", vm.ToValue(rt.exitErr.Code))
+			rt.EventLoop.terminate(rt.exitErr)
+			rt.EventLoop.closeResources()
+		} else {
+			// Called again, e.g. from an 'exit' listener: only the code changes
+			rt.exitErr.Code = rt.exitCode()
+		}
+
+		vm.Interrupt(rt.exitErr)
+		return goja.Undefined()
+	})
+
+	return vm.Set("process", process)
+}
+
+// SetArgs sets the arguments that follow the script path in process.argv
+func (rt *Runtime) SetArgs(args []string) {
+	rt.args = args
+}
+
+// setScriptPath updates process.argv for the script about to run
+func (rt *Runtime) setScriptPath(path string) {
+	execPath := rt.process.Get("execPath").String()
+	argv := append([]string{execPath, path}, rt.args...)
+	rt.process.Set("argv", argv)
+}
+
+// exitCode returns the current value of process.exitCode as an integer
+func (rt *Runtime) exitCode() int {
+	code := rt.process.Get("exitCode")
+	if code == nil || goja.IsUndefined(code) || goja.IsNull(code) {
+		return 0
+	}
+	return int(code.ToInteger())
+}
+
+// emitProcessEvent emits name on the process object and reports whether it
+// had listeners. Exceptions thrown by listeners are reported as uncaught.
+func (rt *Runtime) emitProcessEvent(name string, args ...goja.Value) bool {
+	handled, err := modules.Emit(rt.VM, rt.process, name, args...)
+	if err != nil {
+		if isUncatchable(err) {
+			panic(err)
+		}
+		rt.EventLoop.reportException(err)
+	}
+	return handled
+}
+
+// emitFromLoop emits a process event from Go code running outside of any JS
+// call, such as the microtask checkpoint
+func (rt *Runtime) emitFromLoop(name string, args ...goja.Value) bool {
+	handled := false
+	if err := rt.EventLoop.enter(func() {
+		handled = rt.emitProcessEvent(name, args...)
+	}); err != nil && !isUncatchable(err) {
+		rt.EventLoop.reportException(err)
+	}
+	return handled
+}
+
+// uncaughtException handles an exception that escaped a timer, callback or
+// tick. It emits the process 'uncaughtException' event and terminates the run
+// with the exception if no listener handled it, or with the error a listener
+// threw.
+func (rt *Runtime) uncaughtException(r interface{}) {
+	if rt.exitErr != nil || rt.EventLoop.fatalErr() != nil {
+		return
+	}
+
+	ex := rt.toException(r)
+	modules.CleanErrorStack(rt.VM, ex.Value())
+	handled := false
+	err := rt.EventLoop.enter(func() {
+		var emitErr error
+		handled, emitErr = modules.Emit(rt.VM, rt.process, "uncaughtException", ex.Value(), rt.VM.ToValue("uncaughtException"))
+		if emitErr != nil {
+			panic(emitErr)
+		}
+	})
+	switch {
+	case rt.exitErr != nil:
+		// A listener called process.exit, which terminated the loop already
+	case err != nil:
+		rt.EventLoop.terminate(err)
+	case !handled:
+		rt.EventLoop.terminate(ex)
+	}
+}
+
+// toException converts a value recovered from a task into a JS exception
+func (rt *Runtime) toException(r interface{}) *goja.Exception {
+	var val goja.Value
+	switch r := r.(type) {
+	case *goja.Exception:
+		return r
+	case goja.Value:
+		val = r
+	case error:
+		val = rt.VM.NewGoError(r)
+	default:
+		val = rt.VM.NewGoError(fmt.Errorf("%v", r))
+	}
+	return rt.VM.Try(func() {
+		panic(val)
+	})
+}
+
+// exit finishes a run that ended normally or with err: it emits 'exit' unless
+// process.exit already did, and converts a non-zero exit code into an ExitError
+func (rt *Runtime) exit(err error) error {
+	// A halted runtime runs no more JS, not even 'exit' listeners
+	if haltErr := rt.haltErr(); haltErr != nil {
+		return haltErr
+	}
+
+	if rt.exitErr != nil {
+		if rt.exitErr.Code == 0 {
+			return nil
+		}
+		return rt.exitErr
+	}
+
+	code := rt.exitCode()
+	if err != nil && code == 0 {
+		code = 1
+	}
+	rt.exitErr = &ExitError{Code: code}
+	rt.emitFromLoop("exit", rt.VM.ToValue(code))
+
+	if err != nil {
+		return err
+	}
+	// process.exit inside an 'exit' listener may have changed the code
+	if rt.exitErr.Code != 0 {
+		return rt.exitErr
+	}
+	return nil
+}
+
+// envObject exposes the host environment as process.env
+type envObject struct {
+	vm *goja.Runtime
+}
+
+func (e *envObject) Get(key string) goja.Value {
+	modules.CheckEnv(e.vm, key)
+	if value, ok := os.LookupEnv(key); ok {
+		return e.vm.ToValue(value)
+	}
+	return goja.Undefined()
+}
+
+func (e *envObject) Set(key string, val goja.Value) bool {
+	modules.CheckEnv(e.vm, key)
+	return os.Setenv(key, val.String()) == nil
+}
+
+func (e *envObject) Has(key string) bool {
+	modules.CheckEnv(e.vm, key)
+	_, ok := os.LookupEnv(key)
+	return ok
+}
+
+func (e *envObject) Delete(key string) bool {
+	modules.CheckEnv(e.vm, key)
+	return os.Unsetenv(key) == nil
+}
+
+func (e *envObject) Keys() []string {
+	modules.CheckEnv(e.vm, "*")
+	environ := os.Environ()
+	keys := make([]string, 0, len(environ))
+	for _, kv := range environ {
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			keys = append(keys, kv[:i])
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
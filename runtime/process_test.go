@@ -0,0 +1,177 @@
+package runtime_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gojs/internal/jstest"
+	"gojs/runtime"
+)
+
+func TestProcessArgv(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "main.js")
+	source := `console.log(process.argv[1] === ` + jstest.Quote(script) + `, JSON.stringify(process.argv.slice(2)));`
+	if err := os.WriteFile(script, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var err error
+	out := jstest.Capture(t, func() {
+		rt := runtime.New()
+		rt.SetArgs([]string{"a", "b"})
+		err = rt.RunFile(script)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "true [\"a\",\"b\"]\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+func TestProcessExit(t *testing.T) {
+	out, err := jstest.Run(t, `
+		process.on('exit', (code) => console.log('exit', code));
+		setTimeout(() => console.log('never'), 10);
+		console.log('before');
+		process.exit(3);
+		console.log('after');
+	`)
+	var exitErr *runtime.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 3 {
+		t.Fatalf("err = %v, want exit code 3", err)
+	}
+	if want := "before\nexit 3\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+func TestProcessExitCode(t *testing.T) {
+	out, err := jstest.Run(t, `
+		process.exitCode = 2;
+		process.on('beforeExit', (code) => console.log('beforeExit', code));
+		process.on('exit', (code) => console.log('exit', code));
+	`)
+	var exitErr *runtime.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 2 {
+		t.Fatalf("err = %v, want exit code 2", err)
+	}
+	if want := "beforeExit 2\nexit 2\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+func TestBeforeExitCanScheduleWork(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		let rounds = 0;
+		process.on('beforeExit', () => {
+			console.log('beforeExit', rounds);
+			if (rounds++ < 2) {
+				setTimeout(() => console.log('more work'), 0);
+			}
+		});
+	`, "beforeExit 0\nmore work\nbeforeExit 1\nmore work\nbeforeExit 2\n")
+}
+
+func TestProcessEnv(t *testing.T) {
+	t.Setenv("GOJS_TEST_VAR", "from go")
+	jstest.ExpectOutput(t, `
+		console.log(process.env.GOJS_TEST_VAR, 'GOJS_TEST_VAR' in process.env);
+		process.env.GOJS_TEST_VAR = 'from js';
+		delete process.env.GOJS_TEST_UNSET;
+		console.log(process.env.GOJS_TEST_UNSET);
+	`, "from go true\nundefined\n")
+	if got := os.Getenv("GOJS_TEST_VAR"); got != "from js" {
+		t.Errorf("GOJS_TEST_VAR = %q, want it set by the script", got)
+	}
+}
+
+func TestProcessChdir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	jstest.ExpectOutput(t, `
+		const start = process.cwd();
+		process.chdir(`+jstest.Quote(dir)+`);
+		console.log(process.cwd() === `+jstest.Quote(dir)+`);
+		process.chdir(start);
+		console.log(process.cwd() === start);
+	`, "true\ntrue\n")
+}
+
+func TestProcessInfo(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		console.log(typeof process.pid, typeof process.platform, typeof process.version);
+		console.log(typeof process.hrtime.bigint(), process.hrtime().length);
+		const start = process.hrtime.bigint();
+		console.log(process.hrtime.bigint() >= start);
+	`, "number string string\nbigint 2\ntrue\n")
+}
+
+func TestNextTickRunsBeforePromiseReactions(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		Promise.resolve().then(() => console.log('promise'));
+		queueMicrotask(() => console.log('microtask'));
+		process.nextTick((a, b) => console.log('tick', a, b), 1, 2);
+		console.log('sync');
+	`, "sync\ntick 1 2\npromise\nmicrotask\n")
+}
+
+func TestNextTickFromPromiseReactions(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		Promise.resolve().then(() => {
+			console.log('p1');
+			process.nextTick(() => console.log('tick from p1'));
+			Promise.resolve().then(() => console.log('p1 inner'));
+		});
+		Promise.resolve().then(() => console.log('p2'));
+		process.nextTick(() => console.log('tick'));
+	`, "tick\np1\np2\np1 inner\ntick from p1\n")
+}
+
+func TestUncaughtExceptionEndsTheRun(t *testing.T) {
+	out, err := jstest.Run(t, `
+		process.on('exit', code => console.log('exit', code));
+		setTimeout(() => console.log('never'), 20);
+		setTimeout(() => { throw new Error('boom'); }, 0);
+	`)
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("err = %v, want the uncaught exception", err)
+	}
+	if want := "exit 1\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+func TestUncaughtExceptionListener(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		process.on('uncaughtException', (err, origin) => console.log(err.message, origin));
+		setTimeout(() => { throw new Error('timer'); }, 0);
+		process.nextTick(() => { throw new Error('tick'); });
+		queueMicrotask(() => { throw new Error('microtask'); });
+		setTimeout(() => console.log('done'), 10);
+	`, "tick uncaughtException\nmicrotask uncaughtException\ntimer uncaughtException\ndone\n")
+}
+
+func TestIntervalSurvivesUncaughtException(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		process.on('uncaughtException', (err) => console.log('caught', err.message));
+		let ticks = 0;
+		const id = setInterval(() => {
+			ticks++;
+			console.log('tick', ticks);
+			if (ticks < 3) throw new Error('boom' + ticks);
+			clearInterval(id);
+		}, 1);
+	`, "tick 1\ncaught boom1\ntick 2\ncaught boom2\ntick 3\n")
+}
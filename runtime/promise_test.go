@@ -0,0 +1,50 @@
+package runtime_test
+
+import (
+	"testing"
+
+	"gojs/internal/jstest"
+)
+
+func TestPromiseIsNative(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		console.log(typeof Promise.any, typeof Promise.allSettled, typeof Promise.withResolvers);
+		Promise.any([Promise.reject(1), Promise.resolve(2)]).then((v) => console.log('any', v));
+		const { promise, resolve } = Promise.withResolvers();
+		promise.then((v) => console.log('resolved', v));
+		resolve(3);
+	`, "function function function\nresolved 3\nany 2\n")
+}
+
+func TestMicrotasksShareOneQueue(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		setTimeout(() => console.log('timeout'), 0);
+		queueMicrotask(() => console.log('q1'));
+		Promise.resolve().then(() => console.log('p1')).then(() => console.log('p2'));
+		(async () => { await null; console.log('a1'); await null; console.log('a2'); })();
+		queueMicrotask(() => { console.log('q2'); Promise.resolve().then(() => console.log('p3')); });
+		console.log('sync');
+	`, "sync\nq1\np1\na1\nq2\np2\na2\np3\ntimeout\n")
+
+	// Jobs queued by a callback run after the jobs queued before them
+	jstest.ExpectOutput(t, `
+		queueMicrotask(() => { console.log('q1'); queueMicrotask(() => console.log('q1b')); });
+		Promise.resolve().then(() => console.log('p'));
+		queueMicrotask(() => console.log('q2'));
+	`, "q1\np\nq2\nq1b\n")
+	jstest.ExpectOutput(t, `
+		Promise.resolve().then(() => { console.log('p1'); Promise.resolve().then(() => console.log('p2')); });
+		queueMicrotask(() => console.log('q'));
+		(async () => { await null; console.log('a'); })();
+	`, "p1\nq\na\np2\n")
+}
+
+func TestMicrotasksRunBetweenTimers(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		setTimeout(() => {
+			console.log('t1');
+			Promise.resolve().then(() => console.log('p1'));
+		}, 0);
+		setTimeout(() => console.log('t2'), 0);
+	`, "t1\np1\nt2\n")
+}
@@ -0,0 +1,199 @@
+package runtime
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dop251/goja"
+	"gojs/modules"
+)
+
+// UnhandledRejectionMode controls what happens to promise rejections that
+// have no handler by the time the microtask queue is drained
+type UnhandledRejectionMode string
+
+const (
+	// UnhandledRejectionsThrow emits 'unhandledRejection' and fails the run
+	// if no listener handled it. This is the default.
+	UnhandledRejectionsThrow UnhandledRejectionMode = "throw"
+	// UnhandledRejectionsStrict fails the run even if listeners are present
+	UnhandledRejectionsStrict UnhandledRejectionMode = "strict"
+	// UnhandledRejectionsWarn emits 'unhandledRejection' and always prints a warning
+	UnhandledRejectionsWarn UnhandledRejectionMode = "warn"
+	// UnhandledRejectionsNone emits 'unhandledRejection' and stays silent
+	UnhandledRejectionsNone UnhandledRejectionMode = "none"
+)
+
+// ParseUnhandledRejectionMode validates a --unhandled-rejections value
+func ParseUnhandledRejectionMode(s string) (UnhandledRejectionMode, error) {
+	switch mode := UnhandledRejectionMode(s); mode {
+	case UnhandledRejectionsThrow, UnhandledRejectionsStrict, UnhandledRejectionsWarn, UnhandledRejectionsNone:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid unhandled rejections mode %q (expected strict, warn, none or throw)", s)
+}
+
+// UnhandledRejectionError is returned when a rejected promise was never handled
+type UnhandledRejectionError struct {
+	Reason goja.Value
+	Stack  string
+}
+
+func (e *UnhandledRejectionError) Error() string {
+	return "Uncaught (in promise) " + e.Stack
+}
+
+// rejectionTracker records promise rejections reported by goja until the
+// next microtask checkpoint decides whether they went unhandled
+type rejectionTracker struct {
+	mode        UnhandledRejectionMode
+	pending     []*goja.Promise
+	handledLate []*goja.Promise
+
+	// reported holds the promises whose rejection was reported unhandled,
+	// so that a handler attached later emits 'rejectionHandled'. It is a
+	// WeakSet: a promise nothing else references can no longer be handled.
+	vm             *goja.Runtime
+	reported       *goja.Object
+	reportedAdd    goja.Callable
+	reportedDelete goja.Callable
+}
+
+func newRejectionTracker(vm *goja.Runtime) (*rejectionTracker, error) {
+	reported, err := vm.New(vm.Get("WeakSet"))
+	if err != nil {
+		return nil, err
+	}
+	add, _ := goja.AssertFunction(reported.Get("add"))
+	remove, _ := goja.AssertFunction(reported.Get("delete"))
+	if add == nil || remove == nil {
+		return nil, fmt.Errorf("WeakSet is not available")
+	}
+	return &rejectionTracker{
+		mode:           UnhandledRejectionsThrow,
+		vm:             vm,
+		reported:       reported,
+		reportedAdd:    add,
+		reportedDelete: remove,
+	}, nil
+}
+
+// track is installed as the VM's PromiseRejectionTracker
+func (t *rejectionTracker) track(p *goja.Promise, operation goja.PromiseRejectionOperation) {
+	switch operation {
+	case goja.PromiseRejectionReject:
+		t.pending = append(t.pending, p)
+	case goja.PromiseRejectionHandle:
+		for i, pending := range t.pending {
+			if pending == p {
+				t.pending = append(t.pending[:i], t.pending[i+1:]...)
+				return
+			}
+		}
+		// A handler was attached after the rejection had already been reported
+		if removed, err := t.reportedDelete(t.reported, t.vm.ToValue(p)); err == nil && removed.ToBoolean() {
+			t.handledLate = append(t.handledLate, p)
+		}
+	}
+}
+
+// markReported remembers that the rejection of p was reported unhandled
+func (t *rejectionTracker) markReported(p *goja.Promise) error {
+	_, err := t.reportedAdd(t.reported, t.vm.ToValue(p))
+	return err
+}
+
+// take returns and clears the rejections collected since the last checkpoint
+func (t *rejectionTracker) take() (unhandled, handled []*goja.Promise) {
+	unhandled, t.pending = t.pending, nil
+	handled, t.handledLate = t.handledLate, nil
+	return unhandled, handled
+}
+
+// SetUnhandledRejectionMode changes how unhandled promise rejections are treated
+func (rt *Runtime) SetUnhandledRejectionMode(mode UnhandledRejectionMode) {
+	rt.rejections.mode = mode
+}
+
+// checkRejections runs at every microtask checkpoint. It emits the process
+// 'unhandledRejection' and 'rejectionHandled' events and returns an error if a
+// rejection must terminate the run.
+func (rt *Runtime) checkRejections() error {
+	for {
+		unhandled, handled := rt.rejections.take()
+		if len(unhandled) == 0 && len(handled) == 0 {
+			return nil
+		}
+
+		for _, p := range unhandled {
+			if p.State() != goja.PromiseStateRejected {
+				continue
+			}
+			if err := rt.rejections.markReported(p); err != nil {
+				return err
+			}
+			if err := rt.reportRejection(p); err != nil {
+				return err
+			}
+		}
+
+		for _, p := range handled {
+			rt.emitFromLoop("rejectionHandled", rt.VM.ToValue(p))
+		}
+
+		// A listener may have called process.exit
+		if rt.exitErr != nil {
+			return rt.exitErr
+		}
+
+		// Listeners may have queued more work or rejected more promises
+		rt.EventLoop.processMicrotasks()
+	}
+}
+
+// reportRejection applies the configured mode to a single unhandled rejection
+func (rt *Runtime) reportRejection(p *goja.Promise) error {
+	reason := p.Result()
+	modules.CleanErrorStack(rt.VM, reason)
+	rejectionErr := &UnhandledRejectionError{
+		Reason: reason,
+		Stack:  describeError(reason),
+	}
+
+	if rt.rejections.mode == UnhandledRejectionsStrict {
+		return rejectionErr
+	}
+
+	handled := rt.emitFromLoop("unhandledRejection", reason, rt.VM.ToValue(p))
+	if rt.exitErr != nil {
+		return rt.exitErr
+	}
+
+	switch rt.rejections.mode {
+	case UnhandledRejectionsWarn:
+		fmt.Fprintf(os.Stderr, "Warning: unhandled promise rejection: %s\n", rejectionErr.Stack)
+	case UnhandledRejectionsThrow:
+		if !handled {
+			return rejectionErr
+		}
+	}
+
+	return nil
+}
+
+// describeError returns the stack of an Error, or the string form of any other value
+func describeError(v goja.Value) string {
+	if v == nil || goja.IsUndefined(v) {
+		return "undefined"
+	}
+	if goja.IsNull(v) {
+		return "null"
+	}
+	if obj, ok := v.(*goja.Object); ok {
+		if stack := obj.Get("stack"); stack != nil && !goja.IsUndefined(stack) && !goja.IsNull(stack) {
+			return strings.TrimRight(modules.CleanStack(stack.String()), "\n")
+		}
+	}
+	return v.String()
+}
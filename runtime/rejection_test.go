@@ -0,0 +1,122 @@
+package runtime_test
+
+import (
+	"errors"
+	goruntime "runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"gojs/internal/jstest"
+	"gojs/runtime"
+)
+
+func TestUnhandledRejectionFailsTheRun(t *testing.T) {
+	out, err := jstest.Run(t, `
+		Promise.reject(new Error('boom'));
+		setTimeout(() => console.log('never'), 10);
+	`)
+	var rejection *runtime.UnhandledRejectionError
+	if !errors.As(err, &rejection) {
+		t.Fatalf("err = %v, want an *UnhandledRejectionError", err)
+	}
+	if !strings.HasPrefix(rejection.Stack, "Error: boom\n") {
+		t.Errorf("stack = %q, want the error's stack", rejection.Stack)
+	}
+	if out != "" {
+		t.Errorf("output = %q, want none", out)
+	}
+}
+
+func TestUnhandledRejectionListener(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		process.on('unhandledRejection', (reason, promise) => console.log('unhandled', reason, promise instanceof Promise));
+		Promise.reject('boom');
+		Promise.reject('caught').catch(() => {});
+		setTimeout(() => console.log('still running'), 10);
+	`, "unhandled boom true\nstill running\n")
+}
+
+func TestRejectionHandledLater(t *testing.T) {
+	jstest.ExpectOutput(t, `
+		process.on('unhandledRejection', (reason) => console.log('unhandled', reason));
+		process.on('rejectionHandled', (promise) => console.log('handled', promise === p));
+		const p = Promise.reject('late');
+		setTimeout(() => p.catch((reason) => console.log('caught', reason)), 10);
+	`, "unhandled late\ncaught late\nhandled true\n")
+}
+
+func TestReportedRejectionsAreNotRetained(t *testing.T) {
+	// The reason is a Go value large enough to get a finalizer of its own
+	type reason struct{ _ [64]byte }
+	collected := make(chan struct{})
+	rt := runtime.New()
+	rt.SetUnhandledRejectionMode(runtime.UnhandledRejectionsNone)
+	rt.VM.Set("newReason", func() *reason {
+		r := &reason{}
+		goruntime.SetFinalizer(r, func(*reason) { close(collected) })
+		return r
+	})
+	if _, err := rt.RunScript(`var p = Promise.reject(newReason());`, "test.js"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.RunScript(`p = undefined;`, "test.js"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		goruntime.GC()
+		select {
+		case <-collected:
+			goruntime.KeepAlive(rt)
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Error("the reported promise was never collected")
+}
+
+func TestUnhandledRejectionModes(t *testing.T) {
+	script := `
+		process.on('unhandledRejection', () => console.log('listener'));
+		Promise.reject(new Error('boom'));
+		setTimeout(() => console.log('done'), 10);
+	`
+	tests := []struct {
+		mode runtime.UnhandledRejectionMode
+		want string
+		fail bool
+	}{
+		{runtime.UnhandledRejectionsThrow, "listener\ndone\n", false},
+		{runtime.UnhandledRejectionsStrict, "", true},
+		{runtime.UnhandledRejectionsWarn, "listener\ndone\n", false},
+		{runtime.UnhandledRejectionsNone, "listener\ndone\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			var err error
+			out := jstest.Capture(t, func() {
+				rt := runtime.New()
+				rt.SetUnhandledRejectionMode(tt.mode)
+				_, err = rt.RunScript(script, "test.js")
+			})
+			if (err != nil) != tt.fail {
+				t.Errorf("err = %v, want failure: %v", err, tt.fail)
+			}
+			if out != tt.want {
+				t.Errorf("output = %q, want %q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseUnhandledRejectionMode(t *testing.T) {
+	for _, s := range []string{"throw", "strict", "warn", "none"} {
+		if mode, err := runtime.ParseUnhandledRejectionMode(s); err != nil || string(mode) != s {
+			t.Errorf("ParseUnhandledRejectionMode(%q) = %q, %v", s, mode, err)
+		}
+	}
+	if _, err := runtime.ParseUnhandledRejectionMode("loud"); err == nil {
+		t.Error("ParseUnhandledRejectionMode accepted an invalid mode")
+	}
+}
@@ -2,8 +2,10 @@ package runtime
 
 import (
 	"fmt"
-	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/dop251/goja"
@@ -14,16 +16,81 @@ import (
 type Runtime struct {
 	VM        *goja.Runtime
 	EventLoop *EventLoop
+
+	rejections *rejectionTracker
+	process    *goja.Object
+	args       []string
+	exitErr    *ExitError
+	startTime  time.Time
+
+	opts     Options
+	watching bool
+	limitMu  sync.Mutex
+	limitErr error
+}
+
+// Options configures a Runtime
+type Options struct {
+	// Permissions restricts the file system, environment and module access
+	// of scripts. Nil grants everything.
+	Permissions *modules.Permissions
+
+	// Console receives the output of the console object. Nil writes text
+	// to os.Stdout and os.Stderr.
+	Console modules.ConsoleSink
+
+	// Timeout bounds the wall-clock time of each RunFile, RunScript,
+	// RunModule or Eval call, including the event loop. Zero means no limit.
+	Timeout time.Duration
+	// MaxCallStackSize bounds the depth of nested JS calls. Zero keeps
+	// goja's default.
+	MaxCallStackSize int
+	// MaxHeapBytes bounds the Go heap while a script runs. The heap is
+	// measured for the whole process, so memory held by the host and by
+	// other runtimes counts too: this is meant for hosts running one
+	// runtime at a time. Zero means no limit.
+	MaxHeapBytes uint64
 }
 
 // New creates a new JavaScript runtime
 func New() *Runtime {
+	return NewWithOptions(Options{})
+}
+
+// NewWithOptions creates a new JavaScript runtime configured by opts
+func NewWithOptions(opts Options) *Runtime {
 	vm := goja.New()
 	loop := NewEventLoop(vm)
 
 	rt := &Runtime{
 		VM:        vm,
 		EventLoop: loop,
+		startTime: time.Now(),
+		opts:      opts,
+	}
+
+	if opts.MaxCallStackSize > 0 {
+		vm.SetMaxCallStackSize(opts.MaxCallStackSize)
+	}
+
+	// Permissions must be in place before any module is set up
+	if err := modules.SetPermissions(vm, opts.Permissions); err != nil {
+		panic(err)
+	}
+
+	// Track unhandled promise rejections at every microtask checkpoint
+	rejections, err := newRejectionTracker(vm)
+	if err != nil {
+		panic(err)
+	}
+	rt.rejections = rejections
+	vm.SetPromiseRejectionTracker(rt.rejections.track)
+	loop.checkpoint = rt.checkRejections
+	loop.uncaught = rt.uncaughtException
+
+	// Error constructors are replaced before any module captures them
+	if err := modules.SetupErrors(vm); err != nil {
+		panic(err)
 	}
 
 	// Setup global functions
@@ -35,20 +102,86 @@ func New() *Runtime {
 	}
 
 	// Setup console
-	modules.SetupConsole(vm)
+	modules.SetupConsole(vm, opts.Console)
+
+	// Setup the ES module loader, which require uses for .mjs files
+	if err := modules.SetupESM(vm, loop); err != nil {
+		panic(err)
+	}
 
 	// Setup require function first (defaults to current directory)
 	if err := modules.SetupRequire(vm, "."); err != nil {
 		panic(err)
 	}
 
-	// Setup built-in modules (fs, path) - these will be registered in the require cache
-	if err := modules.SetupFS(vm); err != nil {
+	// Setup events first, process and other modules build on EventEmitter
+	if err := modules.SetupEvents(vm); err != nil {
+		panic(err)
+	}
+
+	// Setup process
+	if err := rt.setupProcess(); err != nil {
+		panic(err)
+	}
+
+	// Setup Buffer, which fs reads binary files into
+	if err := modules.SetupBuffer(vm); err != nil {
+		panic(err)
+	}
+
+	// Setup the stream module, which other modules build their streams on
+	if err := modules.SetupStream(vm, loop); err != nil {
+		panic(err)
+	}
+
+	// Setup built-in modules (fs, path, os, util) - these will be registered in the require cache
+	if err := modules.SetupFS(vm, loop); err != nil {
 		panic(err)
 	}
 	if err := modules.SetupPath(vm); err != nil {
 		panic(err)
 	}
+	if err := modules.SetupOS(vm); err != nil {
+		panic(err)
+	}
+	if err := modules.SetupUtil(vm); err != nil {
+		panic(err)
+	}
+
+	// Setup the URL and URLSearchParams globals and the url module
+	if err := modules.SetupURL(vm); err != nil {
+		panic(err)
+	}
+
+	// Setup EventTarget and AbortController, whose timeouts fire on the loop
+	if err := modules.SetupEventTarget(vm, loop); err != nil {
+		panic(err)
+	}
+
+	// Setup ReadableStream, the body of fetch responses
+	if err := modules.SetupWebStreams(vm, loop); err != nil {
+		panic(err)
+	}
+
+	// Setup fetch, Headers, Request and Response on top of net/http
+	if err := modules.SetupFetch(vm, loop); err != nil {
+		panic(err)
+	}
+
+	// Setup http, whose servers and clients hand their work to the loop
+	if err := modules.SetupHTTP(vm, loop); err != nil {
+		panic(err)
+	}
+
+	// Setup net, whose sockets read and write on goroutines and resume on the loop
+	if err := modules.SetupNet(vm, loop); err != nil {
+		panic(err)
+	}
+
+	// Setup child_process, whose pipes are net sockets
+	if err := modules.SetupChildProcess(vm, loop); err != nil {
+		panic(err)
+	}
 
 	return rt
 }
@@ -60,31 +193,20 @@ func (rt *Runtime) setupGlobals() {
 
 	// queueMicrotask
 	vm.Set("queueMicrotask", func(call goja.FunctionCall) goja.Value {
-		if len(call.Arguments) < 1 {
-			panic(vm.ToValue("queueMicrotask requires a function argument"))
-		}
-
-		fn, ok := goja.AssertFunction(call.Arguments[0])
-		if !ok {
-			panic(vm.ToValue("queueMicrotask argument must be a function"))
+		if _, ok := goja.AssertFunction(call.Argument(0)); !ok {
+			panic(modules.ErrInvalidArgType(vm, "callback", "of type function", call.Argument(0)))
 		}
 
-		loop.QueueMicrotask(func() {
-			fn(goja.Undefined(), goja.Undefined())
-		})
+		loop.queueJob(call.Argument(0))
 
 		return goja.Undefined()
 	})
 
 	// setTimeout
 	vm.Set("setTimeout", func(call goja.FunctionCall) goja.Value {
-		if len(call.Arguments) < 1 {
-			panic(vm.ToValue("setTimeout requires at least 1 argument"))
-		}
-
-		fn, ok := goja.AssertFunction(call.Arguments[0])
+		fn, ok := goja.AssertFunction(call.Argument(0))
 		if !ok {
-			panic(vm.ToValue("setTimeout first argument must be a function"))
+			panic(modules.ErrInvalidArgType(vm, "callback", "of type function", call.Argument(0)))
 		}
 
 		delay := int64(0)
@@ -95,11 +217,13 @@ func (rt *Runtime) setupGlobals() {
 		// Capture additional arguments
 		args := make([]goja.Value, 0)
 		if len(call.Arguments) > 2 {
-			args = call.Arguments[2:]
+			args = append(args, call.Arguments[2:]...)
 		}
 
 		id := loop.SetTimeout(func() {
-			fn(goja.Undefined(), args...)
+			if _, err := fn(goja.Undefined(), args...); err != nil {
+				panic(err)
+			}
 		}, time.Duration(delay)*time.Millisecond)
 
 		return vm.ToValue(id)
@@ -119,13 +243,9 @@ func (rt *Runtime) setupGlobals() {
 
 	// setInterval
 	vm.Set("setInterval", func(call goja.FunctionCall) goja.Value {
-		if len(call.Arguments) < 1 {
-			panic(vm.ToValue("setInterval requires at least 1 argument"))
-		}
-
-		fn, ok := goja.AssertFunction(call.Arguments[0])
+		fn, ok := goja.AssertFunction(call.Argument(0))
 		if !ok {
-			panic(vm.ToValue("setInterval first argument must be a function"))
+			panic(modules.ErrInvalidArgType(vm, "callback", "of type function", call.Argument(0)))
 		}
 
 		delay := int64(0)
@@ -136,11 +256,13 @@ func (rt *Runtime) setupGlobals() {
 		// Capture additional arguments
 		args := make([]goja.Value, 0)
 		if len(call.Arguments) > 2 {
-			args = call.Arguments[2:]
+			args = append(args, call.Arguments[2:]...)
 		}
 
 		id := loop.SetInterval(func() {
-			fn(goja.Undefined(), args...)
+			if _, err := fn(goja.Undefined(), args...); err != nil {
+				panic(err)
+			}
 		}, time.Duration(delay)*time.Millisecond)
 
 		return vm.ToValue(id)
@@ -160,22 +282,20 @@ func (rt *Runtime) setupGlobals() {
 
 	// setImmediate (executes in next macrotask)
 	vm.Set("setImmediate", func(call goja.FunctionCall) goja.Value {
-		if len(call.Arguments) < 1 {
-			panic(vm.ToValue("setImmediate requires a function argument"))
-		}
-
-		fn, ok := goja.AssertFunction(call.Arguments[0])
+		fn, ok := goja.AssertFunction(call.Argument(0))
 		if !ok {
-			panic(vm.ToValue("setImmediate argument must be a function"))
+			panic(modules.ErrInvalidArgType(vm, "callback", "of type function", call.Argument(0)))
 		}
 
 		args := make([]goja.Value, 0)
 		if len(call.Arguments) > 1 {
-			args = call.Arguments[1:]
+			args = append(args, call.Arguments[1:]...)
 		}
 
 		id := loop.SetTimeout(func() {
-			fn(goja.Undefined(), args...)
+			if _, err := fn(goja.Undefined(), args...); err != nil {
+				panic(err)
+			}
 		}, 0)
 
 		return vm.ToValue(id)
@@ -197,34 +317,72 @@ func (rt *Runtime) setupGlobals() {
 	vm.Set("global", vm.GlobalObject())
 }
 
-// RunScript runs a JavaScript script
+// RunScript runs a JavaScript script, then the event loop until it has no
+// more work. A non-zero exit code is returned as an *ExitError.
 func (rt *Runtime) RunScript(script string, filename string) (goja.Value, error) {
+	if err := rt.haltErr(); err != nil {
+		return nil, err
+	}
+	defer rt.watchLimits()()
+
 	// Compile and run the script
-	prg, err := goja.Compile(filename, script, false)
+	prg, err := modules.CompileScript(filename, script)
 	if err != nil {
 		return nil, err
 	}
 
-	val, err := rt.VM.RunProgram(prg)
+	var val goja.Value
+	err = rt.EventLoop.enter(func() {
+		var runErr error
+		val, runErr = rt.VM.RunProgram(prg)
+		if runErr != nil {
+			panic(runErr)
+		}
+	})
 	if err != nil {
-		return nil, err
+		return nil, rt.exit(rt.runError(err))
 	}
 
-	// Run the event loop
-	rt.EventLoop.Run()
+	if err := rt.runLoop(); err != nil {
+		return nil, rt.exit(rt.runError(err))
+	}
 
-	return val, nil
+	return val, rt.exit(nil)
+}
+
+// runLoop runs the event loop, giving 'beforeExit' listeners a chance to
+// schedule more work each time it empties
+func (rt *Runtime) runLoop() error {
+	for {
+		if err := rt.EventLoop.Run(); err != nil {
+			return err
+		}
+
+		rt.emitFromLoop("beforeExit", rt.VM.ToValue(rt.exitCode()))
+		if rt.exitErr != nil {
+			return nil
+		}
+
+		if !rt.EventLoop.hasPendingWork() {
+			return nil
+		}
+	}
 }
 
-// RunFile runs a JavaScript file
+// RunFile runs a JavaScript file as the main CommonJS module. Files with a
+// .mjs extension, or a .js extension inside a package with "type": "module",
+// run as ES modules.
 func (rt *Runtime) RunFile(filename string) error {
+	if err := rt.haltErr(); err != nil {
+		return err
+	}
+
 	absPath, err := filepath.Abs(filename)
 	if err != nil {
 		return err
 	}
 
-	content, err := ioutil.ReadFile(absPath)
-	if err != nil {
+	if _, err := os.Stat(absPath); err != nil {
 		return fmt.Errorf("error reading file %s: %w", filename, err)
 	}
 
@@ -234,19 +392,78 @@ func (rt *Runtime) RunFile(filename string) error {
 		return err
 	}
 
-	_, err = rt.RunScript(string(content), absPath)
-	return err
+	rt.setScriptPath(absPath)
+
+	if modules.IsESModule(absPath) {
+		return rt.RunModule(absPath)
+	}
+
+	return rt.runMain(absPath)
+}
+
+// runMain runs the CommonJS module at path as the main module, then the
+// event loop until it has no more work
+func (rt *Runtime) runMain(path string) error {
+	defer rt.watchLimits()()
+
+	err := rt.EventLoop.enter(func() {
+		if err := modules.RequireMain(rt.VM, path); err != nil {
+			panic(err)
+		}
+	})
+	if err != nil {
+		return rt.exit(rt.runError(err))
+	}
+
+	if err := rt.runLoop(); err != nil {
+		return rt.exit(rt.runError(err))
+	}
+	return rt.exit(nil)
 }
 
 // Eval evaluates JavaScript code (for REPL)
 func (rt *Runtime) Eval(code string) (goja.Value, error) {
-	val, err := rt.VM.RunString(code)
-	if err != nil {
+	if err := rt.haltErr(); err != nil {
 		return nil, err
 	}
+	defer rt.watchLimits()()
+
+	var val goja.Value
+	err := rt.EventLoop.enter(func() {
+		var runErr error
+		prg, compileErr := modules.CompileScript("", code)
+		if compileErr != nil {
+			panic(modules.NewNodeError(rt.VM, "SyntaxError", "", strings.TrimPrefix(compileErr.Error(), "SyntaxError: ")))
+		}
+		val, runErr = rt.VM.RunProgram(prg)
+		if runErr != nil {
+			panic(runErr)
+		}
+	})
+	if err != nil {
+		return nil, rt.runError(err)
+	}
 
 	// Process any microtasks that were queued
-	rt.EventLoop.processMicrotasks()
+	if err := rt.EventLoop.drainMicrotasks(); err != nil {
+		return nil, rt.runError(err)
+	}
+	if rt.exitErr != nil {
+		return nil, rt.exitErr
+	}
+	// An uncaught exception from a tick ends this evaluation, not the session
+	if err := rt.EventLoop.takeFatal(); err != nil {
+		return nil, err
+	}
 
 	return val, nil
 }
+
+// runError replaces the interrupt raised by process.exit with the exit status,
+// and the one raised by an expired limit with the limit's error
+func (rt *Runtime) runError(err error) error {
+	if rt.exitErr != nil {
+		return rt.exitErr
+	}
+	return rt.limitError(err)
+}